@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/spf13/cobra"
+)
+
+// mixerCategory is the configuration category of the U64 audio mixer
+const mixerCategory = "Audio Mixer"
+
+// audioCmd represents the audio command group
+var audioCmd = &cobra.Command{
+	Use:   "audio",
+	Short: "Audio settings (U64 only)",
+	Long:  `Control the Ultimate 64 audio mixer.`,
+}
+
+var audioMixerCmd = &cobra.Command{
+	Use:   "mixer",
+	Short: "Show or change mixer volumes and panning",
+	Long: `Show or change the volume and panning of the U64 audio mixer channels
+(SIDs, UltiSIDs, sampler, drive and tape sounds).
+
+Channel names may be abbreviated to any unique part, ignoring case and
+spaces, e.g. "ultisid1", "socket 2" or "samplerl".`,
+}
+
+var audioMixerShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the mixer channels",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		channels, ok := mixerChannels()
+		if !ok {
+			return
+		}
+
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{"channels": channels})
+			return
+		}
+
+		rows := make([][]string, 0, len(channels))
+		for _, ch := range channels {
+			rows = append(rows, []string{ch.Name, ch.Volume, ch.Pan})
+		}
+		formatter.PrintTable([]string{"channel", "volume", "pan"}, rows)
+	},
+}
+
+var audioMixerSetCmd = &cobra.Command{
+	Use:   "set <channel> [volume] [--pan P] [--save]",
+	Short: "Change a channel's volume and/or panning",
+	Long: `Set the volume of a mixer channel in dB ("off" mutes it) and optionally
+its panning. The closest level the firmware supports is used.
+
+Panning is "center", "left N"/"LN", "right N"/"RN", or a number from -5
+(left) to 5 (right). Negative levels must follow "--" so they are not
+taken for flags.
+
+Examples:
+  c64u audio mixer set ultisid1 -- -6
+  c64u audio mixer set socket1 0 --pan L2
+  c64u audio mixer set sampler --pan center -- -12
+  c64u audio mixer set drive1 off
+  c64u audio mixer set ultisid2 --pan right --save`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		pan, _ := cmd.Flags().GetString("pan")
+		save, _ := cmd.Flags().GetBool("save")
+
+		if len(args) < 2 && pan == "" {
+			formatter.Error("Nothing to change", []string{"give a volume and/or --pan"})
+			return
+		}
+
+		channels, ok := mixerChannels()
+		if !ok {
+			return
+		}
+		ch, err := matchChannel(channels, args[0])
+		if err != nil {
+			formatter.Error("Unknown mixer channel", []string{err.Error()})
+			return
+		}
+
+		changed := make(map[string]interface{})
+		if len(args) == 2 {
+			if ch.volume == nil {
+				formatter.Error("Channel has no volume", []string{ch.Name})
+				return
+			}
+			value, err := mixerVolume(*ch.volume, args[1])
+			if err != nil {
+				formatter.Error("Invalid volume", []string{err.Error()})
+				return
+			}
+			if !setConfigItem(*ch.volume, value) {
+				return
+			}
+			changed["volume"] = value
+		}
+
+		if pan != "" {
+			if ch.pan == nil {
+				formatter.Error("Channel has no panning", []string{ch.Name})
+				return
+			}
+			value, err := mixerPan(*ch.pan, pan)
+			if err != nil {
+				formatter.Error("Invalid panning", []string{err.Error()})
+				return
+			}
+			if !setConfigItem(*ch.pan, value) {
+				return
+			}
+			changed["pan"] = value
+		}
+
+		if save && !saveConfigToFlash() {
+			return
+		}
+		formatter.Success(fmt.Sprintf("Mixer channel %s changed", ch.Name), changed)
+	},
+}
+
+// mixerChannel groups the volume and pan items of a mixer channel
+type mixerChannel struct {
+	Name   string `json:"name"`
+	Volume string `json:"volume,omitempty"`
+	Pan    string `json:"pan,omitempty"`
+
+	volume, pan *api.ConfigItem
+}
+
+// mixerChannels reads the mixer items, grouped by channel
+func mixerChannels() ([]*mixerChannel, bool) {
+	items, err := apiClient.ConfigItems(mixerCategory, "*")
+	if err == nil && len(items) == 0 {
+		err = fmt.Errorf("the device has no audio mixer (U64 only)")
+	}
+	if err != nil {
+		formatter.Error("Failed to read mixer settings", []string{err.Error()})
+		return nil, false
+	}
+
+	byName := make(map[string]*mixerChannel)
+	for i := range items {
+		item := &items[i]
+		kind, name, ok := strings.Cut(item.Name, " ")
+		if !ok {
+			continue
+		}
+		key := strings.ToLower(name)
+		ch := byName[key]
+		if ch == nil {
+			ch = &mixerChannel{Name: name}
+			byName[key] = ch
+		}
+
+		value := strings.TrimSpace(fmt.Sprintf("%v", item.Value))
+		switch strings.ToLower(kind) {
+		case "vol":
+			ch.volume, ch.Volume = item, value
+		case "pan":
+			ch.pan, ch.Pan = item, value
+		}
+	}
+
+	channels := make([]*mixerChannel, 0, len(byName))
+	for _, ch := range byName {
+		channels = append(channels, ch)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	return channels, true
+}
+
+// matchChannel finds a channel by unique, space-insensitive name part
+func matchChannel(channels []*mixerChannel, name string) (*mixerChannel, error) {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	}
+	want := normalize(name)
+
+	var matches []*mixerChannel
+	for _, ch := range channels {
+		n := normalize(ch.Name)
+		if n == want {
+			return ch, nil
+		}
+		if strings.Contains(n, want) {
+			matches = append(matches, ch)
+		}
+	}
+
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return nil, fmt.Errorf("no channel matches '%s'", name)
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = m.Name
+	}
+	return nil, fmt.Errorf("'%s' is ambiguous: %s", name, strings.Join(names, ", "))
+}
+
+// mixerVolume maps "off" or a dB level to a volume option
+func mixerVolume(item api.ConfigItem, volume string) (string, error) {
+	options := configOptions(item)
+	if strings.EqualFold(volume, "off") {
+		if opt, ok := matchOption(options, "OFF"); ok {
+			return opt, nil
+		}
+		return "OFF", nil
+	}
+
+	db, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(strings.ReplaceAll(volume, " ", "")), "db"))
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not a level in dB or off", volume)
+	}
+	if level, ok := closestLevel(options, db); ok {
+		return level, nil
+	}
+	return fmt.Sprintf("%d dB", db), nil
+}
+
+// mixerPan maps a panning argument to a pan option
+func mixerPan(item api.ConfigItem, pan string) (string, error) {
+	p := strings.ToLower(strings.ReplaceAll(pan, " ", ""))
+
+	var side string
+	var amount int
+	switch {
+	case p == "center" || p == "c" || p == "0":
+		side = "Center"
+	case strings.HasPrefix(p, "left"), strings.HasPrefix(p, "l"):
+		side, amount = "Left", panAmount(strings.TrimPrefix(strings.TrimPrefix(p, "left"), "l"))
+	case strings.HasPrefix(p, "right"), strings.HasPrefix(p, "r"):
+		side, amount = "Right", panAmount(strings.TrimPrefix(strings.TrimPrefix(p, "right"), "r"))
+	default:
+		n, err := strconv.Atoi(p)
+		if err != nil || n < -5 || n > 5 {
+			return "", fmt.Errorf("'%s' is not center, left N, right N or -5..5", pan)
+		}
+		side, amount = "Right", n
+		if n < 0 {
+			side, amount = "Left", -n
+		}
+	}
+	if amount < 0 {
+		return "", fmt.Errorf("'%s' is not center, left N, right N or -5..5", pan)
+	}
+
+	value := side
+	if side != "Center" {
+		value = fmt.Sprintf("%s %d", side, amount)
+	}
+	options := configOptions(item)
+	if opt, ok := matchOption(options, value); ok {
+		return opt, nil
+	}
+	if len(options) > 0 {
+		return "", fmt.Errorf("'%s' is not supported; options: %s", value, strings.Join(options, ", "))
+	}
+	return value, nil
+}
+
+// panAmount parses the number after left/right; an empty string means
+// fully panned
+func panAmount(s string) int {
+	if s == "" {
+		return 5
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func init() {
+	audioMixerSetCmd.Flags().String("pan", "", "Panning: center, left N, right N or -5..5")
+	audioMixerSetCmd.Flags().Bool("save", false, "Save the configuration to flash")
+	addPreserveFlags(audioMixerSetCmd)
+
+	audioMixerCmd.AddCommand(audioMixerShowCmd)
+	audioMixerCmd.AddCommand(audioMixerSetCmd)
+	audioCmd.AddCommand(audioMixerCmd)
+}
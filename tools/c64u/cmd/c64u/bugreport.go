@@ -0,0 +1,216 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/transcript"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Bug Report
+// ============================================================================
+
+var bugreportCmd = &cobra.Command{
+	Use:   "bugreport [-o FILE] [--entries N]",
+	Short: "Collect diagnostics into a zip file for a bug report",
+	Long: `Write a zip file to attach to a GitHub issue, with:
+
+  version.json        c64u version, build and platform
+  config.json         the resolved configuration, passwords and tokens redacted
+  device.json         /v1/version and /v1/info, or why they failed
+  transcript.jsonl    the last --entries transcript entries
+  last-failure.json   the last failed request and the command that sent it
+
+The transcript entries and the last failure come from the transcript file
+(--transcript or "transcript" in config.toml); without one they are
+missing, so enable it and reproduce the problem first. Transcript flags
+named like passwords or tokens are redacted too, but host names, file
+names and response bodies are included: look through the files before
+attaching them.
+
+Examples:
+  c64u bugreport
+  c64u bugreport -o report.zip --entries 500`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, _ := cmd.Flags().GetString("output")
+		count, _ := cmd.Flags().GetInt("entries")
+		if path == "" {
+			path = "c64u-bugreport-" + time.Now().Format("20060102-150405") + ".zip"
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			formatter.Error("Failed to load config", []string{err.Error()})
+			return
+		}
+
+		files := map[string]interface{}{
+			"version.json": map[string]interface{}{
+				"version":  version,
+				"commit":   commit,
+				"date":     date,
+				"go":       runtime.Version(),
+				"platform": runtime.GOOS + "/" + runtime.GOARCH,
+				"build":    buildInfo(),
+			},
+			"config.json": map[string]interface{}{
+				"config_file": config.GetConfigPath(),
+				"device":      fmt.Sprintf("%s:%d", host, port),
+				"settings":    config.Redacted(),
+			},
+		}
+
+		transcriptPath := cfg.Transcript
+		if cmd.Flags().Changed("transcript") {
+			transcriptPath = transcriptFile
+		}
+
+		// The transcript is read before this command's own requests land in it
+		summary := map[string]interface{}{"file": path}
+		var entries []transcript.Entry
+		if transcriptPath != "" {
+			all, err := transcript.Read(transcriptPath)
+			if err != nil {
+				formatter.Warning(fmt.Sprintf("Cannot read the transcript: %v", err))
+			}
+			entries = all[max(0, len(all)-count):]
+			if failure := lastFailure(all); failure != nil {
+				files["last-failure.json"] = failure
+				summary["last_failure"] = failure["request"].(transcript.Entry).URL
+			} else {
+				summary["last_failure"] = "none in the transcript"
+			}
+			summary["transcript_entries"] = len(entries)
+		} else {
+			summary["transcript_entries"] = "no transcript configured"
+		}
+
+		device := map[string]interface{}{}
+		for name, call := range map[string]func() (*api.Response, error){
+			"version": apiClient.Endpoints().Version,
+			"info":    apiClient.GetInfo,
+		} {
+			resp, err := call()
+			switch {
+			case err != nil:
+				device[name] = map[string]interface{}{"error": err.Error()}
+			case resp.HasErrors():
+				device[name] = map[string]interface{}{"errors": resp.Errors}
+			default:
+				device[name] = resp.Data
+			}
+		}
+		files["device.json"] = device
+		if info, ok := device["info"].(map[string]interface{}); ok && info["error"] != nil {
+			summary["device"] = "unreachable"
+		} else {
+			summary["device"] = "reachable"
+		}
+
+		if err := writeBugReport(path, files, entries); err != nil {
+			formatter.Error("Failed to write bug report", []string{err.Error()})
+			return
+		}
+		formatter.Success("Bug report written; review it before attaching", summary)
+	},
+}
+
+// lastFailure returns the last failed request in the transcript and the
+// command of the process that sent it
+func lastFailure(entries []transcript.Entry) map[string]interface{} {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Failed() {
+			continue
+		}
+		failure := map[string]interface{}{"request": redactEntry(entries[i])}
+		for j := i - 1; j >= 0; j-- {
+			if entries[j].Type == "command" && entries[j].PID == entries[i].PID {
+				failure["command"] = redactEntry(entries[j])
+				break
+			}
+		}
+		return failure
+	}
+	return nil
+}
+
+// redactEntry hides the values of password and token flags
+func redactEntry(e transcript.Entry) transcript.Entry {
+	if len(e.Flags) == 0 {
+		return e
+	}
+	flags := make(map[string]string, len(e.Flags))
+	for name, value := range e.Flags {
+		if strings.Contains(name, "password") || strings.Contains(name, "token") {
+			value = "REDACTED"
+		}
+		flags[name] = value
+	}
+	e.Flags = flags
+	return e
+}
+
+// writeBugReport writes the JSON files and the transcript entries to a zip
+// file
+func writeBugReport(path string, files map[string]interface{}, entries []transcript.Entry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+	add := func(name string, write func(w *json.Encoder) error) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		return write(json.NewEncoder(w))
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	err = nil
+	for _, name := range names {
+		if err = add(name, func(enc *json.Encoder) error {
+			enc.SetIndent("", "  ")
+			return enc.Encode(files[name])
+		}); err != nil {
+			break
+		}
+	}
+	if err == nil && entries != nil {
+		err = add("transcript.jsonl", func(enc *json.Encoder) error {
+			for _, e := range entries {
+				if err := enc.Encode(redactEntry(e)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func init() {
+	bugreportCmd.Flags().StringP("output", "o", "", "Zip file to write (default c64u-bugreport-<time>.zip)")
+	bugreportCmd.Flags().Int("entries", 200, "Number of recent transcript entries to include")
+}
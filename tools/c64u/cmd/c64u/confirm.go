@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// confirm asks for confirmation on the terminal. With yes set (or
+// assume_yes in config.toml) it returns true without asking; without a
+// terminal it refuses.
+func confirm(prompt string, yes bool) bool {
+	// Destructive commands cannot succeed in read-only mode; say so before
+	// asking
+	if !requireWritable() {
+		return false
+	}
+	if yes || assumeYes {
+		return true
+	}
+	if !output.IsTerminal(os.Stdin) {
+		formatter.Error("Confirmation required", []string{"stdin is not a terminal; use --yes to proceed without confirmation"})
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	formatter.Info("Aborted")
+	return false
+}
+
+// confirmCmd asks for confirmation of a destructive command, honoring its
+// --yes flag
+func confirmCmd(cmd *cobra.Command, prompt string) bool {
+	yes, _ := cmd.Flags().GetBool("yes")
+	return confirm(prompt, yes)
+}
+
+// requireWritable refuses a state-changing command in read-only mode. The
+// API and FTP clients refuse changes on their own; this is for commands that
+// reach the device another way (power backends, telnet).
+func requireWritable() bool {
+	if readOnly {
+		formatter.Error("Read-only mode", []string{
+			"State-changing commands are disabled (--read-only or read_only in config.toml)",
+		})
+		return false
+	}
+	return true
+}
+
+// addYesFlag registers the --yes flag used by confirmCmd
+func addYesFlag(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		c.Flags().BoolP("yes", "y", false, "Do not ask for confirmation")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/telnet"
+	"github.com/spf13/cobra"
+)
+
+// consoleEscape (Ctrl-]) ends an interactive console session, as in telnet(1)
+const consoleEscape = 0x1D
+
+// consoleLinger is how long output is still shown after piped input ends
+const consoleLinger = time.Second
+
+var consoleCmd = &cobra.Command{
+	Use:   "console [--log FILE] [--telnet-port N]",
+	Short: "Connect to the Ultimate's telnet console",
+	Long: `Connect the terminal to the telnet interface of the C64 Ultimate, which
+offers the same menus as the device's own UI (browse files, configure,
+reset, diagnostics) from a remote terminal.
+
+The host comes from the configuration as for all other commands, the port
+from telnet_port (default 23). Press Ctrl-] to quit. With --log, everything
+the device sends is appended to a file as well.
+
+Input can also be piped in, e.g. to script menu keystrokes; the session
+ends shortly after the input does.
+
+Examples:
+  c64u console
+  c64u console --log console.log
+  c64u --host 192.168.1.64 console --telnet-port 2323`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logPath, _ := cmd.Flags().GetString("log")
+		// The menu can change anything, so it is not available read-only
+		if !requireWritable() {
+			return
+		}
+		if cmd.Flags().Changed("telnet-port") {
+			telnetPort, _ = cmd.Flags().GetInt("telnet-port")
+		}
+
+		var out io.Writer = os.Stdout
+		if logPath != "" {
+			logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				formatter.Error("Cannot open log file", []string{err.Error()})
+				return
+			}
+			defer logFile.Close()
+			fmt.Fprintf(logFile, "--- %s:%d %s ---\n", host, telnetPort, time.Now().Format(time.RFC3339))
+			out = io.MultiWriter(os.Stdout, logFile)
+		}
+
+		conn, err := telnet.Dial(host, telnetPort, 10*time.Second)
+		if err != nil {
+			formatter.Error("Failed to connect", []string{err.Error()})
+			return
+		}
+		defer conn.Close()
+
+		interactive := output.IsTerminal(os.Stdin) && output.IsTerminal(os.Stdout)
+		if interactive {
+			if w, h, err := term.GetSize(os.Stdout.Fd()); err == nil {
+				conn.SetSize(w, h)
+			}
+			fmt.Fprintf(os.Stderr, "Connected to %s:%d (Ctrl-] to quit)\n", host, telnetPort)
+			state, err := term.MakeRaw(os.Stdin.Fd())
+			if err != nil {
+				formatter.Error("Cannot switch the terminal to raw mode", []string{err.Error()})
+				return
+			}
+			defer term.Restore(os.Stdin.Fd(), state)
+			output.OnExit(func(int) { term.Restore(os.Stdin.Fd(), state) })
+		}
+
+		closed := make(chan error, 1)
+		go func() {
+			_, err := io.Copy(out, conn)
+			closed <- err
+		}()
+
+		inputDone := make(chan error, 1)
+		go func() {
+			inputDone <- forwardConsoleInput(conn, interactive)
+		}()
+
+		select {
+		case <-closed:
+			if interactive {
+				fmt.Fprint(os.Stderr, "\r\nConnection closed by the device\r\n")
+			}
+		case err := <-inputDone:
+			if err != nil && err != io.EOF {
+				formatter.Warning(err.Error())
+			}
+			if !interactive {
+				select {
+				case <-closed:
+				case <-time.After(consoleLinger):
+				}
+			}
+		}
+	},
+}
+
+// forwardConsoleInput sends stdin to the console until the escape key (in
+// interactive sessions) or the end of input
+func forwardConsoleInput(conn *telnet.Conn, interactive bool) error {
+	buf := make([]byte, 256)
+	for {
+		n, err := os.Stdin.Read(buf)
+		data := buf[:n]
+		if interactive {
+			for i, b := range data {
+				if b == consoleEscape {
+					_, werr := conn.Write(data[:i])
+					return werr
+				}
+			}
+		}
+		if len(data) > 0 {
+			if _, werr := conn.Write(data); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func init() {
+	consoleCmd.Flags().String("log", "", "Append the session output to this file")
+	consoleCmd.Flags().Int("telnet-port", telnet.DefaultPort, "Telnet port (default from telnet_port)")
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Text Conversion
+// ============================================================================
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert text between ASCII, PETSCII and screen codes",
+	Long: `Convert a file or stdin to the encoding named by the subcommand, e.g.
+text to PETSCII for a SEQ file or to screen codes for
+"machine write-mem-file". --from names the input encoding: ascii,
+petscii or screencode.
+
+ASCII text may contain {name} and {$hh} escapes as with "keys type", such
+as {clr}, {rvs on} or {$C1}. --lowercase is for the lowercase/uppercase
+character set, where lowercase letters are unshifted and uppercase
+letters shifted; without it both cases become uppercase.
+
+The result goes to stdout or to the -o file; binary output is not written
+to a terminal.`,
+}
+
+var convertPetsciiCmd = &cobra.Command{
+	Use:   "petscii [file|-] [--from ascii|screencode] [-o FILE]",
+	Short: "Convert text or screen codes to PETSCII",
+	Long: `Convert ASCII text (default) or screen codes to PETSCII. Newlines
+become RETURN. Screen codes are split into --width columns per line,
+trailing spaces removed, with RVS ON and RVS OFF around reversed
+characters.
+
+Examples:
+  c64u convert petscii readme.txt -o readme.seq
+  c64u convert petscii --lowercase -o title.bin <<< 'Hello {rvs on}World'
+  c64u convert petscii --from screencode screen.bin -o screen.seq`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runConvert(cmd, args, "petscii")
+	},
+}
+
+var convertASCIICmd = &cobra.Command{
+	Use:   "ascii [file|-] [--from petscii|screencode] [--strip] [-o FILE]",
+	Short: "Convert PETSCII or screen codes to ASCII text",
+	Long: `Convert PETSCII (default) or screen codes to ASCII text. RETURN
+becomes a newline; codes without an ASCII character, such as colors and
+graphics, are written as {$hh}, so "convert petscii" turns the text back
+into the same codes. --strip leaves them out instead.
+
+Examples:
+  c64u convert ascii readme.seq
+  c64u convert ascii --from screencode --strip screen.bin`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runConvert(cmd, args, "ascii")
+	},
+}
+
+var convertScreencodeCmd = &cobra.Command{
+	Use:   "screencode [file|-] [--from ascii|petscii] [--width N] [-o FILE]",
+	Short: "Convert text or PETSCII to screen codes",
+	Long: `Convert ASCII text (default) or PETSCII to the screen codes of screen
+memory. Each line is filled with spaces to --width columns (40; 0 runs
+lines together), {rvs on} and {rvs off} set the reverse bit, and other
+control codes, which have no screen code, are left out.
+
+Examples:
+  c64u convert screencode title.txt -o title.bin
+  c64u machine write-mem-file 0400 title.bin`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runConvert(cmd, args, "screencode")
+	},
+}
+
+// convertMissing is what the codes left out in a conversion lack
+var convertMissing = map[string]string{"ascii": "ASCII character", "screencode": "screen code"}
+
+// runConvert converts the input to the target encoding through PETSCII
+func runConvert(cmd *cobra.Command, args []string, target string) {
+	from, _ := cmd.Flags().GetString("from")
+	outPath, _ := cmd.Flags().GetString("output")
+	lower, _ := cmd.Flags().GetBool("lowercase")
+	width, _ := cmd.Flags().GetInt("width")
+	strip, _ := cmd.Flags().GetBool("strip")
+
+	if from == "" {
+		from = "ascii"
+		if target == "ascii" {
+			from = "petscii"
+		}
+	}
+	switch {
+	case from != "ascii" && from != "petscii" && from != "screencode":
+		formatter.Error("Invalid input encoding", []string{"--from must be ascii, petscii or screencode"})
+		return
+	case from == target:
+		formatter.Error("Nothing to convert", []string{"the input is already " + target})
+		return
+	case width < 0:
+		formatter.Error("Invalid width", []string{"--width must be 0 or more"})
+		return
+	}
+	toStdout := outPath == "" || outPath == "-"
+	if toStdout && target != "ascii" && output.IsTerminal(os.Stdout) {
+		formatter.Error("Binary output to a terminal", []string{"Write it to a file with -o FILE, or pipe it, e.g. into xxd"})
+		return
+	}
+
+	var data []byte
+	var err error
+	if len(args) == 0 || args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		formatter.Error("Failed to read input", []string{err.Error()})
+		return
+	}
+
+	var codes []byte
+	switch from {
+	case "ascii":
+		text := strings.ReplaceAll(string(data), "\r\n", "\n")
+		if codes, err = petscii.FromASCII(text, lower); err != nil {
+			formatter.Error("Cannot convert text", []string{err.Error()})
+			return
+		}
+	case "petscii":
+		codes = data
+	case "screencode":
+		codes = petscii.FromScreenCodes(data, width)
+	}
+
+	var out []byte
+	dropped := 0
+	switch target {
+	case "petscii":
+		out = codes
+	case "ascii":
+		var text string
+		text, dropped = petscii.ToASCII(codes, lower, strip)
+		out = []byte(text)
+	case "screencode":
+		out, dropped = petscii.ToScreenCodes(codes, width)
+	}
+
+	if toStdout {
+		os.Stdout.Write(out)
+		if dropped > 0 && !jsonOut {
+			formatter.Warning(fmt.Sprintf("Left out %s with no %s", plural(dropped, "code"), convertMissing[target]))
+		}
+		return
+	}
+	if err := os.WriteFile(outPath, out, 0644); err != nil {
+		formatter.Error("Failed to write output", []string{err.Error()})
+		return
+	}
+	summary := map[string]interface{}{
+		"from":  from,
+		"to":    target,
+		"bytes": len(out),
+	}
+	if dropped > 0 {
+		summary["left_out"] = dropped
+	}
+	formatter.Success("Converted to "+outPath, summary)
+}
+
+func init() {
+	convertCmd.AddCommand(convertPetsciiCmd)
+	convertCmd.AddCommand(convertASCIICmd)
+	convertCmd.AddCommand(convertScreencodeCmd)
+	for _, c := range []*cobra.Command{convertPetsciiCmd, convertASCIICmd, convertScreencodeCmd} {
+		c.Flags().String("from", "", "Input encoding: ascii, petscii or screencode")
+		c.Flags().StringP("output", "o", "", "Write to this file instead of stdout")
+		c.Flags().Bool("lowercase", false, "Text is for the lowercase/uppercase character set")
+	}
+	for _, c := range []*cobra.Command{convertPetsciiCmd, convertScreencodeCmd} {
+		c.Flags().Int("width", 40, "Screen columns per line")
+	}
+	convertASCIICmd.Flags().Int("width", 40, "Screen columns per line of screen code input")
+	convertASCIICmd.Flags().Bool("strip", false, "Leave out codes without an ASCII character instead of writing {$hh}")
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/fuse"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/mounts"
+	"github.com/spf13/cobra"
+)
+
+// d64Cmd represents the d64 command group
+var d64Cmd = &cobra.Command{
+	Use:   "d64",
+	Short: "Work with local D64/D71/D81/DNP disk images",
+	Long: `Inspect and edit D64, D71, D81 and DNP disk images on this computer,
+including D81 partitions and DNP subdirectories.`,
+}
+
+var d64MountfsCmd = &cobra.Command{
+	Use:   "mountfs <image> <mountpoint> [--dir PATH] [--drive N] [--read-only]",
+	Short: "Mount a disk image's files as a local file system",
+	Long: `Expose the files of a local D64, D71, D81 or DNP image as a FUSE file
+system, so that standard tools can list, copy, edit and delete them. Runs until
+unmounted with Ctrl-C (or umount/fusermount -u).
+
+File names are shown in lowercase with the file type as extension, e.g.
+"giana sisters.prg"; capitals stand for shifted letters and characters
+without a host equivalent are written as %XX. Copying in a file without a
+known type extension stores it as a PRG. Each changed file is written to
+the image when it is closed. D81 partitions and DNP subdirectories are not
+shown; --dir mounts one of them instead of the root directory.
+
+With --drive the image is uploaded and mounted on that drive of the
+Ultimate after unmounting, if anything was changed. --read-only (or
+read_only in config.toml) mounts the image read-only.
+
+Linux only; needs /dev/fuse (and fusermount3 when not run as root).
+
+Examples:
+  c64u d64 mountfs games.d64 /mnt/disk
+  c64u d64 mountfs work.d81 ~/disk --drive a
+  c64u d64 mountfs archive.d64 /mnt/disk --read-only
+  c64u d64 mountfs tools.dnp /mnt/disk --dir games/arcade`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		imagePath, mountpoint := args[0], args[1]
+		drive, _ := cmd.Flags().GetString("drive")
+		dirPath, _ := cmd.Flags().GetString("dir")
+
+		img, err := openImageDir(imagePath, dirPath)
+		if err != nil {
+			formatter.Error("Cannot open disk image", []string{err.Error()})
+			return
+		}
+		st, err := os.Stat(imagePath)
+		if err != nil {
+			formatter.Error("Cannot open disk image", []string{err.Error()})
+			return
+		}
+		fsys := &imageFS{img: img, path: imagePath, modTime: st.ModTime()}
+
+		opts := fuse.Options{
+			Name:     filepath.Base(imagePath),
+			ReadOnly: readOnly,
+			Errors: func(op, path string, err error) {
+				formatter.Warning(fmt.Sprintf("%s %s: %v", op, path, err))
+			},
+		}
+		if verbose {
+			opts.Debug = func(msg string) { fmt.Fprintln(os.Stderr, msg) }
+		}
+		srv, err := fuse.Mount(mountpoint, fsys, opts)
+		if err != nil {
+			formatter.Error("Failed to mount disk image", []string{err.Error()})
+			return
+		}
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(stop)
+		go func() {
+			for range stop {
+				if err := srv.Unmount(); err != nil {
+					formatter.Warning(err.Error())
+				}
+			}
+		}()
+
+		formatter.Info(fmt.Sprintf("Mounted %s at %s (Ctrl-C to unmount)", filepath.Base(imagePath), srv.Dir()))
+		if err := srv.Serve(); err != nil {
+			formatter.Error("File system failed", []string{err.Error()})
+			return
+		}
+
+		data := map[string]interface{}{
+			"image":      imagePath,
+			"mountpoint": srv.Dir(),
+			"changed":    fsys.changed,
+		}
+		if drive != "" && fsys.changed {
+			resp, err := uploadChangedImage(drive, imagePath, img.Format)
+			if err != nil {
+				formatter.Error("Failed to upload and mount image", []string{err.Error()})
+				return
+			}
+			if resp.HasErrors() {
+				formatter.Error("API returned errors", resp.Errors)
+				return
+			}
+			data["drive"] = drive
+		}
+		formatter.Success("Disk image unmounted", data)
+	},
+}
+
+// uploadChangedImage mounts an edited image on a drive of the device
+func uploadChangedImage(drive, imagePath string, format diskimage.Format) (*api.Response, error) {
+	prev, _ := currentMount(drive)
+	resp, err := apiClient.DrivesMountUpload(drive, imagePath, format.String(), "")
+	if err != nil || resp.HasErrors() {
+		return resp, err
+	}
+	abs, _ := filepath.Abs(imagePath)
+	recordMount(drive, &mounts.Mount{Image: abs, Uploaded: true, Type: format.String()}, prev)
+	return resp, nil
+}
+
+// =============================================================================
+// Image file system
+// =============================================================================
+
+// imageFS serves the files of a disk image, saving the image after every
+// change
+type imageFS struct {
+	img     *diskimage.Image
+	path    string
+	modTime time.Time
+	changed bool
+}
+
+// find returns the directory entry shown as the file at p. Names that
+// convert to an entry are found too, so a file copied in as "game" can be
+// opened under that name although it is listed as "game.prg".
+func (f *imageFS) find(p string) (diskimage.File, error) {
+	name := strings.TrimPrefix(p, "/")
+	if name == "" || strings.Contains(name, "/") {
+		return diskimage.File{}, fs.ErrNotExist
+	}
+	files, err := f.img.Files()
+	if err != nil {
+		return diskimage.File{}, err
+	}
+	for _, file := range files {
+		if !file.IsDir() && diskimage.HostName(file) == name {
+			return file, nil
+		}
+	}
+	if petscii, typ, err := diskimage.ParseHostName(name); err == nil {
+		for _, file := range files {
+			if !file.IsDir() && bytes.Equal(file.Name, petscii) && file.Type == typ {
+				return file, nil
+			}
+		}
+	}
+	return diskimage.File{}, fs.ErrNotExist
+}
+
+// parse converts a path to a PETSCII name and file type
+func (f *imageFS) parse(p string) ([]byte, diskimage.FileType, error) {
+	name := strings.TrimPrefix(p, "/")
+	if strings.Contains(name, "/") {
+		return nil, 0, fuse.ErrNotSupported
+	}
+	petscii, typ, err := diskimage.ParseHostName(name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", fs.ErrInvalid, err)
+	}
+	return petscii, typ, nil
+}
+
+// save writes the image back after a change
+func (f *imageFS) save() error {
+	if err := f.img.Save(f.path); err != nil {
+		return err
+	}
+	f.changed = true
+	f.modTime = time.Now()
+	return nil
+}
+
+// imageErr maps disk image errors to file system errors
+func imageErr(err error) error {
+	switch {
+	case errors.Is(err, diskimage.ErrDiskFull), errors.Is(err, diskimage.ErrDirFull):
+		return fmt.Errorf("%w: %v", fuse.ErrNoSpace, err)
+	case errors.Is(err, diskimage.ErrNotFound):
+		return fs.ErrNotExist
+	case errors.Is(err, diskimage.ErrUnsupported):
+		return fmt.Errorf("%w: %v", fuse.ErrNotSupported, err)
+	}
+	return err
+}
+
+func (f *imageFS) Stat(p string) (fuse.Attr, error) {
+	if p == "/" {
+		return fuse.Attr{Dir: true, ModTime: f.modTime}, nil
+	}
+	file, err := f.find(p)
+	if err != nil {
+		return fuse.Attr{}, err
+	}
+	data, err := f.img.ReadFile(file)
+	if err != nil {
+		return fuse.Attr{}, err
+	}
+	return fuse.Attr{Size: int64(len(data)), ModTime: f.modTime}, nil
+}
+
+func (f *imageFS) ReadDir(p string) ([]fuse.DirEntry, error) {
+	if p != "/" {
+		return nil, fuse.ErrNotDir
+	}
+	files, err := f.img.Files()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var entries []fuse.DirEntry
+	for _, file := range files {
+		name := diskimage.HostName(file)
+		if !file.IsDir() && !seen[name] {
+			seen[name] = true
+			entries = append(entries, fuse.DirEntry{Name: name})
+		}
+	}
+	return entries, nil
+}
+
+func (f *imageFS) ReadFile(p string) ([]byte, error) {
+	file, err := f.find(p)
+	if err != nil {
+		return nil, err
+	}
+	return f.img.ReadFile(file)
+}
+
+func (f *imageFS) WriteFile(p string, data []byte) error {
+	name, typ, err := f.parse(p)
+	if err != nil {
+		return err
+	}
+	if old, err := f.img.Find(name); err == nil {
+		if old.Locked {
+			return fs.ErrPermission
+		}
+		if old.Type != typ {
+			return fmt.Errorf("%w: %s is a %s file", fs.ErrExist, diskimage.HostName(old), old.Type)
+		}
+	}
+	if err := f.img.WriteFile(name, typ, data); err != nil {
+		return imageErr(err)
+	}
+	return f.save()
+}
+
+func (f *imageFS) Remove(p string) error {
+	file, err := f.find(p)
+	if err != nil {
+		return err
+	}
+	if file.Locked {
+		return fs.ErrPermission
+	}
+	if err := f.img.Delete(file.Name); err != nil {
+		return imageErr(err)
+	}
+	return f.save()
+}
+
+func (f *imageFS) Rename(oldPath, newPath string) error {
+	file, err := f.find(oldPath)
+	if err != nil {
+		return err
+	}
+	name, typ, err := f.parse(newPath)
+	if err != nil {
+		return err
+	}
+	if file.Locked {
+		return fs.ErrPermission
+	}
+	if err := f.img.Rename(file.Name, name); err != nil {
+		return imageErr(err)
+	}
+	if typ != file.Type {
+		if err := f.img.SetType(name, typ); err != nil {
+			return imageErr(err)
+		}
+	}
+	return f.save()
+}
+
+func (f *imageFS) Mkdir(p string) error {
+	return fuse.ErrNotSupported
+}
+
+func (f *imageFS) Rmdir(p string) error {
+	return fuse.ErrNotDir
+}
+
+func (f *imageFS) StatFS() (fuse.StatFS, error) {
+	free := f.img.FreeBlocks()
+	used := 0
+	if files, err := f.img.Files(); err == nil {
+		for _, file := range files {
+			used += file.Blocks
+		}
+	}
+	return fuse.StatFS{BlockSize: 254, Blocks: uint64(free + used), Free: uint64(free)}, nil
+}
+
+func init() {
+	d64Cmd.AddCommand(d64MountfsCmd)
+	d64MountfsCmd.Flags().String("dir", "", "Mount this D81 partition or DNP subdirectory, e.g. games/arcade")
+	d64MountfsCmd.Flags().String("drive", "", "Upload and mount the image on this drive after unmounting, if it changed")
+}
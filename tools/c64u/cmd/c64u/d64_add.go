@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// Adding host files to images
+// =============================================================================
+
+var d64AddCmd = &cobra.Command{
+	Use:   "add <image> <file>... [--dir PATH] [--replace] [--long-names truncate|squeeze|error]",
+	Short: "Write local files into a disk image",
+	Long: `Write local files into a D64, D71, D81 or DNP image, named like
+"d64 mountfs" shows them: lowercase letters become the C64's uppercase,
+the extension gives the type (game.prg, notes.seq; other files are PRGs),
+and %XX stands for any PETSCII code. --dir selects a D81 partition or DNP
+subdirectory.
+
+Names longer than 16 characters do not fit a directory entry. They are
+truncated, or with --long-names squeeze first lose vowels inside words
+and then spaces; --long-names error refuses them. If a shortened name is
+already taken, its last characters become " 2", " 3" and so on (set
+[filenames] long_names and unique_suffix in config.toml to change the
+defaults). The table shows which file got which name.
+
+Files whose name is already in the image are skipped unless --replace is
+given; shortened names never replace a file. The image is only written
+when every file fits.
+
+Examples:
+  c64u d64 add games.d64 giana.prg "the great giana sisters intro.prg"
+  c64u d64 add music.d81 *.prg --dir sid --long-names squeeze`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		dirPath, _ := cmd.Flags().GetString("dir")
+		replace, _ := cmd.Flags().GetBool("replace")
+		imagePath := args[0]
+
+		names, ok := imageNameShortener(cmd)
+		if !ok {
+			return
+		}
+		img, err := openImageDir(imagePath, dirPath)
+		if err != nil {
+			formatter.Error("Cannot open disk image", []string{err.Error()})
+			return
+		}
+		existing, err := img.Files()
+		if err != nil {
+			formatter.Error("Failed to read directory", []string{err.Error()})
+			return
+		}
+		for _, f := range existing {
+			names.Reserve(f.Name)
+		}
+
+		// Names that fit are taken first, so a shortened name never takes
+		// the place of a file given by its full name
+		type addFile struct {
+			source    string
+			name      []byte
+			typ       diskimage.FileType
+			shortened bool
+		}
+		files := make([]addFile, 0, len(args)-1)
+		given := make(map[string]string)
+		for _, p := range args[1:] {
+			name, typ, err := diskimage.ParseLongHostName(filepath.Base(p))
+			if err != nil {
+				formatter.Error("Invalid file name", []string{err.Error(), "Write characters without a PETSCII equivalent as %XX"})
+				return
+			}
+			f := addFile{source: p, name: name, typ: typ}
+			if len(name) <= 16 {
+				if other, ok := given[string(name)]; ok {
+					formatter.Error("Names clash", []string{fmt.Sprintf("%s and %s both become %s", other, p, petscii.ToEscaped(name))})
+					return
+				}
+				given[string(name)] = p
+			}
+			files = append(files, f)
+		}
+		for name := range given {
+			names.Reserve([]byte(name))
+		}
+		for i, f := range files {
+			if len(f.name) <= 16 {
+				continue
+			}
+			if files[i].name, err = names.Fit(f.name); errors.Is(err, diskimage.ErrNameTooLong) {
+				formatter.Error("File name too long", []string{
+					fmt.Sprintf("%s: %v", f.source, err),
+					"Rename the file, or use --long-names truncate or squeeze",
+				})
+				return
+			}
+			files[i].shortened = true
+		}
+
+		var added [][]string
+		var skipped []string
+		var mapping []map[string]interface{}
+		blocks, shortened := 0, 0
+		for _, f := range files {
+			name := petscii.ToEscaped(f.name)
+			if old, err := img.Find(f.name); err == nil && (!replace || old.IsDir() || f.shortened) {
+				skipped = append(skipped, fmt.Sprintf("%s: %s exists in %s", f.source, name, imagePath))
+				continue
+			}
+			data, err := os.ReadFile(f.source)
+			if err != nil {
+				formatter.Error("Failed to read file", []string{err.Error()})
+				return
+			}
+			if err := img.WriteFile(f.name, f.typ, data); err != nil {
+				formatter.Error(fmt.Sprintf("Failed to add %s", f.source), []string{
+					err.Error(),
+					fmt.Sprintf("%s was not changed", imagePath),
+				})
+				return
+			}
+			stored, _ := img.Find(f.name)
+			blocks += stored.Blocks
+			if f.shortened {
+				shortened++
+			}
+			added = append(added, []string{name, f.typ.String(), strconv.Itoa(stored.Blocks), f.source})
+			mapping = append(mapping, map[string]interface{}{
+				"name":      name,
+				"type":      f.typ.String(),
+				"source":    f.source,
+				"shortened": f.shortened,
+			})
+		}
+
+		if len(added) == 0 {
+			formatter.Error("Nothing added", skipped)
+			return
+		}
+		if err := img.Save(imagePath); err != nil {
+			formatter.Error("Failed to write disk image", []string{err.Error()})
+			return
+		}
+
+		data := map[string]interface{}{
+			"image":       imagePath,
+			"added":       len(added),
+			"blocks":      blocks,
+			"blocks_free": img.FreeBlocks(),
+		}
+		if jsonOut {
+			data["files"] = mapping
+			if len(skipped) > 0 {
+				data["skipped"] = skipped
+			}
+		} else {
+			formatter.PrintTable([]string{"file", "type", "blocks", "source"}, added)
+			for _, s := range skipped {
+				formatter.Warning("Skipped " + s)
+			}
+			if shortened > 0 {
+				formatter.Warning(fmt.Sprintf("Shortened %s to 16 characters", plural(shortened, "name")))
+			}
+		}
+		formatter.Success(fmt.Sprintf("Added %s to %s", plural(len(added), "file"), imagePath), data)
+	},
+}
+
+func init() {
+	d64Cmd.AddCommand(d64AddCmd)
+	d64AddCmd.Flags().String("dir", "", "Add to this D81 partition or DNP subdirectory")
+	d64AddCmd.Flags().Bool("replace", false, "Replace files with the same name")
+	addLongNamesFlag(d64AddCmd)
+}
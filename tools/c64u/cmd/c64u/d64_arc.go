@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/cbmarc"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// C64 archives (Lynx, ARK, LBR)
+// =============================================================================
+
+var d64UnpackCmd = &cobra.Command{
+	Use:   "unpack <archive> [pattern] [--output DIR | --image IMAGE [--dir PATH]]",
+	Short: "Extract a Lynx, ARK or LBR archive",
+	Long: `Extract the files of a Lynx (.lnx), ARK (.ark) or LBR (.lbr) archive, either
+as host files named as "d64 mountfs" shows them ("game.prg") or straight
+into a disk image, keeping the PETSCII names and file types. A missing
+image is created in the format of its extension.
+
+The pattern selects files as for "d64 copy" (default: all). REL files keep
+their records in host files but cannot be written to images.
+
+Examples:
+  c64u d64 unpack demo.lnx
+  c64u d64 unpack tools.ark --output tools/
+  c64u d64 unpack game.lnx --image game.d64
+  c64u d64 unpack music.lbr "*.prg" --image collection.d81 --dir music`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		outDir, _ := cmd.Flags().GetString("output")
+		imagePath, _ := cmd.Flags().GetString("image")
+		dirPath, _ := cmd.Flags().GetString("dir")
+		pattern := "*"
+		if len(args) > 1 {
+			pattern = args[1]
+		}
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			formatter.Error("Cannot read archive", []string{err.Error()})
+			return
+		}
+		format, files, err := cbmarc.Read(args[0], data)
+		if err != nil {
+			formatter.Error("Cannot read archive", []string{fmt.Sprintf("%s: %v", filepath.Base(args[0]), err)})
+			return
+		}
+
+		var selected []cbmarc.File
+		for _, f := range files {
+			if matchesPattern(diskimage.File{Name: f.Name, Type: f.Type}, pattern) {
+				selected = append(selected, f)
+			}
+		}
+		if len(selected) == 0 {
+			formatter.Error("No files match", []string{fmt.Sprintf("'%s' matches nothing in %s", pattern, args[0])})
+			return
+		}
+
+		var img *diskimage.Image
+		if imagePath != "" {
+			if img, err = openOrCreateImage(imagePath, dirPath); err != nil {
+				formatter.Error("Cannot open disk image", []string{err.Error()})
+				return
+			}
+		} else if err := os.MkdirAll(outDir, 0755); err != nil {
+			formatter.Error("Cannot create output directory", []string{err.Error()})
+			return
+		}
+
+		rows := make([][]string, 0, len(selected))
+		for _, f := range selected {
+			name := diskimage.HostName(diskimage.File{Name: f.Name, Type: f.Type})
+			if img != nil && f.Type == diskimage.REL {
+				formatter.Warning(fmt.Sprintf("Skipped %s: REL files cannot be stored in images", name))
+				continue
+			}
+			if img != nil {
+				if err := img.WriteFile(f.Name, f.Type, f.Data); err != nil {
+					formatter.Error(fmt.Sprintf("Failed to store %s", name), []string{
+						err.Error(),
+						fmt.Sprintf("%s was not changed", imagePath),
+					})
+					return
+				}
+			} else if err := os.WriteFile(filepath.Join(outDir, name), f.Data, 0644); err != nil {
+				formatter.Error(fmt.Sprintf("Failed to write %s", name), []string{err.Error()})
+				return
+			}
+			rows = append(rows, []string{petscii.ToEscaped(f.Name), f.Type.String(), strconv.Itoa(len(f.Data))})
+		}
+
+		result := map[string]interface{}{
+			"archive": args[0],
+			"format":  format.String(),
+			"files":   len(rows),
+		}
+		if img != nil {
+			if err := img.Save(imagePath); err != nil {
+				formatter.Error("Failed to write disk image", []string{err.Error()})
+				return
+			}
+			result["image"] = imagePath
+			result["blocks_free"] = img.FreeBlocks()
+		} else {
+			result["output"] = outDir
+		}
+		if !jsonOut {
+			formatter.PrintTable([]string{"file", "type", "bytes"}, rows)
+		}
+		formatter.Success(fmt.Sprintf("Extracted %s from %s", plural(len(rows), "file"), filepath.Base(args[0])), result)
+	},
+}
+
+var d64PackCmd = &cobra.Command{
+	Use:   "pack <archive.lnx> <image>[:<pattern>] [--src-dir PATH]",
+	Short: "Create a Lynx archive from disk image files",
+	Long: `Write the files of a local disk image into a Lynx archive (the format
+most C64 tools can dissolve), keeping names and file types. The pattern
+selects files as for "d64 copy" (default: all); REL files and partitions
+are skipped.
+
+Examples:
+  c64u d64 pack game.lnx game.d64
+  c64u d64 pack tools.lnx "work.d81:*.prg" --src-dir tools`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		srcDir, _ := cmd.Flags().GetString("src-dir")
+		outPath := args[0]
+		imagePath, pattern := splitImagePattern(args[1])
+
+		img, err := openImageDir(imagePath, srcDir)
+		if err != nil {
+			formatter.Error("Cannot open disk image", []string{err.Error()})
+			return
+		}
+		matched, err := matchImageFiles(img, pattern)
+		if err != nil {
+			formatter.Error("Failed to read directory", []string{err.Error()})
+			return
+		}
+
+		var files []cbmarc.File
+		for _, f := range matched {
+			if f.IsDir() || f.Type == diskimage.REL {
+				formatter.Warning(fmt.Sprintf("Skipped %s: %s files cannot be archived", petscii.ToEscaped(f.Name), f.Type))
+				continue
+			}
+			data, err := img.ReadFile(f)
+			if err != nil {
+				formatter.Error("Failed to read file", []string{err.Error()})
+				return
+			}
+			files = append(files, cbmarc.File{Name: f.Name, Type: f.Type, Data: data})
+		}
+		if len(files) == 0 {
+			formatter.Error("No files to archive", []string{fmt.Sprintf("'%s' matches no files in %s", pattern, imagePath)})
+			return
+		}
+
+		data, err := cbmarc.WriteLynx(files)
+		if err != nil {
+			formatter.Error("Failed to create archive", []string{err.Error()})
+			return
+		}
+		if err := os.WriteFile(outPath, data, 0644); err != nil {
+			formatter.Error("Failed to write archive", []string{err.Error()})
+			return
+		}
+		formatter.Success(fmt.Sprintf("Packed %s into %s", plural(len(files), "file"), outPath), map[string]interface{}{
+			"image":  imagePath,
+			"blocks": (len(data) + 253) / 254,
+		})
+	},
+}
+
+// openOrCreateImage opens a disk image at a partition or subdirectory. A
+// missing image is created empty, named after the file; it is only
+// written when saved.
+func openOrCreateImage(imagePath, dirPath string) (*diskimage.Image, error) {
+	if _, err := os.Stat(imagePath); !os.IsNotExist(err) {
+		return openImageDir(imagePath, dirPath)
+	}
+	if dirPath != "" {
+		return nil, fmt.Errorf("%s does not exist, so it has no directory '%s'", imagePath, dirPath)
+	}
+
+	format, err := diskimage.ParseFormat(filepath.Ext(imagePath))
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(imagePath), filepath.Ext(imagePath))
+	petName, err := petscii.FromText(name)
+	if err != nil || len(petName) > 16 {
+		petName = []byte("UNPACKED")
+	}
+	if format == diskimage.DNP {
+		return diskimage.NewDNP(255, petName, []byte("01"))
+	}
+	return diskimage.New(format, petName, []byte("01")), nil
+}
+
+func init() {
+	d64Cmd.AddCommand(d64UnpackCmd)
+	d64Cmd.AddCommand(d64PackCmd)
+	d64UnpackCmd.Flags().StringP("output", "o", ".", "Directory for the extracted files")
+	d64UnpackCmd.Flags().String("image", "", "Store the files in this disk image instead (created if missing)")
+	d64UnpackCmd.Flags().String("dir", "", "D81 partition or DNP subdirectory of the image to store the files in")
+	d64PackCmd.Flags().String("src-dir", "", "Archive files from this D81 partition or DNP subdirectory")
+}
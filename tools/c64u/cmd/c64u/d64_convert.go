@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// Batch conversion
+// =============================================================================
+
+// convertResult is the outcome of converting one image
+type convertResult struct {
+	Source string   `json:"source"`
+	Output string   `json:"output,omitempty"`
+	Losses []string `json:"losses,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+var d64ConvertCmd = &cobra.Command{
+	Use:   "convert --to FORMAT <image>... [--output DIR] [--workers N] [--replace]",
+	Short: "Convert disk images to another format",
+	Long: `Convert local disk images to D64, D71, D81 or DNP. The disk name, ID and
+directory are carried over, with the files stored as the new format's DOS
+would; directory order, duplicate names, DEL entries (directory art) and
+file flags are kept. Images are converted in parallel (--workers) and
+written to --output with the new extension.
+
+A summary lists every image that could not be converted losslessly and
+why: REL files, GEOS files, partitions and subdirectories are not
+converted, files may not fit a smaller format, error info bytes are
+dropped, and blocks allocated outside any file (e.g. loader data) are
+lost. Existing output files are kept unless --replace is given. Exits with
+status 1 if an image failed.
+
+Examples:
+  c64u d64 convert --to d81 *.d64 -o out/
+  c64u d64 convert --to d64 disk1.d71 disk2.d71
+  c64u d64 convert --to dnp collection/*.d81 -o dnp/ --workers 8`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		to, _ := cmd.Flags().GetString("to")
+		outDir, _ := cmd.Flags().GetString("output")
+		workers, _ := cmd.Flags().GetInt("workers")
+		replace, _ := cmd.Flags().GetBool("replace")
+
+		format, err := diskimage.ParseFormat(to)
+		if err != nil {
+			formatter.Error("Invalid target format", []string{err.Error()})
+			return
+		}
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			formatter.Error("Cannot create output directory", []string{err.Error()})
+			return
+		}
+
+		results := make([]convertResult, len(args))
+		queue := make(chan int)
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		done := 0
+		showProgress := !jsonOut && !verbose && output.IsTerminal(os.Stderr)
+		for w := 0; w < max(1, min(workers, len(args))); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range queue {
+					results[i] = convertImage(args[i], outDir, format, replace)
+					if showProgress {
+						mu.Lock()
+						done++
+						fmt.Fprintf(os.Stderr, "\r\033[K[%d/%d] %s", done, len(args), truncate(filepath.Base(args[i]), 40))
+						mu.Unlock()
+					}
+				}
+			}()
+		}
+		for i := range args {
+			queue <- i
+		}
+		close(queue)
+		wg.Wait()
+		if showProgress {
+			fmt.Fprint(os.Stderr, "\r\033[K")
+		}
+
+		converted, lossy, failed := 0, 0, 0
+		rows := make([][]string, 0, len(results))
+		for _, r := range results {
+			status := "ok"
+			switch {
+			case r.Error != "":
+				failed++
+				status = "failed"
+			case len(r.Losses) > 0:
+				converted++
+				lossy++
+				status = fmt.Sprintf("lossy (%d)", len(r.Losses))
+			default:
+				converted++
+			}
+			rows = append(rows, []string{r.Source, r.Output, status})
+		}
+
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{
+				"format":    format.String(),
+				"converted": converted,
+				"lossy":     lossy,
+				"failed":    failed,
+				"results":   results,
+			})
+			if failed > 0 {
+				output.Exit(1)
+			}
+			return
+		}
+		formatter.PrintTable([]string{"image", "output", "result"}, rows)
+		for _, r := range results {
+			if r.Error != "" {
+				formatter.Warning(fmt.Sprintf("%s: %s", r.Source, r.Error))
+			}
+			for _, l := range r.Losses {
+				formatter.Warning(fmt.Sprintf("%s: %s", r.Source, l))
+			}
+		}
+		if failed > 0 {
+			formatter.Error(fmt.Sprintf("%s of %d failed", plural(failed, "image"), len(results)), []string{
+				fmt.Sprintf("%d converted, %d of them with losses", converted, lossy),
+			})
+			return
+		}
+		formatter.Success(fmt.Sprintf("Converted %s to %s", plural(converted, "image"), format), map[string]interface{}{
+			"lossless":    converted - lossy,
+			"with_losses": lossy,
+			"output":      outDir,
+		})
+	},
+}
+
+// convertImage converts one image into outDir and reports what was lost
+func convertImage(path, outDir string, format diskimage.Format, replace bool) convertResult {
+	res := convertResult{Source: path}
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	dst := filepath.Join(outDir, base+"."+format.String())
+
+	if abs, _ := filepath.Abs(path); abs != "" {
+		if absDst, _ := filepath.Abs(dst); abs == absDst {
+			res.Error = "output would replace the source; choose another --output"
+			return res
+		}
+	}
+	if _, err := os.Stat(dst); err == nil && !replace {
+		res.Error = fmt.Sprintf("%s exists (use --replace)", dst)
+		return res
+	}
+
+	src, err := diskimage.Open(path)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	img, losses, err := diskimage.Convert(src, format)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if err := img.Save(dst); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Output, res.Losses = dst, losses
+	return res
+}
+
+func init() {
+	d64Cmd.AddCommand(d64ConvertCmd)
+	d64ConvertCmd.Flags().String("to", "", "Target format: d64, d71, d81 or dnp")
+	d64ConvertCmd.Flags().StringP("output", "o", ".", "Directory for the converted images")
+	d64ConvertCmd.Flags().Int("workers", 4, "Number of images converted in parallel")
+	d64ConvertCmd.Flags().Bool("replace", false, "Replace existing output files")
+	d64ConvertCmd.MarkFlagRequired("to")
+}
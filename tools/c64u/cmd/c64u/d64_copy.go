@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// Copying between images
+// =============================================================================
+
+var d64CopyCmd = &cobra.Command{
+	Use:   "copy <src-image>[:<pattern>] <dst-image> [--src-dir PATH] [--dst-dir PATH] [--replace]",
+	Short: "Copy files from one disk image to another",
+	Long: `Copy files between local disk images, which may be of different formats
+(D64, D71, D81, DNP). Blocks are allocated in the destination as its DOS
+would; file types and write protection are kept.
+
+The pattern selects the files (default: all). It is matched against the
+PETSCII names as typed for "d64 rename" ("GAME*", "PART?", "{$C1}*") and
+against the host names shown by "d64 mountfs" ("*.seq"), with * and ?
+as wildcards. --src-dir and --dst-dir select D81 partitions or DNP
+subdirectories.
+
+Existing files in the destination are left alone unless --replace is
+given. REL files and partitions are skipped. The destination is only
+written when all selected files fit.
+
+Examples:
+  c64u d64 copy games.d64 collection.d81
+  c64u d64 copy "games.d64:GIANA*" collection.d81 --dst-dir games
+  c64u d64 copy "work.d71:*.seq" data.d64 --replace`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		srcDir, _ := cmd.Flags().GetString("src-dir")
+		dstDir, _ := cmd.Flags().GetString("dst-dir")
+		replace, _ := cmd.Flags().GetBool("replace")
+
+		srcPath, pattern := splitImagePattern(args[0])
+		dstPath := args[1]
+
+		src, err := openImageDir(srcPath, srcDir)
+		if err != nil {
+			formatter.Error("Cannot open source image", []string{err.Error()})
+			return
+		}
+		dst, err := openImageDir(dstPath, dstDir)
+		if err != nil {
+			formatter.Error("Cannot open destination image", []string{err.Error()})
+			return
+		}
+		files, err := matchImageFiles(src, pattern)
+		if err != nil {
+			formatter.Error("Failed to read source directory", []string{err.Error()})
+			return
+		}
+		if len(files) == 0 {
+			formatter.Error("No files match", []string{fmt.Sprintf("'%s' matches nothing in %s", pattern, srcPath)})
+			return
+		}
+
+		var copied [][]string
+		var skipped []string
+		blocks := 0
+		for _, f := range files {
+			name := petscii.ToEscaped(f.Name)
+			if f.IsDir() || f.Type == diskimage.REL {
+				skipped = append(skipped, fmt.Sprintf("%s: %s files cannot be copied", name, f.Type))
+				continue
+			}
+			if old, err := dst.Find(f.Name); err == nil && (!replace || old.IsDir()) {
+				skipped = append(skipped, fmt.Sprintf("%s: exists in %s", name, dstPath))
+				continue
+			}
+
+			data, err := src.ReadFile(f)
+			if err != nil {
+				formatter.Error("Failed to read file", []string{err.Error()})
+				return
+			}
+			if err := dst.WriteFile(f.Name, f.Type, data); err != nil {
+				formatter.Error(fmt.Sprintf("Failed to copy %s", name), []string{
+					err.Error(),
+					fmt.Sprintf("%s was not changed", dstPath),
+				})
+				return
+			}
+			if f.Locked {
+				dst.SetLocked(f.Name, true)
+			}
+			stored, _ := dst.Find(f.Name)
+			blocks += stored.Blocks
+			copied = append(copied, []string{name, f.Type.String(), strconv.Itoa(stored.Blocks)})
+		}
+
+		if len(copied) == 0 {
+			formatter.Error("Nothing copied", skipped)
+			return
+		}
+		if err := dst.Save(dstPath); err != nil {
+			formatter.Error("Failed to write destination image", []string{err.Error()})
+			return
+		}
+
+		data := map[string]interface{}{
+			"source":      srcPath,
+			"destination": dstPath,
+			"copied":      len(copied),
+			"blocks":      blocks,
+			"blocks_free": dst.FreeBlocks(),
+		}
+		if jsonOut {
+			if len(skipped) > 0 {
+				data["skipped"] = skipped
+			}
+		} else {
+			formatter.PrintTable([]string{"file", "type", "blocks"}, copied)
+			for _, s := range skipped {
+				formatter.Warning("Skipped " + s)
+			}
+		}
+		formatter.Success(fmt.Sprintf("Copied %s to %s", plural(len(copied), "file"), dstPath), data)
+	},
+}
+
+// splitImagePattern splits "image:pattern" at the last colon that follows
+// the image's extension, so drive letters and colons in directory names
+// are kept
+func splitImagePattern(arg string) (image, pattern string) {
+	lower := strings.ToLower(arg)
+	for _, ext := range []string{".d64:", ".d71:", ".d81:", ".dnp:"} {
+		if i := strings.LastIndex(lower, ext); i >= 0 {
+			return arg[:i+len(ext)-1], arg[i+len(ext):]
+		}
+	}
+	return arg, "*"
+}
+
+// matchImageFiles returns the entries matching a wildcard pattern, given
+// as PETSCII text with {$hh} escapes or as a host name
+func matchImageFiles(img *diskimage.Image, pattern string) ([]diskimage.File, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+	files, err := img.Files()
+	if err != nil {
+		return nil, err
+	}
+	var matched []diskimage.File
+	for _, f := range files {
+		if matchesPattern(f, pattern) {
+			matched = append(matched, f)
+		}
+	}
+	return matched, nil
+}
+
+// matchesPattern reports whether the PETSCII name (as text with {$hh}
+// escapes) or the host name of an entry matches a wildcard pattern
+func matchesPattern(f diskimage.File, pattern string) bool {
+	byName, _ := path.Match(strings.ToUpper(pattern), petscii.ToEscaped(f.Name))
+	byHost, _ := path.Match(strings.ToLower(pattern), strings.ToLower(diskimage.HostName(f)))
+	return byName || byHost
+}
+
+func init() {
+	d64Cmd.AddCommand(d64CopyCmd)
+	d64CopyCmd.Flags().String("src-dir", "", "Copy from this D81 partition or DNP subdirectory")
+	d64CopyCmd.Flags().String("dst-dir", "", "Copy into this D81 partition or DNP subdirectory")
+	d64CopyCmd.Flags().Bool("replace", false, "Replace files that exist in the destination")
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// Comparing images
+// =============================================================================
+
+var d64DiffCmd = &cobra.Command{
+	Use:   "diff <a-image> <b-image> [--summary] [--side-by-side] [--context N]",
+	Short: "Compare two disk images sector by sector",
+	Long: `Compare two local disk images of the same format sector by sector and
+show each differing sector as a hex diff, labelled with what it holds in
+either image (header, BAM, directory or the file it belongs to), followed
+by a summary per file. Error info bytes are compared too.
+
+Useful to check that a save game or a copy changed exactly what was
+expected. --summary shows only the summary. Exits with status 1 if the
+images differ.
+
+Examples:
+  c64u d64 diff before.d64 after.d64
+  c64u d64 diff game.d64 game-saved.d64 --summary
+  c64u --json d64 diff a.d81 b.d81`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		summaryOnly, _ := cmd.Flags().GetBool("summary")
+		sideBySide, _ := cmd.Flags().GetBool("side-by-side")
+		context, _ := cmd.Flags().GetInt("context")
+
+		a, err := diskimage.Open(args[0])
+		if err != nil {
+			formatter.Error("Cannot open disk image", []string{err.Error()})
+			return
+		}
+		b, err := diskimage.Open(args[1])
+		if err != nil {
+			formatter.Error("Cannot open disk image", []string{err.Error()})
+			return
+		}
+		if a.Format != b.Format {
+			formatter.Error("Images have different formats", []string{
+				fmt.Sprintf("%s is a %s and %s a %s image; convert one with \"d64 copy\" first",
+					args[0], a.Format, args[1], b.Format),
+			})
+			return
+		}
+
+		useA, useB := a.Usage(), b.Usage()
+		label := func(ts [2]int) string {
+			if u, ok := useB[ts]; ok {
+				return sectorUseLabel(u)
+			}
+			if u, ok := useA[ts]; ok {
+				return sectorUseLabel(u)
+			}
+			return "unused"
+		}
+
+		type sectorDiff struct {
+			Track  int    `json:"track"`
+			Sector int    `json:"sector"`
+			Use    string `json:"use"`
+			Bytes  int    `json:"bytes"`
+			// Only names the image that has the sector, for differing track counts
+			Only   string                   `json:"only,omitempty"`
+			Ranges []map[string]interface{} `json:"ranges,omitempty"`
+		}
+		var diffs []sectorDiff
+		var errorDiffs []string
+		totals := map[string][2]int{}
+		tracks := make(map[int]bool)
+
+		for t := 1; t <= max(a.Tracks, b.Tracks); t++ {
+			for s := 0; s < a.SectorsPerTrack(t); s++ {
+				ts := [2]int{t, s}
+				secA, errA := a.Sector(t, s)
+				secB, errB := b.Sector(t, s)
+				d := sectorDiff{Track: t, Sector: s, Use: label(ts)}
+				switch {
+				case errA != nil:
+					d.Only, d.Bytes = args[1], diskimage.SectorSize
+				case errB != nil:
+					d.Only, d.Bytes = args[0], diskimage.SectorSize
+				default:
+					if e := errorInfoDiff(a, b, t, s); e != "" {
+						errorDiffs = append(errorDiffs, fmt.Sprintf("%d/%d: %s", t, s, e))
+					}
+					ranges := output.DiffBytes(secA, secB)
+					if len(ranges) == 0 {
+						continue
+					}
+					for _, r := range ranges {
+						d.Bytes += len(r.Expected)
+						d.Ranges = append(d.Ranges, map[string]interface{}{
+							"offset": r.Offset,
+							"length": len(r.Expected),
+							"a":      hex.EncodeToString(r.Expected),
+							"b":      hex.EncodeToString(r.Actual),
+						})
+					}
+				}
+				diffs = append(diffs, d)
+				tracks[t] = true
+				n := totals[d.Use]
+				totals[d.Use] = [2]int{n[0] + 1, n[1] + d.Bytes}
+			}
+		}
+
+		bytes := 0
+		for _, d := range diffs {
+			bytes += d.Bytes
+		}
+		equal := len(diffs) == 0 && len(errorDiffs) == 0
+		uses := make([]string, 0, len(totals))
+		for u := range totals {
+			uses = append(uses, u)
+		}
+		sort.Strings(uses)
+
+		if jsonOut {
+			summary := make([]map[string]interface{}, 0, len(uses))
+			for _, u := range uses {
+				summary = append(summary, map[string]interface{}{"use": u, "sectors": totals[u][0], "bytes": totals[u][1]})
+			}
+			if diffs == nil {
+				diffs = []sectorDiff{}
+			}
+			result := map[string]interface{}{
+				"equal":   equal,
+				"a":       args[0],
+				"b":       args[1],
+				"sectors": diffs,
+				"summary": summary,
+				"bytes":   bytes,
+			}
+			if len(errorDiffs) > 0 {
+				result["error_info"] = errorDiffs
+			}
+			formatter.PrintData(result)
+			if !equal {
+				output.Exit(1)
+			}
+			return
+		}
+
+		if equal {
+			formatter.Success("Images are identical", map[string]interface{}{
+				"sectors": len(a.Bytes()) / diskimage.SectorSize,
+			})
+			return
+		}
+
+		if !summaryOnly {
+			opts := output.DiffOptions{SideBySide: sideBySide, Context: context}
+			fmt.Println("--- " + args[0])
+			fmt.Println("+++ " + args[1])
+			for _, d := range diffs {
+				if d.Only != "" {
+					formatter.Warning(fmt.Sprintf("%d/%d only in %s", d.Track, d.Sector, d.Only))
+					continue
+				}
+				secA, _ := a.Sector(d.Track, d.Sector)
+				secB, _ := b.Sector(d.Track, d.Sector)
+				opts.Title = fmt.Sprintf("%d/%d %s", d.Track, d.Sector, d.Use)
+				formatter.PrintHexHunks(0, secA, secB, opts)
+			}
+			fmt.Println()
+		}
+
+		rows := make([][]string, 0, len(uses))
+		for _, u := range uses {
+			rows = append(rows, []string{u, strconv.Itoa(totals[u][0]), strconv.Itoa(totals[u][1])})
+		}
+		if len(rows) > 0 {
+			formatter.PrintTable([]string{"use", "sectors", "bytes"}, rows)
+		}
+		for _, e := range errorDiffs {
+			formatter.Warning("Error info differs at " + e)
+		}
+		formatter.Info(fmt.Sprintf("Differences: %s on %s (%s)",
+			plural(len(diffs), "sector"), plural(len(tracks), "track"), plural(bytes, "byte")))
+		output.Exit(1)
+	},
+}
+
+// sectorUseLabel describes what a sector holds, e.g. "file GAME" or
+// "directory TOOLS/"
+func sectorUseLabel(u diskimage.SectorUse) string {
+	if len(u.Name) == 0 {
+		return u.What
+	}
+	return u.What + " " + petscii.ToEscaped(u.Name)
+}
+
+// errorInfoDiff describes a difference in the error info byte of a
+// sector; images without error info count as having no errors
+func errorInfoDiff(a, b *diskimage.Image, track, sector int) string {
+	ea, okA := a.ErrorByte(track, sector)
+	eb, okB := b.ErrorByte(track, sector)
+	if !okA {
+		ea = 1
+	}
+	if !okB {
+		eb = 1
+	}
+	if ea == eb || (ea <= 1 && eb <= 1) {
+		return ""
+	}
+	return fmt.Sprintf("$%02X → $%02X", ea, eb)
+}
+
+func init() {
+	d64Cmd.AddCommand(d64DiffCmd)
+	d64DiffCmd.Flags().Bool("summary", false, "Show only the summary per file")
+	d64DiffCmd.Flags().Bool("side-by-side", false, "Show the bytes of both images side by side")
+	d64DiffCmd.Flags().Int("context", 1, "Number of unchanged rows to show around differences")
+}
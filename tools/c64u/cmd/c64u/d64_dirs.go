@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/basic"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// Image creation, listing and subdirectories
+// =============================================================================
+
+var d64NewCmd = &cobra.Command{
+	Use:   "new <image> [--name NAME] [--id ID] [--tracks N] [--yes]",
+	Short: "Create an empty disk image",
+	Long: `Create a formatted, empty disk image. The format follows the file
+extension: .d64, .d71, .d81 or .dnp. A DNP image is a CMD native
+partition of --tracks tracks of 64 KiB each (1-255, default 255 = 16 MiB).
+
+Examples:
+  c64u d64 new work.d64 --name "WORK DISK" --id 01
+  c64u d64 new tools.dnp --tracks 64
+  c64u d64 new big.d81 --name ARCHIVE`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		imagePath := args[0]
+		name, _ := cmd.Flags().GetString("name")
+		id, _ := cmd.Flags().GetString("id")
+		tracks, _ := cmd.Flags().GetInt("tracks")
+
+		format, err := diskimage.ParseFormat(filepath.Ext(imagePath))
+		if err != nil {
+			formatter.Error("Unknown image format", []string{err.Error()})
+			return
+		}
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(imagePath), filepath.Ext(imagePath))
+			if len(name) > 16 {
+				name = name[:16]
+			}
+		}
+		petName, err := petscii.FromEscaped(name)
+		if err != nil || len(petName) > 16 {
+			formatter.Error("Invalid disk name", []string{petsciiProblem(name, err, "up to 16")})
+			return
+		}
+		petID, err := petscii.FromEscaped(id)
+		if err != nil || len(petID) != 2 {
+			formatter.Error("Invalid disk ID", []string{petsciiProblem(id, err, "exactly 2")})
+			return
+		}
+
+		var img *diskimage.Image
+		switch {
+		case format == diskimage.DNP:
+			if img, err = diskimage.NewDNP(tracks, petName, petID); err != nil {
+				formatter.Error("Invalid image size", []string{err.Error()})
+				return
+			}
+		case cmd.Flags().Changed("tracks"):
+			formatter.Error("Invalid image size", []string{"--tracks only applies to DNP images"})
+			return
+		default:
+			img = diskimage.New(format, petName, petID)
+		}
+
+		if _, err := os.Stat(imagePath); err == nil {
+			if !confirmCmd(cmd, fmt.Sprintf("Replace %s?", imagePath)) {
+				return
+			}
+		}
+		if err := img.Save(imagePath); err != nil {
+			formatter.Error("Failed to write disk image", []string{err.Error()})
+			return
+		}
+		formatter.Success(fmt.Sprintf("Created %s", imagePath), map[string]interface{}{
+			"format":      img.Format.String(),
+			"tracks":      img.Tracks,
+			"blocks_free": img.FreeBlocks(),
+		})
+	},
+}
+
+var d64DirCmd = &cobra.Command{
+	Use:   "dir <image> [path]",
+	Short: "List the directory of a disk image",
+	Long: `List the directory of a local disk image as the drive would show it.
+
+The path selects a D81 partition or DNP subdirectory, with parts separated
+by "/", e.g. "games/arcade"; each part may be given with or without its
+.cbm or .dir extension.
+
+Examples:
+  c64u d64 dir games.d64
+  c64u d64 dir work.d81 tools
+  c64u --json d64 dir archive.dnp demos/1990`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		dirPath := ""
+		if len(args) > 1 {
+			dirPath = args[1]
+		}
+		img, err := openImageDir(args[0], dirPath)
+		if err != nil {
+			formatter.Error("Cannot open disk image", []string{err.Error()})
+			return
+		}
+		files, err := img.Files()
+		if err != nil {
+			formatter.Error("Failed to read directory", []string{err.Error()})
+			return
+		}
+
+		dir := basic.Directory{
+			DiskName:   petscii.ToText(img.Name()),
+			DiskID:     petscii.ToText(img.ID()),
+			Entries:    []basic.Entry{},
+			BlocksFree: img.FreeBlocks(),
+		}
+		for _, f := range files {
+			dir.Entries = append(dir.Entries, basic.Entry{
+				Blocks: f.Blocks,
+				Name:   petscii.ToText(f.Name),
+				Type:   strings.ToUpper(f.Type.String()),
+				Locked: f.Locked,
+				Splat:  !f.Closed,
+			})
+		}
+
+		if jsonOut {
+			formatter.PrintData(dir)
+			return
+		}
+		formatter.PrintHeader(fmt.Sprintf(`0 "%s" %s`, dir.DiskName, dir.DiskID))
+		for _, e := range dir.Entries {
+			fmt.Println(basic.FormatEntry(e))
+		}
+		fmt.Printf("%d BLOCKS FREE.\n", dir.BlocksFree)
+	},
+}
+
+var d64MkdirCmd = &cobra.Command{
+	Use:   "mkdir <image> <path> [--tracks N]",
+	Short: "Create a D81 partition or DNP subdirectory",
+	Long: `Create a subdirectory in a local disk image.
+
+In a D81 image this is a partition of --tracks whole tracks (at least 3,
+default 3 = 120 blocks), formatted so that the 1581 can enter it with
+CD or "/"; it takes the free tracks farthest from the directory track.
+Partitions can be nested. In a DNP image it is a CMD native subdirectory,
+which grows as needed.
+
+All but the last part of the path must exist.
+
+Examples:
+  c64u d64 mkdir work.d81 tools
+  c64u d64 mkdir work.d81 games --tracks 10
+  c64u d64 mkdir archive.dnp demos/1990`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		imagePath := args[0]
+		tracks, _ := cmd.Flags().GetInt("tracks")
+
+		parent, name := pathSplit(strings.Trim(args[1], "/"))
+		img, err := openImageDir(imagePath, parent)
+		if err != nil {
+			formatter.Error("Cannot open disk image", []string{err.Error()})
+			return
+		}
+		petName, _, err := diskimage.ParseHostName(name)
+		if err != nil {
+			formatter.Error("Invalid directory name", []string{err.Error()})
+			return
+		}
+
+		var dir diskimage.File
+		switch img.Format {
+		case diskimage.D81:
+			dir, err = img.MakePartition(petName, tracks)
+		default:
+			dir, err = img.MakeDir(petName)
+		}
+		if err != nil {
+			formatter.Error("Failed to create directory", []string{err.Error()})
+			return
+		}
+		if err := img.Save(imagePath); err != nil {
+			formatter.Error("Failed to write disk image", []string{err.Error()})
+			return
+		}
+		formatter.Success(fmt.Sprintf("Created %s", diskimage.HostName(dir)), map[string]interface{}{
+			"image":  imagePath,
+			"path":   strings.Trim(args[1], "/"),
+			"track":  dir.Track,
+			"blocks": dir.Blocks,
+		})
+	},
+}
+
+// pathSplit splits a slash-separated path into its parent and last part
+func pathSplit(p string) (parent, name string) {
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return "", p
+}
+
+// openImageDir opens a disk image at the D81 partition or DNP
+// subdirectory dirPath ("" for the root directory)
+func openImageDir(imagePath, dirPath string) (*diskimage.Image, error) {
+	img, err := diskimage.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range strings.Split(dirPath, "/") {
+		if part == "" {
+			continue
+		}
+		files, err := img.Files()
+		if err != nil {
+			return nil, err
+		}
+		var found *diskimage.File
+		for i, f := range files {
+			name := diskimage.HostName(f)
+			if f.IsDir() && (name == part || strings.TrimSuffix(name, "."+f.Type.String()) == part) {
+				found = &files[i]
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("%s: no partition or subdirectory '%s'", filepath.Base(imagePath), part)
+		}
+		if img, err = img.Subdir(found.Name); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(imagePath), err)
+		}
+	}
+	return img, nil
+}
+
+func init() {
+	d64Cmd.AddCommand(d64NewCmd)
+	d64Cmd.AddCommand(d64DirCmd)
+	d64Cmd.AddCommand(d64MkdirCmd)
+	d64NewCmd.Flags().String("name", "", "Disk name (default: the file name)")
+	d64NewCmd.Flags().String("id", "01", "Disk ID (2 characters)")
+	d64NewCmd.Flags().Int("tracks", 255, "Number of 64 KiB tracks of a DNP image (1-255)")
+	d64NewCmd.Flags().BoolP("yes", "y", false, "Replace an existing file without asking")
+	d64MkdirCmd.Flags().Int("tracks", 3, "Size of a D81 partition in tracks of 40 blocks")
+}
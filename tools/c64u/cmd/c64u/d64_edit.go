@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// Image metadata
+// =============================================================================
+
+var d64RenameCmd = &cobra.Command{
+	Use:   "rename <image> [--name NAME] [--id ID] [--dir PATH]",
+	Short: "Change the disk name and ID of an image",
+	Long: `Change the disk name and/or ID in the header of a local disk image. The
+rest of the image is left untouched.
+
+Names are typed as text: letters become unshifted PETSCII letters (the
+uppercase shown by the C64), and {$hh} stands for any PETSCII code, e.g.
+{$C1} for a shifted A. With --dir the header of a D81 partition or DNP
+subdirectory is changed instead.
+
+Examples:
+  c64u d64 rename game.d64 --name "NEW NAME" --id AB
+  c64u d64 rename game.d64 --id 2A
+  c64u d64 rename work.d81 --dir tools --name "TOOLS{$A0}V2"`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		imagePath := args[0]
+		dirPath, _ := cmd.Flags().GetString("dir")
+		if !cmd.Flags().Changed("name") && !cmd.Flags().Changed("id") {
+			formatter.Error("Nothing to change", []string{"Give --name and/or --id"})
+			return
+		}
+
+		img, err := openImageDir(imagePath, dirPath)
+		if err != nil {
+			formatter.Error("Cannot open disk image", []string{err.Error()})
+			return
+		}
+
+		name := img.Name()
+		if cmd.Flags().Changed("name") {
+			text, _ := cmd.Flags().GetString("name")
+			if name, err = petscii.FromEscaped(text); err != nil || len(name) > 16 {
+				formatter.Error("Invalid disk name", []string{petsciiProblem(text, err, "up to 16")})
+				return
+			}
+		}
+		var id []byte
+		if cmd.Flags().Changed("id") {
+			text, _ := cmd.Flags().GetString("id")
+			if id, err = petscii.FromEscaped(text); err != nil || len(id) != 2 {
+				formatter.Error("Invalid disk ID", []string{petsciiProblem(text, err, "exactly 2")})
+				return
+			}
+		}
+
+		oldName, oldID := img.Name(), img.ID()
+		if err := img.SetHeader(name, id); err != nil {
+			formatter.Error("Failed to change the header", []string{err.Error()})
+			return
+		}
+		if err := img.Save(imagePath); err != nil {
+			formatter.Error("Failed to write disk image", []string{err.Error()})
+			return
+		}
+		formatter.Success(fmt.Sprintf("Header of %s changed", imagePath), map[string]interface{}{
+			"old": fmt.Sprintf(`"%s" %s`, petscii.ToEscaped(oldName), petscii.ToEscaped(oldID)),
+			"new": fmt.Sprintf(`"%s" %s`, petscii.ToEscaped(img.Name()), petscii.ToEscaped(img.ID())),
+		})
+	},
+}
+
+var d64RetitleFileCmd = &cobra.Command{
+	Use:   "retitle-file <image> <name> <new-name> [--dir PATH]",
+	Short: "Rename a file in a disk image",
+	Long: `Change the name of a directory entry in a local disk image. The file's
+data, type and position in the directory stay the same.
+
+Both names are typed as for "d64 rename" (text, with {$hh} for any PETSCII
+code); the file can also be given by the host name "d64 mountfs" shows,
+such as "giana sisters.prg". An existing file with the new name is not
+replaced.
+
+Examples:
+  c64u d64 retitle-file game.d64 "GAME" "GAME V2"
+  c64u d64 retitle-file game.d64 "giana sisters.prg" "GIANA{$A0}SISTERS"
+  c64u d64 retitle-file work.d81 --dir tools "OLD" "NEW"`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		imagePath := args[0]
+		dirPath, _ := cmd.Flags().GetString("dir")
+
+		img, err := openImageDir(imagePath, dirPath)
+		if err != nil {
+			formatter.Error("Cannot open disk image", []string{err.Error()})
+			return
+		}
+		file, err := findImageFile(img, args[1])
+		if err != nil {
+			formatter.Error("File not found", []string{fmt.Sprintf("%s: %v", args[1], err)})
+			return
+		}
+		newName, err := petscii.FromEscaped(args[2])
+		if err != nil || len(newName) == 0 || len(newName) > 16 {
+			formatter.Error("Invalid file name", []string{petsciiProblem(args[2], err, "1 to 16")})
+			return
+		}
+		if bytes.Equal(file.Name, newName) {
+			formatter.Info("Name unchanged")
+			return
+		}
+		if _, err := img.Find(newName); err == nil {
+			formatter.Error("File exists", []string{
+				fmt.Sprintf(`"%s" is already in the directory`, petscii.ToEscaped(newName)),
+			})
+			return
+		}
+
+		if err := img.Rename(file.Name, newName); err != nil {
+			formatter.Error("Failed to rename file", []string{err.Error()})
+			return
+		}
+		if err := img.Save(imagePath); err != nil {
+			formatter.Error("Failed to write disk image", []string{err.Error()})
+			return
+		}
+		formatter.Success("File renamed", map[string]interface{}{
+			"old": petscii.ToEscaped(file.Name),
+			"new": petscii.ToEscaped(newName),
+		})
+	},
+}
+
+// findImageFile finds a directory entry by its PETSCII name (as text with
+// {$hh} escapes) or by its host name
+func findImageFile(img *diskimage.Image, name string) (diskimage.File, error) {
+	files, err := img.Files()
+	if err != nil {
+		return diskimage.File{}, err
+	}
+	if codes, err := petscii.FromEscaped(name); err == nil {
+		for _, f := range files {
+			if bytes.Equal(f.Name, codes) {
+				return f, nil
+			}
+		}
+	}
+	for _, f := range files {
+		if diskimage.HostName(f) == name {
+			return f, nil
+		}
+	}
+	return diskimage.File{}, diskimage.ErrNotFound
+}
+
+// petsciiProblem describes why text is not a valid name of the given
+// length
+func petsciiProblem(text string, err error, length string) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("'%s' must be %s PETSCII characters", text, length)
+}
+
+func init() {
+	d64Cmd.AddCommand(d64RenameCmd)
+	d64Cmd.AddCommand(d64RetitleFileCmd)
+	d64RenameCmd.Flags().String("name", "", "New disk name (up to 16 characters)")
+	d64RenameCmd.Flags().String("id", "", "New disk ID (2 characters)")
+	d64RenameCmd.Flags().String("dir", "", "Change the header of this D81 partition or DNP subdirectory")
+	d64RetitleFileCmd.Flags().String("dir", "", "The file is in this D81 partition or DNP subdirectory")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/schedule"
+	"github.com/spf13/cobra"
+)
+
+// daemonCmd runs c64u as a long-lived background process
+var daemonCmd = &cobra.Command{
+	Use:   "daemon [--log FILE] [--listen ADDR]",
+	Short: "Run the c64u daemon (scheduled jobs, HTTP API)",
+	Long: `Run c64u in the foreground as a daemon that executes the scheduled jobs
+defined in config.toml (see "c64u schedule --help").
+
+Each job runs as a separate c64u process against the same device, so the
+device lock serializes jobs with other c64u invocations. Job output and
+results are logged to stderr or to the file given with --log.
+
+With --listen (or listen in the [daemon] section) the daemon also serves an
+HTTP API that queues c64u commands, e.g. for a web UI shared at a party.
+Requests authenticate with "Authorization: Bearer <token>"; each token in
+[[daemon.tokens]] has a scope:
+  view   status queries (about, info, drives list, files info/df/tree, ...),
+         run with --read-only
+  run    also runners, run, dir, drives mount/unmount/reset and machine
+         reset/pause/resume/menu-button
+  admin  any command (except console and daemon)
+Below admin, only a command's own flags are accepted and file arguments
+must be paths on the device. Commands run one at a time and are stopped
+after command_timeout (default 5m).
+
+Endpoints:
+  GET  /v1/status          daemon and token information
+  POST /v1/commands        queue {"args": ["runners", "sidplay", "/Usb0/a.sid"]}
+  GET  /v1/commands        queued and recent commands
+  GET  /v1/commands/{id}   state, exit code and output of a command
+
+Examples:
+  c64u daemon --log ~/.config/c64u/daemon.log
+  c64u daemon --listen 0.0.0.0:6465
+  curl -H "Authorization: Bearer $TOKEN" -d '{"args":["run","/Usb0/demo.prg"]}' \
+    http://c64host:6465/v1/commands`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logFile, _ := cmd.Flags().GetString("log")
+
+		var logOut io.Writer = os.Stderr
+		if logFile != "" {
+			f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				formatter.Error("Failed to open log file", []string{err.Error()})
+				return
+			}
+			defer f.Close()
+			logOut = f
+		}
+		logger := log.New(logOut, "c64u: ", log.LstdFlags)
+
+		jobs, err := loadScheduledJobs()
+		if err != nil {
+			formatter.Error("Failed to load scheduled jobs", []string{err.Error()})
+			return
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			formatter.Error("Failed to load config", []string{err.Error()})
+			return
+		}
+		listen := cfg.Daemon.Listen
+		if cmd.Flags().Changed("listen") {
+			listen, _ = cmd.Flags().GetString("listen")
+		}
+
+		logger.Printf("daemon started for %s:%d with %d scheduled job(s)", host, port, len(jobs))
+		for _, job := range jobs {
+			logger.Printf("job '%s' (%s) next run at %s", job.Name, job.Spec, job.Next(time.Now()).Format(time.RFC3339))
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if listen != "" {
+			srv, err := startDaemonAPI(ctx, cfg.Daemon, listen, logger)
+			if err != nil {
+				formatter.Error("Failed to start the daemon API", []string{err.Error()})
+				return
+			}
+			defer func() {
+				shutdown, done := context.WithTimeout(context.Background(), 2*time.Second)
+				srv.Shutdown(shutdown)
+				done()
+			}()
+		}
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+		runScheduler(jobs, logger, stop)
+		logger.Printf("daemon stopped")
+	},
+}
+
+// runScheduler executes jobs as they become due until stop receives a signal
+func runScheduler(jobs []*schedule.Job, logger *log.Logger, stop <-chan os.Signal) {
+	next := make([]time.Time, len(jobs))
+	now := time.Now()
+	for i, job := range jobs {
+		next[i] = job.Next(now)
+	}
+
+	for {
+		// Find the earliest due job
+		var wake time.Time
+		for _, t := range next {
+			if !t.IsZero() && (wake.IsZero() || t.Before(wake)) {
+				wake = t
+			}
+		}
+
+		var timer <-chan time.Time
+		if !wake.IsZero() {
+			timer = time.After(time.Until(wake))
+		}
+
+		select {
+		case sig := <-stop:
+			logger.Printf("received %s, shutting down", sig)
+			return
+		case <-timer:
+		}
+
+		now := time.Now()
+		for i, job := range jobs {
+			if next[i].IsZero() || now.Before(next[i]) {
+				continue
+			}
+
+			logger.Printf("running job '%s': c64u %s", job.Name, strings.Join(job.Args, " "))
+			var out bytes.Buffer
+			elapsed, err := runScheduledJob(job, &out)
+			for _, line := range strings.Split(strings.TrimRight(out.String(), "\n"), "\n") {
+				if line != "" {
+					logger.Printf("[%s] %s", job.Name, line)
+				}
+			}
+			if err != nil {
+				logger.Printf("job '%s' failed after %s: %v", job.Name, output.HumanDuration(elapsed), err)
+			} else {
+				logger.Printf("job '%s' completed in %s", job.Name, output.HumanDuration(elapsed))
+			}
+
+			next[i] = job.Next(time.Now())
+			logger.Printf("job '%s' next run at %s", job.Name, next[i].Format(time.RFC3339))
+		}
+	}
+}
+
+func init() {
+	daemonCmd.Flags().String("log", "", "Append daemon log to this file instead of stderr")
+	daemonCmd.Flags().String("listen", "", "Serve the HTTP API on this address (e.g. 0.0.0.0:6465)")
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/fetch"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/schedule"
+	"github.com/spf13/pflag"
+)
+
+// ============================================================================
+// Daemon API
+// ============================================================================
+
+// Permission scopes of API tokens, each including the ones before it
+const (
+	scopeView  = "view"
+	scopeRun   = "run"
+	scopeAdmin = "admin"
+)
+
+var scopeLevels = map[string]int{scopeView: 1, scopeRun: 2, scopeAdmin: 3}
+
+// apiViewCommands only query the device; they run with --read-only
+var apiViewCommands = map[string]bool{
+	"about":         true,
+	"info":          true,
+	"version":       true,
+	"drives list":   true,
+	"files info":    true,
+	"files df":      true,
+	"files tree":    true,
+	"modem status":  true,
+	"power status":  true,
+	"schedule list": true,
+}
+
+// apiRunCommands start programs and change disks, but cannot reconfigure,
+// flash, delete or power off the device
+var apiRunCommands = map[string]bool{
+	"run":                 true,
+	"dir":                 true,
+	"runners sidplay":     true,
+	"runners modplay":     true,
+	"runners load-prg":    true,
+	"runners run-prg":     true,
+	"runners run-crt":     true,
+	"drives mount":        true,
+	"drives unmount":      true,
+	"drives reset":        true,
+	"machine reset":       true,
+	"machine pause":       true,
+	"machine resume":      true,
+	"machine menu-button": true,
+}
+
+// apiInteractiveCommands need a terminal or never finish
+var apiInteractiveCommands = map[string]bool{
+	"console": true,
+	"daemon":  true,
+}
+
+// apiToken is a configured token
+type apiToken struct {
+	name  string
+	token string
+	scope string
+}
+
+// apiCommand is a command queued through the API
+type apiCommand struct {
+	ID       int        `json:"id"`
+	Args     []string   `json:"args"`
+	Token    string     `json:"token"`
+	State    string     `json:"state"`
+	Queued   time.Time  `json:"queued"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	ExitCode *int       `json:"exit_code,omitempty"`
+	Output   string     `json:"output,omitempty"`
+	Error    string     `json:"error,omitempty"`
+
+	// readOnly runs the command with --read-only
+	readOnly bool
+}
+
+// commandHistory is how many finished commands the API remembers
+const commandHistory = 100
+
+// daemonAPI serves the daemon's HTTP API
+type daemonAPI struct {
+	tokens  []apiToken
+	timeout time.Duration
+	logger  *log.Logger
+
+	mu       sync.Mutex
+	nextID   int
+	commands []*apiCommand
+	queue    chan *apiCommand
+}
+
+// newDaemonAPI validates the configured tokens
+func newDaemonAPI(cfg config.DaemonConfig, logger *log.Logger) (*daemonAPI, error) {
+	if len(cfg.Tokens) == 0 {
+		return nil, errors.New("no API tokens configured ([[daemon.tokens]] in config.toml)")
+	}
+	a := &daemonAPI{
+		timeout: cfg.CommandTimeout,
+		logger:  logger,
+		nextID:  1,
+		queue:   make(chan *apiCommand, commandHistory),
+	}
+	seen := make(map[string]bool)
+	for _, t := range cfg.Tokens {
+		if t.Name == "" {
+			return nil, errors.New("API token without a name")
+		}
+		if len(t.Token) < 16 {
+			return nil, fmt.Errorf("API token '%s' is shorter than 16 characters", t.Name)
+		}
+		if scopeLevels[t.Scope] == 0 {
+			return nil, fmt.Errorf("API token '%s': invalid scope '%s' (use view, run or admin)", t.Name, t.Scope)
+		}
+		if seen[t.Token] {
+			return nil, fmt.Errorf("API token '%s' duplicates another token", t.Name)
+		}
+		seen[t.Token] = true
+		a.tokens = append(a.tokens, apiToken{name: t.Name, token: t.Token, scope: t.Scope})
+	}
+	return a, nil
+}
+
+// handler returns the API routes
+func (a *daemonAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", a.auth(scopeView, a.handleStatus))
+	mux.HandleFunc("GET /v1/commands", a.auth(scopeView, a.handleList))
+	mux.HandleFunc("POST /v1/commands", a.auth(scopeView, a.handleSubmit))
+	mux.HandleFunc("GET /v1/commands/{id}", a.auth(scopeView, a.handleGet))
+	return mux
+}
+
+// auth authenticates the bearer token and checks its scope
+func (a *daemonAPI) auth(scope string, next func(http.ResponseWriter, *http.Request, apiToken)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		var token *apiToken
+		for i := range a.tokens {
+			if ok && subtle.ConstantTimeCompare([]byte(given), []byte(a.tokens[i].token)) == 1 {
+				token = &a.tokens[i]
+			}
+		}
+		if token == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="c64u"`)
+			apiError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		if scopeLevels[token.scope] < scopeLevels[scope] {
+			apiError(w, http.StatusForbidden, fmt.Sprintf("token '%s' lacks the %s scope", token.name, scope))
+			return
+		}
+		next(w, r, *token)
+	}
+}
+
+func (a *daemonAPI) handleStatus(w http.ResponseWriter, r *http.Request, token apiToken) {
+	a.mu.Lock()
+	queued := 0
+	for _, c := range a.commands {
+		if c.State == "queued" {
+			queued++
+		}
+	}
+	a.mu.Unlock()
+
+	apiJSON(w, http.StatusOK, map[string]interface{}{
+		"device":  fmt.Sprintf("%s:%d", host, port),
+		"version": version,
+		"token":   token.name,
+		"scope":   token.scope,
+		"queued":  queued,
+		"playing": loadRunning(),
+	})
+}
+
+func (a *daemonAPI) handleList(w http.ResponseWriter, r *http.Request, token apiToken) {
+	a.mu.Lock()
+	list := make([]apiCommand, 0, len(a.commands))
+	for _, c := range a.commands {
+		entry := *c
+		entry.Output = ""
+		list = append(list, entry)
+	}
+	a.mu.Unlock()
+	apiJSON(w, http.StatusOK, map[string]interface{}{"commands": list})
+}
+
+func (a *daemonAPI) handleGet(w http.ResponseWriter, r *http.Request, token apiToken) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apiError(w, http.StatusNotFound, "no such command")
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, c := range a.commands {
+		if c.ID == id {
+			apiJSON(w, http.StatusOK, c)
+			return
+		}
+	}
+	apiError(w, http.StatusNotFound, "no such command")
+}
+
+func (a *daemonAPI) handleSubmit(w http.ResponseWriter, r *http.Request, token apiToken) {
+	var req struct {
+		Args []string `json:"args"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	scope, err := commandScope(req.Args, token.scope)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if scopeLevels[token.scope] < scopeLevels[scope] {
+		apiError(w, http.StatusForbidden, fmt.Sprintf("'%s' needs the %s scope", strings.Join(req.Args, " "), scope))
+		return
+	}
+
+	a.mu.Lock()
+	c := &apiCommand{
+		ID:       a.nextID,
+		Args:     req.Args,
+		Token:    token.name,
+		State:    "queued",
+		Queued:   time.Now(),
+		readOnly: scope == scopeView,
+	}
+	select {
+	case a.queue <- c:
+	default:
+		a.mu.Unlock()
+		apiError(w, http.StatusServiceUnavailable, "command queue is full")
+		return
+	}
+	a.nextID++
+	a.commands = append(a.commands, c)
+	a.prune()
+	entry := *c
+	a.mu.Unlock()
+
+	a.logger.Printf("api: '%s' queued command %d: c64u %s", token.name, c.ID, strings.Join(c.Args, " "))
+	w.Header().Set("Location", fmt.Sprintf("/v1/commands/%d", c.ID))
+	apiJSON(w, http.StatusAccepted, entry)
+}
+
+// prune forgets the oldest finished commands; a.mu must be held
+func (a *daemonAPI) prune() {
+	for len(a.commands) > commandHistory {
+		i := 0
+		for i < len(a.commands) && (a.commands[i].State == "queued" || a.commands[i].State == "running") {
+			i++
+		}
+		if i == len(a.commands) {
+			return
+		}
+		a.commands = append(a.commands[:i], a.commands[i+1:]...)
+	}
+}
+
+// run executes queued commands one at a time until ctx is done
+func (a *daemonAPI) run(ctx context.Context) {
+	for {
+		var c *apiCommand
+		select {
+		case <-ctx.Done():
+			return
+		case c = <-a.queue:
+		}
+
+		a.mu.Lock()
+		started := time.Now()
+		c.State = "running"
+		c.Started = &started
+		args := c.Args
+		if c.readOnly {
+			args = append([]string{"--read-only"}, args...)
+		}
+		a.mu.Unlock()
+
+		out, code, err := a.exec(ctx, c.ID, args)
+
+		a.mu.Lock()
+		finished := time.Now()
+		c.Finished = &finished
+		c.Output = out
+		c.ExitCode = code
+		switch {
+		case err != nil:
+			c.State = "failed"
+			c.Error = err.Error()
+		case *code != 0:
+			c.State = "failed"
+		default:
+			c.State = "done"
+		}
+		a.mu.Unlock()
+		a.logger.Printf("api: command %d %s in %s", c.ID, c.State, finished.Sub(started).Round(time.Millisecond))
+	}
+}
+
+// exec runs one command with the configured timeout
+func (a *daemonAPI) exec(ctx context.Context, id int, args []string) (string, *int, error) {
+	job := &schedule.Job{Name: fmt.Sprintf("api-%d", id), Args: args}
+	c, err := jobCommand(job)
+	if err != nil {
+		return "", nil, err
+	}
+	var out strings.Builder
+	c.Stdout = &out
+	c.Stderr = &out
+	if err := c.Start(); err != nil {
+		return "", nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+	var timeout <-chan time.Time
+	if a.timeout > 0 {
+		timeout = time.After(a.timeout)
+	}
+	var reason error
+	select {
+	case err = <-done:
+	case <-timeout:
+		c.Process.Signal(os.Interrupt)
+		reason = fmt.Errorf("stopped after %s", a.timeout)
+	case <-ctx.Done():
+		c.Process.Signal(os.Interrupt)
+		reason = errors.New("daemon shutting down")
+	}
+	if reason != nil {
+		select {
+		case err = <-done:
+		case <-time.After(5 * time.Second):
+			c.Process.Kill()
+			err = <-done
+		}
+	}
+
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+		err = nil
+	}
+	if reason != nil {
+		err = reason
+	}
+	return out.String(), &code, err
+}
+
+// commandTreeMu serializes lookups in the command tree: cobra merges flag
+// sets on lookup, which is not safe from concurrent requests
+var commandTreeMu sync.Mutex
+
+// commandScope returns the scope a command line needs. Tokens below admin
+// may only use the command's own flags, and file arguments must be paths
+// on the device, so the daemon host's files and settings stay out of reach.
+func commandScope(args []string, tokenScope string) (string, error) {
+	commandTreeMu.Lock()
+	defer commandTreeMu.Unlock()
+	if len(args) == 0 {
+		return "", errors.New("no command given")
+	}
+	cmd, rest, err := rootCmd.Find(args)
+	if err != nil || cmd == rootCmd {
+		return "", fmt.Errorf("unknown command '%s'", args[0])
+	}
+	path := strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" ")
+	if apiInteractiveCommands[path] || cmd.Run == nil {
+		return "", fmt.Errorf("'%s' cannot be run through the API", path)
+	}
+
+	scope := scopeAdmin
+	switch {
+	case apiViewCommands[path]:
+		scope = scopeView
+	case apiRunCommands[path]:
+		scope = scopeRun
+	}
+	if tokenScope == scopeAdmin {
+		return scope, nil
+	}
+
+	local := cmd.LocalNonPersistentFlags()
+	for _, arg := range rest {
+		if arg == "-" || fetch.IsURL(arg) {
+			return "", fmt.Errorf("'%s': only paths on the device are allowed", arg)
+		}
+		if name, ok := strings.CutPrefix(arg, "--"); ok {
+			name, _, _ = strings.Cut(name, "=")
+			if local.Lookup(name) == nil {
+				return "", fmt.Errorf("flag --%s is not allowed", name)
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "-") && len(arg) > 1 && !isNumber(arg) {
+			if !shorthandsAllowed(local, arg[1:]) {
+				return "", fmt.Errorf("flag %s is not allowed", arg)
+			}
+			continue
+		}
+		if _, err := os.Stat(arg); err == nil {
+			return "", fmt.Errorf("'%s': only paths on the device are allowed", arg)
+		}
+	}
+	return scope, nil
+}
+
+// shorthandsAllowed reports whether all shorthand flags in s are local
+func shorthandsAllowed(flags *pflag.FlagSet, s string) bool {
+	for _, r := range s {
+		if r == '=' {
+			return true
+		}
+		if flags.ShorthandLookup(string(r)) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isNumber reports whether s is a (negative) number argument
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// apiJSON writes a JSON response
+func apiJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiError writes an error response
+func apiError(w http.ResponseWriter, status int, msg string) {
+	apiJSON(w, status, map[string]interface{}{"errors": []string{msg}})
+}
+
+// startDaemonAPI serves the API on listen until ctx is done
+func startDaemonAPI(ctx context.Context, cfg config.DaemonConfig, listen string, logger *log.Logger) (*http.Server, error) {
+	a, err := newDaemonAPI(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: a.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go a.run(ctx)
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Printf("api: %v", err)
+		}
+	}()
+	logger.Printf("api listening on %s with %d token(s)", ln.Addr(), len(a.tokens))
+	return srv, nil
+}
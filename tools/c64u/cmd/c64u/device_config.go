@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+)
+
+// Helpers for commands built on the device configuration API
+
+// matchConfigItem finds an item by exact name or unique case-insensitive
+// substring
+func matchConfigItem(items []api.ConfigItem, name string) (api.ConfigItem, error) {
+	want := strings.ToLower(name)
+	var matches []api.ConfigItem
+	for _, it := range items {
+		lower := strings.ToLower(it.Name)
+		if lower == want {
+			return it, nil
+		}
+		if strings.Contains(lower, want) {
+			matches = append(matches, it)
+		}
+	}
+
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return api.ConfigItem{}, fmt.Errorf("no setting matches '%s'", name)
+	}
+
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = m.Name
+	}
+	return api.ConfigItem{}, fmt.Errorf("'%s' is ambiguous: %s", name, strings.Join(names, ", "))
+}
+
+// saveConfigToFlash makes the current device configuration persistent
+func saveConfigToFlash() bool {
+	resp, err := apiClient.ConfigSaveToFlash()
+	if err != nil {
+		formatter.Error("Failed to save configuration", []string{err.Error()})
+		return false
+	}
+	if resp.HasErrors() {
+		formatter.Error("API returned errors", resp.Errors)
+		return false
+	}
+	return true
+}
+
+// setConfigItem changes a configuration item, reporting failures
+func setConfigItem(item api.ConfigItem, value string) bool {
+	if preserved != nil {
+		preserved.remember(item)
+	}
+	resp, err := apiClient.ConfigSet(item.Category, item.Name, value)
+	if err != nil {
+		formatter.Error(fmt.Sprintf("Failed to set %s", item.Name), []string{err.Error()})
+		return false
+	}
+	if resp.HasErrors() {
+		formatter.Error("API returned errors", resp.Errors)
+		return false
+	}
+	return true
+}
+
+// configOptions returns the allowed values of an enumerated item, or nil
+func configOptions(item api.ConfigItem) []string {
+	items, err := apiClient.ConfigItems(item.Category, item.Name)
+	if err != nil || len(items) != 1 {
+		return nil
+	}
+
+	raw, _ := items[0].Details["values"].([]interface{})
+	options := make([]string, 0, len(raw))
+	for _, v := range raw {
+		options = append(options, fmt.Sprintf("%v", v))
+	}
+	return options
+}
+
+var levelPattern = regexp.MustCompile(`[-+]?\d+`)
+
+// closestLevel picks the option whose number (e.g. "-6 dB") is closest to
+// level, ignoring options without a number such as "OFF"
+func closestLevel(options []string, level int) (string, bool) {
+	best, bestDiff := "", -1
+	for _, opt := range options {
+		m := levelPattern.FindString(opt)
+		if m == "" {
+			continue
+		}
+		n, _ := strconv.Atoi(m)
+		diff := n - level
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff < 0 || diff < bestDiff {
+			best, bestDiff = opt, diff
+		}
+	}
+	return best, bestDiff >= 0
+}
+
+// printConfigItems prints configuration items as a table
+func printConfigItems(items []api.ConfigItem) {
+	if jsonOut {
+		formatter.PrintData(map[string]interface{}{"settings": items})
+		return
+	}
+
+	rows := make([][]string, 0, len(items))
+	for _, it := range items {
+		rows = append(rows, []string{it.Category, it.Name, fmt.Sprintf("%v", it.Value)})
+	}
+	formatter.PrintTable([]string{"category", "setting", "value"}, rows)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/basic"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/keyboard"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+var dirCmd = &cobra.Command{
+	Use:   "dir [drive] [--timeout D]",
+	Short: "List a disk directory as the C64 sees it",
+	Long: `Load the directory of a drive with LOAD"$" and print it.
+
+The listing is parsed from the BASIC program in C64 memory, so it shows what
+the drive itself reports, including softloaded or custom filesystems. The
+drive may be given as a device number (default 8) or drive name (a, b).
+
+The machine must be at the READY. prompt. Any BASIC program in memory is
+replaced by the directory listing.
+
+Examples:
+  c64u dir
+  c64u dir 9
+  c64u dir b
+  c64u --json dir`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		drive := "8"
+		if len(args) > 0 {
+			drive = args[0]
+		}
+		device, err := driveDevice(drive)
+		if err != nil {
+			formatter.Error("Unknown drive", []string{err.Error()})
+			return
+		}
+
+		line := fmt.Sprintf(`LOAD"$",%d`, device)
+		codes, _ := petscii.FromText(line)
+		if err := keyboard.Type(apiClient, append(codes, petscii.Return), timeout); err != nil {
+			formatter.Error("Failed to type LOAD command", []string{err.Error()})
+			return
+		}
+
+		out, _, err := waitForOutput(line, timeout)
+		if err != nil {
+			formatter.Error("Directory load did not finish", []string{err.Error()})
+			return
+		}
+		for _, l := range out {
+			if strings.HasPrefix(l, "?") {
+				formatter.Error("Failed to load directory", []string{strings.TrimPrefix(l, "?")})
+				return
+			}
+		}
+
+		pointers, err := readMemory(basic.TXTTAB, 4)
+		if err != nil {
+			formatter.Error("Failed to read BASIC pointers", []string{err.Error()})
+			return
+		}
+		start := int(pointers[0]) | int(pointers[1])<<8
+		end := int(pointers[2]) | int(pointers[3])<<8
+		if end <= start {
+			formatter.Error("No directory in memory", []string{fmt.Sprintf("BASIC program is empty ($%04X-$%04X)", start, end)})
+			return
+		}
+
+		program, err := readMemory(start, end-start)
+		if err != nil {
+			formatter.Error("Failed to read directory", []string{err.Error()})
+			return
+		}
+
+		dir, err := basic.ParseDirectory(program, start)
+		if err != nil {
+			formatter.Error("Failed to parse directory", []string{err.Error()})
+			return
+		}
+
+		if jsonOut {
+			formatter.PrintData(dir)
+			return
+		}
+
+		formatter.PrintHeader(fmt.Sprintf(`0 "%s" %s`, dir.DiskName, dir.DiskID))
+		for _, e := range dir.Entries {
+			fmt.Println(basic.FormatEntry(e))
+		}
+		fmt.Printf("%d BLOCKS FREE.\n", dir.BlocksFree)
+	},
+}
+
+// driveDevice resolves a device number or drive name to an IEC device number
+func driveDevice(drive string) (int, error) {
+	if n, err := strconv.Atoi(drive); err == nil {
+		if n < 4 || n > 30 {
+			return 0, fmt.Errorf("device number %d out of range (4-30)", n)
+		}
+		return n, nil
+	}
+
+	resp, err := apiClient.DrivesList()
+	if err != nil {
+		return 0, err
+	}
+	drives, _ := resp.Data["drives"].([]interface{})
+	for _, driveData := range drives {
+		driveMap, _ := driveData.(map[string]interface{})
+		if info, ok := driveMap[drive].(map[string]interface{}); ok {
+			if busID, ok := info["bus_id"].(float64); ok {
+				return int(busID), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no drive named '%s'", drive)
+}
+
+func init() {
+	dirCmd.Flags().Duration("timeout", 30*time.Second, "How long to wait for the directory to load")
+}
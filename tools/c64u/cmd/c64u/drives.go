@@ -3,8 +3,14 @@ package main
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/imagecache"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/mounts"
 	"github.com/spf13/cobra"
 )
 
@@ -40,99 +46,110 @@ var drivesListCmd = &cobra.Command{
 
 		if jsonOut {
 			formatter.PrintData(resp.Data)
-		} else {
-			// Parse drives data
-			drives, ok := resp.Data["drives"].([]interface{})
-			if !ok || len(drives) == 0 {
-				formatter.Info("No drives found")
-				return
-			}
+			return
+		}
 
-			formatter.PrintHeader("C64 Ultimate Drives")
-			fmt.Println()
+		wide, _ := cmd.Flags().GetBool("wide")
 
-			// Print each drive
-			for _, driveData := range drives {
-				driveMap, ok := driveData.(map[string]interface{})
+		// Parse drives data
+		drives, ok := resp.Data["drives"].([]interface{})
+		if !ok || len(drives) == 0 {
+			formatter.Info("No drives found")
+			return
+		}
+
+		headers := []string{"Drive", "Bus ID", "Type", "Status", "Image", "Last Error"}
+		var rows [][]string
+		var partitionLines []string
+
+		for _, driveData := range drives {
+			driveMap, ok := driveData.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			// Each drive is a map with one key (the drive name)
+			for driveName, driveInfo := range driveMap {
+				info, ok := driveInfo.(map[string]interface{})
 				if !ok {
 					continue
 				}
 
-				// Each drive is a map with one key (the drive name)
-				for driveName, driveInfo := range driveMap {
-					info, ok := driveInfo.(map[string]interface{})
-					if !ok {
-						continue
-					}
-
-					// Print drive header
-					enabledText := ""
-					if e, ok := info["enabled"].(bool); ok && e {
-						enabledText = " (Enabled ✓)"
-					} else {
-						enabledText = " (Disabled ✗)"
-					}
+				busID := "-"
+				if id, ok := info["bus_id"].(float64); ok {
+					busID = fmt.Sprintf("%d", int(id))
+				}
 
-					formatter.PrintHeader(fmt.Sprintf("%s%s", driveName, enabledText))
-					fmt.Println()
+				driveType := "-"
+				if t, ok := info["type"].(string); ok && t != "" {
+					driveType = t
+				}
 
-					// Print drive details
-					if busID, ok := info["bus_id"].(float64); ok {
-						formatter.PrintKeyValue("Bus ID", fmt.Sprintf("%d", int(busID)))
-					}
+				status := "off"
+				if e, ok := info["enabled"].(bool); ok && e {
+					status = "on"
+				}
 
-					if driveType, ok := info["type"].(string); ok && driveType != "" {
-						formatter.PrintKeyValue("Type", driveType)
+				image := "-"
+				if imageName, ok := info["image_file"].(string); ok && imageName != "" {
+					image = imageName
+					if imagePath, ok := info["image_path"].(string); ok && imagePath != "" && wide {
+						image = path.Join(imagePath, imageName)
 					}
+				}
 
-					if rom, ok := info["rom"].(string); ok && rom != "" {
-						formatter.PrintKeyValue("ROM", rom)
+				lastError := "-"
+				if e, ok := info["last_error"].(string); ok && e != "" {
+					lastError = e
+					if !wide {
+						lastError = truncate(lastError, 30)
 					}
+				}
 
-					// Image info
-					if imageName, ok := info["image_file"].(string); ok && imageName != "" {
-						formatter.PrintKeyValue("Image", imageName)
-						if imagePath, ok := info["image_path"].(string); ok && imagePath != "" {
-							formatter.PrintKeyValue("Path", imagePath)
-						}
-					} else {
-						fmt.Println("  No disk mounted")
-					}
+				rows = append(rows, []string{driveName, busID, driveType, status, image, lastError})
 
-					// Partitions info
-					if partitions, ok := info["partitions"].([]interface{}); ok && len(partitions) > 0 {
-						fmt.Println()
-						fmt.Println("  Partitions:")
-						for _, partition := range partitions {
-							if partMap, ok := partition.(map[string]interface{}); ok {
-								partID := ""
-								partPath := ""
-								if id, ok := partMap["id"].(float64); ok {
-									partID = fmt.Sprintf("%d", int(id))
-								}
-								if path, ok := partMap["path"].(string); ok {
-									partPath = path
-								}
-								if partID != "" && partPath != "" {
-									fmt.Printf("    [%s] %s\n", partID, partPath)
-								}
+				// Partitions info
+				if partitions, ok := info["partitions"].([]interface{}); ok && len(partitions) > 0 {
+					for _, partition := range partitions {
+						if partMap, ok := partition.(map[string]interface{}); ok {
+							partID := ""
+							partPath := ""
+							if id, ok := partMap["id"].(float64); ok {
+								partID = fmt.Sprintf("%d", int(id))
+							}
+							if p, ok := partMap["path"].(string); ok {
+								partPath = p
+							}
+							if partID != "" && partPath != "" {
+								partitionLines = append(partitionLines, fmt.Sprintf("  %s [%s] %s", driveName, partID, partPath))
 							}
 						}
 					}
+				}
+			}
+		}
 
-					// Last error info
-					if lastError, ok := info["last_error"].(string); ok && lastError != "" {
-						fmt.Println()
-						formatter.PrintKeyValue("Last Error", lastError)
-					}
+		formatter.PrintTable(headers, rows)
 
-					fmt.Println()
-				}
+		if len(partitionLines) > 0 {
+			fmt.Println()
+			formatter.PrintHeader("Partitions")
+			for _, line := range partitionLines {
+				fmt.Println(line)
 			}
 		}
 	},
 }
 
+// truncate shortens s to at most n characters, marking the cut with "…"
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
 // ============================================================================
 // Mount/Unmount Operations
 // ============================================================================
@@ -155,6 +172,7 @@ Example:
 		imageType, _ := cmd.Flags().GetString("type")
 		mode, _ := cmd.Flags().GetString("mode")
 
+		prev, _ := currentMount(drive)
 		resp, err := apiClient.DrivesMount(drive, image, imageType, mode)
 		if err != nil {
 			formatter.Error("Failed to mount image", []string{err.Error()})
@@ -166,6 +184,8 @@ Example:
 			return
 		}
 
+		recordMount(drive, &mounts.Mount{Image: image, Type: imageType, Mode: mode}, prev)
+
 		data := map[string]interface{}{
 			"drive": drive,
 			"image": filepath.Base(image),
@@ -186,22 +206,111 @@ Drive: 8, 9, 10, 11
 Types: d64, g64, d71, g71, d81
 Modes: readwrite, readonly, unlinked
 
-Example:
-  c64u drives mount-upload 8 game.d64 --mode readonly`,
+With --delta, the image is compared to the last one uploaded to the same
+drive (tracked by hash in ~/.config/c64u/cache/images.json) and the changed
+sectors are reported. The firmware has no sector-write API, so a changed
+image is still uploaded in full. Only an unchanged image that was uploaded
+with --mode readonly and is still mounted is skipped; with the other modes
+the drive may have written to it, so it is uploaded again.
+
+Before mounting, the image is searched for known fastloaders and copy
+protections (IRQ loaders, parallel speeders, JiffyDOS, custom drive code,
+G64 tracks the DOS would not write); for each, what it needs is shown,
+with the drive type or ROM to change if the drive does not match
+(--verbose lists the unusual tracks).
+
+With --remote-cache (or remote_cache in config.toml), the image is stored
+on the device under its content hash (remote_cache_dir) via FTP and the
+stored copy is mounted; identical images are not uploaded again. As the
+copy is shared, it is mounted unlinked unless --mode readonly is given.
+
+The file may also be a .zip or .gz archive; the disk image in it is
+extracted before the upload (--entry picks one of several). A local .zip
+with several disk images is a multi-disk set: all of them are uploaded
+via FTP to remote_cache_dir/swap/<zip name>, in the order of their names,
+disk 1 is mounted and the rest become the drive's swap list for
+"drives swap". Use "-" as
+the file to read the image from stdin; it is taken as a D64 unless
+--stdin-name (e.g. disk.d81) or --type says otherwise.
+
+Examples:
+  c64u drives mount-upload 8 game.d64 --mode readonly
+  c64u drives mount-upload 8 build/disk.d64 --delta
+  c64u drives mount-upload 8 loader.d64 --remote-cache
+  c64u drives mount-upload 8 game.zip --entry "*side1*"
+  c64u drives mount-upload 8 "Last Ninja 2.zip"
+  make disk | c64u drives mount-upload 8 -`,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		drive := args[0]
-		localFile := args[1]
 		imageType, _ := cmd.Flags().GetString("type")
 		mode, _ := cmd.Flags().GetString("mode")
+		delta, _ := cmd.Flags().GetBool("delta")
 
-		// Check if file exists
-		if _, err := os.Stat(localFile); os.IsNotExist(err) {
-			formatter.Error("File not found", []string{localFile})
+		disks, ok := multiDiskArchive(cmd, args[1])
+		if !ok {
+			return
+		}
+		if disks != nil {
+			if delta || cmd.Flags().Changed("remote-cache") {
+				formatter.Error("Invalid flags", []string{"--delta and --remote-cache do not apply to a .zip with several disk images"})
+				return
+			}
+			mountDiskSet(drive, args[1], disks, imageType, mode)
 			return
 		}
 
-		resp, err := apiClient.DrivesMountUpload(drive, localFile, imageType, mode)
+		localFile, cleanup, ok := resolveUploadFile(cmd, args[1], diskExts)
+		if !ok {
+			return
+		}
+		defer cleanup()
+		adviseLoaders(drive, localFile)
+
+		var upload *deltaUpload
+		if delta {
+			var err error
+			upload, err = prepareDeltaUpload(drive, localFile, mode)
+			if err != nil {
+				formatter.Error("Failed to compare with previous upload", []string{err.Error()})
+				return
+			}
+			if upload.skip {
+				data := map[string]interface{}{
+					"drive":    drive,
+					"image":    filepath.Base(localFile),
+					"uploaded": false,
+				}
+				formatter.Success("Disk image unchanged and still mounted, skipped upload", data)
+				return
+			}
+		}
+
+		cached := useRemoteCache(cmd)
+		if cached {
+			// The cached copy is shared, so the drive must not write to it
+			switch mode {
+			case "":
+				mode = "unlinked"
+			case "readwrite":
+				formatter.Error("Invalid mode", []string{"--remote-cache cannot mount read-write; use readonly or unlinked"})
+				return
+			}
+		}
+
+		prev, _ := currentMount(drive)
+		var resp *api.Response
+		var err error
+		var remote string
+		uploaded := true
+		if cached {
+			remote, uploaded, err = remoteCopy(localFile)
+			if err == nil {
+				resp, err = apiClient.DrivesMount(drive, remote, imageType, mode)
+			}
+		} else {
+			resp, err = apiClient.DrivesMountUpload(drive, localFile, imageType, mode)
+		}
 		if err != nil {
 			formatter.Error("Failed to upload and mount image", []string{err.Error()})
 			return
@@ -212,6 +321,13 @@ Example:
 			return
 		}
 
+		if cached {
+			recordMount(drive, &mounts.Mount{Image: remote, Type: imageType, Mode: mode}, prev)
+		} else {
+			abs, _ := filepath.Abs(localFile)
+			recordMount(drive, &mounts.Mount{Image: abs, Uploaded: true, Type: imageType, Mode: mode}, prev)
+		}
+
 		data := map[string]interface{}{
 			"drive": drive,
 			"image": filepath.Base(localFile),
@@ -219,6 +335,17 @@ Example:
 		if mode != "" {
 			data["mode"] = mode
 		}
+		if cached {
+			data["remote"] = remote
+			data["uploaded"] = uploaded
+		}
+		if upload != nil {
+			upload.addSummary(data)
+			if err := upload.save(); err != nil {
+				formatter.Warning(fmt.Sprintf("Failed to update image cache: %v", err))
+			}
+		}
+		recordUpload("mount", drive, localFile)
 		formatter.Success("Disk image uploaded and mounted", data)
 	},
 }
@@ -228,12 +355,27 @@ var drivesUnmountCmd = &cobra.Command{
 	Short: "Unmount disk from drive",
 	Long: `Remove the currently mounted disk image from the specified drive.
 
+An image mounted read-write is only unmounted after confirmation, as that
+ends the session writing to it; --yes (or assume_yes in config.toml) skips
+the question. The drives API does not report the mount mode, so only
+images mounted by c64u with --mode readonly or unlinked are unmounted
+without asking.
+
 Example:
   c64u drives unmount 8`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		drive := args[0]
 
+		prev, err := currentMount(drive)
+		if err != nil {
+			formatter.Error("Failed to read drive status", []string{err.Error()})
+			return
+		}
+		if !confirmUnmount(cmd, drive, prev) {
+			return
+		}
+
 		resp, err := apiClient.DrivesRemove(drive)
 		if err != nil {
 			formatter.Error("Failed to unmount disk", []string{err.Error()})
@@ -245,10 +387,106 @@ Example:
 			return
 		}
 
+		recordMount(drive, nil, prev)
 		formatter.Success(fmt.Sprintf("Disk unmounted from drive %s", drive), nil)
 	},
 }
 
+var drivesUndoCmd = &cobra.Command{
+	Use:   "undo <drive>",
+	Short: "Restore the drive's previous mount",
+	Long: `Remount whatever was in the drive before the last mount, mount-upload,
+unmount or undo command (undo again to switch back). If the drive was
+empty, the current image is unmounted.
+
+The previous image is remounted from its path on the device, or uploaded
+again from the local file if it was uploaded, with the mode it had if c64u
+mounted it. Mounts are tracked per device in ~/.config/c64u/cache/mounts.json.
+
+Example:
+  c64u drives undo 8`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		drive := args[0]
+
+		name, _, err := driveStatus(drive)
+		if err != nil {
+			formatter.Error("Failed to read drive status", []string{err.Error()})
+			return
+		}
+		state, err := mounts.Load(mountStatePath())
+		if err != nil {
+			formatter.Error("Failed to load mount state", []string{err.Error()})
+			return
+		}
+		prev, ok := state.Undo(mounts.Key(historyDevice(), name))
+		if !ok {
+			formatter.Error("Nothing to undo", []string{fmt.Sprintf("no mount of drive %s has been recorded", drive)})
+			return
+		}
+		cur, err := currentMount(drive)
+		if err != nil {
+			formatter.Error("Failed to read drive status", []string{err.Error()})
+			return
+		}
+
+		// The drive was empty before the last mount
+		if prev == nil {
+			if cur == nil {
+				formatter.Info(fmt.Sprintf("Drive %s is already empty", drive))
+				return
+			}
+			if !confirmUnmount(cmd, drive, cur) {
+				return
+			}
+			resp, err := apiClient.DrivesRemove(drive)
+			if err != nil {
+				formatter.Error("Failed to unmount disk", []string{err.Error()})
+				return
+			}
+			if resp.HasErrors() {
+				formatter.Error("API returned errors", resp.Errors)
+				return
+			}
+			recordMount(drive, nil, cur)
+			formatter.Success(fmt.Sprintf("Disk unmounted from drive %s (it was empty before)", drive), nil)
+			return
+		}
+
+		var resp *api.Response
+		if prev.Uploaded {
+			if _, err := os.Stat(prev.Image); err != nil {
+				formatter.Error("Cannot restore the previous image", []string{
+					fmt.Sprintf("it was uploaded from %s, which no longer exists", prev.Image),
+				})
+				return
+			}
+			resp, err = apiClient.DrivesMountUpload(drive, prev.Image, prev.Type, prev.Mode)
+		} else {
+			resp, err = apiClient.DrivesMount(drive, prev.Image, prev.Type, prev.Mode)
+		}
+		if err != nil {
+			formatter.Error("Failed to mount image", []string{err.Error()})
+			return
+		}
+		if resp.HasErrors() {
+			formatter.Error("API returned errors", resp.Errors)
+			return
+		}
+
+		recordMount(drive, &mounts.Mount{Image: prev.Image, Uploaded: prev.Uploaded, Type: prev.Type, Mode: prev.Mode}, cur)
+
+		data := map[string]interface{}{
+			"drive": drive,
+			"image": filepath.Base(prev.Image),
+		}
+		if prev.Mode != "" {
+			data["mode"] = prev.Mode
+		}
+		formatter.Success("Previous disk image mounted", data)
+	},
+}
+
 // ============================================================================
 // Drive Control
 // ============================================================================
@@ -371,20 +609,34 @@ var drivesLoadROMUploadCmd = &cobra.Command{
 	Short: "Upload and load custom ROM",
 	Long: `Upload a local custom drive ROM (16K/32K) and load it temporarily.
 
-Example:
-  c64u drives load-rom-upload 8 speeddos.rom`,
+With --remote-cache the ROM is kept on the device under its content hash
+and reused on later loads instead of being uploaded again.
+
+Examples:
+  c64u drives load-rom-upload 8 speeddos.rom
+  c64u drives load-rom-upload 8 jiffydos.rom --remote-cache`,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		drive := args[0]
-		localFile := args[1]
-
-		// Check if file exists
-		if _, err := os.Stat(localFile); os.IsNotExist(err) {
-			formatter.Error("File not found", []string{localFile})
+		localFile, cleanup, ok := resolveUploadFile(cmd, args[1], romExts)
+		if !ok {
 			return
 		}
-
-		resp, err := apiClient.DrivesLoadROMUpload(drive, localFile)
+		defer cleanup()
+
+		var resp *api.Response
+		var err error
+		var remote string
+		uploaded := true
+		cached := useRemoteCache(cmd)
+		if cached {
+			remote, uploaded, err = remoteCopy(localFile)
+			if err == nil {
+				resp, err = apiClient.DrivesLoadROM(drive, remote)
+			}
+		} else {
+			resp, err = apiClient.DrivesLoadROMUpload(drive, localFile)
+		}
 		if err != nil {
 			formatter.Error("Failed to upload and load ROM", []string{err.Error()})
 			return
@@ -399,6 +651,11 @@ Example:
 			"drive": drive,
 			"rom":   filepath.Base(localFile),
 		}
+		if cached {
+			data["remote"] = remote
+			data["uploaded"] = uploaded
+		}
+		recordUpload("load_rom", drive, localFile)
 		formatter.Success("Custom ROM uploaded and loaded", data)
 	},
 }
@@ -446,6 +703,255 @@ Example:
 	},
 }
 
+// ============================================================================
+// Drive Sound and LEDs
+// ============================================================================
+
+var drivesSoundCmd = &cobra.Command{
+	Use:   "sound [on|off] [--volume DB] [--drive a|b] [--save]",
+	Short: "Show or toggle drive sound emulation",
+	Long: `Show or change the volume of the emulated drive sounds (audio mixer
+"Vol Drive" settings). "on" sets the volume to 0 dB unless --volume gives a
+level in dB; the closest level supported by the firmware is used.
+
+Examples:
+  c64u drives sound
+  c64u drives sound off
+  c64u drives sound on --volume -12
+  c64u drives sound on --drive a --save`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"on", "off"},
+	Run: func(cmd *cobra.Command, args []string) {
+		volume, _ := cmd.Flags().GetInt("volume")
+		drive, _ := cmd.Flags().GetString("drive")
+		save, _ := cmd.Flags().GetBool("save")
+
+		items, err := apiClient.ConfigItems("Audio Mixer", "Vol Drive*")
+		if err == nil && len(items) == 0 {
+			err = fmt.Errorf("no drive volume settings in the audio mixer (U64 only)")
+		}
+		if err != nil {
+			formatter.Error("Failed to read drive sound settings", []string{err.Error()})
+			return
+		}
+		items = filterDriveItems(items, drive)
+
+		if len(args) == 0 {
+			printConfigItems(items)
+			return
+		}
+
+		state := strings.ToLower(args[0])
+		if state != "on" && state != "off" {
+			formatter.Error("Invalid state", []string{fmt.Sprintf("'%s' is not on or off", args[0])})
+			return
+		}
+
+		changed := make(map[string]interface{})
+		for _, item := range items {
+			value := "OFF"
+			if state == "on" {
+				value = fmt.Sprintf("%d dB", volume)
+				if level, ok := closestLevel(configOptions(item), volume); ok {
+					value = level
+				}
+			}
+			if !setConfigItem(item, value) {
+				return
+			}
+			changed[item.Name] = value
+		}
+
+		if save && !saveConfigToFlash() {
+			return
+		}
+		formatter.Success(fmt.Sprintf("Drive sound %s", state), changed)
+	},
+}
+
+var drivesLEDCmd = &cobra.Command{
+	Use:   "led [<setting> <value>] [--save]",
+	Short: "Show or change drive/activity LED settings",
+	Long: `Show every configuration setting with "LED" in its name, or change
+one. The setting may be any unique part of its name.
+
+Examples:
+  c64u drives led
+  c64u drives led "select top" "Drive Activity" --save`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 && len(args) != 2 {
+			return fmt.Errorf("expected no arguments or <setting> <value>")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		save, _ := cmd.Flags().GetBool("save")
+
+		items, err := apiClient.ConfigItems("*", "*LED*")
+		if err == nil && len(items) == 0 {
+			err = fmt.Errorf("the device reports no LED settings")
+		}
+		if err != nil {
+			formatter.Error("Failed to read LED settings", []string{err.Error()})
+			return
+		}
+
+		if len(args) == 0 {
+			printConfigItems(items)
+			return
+		}
+
+		item, err := matchConfigItem(items, args[0])
+		if err != nil {
+			formatter.Error("Unknown LED setting", []string{err.Error()})
+			return
+		}
+		if !setConfigItem(item, args[1]) {
+			return
+		}
+		if save && !saveConfigToFlash() {
+			return
+		}
+		formatter.Success(fmt.Sprintf("%s set to %s", item.Name, args[1]), map[string]interface{}{
+			"category": item.Category,
+			"previous": item.Value,
+		})
+	},
+}
+
+// filterDriveItems keeps the per-drive items ("... 1"/"... A" for drive a,
+// "... 2"/"... B" for drive b); an empty drive keeps all
+func filterDriveItems(items []api.ConfigItem, drive string) []api.ConfigItem {
+	var suffixes []string
+	switch strings.ToLower(drive) {
+	case "":
+		return items
+	case "a", "8":
+		suffixes = []string{" 1", " A"}
+	case "b", "9":
+		suffixes = []string{" 2", " B"}
+	default:
+		formatter.Error("Invalid drive", []string{fmt.Sprintf("'%s' is not a or b", drive)})
+	}
+
+	var out []api.ConfigItem
+	for _, it := range items {
+		for _, sfx := range suffixes {
+			if strings.HasSuffix(strings.ToUpper(it.Name), sfx) {
+				out = append(out, it)
+			}
+		}
+	}
+	return out
+}
+
+// ============================================================================
+// Delta Uploads
+// ============================================================================
+
+// deltaUpload tracks a disk image upload against the image cache
+type deltaUpload struct {
+	cache *imagecache.Cache
+	key   string
+	drive string
+	entry *imagecache.Entry
+	delta *imagecache.Delta
+	skip  bool
+}
+
+// prepareDeltaUpload compares a local image with the previous upload to drive
+func prepareDeltaUpload(drive, localFile, mode string) (*deltaUpload, error) {
+	data, err := os.ReadFile(localFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := imagecache.Load(filepath.Join(config.GetConfigDir(), "cache", "images.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	u := &deltaUpload{
+		cache: cache,
+		key:   imagecache.Key(strings.TrimPrefix(apiClient.BaseURL, "http://"), drive),
+		drive: drive,
+		entry: imagecache.NewEntry(filepath.Base(localFile), data),
+	}
+	u.entry.Mode = mode
+
+	prev := cache.Get(u.key)
+	if prev == nil {
+		return u, nil
+	}
+
+	delta := imagecache.Compare(prev, u.entry)
+	u.delta = &delta
+
+	// A read-only mount can't have been modified on the device, so if it is
+	// still mounted there is nothing to upload
+	if delta.Unchanged() && prev.Mode == "readonly" && mode == "readonly" && prev.ImageFile != "" {
+		if mounted, _ := mountedImage(drive); mounted == prev.ImageFile {
+			u.skip = true
+			return u, nil
+		}
+	}
+
+	if !delta.Unchanged() && !jsonOut {
+		formatter.Info(fmt.Sprintf("%d of %d sectors changed since last upload (no sector-write API, uploading full image)",
+			len(delta.Changed), delta.Total))
+		if verbose {
+			fmt.Printf("  Changed: %s\n", describeSectors(u.entry.Name, delta.Changed))
+		}
+	}
+	return u, nil
+}
+
+// addSummary adds the delta statistics to a success message
+func (u *deltaUpload) addSummary(data map[string]interface{}) {
+	if u.delta == nil {
+		return
+	}
+	data["sectors_changed"] = len(u.delta.Changed)
+	data["sectors_total"] = u.delta.Total
+}
+
+// save records the upload in the image cache
+func (u *deltaUpload) save() error {
+	u.entry.ImageFile, _ = mountedImage(u.drive)
+	u.cache.Put(u.key, u.entry)
+	return u.cache.Save()
+}
+
+// mountedImage returns the image file name mounted in drive (name or bus ID)
+func mountedImage(drive string) (string, error) {
+	_, info, err := driveStatus(drive)
+	if err != nil {
+		return "", err
+	}
+	image, _ := info["image_file"].(string)
+	return image, nil
+}
+
+// describeSectors lists changed blocks, as track/sector for D64 images
+func describeSectors(name string, blocks []int) string {
+	const maxShown = 16
+
+	var parts []string
+	d64 := strings.EqualFold(filepath.Ext(name), ".d64")
+	for i, block := range blocks {
+		if i == maxShown {
+			parts = append(parts, fmt.Sprintf("... (%d more)", len(blocks)-maxShown))
+			break
+		}
+		if track, sector, ok := imagecache.D64Location(block); d64 && ok {
+			parts = append(parts, fmt.Sprintf("%d/%d", track, sector))
+		} else {
+			parts = append(parts, fmt.Sprintf("#%d", block))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
 func init() {
 	// Add list command
 	drivesCmd.AddCommand(drivesListCmd)
@@ -454,6 +960,8 @@ func init() {
 	drivesCmd.AddCommand(drivesMountCmd)
 	drivesCmd.AddCommand(drivesMountUploadCmd)
 	drivesCmd.AddCommand(drivesUnmountCmd)
+	drivesCmd.AddCommand(drivesUndoCmd)
+	addYesFlag(drivesUnmountCmd, drivesUndoCmd)
 
 	// Add control commands
 	drivesCmd.AddCommand(drivesResetCmd)
@@ -465,9 +973,25 @@ func init() {
 	drivesCmd.AddCommand(drivesLoadROMUploadCmd)
 	drivesCmd.AddCommand(drivesSetModeCmd)
 
+	// Add sound and LED commands
+	drivesCmd.AddCommand(drivesSoundCmd)
+	drivesCmd.AddCommand(drivesLEDCmd)
+	drivesSoundCmd.Flags().Int("volume", 0, "Volume in dB for \"on\"")
+	drivesSoundCmd.Flags().String("drive", "", "Only change drive a or b")
+	drivesSoundCmd.Flags().Bool("save", false, "Save the configuration to flash")
+	drivesLEDCmd.Flags().Bool("save", false, "Save the configuration to flash")
+	addPreserveFlags(drivesSoundCmd, drivesLEDCmd)
+
+	drivesListCmd.Flags().Bool("wide", false, "Show full image paths and untruncated errors")
+	drivesListCmd.Annotations = pagedOutput
+
 	// Add flags for mount commands
 	drivesMountCmd.Flags().String("type", "", "Image type (d64, g64, d71, g71, d81)")
 	drivesMountCmd.Flags().String("mode", "", "Mount mode (readwrite, readonly, unlinked)")
 	drivesMountUploadCmd.Flags().String("type", "", "Image type (d64, g64, d71, g71, d81)")
 	drivesMountUploadCmd.Flags().String("mode", "", "Mount mode (readwrite, readonly, unlinked)")
+	drivesMountUploadCmd.Flags().Bool("delta", false, "Report the sectors changed since the previous upload; skip it if unchanged and still mounted readonly")
+	drivesMountUploadCmd.Flags().Bool("remote-cache", false, "Reuse a content-addressed copy kept on the device")
+	drivesLoadROMUploadCmd.Flags().Bool("remote-cache", false, "Reuse a content-addressed copy kept on the device")
+	addUploadSourceFlags(drivesMountUploadCmd, drivesLoadROMUploadCmd)
 }
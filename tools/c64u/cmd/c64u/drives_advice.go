@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/fastload"
+)
+
+// ============================================================================
+// Fastloader Advice
+// ============================================================================
+
+// adviseLoaders warns about fastloaders and protections on an image about
+// to be mounted, and about drive settings they will not work with
+func adviseLoaders(drive, file string) {
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext == ".g71" {
+		return
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	findings, notes, err := fastload.Scan(file, data)
+	if err != nil || len(findings) == 0 {
+		return
+	}
+
+	// Drive settings are only compared if the device reports them
+	_, info, err := driveStatus(drive)
+	driveType, rom := "", ""
+	if err == nil {
+		driveType, _ = info["type"].(string)
+		rom, _ = info["rom"].(string)
+	}
+
+	for _, f := range findings {
+		where := ""
+		if f.File != "" {
+			where = fmt.Sprintf(" (in %s)", f.File)
+		}
+		formatter.Warning(fmt.Sprintf("%s%s: %s", f.Loader.Name, where, f.Loader.Advice))
+		if f.Loader.GCR && ext != ".g64" {
+			formatter.Info("  This is a " + strings.ToUpper(ext[1:]) + " image: the GCR data the loader checks is not in it")
+		}
+		if f.Drive != "" && driveType != "" && driveType != f.Drive {
+			formatter.Info(fmt.Sprintf("  Drive %s is a %s: c64u drives set-mode %s %s", drive, driveType, drive, f.Drive))
+		}
+		if f.Loader.ROM != "" && rom != "" && !strings.Contains(strings.ToLower(rom), f.Loader.ROM) {
+			formatter.Info(fmt.Sprintf("  Drive %s runs %s: load a %s ROM with c64u drives load-rom-upload %s <rom>", drive, rom, f.Loader.Name, drive))
+		}
+	}
+	if verbose {
+		for _, n := range notes {
+			formatter.Info("  " + n)
+		}
+	}
+}
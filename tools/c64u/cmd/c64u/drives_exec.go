@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/drivecode"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Drive Code
+// ============================================================================
+
+var drivesExecCmd = &cobra.Command{
+	Use:   "exec <drive> <file> [--addr ADDR] [--exec ADDR] [--no-exec]",
+	Short: "Upload code into a drive's RAM and run it",
+	Long: `Write code into the RAM of an emulated drive with M-W commands and start
+it with M-E, for developing fastloaders and other drive code.
+
+The drives API has no command channel, so the commands are sent by the
+C64: a small program that sends them is uploaded and run like "runners
+run-prg-upload", which replaces the running program. Its table of
+commands is sent in chunks of 32 bytes.
+
+The file is raw code for --addr (hex, default 0500); a .prg is written
+to its load address unless --addr is given. --exec starts it at another
+address than the first byte, --no-exec only writes it. The code must fit
+the drive's RAM ($0000-$07FF, 1581: $0000-$1FFF) and stay clear of the
+command buffer at $0200.
+
+Examples:
+  c64u drives exec 8 loader.bin --addr 0500
+  c64u drives exec 8 drivecode.prg --exec 0503
+  c64u drives exec 9 table.bin --addr 0600 --no-exec`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		drive := args[0]
+		addrFlag, _ := cmd.Flags().GetString("addr")
+		execFlag, _ := cmd.Flags().GetString("exec")
+		noExec, _ := cmd.Flags().GetBool("no-exec")
+
+		code, err := os.ReadFile(args[1])
+		if err != nil {
+			formatter.Error("Cannot read drive code", []string{err.Error()})
+			return
+		}
+		addr := 0x0500
+		if strings.EqualFold(filepath.Ext(args[1]), ".prg") && len(code) >= 2 {
+			addr = int(code[0]) | int(code[1])<<8
+			code = code[2:]
+		}
+		if addrFlag != "" {
+			if addr, err = parseDriveAddress(addrFlag); err != nil {
+				formatter.Error("Invalid address", []string{err.Error()})
+				return
+			}
+		}
+		exec := addr
+		if execFlag != "" {
+			if exec, err = parseDriveAddress(execFlag); err != nil {
+				formatter.Error("Invalid start address", []string{err.Error()})
+				return
+			}
+		}
+		if noExec {
+			exec = -1
+		}
+
+		_, info, err := driveStatus(drive)
+		if err != nil {
+			formatter.Error("Failed to get drive status", []string{err.Error()})
+			return
+		}
+		if enabled, ok := info["enabled"].(bool); ok && !enabled {
+			formatter.Error("Drive is off", []string{"switch it on with: c64u drives on " + drive})
+			return
+		}
+		busID, _ := info["bus_id"].(float64)
+		driveType, _ := info["type"].(string)
+		cmds, err := drivecode.Commands(code, addr, exec, drivecode.RAMSize(driveType))
+		if err != nil {
+			formatter.Error("Cannot write drive code", []string{err.Error()})
+			return
+		}
+
+		tmp, err := os.CreateTemp("", "c64u-drive-exec-*.prg")
+		if err != nil {
+			formatter.Error("Cannot create sender program", []string{err.Error()})
+			return
+		}
+		cleanup := func() { os.Remove(tmp.Name()) }
+		defer cleanup()
+		output.OnExit(func(int) { cleanup() })
+		_, err = tmp.Write(drivecode.SenderPRG(int(busID), cmds))
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			formatter.Error("Cannot create sender program", []string{err.Error()})
+			return
+		}
+
+		resp, err := apiClient.RunPRGUpload(tmp.Name())
+		if err != nil {
+			formatter.Error("Failed to run sender program", []string{err.Error()})
+			return
+		}
+		if resp.HasErrors() {
+			formatter.Error("API returned errors", resp.Errors)
+			return
+		}
+
+		data := map[string]interface{}{
+			"drive":    fmt.Sprintf("%s (device %d, %s)", drive, int(busID), driveType),
+			"code":     fmt.Sprintf("$%04X-$%04X (%s)", addr, addr+len(code)-1, plural(len(code), "byte")),
+			"commands": len(cmds),
+		}
+		if exec >= 0 {
+			data["exec"] = fmt.Sprintf("$%04X", exec)
+		}
+		formatter.Success("Drive code sent", data)
+	},
+}
+
+var drivesReadMemCmd = &cobra.Command{
+	Use:   "read-mem <drive> <address> [--length N] [--output FILE]",
+	Short: "Read a drive's RAM or ROM",
+	Long: `Read memory of an emulated drive with M-R commands, e.g. to inspect
+drive code or dump the DOS ROM.
+
+As for "drives exec", the commands are sent by the C64: a small program
+is uploaded and run like "runners run-prg-upload", which replaces the
+running program. It reads the drive memory in chunks of 32 bytes into
+C64 RAM at $4000, which is then read back via DMA.
+
+The address is hex; up to 8192 bytes are read (default 256). The dump is
+printed like "machine read-mem", or written to --output as raw bytes.
+
+Examples:
+  c64u drives read-mem 8 0500 --length 256
+  c64u drives read-mem 8 c000 --length 8192 --output dos-c000.bin
+  c64u drives read-mem 8 e000 --length 8192 --output dos-e000.bin`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		drive := args[0]
+		length, _ := cmd.Flags().GetInt("length")
+		outFile, _ := cmd.Flags().GetString("output")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		addr, err := parseDriveAddress(args[1])
+		if err != nil {
+			formatter.Error("Invalid address", []string{err.Error()})
+			return
+		}
+		cmds, err := drivecode.ReadCommands(addr, length)
+		if err != nil {
+			formatter.Error("Cannot read drive memory", []string{err.Error()})
+			return
+		}
+
+		_, info, err := driveStatus(drive)
+		if err != nil {
+			formatter.Error("Failed to get drive status", []string{err.Error()})
+			return
+		}
+		if enabled, ok := info["enabled"].(bool); ok && !enabled {
+			formatter.Error("Drive is off", []string{"switch it on with: c64u drives on " + drive})
+			return
+		}
+		busID, _ := info["bus_id"].(float64)
+		driveType, _ := info["type"].(string)
+
+		tmp, err := os.CreateTemp("", "c64u-drive-read-*.prg")
+		if err != nil {
+			formatter.Error("Cannot create reader program", []string{err.Error()})
+			return
+		}
+		cleanup := func() { os.Remove(tmp.Name()) }
+		defer cleanup()
+		output.OnExit(func(int) { cleanup() })
+		_, err = tmp.Write(drivecode.ReaderPRG(int(busID), cmds))
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			formatter.Error("Cannot create reader program", []string{err.Error()})
+			return
+		}
+
+		// A flag left by an earlier run would end the wait at once
+		if err := writeMemory(drivecode.ReadFlag, []byte{0}); err != nil {
+			formatter.Error("Failed to prepare the read", []string{err.Error()})
+			return
+		}
+		resp, err := apiClient.RunPRGUpload(tmp.Name())
+		if err != nil {
+			formatter.Error("Failed to run reader program", []string{err.Error()})
+			return
+		}
+		if resp.HasErrors() {
+			formatter.Error("API returned errors", resp.Errors)
+			return
+		}
+
+		data, err := waitDriveRead(length, timeout)
+		if err != nil {
+			formatter.Error("Drive memory was not read", []string{err.Error(),
+				"the drive may not answer; check it with: c64u drives list"})
+			return
+		}
+
+		if outFile != "" {
+			if err := os.WriteFile(outFile, data, 0644); err != nil {
+				formatter.Error("Failed to write file", []string{err.Error()})
+				return
+			}
+			formatter.Success(fmt.Sprintf("Saved drive memory $%04X-$%04X to %s", addr, addr+length-1, outFile), map[string]interface{}{
+				"drive": fmt.Sprintf("%s (device %d, %s)", drive, int(busID), driveType),
+				"size":  formatter.Size(int64(len(data))),
+			})
+			return
+		}
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{
+				"drive":   drive,
+				"address": fmt.Sprintf("$%04X", addr),
+				"length":  len(data),
+				"data":    fmt.Sprintf("%x", data),
+			})
+			return
+		}
+		formatter.PrintHeader(fmt.Sprintf("Drive %s memory from $%04X: %s", drive, addr, formatter.Size(int64(len(data)))))
+		fmt.Println()
+		fmt.Print(api.FormatMemoryDump(data, addr))
+	},
+}
+
+// driveReadPoll is how often the reader's flag is checked
+const driveReadPoll = 200 * time.Millisecond
+
+// waitDriveRead waits until the reader program has stored the drive
+// memory and returns it
+func waitDriveRead(length int, timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		flag, err := readMemory(drivecode.ReadFlag, 1)
+		if err != nil {
+			return nil, err
+		}
+		if flag[0] == 1 {
+			return readMemory(drivecode.ReadBuffer, length)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("the reader program did not finish within %s", timeout)
+		}
+		time.Sleep(driveReadPoll)
+	}
+}
+
+// parseDriveAddress parses a hex drive address
+func parseDriveAddress(s string) (int, error) {
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "$"), "0x"), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a hex address", s)
+	}
+	return int(addr), nil
+}
+
+func init() {
+	drivesCmd.AddCommand(drivesExecCmd)
+	drivesExecCmd.Flags().String("addr", "", "Drive address to write to in hex (default: 0500 or the PRG load address)")
+	drivesExecCmd.Flags().String("exec", "", "Address to start in hex (default: --addr)")
+	drivesExecCmd.Flags().Bool("no-exec", false, "Only write the code, do not start it")
+
+	drivesCmd.AddCommand(drivesReadMemCmd)
+	drivesReadMemCmd.Flags().Int("length", 256, "Number of bytes to read (at most 8192)")
+	drivesReadMemCmd.Flags().StringP("output", "o", "", "Write the raw bytes to this file")
+	drivesReadMemCmd.Flags().Duration("timeout", 30*time.Second, "Give up if the drive has not answered after this long")
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/lock"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Drive Indicator (for shell prompts and status bars)
+// ============================================================================
+
+var drivesIndicatorCmd = &cobra.Command{
+	Use:   "indicator [--watch] [--interval D]",
+	Short: "One-line drive status for prompts and status bars",
+	Long: `Print a compact one-line summary of the drives and their mounted images,
+for a shell prompt or a tmux/screen status bar:
+
+  8:game.d64* 9:off | busy (pid 4242)
+
+A drive is marked with * while it is active: its image or status changed
+since the previous poll (only seen with --watch; the drives API has no
+activity flag). "busy" means another c64u process is using the device,
+e.g. an upload in progress, so it is not safe to swap disks or power off;
+"idle" means it is.
+
+With --watch, the line is refreshed every --interval (in place on a
+terminal, as a new line when piped). With --json, one JSON object per poll.
+
+Examples:
+  c64u drives indicator
+  c64u drives indicator --watch --interval 1s
+  set -g status-right '#(c64u drives indicator)'   # tmux`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		watch, _ := cmd.Flags().GetBool("watch")
+		interval, _ := cmd.Flags().GetDuration("interval")
+
+		status, err := pollIndicator(nil)
+		if err != nil {
+			formatter.Error("Failed to read drive status", []string{err.Error()})
+			return
+		}
+		if !watch {
+			printIndicator(status, false)
+			return
+		}
+
+		inPlace := !jsonOut && output.IsTerminal(os.Stdout)
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt)
+
+		printIndicator(status, inPlace)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				if inPlace {
+					fmt.Println()
+				}
+				return
+			case <-ticker.C:
+			}
+
+			next, err := pollIndicator(status)
+			if err != nil {
+				// Keep the last line; the device may be rebooting
+				continue
+			}
+			if inPlace || jsonOut || next.line() != status.line() {
+				printIndicator(next, inPlace)
+			}
+			status = next
+		}
+	},
+}
+
+// indicatorDrive is the state of one drive in the indicator
+type indicatorDrive struct {
+	Name    string `json:"name"`
+	BusID   int    `json:"bus_id"`
+	Enabled bool   `json:"enabled"`
+	Image   string `json:"image,omitempty"`
+	Active  bool   `json:"active"`
+
+	// lastError tells status changes apart between polls
+	lastError string
+}
+
+// indicatorStatus is one poll of the indicator
+type indicatorStatus struct {
+	Time   time.Time        `json:"time"`
+	Drives []indicatorDrive `json:"drives"`
+	Busy   bool             `json:"busy"`
+	PID    string           `json:"pid,omitempty"`
+}
+
+// pollIndicator reads the drives and the device lock. Drives whose image
+// or status differ from prev are marked active.
+func pollIndicator(prev *indicatorStatus) (*indicatorStatus, error) {
+	resp, err := apiClient.DrivesList()
+	if err != nil {
+		return nil, err
+	}
+	if resp.HasErrors() {
+		return nil, fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+	}
+
+	status := &indicatorStatus{Time: time.Now()}
+	drives, _ := resp.Data["drives"].([]interface{})
+	for _, driveData := range drives {
+		driveMap, ok := driveData.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, driveInfo := range driveMap {
+			info, ok := driveInfo.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			d := indicatorDrive{Name: name}
+			if id, ok := info["bus_id"].(float64); ok {
+				d.BusID = int(id)
+			}
+			d.Enabled, _ = info["enabled"].(bool)
+			d.Image, _ = info["image_file"].(string)
+			d.lastError, _ = info["last_error"].(string)
+			status.Drives = append(status.Drives, d)
+		}
+	}
+	sort.Slice(status.Drives, func(i, j int) bool { return status.Drives[i].BusID < status.Drives[j].BusID })
+
+	if prev != nil {
+		old := make(map[string]indicatorDrive)
+		for _, d := range prev.Drives {
+			old[d.Name] = d
+		}
+		for i, d := range status.Drives {
+			o, ok := old[d.Name]
+			status.Drives[i].Active = ok && (o.Image != d.Image || o.lastError != d.lastError || o.Enabled != d.Enabled)
+		}
+	}
+
+	if l, ok := apiClient.Locker.(*lock.Lock); ok {
+		status.PID, status.Busy, _ = l.Owner()
+	}
+	return status, nil
+}
+
+// line renders the status as the indicator text
+func (s *indicatorStatus) line() string {
+	parts := make([]string, 0, len(s.Drives)+1)
+	for _, d := range s.Drives {
+		label := "empty"
+		switch {
+		case !d.Enabled:
+			label = "off"
+		case d.Image != "":
+			label = d.Image
+		}
+		if d.Active {
+			label += "*"
+		}
+		parts = append(parts, fmt.Sprintf("%d:%s", d.BusID, label))
+	}
+
+	state := "idle"
+	if s.Busy {
+		state = "busy"
+		if s.PID != "" {
+			state += fmt.Sprintf(" (pid %s)", s.PID)
+		}
+	}
+	return strings.Join(parts, " ") + " | " + state
+}
+
+// printIndicator prints a status, replacing the current terminal line if
+// inPlace is set
+func printIndicator(s *indicatorStatus, inPlace bool) {
+	if jsonOut {
+		data, _ := json.Marshal(s)
+		fmt.Println(string(data))
+		return
+	}
+	if inPlace {
+		fmt.Printf("\r\033[K%s", s.line())
+		return
+	}
+	fmt.Println(s.line())
+}
+
+func init() {
+	drivesIndicatorCmd.Flags().Bool("watch", false, "Keep refreshing the indicator")
+	drivesIndicatorCmd.Flags().Duration("interval", 2*time.Second, "Refresh interval with --watch")
+	drivesCmd.AddCommand(drivesIndicatorCmd)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	pathpkg "path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/basic"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/mounts"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Drive Self-Test
+// ============================================================================
+
+// selftestResults is where the test program stores its results: a done
+// flag, the running test and four bytes per test (DOS error, mismatching
+// bytes, jiffies low and high)
+const selftestResults = 0xC000
+
+// selftestNames are the tests the program runs, in order
+var selftestNames = []string{"format", "write file", "read file", "write block", "read block", "seek 1-35"}
+
+// selftestResult is the outcome of one test
+type selftestResult struct {
+	Test       string  `json:"test"`
+	Result     string  `json:"result"` // "pass", "fail" or "skip"
+	Error      int     `json:"dos_error"`
+	Mismatches int     `json:"mismatches"`
+	Seconds    float64 `json:"seconds"`
+	Note       string  `json:"note,omitempty"`
+}
+
+var drivesSelftestCmd = &cobra.Command{
+	Use:   "selftest <drive> [--timeout D] [--yes]",
+	Short: "Check a drive's emulation with a scripted test battery",
+	Long: `Mount a scratch D64 in a drive and run a BASIC test program on the C64
+that exercises it through the DOS, to validate the drive emulation after
+configuration changes:
+
+  format       N: full format, disk named SELFTEST
+  write file   1024 bytes pattern written to a SEQ file
+  read file    the file read back and compared
+  write block  a pattern written to track 35 sector 0 with U2
+  read block   the sector read back with U1 and compared
+  seek 1-35    five times back and forth between tracks 1 and 35
+
+Each test passes if the DOS reports 00 and all bytes match; its time is
+shown. Afterwards the image is read from the device and its sectors are
+compared with what was written ("image").
+
+The C64 is reset and the program runs instead of whatever was running;
+the previous disk can be put back with "drives undo". Exits with status 1
+if a test fails.
+
+Example:
+  c64u drives selftest 8 --yes`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		drive := args[0]
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		name, info, err := driveStatus(drive)
+		if err != nil {
+			formatter.Error("Failed to get drive status", []string{err.Error()})
+			return
+		}
+		if enabled, ok := info["enabled"].(bool); ok && !enabled {
+			formatter.Error("Drive is off", []string{"switch it on with: c64u drives on " + drive})
+			return
+		}
+		busID, _ := info["bus_id"].(float64)
+		if !confirmCmd(cmd, fmt.Sprintf("Reset the C64 and replace the disk in drive %s with a scratch disk?", name)) {
+			return
+		}
+
+		// Scratch disk
+		tmp, err := os.CreateTemp("", "c64u-selftest-*.d64")
+		if err != nil {
+			formatter.Error("Cannot create scratch disk", []string{err.Error()})
+			return
+		}
+		tmp.Close()
+		removeDisk := func() { os.Remove(tmp.Name()) }
+		defer removeDisk()
+		output.OnExit(func(int) { removeDisk() })
+		if err := diskimage.New(diskimage.D64, []byte("SCRATCH"), []byte("00")).Save(tmp.Name()); err != nil {
+			formatter.Error("Cannot create scratch disk", []string{err.Error()})
+			return
+		}
+		prev, _ := currentMount(drive)
+		resp, err := apiClient.DrivesMountUpload(drive, tmp.Name(), "d64", "readwrite")
+		if err == nil && resp.HasErrors() {
+			err = fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+		}
+		if err != nil {
+			formatter.Error("Failed to mount scratch disk", []string{err.Error()})
+			return
+		}
+		recordMount(drive, &mounts.Mount{Image: tmp.Name(), Uploaded: true, Type: "d64", Mode: "readwrite"}, prev)
+
+		// Test program
+		prg, err := os.CreateTemp("", "c64u-selftest-*.prg")
+		if err != nil {
+			formatter.Error("Cannot create test program", []string{err.Error()})
+			return
+		}
+		removeProgram := func() { os.Remove(prg.Name()) }
+		defer removeProgram()
+		output.OnExit(func(int) { removeProgram() })
+		_, err = prg.Write(selftestProgram(int(busID)))
+		if cerr := prg.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			formatter.Error("Cannot create test program", []string{err.Error()})
+			return
+		}
+		// Results left by an earlier run would end the wait at once
+		if err := writeMemory(selftestResults, make([]byte, 4+4*len(selftestNames)+4)); err != nil {
+			formatter.Error("Failed to clear test results", []string{err.Error()})
+			return
+		}
+		resp, err = apiClient.RunPRGUpload(prg.Name())
+		if err == nil && resp.HasErrors() {
+			err = fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+		}
+		if err != nil {
+			formatter.Error("Failed to run test program", []string{err.Error()})
+			return
+		}
+
+		raw, err := waitSelftest(timeout)
+		if err != nil {
+			formatter.Error("Self-test did not finish", []string{err.Error(),
+				"the drive may not answer; check it with: c64u drives list"})
+			return
+		}
+		results := selftestResultsFrom(raw)
+		results = append(results, checkSelftestImage(drive))
+
+		failed := 0
+		for _, r := range results {
+			if r.Result == "fail" {
+				failed++
+			}
+		}
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{"drive": name, "results": results, "failed": failed})
+		} else {
+			rows := make([][]string, 0, len(results))
+			for _, r := range results {
+				dosErr, mismatches, secs := "", "", ""
+				if r.Test != "image" {
+					dosErr = fmt.Sprintf("%02d", r.Error)
+					mismatches = strconv.Itoa(r.Mismatches)
+					secs = fmt.Sprintf("%.1f", r.Seconds)
+				}
+				rows = append(rows, []string{r.Test, r.Result, dosErr, mismatches, secs, r.Note})
+			}
+			formatter.PrintTable([]string{"test", "result", "dos", "mismatches", "seconds", "note"}, rows)
+			fmt.Println()
+			if failed == 0 {
+				formatter.Success(fmt.Sprintf("Drive %s passed the self-test", name), nil)
+			} else {
+				formatter.Warning(fmt.Sprintf("Drive %s failed %s", name, plural(failed, "test")))
+			}
+			formatter.Info("Put the previous disk back with: c64u drives undo " + drive)
+		}
+		if failed > 0 {
+			output.Exit(1)
+		}
+	},
+}
+
+// selftestProgram builds the BASIC test program for a device
+func selftestProgram(device int) []byte {
+	text := map[int]string{
+		10:  fmt.Sprintf("D=%d:R=%d:FORI=0TO31:POKER+I,0:NEXT:M=0:OPEN15,D,15", device, selftestResults),
+		20:  "K=1:POKER+1,K:T0=TI:PRINT#15,\"N:SELFTEST,ST\":GOSUB900",
+		30:  "K=2:POKER+1,K:T0=TI:OPEN2,D,2,\"PATTERN,S,W\":FORI=0TO1023:PRINT#2,CHR$(IAND255);:NEXT:CLOSE2:GOSUB900",
+		40:  "K=3:POKER+1,K:T0=TI:OPEN2,D,2,\"PATTERN,S,R\"",
+		45:  "FORI=0TO1023:GET#2,A$:IFASC(A$+CHR$(0))<>(IAND255)THENM=M+1",
+		50:  "NEXT:CLOSE2:GOSUB900",
+		60:  "K=4:POKER+1,K:T0=TI:OPEN3,D,3,\"#\":PRINT#15,\"B-P 3 0\":FORI=0TO255:PRINT#3,CHR$(255-I);:NEXT:PRINT#15,\"U2 3 0 35 0\":GOSUB900",
+		70:  "K=5:POKER+1,K:T0=TI:PRINT#15,\"U1 3 0 35 0\":PRINT#15,\"B-P 3 0\"",
+		75:  "FORI=0TO255:GET#3,A$:IFASC(A$+CHR$(0))<>255-ITHENM=M+1",
+		80:  "NEXT:GOSUB900",
+		90:  "K=6:POKER+1,K:T0=TI:FORJ=1TO5:PRINT#15,\"U1 3 0 1 0\":PRINT#15,\"U1 3 0 35 0\":NEXT:GOSUB900",
+		100: "CLOSE3:CLOSE15:POKER,1:END",
+		900: "INPUT#15,E,E$,T,S:T=TI-T0:IFM>255THENM=255",
+		910: "POKER+4*K,E:POKER+4*K+1,M:POKER+4*K+2,T-INT(T/256)*256:POKER+4*K+3,INT(T/256):M=0:RETURN",
+	}
+	numbers := []int{10, 20, 30, 40, 45, 50, 60, 70, 75, 80, 90, 100, 900, 910}
+	lines := make([]basic.Line, 0, len(numbers))
+	for _, n := range numbers {
+		tok, _ := basic.Tokenize(text[n])
+		lines = append(lines, basic.Line{Number: n, Text: tok})
+	}
+	prg := []byte{basicStart & 0xFF, basicStart >> 8}
+	return append(prg, basic.Encode(lines, basicStart)...)
+}
+
+// waitSelftest polls the results until the program has finished
+func waitSelftest(timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	running := 0
+	for {
+		raw, err := readMemory(selftestResults, 4+4*len(selftestNames)+4)
+		if err != nil {
+			return nil, err
+		}
+		if raw[0] == 1 {
+			return raw, nil
+		}
+		if k := int(raw[1]); k != running && k >= 1 && k <= len(selftestNames) {
+			running = k
+			if !jsonOut {
+				formatter.Info(fmt.Sprintf("Test %d of %d: %s", k, len(selftestNames), selftestNames[k-1]))
+			}
+		}
+		if time.Now().After(deadline) {
+			if running > 0 {
+				return nil, fmt.Errorf("no result after %s, test '%s' was running", timeout, selftestNames[running-1])
+			}
+			return nil, fmt.Errorf("no result after %s, the test program did not start", timeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// selftestResultsFrom decodes the results the program stored
+func selftestResultsFrom(raw []byte) []selftestResult {
+	results := make([]selftestResult, 0, len(selftestNames))
+	for i, test := range selftestNames {
+		b := raw[4*(i+1):]
+		r := selftestResult{
+			Test:       test,
+			Result:     "pass",
+			Error:      int(b[0]),
+			Mismatches: int(b[1]),
+			Seconds:    float64(int(b[2])|int(b[3])<<8) / 60,
+		}
+		switch {
+		case r.Error != 0:
+			r.Result = "fail"
+			r.Note = "the DOS reported an error"
+		case r.Mismatches != 0:
+			r.Result = "fail"
+			r.Note = "bytes read differ from those written"
+			if r.Mismatches == 255 {
+				r.Note = "255 or more bytes differ"
+			}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// checkSelftestImage reads the scratch image back from the device and
+// compares it with what the program wrote
+func checkSelftestImage(drive string) selftestResult {
+	r := selftestResult{Test: "image", Result: "fail"}
+	_, info, err := driveStatus(drive)
+	if err != nil {
+		r.Result, r.Note = "skip", "cannot get drive status: "+err.Error()
+		return r
+	}
+	image, _ := info["image_file"].(string)
+	dir, _ := info["image_path"].(string)
+	if image == "" {
+		r.Result, r.Note = "skip", "the drive reports no image"
+		return r
+	}
+	data, err := retrieveDeviceFile(pathpkg.Join(dir, image))
+	if err != nil {
+		r.Result, r.Note = "skip", "cannot read the image: "+err.Error()
+		return r
+	}
+	img, err := diskimage.Parse(data)
+	if err != nil {
+		r.Note = err.Error()
+		return r
+	}
+	if !bytes.Equal(img.Name(), []byte("SELFTEST")) || !bytes.Equal(img.ID(), []byte("ST")) {
+		r.Result, r.Note = "skip", "the device has not written the image back to "+image+" yet"
+		return r
+	}
+
+	pattern := make([]byte, 1024)
+	for i := range pattern {
+		pattern[i] = byte(i)
+	}
+	f, err := img.Find([]byte("PATTERN"))
+	if err != nil {
+		r.Note = "file PATTERN: " + err.Error()
+		return r
+	}
+	if content, err := img.ReadFile(f); err != nil || !bytes.Equal(content, pattern) {
+		r.Note = "file PATTERN does not hold the pattern"
+		return r
+	}
+	sector, err := img.Sector(35, 0)
+	if err != nil {
+		r.Note = err.Error()
+		return r
+	}
+	for i, b := range sector {
+		if b != byte(255-i) {
+			r.Note = fmt.Sprintf("track 35 sector 0 differs at byte %d", i)
+			return r
+		}
+	}
+	r.Result = "pass"
+	return r
+}
+
+func init() {
+	drivesCmd.AddCommand(drivesSelftestCmd)
+	drivesSelftestCmd.Flags().Duration("timeout", 5*time.Minute, "Give up if the tests have not finished after this long")
+	addYesFlag(drivesSelftestCmd)
+}
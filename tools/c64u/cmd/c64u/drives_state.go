@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	pathpkg "path"
+	"path/filepath"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/mounts"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Drive State
+// ============================================================================
+
+// driveStatus looks up a drive by name or bus ID and returns its name and
+// the info the device reports for it
+func driveStatus(drive string) (string, map[string]interface{}, error) {
+	resp, err := apiClient.DrivesList()
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.HasErrors() {
+		return "", nil, fmt.Errorf("%v", resp.Errors)
+	}
+
+	drives, _ := resp.Data["drives"].([]interface{})
+	for _, driveData := range drives {
+		driveMap, ok := driveData.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, driveInfo := range driveMap {
+			info, ok := driveInfo.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			busID, _ := info["bus_id"].(float64)
+			if name == drive || fmt.Sprintf("%d", int(busID)) == drive {
+				return name, info, nil
+			}
+		}
+	}
+	return "", nil, fmt.Errorf("drive %s not found", drive)
+}
+
+// mountStatePath is the location of the recorded mounts
+func mountStatePath() string {
+	return filepath.Join(config.GetConfigDir(), "cache", "mounts.json")
+}
+
+// currentMount returns what is mounted in a drive: the recorded mount if
+// the device still reports its image, otherwise the image the device
+// reports (mode unknown). nil means the drive is empty.
+func currentMount(drive string) (*mounts.Mount, error) {
+	name, info, err := driveStatus(drive)
+	if err != nil {
+		return nil, err
+	}
+	image, _ := info["image_file"].(string)
+	if image == "" {
+		return nil, nil
+	}
+
+	if state, err := mounts.Load(mountStatePath()); err == nil {
+		if m := state.Get(mounts.Key(historyDevice(), name)); m != nil && m.ImageFile == image {
+			return m, nil
+		}
+	}
+	dir, _ := info["image_path"].(string)
+	return &mounts.Mount{Image: pathpkg.Join(dir, image), ImageFile: image}, nil
+}
+
+// recordMount stores what was mounted in a drive (nil after an unmount),
+// so later commands know its mode, and prev, what it held before, for
+// "drives undo". An empty mode is the firmware default, readwrite.
+// Failures only produce a warning.
+func recordMount(drive string, m, prev *mounts.Mount) {
+	err := updateMountState(drive, func(state *mounts.State, key string, info map[string]interface{}) {
+		if m != nil {
+			if m.Mode == "" {
+				m.Mode = "readwrite"
+			}
+			m.ImageFile, _ = info["image_file"].(string)
+			m.Time = time.Now()
+		}
+		state.Set(key, m, prev)
+	})
+	if err != nil {
+		formatter.Warning(fmt.Sprintf("Failed to record mount: %v", err))
+	}
+}
+
+// confirmUnmount asks before removing m from a drive unless it is known
+// to be mounted readonly or unlinked
+func confirmUnmount(cmd *cobra.Command, drive string, m *mounts.Mount) bool {
+	if m == nil {
+		return true
+	}
+	switch m.Mode {
+	case "readonly", "unlinked":
+		return true
+	case "readwrite":
+		return confirmCmd(cmd, fmt.Sprintf("Drive %s has %s mounted read-write. Unmount it?", drive, m.ImageFile))
+	}
+	return confirmCmd(cmd, fmt.Sprintf("Drive %s has %s mounted (possibly read-write). Unmount it?", drive, m.ImageFile))
+}
+
+// updateMountState loads the mount state, resolves the drive and saves
+// the state after update has run
+func updateMountState(drive string, update func(state *mounts.State, key string, info map[string]interface{})) error {
+	name, info, err := driveStatus(drive)
+	if err != nil {
+		return err
+	}
+	state, err := mounts.Load(mountStatePath())
+	if err != nil {
+		return err
+	}
+	update(state, mounts.Key(historyDevice(), name), info)
+	return state.Save()
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/archive"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/fetch"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/mounts"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/safename"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Multi-Disk Sets
+// ============================================================================
+
+var drivesSwapCmd = &cobra.Command{
+	Use:   "swap <drive> [next|prev|<n>] [--list] [--clear]",
+	Short: "Mount the next disk of a multi-disk set",
+	Long: `Swap to another disk of the set that "drives mount-upload" registered
+for the drive when given a .zip with several disk images: the next one
+(default, wrapping around to disk 1), the previous one, or disk n.
+
+The images stay on the device (under remote_cache_dir/swap), so a swap
+is a mount of the next file, with the type and mode of the first; disks
+mounted read-write keep what the game saved to them. --list shows the set
+and which disk is in the drive, --clear forgets it (the files on the
+device are kept).
+
+Examples:
+  c64u drives mount-upload 8 "Last Ninja 2.zip"
+  c64u drives swap 8
+  c64u drives swap 8 3
+  c64u drives swap 8 --list`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		drive := args[0]
+		list, _ := cmd.Flags().GetBool("list")
+		clear, _ := cmd.Flags().GetBool("clear")
+
+		name, _, err := driveStatus(drive)
+		if err != nil {
+			formatter.Error("Failed to read drive status", []string{err.Error()})
+			return
+		}
+		state, err := mounts.Load(mountStatePath())
+		if err != nil {
+			formatter.Error("Failed to load mount state", []string{err.Error()})
+			return
+		}
+		key := mounts.Key(historyDevice(), name)
+		set := state.Swap(key)
+		if set == nil {
+			formatter.Error(fmt.Sprintf("No disk set for drive %s", drive), []string{
+				"Mount a .zip with several disk images: c64u drives mount-upload " + drive + " game.zip",
+			})
+			return
+		}
+
+		if clear {
+			state.SetSwap(key, nil)
+			if err := state.Save(); err != nil {
+				formatter.Error("Failed to save mount state", []string{err.Error()})
+				return
+			}
+			formatter.Success(fmt.Sprintf("Forgot the disk set of drive %s", drive), nil)
+			return
+		}
+		if list {
+			printSwapList(set)
+			return
+		}
+
+		target := (set.Current + 1) % len(set.Images)
+		if len(args) == 2 {
+			switch args[1] {
+			case "next":
+			case "prev":
+				target = (set.Current + len(set.Images) - 1) % len(set.Images)
+			default:
+				n, err := strconv.Atoi(args[1])
+				if err != nil || n < 1 || n > len(set.Images) {
+					formatter.Error("Invalid disk", []string{fmt.Sprintf("give next, prev or a disk number from 1 to %d", len(set.Images))})
+					return
+				}
+				target = n - 1
+			}
+		}
+
+		prev, _ := currentMount(drive)
+		resp, err := apiClient.DrivesMount(drive, set.Images[target], set.Type, set.Mode)
+		if err != nil {
+			formatter.Error("Failed to mount image", []string{err.Error()})
+			return
+		}
+		if resp.HasErrors() {
+			formatter.Error("API returned errors", resp.Errors)
+			return
+		}
+		recordMount(drive, &mounts.Mount{Image: set.Images[target], Type: set.Type, Mode: set.Mode}, prev)
+		set.Current = target
+		if err := updateMountState(drive, func(state *mounts.State, key string, _ map[string]interface{}) {
+			state.SetSwap(key, set)
+		}); err != nil {
+			formatter.Warning(fmt.Sprintf("Failed to record the swap: %v", err))
+		}
+
+		formatter.Success(fmt.Sprintf("Disk %d of %d mounted", target+1, len(set.Images)), map[string]interface{}{
+			"drive": drive,
+			"disk":  target + 1,
+			"image": path.Base(set.Images[target]),
+		})
+	},
+}
+
+// printSwapList shows the disks of a set, marking the one in the drive
+func printSwapList(set *mounts.SwapList) {
+	if jsonOut {
+		formatter.PrintData(set)
+		return
+	}
+	rows := make([][]string, len(set.Images))
+	for i, image := range set.Images {
+		mark := ""
+		if i == set.Current {
+			mark = "mounted"
+		}
+		rows[i] = []string{strconv.Itoa(i + 1), path.Base(image), mark}
+	}
+	formatter.PrintTable([]string{"disk", "image", ""}, rows)
+	formatter.Info(fmt.Sprintf("From %s, on the device in %s", filepath.Base(set.Source), path.Dir(set.Images[0])))
+}
+
+// multiDiskArchive returns the disk images of a local .zip holding more
+// than one, in disk order; nil for any other file, or when --entry picks
+// one of them
+func multiDiskArchive(cmd *cobra.Command, arg string) ([]archive.Entry, bool) {
+	entry, _ := cmd.Flags().GetString("entry")
+	if entry != "" || arg == "-" || fetch.IsURL(arg) || !strings.EqualFold(filepath.Ext(arg), ".zip") {
+		return nil, true
+	}
+	entries, err := archive.List(arg)
+	if err != nil {
+		formatter.Error("Failed to read archive", []string{err.Error()})
+		return nil, false
+	}
+	if disks := archive.Matching(entries, diskExts); len(disks) > 1 {
+		return disks, true
+	}
+	return nil, true
+}
+
+// mountDiskSet uploads the disk images of an archive to a folder on the
+// device, mounts the first and registers all as the drive's swap list
+func mountDiskSet(drive, zipPath string, disks []archive.Entry, imageType, mode string) {
+	dir, err := os.MkdirTemp("", "c64u-disks-*")
+	if err != nil {
+		formatter.Error("Failed to create temporary directory", []string{err.Error()})
+		return
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	defer cleanup()
+	output.OnExit(func(int) { cleanup() })
+
+	// File names that FAT or CBM DOS reject are made safe; disks with the
+	// same name in different folders of the archive are numbered
+	rules := &safename.Rules{}
+	set := strings.TrimSuffix(filepath.Base(zipPath), filepath.Ext(zipPath))
+	remoteDir := path.Join(remoteCacheDir, "swap", rules.Name(set))
+	locals := make([]string, len(disks))
+	remotes := make([]string, len(disks))
+	seen := make(map[string]bool)
+	for i, d := range disks {
+		name := rules.Name(path.Base(d.Name))
+		if seen[strings.ToLower(name)] {
+			name = fmt.Sprintf("%d-%s", i+1, name)
+		}
+		seen[strings.ToLower(name)] = true
+		locals[i] = filepath.Join(dir, name)
+		remotes[i] = path.Join(remoteDir, name)
+		if err := archive.Extract(zipPath, d.Name, locals[i]); err != nil {
+			formatter.Error("Failed to extract archive", []string{err.Error()})
+			return
+		}
+	}
+
+	conn, err := dialFTP()
+	if err != nil {
+		formatter.Error("Failed to connect", []string{err.Error()})
+		return
+	}
+	if err := conn.MkdirAll(remoteDir); err != nil {
+		conn.Close()
+		formatter.Error("Failed to create folder on the device", []string{err.Error()})
+		return
+	}
+	for i := range locals {
+		if verbose {
+			fmt.Printf("→ Uploading %s to %s\n", path.Base(disks[i].Name), remotes[i])
+		}
+		if err := conn.Upload(locals[i], remotes[i]); err != nil {
+			conn.Close()
+			formatter.Error(fmt.Sprintf("Failed to upload disk %d", i+1), []string{err.Error()})
+			return
+		}
+	}
+	conn.Close()
+
+	prev, _ := currentMount(drive)
+	resp, err := apiClient.DrivesMount(drive, remotes[0], imageType, mode)
+	if err != nil {
+		formatter.Error("Failed to mount image", []string{err.Error()})
+		return
+	}
+	if resp.HasErrors() {
+		formatter.Error("API returned errors", resp.Errors)
+		return
+	}
+	recordMount(drive, &mounts.Mount{Image: remotes[0], Type: imageType, Mode: mode}, prev)
+
+	abs, _ := filepath.Abs(zipPath)
+	swaps := &mounts.SwapList{Source: abs, Images: remotes, Type: imageType, Mode: mode}
+	if err := updateMountState(drive, func(state *mounts.State, key string, _ map[string]interface{}) {
+		state.SetSwap(key, swaps)
+	}); err != nil {
+		formatter.Warning(fmt.Sprintf("Failed to record the disk set: %v", err))
+	}
+	recordUpload("mount", drive, zipPath)
+
+	if !jsonOut {
+		printSwapList(swaps)
+	}
+	formatter.Success(fmt.Sprintf("Disk 1 of %d mounted; c64u drives swap %s changes disks", len(remotes), drive), map[string]interface{}{
+		"drive":  drive,
+		"image":  path.Base(remotes[0]),
+		"disks":  len(remotes),
+		"folder": remoteDir,
+	})
+}
+
+func init() {
+	drivesCmd.AddCommand(drivesSwapCmd)
+	drivesSwapCmd.Flags().Bool("list", false, "Show the disks of the set")
+	drivesSwapCmd.Flags().Bool("clear", false, "Forget the disk set")
+}
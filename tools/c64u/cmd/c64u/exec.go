@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/keyboard"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/screen"
+	"github.com/spf13/cobra"
+)
+
+// maxBasicLine is the longest line the BASIC screen editor accepts
+const maxBasicLine = 80
+
+var execCmd = &cobra.Command{
+	Use:   "exec <command> [--dos] [--timeout D]",
+	Short: "Run a BASIC command and capture its output",
+	Long: `Type a command line at the BASIC prompt, wait for the next READY. and
+return the screen output between the command and the prompt.
+
+The machine must be at the READY. prompt. With --dos the argument is sent to
+the drive's command channel instead and the drive status is returned; an
+empty DOS command just reads the status.
+
+Examples:
+  c64u exec "PRINT FRE(0)"
+  c64u exec "LIST 10-100"
+  c64u exec --dos "I"
+  c64u exec --dos "" --drive 9
+  c64u --json exec "PRINT PEEK(53280)"`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dos, _ := cmd.Flags().GetBool("dos")
+		drive, _ := cmd.Flags().GetInt("drive")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		line := args[0]
+		if dos {
+			line = dosCommandLine(line, drive)
+		}
+
+		codes, err := petscii.FromText(line)
+		if err != nil {
+			formatter.Error("Cannot type command", []string{err.Error()})
+			return
+		}
+		if len(codes) > maxBasicLine {
+			formatter.Error("Command too long", []string{fmt.Sprintf("%d characters, BASIC accepts at most %d", len(codes), maxBasicLine)})
+			return
+		}
+
+		if err := keyboard.Type(apiClient, append(codes, petscii.Return), timeout); err != nil {
+			formatter.Error("Failed to type command", []string{err.Error()})
+			return
+		}
+
+		lines, truncated, err := waitForOutput(strings.ToUpper(line), timeout)
+		if err != nil {
+			formatter.Error("Command did not finish", []string{err.Error()})
+			return
+		}
+
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{
+				"command":   args[0],
+				"output":    lines,
+				"truncated": truncated,
+			})
+			return
+		}
+
+		if truncated {
+			formatter.Warning("Output scrolled off the screen; showing the visible part only")
+		}
+		for _, l := range lines {
+			fmt.Println(l)
+		}
+	},
+}
+
+// dosCommandLine builds a BASIC line that sends cmd to the drive's command
+// channel and prints the drive status
+func dosCommandLine(cmd string, drive int) string {
+	open := fmt.Sprintf("OPEN15,%d,15", drive)
+	if cmd != "" {
+		open += fmt.Sprintf(",%q", cmd)
+	}
+	return open + ":INPUT#15,E,E$,T,S:CLOSE15:PRINTE;E$;T;S"
+}
+
+// waitForOutput polls the screen until a READY. prompt follows the echoed
+// command line and returns the lines in between. truncated is set when the
+// command line has scrolled off the screen.
+func waitForOutput(echo string, timeout time.Duration) ([]string, bool, error) {
+	prefix := echo
+	if len(prefix) > screen.Columns {
+		prefix = prefix[:screen.Columns]
+	}
+	echoRows := (len(echo)-1)/screen.Columns + 1
+
+	deadline := time.Now().Add(timeout)
+	for {
+		s, err := screen.Read(apiClient)
+		if err != nil {
+			return nil, false, err
+		}
+		lines := s.Lines()
+
+		echoAt, readyAt := -1, -1
+		for i, l := range lines {
+			if strings.HasPrefix(l, prefix) {
+				echoAt = i
+			}
+			if l == "READY." {
+				readyAt = i
+			}
+		}
+
+		switch {
+		case echoAt >= 0 && readyAt >= echoAt+echoRows:
+			return trimBlankLines(lines[echoAt+echoRows : readyAt]), false, nil
+		case echoAt < 0 && readyAt >= 0 && lastNonBlank(lines) == readyAt:
+			return trimBlankLines(lines[:readyAt]), true, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, false, fmt.Errorf("no READY. prompt after %s (program still running?)", timeout)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// lastNonBlank returns the index of the last non-empty line, or -1
+func lastNonBlank(lines []string) int {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i] != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// trimBlankLines removes trailing empty lines
+func trimBlankLines(lines []string) []string {
+	return lines[:lastNonBlank(lines)+1]
+}
+
+func init() {
+	execCmd.Flags().Bool("dos", false, "Send the argument to the drive command channel")
+	execCmd.Flags().Int("drive", 8, "Drive number for --dos")
+	execCmd.Flags().Duration("timeout", 10*time.Second, "How long to wait for the READY. prompt")
+}
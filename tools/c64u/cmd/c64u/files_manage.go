@@ -0,0 +1,569 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/ftp"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// trashDirName is the directory on each volume that --trash moves files to
+const trashDirName = ".trash"
+
+// trashBatchFormat names the per-run directories inside the trash
+const trashBatchFormat = "20060102-150405"
+
+// trashMovesFile records the moves of "files mv --trash" in its batch so
+// that undo can move the files back before restoring the trashed ones
+const trashMovesFile = ".c64u-moves"
+
+// ============================================================================
+// Removing and Moving Files (via FTP)
+// ============================================================================
+
+var filesRmCmd = &cobra.Command{
+	Use:   "rm <path>... [--trash] [--yes]",
+	Short: "Delete files on the C64 Ultimate",
+	Long: `Delete remote files. Paths may contain wildcards, which are expanded
+with the files info API.
+
+The matching files are listed and must be confirmed before anything is
+deleted; --yes skips the confirmation (required when not on a terminal).
+With --trash, files are moved to /<volume>/.trash/<time>/ instead and can
+be restored with "c64u files undo".
+
+Examples:
+  c64u files rm /Usb0/dev/old.prg
+  c64u files rm "/Usb0/games/*.d64" --trash
+  c64u files rm "/Usb0/tmp/*" --yes`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		trash, _ := cmd.Flags().GetBool("trash")
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		matches, ok := expandRemote(args)
+		if !ok {
+			return
+		}
+
+		conn, err := dialFTP()
+		if err != nil {
+			formatter.Error("Failed to connect", []string{err.Error()})
+			return
+		}
+		defer conn.Close()
+
+		if !checkRemoteFiles(conn, matches) {
+			return
+		}
+
+		verb := "Delete"
+		if trash {
+			verb = "Move to trash"
+		}
+		previewMatches(matches)
+		if !confirm(fmt.Sprintf("%s %s?", verb, plural(len(matches), "file")), yes) {
+			return
+		}
+
+		if trash {
+			batch := time.Now().Format(trashBatchFormat)
+			var moved []string
+			for _, m := range matches {
+				target, err := moveToTrash(conn, m.Path, batch)
+				if err != nil {
+					formatter.Error("Failed to move file to trash", []string{err.Error()})
+					return
+				}
+				moved = append(moved, target)
+			}
+			formatter.Success(fmt.Sprintf("Moved %s to trash", plural(len(moved), "file")), map[string]interface{}{
+				"batch": batch,
+				"undo":  "c64u files undo",
+			})
+			return
+		}
+
+		var deleted []string
+		for _, m := range matches {
+			if err := conn.Delete(m.Path); err != nil {
+				formatter.Error(fmt.Sprintf("Deleted %d of %d files", len(deleted), len(matches)), []string{err.Error()})
+				return
+			}
+			deleted = append(deleted, m.Path)
+		}
+		formatter.Success(fmt.Sprintf("Deleted %s", plural(len(deleted), "file")), nil)
+	},
+}
+
+var filesMvCmd = &cobra.Command{
+	Use:   "mv <path>... <dest> [--trash] [--yes]",
+	Short: "Move or rename files on the C64 Ultimate",
+	Long: `Move remote files. Paths may contain wildcards, which are expanded with
+the files info API.
+
+With several files, or when <dest> ends in "/" or is a directory, the files
+are moved into <dest> (created if missing); otherwise the file is renamed
+to <dest>. Existing files are not overwritten unless --trash is given,
+which moves them to the trash first ("c64u files undo" restores them).
+
+The moves are listed and must be confirmed; --yes skips the confirmation.
+
+Examples:
+  c64u files mv /Usb0/dev/game.prg /Usb0/games/
+  c64u files mv "/Usb0/dev/*.sid" /Usb0/music --yes
+  c64u files mv /Usb0/dev/new.d64 /Usb0/games/game.d64 --trash`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		trash, _ := cmd.Flags().GetBool("trash")
+		yes, _ := cmd.Flags().GetBool("yes")
+		dest := args[len(args)-1]
+
+		matches, ok := expandRemote(args[:len(args)-1])
+		if !ok {
+			return
+		}
+
+		conn, err := dialFTP()
+		if err != nil {
+			formatter.Error("Failed to connect", []string{err.Error()})
+			return
+		}
+		defer conn.Close()
+
+		if !checkRemoteFiles(conn, matches) {
+			return
+		}
+
+		intoDir := len(matches) > 1 || strings.HasSuffix(dest, "/") || conn.IsDir(dest)
+		dest = pathpkg.Clean("/" + dest)
+
+		// Work out the targets and which of them already exist
+		targets := make([]string, len(matches))
+		var existing []string
+		for i, m := range matches {
+			targets[i] = dest
+			if intoDir {
+				targets[i] = pathpkg.Join(dest, pathpkg.Base(m.Path))
+			}
+			if targets[i] == m.Path {
+				formatter.Error("Source and destination are the same", []string{m.Path})
+				return
+			}
+			if remoteExists(conn, targets[i]) {
+				existing = append(existing, targets[i])
+			}
+		}
+		if len(existing) > 0 && !trash {
+			formatter.Error("Destination files exist", append(existing, "use --trash to move them to the trash first"))
+			return
+		}
+
+		w := previewWriter()
+		for i, m := range matches {
+			fmt.Fprintf(w, "  %s → %s\n", m.Path, targets[i])
+		}
+		for _, t := range existing {
+			fmt.Fprintf(w, "  %s → trash\n", t)
+		}
+		if !confirm(fmt.Sprintf("Move %s?", plural(len(matches), "file")), yes) {
+			return
+		}
+
+		if intoDir {
+			if err := conn.MkdirAll(dest); err != nil {
+				formatter.Error("Failed to create directory", []string{err.Error()})
+				return
+			}
+		}
+
+		batch := time.Now().Format(trashBatchFormat)
+		for _, t := range existing {
+			if _, err := moveToTrash(conn, t, batch); err != nil {
+				formatter.Error("Failed to move file to trash", []string{err.Error()})
+				return
+			}
+		}
+		var moves strings.Builder
+		for i, m := range matches {
+			if err := conn.Rename(m.Path, targets[i]); err != nil {
+				formatter.Error(fmt.Sprintf("Moved %d of %d files", i, len(matches)), []string{err.Error()})
+				return
+			}
+			fmt.Fprintf(&moves, "%s\t%s\n", targets[i], m.Path)
+		}
+		if len(existing) > 0 {
+			volume, _ := splitVolume(dest)
+			manifest := pathpkg.Join("/", volume, trashDirName, batch, trashMovesFile)
+			if err := conn.Store(manifest, strings.NewReader(moves.String())); err != nil {
+				formatter.Warning(fmt.Sprintf("Failed to record the moves, undo will only restore the trashed files: %v", err))
+			}
+		}
+
+		data := map[string]interface{}{"destination": dest}
+		if len(existing) > 0 {
+			data["trashed"] = len(existing)
+			data["undo"] = "c64u files undo"
+		}
+		formatter.Success(fmt.Sprintf("Moved %s", plural(len(matches), "file")), data)
+	},
+}
+
+var filesUndoCmd = &cobra.Command{
+	Use:   "undo [--list]",
+	Short: "Restore the files last moved to the trash",
+	Long: `Move the files of the most recent trash batch (from "files rm --trash"
+or "files mv --trash") back to where they were. For "files mv --trash",
+the moved files are first moved back as well. Files whose original path is
+taken again are left in the trash and reported.
+
+With --list, the trash batches are shown instead.
+
+Examples:
+  c64u files undo
+  c64u files undo --list`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		list, _ := cmd.Flags().GetBool("list")
+
+		conn, err := dialFTP()
+		if err != nil {
+			formatter.Error("Failed to connect", []string{err.Error()})
+			return
+		}
+		defer conn.Close()
+
+		batches, err := trashBatches(conn)
+		if err != nil {
+			formatter.Error("Failed to read the trash", []string{err.Error()})
+			return
+		}
+
+		if list {
+			if jsonOut {
+				formatter.PrintData(map[string]interface{}{"batches": batches})
+				return
+			}
+			if len(batches) == 0 {
+				formatter.Info("The trash is empty")
+				return
+			}
+			var rows [][]string
+			for _, b := range batches {
+				rows = append(rows, []string{b.Name, b.Dir})
+			}
+			formatter.PrintTable([]string{"batch", "directory"}, rows)
+			return
+		}
+
+		if len(batches) == 0 {
+			formatter.Info("The trash is empty")
+			return
+		}
+
+		// A batch may span volumes; restore all directories of the newest one
+		latest := batches[len(batches)-1].Name
+		var restored, kept []string
+		for _, b := range batches {
+			if b.Name != latest {
+				continue
+			}
+			r, k, err := restoreTrashBatch(conn, b)
+			restored = append(restored, r...)
+			kept = append(kept, k...)
+			if err != nil {
+				formatter.Error("Failed to restore files", []string{err.Error()})
+				return
+			}
+		}
+
+		if len(kept) > 0 {
+			formatter.Warning(fmt.Sprintf("%s left in the trash, the original path is in use: %s", plural(len(kept), "file"), strings.Join(kept, ", ")))
+		}
+		formatter.Success(fmt.Sprintf("Restored %s", plural(len(restored), "file")), map[string]interface{}{
+			"batch": latest,
+		})
+	},
+}
+
+// remoteMatch is a remote file selected by a path or wildcard
+type remoteMatch struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// trashBatch is one run of --trash on one volume
+type trashBatch struct {
+	Name   string `json:"name"`
+	Volume string `json:"volume"`
+	Dir    string `json:"dir"`
+}
+
+// expandRemote resolves paths with wildcards to the matching files using
+// the files info API; other paths are used as given (size -1)
+func expandRemote(patterns []string) ([]remoteMatch, bool) {
+	var matches []remoteMatch
+	seen := make(map[string]bool)
+	add := func(m remoteMatch) {
+		if !seen[m.Path] {
+			seen[m.Path] = true
+			matches = append(matches, m)
+		}
+	}
+
+	for _, pattern := range patterns {
+		pattern = pathpkg.Clean("/" + pattern)
+		if !strings.ContainsAny(pattern, "*?") {
+			add(remoteMatch{Path: pattern, Size: -1})
+			continue
+		}
+
+		resp, err := apiClient.FilesInfo(pattern)
+		if err != nil {
+			formatter.Error("Failed to expand wildcard", []string{err.Error()})
+			return nil, false
+		}
+		if resp.HasErrors() {
+			formatter.Error(fmt.Sprintf("No files match %s", pattern), resp.Errors)
+			return nil, false
+		}
+
+		files, _ := resp.Data["files"].([]interface{})
+		found := 0
+		for _, f := range files {
+			fileMap, _ := f.(map[string]interface{})
+			for name, info := range fileMap {
+				// The API reports names relative to the pattern's directory
+				p := name
+				if !strings.HasPrefix(p, "/") {
+					p = pathpkg.Join(pathpkg.Dir(pattern), name)
+				}
+				m := remoteMatch{Path: p, Size: -1}
+				if details, ok := info.(map[string]interface{}); ok {
+					if sz, ok := details["size"].(float64); ok {
+						m.Size = int64(sz)
+					}
+				}
+				add(m)
+				found++
+			}
+		}
+		if found == 0 {
+			formatter.Error("No files match", []string{pattern})
+			return nil, false
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Path < matches[j].Path })
+	return matches, true
+}
+
+// checkRemoteFiles reports an error if a path given without wildcards
+// does not exist or is a directory
+func checkRemoteFiles(conn *ftp.Client, matches []remoteMatch) bool {
+	for _, m := range matches {
+		if m.Size >= 0 {
+			continue
+		}
+		if conn.IsDir(m.Path) {
+			formatter.Error("Not a file", []string{fmt.Sprintf("%s is a directory", m.Path)})
+			return false
+		}
+		if !remoteExists(conn, m.Path) {
+			formatter.Error("File not found", []string{m.Path})
+			return false
+		}
+	}
+	return true
+}
+
+// previewWriter returns where previews go: stdout, or stderr in JSON mode
+// so that the JSON output stays parseable
+func previewWriter() io.Writer {
+	if jsonOut {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// previewMatches lists the files an operation will affect
+func previewMatches(matches []remoteMatch) {
+	w := previewWriter()
+	for _, m := range matches {
+		if m.Size < 0 {
+			fmt.Fprintf(w, "  %s\n", m.Path)
+			continue
+		}
+		fmt.Fprintf(w, "  %s  (%s)\n", m.Path, output.HumanSize(m.Size))
+	}
+}
+
+// remoteExists reports whether a remote file or directory exists
+func remoteExists(conn *ftp.Client, p string) bool {
+	if conn.IsDir(p) {
+		return true
+	}
+	// A parent directory that cannot be listed does not exist either
+	entries, _ := conn.List(pathpkg.Dir(p))
+	for _, e := range entries {
+		if e.Name == pathpkg.Base(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitVolume splits "/Usb0/games/x.prg" into "Usb0" and "games/x.prg"
+func splitVolume(p string) (string, string) {
+	volume, rel, _ := strings.Cut(strings.TrimPrefix(pathpkg.Clean("/"+p), "/"), "/")
+	return volume, rel
+}
+
+// moveToTrash moves a remote file to the trash batch of its volume,
+// keeping its path relative to the volume
+func moveToTrash(conn *ftp.Client, p, batch string) (string, error) {
+	volume, rel := splitVolume(p)
+	if rel == "" {
+		return "", fmt.Errorf("cannot move volume %s to the trash", p)
+	}
+
+	target := pathpkg.Join("/", volume, trashDirName, batch, rel)
+	if err := conn.MkdirAll(pathpkg.Dir(target)); err != nil {
+		return "", err
+	}
+	if err := conn.Rename(p, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// trashBatches lists the trash batches of all volumes, oldest first
+func trashBatches(conn *ftp.Client) ([]trashBatch, error) {
+	volumes, err := conn.List("/")
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []trashBatch
+	for _, v := range volumes {
+		if !v.Dir {
+			continue
+		}
+		trashDir := pathpkg.Join(v.Path, trashDirName)
+		if !conn.IsDir(trashDir) {
+			continue
+		}
+		entries, err := conn.List(trashDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Dir {
+				batches = append(batches, trashBatch{Name: e.Name, Volume: v.Name, Dir: e.Path})
+			}
+		}
+	}
+
+	sort.SliceStable(batches, func(i, j int) bool { return batches[i].Name < batches[j].Name })
+	return batches, nil
+}
+
+// restoreTrashBatch reverts the moves recorded in a batch, moves its files
+// back to their original paths and removes the emptied batch directories.
+// It returns the restored files and those kept because their original path
+// is taken.
+func restoreTrashBatch(conn *ftp.Client, b trashBatch) ([]string, []string, error) {
+	var files, dirs []string
+	manifest := ""
+	err := conn.Walk(b.Dir, func(e ftp.Entry) error {
+		switch {
+		case e.Dir:
+			dirs = append(dirs, e.Path)
+		case e.Path == pathpkg.Join(b.Dir, trashMovesFile):
+			manifest = e.Path
+		default:
+			files = append(files, e.Path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var restored, kept []string
+	if manifest != "" {
+		var buf strings.Builder
+		if err := conn.Retrieve(manifest, &buf); err != nil {
+			return nil, nil, err
+		}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			target, source, ok := strings.Cut(line, "\t")
+			if !ok || !remoteExists(conn, target) {
+				continue
+			}
+			if remoteExists(conn, source) {
+				kept = append(kept, source)
+				continue
+			}
+			if err := conn.MkdirAll(pathpkg.Dir(source)); err != nil {
+				return restored, kept, err
+			}
+			if err := conn.Rename(target, source); err != nil {
+				return restored, kept, err
+			}
+			restored = append(restored, source)
+		}
+		if len(kept) == 0 {
+			if err := conn.Delete(manifest); err != nil {
+				return restored, kept, err
+			}
+		}
+	}
+
+	for _, f := range files {
+		original := pathpkg.Join("/", b.Volume, strings.TrimPrefix(f, b.Dir+"/"))
+		if remoteExists(conn, original) {
+			kept = append(kept, original)
+			continue
+		}
+		if err := conn.MkdirAll(pathpkg.Dir(original)); err != nil {
+			return restored, kept, err
+		}
+		if err := conn.Rename(f, original); err != nil {
+			return restored, kept, err
+		}
+		restored = append(restored, original)
+	}
+
+	if len(kept) == 0 {
+		// Walk lists parents before children, so remove in reverse
+		for i := len(dirs) - 1; i >= 0; i-- {
+			if err := conn.RemoveDir(dirs[i]); err != nil {
+				return restored, kept, err
+			}
+		}
+		if err := conn.RemoveDir(b.Dir); err != nil {
+			return restored, kept, err
+		}
+	}
+	return restored, kept, nil
+}
+
+func init() {
+	for _, c := range []*cobra.Command{filesRmCmd, filesMvCmd} {
+		c.Flags().Bool("trash", false, "Move files to the volume's .trash directory instead of deleting or overwriting them")
+	}
+	addYesFlag(filesRmCmd, filesMvCmd)
+	filesUndoCmd.Flags().Bool("list", false, "List the trash batches")
+
+	filesCmd.AddCommand(filesRmCmd)
+	filesCmd.AddCommand(filesMvCmd)
+	filesCmd.AddCommand(filesUndoCmd)
+}
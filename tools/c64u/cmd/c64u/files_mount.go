@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/signal"
+	pathpkg "path"
+	"syscall"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/ftp"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/fuse"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/lock"
+	"github.com/spf13/cobra"
+)
+
+// listingTTL is how long directory listings are reused, so that listing a
+// directory and stating its files does not cost a LIST per file
+const listingTTL = 2 * time.Second
+
+var filesMountCmd = &cobra.Command{
+	Use:   "mount <remote-path> <mountpoint> [--read-only]",
+	Short: "Mount the device filesystem locally via FUSE",
+	Long: `Expose a directory of the C64 Ultimate filesystem as a local FUSE file
+system, so files can be browsed, copied and edited with a file manager or
+any other tool. Runs until unmounted with Ctrl-C (or umount/fusermount -u).
+
+Transfers go over FTP: a file is downloaded when it is opened and uploaded
+when it is closed after changes. The device lock is taken for each upload,
+rename and delete, so other c64u commands can run in between. In
+read-only mode (--read-only or read_only in config.toml) the file system
+is mounted read-only.
+
+Linux only; needs /dev/fuse (and fusermount3 when not run as root).
+
+Examples:
+  c64u files mount /Usb0 ~/c64u
+  c64u fs mount /Usb0/games /mnt/games --read-only`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		remote, mountpoint := pathpkg.Clean("/"+args[0]), args[1]
+
+		conn, err := dialFTP()
+		if err != nil {
+			formatter.Error("Failed to connect", []string{err.Error()})
+			return
+		}
+		if remote != "/" && !conn.IsDir(remote) {
+			conn.Close()
+			formatter.Error("Directory not found", []string{remote})
+			return
+		}
+		fsys := &remoteFS{conn: conn, root: remote, listings: make(map[string]remoteListing)}
+		defer func() { fsys.conn.Close() }()
+
+		opts := fuse.Options{
+			Name:     fmt.Sprintf("%s:%s", host, remote),
+			ReadOnly: readOnly,
+			Errors: func(op, path string, err error) {
+				formatter.Warning(fmt.Sprintf("%s %s: %v", op, path, err))
+			},
+		}
+		if verbose {
+			opts.Debug = func(msg string) { fmt.Fprintln(os.Stderr, msg) }
+		}
+		srv, err := fuse.Mount(mountpoint, fsys, opts)
+		if err != nil {
+			formatter.Error("Failed to mount", []string{err.Error()})
+			return
+		}
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(stop)
+		go func() {
+			for range stop {
+				if err := srv.Unmount(); err != nil {
+					formatter.Warning(err.Error())
+				}
+			}
+		}()
+
+		formatter.Info(fmt.Sprintf("Mounted %s at %s (Ctrl-C to unmount)", remote, srv.Dir()))
+		if err := srv.Serve(); err != nil {
+			formatter.Error("File system failed", []string{err.Error()})
+			return
+		}
+
+		formatter.Success("Device filesystem unmounted", map[string]interface{}{
+			"remote":     remote,
+			"mountpoint": srv.Dir(),
+			"uploaded":   fsys.uploaded,
+			"downloaded": fsys.downloaded,
+		})
+	},
+}
+
+// =============================================================================
+// Device file system
+// =============================================================================
+
+// remoteFS serves a directory of the device over one FTP connection,
+// reconnecting when the device drops it
+type remoteFS struct {
+	conn *ftp.Client
+	root string
+
+	listings   map[string]remoteListing
+	uploaded   int
+	downloaded int
+}
+
+// remoteListing is a cached directory listing
+type remoteListing struct {
+	entries []ftp.Entry
+	time    time.Time
+}
+
+// remote returns the device path of a mount path
+func (r *remoteFS) remote(p string) string {
+	return pathpkg.Join(r.root, p)
+}
+
+// do runs fn on the connection, dialing again and retrying once if the
+// connection was lost (the FTP server closes idle sessions)
+func (r *remoteFS) do(fn func(conn *ftp.Client) error) error {
+	err := fn(r.conn)
+	var netErr net.Error
+	if err == nil || !(errors.Is(err, io.EOF) || errors.As(err, &netErr)) {
+		return err
+	}
+	conn, dialErr := dialFTP()
+	if dialErr != nil {
+		return err
+	}
+	r.conn.Close()
+	r.conn = conn
+	return fn(r.conn)
+}
+
+// locked runs a change on the device while holding the device lock
+func (r *remoteFS) locked(fn func(conn *ftp.Client) error) error {
+	if l, ok := apiClient.Locker.(*lock.Lock); ok {
+		if err := l.Lock(); err != nil {
+			return err
+		}
+		defer l.Release()
+	}
+	// Any change may affect the cached listings
+	r.listings = make(map[string]remoteListing)
+	return r.do(fn)
+}
+
+// list returns the entries of a device directory, cached for listingTTL
+func (r *remoteFS) list(dir string) ([]ftp.Entry, error) {
+	if l, ok := r.listings[dir]; ok && time.Since(l.time) < listingTTL {
+		return l.entries, nil
+	}
+	var entries []ftp.Entry
+	err := r.do(func(conn *ftp.Client) error {
+		var err error
+		entries, err = conn.List(dir)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.listings[dir] = remoteListing{entries: entries, time: time.Now()}
+	return entries, nil
+}
+
+// entry looks up a path in its directory's listing
+func (r *remoteFS) entry(p string) (ftp.Entry, error) {
+	remote := r.remote(p)
+	entries, err := r.list(pathpkg.Dir(remote))
+	if err != nil {
+		return ftp.Entry{}, err
+	}
+	for _, e := range entries {
+		if e.Name == pathpkg.Base(remote) {
+			return e, nil
+		}
+	}
+	return ftp.Entry{}, fs.ErrNotExist
+}
+
+func (r *remoteFS) Stat(p string) (fuse.Attr, error) {
+	if p == "/" {
+		return fuse.Attr{Dir: true}, nil
+	}
+	e, err := r.entry(p)
+	if err != nil {
+		return fuse.Attr{}, err
+	}
+	return fuse.Attr{Dir: e.Dir, Size: e.Size, ModTime: e.Time}, nil
+}
+
+func (r *remoteFS) ReadDir(p string) ([]fuse.DirEntry, error) {
+	entries, err := r.list(r.remote(p))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]fuse.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, fuse.DirEntry{Name: e.Name, Dir: e.Dir})
+	}
+	return out, nil
+}
+
+func (r *remoteFS) ReadFile(p string) ([]byte, error) {
+	if e, err := r.entry(p); err != nil {
+		return nil, err
+	} else if e.Dir {
+		return nil, fuse.ErrIsDir
+	}
+	var buf bytes.Buffer
+	err := r.do(func(conn *ftp.Client) error {
+		buf.Reset()
+		return conn.Retrieve(r.remote(p), &buf)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.downloaded++
+	return buf.Bytes(), nil
+}
+
+func (r *remoteFS) WriteFile(p string, data []byte) error {
+	err := r.locked(func(conn *ftp.Client) error {
+		return conn.Store(r.remote(p), bytes.NewReader(data))
+	})
+	if err != nil {
+		return err
+	}
+	r.uploaded++
+	return nil
+}
+
+func (r *remoteFS) Remove(p string) error {
+	return r.locked(func(conn *ftp.Client) error {
+		return conn.Delete(r.remote(p))
+	})
+}
+
+func (r *remoteFS) Rename(oldPath, newPath string) error {
+	return r.locked(func(conn *ftp.Client) error {
+		return conn.Rename(r.remote(oldPath), r.remote(newPath))
+	})
+}
+
+func (r *remoteFS) Mkdir(p string) error {
+	return r.locked(func(conn *ftp.Client) error {
+		return conn.MkdirAll(r.remote(p))
+	})
+}
+
+func (r *remoteFS) Rmdir(p string) error {
+	entries, err := r.list(r.remote(p))
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fuse.ErrNotEmpty
+	}
+	return r.locked(func(conn *ftp.Client) error {
+		return conn.RemoveDir(r.remote(p))
+	})
+}
+
+// StatFS reports the free space of the volume (when the server supports
+// AVBL); the total size is not available over FTP, so it is shown as the
+// free space
+func (r *remoteFS) StatFS() (fuse.StatFS, error) {
+	const blockSize = 4096
+	free, err := r.conn.Available(r.root)
+	if err != nil {
+		return fuse.StatFS{BlockSize: blockSize}, nil
+	}
+	blocks := uint64(free) / blockSize
+	return fuse.StatFS{BlockSize: blockSize, Blocks: blocks, Free: blocks}, nil
+}
+
+func init() {
+	filesCmd.AddCommand(filesMountCmd)
+}
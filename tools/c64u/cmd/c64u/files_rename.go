@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	pathpkg "path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/safename"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/transfer"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Batch Renaming and Safe File Names
+// ============================================================================
+
+var filesRenameBatchCmd = &cobra.Command{
+	Use:   "rename-batch <path>... [--pattern RE --replace TEXT] [--transliterate] [--dry-run] [--yes]",
+	Short: "Rename many files on the C64 Ultimate by pattern or to safe names",
+	Long: `Rename remote files in place. Paths may contain wildcards, which are
+expanded with the files info API.
+
+--pattern is a regular expression matched against each file name (not
+the directory), and --replace what the match becomes, with $1 or ${name}
+for groups. --transliterate then makes the names safe: umlauts spelled
+out (ä becomes ae), accents removed, and characters CBM DOS or FAT reject
+(" * , / : < = > ? \ |), or that PETSCII lacks, replaced by "_". The
+[filenames] rules in config.toml (replace, max_length) apply too.
+
+Files whose name does not change are skipped. The renames are listed and
+must be confirmed (--yes skips that, --dry-run only lists them); two files
+getting the same name, or a name already taken, stop the renaming before
+anything is renamed.
+
+Examples:
+  c64u files rename-batch "/Usb0/music/*" --transliterate --dry-run
+  c64u files rename-batch "/Usb0/disks/*.d64" --pattern '^(.*)_side(\d)' --replace '$1-$2'`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pattern, _ := cmd.Flags().GetString("pattern")
+		replace, _ := cmd.Flags().GetString("replace")
+		translit, _ := cmd.Flags().GetBool("transliterate")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		if cmd.Flags().Changed("replace") && pattern == "" {
+			formatter.Error("Invalid flags", []string{"--replace requires --pattern"})
+			return
+		}
+		if pattern == "" && !translit {
+			formatter.Error("Nothing to rename", []string{"give --pattern and --replace, --transliterate, or both"})
+			return
+		}
+		var re *regexp.Regexp
+		if pattern != "" {
+			var err error
+			if re, err = regexp.Compile(pattern); err != nil {
+				formatter.Error("Invalid pattern", []string{err.Error()})
+				return
+			}
+		}
+		var rules *safename.Rules
+		if translit {
+			var ok bool
+			if rules, ok = filenameRules(); !ok {
+				return
+			}
+		}
+
+		matches, ok := expandRemote(args)
+		if !ok {
+			return
+		}
+		conn, err := dialFTP()
+		if err != nil {
+			formatter.Error("Failed to connect", []string{err.Error()})
+			return
+		}
+		defer conn.Close()
+		if !checkRemoteFiles(conn, matches) {
+			return
+		}
+
+		// Work out the new names and refuse clashes before renaming anything;
+		// FAT names do not differ by case
+		type rename struct{ from, to string }
+		var renames []rename
+		for _, m := range matches {
+			name := pathpkg.Base(m.Path)
+			if re != nil {
+				name = re.ReplaceAllString(name, replace)
+			}
+			if rules != nil {
+				name = rules.Name(name)
+			}
+			if name == "" || strings.Contains(name, "/") {
+				formatter.Error("Invalid new name", []string{fmt.Sprintf("%s would be renamed to %q", m.Path, name)})
+				return
+			}
+			if to := pathpkg.Join(pathpkg.Dir(m.Path), name); to != m.Path {
+				renames = append(renames, rename{m.Path, to})
+			}
+		}
+		moving := make(map[string]bool, len(renames))
+		for _, r := range renames {
+			moving[strings.ToLower(r.from)] = true
+		}
+		targets := make(map[string]string)
+		var clashes []string
+		for _, r := range renames {
+			key := strings.ToLower(r.to)
+			if other, ok := targets[key]; ok {
+				clashes = append(clashes, fmt.Sprintf("%s and %s would both become %s", other, r.from, r.to))
+				continue
+			}
+			if !moving[key] && remoteExists(conn, r.to) {
+				clashes = append(clashes, fmt.Sprintf("%s would replace the existing %s", r.from, r.to))
+			}
+			targets[key] = r.from
+		}
+		if len(clashes) > 0 {
+			formatter.Error("Names clash", clashes)
+			return
+		}
+		if len(renames) == 0 {
+			formatter.Info(fmt.Sprintf("No names change (%s checked)", plural(len(matches), "file")))
+			return
+		}
+
+		if dryRun && jsonOut {
+			list := make([]map[string]string, len(renames))
+			for i, r := range renames {
+				list[i] = map[string]string{"from": r.from, "to": r.to}
+			}
+			formatter.PrintData(map[string]interface{}{"dry_run": true, "renames": list})
+			return
+		}
+		w := previewWriter()
+		for _, r := range renames {
+			fmt.Fprintf(w, "  %s → %s\n", r.from, pathpkg.Base(r.to))
+		}
+		if dryRun {
+			formatter.Info(fmt.Sprintf("Dry run: %s would be renamed", plural(len(renames), "file")))
+			return
+		}
+		if !confirm(fmt.Sprintf("Rename %s?", plural(len(renames), "file")), yes) {
+			return
+		}
+
+		// A file renamed to the old name of another waits until that one moved
+		for done := 0; len(renames) > 0; {
+			progress := false
+			rest := renames[:0]
+			for _, r := range renames {
+				if key := strings.ToLower(r.to); moving[key] && key != strings.ToLower(r.from) {
+					rest = append(rest, r)
+					continue
+				}
+				if err := conn.Rename(r.from, r.to); err != nil {
+					formatter.Error(fmt.Sprintf("Renamed %d of %d files", done, done+len(renames)), []string{err.Error()})
+					return
+				}
+				delete(moving, strings.ToLower(r.from))
+				done++
+				progress = true
+			}
+			renames = rest
+			if !progress {
+				formatter.Error(fmt.Sprintf("Renamed %d files", done), []string{"the remaining names swap places; rename them in two steps"})
+				return
+			}
+			if len(renames) == 0 {
+				formatter.Success(fmt.Sprintf("Renamed %s", plural(done, "file")), nil)
+			}
+		}
+	},
+}
+
+// filenameRules returns the transliteration rules from config.toml
+func filenameRules() (*safename.Rules, bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		formatter.Error("Failed to load config", []string{err.Error()})
+		return nil, false
+	}
+	rules := &safename.Rules{MaxLength: cfg.Filenames.MaxLength}
+	for _, pair := range cfg.Filenames.Replace {
+		if len(pair) != 2 || pair[0] == "" {
+			formatter.Error("Invalid filenames.replace in config.toml", []string{
+				fmt.Sprintf("%q is not a pair of a string and its replacement", pair),
+			})
+			return nil, false
+		}
+		rules.Replace = append(rules.Replace, [2]string{pair[0], pair[1]})
+	}
+	return rules, true
+}
+
+// imageNameShortener returns the Shortener for names written to a disk
+// image, with --long-names or long_names and unique_suffix from
+// config.toml
+func imageNameShortener(cmd *cobra.Command) (*diskimage.Shortener, bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		formatter.Error("Failed to load config", []string{err.Error()})
+		return nil, false
+	}
+	mode := cfg.Filenames.LongNames
+	if cmd.Flags().Changed("long-names") {
+		mode, _ = cmd.Flags().GetString("long-names")
+	}
+	s, err := diskimage.NewShortener(mode, cfg.Filenames.UniqueSuffix)
+	if err != nil {
+		formatter.Error("Invalid long name handling", []string{err.Error()})
+		return nil, false
+	}
+	return s, true
+}
+
+// addLongNamesFlag adds --long-names to commands that write disk images
+func addLongNamesFlag(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		c.Flags().String("long-names", "", "Names over 16 characters: truncate, squeeze or error (default from config.toml, else truncate)")
+	}
+}
+
+// uploadFilenameRules returns the rules for an upload or sync: with
+// --transliterate, or transliterate in config.toml, unless
+// --transliterate=false; nil means names are kept
+func uploadFilenameRules(cmd *cobra.Command) (*safename.Rules, bool) {
+	on, _ := cmd.Flags().GetBool("transliterate")
+	if !cmd.Flags().Changed("transliterate") {
+		if cfg, err := config.Load(); err == nil {
+			on = cfg.Filenames.Transliterate
+		}
+	}
+	if !on {
+		return nil, true
+	}
+	return filenameRules()
+}
+
+// applyFilenameRules makes the part of each remote path below root safe.
+// Without rules it warns about names the device may reject. Two files
+// ending up with the same name are an error.
+func applyFilenameRules(jobs []transfer.Job, root string, rules *safename.Rules) bool {
+	root = pathpkg.Clean(root)
+	if rules == nil {
+		var unsafe []string
+		for _, job := range jobs {
+			for _, name := range strings.Split(strings.TrimPrefix(job.Remote, root), "/") {
+				if name != "" && safename.Unsafe(name) {
+					unsafe = append(unsafe, job.Remote)
+					break
+				}
+			}
+		}
+		if len(unsafe) > 0 {
+			sort.Strings(unsafe)
+			formatter.Warning(fmt.Sprintf("%s with characters CBM DOS or FAT may reject, e.g. %s; --transliterate makes them safe",
+				plural(len(unsafe), "file name"), unsafe[0]))
+		}
+		return true
+	}
+
+	seen := make(map[string]string, len(jobs))
+	var clashes []string
+	for i, job := range jobs {
+		if rel, ok := strings.CutPrefix(job.Remote, root); ok {
+			jobs[i].Remote = root + rules.Path(rel)
+		}
+		key := strings.ToLower(jobs[i].Remote)
+		if other, ok := seen[key]; ok {
+			clashes = append(clashes, fmt.Sprintf("%s and %s would both be uploaded as %s", other, job.Local, jobs[i].Remote))
+		}
+		seen[key] = job.Local
+	}
+	if len(clashes) > 0 {
+		formatter.Error("Transliterated names clash", append(clashes, "add a filenames.replace rule in config.toml to tell them apart"))
+		return false
+	}
+	return true
+}
+
+func init() {
+	filesCmd.AddCommand(filesRenameBatchCmd)
+	filesRenameBatchCmd.Flags().String("pattern", "", "Regular expression matched against each file name")
+	filesRenameBatchCmd.Flags().String("replace", "", "What the --pattern match becomes ($1, ${name} for groups)")
+	filesRenameBatchCmd.Flags().Bool("transliterate", false, "Make the names safe for CBM DOS and FAT")
+	filesRenameBatchCmd.Flags().Bool("dry-run", false, "List the renames without renaming")
+	addYesFlag(filesRenameBatchCmd)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/ftp"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/transfer"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Two-Way Sync (via FTP)
+// ============================================================================
+
+// runTwoWaySync propagates changes between localDir and remoteDir in both
+// directions, based on the state of the previous two-way sync. Conflicts
+// are left untouched unless prefer is "local" or "remote".
+func runTwoWaySync(cmd *cobra.Command, localDir, remoteDir string, dryRun bool, prefer string) {
+	if prefer != "" && prefer != "local" && prefer != "remote" {
+		formatter.Error("Invalid --prefer", []string{"use local or remote"})
+		return
+	}
+
+	absLocal, err := filepath.Abs(localDir)
+	if err != nil {
+		formatter.Error("Invalid directory", []string{err.Error()})
+		return
+	}
+
+	jobs, err := collectUploadJobs(localDir, remoteDir)
+	if err != nil {
+		formatter.Error("Failed to read directory", []string{err.Error()})
+		return
+	}
+	local := make(map[string]transfer.FileState)
+	for _, job := range jobs {
+		hash, err := transfer.FileHash(job.Local)
+		if err != nil {
+			formatter.Error("Failed to read file", []string{err.Error()})
+			return
+		}
+		local[syncRelPath(remoteDir, job.Remote)] = transfer.FileState{Size: job.Size, Hash: hash}
+	}
+
+	conn, err := dialFTP()
+	if err != nil {
+		formatter.Error("Failed to connect", []string{err.Error()})
+		return
+	}
+	defer conn.Close()
+
+	remote, err := remoteSyncFiles(conn, remoteDir)
+	if err != nil {
+		formatter.Error("Failed to list remote directory", []string{err.Error()})
+		return
+	}
+
+	state, err := transfer.LoadTwoWayState(filepath.Join(config.GetConfigDir(), "cache", "sync-two-way.json"))
+	if err != nil {
+		formatter.Error("Failed to load sync state", []string{err.Error()})
+		return
+	}
+	base := state.Pair(fmt.Sprintf("%s:%d%s %s", host, ftpPort, remoteDir, absLocal))
+
+	localPath := func(rel string) string { return filepath.Join(localDir, filepath.FromSlash(rel)) }
+	remotePath := func(rel string) string { return pathpkg.Join(remoteDir, rel) }
+
+	// Files created or changed on both sides with equal sizes are in sync
+	// if their contents match; that needs a download
+	changes := transfer.PlanTwoWay(base, local, remote)
+	for i, c := range changes {
+		if c.Action != transfer.ActionCompare {
+			continue
+		}
+		same, err := remoteMatchesHash(conn, remotePath(c.Path), local[c.Path].Hash)
+		if err != nil {
+			formatter.Error("Failed to compare files", []string{err.Error()})
+			return
+		}
+		if !same {
+			reason := "changed on both sides"
+			if _, synced := base[c.Path]; !synced {
+				reason = "created on both sides"
+			}
+			changes[i].Action, changes[i].Reason = transfer.ActionConflict, reason
+		}
+	}
+
+	// Resolve conflicts with --prefer, in favor of the preferred side
+	var conflicts []transfer.Change
+	for i, c := range changes {
+		if c.Action != transfer.ActionConflict {
+			continue
+		}
+		_, hasLocal := local[c.Path]
+		_, hasRemote := remote[c.Path]
+		switch {
+		case prefer == "local" && hasLocal:
+			changes[i].Action = transfer.ActionUpload
+		case prefer == "local":
+			changes[i].Action = transfer.ActionDeleteRemote
+		case prefer == "remote" && hasRemote:
+			changes[i].Action = transfer.ActionDownload
+		case prefer == "remote":
+			changes[i].Action = transfer.ActionDeleteLocal
+		default:
+			conflicts = append(conflicts, c)
+			continue
+		}
+		changes[i].Reason = c.Reason + ", keeping the " + prefer + " side"
+	}
+
+	if dryRun {
+		printTwoWayPlan(changes)
+		return
+	}
+
+	// Apply the changes; uploads go through the worker pool
+	var uploads []transfer.Job
+	done := make(map[string]bool)
+	for _, c := range changes {
+		switch c.Action {
+		case transfer.ActionUpload:
+			uploads = append(uploads, transfer.Job{Local: localPath(c.Path), Remote: remotePath(c.Path), Size: local[c.Path].Size})
+		case transfer.ActionDownload:
+			if err := os.MkdirAll(filepath.Dir(localPath(c.Path)), 0755); err != nil {
+				formatter.Error("Failed to create directory", []string{err.Error()})
+				return
+			}
+			if err := conn.Download(remotePath(c.Path), localPath(c.Path)); err != nil {
+				formatter.Error("Download failed", []string{err.Error()})
+				return
+			}
+			done[c.Path] = true
+		case transfer.ActionDeleteLocal:
+			if err := os.Remove(localPath(c.Path)); err != nil && !os.IsNotExist(err) {
+				formatter.Error("Failed to delete file", []string{err.Error()})
+				return
+			}
+			done[c.Path] = true
+		case transfer.ActionDeleteRemote:
+			if err := conn.Delete(remotePath(c.Path)); err != nil {
+				formatter.Error("Failed to delete file", []string{err.Error()})
+				return
+			}
+			done[c.Path] = true
+		case transfer.ActionCompare, transfer.ActionForget:
+			done[c.Path] = true
+		}
+	}
+
+	var failed []string
+	if len(uploads) > 0 {
+		results, ok := runUploads(cmd, uploads)
+		if !ok {
+			return
+		}
+		for _, res := range results {
+			rel := syncRelPath(remoteDir, res.Remote)
+			if res.Err != nil {
+				failed = append(failed, res.Err.Error())
+				continue
+			}
+			done[rel] = true
+		}
+	}
+
+	// Record the new base of every file that is now in sync
+	remote, err = remoteSyncFiles(conn, remoteDir)
+	if err != nil {
+		formatter.Error("Failed to list remote directory", []string{err.Error()})
+		return
+	}
+	for rel := range done {
+		r, hasRemote := remote[rel]
+		hash, err := transfer.FileHash(localPath(rel))
+		if err != nil || !hasRemote {
+			delete(base, rel)
+			continue
+		}
+		base[rel] = transfer.Base{Hash: hash, RemoteSize: r.Size, RemoteTime: r.Time}
+	}
+	if err := state.Save(); err != nil {
+		formatter.Warning(fmt.Sprintf("Failed to save sync state: %v", err))
+	}
+
+	if len(failed) > 0 {
+		formatter.Error(fmt.Sprintf("%d of %d files failed to upload", len(failed), len(uploads)), failed)
+		return
+	}
+	if len(conflicts) > 0 {
+		details := make([]string, 0, len(conflicts)+1)
+		for _, c := range conflicts {
+			details = append(details, fmt.Sprintf("%s: %s", c.Path, c.Reason))
+		}
+		details = append(details, "make both sides identical, or rerun with --prefer local|remote")
+		formatter.Error(fmt.Sprintf("Synced, %s to resolve", plural(len(conflicts), "conflict")), details)
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.Action]++
+	}
+	if len(changes) == 0 {
+		formatter.Success("Already up to date", nil)
+		return
+	}
+	formatter.Success("Two-way sync complete", map[string]interface{}{
+		"uploaded":       counts[transfer.ActionUpload],
+		"downloaded":     counts[transfer.ActionDownload],
+		"deleted_local":  counts[transfer.ActionDeleteLocal],
+		"deleted_remote": counts[transfer.ActionDeleteRemote],
+	})
+}
+
+// remoteSyncFiles lists the non-hidden files below remoteDir by relative
+// path. A missing directory yields an empty map.
+func remoteSyncFiles(conn *ftp.Client, remoteDir string) (map[string]transfer.FileState, error) {
+	files := make(map[string]transfer.FileState)
+	if !conn.IsDir(remoteDir) {
+		return files, nil
+	}
+
+	entries, err := snapshotRemote(conn, remoteDir, true)
+	if err != nil {
+		return nil, err
+	}
+	for p, e := range entries {
+		rel := syncRelPath(remoteDir, p)
+		if strings.HasPrefix(rel, ".") || strings.Contains(rel, "/.") {
+			continue
+		}
+		files[rel] = transfer.FileState{Size: e.Size, Time: e.Time}
+	}
+	return files, nil
+}
+
+// remoteMatchesHash downloads a remote file and compares its hash
+func remoteMatchesHash(conn *ftp.Client, remote, hash string) (bool, error) {
+	tmp, err := os.CreateTemp("", "c64u-sync-*")
+	if err != nil {
+		return false, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := conn.Download(remote, tmp.Name()); err != nil {
+		return false, err
+	}
+	remoteHash, err := transfer.FileHash(tmp.Name())
+	if err != nil {
+		return false, err
+	}
+	return remoteHash == hash, nil
+}
+
+// syncRelPath returns a remote path relative to the sync directory
+func syncRelPath(remoteDir, remote string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(remote, remoteDir), "/")
+}
+
+// printTwoWayPlan shows what a two-way sync would do
+func printTwoWayPlan(changes []transfer.Change) {
+	if jsonOut {
+		formatter.PrintData(map[string]interface{}{
+			"dry_run": true,
+			"changes": changes,
+		})
+		return
+	}
+
+	planned, conflicts := 0, 0
+	for _, c := range changes {
+		switch c.Action {
+		case transfer.ActionCompare, transfer.ActionForget:
+			continue
+		case transfer.ActionConflict:
+			conflicts++
+		default:
+			planned++
+		}
+		fmt.Printf("  %-13s %s (%s)\n", c.Action, c.Path, c.Reason)
+	}
+	formatter.Info(fmt.Sprintf("Dry run: %s, %s", plural(planned, "change"), plural(conflicts, "conflict")))
+}
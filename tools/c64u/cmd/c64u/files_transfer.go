@@ -0,0 +1,414 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/ftp"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/transfer"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// File Transfers (via FTP)
+// ============================================================================
+
+var filesUploadCmd = &cobra.Command{
+	Use:   "upload <local>... <remote>",
+	Short: "Upload files to the C64 Ultimate via FTP",
+	Long: `Upload local files or directories to the C64 Ultimate filesystem via FTP.
+
+Directories are uploaded recursively into the remote directory. With a
+single local file, <remote> may also be the target file name.
+
+Files are transferred over several parallel FTP connections (--workers),
+and failed files are retried (--retries).
+
+Names with characters that CBM DOS or FAT reject, or that PETSCII lacks,
+are reported; --transliterate (or transliterate in the [filenames] table
+of config.toml) uploads them under safe names instead, see
+"c64u files rename-batch --help". A target file name given explicitly is
+kept.
+
+Examples:
+  c64u files upload game.prg /Usb0/games/
+  c64u files upload game.prg /Usb0/games/mygame.prg
+  c64u files upload sids/ demos/ /Usb0/collections --workers 4
+  c64u files upload "Mörk Musik/" /Usb0/music --transliterate`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		sources := args[:len(args)-1]
+		remote := args[len(args)-1]
+
+		conn, err := dialFTP()
+		if err != nil {
+			formatter.Error("Failed to connect", []string{err.Error()})
+			return
+		}
+		remoteIsDir := strings.HasSuffix(remote, "/") || conn.IsDir(remote)
+		conn.Close()
+
+		var jobs []transfer.Job
+		for _, src := range sources {
+			info, err := os.Stat(src)
+			if err != nil {
+				formatter.Error("File not found", []string{src})
+				return
+			}
+
+			if !info.IsDir() {
+				target := remote
+				if remoteIsDir || len(sources) > 1 {
+					target = pathpkg.Join(remote, filepath.Base(src))
+				}
+				jobs = append(jobs, transfer.Job{Local: src, Remote: target, Size: info.Size()})
+				continue
+			}
+
+			dirJobs, err := collectUploadJobs(src, pathpkg.Join(remote, filepath.Base(filepath.Clean(src))))
+			if err != nil {
+				formatter.Error("Failed to read directory", []string{err.Error()})
+				return
+			}
+			jobs = append(jobs, dirJobs...)
+		}
+
+		if remoteIsDir || len(sources) > 1 || len(jobs) != 1 || jobs[0].Remote != remote {
+			rules, ok := uploadFilenameRules(cmd)
+			if !ok || !applyFilenameRules(jobs, remote, rules) {
+				return
+			}
+		}
+
+		results, ok := runUploads(cmd, jobs)
+		if !ok {
+			return
+		}
+		printTransferSummary("Uploaded", results, 0)
+	},
+}
+
+var filesSyncCmd = &cobra.Command{
+	Use:   "sync <local-dir> <remote-dir>",
+	Short: "Sync a local directory to the C64 Ultimate via FTP",
+	Long: `Upload new and changed files from a local directory to a remote directory.
+
+A file is uploaded if it is missing on the device, its size differs, or its
+contents changed since the last sync (hashes are kept in
+~/.config/c64u/cache/sync.json). Hidden files are skipped. Nothing is
+deleted on the device.
+
+With --two-way, changes are propagated in both directions: files new or
+changed on one side are copied to the other and deletions are repeated,
+based on the state of the previous two-way sync (kept in
+~/.config/c64u/cache/sync-two-way.json). Files changed on both sides, or
+changed on one and deleted on the other, are conflicts: they are left
+alone and reported (exit code 1) until resolved by hand or with
+--prefer local|remote. Remote changes are detected by size and
+modification time, as reported by the FTP server.
+
+--transliterate uploads files under safe names as "files upload" does. A
+two-way sync needs the same names on both sides and keeps them.
+
+Examples:
+  c64u files sync ./HVSC /Usb0/HVSC --workers 4
+  c64u files sync build/ /Usb0/dev --dry-run
+  c64u files sync disks/ /Usb0/disks --two-way
+  c64u files sync disks/ /Usb0/disks --two-way --prefer remote`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		localDir := args[0]
+		remoteDir := pathpkg.Clean("/" + args[1])
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		force, _ := cmd.Flags().GetBool("force")
+		twoWay, _ := cmd.Flags().GetBool("two-way")
+		prefer, _ := cmd.Flags().GetString("prefer")
+
+		if info, err := os.Stat(localDir); err != nil || !info.IsDir() {
+			formatter.Error("Not a directory", []string{localDir})
+			return
+		}
+
+		if twoWay {
+			if on, _ := cmd.Flags().GetBool("transliterate"); on {
+				formatter.Error("Invalid flags", []string{"--transliterate cannot be combined with --two-way, which needs the same names on both sides"})
+				return
+			}
+			if force {
+				formatter.Error("Invalid flags", []string{"--force cannot be combined with --two-way; use --prefer"})
+				return
+			}
+			runTwoWaySync(cmd, localDir, remoteDir, dryRun, prefer)
+			return
+		}
+		if prefer != "" {
+			formatter.Error("Invalid flags", []string{"--prefer requires --two-way"})
+			return
+		}
+
+		jobs, err := collectUploadJobs(localDir, remoteDir)
+		if err != nil {
+			formatter.Error("Failed to read directory", []string{err.Error()})
+			return
+		}
+		rules, ok := uploadFilenameRules(cmd)
+		if !ok || !applyFilenameRules(jobs, remoteDir, rules) {
+			return
+		}
+
+		remoteSizes, err := remoteFileSizes(remoteDir)
+		if err != nil {
+			formatter.Error("Failed to list remote directory", []string{err.Error()})
+			return
+		}
+
+		state, err := transfer.LoadState(filepath.Join(config.GetConfigDir(), "cache", "sync.json"))
+		if err != nil {
+			formatter.Error("Failed to load sync state", []string{err.Error()})
+			return
+		}
+		device := fmt.Sprintf("%s:%d", host, ftpPort)
+
+		// Select the files that need to be uploaded
+		var pending []transfer.Job
+		hashes := make(map[string]string)
+		for _, job := range jobs {
+			hash, err := transfer.FileHash(job.Local)
+			if err != nil {
+				formatter.Error("Failed to read file", []string{err.Error()})
+				return
+			}
+			hashes[job.Remote] = hash
+
+			size, exists := remoteSizes[job.Remote]
+			if force || !exists || size != job.Size || state.Hash(device, job.Remote) != hash {
+				pending = append(pending, job)
+			}
+		}
+		unchanged := len(jobs) - len(pending)
+
+		if dryRun {
+			if jsonOut {
+				var files []string
+				for _, job := range pending {
+					files = append(files, job.Remote)
+				}
+				formatter.PrintData(map[string]interface{}{
+					"dry_run":   true,
+					"upload":    files,
+					"unchanged": unchanged,
+				})
+				return
+			}
+			for _, job := range pending {
+				fmt.Printf("  upload %s (%s)\n", job.Remote, formatter.Size(job.Size))
+			}
+			formatter.Info(fmt.Sprintf("Dry run: %d files would be uploaded, %d unchanged", len(pending), unchanged))
+			return
+		}
+
+		results, ok := runUploads(cmd, pending)
+		if !ok {
+			return
+		}
+
+		for _, res := range results {
+			if res.Err == nil {
+				state.SetHash(device, res.Remote, hashes[res.Remote])
+			}
+		}
+		if err := state.Save(); err != nil {
+			formatter.Warning(fmt.Sprintf("Failed to save sync state: %v", err))
+		}
+
+		printTransferSummary("Synced", results, unchanged)
+	},
+}
+
+// dialFTP connects to the device's FTP server
+func dialFTP() (*ftp.Client, error) {
+	conn, err := ftp.Dial(host, ftpPort, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.Verbose = verbose
+	conn.ReadOnly = readOnly
+	return conn, nil
+}
+
+// collectUploadJobs maps every regular, non-hidden file below localDir to
+// the same relative path below remoteDir
+func collectUploadJobs(localDir, remoteDir string) ([]transfer.Job, error) {
+	var jobs []transfer.Job
+	err := filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != localDir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, transfer.Job{
+			Local:  p,
+			Remote: pathpkg.Join(remoteDir, filepath.ToSlash(rel)),
+			Size:   info.Size(),
+		})
+		return nil
+	})
+	return jobs, err
+}
+
+// remoteFileSizes returns the sizes of all files below a remote directory.
+// A missing directory yields an empty map.
+func remoteFileSizes(remoteDir string) (map[string]int64, error) {
+	conn, err := dialFTP()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	sizes := make(map[string]int64)
+	if !conn.IsDir(remoteDir) {
+		return sizes, nil
+	}
+
+	err = conn.Walk(remoteDir, func(e ftp.Entry) error {
+		if !e.Dir {
+			sizes[e.Path] = e.Size
+		}
+		return nil
+	})
+	return sizes, err
+}
+
+// runUploads uploads jobs with the worker pool configured by the command's
+// flags, showing aggregate progress on a terminal
+func runUploads(cmd *cobra.Command, jobs []transfer.Job) ([]transfer.Result, bool) {
+	workers, _ := cmd.Flags().GetInt("workers")
+	retries, _ := cmd.Flags().GetInt("retries")
+
+	if apiClient.Locker != nil {
+		if err := apiClient.Locker.Lock(); err != nil {
+			formatter.Error("Failed to acquire device lock", []string{err.Error()})
+			return nil, false
+		}
+	}
+
+	pool := &transfer.Pool{
+		Workers:    workers,
+		Retries:    retries,
+		RetryDelay: 500 * time.Millisecond,
+		Connect: func() (transfer.Uploader, error) {
+			return dialFTP()
+		},
+	}
+
+	showProgress := !jsonOut && !verbose && output.IsTerminal(os.Stderr)
+	if showProgress {
+		pool.OnProgress = func(p transfer.Progress) {
+			line := fmt.Sprintf("[%d/%d] %s / %s", p.Done+p.Failed, p.Total,
+				output.HumanSize(p.Bytes), output.HumanSize(p.TotalBytes))
+			if p.Failed > 0 {
+				line += fmt.Sprintf(", %d failed", p.Failed)
+			}
+			fmt.Fprintf(os.Stderr, "\r\033[K%s  %s", line, truncate(p.Current, 40))
+		}
+	}
+
+	results, err := pool.Run(jobs)
+	if showProgress && len(jobs) > 0 {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	if err != nil {
+		formatter.Error("Upload failed", []string{err.Error()})
+		return nil, false
+	}
+	return results, true
+}
+
+// printTransferSummary reports uploaded and failed files. Failures exit 1.
+func printTransferSummary(verb string, results []transfer.Result, unchanged int) {
+	var uploaded []string
+	var failed []string
+	var bytes int64
+	for _, res := range results {
+		if res.Err != nil {
+			failed = append(failed, fmt.Sprintf("%v (after %s)", res.Err, plural(res.Attempts, "attempt")))
+			continue
+		}
+		uploaded = append(uploaded, res.Remote)
+		bytes += res.Size
+	}
+
+	if len(failed) > 0 {
+		formatter.Error(fmt.Sprintf("%d of %d files failed to upload", len(failed), len(results)), failed)
+		return
+	}
+
+	if jsonOut {
+		formatter.PrintData(map[string]interface{}{
+			"uploaded":  uploaded,
+			"bytes":     bytes,
+			"unchanged": unchanged,
+		})
+		return
+	}
+
+	if len(results) == 0 {
+		formatter.Success("Already up to date", map[string]interface{}{"unchanged": unchanged})
+		return
+	}
+
+	data := map[string]interface{}{
+		"files": len(uploaded),
+		"size":  formatter.Size(bytes),
+	}
+	if unchanged > 0 {
+		data["unchanged"] = unchanged
+	}
+	formatter.Success(fmt.Sprintf("%s %s", verb, plural(len(uploaded), "file")), data)
+}
+
+// plural formats a count with a singular or plural noun, e.g. "1 file"
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func init() {
+	filesCmd.AddCommand(filesUploadCmd)
+	filesCmd.AddCommand(filesSyncCmd)
+
+	for _, cmd := range []*cobra.Command{filesUploadCmd, filesSyncCmd} {
+		cmd.Flags().Int("workers", 3, "Number of parallel FTP connections")
+		cmd.Flags().Int("retries", 2, "Number of retries per file")
+		cmd.Flags().Bool("transliterate", false, "Upload files with unsafe names under safe ones (default: filenames.transliterate)")
+	}
+	filesSyncCmd.Flags().Bool("dry-run", false, "Show what would be uploaded without uploading")
+	filesSyncCmd.Flags().Bool("force", false, "Upload all files, even if unchanged")
+	filesSyncCmd.Flags().Bool("two-way", false, "Propagate changes in both directions and report conflicts")
+	filesSyncCmd.Flags().String("prefer", "", "Resolve two-way conflicts in favor of local or remote")
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	pathpkg "path"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/ftp"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Storage Overview (via FTP)
+// ============================================================================
+
+var filesTreeCmd = &cobra.Command{
+	Use:   "tree <path> [--depth N]",
+	Short: "Show a directory tree of the Ultimate's storage",
+	Long: `List a remote directory recursively as a tree, with file sizes and
+per-directory totals.
+
+The whole tree below <path> is read to compute the totals; --depth only
+limits how deep it is printed.
+
+Examples:
+  c64u files tree /Usb0/games
+  c64u files tree /Usb0 --depth 1
+  c64u --json files tree /Usb0/HVSC`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		depth, _ := cmd.Flags().GetInt("depth")
+
+		root, ok := scanRemoteTree(args[0])
+		if !ok {
+			return
+		}
+
+		if jsonOut {
+			formatter.PrintData(root)
+			return
+		}
+
+		fmt.Printf("%s  (%s)\n", root.Path, formatter.Size(root.Size))
+		printTree(root, "", 1, depth)
+		fmt.Println()
+		fmt.Printf("%d directories, %s, %s\n", root.Dirs, plural(root.Files, "file"), formatter.Size(root.Size))
+	},
+}
+
+var filesDuCmd = &cobra.Command{
+	Use:   "du <path> [--depth N]",
+	Short: "Show disk usage per directory",
+	Long: `Show the total size and file count of a remote directory and each
+directory below it, like du(1).
+
+Examples:
+  c64u files du /Usb0
+  c64u files du /Usb0 --depth 1
+  c64u --json files du /SD`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		depth, _ := cmd.Flags().GetInt("depth")
+
+		root, ok := scanRemoteTree(args[0])
+		if !ok {
+			return
+		}
+
+		var dirs []*remoteNode
+		var collect func(n *remoteNode, level int)
+		collect = func(n *remoteNode, level int) {
+			dirs = append(dirs, n)
+			if depth >= 0 && level >= depth {
+				return
+			}
+			for _, c := range n.Children {
+				if c.Dir {
+					collect(c, level+1)
+				}
+			}
+		}
+		collect(root, 0)
+
+		if jsonOut {
+			entries := make([]map[string]interface{}, len(dirs))
+			for i, d := range dirs {
+				entries[i] = map[string]interface{}{
+					"path":  d.Path,
+					"size":  d.Size,
+					"files": d.Files,
+				}
+			}
+			formatter.PrintData(map[string]interface{}{"directories": entries})
+			return
+		}
+
+		rows := make([][]string, len(dirs))
+		for i, d := range dirs {
+			rows[i] = []string{formatter.Size(d.Size), fmt.Sprintf("%d", d.Files), d.Path}
+		}
+		formatter.PrintTable([]string{"size", "files", "path"}, rows)
+	},
+}
+
+var filesDfCmd = &cobra.Command{
+	Use:   "df",
+	Short: "Show free space of the mounted volumes",
+	Long: `Show the free space of each volume (USB sticks, SD card, ...) mounted on
+the Ultimate. Volumes are the top-level directories of the FTP server.
+
+Free space is queried with the FTP AVBL command and shown as "unknown" if
+the firmware does not support it; use "files du" for the space in use.
+
+Examples:
+  c64u files df
+  c64u --json files df`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, err := dialFTP()
+		if err != nil {
+			formatter.Error("Failed to connect", []string{err.Error()})
+			return
+		}
+		defer conn.Close()
+
+		entries, err := conn.List("/")
+		if err != nil {
+			formatter.Error("Failed to list volumes", []string{err.Error()})
+			return
+		}
+
+		var volumes []map[string]interface{}
+		var rows [][]string
+		unknown := 0
+		for _, e := range entries {
+			if !e.Dir {
+				continue
+			}
+			vol := map[string]interface{}{"name": e.Name, "path": e.Path, "free": nil}
+			free := "unknown"
+
+			n, err := conn.Available(e.Path)
+			switch {
+			case err == nil:
+				vol["free"] = n
+				free = formatter.Size(n)
+			case errors.Is(err, ftp.ErrUnsupported):
+				unknown++
+			default:
+				formatter.Error("Failed to query free space", []string{err.Error()})
+				return
+			}
+			volumes = append(volumes, vol)
+			rows = append(rows, []string{e.Name, free})
+		}
+
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{"volumes": volumes})
+			return
+		}
+
+		if len(rows) == 0 {
+			formatter.Info("No volumes mounted")
+			return
+		}
+		formatter.PrintTable([]string{"volume", "free"}, rows)
+		if unknown > 0 {
+			formatter.Warning("The device's FTP server does not report free space (AVBL)")
+		}
+	},
+}
+
+// remoteNode is a file or directory in a remote tree. For directories,
+// Size, Files and Dirs are totals over everything below it.
+type remoteNode struct {
+	Name     string        `json:"name"`
+	Path     string        `json:"path"`
+	Dir      bool          `json:"dir"`
+	Size     int64         `json:"size"`
+	Files    int           `json:"files,omitempty"`
+	Dirs     int           `json:"dirs,omitempty"`
+	Children []*remoteNode `json:"children,omitempty"`
+}
+
+// scanRemoteTree reads the remote directory tree below dir
+func scanRemoteTree(dir string) (*remoteNode, bool) {
+	conn, err := dialFTP()
+	if err != nil {
+		formatter.Error("Failed to connect", []string{err.Error()})
+		return nil, false
+	}
+	defer conn.Close()
+
+	dir = pathpkg.Clean("/" + dir)
+	if !conn.IsDir(dir) {
+		formatter.Error("Not a directory", []string{dir})
+		return nil, false
+	}
+
+	root := &remoteNode{Name: pathpkg.Base(dir), Path: dir, Dir: true}
+	if err := scanRemoteDir(conn, root); err != nil {
+		formatter.Error("Failed to read directory", []string{err.Error()})
+		return nil, false
+	}
+	return root, true
+}
+
+// scanRemoteDir fills in the children and totals of a directory node
+func scanRemoteDir(conn *ftp.Client, node *remoteNode) error {
+	entries, err := conn.List(node.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		child := &remoteNode{Name: e.Name, Path: e.Path, Dir: e.Dir, Size: e.Size}
+		if e.Dir {
+			child.Size = 0
+			if err := scanRemoteDir(conn, child); err != nil {
+				return err
+			}
+			node.Dirs += child.Dirs + 1
+		} else {
+			node.Files++
+		}
+		node.Files += child.Files
+		node.Size += child.Size
+		node.Children = append(node.Children, child)
+	}
+	return nil
+}
+
+// printTree prints the children of a node with box-drawing branches,
+// down to maxDepth levels (negative for no limit)
+func printTree(node *remoteNode, prefix string, level, maxDepth int) {
+	for i, c := range node.Children {
+		branch, indent := "├── ", "│   "
+		if i == len(node.Children)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		if c.Dir {
+			fmt.Printf("%s%s%s/  (%s, %s)\n", prefix, branch, c.Name, plural(c.Files, "file"), formatter.Size(c.Size))
+			if maxDepth < 0 || level < maxDepth {
+				printTree(c, prefix+indent, level+1, maxDepth)
+			}
+			continue
+		}
+		fmt.Printf("%s%s%s  %s\n", prefix, branch, c.Name, formatter.Size(c.Size))
+	}
+}
+
+func init() {
+	filesTreeCmd.Flags().Int("depth", -1, "Maximum depth to print (-1 for no limit)")
+	filesDuCmd.Flags().Int("depth", -1, "Maximum depth of directories to list (-1 for no limit)")
+
+	filesCmd.AddCommand(filesTreeCmd)
+	filesCmd.AddCommand(filesDuCmd)
+	filesCmd.AddCommand(filesDfCmd)
+}
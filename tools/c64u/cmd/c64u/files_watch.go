@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	pathpkg "path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/ftp"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Watching Remote Directories (via FTP)
+// ============================================================================
+
+var filesWatchCmd = &cobra.Command{
+	Use:   "watch <path> [--interval D] [--recursive] [--exec CMD]",
+	Short: "Report changes in a remote directory",
+	Long: `Poll a remote directory and report files that are added, removed or
+changed (size or modification time), e.g. save games or SEQ files written
+by the running program. Stop with Ctrl-C.
+
+With --json, each change is printed as one JSON object per line:
+  {"time":"...","event":"added","path":"/Usb0/save.seq","size":254}
+
+With --exec, a command is run through the shell for every change, with the
+environment variables C64U_EVENT (added, removed, changed), C64U_PATH and
+C64U_SIZE set.
+
+Examples:
+  c64u files watch /Usb0/saves
+  c64u files watch /Usb0/dev --recursive --interval 1s
+  c64u files watch /Usb0/saves --exec 'notify-send "$C64U_EVENT $C64U_PATH"'
+  c64u --json files watch /Usb0/out | jq -r .path`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		interval, _ := cmd.Flags().GetDuration("interval")
+		recursive, _ := cmd.Flags().GetBool("recursive")
+		command, _ := cmd.Flags().GetString("exec")
+		dir := pathpkg.Clean("/" + args[0])
+
+		conn, err := dialFTP()
+		if err != nil {
+			formatter.Error("Failed to connect", []string{err.Error()})
+			return
+		}
+		defer conn.Close()
+
+		if !conn.IsDir(dir) {
+			formatter.Error("Not a directory", []string{dir})
+			return
+		}
+
+		previous, err := snapshotRemote(conn, dir, recursive)
+		if err != nil {
+			formatter.Error("Failed to list directory", []string{err.Error()})
+			return
+		}
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt)
+		if !jsonOut {
+			formatter.Info(fmt.Sprintf("Watching %s (%s, Ctrl-C to stop)", dir, plural(len(previous), "file")))
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			current, err := snapshotRemote(conn, dir, recursive)
+			if err != nil {
+				formatter.Warning(err.Error())
+				continue
+			}
+
+			for _, ev := range diffSnapshots(previous, current) {
+				printWatchEvent(ev)
+				if command != "" {
+					runWatchCommand(command, ev)
+				}
+			}
+			previous = current
+		}
+	},
+}
+
+// watchEvent is a change seen by files watch
+type watchEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	Path  string    `json:"path"`
+	Size  int64     `json:"size"`
+}
+
+// snapshotRemote lists the files in dir (and below it with recursive),
+// keyed by path
+func snapshotRemote(conn *ftp.Client, dir string, recursive bool) (map[string]ftp.Entry, error) {
+	files := make(map[string]ftp.Entry)
+	if recursive {
+		err := conn.Walk(dir, func(e ftp.Entry) error {
+			if !e.Dir {
+				files[e.Path] = e
+			}
+			return nil
+		})
+		return files, err
+	}
+
+	entries, err := conn.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.Dir {
+			files[e.Path] = e
+		}
+	}
+	return files, nil
+}
+
+// diffSnapshots returns the changes between two snapshots, sorted by path
+func diffSnapshots(previous, current map[string]ftp.Entry) []watchEvent {
+	now := time.Now()
+	var events []watchEvent
+	for p, e := range current {
+		old, ok := previous[p]
+		switch {
+		case !ok:
+			events = append(events, watchEvent{Time: now, Event: "added", Path: p, Size: e.Size})
+		case old.Size != e.Size || !old.Time.Equal(e.Time):
+			events = append(events, watchEvent{Time: now, Event: "changed", Path: p, Size: e.Size})
+		}
+	}
+	for p, e := range previous {
+		if _, ok := current[p]; !ok {
+			events = append(events, watchEvent{Time: now, Event: "removed", Path: p, Size: e.Size})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
+
+// printWatchEvent prints an event as a text line or a JSON line
+func printWatchEvent(ev watchEvent) {
+	if jsonOut {
+		line, _ := json.Marshal(ev)
+		fmt.Println(string(line))
+		return
+	}
+
+	marks := map[string]string{"added": "+", "removed": "-", "changed": "~"}
+	if ev.Event == "removed" {
+		fmt.Printf("%s %s %s\n", ev.Time.Format("15:04:05"), marks[ev.Event], ev.Path)
+		return
+	}
+	fmt.Printf("%s %s %s  (%s)\n", ev.Time.Format("15:04:05"), marks[ev.Event], ev.Path, output.HumanSize(ev.Size))
+}
+
+// runWatchCommand runs the --exec command for an event through the shell
+func runWatchCommand(command string, ev watchEvent) {
+	c := shellCommand(command)
+	c.Env = append(os.Environ(),
+		"C64U_EVENT="+ev.Event,
+		"C64U_PATH="+ev.Path,
+		"C64U_SIZE="+strconv.FormatInt(ev.Size, 10),
+	)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		formatter.Warning(fmt.Sprintf("--exec failed for %s: %v", ev.Path, err))
+	}
+}
+
+func init() {
+	filesWatchCmd.Flags().Duration("interval", 2*time.Second, "Polling interval")
+	filesWatchCmd.Flags().BoolP("recursive", "r", false, "Also watch subdirectories")
+	filesWatchCmd.Flags().String("exec", "", "Shell command to run for every change")
+
+	filesCmd.AddCommand(filesWatchCmd)
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/g64"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+// g64Cmd represents the g64 command group
+var g64Cmd = &cobra.Command{
+	Use:   "g64",
+	Short: "Analyze and convert local G64 (GCR) disk images",
+	Long: `Inspect G64 images, which hold the raw GCR data of each track of a 1541
+disk as read from an original (e.g. with a nibbler via the Ultimate), and
+convert between G64 and D64 keeping the read errors of each sector.`,
+}
+
+var g64AnalyzeCmd = &cobra.Command{
+	Use:   "analyze <image.g64> [--all]",
+	Short: "Report protection-relevant anomalies per track",
+	Long: `Decode every track of a G64 image as the 1541 would and report what is
+unusual about it: read errors per sector (as DOS error numbers, e.g. 23 for
+a data checksum error), densities other than the standard zone, long
+tracks, long or missing syncs, killer tracks, half tracks with data, extra
+or duplicate sectors and non-standard block markers.
+
+Only tracks with anomalies are listed unless --all is given; --json
+includes the sync lengths and sector errors of every track.
+
+Examples:
+  c64u g64 analyze original.g64
+  c64u g64 analyze original.g64 --all
+  c64u --json g64 analyze original.g64`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+
+		img, err := g64.Open(args[0])
+		if err != nil {
+			formatter.Error("Cannot open G64 image", []string{err.Error()})
+			return
+		}
+		disk := g64.Analyze(img)
+
+		errors, flagged := 0, 0
+		var rows [][]string
+		for _, t := range disk.Tracks {
+			errors += len(t.Errors())
+			if len(t.Anomalies) > 0 || len(t.Errors()) > 0 {
+				flagged++
+			} else if !all {
+				continue
+			}
+			rows = append(rows, []string{
+				strconv.FormatFloat(t.Track, 'f', -1, 64),
+				speedName(t.Speed),
+				strconv.Itoa(t.Bytes),
+				syncSummary(t.Syncs),
+				sectorSummary(t),
+				strings.Join(t.Anomalies, "; "),
+			})
+		}
+
+		summary := map[string]interface{}{
+			"image":         args[0],
+			"disk_id":       petscii.ToText(disk.ID[:]),
+			"tracks":        len(disk.Tracks),
+			"sector_errors": errors,
+			"flagged":       flagged,
+		}
+		if jsonOut {
+			summary["track_info"] = disk.Tracks
+			formatter.PrintData(summary)
+			return
+		}
+		if len(rows) > 0 {
+			formatter.PrintTable([]string{"track", "zone", "bytes", "syncs", "errors", "anomalies"}, rows)
+		}
+		msg := fmt.Sprintf("%s: no anomalies", filepath.Base(args[0]))
+		if flagged > 0 {
+			msg = fmt.Sprintf("%s: %s with anomalies, %s", filepath.Base(args[0]),
+				plural(flagged, "track"), plural(errors, "sector error"))
+		}
+		formatter.Success(msg, map[string]interface{}{
+			"disk_id": petscii.ToText(disk.ID[:]),
+			"tracks":  len(disk.Tracks),
+		})
+	},
+}
+
+var g64TrackCmd = &cobra.Command{
+	Use:   "track <image.g64> <track> [--raw]",
+	Short: "Show the syncs and blocks of one track",
+	Long: `List the sync marks and the blocks after them on one track of a G64
+image: their bit position, sync length, header fields (track, sector, ID,
+checksum) and data block checksums. Half tracks are given as 18.5.
+
+--raw adds a hex dump of the track's raw GCR bytes.
+
+Examples:
+  c64u g64 track original.g64 18
+  c64u g64 track original.g64 36.5 --raw`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		raw, _ := cmd.Flags().GetBool("raw")
+
+		number, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || number*2 != float64(int(number*2)) {
+			formatter.Error("Invalid track", []string{fmt.Sprintf("'%s' is not a track such as 18 or 18.5", args[1])})
+			return
+		}
+		img, err := g64.Open(args[0])
+		if err != nil {
+			formatter.Error("Cannot open G64 image", []string{err.Error()})
+			return
+		}
+		disk := g64.Analyze(img)
+
+		var info *g64.TrackInfo
+		for i := range disk.Tracks {
+			if disk.Tracks[i].Half == int(number*2) && !disk.Tracks[i].Missing {
+				info = &disk.Tracks[i]
+			}
+		}
+		var data []byte
+		for _, t := range img.Tracks {
+			if t.Half == int(number*2) {
+				data = t.Data
+			}
+		}
+		if info == nil {
+			formatter.Error("Track not found", []string{fmt.Sprintf("%s has no data for track %s", args[0], args[1])})
+			return
+		}
+
+		rows := make([][]string, 0, len(info.Blocks))
+		for _, b := range info.Blocks {
+			rows = append(rows, []string{
+				strconv.Itoa(b.Pos),
+				strconv.Itoa(b.SyncBits),
+				blockKind(b),
+				blockDetails(b, disk.ID),
+			})
+		}
+
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{
+				"track":  info,
+				"blocks": info.Blocks,
+				"raw":    hex.EncodeToString(data),
+			})
+			return
+		}
+		formatter.PrintHeader(fmt.Sprintf("Track %s: %d bytes, zone %s (standard %d)",
+			args[1], info.Bytes, speedName(info.Speed), info.StandardSpeed))
+		if len(rows) > 0 {
+			formatter.PrintTable([]string{"bit", "sync", "block", "details"}, rows)
+		}
+		for _, a := range info.Anomalies {
+			formatter.Warning(a)
+		}
+		for _, s := range info.Errors() {
+			formatter.Warning(fmt.Sprintf("sector %d: %s", s.Sector, s.Error))
+		}
+		if raw {
+			fmt.Print(hex.Dump(data))
+		}
+	},
+}
+
+var g64ConvertCmd = &cobra.Command{
+	Use:   "convert <source> <destination> [--no-error-info] [--yes]",
+	Short: "Convert between G64 and D64 keeping read errors",
+	Long: `Convert a G64 image to D64 or a D64 image to G64; the direction follows
+the file extensions.
+
+G64 to D64 decodes every sector as the 1541 would. Sectors that cannot be
+read are recorded in the D64's error info bytes (one per sector, as
+emulators and the Ultimate use them), unless --no-error-info is given. The
+D64 gets 40 tracks if tracks 36-40 can be read. GCR-level details such as
+densities, sync lengths and half tracks cannot be kept in a D64; see
+"g64 analyze" for what is lost.
+
+D64 to G64 writes the tracks as the DOS formats them, with the error of
+each sector reproduced (a missing header or data block, a bad checksum, a
+different disk ID or no sync), so that protection checks for read errors
+still work. Errors that only occur when writing are listed and dropped.
+
+Examples:
+  c64u g64 convert original.g64 game.d64
+  c64u g64 convert original.g64 clean.d64 --no-error-info
+  c64u g64 convert game.d64 game.g64`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		noErrors, _ := cmd.Flags().GetBool("no-error-info")
+		src, dst := args[0], args[1]
+		srcExt, dstExt := strings.ToLower(filepath.Ext(src)), strings.ToLower(filepath.Ext(dst))
+
+		if _, err := os.Stat(dst); err == nil {
+			if !confirmCmd(cmd, fmt.Sprintf("Replace %s?", dst)) {
+				return
+			}
+		}
+
+		switch {
+		case srcExt == ".g64" && dstExt == ".d64":
+			img, err := g64.Open(src)
+			if err != nil {
+				formatter.Error("Cannot open G64 image", []string{err.Error()})
+				return
+			}
+			disk := g64.Analyze(img)
+			d64, err := g64.ToD64(disk, !noErrors)
+			if err != nil {
+				formatter.Error("Failed to build D64 image", []string{err.Error()})
+				return
+			}
+			errors := 0
+			for _, t := range disk.Tracks {
+				if t.Half <= 2*d64.Tracks {
+					errors += len(t.Errors())
+				}
+			}
+			if err := d64.Save(dst); err != nil {
+				formatter.Error("Failed to write disk image", []string{err.Error()})
+				return
+			}
+			_, hasInfo := d64.ErrorByte(18, 0)
+			formatter.Success(fmt.Sprintf("Converted %s to %s", filepath.Base(src), dst), map[string]interface{}{
+				"tracks":        d64.Tracks,
+				"sector_errors": errors,
+				"error_info":    hasInfo,
+			})
+
+		case srcExt == ".d64" && dstExt == ".g64":
+			d64, err := diskimage.Open(src)
+			if err != nil {
+				formatter.Error("Cannot open disk image", []string{err.Error()})
+				return
+			}
+			img, dropped, err := g64.FromD64(d64)
+			if err != nil {
+				formatter.Error("Failed to encode G64 image", []string{err.Error()})
+				return
+			}
+			if err := img.Save(dst); err != nil {
+				formatter.Error("Failed to write G64 image", []string{err.Error()})
+				return
+			}
+			for _, d := range dropped {
+				formatter.Warning("Error not reproduced: " + d)
+			}
+			errors := 0
+			for _, t := range g64.Analyze(img).Tracks {
+				errors += len(t.Errors())
+			}
+			formatter.Success(fmt.Sprintf("Converted %s to %s", filepath.Base(src), dst), map[string]interface{}{
+				"tracks":        d64.Tracks,
+				"sector_errors": errors,
+			})
+
+		default:
+			formatter.Error("Unsupported conversion", []string{
+				fmt.Sprintf("cannot convert %s to %s", srcExt, dstExt),
+				"convert .g64 to .d64 or .d64 to .g64",
+			})
+		}
+	},
+}
+
+// speedName returns a density zone for display
+func speedName(speed int) string {
+	if speed < 0 {
+		return "var"
+	}
+	return strconv.Itoa(speed)
+}
+
+// syncSummary returns the number of syncs and their length range
+func syncSummary(syncs []int) string {
+	if len(syncs) == 0 {
+		return "0"
+	}
+	lo, hi := syncs[0], syncs[0]
+	for _, s := range syncs {
+		lo, hi = min(lo, s), max(hi, s)
+	}
+	if lo == hi {
+		return fmt.Sprintf("%d × %d", len(syncs), lo)
+	}
+	return fmt.Sprintf("%d × %d-%d", len(syncs), lo, hi)
+}
+
+// sectorSummary lists the sectors of a track with read errors as
+// "sector:DOS error"
+func sectorSummary(t g64.TrackInfo) string {
+	errs := t.Errors()
+	if len(errs) == len(t.Sectors) && len(errs) > 0 && allSame(errs) {
+		return "all:" + strings.Fields(errs[0].Error.String())[0]
+	}
+	parts := make([]string, 0, len(errs))
+	for _, s := range errs {
+		parts = append(parts, fmt.Sprintf("%d:%s", s.Sector, strings.Fields(s.Error.String())[0]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// allSame reports whether all sectors have the same error
+func allSame(sectors []g64.Sector) bool {
+	for _, s := range sectors {
+		if s.Error != sectors[0].Error {
+			return false
+		}
+	}
+	return true
+}
+
+// blockKind names a block by its marker
+func blockKind(b g64.Block) string {
+	switch {
+	case b.IsHeader():
+		return "header"
+	case b.IsData():
+		return "data"
+	}
+	return fmt.Sprintf("$%02X", b.Marker)
+}
+
+// blockDetails describes the decoded fields of a block
+func blockDetails(b g64.Block, id [2]byte) string {
+	var parts []string
+	switch {
+	case b.IsHeader():
+		parts = append(parts, fmt.Sprintf("%d/%d id %s", b.Track, b.Sector, petscii.ToText(b.ID[:])))
+		if b.ID != id {
+			parts = append(parts, "id mismatch")
+		}
+	case b.IsData():
+		parts = append(parts, fmt.Sprintf("link %d/%d", b.Data[0], b.Data[1]))
+	}
+	if (b.IsHeader() || b.IsData()) && !b.ChecksumOK {
+		parts = append(parts, "bad checksum")
+	}
+	if b.BadGCR > 0 {
+		parts = append(parts, fmt.Sprintf("%d invalid GCR", b.BadGCR))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func init() {
+	g64Cmd.AddCommand(g64AnalyzeCmd)
+	g64Cmd.AddCommand(g64TrackCmd)
+	g64Cmd.AddCommand(g64ConvertCmd)
+	g64AnalyzeCmd.Flags().Bool("all", false, "List all tracks, not only those with anomalies")
+	g64TrackCmd.Flags().Bool("raw", false, "Also dump the raw GCR bytes")
+	g64ConvertCmd.Flags().Bool("no-error-info", false, "Write a D64 without error info bytes")
+	g64ConvertCmd.Flags().BoolP("yes", "y", false, "Replace an existing destination without asking")
+}
@@ -0,0 +1,662 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/gameprofile"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/keyboard"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/mounts"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/screen"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Game Launch Profiles
+// ============================================================================
+
+var gameCmd = &cobra.Command{
+	Use:   "game",
+	Short: "Launch titles with the settings they need",
+	Long: `Launch a title from a profile that lists what it needs: drive mode,
+REU, SID model, joystick port, disk images and the program. "game stop"
+puts the settings and drives back as they were before the launch.
+
+Profiles are TOML files in the games folder of the config directory
+(~/.config/c64u/games/elite.toml is "elite"):
+
+  description = "Elite (Firebird, 1985)"
+  drive_mode = "1541"           # drive 8: 1541, 1571 or 1581
+  reu = "off"                   # or a size: 512K, 16M
+  sid = "6581"                  # UltiSID model: 6581 or 8580
+  joystick = 1                  # port the game reads; 1 swaps the ports
+
+  [[mount]]
+  drive = "a"
+  image = "elite.d64"           # local (uploaded) or a device path
+  mode = "readwrite"            # readwrite, readonly, unlinked
+  # drive_mode = "1571"         # mode of this drive
+
+  [settings."U64 Specific Settings"]
+  "CPU Speed" = " 1"            # any other device setting
+
+run = "elite.prg" starts a PRG or CRT instead of loading from disk; without
+it the machine is reset and LOAD"*",8,1 (or load = "name") and RUN are
+typed, with 8 being the bus ID of the first mounted drive. Relative paths
+are relative to the profile.`,
+}
+
+var gameLaunchCmd = &cobra.Command{
+	Use:   "launch <name|profile.toml> [--no-run] [--timeout D]",
+	Short: "Apply a profile's settings and mounts and start the title",
+	Long: `Change the device settings a profile needs, set the drive modes,
+mount its images and start it. What was there before is recorded first,
+so "c64u game stop" can restore it even if the launch fails halfway.
+Settings that already have the wanted value are left alone.
+
+The settings change until the next power cycle; nothing is saved to
+flash. --no-run prepares the machine without starting the title.
+
+Examples:
+  c64u game launch elite
+  c64u game launch ./profiles/turrican.toml
+  c64u game launch mayhem --no-run`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		noRun, _ := cmd.Flags().GetBool("no-run")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		p, err := gameprofile.Load(gameprofile.Dir(config.GetConfigDir()), args[0])
+		if err != nil {
+			formatter.Error("Cannot load the profile", []string{err.Error()})
+			return
+		}
+		if s, _ := loadGameSession(); s != nil {
+			formatter.Error(fmt.Sprintf("%s is running", s.Profile), []string{
+				"c64u game stop restores its settings first",
+			})
+			return
+		}
+
+		changes, err := profileChanges(p)
+		if err != nil {
+			formatter.Error("Cannot apply the profile", []string{err.Error()})
+			return
+		}
+		session := &gameSession{
+			Profile: p.Name,
+			Path:    p.Path,
+			Started: time.Now(),
+			Config:  map[string]map[string]interface{}{},
+			Modes:   map[string]string{},
+		}
+		values := map[string]map[string]interface{}{}
+		for _, c := range changes {
+			if values[c.item.Category] == nil {
+				values[c.item.Category] = map[string]interface{}{}
+				session.Config[c.item.Category] = map[string]interface{}{}
+			}
+			values[c.item.Category][c.item.Name] = c.value
+			session.Config[c.item.Category][c.item.Name] = c.item.Value
+		}
+
+		modes, err := profileDriveModes(p, session)
+		if err != nil {
+			formatter.Error("Failed to read drive status", []string{err.Error()})
+			return
+		}
+		for _, m := range p.Mounts {
+			d, err := gameDriveState(m.Drive)
+			if err != nil {
+				formatter.Error("Failed to read drive status", []string{err.Error()})
+				return
+			}
+			session.Drives = append(session.Drives, d)
+		}
+		if err := session.save(); err != nil {
+			formatter.Error("Failed to record the previous settings", []string{err.Error()})
+			return
+		}
+
+		hint := "c64u game stop restores the previous settings"
+		if len(values) > 0 {
+			if err := apiStep(func() (*api.Response, error) { return apiClient.ConfigSetMany(values) }); err != nil {
+				formatter.Error("Failed to change settings", []string{err.Error(), hint})
+				return
+			}
+		}
+		for _, drive := range sortedKeys(modes) {
+			if err := apiStep(func() (*api.Response, error) { return apiClient.DrivesSetMode(drive, modes[drive]) }); err != nil {
+				formatter.Error(fmt.Sprintf("Failed to set drive %s to %s", drive, modes[drive]), []string{err.Error(), hint})
+				return
+			}
+		}
+		for _, m := range p.Mounts {
+			if err := mountGameImage(m); err != nil {
+				formatter.Error(fmt.Sprintf("Failed to mount %s", m.Image), []string{err.Error(), hint})
+				return
+			}
+		}
+
+		started := ""
+		if !noRun {
+			if started, err = startGame(p, timeout); err != nil {
+				formatter.Error(fmt.Sprintf("Failed to start %s", p.Name), []string{err.Error(), hint})
+				return
+			}
+		}
+
+		if !jsonOut && len(changes) > 0 {
+			rows := make([][]string, len(changes))
+			for i, c := range changes {
+				rows[i] = []string{c.item.Category, c.item.Name, fmt.Sprintf("%v", c.item.Value), c.value}
+			}
+			formatter.PrintTable([]string{"category", "setting", "was", "now"}, rows)
+		}
+		data := map[string]interface{}{
+			"profile":  p.Name,
+			"settings": len(changes),
+			"mounts":   len(p.Mounts),
+		}
+		if len(modes) > 0 {
+			data["drive_modes"] = modes
+		}
+		if started != "" {
+			data["started"] = started
+		}
+		msg := fmt.Sprintf("Launched %s", p.Name)
+		if noRun {
+			msg = fmt.Sprintf("Prepared the machine for %s", p.Name)
+		}
+		formatter.Success(msg, data)
+	},
+}
+
+var gameStopCmd = &cobra.Command{
+	Use:   "stop [--no-reset] [--forget]",
+	Short: "Restore the settings and drives from before the launch",
+	Long: `Undo "game launch": put back the changed device settings and drive
+modes, remount the images the drives had (or empty them) and reset the
+machine (--no-reset leaves the title running).
+
+Problems with single settings or drives do not stop the others; they are
+listed, the record is kept so that stop can be retried, and the command
+exits 1. --forget drops the record without restoring anything.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		noReset, _ := cmd.Flags().GetBool("no-reset")
+		forget, _ := cmd.Flags().GetBool("forget")
+
+		s, err := loadGameSession()
+		if err != nil {
+			formatter.Error("Failed to read the launch record", []string{err.Error()})
+			return
+		}
+		if s == nil {
+			formatter.Error("No game launched", []string{"c64u game launch <name> starts one"})
+			return
+		}
+		if forget {
+			if err := removeGameSession(); err != nil {
+				formatter.Error("Failed to remove the launch record", []string{err.Error()})
+				return
+			}
+			formatter.Success(fmt.Sprintf("Forgot the launch of %s; the settings were not restored", s.Profile), nil)
+			return
+		}
+
+		var problems []string
+		settings := 0
+		if len(s.Config) > 0 {
+			if err := apiStep(func() (*api.Response, error) { return apiClient.ConfigSetMany(s.Config) }); err != nil {
+				problems = append(problems, "settings: "+err.Error())
+			} else {
+				for _, items := range s.Config {
+					settings += len(items)
+				}
+			}
+		}
+		for _, drive := range sortedKeys(s.Modes) {
+			if err := apiStep(func() (*api.Response, error) { return apiClient.DrivesSetMode(drive, s.Modes[drive]) }); err != nil {
+				problems = append(problems, fmt.Sprintf("drive %s mode: %v", drive, err))
+			}
+		}
+		for _, d := range s.Drives {
+			if err := stateMount(d, nil, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("drive %s: %v", d.Drive, err))
+			}
+		}
+		if !noReset {
+			if err := apiStep(apiClient.MachineReset); err != nil {
+				problems = append(problems, "reset: "+err.Error())
+			} else {
+				clearRunning()
+			}
+		}
+
+		if len(problems) > 0 {
+			formatter.Error(fmt.Sprintf("Restored %s with problems", s.Profile), append(problems,
+				"c64u game stop tries again; --forget drops the record"))
+			return
+		}
+		if err := removeGameSession(); err != nil {
+			formatter.Warning(fmt.Sprintf("Failed to remove the launch record: %v", err))
+		}
+		formatter.Success(fmt.Sprintf("Stopped %s and restored the previous settings", s.Profile), map[string]interface{}{
+			"settings": settings,
+			"drives":   len(s.Drives),
+		})
+	},
+}
+
+var gameListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the game profiles",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := gameprofile.Dir(config.GetConfigDir())
+		profiles, err := gameprofile.List(dir)
+		if err != nil {
+			formatter.Error("Failed to read the profiles", []string{err.Error()})
+			return
+		}
+		running := ""
+		if s, _ := loadGameSession(); s != nil {
+			running = s.Profile
+		}
+
+		if jsonOut {
+			list := make([]map[string]interface{}, len(profiles))
+			for i, p := range profiles {
+				list[i] = map[string]interface{}{
+					"name":        p.Name,
+					"description": p.Description,
+					"path":        p.Path,
+					"launched":    p.Name == running,
+				}
+			}
+			formatter.PrintData(map[string]interface{}{"directory": dir, "profiles": list})
+			return
+		}
+		if len(profiles) == 0 {
+			formatter.Info("No profiles in " + dir)
+			return
+		}
+		rows := make([][]string, len(profiles))
+		for i, p := range profiles {
+			starts := filepath.Base(p.Run)
+			if p.Run == "" {
+				starts = fmt.Sprintf(`LOAD"%s" from %s`, p.Load, filepath.Base(p.Mounts[0].Image))
+			}
+			mark := ""
+			if p.Name == running {
+				mark = "launched"
+			}
+			rows[i] = []string{p.Name, p.Description, starts, mark}
+		}
+		formatter.PrintTable([]string{"name", "description", "starts", ""}, rows)
+	},
+}
+
+// settingChange is a device setting a profile needs changed
+type settingChange struct {
+	item  api.ConfigItem
+	value string
+}
+
+// profileChanges returns the device settings a profile needs that do not
+// have the wanted value yet
+func profileChanges(p *gameprofile.Profile) ([]settingChange, error) {
+	var wanted []settingChange
+	want := func(pattern, key string, match func(string) bool) error {
+		item, err := gameSetting(pattern, key)
+		if err != nil {
+			return err
+		}
+		value, err := settingOption(item, key, match)
+		if err != nil {
+			return err
+		}
+		wanted = append(wanted, settingChange{item: item, value: value})
+		return nil
+	}
+	contains := func(words ...string) func(string) bool {
+		return func(opt string) bool {
+			for _, w := range words {
+				if strings.Contains(strings.ToLower(opt), w) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	if strings.EqualFold(p.REU, "off") {
+		if err := want("*RAM Expansion Unit*", "reu", contains("disab", "off")); err != nil {
+			return nil, err
+		}
+	} else if p.REU != "" {
+		size, _ := gameprofile.ReuSize(p.REU)
+		if err := want("*RAM Expansion Unit*", "reu", contains("enab", "on")); err != nil {
+			return nil, err
+		}
+		if err := want("*REU Size*", "reu", func(opt string) bool {
+			s, ok := gameprofile.ReuSize(opt)
+			return ok && s == size
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if p.SID != "" {
+		items, err := apiClient.ConfigItems("*", "*UltiSID*")
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, item := range items {
+			name := strings.ToLower(item.Name)
+			if !strings.Contains(name, "curve") && !strings.Contains(name, "model") {
+				continue
+			}
+			value, err := settingOption(item, "sid", func(opt string) bool {
+				return strings.HasPrefix(strings.TrimSpace(opt), p.SID)
+			})
+			if err != nil {
+				return nil, err
+			}
+			wanted = append(wanted, settingChange{item: item, value: value})
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("sid: the device has no UltiSID model setting; give it under [settings]")
+		}
+	}
+	if p.Joystick != 0 {
+		match := contains("normal")
+		if p.Joystick == 1 {
+			match = contains("swap")
+		}
+		if err := want("*Joystick Swap*", "joystick", match); err != nil {
+			return nil, err
+		}
+	}
+	for _, category := range sortedKeys(p.Settings) {
+		for _, name := range sortedKeys(p.Settings[category]) {
+			items, err := apiClient.ConfigItems(category, name)
+			if err != nil {
+				return nil, fmt.Errorf("%s/%s: %w", category, name, err)
+			}
+			if len(items) != 1 {
+				return nil, fmt.Errorf("the device has no setting '%s' in '%s'", name, category)
+			}
+			value := p.Settings[category][name]
+			if options := configOptions(items[0]); len(options) > 0 {
+				opt, ok := matchOption(options, strings.TrimSpace(value))
+				if !ok {
+					return nil, fmt.Errorf("%s: '%s' is not one of %s", name, value, strings.Join(options, ", "))
+				}
+				value = opt
+			}
+			wanted = append(wanted, settingChange{item: items[0], value: value})
+		}
+	}
+
+	var changes []settingChange
+	for _, c := range wanted {
+		if strings.TrimSpace(fmt.Sprintf("%v", c.item.Value)) != strings.TrimSpace(c.value) {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// gameSetting finds the device setting for a profile key
+func gameSetting(pattern, key string) (api.ConfigItem, error) {
+	items, err := apiClient.ConfigItems("*", pattern)
+	if err != nil {
+		return api.ConfigItem{}, err
+	}
+	if len(items) == 0 {
+		return api.ConfigItem{}, fmt.Errorf("%s: the device has no '%s' setting; give it under [settings]", key, strings.Trim(pattern, "*"))
+	}
+	return items[0], nil
+}
+
+// settingOption returns the first option of a setting that matches
+func settingOption(item api.ConfigItem, key string, match func(string) bool) (string, error) {
+	options := configOptions(item)
+	for _, opt := range options {
+		if match(opt) {
+			return opt, nil
+		}
+	}
+	if len(options) == 0 {
+		return "", fmt.Errorf("%s: the device reports no values for %s", key, item.Name)
+	}
+	return "", fmt.Errorf("%s: no value of %s fits; it has %s", key, item.Name, strings.Join(options, ", "))
+}
+
+// profileDriveModes returns the drive modes a profile changes and records
+// the current ones in the session
+func profileDriveModes(p *gameprofile.Profile, s *gameSession) (map[string]string, error) {
+	needed := map[string]string{}
+	if p.DriveMode != "" {
+		needed["8"] = p.DriveMode
+	}
+	for _, m := range p.Mounts {
+		if m.DriveMode != "" {
+			needed[m.Drive] = m.DriveMode
+		}
+	}
+
+	modes := map[string]string{}
+	for drive, mode := range needed {
+		_, info, err := driveStatus(drive)
+		if err != nil {
+			return nil, err
+		}
+		if current, _ := info["type"].(string); current != mode {
+			modes[drive] = mode
+			if current != "" {
+				s.Modes[drive] = current
+			}
+		}
+	}
+	return modes, nil
+}
+
+// gameDriveState returns what a drive has mounted, for restoring it
+func gameDriveState(drive string) (stateDrive, error) {
+	name, info, err := driveStatus(drive)
+	if err != nil {
+		return stateDrive{}, err
+	}
+	d := stateDrive{Drive: name}
+	if busID, ok := info["bus_id"].(float64); ok {
+		d.BusID = int(busID)
+	}
+	if file, _ := info["image_file"].(string); file != "" {
+		dir, _ := info["image_path"].(string)
+		d.Image = pathpkg.Join(dir, file)
+		if m, err := currentMount(name); err == nil && m != nil {
+			d.Type, d.Mode = m.Type, m.Mode
+		}
+	}
+	return d, nil
+}
+
+// mountGameImage mounts an image of a profile, uploading a local file
+func mountGameImage(m gameprofile.Mount) error {
+	prev, _ := currentMount(m.Drive)
+	if _, err := os.Stat(m.Image); err == nil {
+		if err := apiStep(func() (*api.Response, error) {
+			return apiClient.DrivesMountUpload(m.Drive, m.Image, m.Type, m.Mode)
+		}); err != nil {
+			return err
+		}
+		recordMount(m.Drive, &mounts.Mount{Image: m.Image, Uploaded: true, Type: m.Type, Mode: m.Mode}, prev)
+		recordUpload("mount", m.Drive, m.Image)
+		return nil
+	}
+	if err := apiStep(func() (*api.Response, error) {
+		return apiClient.DrivesMount(m.Drive, m.Image, m.Type, m.Mode)
+	}); err != nil {
+		return err
+	}
+	recordMount(m.Drive, &mounts.Mount{Image: m.Image, Type: m.Type, Mode: m.Mode}, prev)
+	return nil
+}
+
+// startGame runs the program of a profile, or resets the machine and
+// loads from the first mounted drive. It returns what was started.
+func startGame(p *gameprofile.Profile, timeout time.Duration) (string, error) {
+	if p.Run != "" {
+		return filepath.Base(p.Run), startProgram(p.Run)
+	}
+
+	_, info, err := driveStatus(p.Mounts[0].Drive)
+	if err != nil {
+		return "", err
+	}
+	bus := 8
+	if id, ok := info["bus_id"].(float64); ok {
+		bus = int(id)
+	}
+	if err := apiStep(apiClient.MachineReset); err != nil {
+		return "", fmt.Errorf("failed to reset machine: %w", err)
+	}
+	clearRunning()
+	if _, err := screen.WaitFor(apiClient, "READY.", timeout, 200*time.Millisecond); err != nil {
+		return "", fmt.Errorf("machine did not become ready: %w", err)
+	}
+	time.Sleep(readySettleDelay)
+	if err := bootDisk(bus, p.Load, timeout); err != nil {
+		return "", err
+	}
+	recordRunning("game", p.Name, 0, false)
+	return fmt.Sprintf(`LOAD"%s",%d,1`, p.Load, bus), nil
+}
+
+// bootDisk types LOAD"name",bus,1 on a cleared screen and RUN once READY.
+// shows the load finished. A program that starts itself replaces the
+// LOADING message, which ends the wait as well.
+func bootDisk(bus int, name string, timeout time.Duration) error {
+	codes, err := petscii.FromKeys(fmt.Sprintf(`{clr}LOAD"%s",%d,1`, name, bus))
+	if err != nil {
+		return fmt.Errorf("cannot type the file name: %w", err)
+	}
+	if err := keyboard.Type(apiClient, append(codes, petscii.Return), timeout); err != nil {
+		return fmt.Errorf("failed to type LOAD: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	loading := false
+	for {
+		s, err := screen.Read(apiClient)
+		if err == nil {
+			for _, line := range s.Lines() {
+				if line = strings.TrimSpace(line); strings.HasPrefix(line, "?") && strings.HasSuffix(line, "ERROR") {
+					return errors.New(line)
+				}
+			}
+			switch {
+			case s.Contains("READY."):
+				run, _ := petscii.FromKeys("RUN")
+				if err := keyboard.Type(apiClient, append(run, petscii.Return), timeout); err != nil {
+					return fmt.Errorf("failed to type RUN: %w", err)
+				}
+				return nil
+			case s.Contains("LOADING"):
+				loading = true
+			case loading:
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the load did not finish within %s", timeout)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// gameSession is what "game launch" changed, for "game stop" to undo
+type gameSession struct {
+	Profile string    `json:"profile"`
+	Path    string    `json:"path"`
+	Started time.Time `json:"started"`
+	// Config holds the previous values of the changed settings
+	Config map[string]map[string]interface{} `json:"config,omitempty"`
+	// Modes are the previous modes of the drives whose mode changed
+	Modes map[string]string `json:"drive_modes,omitempty"`
+	// Drives are what the drives the profile mounts had mounted
+	Drives []stateDrive `json:"drives,omitempty"`
+}
+
+// gameSessionPath is the location of the launch record
+func gameSessionPath() string {
+	return filepath.Join(config.GetConfigDir(), "cache", "game.json")
+}
+
+// loadGameSession returns the launch record, or nil without a launch
+func loadGameSession() (*gameSession, error) {
+	data, err := os.ReadFile(gameSessionPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var s gameSession
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", gameSessionPath(), err)
+	}
+	return &s, nil
+}
+
+func (s *gameSession) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := gameSessionPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func removeGameSession() error {
+	if err := os.Remove(gameSessionPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func init() {
+	gameCmd.AddCommand(gameLaunchCmd)
+	gameCmd.AddCommand(gameStopCmd)
+	gameCmd.AddCommand(gameListCmd)
+	gameLaunchCmd.Flags().Bool("no-run", false, "Apply the settings and mounts without starting the title")
+	gameLaunchCmd.Flags().Duration("timeout", 2*time.Minute, "How long to wait for READY. and the load from disk")
+	gameStopCmd.Flags().Bool("no-reset", false, "Do not reset the machine")
+	gameStopCmd.Flags().Bool("forget", false, "Drop the launch record without restoring")
+}
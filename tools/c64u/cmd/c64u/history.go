@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/history"
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the history command group
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show what was sent to the device",
+	Long: `Query the local manifest of uploads.
+
+Recording is enabled with upload_history = true in config.toml. Every
+program, cartridge, SID/MOD file, disk image and ROM uploaded through the
+runners and drives commands is then recorded with its SHA-256, size, time
+and target.`,
+}
+
+var historyUploadsCmd = &cobra.Command{
+	Use:   "uploads [--current] [--all-devices] [--limit N]",
+	Short: "List recorded uploads",
+	Long: `List recorded uploads, newest first, for the current device.
+
+With --current only the latest upload per target (runner, drive a, ...) is
+shown, answering "which build is on the machine right now?". Compare the
+hash with a local build using sha256sum.
+
+Examples:
+  c64u history uploads
+  c64u history uploads --current
+  c64u --json history uploads --limit 5`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		current, _ := cmd.Flags().GetBool("current")
+		allDevices, _ := cmd.Flags().GetBool("all-devices")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		uploads, err := history.Read(historyPath())
+		if err != nil {
+			formatter.Error("Failed to read upload history", []string{err.Error()})
+			return
+		}
+
+		if !allDevices {
+			device := historyDevice()
+			filtered := uploads[:0]
+			for _, u := range uploads {
+				if u.Device == device {
+					filtered = append(filtered, u)
+				}
+			}
+			uploads = filtered
+		}
+
+		if current {
+			uploads = history.Current(uploads)
+		} else {
+			// Newest first
+			for i, j := 0, len(uploads)-1; i < j; i, j = i+1, j-1 {
+				uploads[i], uploads[j] = uploads[j], uploads[i]
+			}
+		}
+		if limit > 0 && len(uploads) > limit {
+			uploads = uploads[:limit]
+		}
+
+		if jsonOut {
+			if uploads == nil {
+				uploads = []history.Upload{}
+			}
+			formatter.PrintData(map[string]interface{}{"uploads": uploads})
+			return
+		}
+
+		if len(uploads) == 0 {
+			msg := "No uploads recorded"
+			if !uploadHistory {
+				msg += " (enable upload_history in config.toml)"
+			}
+			formatter.Info(msg)
+			return
+		}
+
+		headers := []string{"time", "target", "kind", "file", "size", "sha256"}
+		if allDevices {
+			headers = append([]string{"device"}, headers...)
+		}
+		rows := make([][]string, 0, len(uploads))
+		for _, u := range uploads {
+			row := []string{
+				u.Time.Local().Format("2006-01-02 15:04:05"),
+				u.Target,
+				u.Kind,
+				filepath.Base(u.File),
+				formatter.Size(u.Size),
+				u.SHA256[:12],
+			}
+			if allDevices {
+				row = append([]string{u.Device}, row...)
+			}
+			rows = append(rows, row)
+		}
+		formatter.PrintTable(headers, rows)
+	},
+}
+
+// historyPath is the location of the upload manifest
+func historyPath() string {
+	return filepath.Join(config.GetConfigDir(), "history", "uploads.jsonl")
+}
+
+// historyDevice identifies the current device in the manifest
+func historyDevice() string {
+	return strings.TrimPrefix(apiClient.BaseURL, "http://")
+}
+
+// recordUpload adds a successful upload to the manifest if recording is
+// enabled. Failures only produce a warning.
+func recordUpload(kind, target, local string) {
+	if !uploadHistory {
+		return
+	}
+
+	u, err := history.NewUpload(historyDevice(), kind, target, local)
+	if err == nil {
+		err = history.Append(historyPath(), u)
+	}
+	if err != nil {
+		formatter.Warning(fmt.Sprintf("Failed to record upload: %v", err))
+	}
+}
+
+func init() {
+	historyUploadsCmd.Flags().Bool("current", false, "Only show the latest upload per target")
+	historyUploadsCmd.Flags().Bool("all-devices", false, "Include uploads to other devices")
+	historyUploadsCmd.Flags().Int("limit", 0, "Show at most N uploads")
+	historyUploadsCmd.Annotations = pagedOutput
+
+	historyCmd.AddCommand(historyUploadsCmd)
+}
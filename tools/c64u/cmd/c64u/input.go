@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/keyboard"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// inputCmd represents the input command group
+var inputCmd = &cobra.Command{
+	Use:   "input",
+	Short: "Record and replay keyboard sessions",
+	Long: `Record keys typed in the terminal while they are sent to the C64, with
+their timing, and play them back later, for demos and repeatable tests.
+
+Keys are sent through the KERNAL keyboard buffer as with "keys press".
+The REST API cannot drive the joystick ports, so there are no joystick
+events.`,
+}
+
+var inputRecordCmd = &cobra.Command{
+	Use:   "record <session.json>",
+	Short: "Type on the C64 from the terminal and record the keys",
+	Long: `Send the keys typed in the terminal to the C64 and record each with the
+time since the start, until Ctrl-] ends the session and it is saved.
+
+Letters are sent unshifted, Enter is RETURN, Backspace and Delete are DEL,
+Insert is INST, Esc is RUN/STOP; the cursor keys, Home and F1-F8 are their
+C64 counterparts.
+
+Example:
+  c64u input record demo.json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		interactive := output.IsTerminal(os.Stdin)
+		restore := func() {}
+		if interactive {
+			fmt.Fprintln(os.Stderr, "Recording, type on the C64 (Ctrl-] to stop)")
+			state, err := term.MakeRaw(os.Stdin.Fd())
+			if err != nil {
+				formatter.Error("Cannot switch the terminal to raw mode", []string{err.Error()})
+				return
+			}
+			restore = func() { term.Restore(os.Stdin.Fd(), state) }
+			defer restore()
+			output.OnExit(func(int) { restore() })
+		}
+
+		start := time.Now()
+		session := &keyboard.Session{Recorded: start}
+		recordErr := recordInput(session, start, timeout)
+		restore()
+
+		if err := session.Save(args[0]); err != nil {
+			formatter.Error("Failed to save session", []string{err.Error()})
+			return
+		}
+		if recordErr != nil {
+			formatter.Error("Recording stopped", []string{recordErr.Error(),
+				fmt.Sprintf("the %s before it are saved in %s", plural(len(session.Events), "key"), args[0])})
+			return
+		}
+		formatter.Success("Session recorded", map[string]interface{}{
+			"file":     args[0],
+			"keys":     len(session.Events),
+			"duration": formatter.Duration(time.Since(start)),
+		})
+	},
+}
+
+// recordInput sends keys from stdin to the C64 and adds them to the
+// session until Ctrl-] or the end of input
+func recordInput(session *keyboard.Session, start time.Time, timeout time.Duration) error {
+	buf := make([]byte, 256)
+	for {
+		n, err := os.Stdin.Read(buf)
+		names, quit := terminalKeys(buf[:n])
+		// Keys read together (typed fast or pasted) are pressed together
+		at := time.Since(start)
+		var keys []keyboard.Key
+		for _, name := range names {
+			if k, perr := keyboard.ParseKey(name); perr == nil {
+				keys = append(keys, k)
+			}
+		}
+		if perr := keyboard.Press(apiClient, keys, timeout); perr != nil {
+			return perr
+		}
+		for _, k := range keys {
+			session.Events = append(session.Events, keyboard.Event{AtMS: at.Milliseconds(), Key: k.Name})
+		}
+		if quit || err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// terminalSequences map the escape sequences terminals send to C64 keys
+var terminalSequences = map[string]string{
+	"\x1b[A": "CRSR-UP", "\x1b[B": "CRSR-DOWN", "\x1b[C": "CRSR-RIGHT", "\x1b[D": "CRSR-LEFT",
+	"\x1bOA": "CRSR-UP", "\x1bOB": "CRSR-DOWN", "\x1bOC": "CRSR-RIGHT", "\x1bOD": "CRSR-LEFT",
+	"\x1b[H": "HOME", "\x1bOH": "HOME", "\x1b[1~": "HOME", "\x1b[2~": "INST", "\x1b[3~": "DEL",
+	"\x1bOP": "F1", "\x1bOQ": "F2", "\x1bOR": "F3", "\x1bOS": "F4",
+	"\x1b[15~": "F5", "\x1b[17~": "F6", "\x1b[18~": "F7", "\x1b[19~": "F8",
+}
+
+// terminalKeys translates terminal input to key names; quit is set at
+// Ctrl-], and the input after it is dropped
+func terminalKeys(data []byte) (names []string, quit bool) {
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		switch {
+		case b == consoleEscape:
+			return names, true
+		case b == 0x1B:
+			seq := terminalSequence(data[i:])
+			if name, ok := terminalSequences[seq]; ok {
+				names = append(names, name)
+			} else if len(seq) == 1 {
+				names = append(names, "RUNSTOP")
+			}
+			i += len(seq) - 1
+		case b == '\r' || b == '\n':
+			names = append(names, "RETURN")
+		case b == 0x7F || b == 0x08:
+			names = append(names, "DEL")
+		case b >= 0x20 && b < 0x7F:
+			names = append(names, string(rune(b)))
+		}
+	}
+	return names, false
+}
+
+// terminalSequence returns the escape sequence at the start of data: ESC
+// alone, or ESC [ or ESC O up to the final letter or ~
+func terminalSequence(data []byte) string {
+	if len(data) < 2 || (data[1] != '[' && data[1] != 'O') {
+		return string(data[:1])
+	}
+	for j := 2; j < len(data); j++ {
+		if c := data[j]; c == '~' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+			return string(data[:j+1])
+		}
+	}
+	return string(data)
+}
+
+var inputReplayCmd = &cobra.Command{
+	Use:   "replay <session.json> [--speed X]",
+	Short: "Play back a recorded keyboard session",
+	Long: `Press the keys of a recorded session at their recorded times. --speed 2
+plays it twice as fast, --speed 0 presses the keys as fast as the machine
+takes them.
+
+Each key waits until the machine has taken the previous ones, so a key
+comes late if the machine is busier than during the recording; the
+largest delay is reported. Ctrl-C stops the replay.
+
+Examples:
+  c64u input replay demo.json
+  c64u input replay test.json --speed 0`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		speed, _ := cmd.Flags().GetFloat64("speed")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		if speed < 0 {
+			formatter.Error("Invalid speed", []string{"--speed must not be negative"})
+			return
+		}
+
+		session, keys, err := keyboard.LoadSession(args[0])
+		if err != nil {
+			formatter.Error("Failed to load session", []string{err.Error()})
+			return
+		}
+
+		start := time.Now()
+		due := func(i int) time.Time {
+			return start.Add(time.Duration(float64(session.Events[i].AtMS)/speed) * time.Millisecond)
+		}
+		var late time.Duration
+		for i := 0; i < len(keys); {
+			// Keys that are due, also after a late one, are pressed together
+			n := len(keys) - i
+			if speed > 0 {
+				time.Sleep(time.Until(due(i)))
+				late = max(late, time.Since(due(i)))
+				now := time.Now()
+				for n = 1; i+n < len(keys) && !due(i+n).After(now); n++ {
+				}
+			}
+			if err := keyboard.Press(apiClient, keys[i:i+n], timeout); err != nil {
+				formatter.Error(fmt.Sprintf("Replay stopped at key %d (%s)", i+1, keys[i].Name), []string{err.Error()})
+				return
+			}
+			i += n
+		}
+
+		data := map[string]interface{}{
+			"keys":     len(keys),
+			"duration": formatter.Duration(time.Since(start)),
+		}
+		if speed > 0 {
+			data["max_late"] = formatter.Duration(late)
+		}
+		formatter.Success("Session replayed", data)
+	},
+}
+
+func init() {
+	inputCmd.AddCommand(inputRecordCmd)
+	inputCmd.AddCommand(inputReplayCmd)
+	inputRecordCmd.Flags().Duration("timeout", 10*time.Second, "How long to wait for the machine to take each key")
+	inputReplayCmd.Flags().Float64("speed", 1, "Playback speed factor (0: no pauses)")
+	inputReplayCmd.Flags().Duration("timeout", 10*time.Second, "How long to wait for the machine to take each key")
+}
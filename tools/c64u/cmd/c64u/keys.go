@@ -0,0 +1,373 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/keyboard"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/keymap"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+// keysCmd represents the keys command group
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Keyboard input",
+	Long: `Send keystrokes to the running machine.
+
+The REST API has no keyboard endpoint, so keys are written into the KERNAL
+keyboard buffer with DMA, ten at a time. They reach programs that read the
+keyboard through the KERNAL (BASIC, most menus), not ones that scan the
+keyboard matrix themselves, nor the Ultimate menu.`,
+}
+
+var keysTypeCmd = &cobra.Command{
+	Use:   "type <text|-> [--return] [--via-dma] [--timeout D]",
+	Short: "Type text on the C64 keyboard",
+	Long: `Type text into the running machine as keystrokes. "-" reads the text
+from stdin.
+
+Letters are typed unshifted (uppercase in the default character set) and
+newlines as RETURN. Other keys are written in braces, as in petcat:
+  {return} {clr} {home} {del} {inst} {up} {down} {left} {right}
+  {f1}-{f8} {rvs on} {rvs off} {swlc} {swuc} {blk} {wht} {red} ...
+and {$hh} types PETSCII code hh. --return presses RETURN at the end.
+Characters of the host keyboard layout that PETSCII lacks, such as
+umlauts, are translated by the keymap (--keymap or keymap in
+config.toml, see "keys layouts").
+
+Typing waits for the machine to take each batch of keys; it fails after
+--timeout if it does not (paused, or not reading the keyboard).
+
+--via-dma asks for the keyboard buffer explicitly. No firmware has a
+keyboard endpoint yet, so the buffer is always used; --via-dma lets a
+script keep it should a later firmware add one.
+
+Examples:
+  c64u keys type 'LOAD"*",8,1' --return
+  c64u keys type '{clr}RUN{return}'
+  c64u keys type - < commands.txt`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pressReturn, _ := cmd.Flags().GetBool("return")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		text := args[0]
+		if text == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				formatter.Error("Failed to read stdin", []string{err.Error()})
+				return
+			}
+			text = strings.ReplaceAll(string(data), "\r\n", "\n")
+		}
+
+		km, ok := loadKeymap(cmd)
+		if !ok {
+			return
+		}
+		codes, err := petscii.FromKeys(km.Apply(text))
+		if err != nil {
+			formatter.Error("Cannot type text", []string{err.Error(), keymapHint(km)})
+			return
+		}
+		if pressReturn {
+			codes = append(codes, petscii.Return)
+		}
+		if len(codes) == 0 {
+			formatter.Error("Nothing to type", []string{"the text is empty"})
+			return
+		}
+
+		if err := keyboard.Type(apiClient, codes, timeout); err != nil {
+			formatter.Error("Failed to type text", []string{err.Error()})
+			return
+		}
+		formatter.Success("Typed "+plural(len(codes), "key"), map[string]interface{}{
+			"keys": petscii.ToEscaped(codes),
+		})
+	},
+}
+
+var keysPressCmd = &cobra.Command{
+	Use:   "press <key>... [--timeout D]",
+	Short: "Press special keys and key combinations",
+	Long: `Press keys by name, one after the other. A name is a single character,
+one of
+  RETURN SPACE HOME CLR DEL INST CRSR-DOWN CRSR-UP CRSR-LEFT CRSR-RIGHT
+  F1-F8 RUNSTOP POUND UP-ARROW LEFT-ARROW
+or a combination with SHIFT, CTRL or C= joined by +, such as SHIFT+A,
+SHIFT+RUNSTOP (types LOAD and RUN, as the KERNAL does), CTRL+1 to CTRL+8
+and C=+1 to C=+8 (colors), CTRL+9 and CTRL+0 (reverse on and off).
+
+RUNSTOP is seen by the KERNAL's STOP check until its next keyboard scan,
+which breaks a running BASIC program, and goes into the keyboard buffer
+for programs waiting for a key. RESTORE (and RUNSTOP+RESTORE) raises an
+NMI, which the API cannot do; "machine reset" is the nearest.
+
+Examples:
+  c64u keys press F1
+  c64u keys press RUNSTOP
+  c64u keys press CLR CRSR-DOWN CRSR-DOWN RETURN
+  c64u keys press SHIFT+RUNSTOP`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		keys := make([]keyboard.Key, 0, len(args))
+		names := make([]string, 0, len(args))
+		for _, arg := range args {
+			k, err := keyboard.ParseKey(arg)
+			if errors.Is(err, keyboard.ErrRestore) {
+				formatter.Error("Cannot press "+arg, []string{err.Error(), "to get out of a program, use: c64u machine reset"})
+				return
+			}
+			if err != nil {
+				formatter.Error("Cannot press "+arg, []string{err.Error()})
+				return
+			}
+			keys = append(keys, k)
+			names = append(names, k.Name)
+		}
+
+		if err := keyboard.Press(apiClient, keys, timeout); err != nil {
+			formatter.Error("Failed to press keys", []string{err.Error()})
+			return
+		}
+		formatter.Success("Pressed "+strings.Join(names, " "), nil)
+	},
+}
+
+var keysPasteCmd = &cobra.Command{
+	Use:   "paste [--clipboard] [--delay D] [--timeout D]",
+	Short: "Type text from stdin or the clipboard, e.g. a BASIC listing",
+	Long: `Type the text on stdin, or in the clipboard with --clipboard, into the
+machine line by line, e.g. a BASIC listing from an editor at the READY.
+prompt. Each line ends with RETURN.
+
+The text is translated to PETSCII as typed: letters of either case become
+unshifted letters, tabs become spaces and typographic quotes plain ones;
+{name} and {$hh} stand for special keys as with "keys type", and the
+keymap translates characters of the host layout. A line of
+more than 80 characters, which the screen editor cannot take, stops the
+paste before anything is typed.
+
+Keys go in ten at a time as fast as the machine takes them; --delay types
+one key at a time with a pause after each, for programs that poll the
+keyboard slowly. --clipboard uses pbpaste, wl-paste, xclip, xsel or
+PowerShell, whichever is available.
+
+Examples:
+  c64u keys paste < game.bas
+  c64u keys paste --clipboard
+  c64u keys paste --delay 50ms < input.txt`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		clipboard, _ := cmd.Flags().GetBool("clipboard")
+		delay, _ := cmd.Flags().GetDuration("delay")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		var data []byte
+		var err error
+		if clipboard {
+			data, err = readClipboard()
+		} else {
+			data, err = io.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			formatter.Error("Failed to read the text to paste", []string{err.Error()})
+			return
+		}
+
+		km, ok := loadKeymap(cmd)
+		if !ok {
+			return
+		}
+		codes, lines, err := pasteCodes(km.Apply(string(data)))
+		if err != nil {
+			formatter.Error("Cannot paste text", []string{err.Error(), keymapHint(km)})
+			return
+		}
+		if len(codes) == 0 {
+			formatter.Error("Nothing to paste", []string{"the text is empty"})
+			return
+		}
+
+		if delay <= 0 {
+			err = keyboard.Type(apiClient, codes, timeout)
+		} else {
+			for _, c := range codes {
+				if err = keyboard.Type(apiClient, []byte{c}, timeout); err != nil {
+					break
+				}
+				time.Sleep(delay)
+			}
+		}
+		if err != nil {
+			formatter.Error("Failed to paste text", []string{err.Error()})
+			return
+		}
+		formatter.Success("Pasted "+plural(lines, "line"), map[string]interface{}{
+			"keys": len(codes),
+		})
+	},
+}
+
+// pasteReplacer maps text from editors to characters PETSCII has
+var pasteReplacer = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\t", " ",
+	"\u201c", "\"", "\u201d", "\"", "\u2018", "'", "\u2019", "'", "\u00a0", " ")
+
+// pasteCodes translates pasted text to keys, ending each line with RETURN
+func pasteCodes(text string) ([]byte, int, error) {
+	text = strings.TrimSuffix(pasteReplacer.Replace(text), "\n")
+	if text == "" {
+		return nil, 0, nil
+	}
+	var codes []byte
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		c, err := petscii.FromKeys(line)
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if len(c) > maxBasicLine {
+			return nil, 0, fmt.Errorf("line %d has %d characters, the screen editor takes at most %d", i+1, len(c), maxBasicLine)
+		}
+		codes = append(append(codes, c...), petscii.Return)
+	}
+	return codes, len(lines), nil
+}
+
+var keysLayoutsCmd = &cobra.Command{
+	Use:   "layouts",
+	Short: "List the keymaps for host keyboard layouts",
+	Long: `List the keymaps that translate characters of host keyboard layouts,
+which PETSCII lacks, for "keys type" and "keys paste".
+
+The keymap is chosen with keymap = "<name>" in config.toml or --keymap.
+Custom keymaps are TOML files in ~/.config/c64u/keymaps, named after the
+file; one named like a built-in keymap replaces it:
+
+  description = "Swedish with lowercase å ä ö"
+  [chars]
+  "å" = "{$5D}"
+  "ü" = "UE"
+
+Each character becomes text as written for "keys type": characters and
+{name} or {$hh} escapes.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load()
+		if err != nil {
+			formatter.Error("Failed to load config", []string{err.Error()})
+			return
+		}
+		keymaps, err := keymap.List(keymap.Dir(config.GetConfigDir()))
+		if err != nil {
+			formatter.Error("Failed to load keymaps", []string{err.Error()})
+			return
+		}
+
+		if jsonOut {
+			list := make([]map[string]interface{}, 0, len(keymaps))
+			for _, k := range keymaps {
+				list = append(list, map[string]interface{}{
+					"name": k.Name, "description": k.Description, "file": k.Path,
+					"characters": len(k.Chars), "active": k.Name == cfg.Keymap,
+				})
+			}
+			formatter.PrintData(map[string]interface{}{"keymaps": list})
+			return
+		}
+		rows := make([][]string, 0, len(keymaps))
+		for _, k := range keymaps {
+			kind := "built-in"
+			if k.Path != "" {
+				kind = "custom"
+			}
+			active := ""
+			if k.Name == cfg.Keymap {
+				active = "*"
+			}
+			rows = append(rows, []string{k.Name, kind, strconv.Itoa(len(k.Chars)), active, k.Description})
+		}
+		formatter.PrintTable([]string{"keymap", "kind", "characters", "active", "description"}, rows)
+	},
+}
+
+// loadKeymap returns the keymap chosen with --keymap or in config.toml,
+// nil for none; false means it could not be loaded
+func loadKeymap(cmd *cobra.Command) (*keymap.Keymap, bool) {
+	name, _ := cmd.Flags().GetString("keymap")
+	if !cmd.Flags().Changed("keymap") {
+		if cfg, err := config.Load(); err == nil {
+			name = cfg.Keymap
+		}
+	}
+	if name == "" || name == "none" {
+		return nil, true
+	}
+	km, err := keymap.Load(keymap.Dir(config.GetConfigDir()), name)
+	if err != nil {
+		formatter.Error("Cannot load keymap", []string{err.Error()})
+		return nil, false
+	}
+	return km, true
+}
+
+// keymapHint suggests a keymap for characters PETSCII lacks
+func keymapHint(km *keymap.Keymap) string {
+	if km == nil {
+		return "choose a keymap for your keyboard layout: c64u keys layouts"
+	}
+	return fmt.Sprintf("add the character to the keymap '%s' (see c64u keys layouts --help)", km.Name)
+}
+
+// clipboardCommands read the clipboard on the various systems
+var clipboardCommands = [][]string{
+	{"pbpaste"},
+	{"wl-paste", "--no-newline"},
+	{"xclip", "-selection", "clipboard", "-o"},
+	{"xsel", "--clipboard", "--output"},
+	{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard"},
+}
+
+// readClipboard returns the text in the clipboard
+func readClipboard() ([]byte, error) {
+	for _, c := range clipboardCommands {
+		if _, err := exec.LookPath(c[0]); err != nil {
+			continue
+		}
+		out, err := exec.Command(c[0], c[1:]...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c[0], err)
+		}
+		return out, nil
+	}
+	return nil, errors.New("no clipboard tool found (pbpaste, wl-paste, xclip, xsel); pipe the text to stdin instead")
+}
+
+func init() {
+	keysCmd.AddCommand(keysTypeCmd)
+	keysCmd.AddCommand(keysPressCmd)
+	keysCmd.AddCommand(keysPasteCmd)
+	keysCmd.AddCommand(keysLayoutsCmd)
+	for _, c := range []*cobra.Command{keysTypeCmd, keysPasteCmd} {
+		c.Flags().String("keymap", "", "Keymap for the host keyboard layout (default: keymap in config.toml)")
+	}
+	keysTypeCmd.Flags().Bool("return", false, "Press RETURN after the text")
+	keysTypeCmd.Flags().Bool("via-dma", false, "Type through the KERNAL keyboard buffer (currently always)")
+	keysTypeCmd.Flags().Duration("timeout", 10*time.Second, "How long to wait for the machine to take each batch of keys")
+	keysPressCmd.Flags().Duration("timeout", 10*time.Second, "How long to wait for the machine to take each key")
+	keysPasteCmd.Flags().Bool("clipboard", false, "Paste the clipboard instead of stdin")
+	keysPasteCmd.Flags().Duration("delay", 0, "Type one key at a time with this pause after each")
+	keysPasteCmd.Flags().Duration("timeout", 10*time.Second, "How long to wait for the machine to take each batch of keys")
+}
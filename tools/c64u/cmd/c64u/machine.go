@@ -3,9 +3,14 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/screen"
 	"github.com/spf13/cobra"
 )
 
@@ -24,30 +29,178 @@ memory read/write operations via DMA.`,
 // ============================================================================
 
 var machineResetCmd = &cobra.Command{
-	Use:   "reset",
+	Use:   "reset [--hold-ms N] [--freeze] [--then-run FILE] [--after D|--at T]",
 	Short: "Reset the machine",
-	Long:  `Send a reset signal to the machine without changing configuration.`,
+	Long: `Send a reset signal to the machine without changing configuration.
+
+The API has no reset line control, so timing options are emulated:
+  --hold-ms N     keep the machine halted (DMA paused) for N ms, then reset
+  --freeze        pause the machine right after the reset
+  --then-run FILE wait for the READY. prompt, then run a program or cartridge
+                  (a local file is uploaded, otherwise FILE is a device path)
+
+--after D or --at T waits in the foreground first, e.g. --after 90m or
+--at 18:00 (the next 18:00; a date is written "2026-10-14 18:00").
+Ctrl-C cancels the wait.
+
+Examples:
+  c64u machine reset
+  c64u machine reset --hold-ms 500
+  c64u machine reset --then-run game.prg
+  c64u machine reset --then-run /Usb0/carts/action.crt
+  c64u machine reset --at 18:00`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		resp, err := apiClient.MachineReset()
-		if err != nil {
-			formatter.Error("Failed to reset machine", []string{err.Error()})
+		holdMS, _ := cmd.Flags().GetInt("hold-ms")
+		freeze, _ := cmd.Flags().GetBool("freeze")
+		thenRun, _ := cmd.Flags().GetString("then-run")
+		readyTimeout, _ := cmd.Flags().GetDuration("ready-timeout")
+
+		if freeze && thenRun != "" {
+			formatter.Error("Invalid options", []string{"--freeze and --then-run cannot be combined"})
+			return
+		}
+		if !waitDelay(cmd, "reset") {
 			return
 		}
 
-		if resp.HasErrors() {
-			formatter.Error("API returned errors", resp.Errors)
+		if holdMS > 0 {
+			if !machineStep("pause machine", apiClient.MachinePause) {
+				return
+			}
+			time.Sleep(time.Duration(holdMS) * time.Millisecond)
+		}
+
+		if !machineStep("reset machine", apiClient.MachineReset) {
 			return
 		}
+		clearRunning()
+
+		switch {
+		case freeze:
+			if !machineStep("pause machine", apiClient.MachinePause) {
+				return
+			}
+		case holdMS > 0:
+			if !machineStep("resume machine", apiClient.MachineResume) {
+				return
+			}
+		}
+
+		data := map[string]interface{}{}
+		if holdMS > 0 {
+			data["hold_ms"] = holdMS
+		}
+		if freeze {
+			data["frozen"] = true
+		}
+
+		if thenRun != "" {
+			start := time.Now()
+			if _, err := screen.WaitFor(apiClient, "READY.", readyTimeout, 200*time.Millisecond); err != nil {
+				formatter.Error("Machine did not become ready", []string{err.Error()})
+				return
+			}
+			data["ready_after"] = formatter.Duration(time.Since(start))
+			time.Sleep(readySettleDelay)
+
+			if !runProgram(thenRun) {
+				return
+			}
+			data["started"] = thenRun
+		}
 
-		formatter.Success("Machine reset successfully", nil)
+		if len(data) == 0 {
+			data = nil
+		}
+		formatter.Success("Machine reset successfully", data)
 	},
 }
 
+// readySettleDelay gives BASIC a moment after printing READY. before a
+// program is started
+const readySettleDelay = 200 * time.Millisecond
+
+// machineStep runs a machine control call, reporting failures
+func machineStep(action string, call func() (*api.Response, error)) bool {
+	resp, err := call()
+	if err != nil {
+		formatter.Error("Failed to "+action, []string{err.Error()})
+		return false
+	}
+	if resp.HasErrors() {
+		formatter.Error("API returned errors", resp.Errors)
+		return false
+	}
+	return true
+}
+
+// apiStep calls the API and returns its errors as one error
+func apiStep(call func() (*api.Response, error)) error {
+	resp, err := call()
+	if err != nil {
+		return err
+	}
+	if resp.HasErrors() {
+		return fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+	}
+	return nil
+}
+
+// runProgram starts a PRG or CRT, uploading it if it is a local file
+func runProgram(file string) bool {
+	if err := startProgram(file); err != nil {
+		formatter.Error("Failed to run "+file, []string{err.Error()})
+		return false
+	}
+	return true
+}
+
+// startProgram is runProgram returning the error instead of printing it
+func startProgram(file string) error {
+	crt := strings.EqualFold(filepath.Ext(file), ".crt")
+	_, statErr := os.Stat(file)
+	local := statErr == nil
+
+	run := apiClient.RunPRG
+	switch {
+	case crt && local:
+		run = apiClient.RunCRTUpload
+	case crt:
+		run = apiClient.RunCRT
+	case local:
+		run = apiClient.RunPRGUpload
+	}
+	if err := apiStep(func() (*api.Response, error) { return run(file) }); err != nil {
+		return err
+	}
+
+	kind := "run_prg"
+	if crt {
+		kind = "run_crt"
+	}
+	if local {
+		recordUpload(kind, "runner", file)
+	}
+	recordRunning(kind, file, 0, local)
+	return nil
+}
+
 var machineRebootCmd = &cobra.Command{
-	Use:   "reboot",
+	Use:   "reboot [--after D|--at T]",
 	Short: "Reboot the machine",
-	Long:  `Restart the machine with cartridge reinitialization.`,
+	Long: `Restart the machine with cartridge reinitialization.
+
+Asks for confirmation first, as a running program loses its state; --yes
+(or assume_yes in config.toml) skips the question.
+
+--after 2h or --at 18:00 reboots later: after the confirmation, c64u waits
+in the foreground until then (Ctrl-C cancels).`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if !confirmCmd(cmd, "Reboot the machine?") || !waitDelay(cmd, "reboot") {
+			return
+		}
+
 		resp, err := apiClient.MachineReboot()
 		if err != nil {
 			formatter.Error("Failed to reboot machine", []string{err.Error()})
@@ -59,6 +212,7 @@ var machineRebootCmd = &cobra.Command{
 			return
 		}
 
+		clearRunning()
 		formatter.Success("Machine rebooted successfully", nil)
 	},
 }
@@ -104,10 +258,26 @@ var machineResumeCmd = &cobra.Command{
 }
 
 var machinePowerOffCmd = &cobra.Command{
-	Use:   "poweroff",
+	Use:   "poweroff [--after D|--at T]",
 	Short: "Power off the machine (U64 only)",
-	Long:  `Power off the machine. This command only works on Ultimate 64 hardware.`,
+	Long: `Power off the machine. This command only works on Ultimate 64 hardware.
+
+Asks for confirmation first; --yes (or assume_yes in config.toml) skips
+the question.
+
+--after and --at delay the power off, for exhibits or time limits: the
+question is asked at once, then c64u waits in the foreground (Ctrl-C
+cancels). --at takes HH:MM, the next such time, or "YYYY-MM-DD HH:MM".
+For a daily time use a [[schedule]] job and "c64u daemon".
+
+Examples:
+  c64u machine poweroff --after 2h --yes
+  c64u machine poweroff --at 19:30`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if !confirmCmd(cmd, "Power off the machine?") || !waitDelay(cmd, "power off") {
+			return
+		}
+
 		resp, err := apiClient.MachinePowerOff()
 		if err != nil {
 			formatter.Error("Failed to power off machine", []string{err.Error()})
@@ -119,6 +289,7 @@ var machinePowerOffCmd = &cobra.Command{
 			return
 		}
 
+		clearRunning()
 		formatter.Success("Machine powered off", nil)
 	},
 }
@@ -213,26 +384,60 @@ Example:
 			"file":    filePath,
 			"size":    fileInfo.Size(),
 		}
+		if !jsonOut {
+			data["size"] = formatter.Size(fileInfo.Size())
+		}
 		formatter.Success("Wrote file to memory", data)
 	},
 }
 
 var machineReadMemCmd = &cobra.Command{
-	Use:   "read-mem <address> [--length N]",
+	Use:   "read-mem <address> [--length N] [--bank cpu|ram|rom|io | --port N]",
 	Short: "Read memory via DMA",
 	Long: `Perform DMA read operation and return binary data.
 
 The output can be redirected to a file or viewed as hex dump.
 
+DMA sees memory as the CPU does, so where ROM or I/O is banked in, the RAM
+below cannot be read. --bank changes the processor port $01 for the read:
+
+  cpu   as the CPU sees it now (default)
+  ram   RAM everywhere, including below BASIC, I/O and the KERNAL
+  rom   BASIC, character ROM at $D000 and KERNAL
+  io    BASIC, I/O and KERNAL, the usual setup
+
+--port sets bits 0-2 of $01 (LORAM, HIRAM, CHAREN) to a value of 0-7
+instead. The machine is paused, $01 changed, the memory read, and $01
+restored before the machine resumes, so the running program does not
+notice. A cartridge can still map its own ROM over these areas.
+
+If the device does not let DMA change the port, the read shows the usual
+view; that is reported when $A000 did not change although BASIC ROM
+should have been swapped in or out.
+
 Examples:
   c64u machine read-mem 0400 --length 1000 > screen.bin
-  c64u machine read-mem d020 --length 1`,
+  c64u machine read-mem d020 --length 1
+  c64u machine read-mem a000 --length 8192 --bank ram > under-basic.bin
+  c64u machine read-mem d000 --length 4096 --bank rom > chargen.bin`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		address := args[0]
 		length, _ := cmd.Flags().GetInt("length")
 
-		resp, err := apiClient.MachineReadMem(address, length)
+		bits, banked, err := bankFlag(cmd)
+		if err != nil {
+			formatter.Error("Invalid bank", []string{err.Error()})
+			return
+		}
+
+		var resp *api.Response
+		var read *bankedRead
+		if banked {
+			resp, read, err = readBanked(address, length, bits)
+		} else {
+			resp, err = apiClient.MachineReadMem(address, length)
+		}
 		if err != nil {
 			formatter.Error("Failed to read memory", []string{err.Error()})
 			return
@@ -242,6 +447,10 @@ Examples:
 			formatter.Error("API returned errors", resp.Errors)
 			return
 		}
+		notice := ""
+		if read != nil && read.unchanged {
+			notice = fmt.Sprintf("$%04X did not change with $01 = $%02X; the device may not let DMA set the processor port, so this is the CPU's view", basicProbe, read.port())
+		}
 
 		// Parse address for hex dump
 		addr, err := strconv.ParseInt(address, 16, 64)
@@ -251,19 +460,120 @@ Examples:
 
 		// Display as hex dump in text mode, raw bytes in JSON mode
 		if jsonOut {
-			formatter.PrintData(map[string]interface{}{
+			data := map[string]interface{}{
 				"address": "$" + address,
 				"length":  len(resp.RawBody),
 				"data":    fmt.Sprintf("%x", resp.RawBody),
-			})
+			}
+			if read != nil {
+				data["port"] = fmt.Sprintf("$%02X", read.port())
+				data["bank"] = bankDescription(bits)
+			}
+			if notice != "" {
+				data["warning"] = notice
+			}
+			formatter.PrintData(data)
 		} else {
-			formatter.PrintHeader(fmt.Sprintf("Memory dump from $%s (%d bytes)", address, len(resp.RawBody)))
+			header := fmt.Sprintf("Memory dump from $%s: %s", address, formatter.Size(int64(len(resp.RawBody))))
+			if read != nil {
+				header += " (" + bankDescription(bits) + ")"
+			}
+			formatter.PrintHeader(header)
 			fmt.Println()
 			fmt.Print(api.FormatMemoryDump(resp.RawBody, int(addr)))
+			if notice != "" {
+				formatter.Warning(notice)
+			}
 		}
 	},
 }
 
+var machineDiffCmd = &cobra.Command{
+	Use:   "diff <address> <file> [--side-by-side] [--context N]",
+	Short: "Compare memory with a local file",
+	Long: `Read memory starting at the hex address and compare it byte by byte with
+the contents of a local file. Differences are shown as a colored hex diff,
+or as a list of differing ranges in JSON mode.
+
+Exits with status 1 if the memory differs from the file.
+
+Examples:
+  c64u machine diff 0400 expected-screen.bin
+  c64u machine diff c000 routine.bin --side-by-side`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		address := args[0]
+		filePath := args[1]
+		sideBySide, _ := cmd.Flags().GetBool("side-by-side")
+		context, _ := cmd.Flags().GetInt("context")
+
+		expected, err := os.ReadFile(filePath)
+		if err != nil {
+			formatter.Error("Failed to read file", []string{err.Error()})
+			return
+		}
+		if len(expected) == 0 {
+			formatter.Error("File is empty", []string{filePath})
+			return
+		}
+
+		addr, err := strconv.ParseInt(address, 16, 64)
+		if err != nil {
+			formatter.Error("Invalid address", []string{fmt.Sprintf("'%s' is not a hex address", address)})
+			return
+		}
+
+		resp, err := apiClient.MachineReadMem(address, len(expected))
+		if err != nil {
+			formatter.Error("Failed to read memory", []string{err.Error()})
+			return
+		}
+
+		if resp.HasErrors() {
+			formatter.Error("API returned errors", resp.Errors)
+			return
+		}
+
+		equal := formatter.PrintHexDiff(int(addr), expected, resp.RawBody, output.DiffOptions{
+			ExpectedLabel: filePath,
+			ActualLabel:   fmt.Sprintf("memory $%04X-$%04X", addr, int(addr)+len(expected)-1),
+			SideBySide:    sideBySide,
+			Context:       context,
+		})
+		if !equal {
+			output.Exit(1)
+		}
+		formatter.Success("Memory matches file", nil)
+	},
+}
+
+// readMemory reads length bytes at address via DMA
+func readMemory(address, length int) ([]byte, error) {
+	resp, err := apiClient.MachineReadMem(fmt.Sprintf("%04X", address), length)
+	if err != nil {
+		return nil, err
+	}
+	if resp.HasErrors() {
+		return nil, fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+	}
+	if len(resp.RawBody) < length {
+		return nil, fmt.Errorf("short read at $%04X: got %d of %d bytes", address, len(resp.RawBody), length)
+	}
+	return resp.RawBody[:length], nil
+}
+
+// writeMemory writes up to 128 bytes at address via DMA
+func writeMemory(address int, data []byte) error {
+	resp, err := apiClient.MachineWriteMem(fmt.Sprintf("%04X", address), fmt.Sprintf("%X", data))
+	if err != nil {
+		return err
+	}
+	if resp.HasErrors() {
+		return fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+	}
+	return nil
+}
+
 // ============================================================================
 // Debug Register (U64 only)
 // ============================================================================
@@ -314,6 +624,125 @@ Example:
 	},
 }
 
+// ============================================================================
+// CPU Speed (U64 only)
+// ============================================================================
+
+// Configuration items controlling the U64 turbo mode
+const (
+	speedItem   = "CPU Speed"
+	turboItem   = "Turbo Control"
+	badlineItem = "Badline Timing"
+)
+
+var machineSpeedCmd = &cobra.Command{
+	Use:   "speed <1x|2x|...|48x|badline-on|badline-off> [--save]",
+	Short: "Set the CPU speed and badline timing (U64 only)",
+	Long: `Change the Ultimate 64 turbo settings through the configuration API.
+
+"Nx" runs the CPU at N MHz (1x turns the turbo off); the closest speed
+supported by the firmware is used. "badline-off" disables VIC badline
+timing, which speeds up turbo mode further at the cost of display timing.
+
+Examples:
+  c64u machine speed show
+  c64u machine speed 4x
+  c64u machine speed 1x
+  c64u machine speed badline-off --save`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		save, _ := cmd.Flags().GetBool("save")
+		mode := strings.ToLower(args[0])
+
+		changed := make(map[string]interface{})
+		set := func(name, value string) bool {
+			item, ok := speedSetting(name)
+			if !ok {
+				return false
+			}
+			if !setConfigItem(item, value) {
+				return false
+			}
+			changed[item.Name] = value
+			return true
+		}
+
+		switch {
+		case mode == "badline-off" || mode == "badline-on":
+			value := "Disabled"
+			if mode == "badline-on" {
+				value = "Enabled"
+			}
+			if !set(badlineItem, value) {
+				return
+			}
+		case strings.HasSuffix(mode, "x"):
+			mhz, err := strconv.Atoi(strings.TrimSuffix(mode, "x"))
+			if err != nil || mhz < 1 {
+				formatter.Error("Invalid speed", []string{fmt.Sprintf("'%s' is not a speed like 1x, 2x or 8x", args[0])})
+				return
+			}
+
+			if mhz == 1 {
+				if !set(turboItem, "Off") {
+					return
+				}
+				break
+			}
+
+			speed, ok := speedSetting(speedItem)
+			if !ok {
+				return
+			}
+			value := fmt.Sprintf("%2d", mhz)
+			if level, ok := closestLevel(configOptions(speed), mhz); ok {
+				value = level
+			}
+			if !set(turboItem, "Manual") || !set(speedItem, value) {
+				return
+			}
+		default:
+			formatter.Error("Invalid speed", []string{fmt.Sprintf("'%s' is not Nx, badline-on or badline-off", args[0])})
+			return
+		}
+
+		if save && !saveConfigToFlash() {
+			return
+		}
+		formatter.Success("CPU speed settings changed", changed)
+	},
+}
+
+var machineSpeedShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the CPU speed and badline timing",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var items []api.ConfigItem
+		for _, name := range []string{turboItem, speedItem, badlineItem} {
+			item, ok := speedSetting(name)
+			if !ok {
+				return
+			}
+			items = append(items, item)
+		}
+		printConfigItems(items)
+	},
+}
+
+// speedSetting looks up a turbo configuration item in any category
+func speedSetting(name string) (api.ConfigItem, bool) {
+	items, err := apiClient.ConfigItems("*", name)
+	if err == nil && len(items) == 0 {
+		err = fmt.Errorf("the device has no '%s' setting (U64 only)", name)
+	}
+	if err != nil {
+		formatter.Error("Failed to read speed settings", []string{err.Error()})
+		return api.ConfigItem{}, false
+	}
+	return items[0], true
+}
+
 func init() {
 	// Add control commands
 	machineCmd.AddCommand(machineResetCmd)
@@ -323,15 +752,39 @@ func init() {
 	machineCmd.AddCommand(machinePowerOffCmd)
 	machineCmd.AddCommand(machineMenuButtonCmd)
 
+	addYesFlag(machineRebootCmd, machinePowerOffCmd)
+	addDelayFlags(machineResetCmd, machineRebootCmd, machinePowerOffCmd)
+
 	// Add memory operation commands
 	machineCmd.AddCommand(machineWriteMemCmd)
 	machineCmd.AddCommand(machineWriteMemFileCmd)
 	machineCmd.AddCommand(machineReadMemCmd)
+	machineCmd.AddCommand(machineDiffCmd)
 
 	// Add debug register commands
 	machineCmd.AddCommand(machineDebugRegCmd)
 	machineCmd.AddCommand(machineDebugRegSetCmd)
+	machineCmd.AddCommand(machineScreenshotCmd)
+	machineCmd.AddCommand(machineScreenCmd)
+
+	// Add speed commands
+	machineCmd.AddCommand(machineSpeedCmd)
+	machineSpeedCmd.AddCommand(machineSpeedShowCmd)
+	machineSpeedCmd.Flags().Bool("save", false, "Save the configuration to flash")
+	addPreserveFlags(machineSpeedCmd)
 
 	// Add flags
+	machineResetCmd.Flags().Int("hold-ms", 0, "Keep the machine halted for N ms before the reset")
+	machineResetCmd.Flags().Bool("freeze", false, "Pause the machine right after the reset")
+	machineResetCmd.Flags().String("then-run", "", "Run a PRG/CRT once the machine shows READY.")
+	machineResetCmd.Flags().Duration("ready-timeout", 10*time.Second, "How long to wait for READY. with --then-run")
 	machineReadMemCmd.Flags().Int("length", 256, "Number of bytes to read")
+	machineReadMemCmd.Flags().String("bank", "", "What to read where memory is banked: cpu, ram, rom or io")
+	machineReadMemCmd.Flags().String("port", "", "Bits 0-2 of $01 (0-7) to read with, instead of --bank")
+	machineDiffCmd.Flags().Bool("side-by-side", false, "Show expected and actual bytes side by side")
+	machineDiffCmd.Flags().Int("context", 1, "Number of unchanged rows to show around differences")
+
+	// Page long hexdumps
+	machineReadMemCmd.Annotations = pagedOutput
+	machineDiffCmd.Annotations = pagedOutput
 }
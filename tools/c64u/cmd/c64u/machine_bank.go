@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Banked Memory Reads
+// ============================================================================
+
+// Processor port lines in $01 that select what is seen at $A000-$BFFF,
+// $D000-$DFFF and $E000-$FFFF
+const (
+	portAddress = 0x01
+	portLoram   = 0x01
+	portHiram   = 0x02
+	portCharen  = 0x04
+	portBanking = portLoram | portHiram | portCharen
+)
+
+// memoryBanks are the --bank views as bits 0-2 of $01
+var memoryBanks = map[string]byte{
+	"ram": 0,
+	"rom": portLoram | portHiram,
+	"io":  portLoram | portHiram | portCharen,
+}
+
+// basicProbe is read to tell whether the port change took effect: BASIC
+// ROM is banked in at $A000 only with LORAM and HIRAM
+const basicProbe = 0xA000
+
+// bankFlag returns bits 0-2 of $01 for --bank or --port; false means
+// the CPU's own view
+func bankFlag(cmd *cobra.Command) (byte, bool, error) {
+	bank, _ := cmd.Flags().GetString("bank")
+	port, _ := cmd.Flags().GetString("port")
+	bank = strings.ToLower(bank)
+	switch {
+	case port != "" && bank != "" && bank != "cpu":
+		return 0, false, fmt.Errorf("--bank and --port cannot be combined")
+	case port != "":
+		v, err := strconv.ParseUint(strings.TrimPrefix(port, "$"), 16, 8)
+		if err != nil || v&^portBanking != 0 {
+			return 0, false, fmt.Errorf("--port must be 0-7, bits 0-2 of $01 (LORAM, HIRAM, CHAREN)")
+		}
+		return byte(v), true, nil
+	case bank == "" || bank == "cpu":
+		return 0, false, nil
+	}
+	bits, ok := memoryBanks[bank]
+	if !ok {
+		return 0, false, fmt.Errorf("'%s' is not cpu, ram, rom or io", bank)
+	}
+	return bits, true, nil
+}
+
+// bankDescription names what the CPU sees with bits 0-2 of $01 (without
+// a cartridge)
+func bankDescription(bits byte) string {
+	if bits&(portLoram|portHiram) == 0 {
+		return "RAM everywhere"
+	}
+	parts := []string{"RAM at $A000"}
+	if basicVisible(bits) {
+		parts[0] = "BASIC ROM"
+	}
+	if bits&portCharen != 0 {
+		parts = append(parts, "I/O")
+	} else {
+		parts = append(parts, "character ROM")
+	}
+	if bits&portHiram != 0 {
+		parts = append(parts, "KERNAL ROM")
+	} else {
+		parts = append(parts, "RAM at $E000")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// bankedRead is a read with $01 changed for its duration
+type bankedRead struct {
+	previous byte
+	bits     byte
+	// unchanged is set when $A000 looked the same although the change
+	// should have swapped BASIC ROM and RAM there
+	unchanged bool
+}
+
+// port is the value $01 had during the read
+func (r *bankedRead) port() byte {
+	return r.previous&^portBanking | r.bits
+}
+
+// readBanked pauses the machine, sets bits 0-2 of $01, reads memory and
+// restores $01 and the run state. The machine is resumed before any
+// error is returned.
+func readBanked(address string, length int, bits byte) (*api.Response, *bankedRead, error) {
+	if err := apiStep(apiClient.MachinePause); err != nil {
+		return nil, nil, fmt.Errorf("failed to pause machine: %w", err)
+	}
+	resp, read, err := readWithPort(address, length, bits)
+	if rerr := apiStep(apiClient.MachineResume); rerr != nil && err == nil {
+		err = fmt.Errorf("failed to resume machine: %w", rerr)
+	}
+	return resp, read, err
+}
+
+func readWithPort(address string, length int, bits byte) (*api.Response, *bankedRead, error) {
+	port, err := readMemory(portAddress, 1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read $01: %w", err)
+	}
+	read := &bankedRead{previous: port[0], bits: bits}
+	before, err := readMemory(basicProbe, 16)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeMemory(portAddress, []byte{read.port()}); err != nil {
+		return nil, nil, fmt.Errorf("failed to set $01: %w", err)
+	}
+	resp, err := apiClient.MachineReadMem(address, length)
+	if err == nil && resp.HasErrors() {
+		err = fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+	}
+	after, perr := readMemory(basicProbe, 16)
+	if werr := writeMemory(portAddress, port); werr != nil {
+		return nil, nil, fmt.Errorf("failed to restore $01 to $%02X: %w", port[0], werr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if perr == nil && basicVisible(port[0]) != basicVisible(bits) {
+		read.unchanged = bytes.Equal(before, after)
+	}
+	return resp, read, nil
+}
+
+func basicVisible(bits byte) bool {
+	return bits&portLoram != 0 && bits&portHiram != 0
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Delayed Machine Control
+// ============================================================================
+
+// delayLayouts are the accepted --at formats; the first ones are times of
+// day
+var delayLayouts = []string{"15:04", "15:04:05", "2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02T15:04", time.RFC3339}
+
+// addDelayFlags adds --after and --at to commands
+func addDelayFlags(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		c.Flags().Duration("after", 0, "Wait this long before acting (e.g. 90m, 2h)")
+		c.Flags().String("at", "", "Act at this time (HH:MM or \"YYYY-MM-DD HH:MM\")")
+	}
+}
+
+// delayUntil returns when a command with --after or --at should act; the
+// zero time means now
+func delayUntil(cmd *cobra.Command, now time.Time) (time.Time, error) {
+	after, _ := cmd.Flags().GetDuration("after")
+	at, _ := cmd.Flags().GetString("at")
+	switch {
+	case after != 0 && at != "":
+		return time.Time{}, fmt.Errorf("--after and --at cannot be combined")
+	case after < 0:
+		return time.Time{}, fmt.Errorf("--after must not be negative")
+	case after > 0:
+		return now.Add(after), nil
+	case at == "":
+		return time.Time{}, nil
+	}
+
+	for i, layout := range delayLayouts {
+		t, err := time.ParseInLocation(layout, at, now.Location())
+		if err != nil {
+			continue
+		}
+		if i < 2 {
+			t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, now.Location())
+			if !t.After(now) {
+				t = t.AddDate(0, 0, 1)
+			}
+		} else if !t.After(now) {
+			return time.Time{}, fmt.Errorf("%s is in the past", at)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("'%s' is not a time (HH:MM or \"YYYY-MM-DD HH:MM\")", at)
+}
+
+// waitDelay waits until the time given with --after or --at, reporting
+// what will happen; false means the flags were invalid or the wait was
+// cancelled
+func waitDelay(cmd *cobra.Command, action string) bool {
+	until, err := delayUntil(cmd, time.Now())
+	if err != nil {
+		formatter.Error("Invalid delay", []string{err.Error()})
+		return false
+	}
+	if until.IsZero() {
+		return true
+	}
+
+	wait := time.Until(until).Round(time.Second)
+	formatter.Info(fmt.Sprintf("The machine will %s at %s (in %s); Ctrl-C cancels",
+		action, until.Format("2006-01-02 15:04:05"), formatter.Duration(wait)))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+	select {
+	case <-stop:
+		formatter.Warning(fmt.Sprintf("Cancelled, the machine will not %s", action))
+		return false
+	case <-timer.C:
+		return true
+	}
+}
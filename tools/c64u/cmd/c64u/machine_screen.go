@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/palette"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/screen"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Text Screen in the Terminal
+// ============================================================================
+
+var machineScreenCmd = &cobra.Command{
+	Use:   "screen [--watch [--interval D]] [--no-border] [--legacy-symbols] [--palette FILE]",
+	Short: "Show the C64 text screen in the terminal",
+	Long: `Read screen memory, color RAM and the VIC registers via DMA and draw
+the 40x25 text screen in the terminal, with the border and the VIC-II
+colors. Works on any Ultimate, without a monitor or the video stream.
+
+The screen address and character set come from $DD00 and $D018. The ROM
+sets are shown as Unicode; a custom character set in RAM cannot be, and
+is shown with the uppercase glyphs. PETSCII graphics are drawn with box
+drawing and block elements; --legacy-symbols uses the exact glyphs of
+Unicode's Symbols for Legacy Computing, if the terminal font has them.
+Extended background color mode is followed; in bitmap mode the screen
+memory holds colors, not characters, and the picture is meaningless.
+
+Colors are 24-bit and from Pepto's palette unless --palette gives a VICE
+.vpl file. With --no-color or output that is not a terminal the screen is
+plain text, as with --json.
+
+--watch keeps reading the screen every --interval and redraws the rows
+that changed, until Ctrl-C. Each read is four REST requests; the screen
+may change between them, so a fast-moving screen shows torn frames. When
+piped, the screen is printed again whenever it changes (with --json, one
+JSON object per line).
+
+Examples:
+  c64u machine screen
+  c64u machine screen --legacy-symbols --no-border
+  c64u machine screen --watch --interval 250ms
+  c64u machine screen --no-color > screen.txt`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		watch, _ := cmd.Flags().GetBool("watch")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		noBorder, _ := cmd.Flags().GetBool("no-border")
+		legacy, _ := cmd.Flags().GetBool("legacy-symbols")
+		palettePath, _ := cmd.Flags().GetString("palette")
+
+		if watch && interval < 50*time.Millisecond {
+			formatter.Error("Invalid interval", []string{"--interval must be at least 50ms"})
+			return
+		}
+		pal := palette.Default
+		if palettePath != "" {
+			var err error
+			if pal, err = palette.Load(palettePath); err != nil {
+				formatter.Error("Invalid palette file", []string{err.Error()})
+				return
+			}
+		}
+
+		s, err := readTextScreen(legacy)
+		if err != nil {
+			formatter.Error("Failed to read the screen", []string{err.Error()})
+			return
+		}
+		colored := !noColor && output.IsTerminal(os.Stdout)
+		if watch {
+			watchScreen(s, interval, pal, colored, !noBorder)
+			return
+		}
+
+		if jsonOut {
+			formatter.PrintData(s.data())
+			return
+		}
+		if colored {
+			fmt.Println(strings.Join(s.render(pal, !noBorder), "\n"))
+		} else {
+			fmt.Println(strings.Join(s.lines(), "\n"))
+		}
+		if note := s.note(); note != "" {
+			formatter.Warning(note)
+		}
+	},
+}
+
+// textScreen is a snapshot of the text screen with its colors
+type textScreen struct {
+	base, charAddr int
+	charset, mode  string
+	codes, colors  []byte
+	border         byte
+	// background holds $D021-$D024; all but the first are only used in
+	// extended background color mode
+	background [4]byte
+	ecm        bool
+	legacy     bool
+}
+
+// readTextScreen reads the VIC registers, screen memory and color RAM
+func readTextScreen(legacy bool) (*textScreen, error) {
+	// $D011-$D024 holds the mode, $D018 and the border and background colors
+	vic, err := readMemory(0xD011, 0x14)
+	if err != nil {
+		return nil, fmt.Errorf("VIC registers: %w", err)
+	}
+	cia, err := readMemory(0xDD00, 1)
+	if err != nil {
+		return nil, fmt.Errorf("$DD00: %w", err)
+	}
+	s := &textScreen{
+		base:       screen.BaseFrom(cia[0], vic[0x07]),
+		border:     vic[0x0F] & 0x0F,
+		background: [4]byte{vic[0x10] & 0x0F, vic[0x11] & 0x0F, vic[0x12] & 0x0F, vic[0x13] & 0x0F},
+		ecm:        vic[0x00]&0x40 != 0,
+		legacy:     legacy,
+		mode:       "text",
+	}
+	s.charAddr, s.charset = screen.CharsetFrom(cia[0], vic[0x07])
+	switch {
+	case vic[0x00]&0x20 != 0:
+		s.mode = "bitmap"
+	case s.ecm:
+		s.mode = "extended-color"
+	case vic[0x05]&0x10 != 0:
+		s.mode = "multicolor"
+	}
+	if s.codes, err = readMemory(s.base, screen.Size); err != nil {
+		return nil, fmt.Errorf("screen memory: %w", err)
+	}
+	if s.colors, err = readMemory(0xD800, screen.Size); err != nil {
+		return nil, fmt.Errorf("color RAM: %w", err)
+	}
+	return s, nil
+}
+
+// data returns the screen for JSON output
+func (s *textScreen) data() map[string]interface{} {
+	return map[string]interface{}{
+		"address":         fmt.Sprintf("$%04X", s.base),
+		"charset":         s.charset,
+		"charset_address": fmt.Sprintf("$%04X", s.charAddr),
+		"mode":            s.mode,
+		"border":          s.border,
+		"background":      s.background[0],
+		"lines":           s.lines(),
+	}
+}
+
+// note explains why the screen may not look as on the C64
+func (s *textScreen) note() string {
+	switch {
+	case s.mode == "bitmap":
+		return "The VIC is in bitmap mode; screen memory holds colors, not characters"
+	case s.charset == screen.Custom:
+		return fmt.Sprintf("Custom character set at $%04X, shown with the uppercase glyphs", s.charAddr)
+	}
+	return ""
+}
+
+// cell returns the glyph and the colors of a screen position
+func (s *textScreen) cell(i int) (glyph rune, fg, bg byte) {
+	code := s.codes[i]
+	fg, bg = s.colors[i]&0x0F, s.background[0]
+	if s.ecm {
+		// The top two bits choose the background; there is no reverse
+		bg = s.background[code>>6]
+		code &= 0x3F
+	} else if code&0x80 != 0 {
+		fg, bg = bg, fg
+	}
+	return screen.Glyph(code, s.charset == screen.Lowercase, s.legacy), fg, bg
+}
+
+// lines returns the screen as text, one string per row with trailing
+// spaces removed
+func (s *textScreen) lines() []string {
+	lines := make([]string, screen.Rows)
+	for row := range lines {
+		var b strings.Builder
+		for col := 0; col < screen.Columns; col++ {
+			glyph, _, _ := s.cell(row*screen.Columns + col)
+			b.WriteRune(glyph)
+		}
+		lines[row] = strings.TrimRight(b.String(), " ")
+	}
+	return lines
+}
+
+// render returns the rows of the screen with 24-bit ANSI colors, with a
+// border of two columns and one row around it
+func (s *textScreen) render(pal *palette.Palette, border bool) []string {
+	var b strings.Builder
+	setColors := func(fg, bg byte) {
+		f, k := pal.Colors[fg], pal.Colors[bg]
+		fmt.Fprintf(&b, "\033[38;2;%d;%d;%dm\033[48;2;%d;%d;%dm", f.R, f.G, f.B, k.R, k.G, k.B)
+	}
+	var rows []string
+	endRow := func() {
+		b.WriteString("\033[0m")
+		rows = append(rows, b.String())
+		b.Reset()
+	}
+
+	if border {
+		setColors(s.border, s.border)
+		b.WriteString(strings.Repeat(" ", screen.Columns+4))
+		endRow()
+	}
+	for row := 0; row < screen.Rows; row++ {
+		if border {
+			setColors(s.border, s.border)
+			b.WriteString("  ")
+		}
+		last := -1
+		for col := 0; col < screen.Columns; col++ {
+			glyph, fg, bg := s.cell(row*screen.Columns + col)
+			if c := int(fg)<<4 | int(bg); c != last {
+				setColors(fg, bg)
+				last = c
+			}
+			b.WriteRune(glyph)
+		}
+		if border {
+			setColors(s.border, s.border)
+			b.WriteString("  ")
+		}
+		endRow()
+	}
+	if border {
+		rows = append(rows, rows[0])
+	}
+	return rows
+}
+
+// watchScreen redraws the screen every interval until Ctrl-C. On a
+// terminal only rows that changed are rewritten, in the alternate screen;
+// otherwise the screen is printed again when it changes.
+func watchScreen(s *textScreen, interval time.Duration, pal *palette.Palette, colored, border bool) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	if jsonOut || !output.IsTerminal(os.Stdout) {
+		last := ""
+		for {
+			var text string
+			if jsonOut {
+				data, _ := json.Marshal(s.data())
+				text = string(data)
+			} else {
+				text = strings.Join(s.lines(), "\n") + "\n"
+			}
+			if text != last {
+				fmt.Println(text)
+				last = text
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			// Keep the last screen; the device may be rebooting
+			if next, err := readTextScreen(s.legacy); err == nil {
+				s = next
+			}
+		}
+	}
+
+	restore := func() { fmt.Print("\033[0m\033[?25h\033[?1049l") }
+	defer restore()
+	output.OnExit(func(int) { restore() })
+	fmt.Print("\033[?1049h\033[?25l\033[H\033[2J")
+
+	var shown []string
+	status, shownStatus := "", "\x00"
+	for {
+		rows := s.lines()
+		if colored {
+			rows = s.render(pal, border)
+		}
+		var b strings.Builder
+		for i, row := range rows {
+			if i >= len(shown) || shown[i] != row {
+				fmt.Fprintf(&b, "\033[%d;1H%s\033[K", i+1, row)
+			}
+		}
+		if note := s.note(); status == "" && note != "" {
+			status = note
+		}
+		if status != shownStatus {
+			fmt.Fprintf(&b, "\033[%d;1H\033[K%s", len(rows)+2, status)
+			shownStatus = status
+		}
+		os.Stdout.WriteString(b.String())
+		shown = rows
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		next, err := readTextScreen(s.legacy)
+		if err != nil {
+			status = fmt.Sprintf("Read failed, retrying: %v", err)
+			continue
+		}
+		s, status = next, ""
+	}
+}
+
+func init() {
+	machineScreenCmd.Flags().Bool("watch", false, "Keep redrawing the screen until Ctrl-C")
+	machineScreenCmd.Flags().Duration("interval", 500*time.Millisecond, "Refresh interval with --watch")
+	machineScreenCmd.Flags().Bool("no-border", false, "Leave out the border")
+	machineScreenCmd.Flags().Bool("legacy-symbols", false, "Use Unicode's Symbols for Legacy Computing for PETSCII graphics")
+	machineScreenCmd.Flags().String("palette", "", "VICE palette (.vpl) file for the colors")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/png"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/palette"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/vicstream"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Screenshot (U64 only)
+// ============================================================================
+
+var machineScreenshotCmd = &cobra.Command{
+	Use:   "screenshot <out.png> [ip] [--after-frames N] [--pause]",
+	Short: "Save a frame of the video stream as PNG (U64 only)",
+	Long: `Start the video stream, save one complete frame as PNG and stop the
+stream again. The picture is the full 384x272 (PAL) frame with borders,
+the size of a VICE screenshot with normal borders, as an indexed PNG of
+the 16 VIC-II colors, so it can be compared pixel by pixel.
+
+--after-frames N saves the frame N frames after the first complete one
+received. Frames are counted by their number in the stream, so a frame
+lost on the network does not shift the count; the next complete frame is
+taken instead and its offset reported.
+
+--pause halts the CPU (DMA) before the stream starts and resumes it after
+the capture. The VIC keeps drawing, but nothing changes the screen, so
+every frame is the same and the picture does not depend on timing; use it
+for comparisons. Raster effects freeze with the register values of the
+moment the CPU stopped.
+
+There is no --at-raster: the stream only delivers whole frames, a pause
+takes effect at whatever raster line the CPU is on when the HTTP request
+arrives, milliseconds late against the 64 µs of a line, and neither the
+REST API nor the debug register $D7FF can choose or report that line.
+
+The destination is chosen as for "streams start". The colors are
+Pepto's palette unless --palette gives a VICE .vpl file.
+
+Examples:
+  c64u machine screenshot title.png
+  c64u machine screenshot ref.png --pause
+  c64u machine screenshot intro.png --after-frames 250 --palette colodore.vpl`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		afterFrames, _ := cmd.Flags().GetInt("after-frames")
+		pause, _ := cmd.Flags().GetBool("pause")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		palettePath, _ := cmd.Flags().GetString("palette")
+		streamPort := streamPorts["video"]
+
+		if afterFrames < 0 || afterFrames > 0x7FFF {
+			formatter.Error("Invalid frame count", []string{"--after-frames must be between 0 and 32767"})
+			return
+		}
+
+		pal := palette.Default
+		if palettePath != "" {
+			var err error
+			if pal, err = palette.Load(palettePath); err != nil {
+				formatter.Error("Invalid palette file", []string{err.Error()})
+				return
+			}
+		}
+
+		ip, err := streamDestination(cmd, args[1:])
+		if err != nil {
+			formatter.Error("Cannot determine the stream destination", []string{
+				err.Error(),
+				"Give the destination IP address as argument",
+			})
+			return
+		}
+
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: streamPort})
+		if err != nil {
+			formatter.Error(fmt.Sprintf("Cannot listen on UDP port %d", streamPort), []string{
+				err.Error(),
+				"Another program (e.g. a stream viewer) may already use the port; close it and retry",
+			})
+			return
+		}
+		defer conn.Close()
+
+		if err := loopbackProbe(conn, streamPort); err != nil {
+			formatter.Error("Loopback probe failed", []string{err.Error()})
+			return
+		}
+
+		if pause {
+			if !machineStep("pause machine", apiClient.MachinePause) {
+				return
+			}
+		}
+		// formatter.Error exits, so the machine is resumed before any error
+		frame, offset, err := captureFrame(conn, ip, afterFrames, timeout)
+		if pause {
+			if resp, rerr := apiClient.MachineResume(); rerr != nil {
+				formatter.Warning(fmt.Sprintf("Failed to resume machine: %v", rerr))
+			} else if resp.HasErrors() {
+				formatter.Warning(fmt.Sprintf("Failed to resume machine: %v", resp.Errors))
+			}
+		}
+		if errors.Is(err, errNoFrame) {
+			formatter.Error(err.Error(), streamFirewallHints(ip, streamPort))
+			return
+		} else if err != nil {
+			formatter.Error("Screenshot failed", []string{err.Error()})
+			return
+		}
+
+		f, err := os.Create(args[0])
+		if err != nil {
+			formatter.Error("Failed to save screenshot", []string{err.Error()})
+			return
+		}
+		err = png.Encode(f, frame.Image(pal))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			formatter.Error("Failed to save screenshot", []string{err.Error()})
+			return
+		}
+
+		formatter.Success("Screenshot saved", map[string]interface{}{
+			"file":         args[0],
+			"size":         fmt.Sprintf("%dx%d", frame.Width, frame.Height),
+			"frame":        frame.Number,
+			"after_frames": offset,
+			"palette":      pal.Name,
+		})
+	},
+}
+
+// errNoFrame is returned by captureFrame when not a single frame arrives
+var errNoFrame = errors.New("no complete video frame received")
+
+// captureFrame runs the video stream until the complete frame at least
+// afterFrames after the first complete one; offset is its distance from
+// the first
+func captureFrame(conn *net.UDPConn, ip string, afterFrames int, timeout time.Duration) (frame *vicstream.Frame, offset int, err error) {
+	resp, err := apiClient.StreamsStart("video", ip)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to start stream: %w", err)
+	}
+	if resp.HasErrors() {
+		return nil, 0, fmt.Errorf("failed to start stream: %s", strings.Join(resp.Errors, "; "))
+	}
+	defer func() {
+		if resp, err := apiClient.StreamsStop("video"); err != nil {
+			formatter.Warning(fmt.Sprintf("Failed to stop stream: %v", err))
+		} else if resp.HasErrors() {
+			formatter.Warning(fmt.Sprintf("Failed to stop stream: %v", resp.Errors))
+		}
+	}()
+
+	// A PAL frame is 68 packets, sent within 20 ms
+	conn.SetReadBuffer(1 << 20)
+	var asm vicstream.Assembler
+	var first *vicstream.Frame
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		// ParsePacket keeps referring to the buffer, so each read gets its own
+		buf := make([]byte, 2048)
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if first == nil {
+				return nil, 0, fmt.Errorf("%w within %s", errNoFrame, timeout)
+			}
+			return nil, 0, fmt.Errorf("the stream stopped before frame %d after the first", afterFrames)
+		}
+		p, err := vicstream.ParsePacket(buf[:n])
+		if err != nil {
+			continue
+		}
+		f := asm.Add(p)
+		if f == nil {
+			continue
+		}
+		if first == nil {
+			first = f
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		// Frame numbers wrap at 16 bits
+		if offset := int(f.Number - first.Number); offset >= afterFrames {
+			return f, offset, nil
+		}
+	}
+}
+
+func init() {
+	machineScreenshotCmd.Flags().Int("after-frames", 0, "Save the frame N frames after the first complete one")
+	machineScreenshotCmd.Flags().Bool("pause", false, "Halt the CPU during the capture for a static picture")
+	machineScreenshotCmd.Flags().Duration("timeout", 5*time.Second, "How long to wait for each complete frame")
+	machineScreenshotCmd.Flags().String("palette", "", "VICE palette (.vpl) file for the PNG colors")
+	machineScreenshotCmd.Flags().String("interface", "", "Receive on the address of this network interface")
+}
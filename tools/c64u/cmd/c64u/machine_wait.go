@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/screen"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Waiting for Screen Text
+// ============================================================================
+
+var machineWaitForTextCmd = &cobra.Command{
+	Use:   "wait-for-text <text> [--timeout D] [--interval D] [--gone]",
+	Short: "Wait until text appears on the C64 screen",
+	Long: `Poll screen memory via DMA until the text appears anywhere on the
+screen, e.g. READY. after a reset or a program's "PASSED" message. Exits
+with status 0 once it is found and 1 when --timeout elapses first, so CI
+scripts can wait for a program before checking its results.
+
+The text is compared without regard to case, as the screen shows letters
+in the C64's uppercase; a match does not continue across rows. With
+--gone it waits until the text is no longer on the screen instead.
+
+Reads that fail, e.g. while the machine reboots, are retried until the
+timeout. On a timeout the last screen read is printed to stderr (not with
+--json).
+
+Examples:
+  c64u machine reset && c64u machine wait-for-text READY.
+  c64u runners run-prg-upload test.prg && c64u machine wait-for-text "ALL TESTS PASSED" --timeout 2m
+  c64u machine wait-for-text "LOADING" --gone --timeout 1m`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		text := args[0]
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		gone, _ := cmd.Flags().GetBool("gone")
+
+		if text == "" {
+			formatter.Error("Nothing to wait for", []string{"give the text to look for"})
+			return
+		}
+		if interval <= 0 || timeout <= 0 {
+			formatter.Error("Invalid duration", []string{"--timeout and --interval must be positive"})
+			return
+		}
+
+		start := time.Now()
+		deadline := start.Add(timeout)
+		var last *screen.Screen
+		var lastErr error
+		for {
+			s, err := screen.Read(apiClient)
+			if err == nil {
+				last, lastErr = s, nil
+				row, col, found := s.Find(text)
+				if found != gone {
+					data := map[string]interface{}{
+						"text":  text,
+						"after": formatter.Duration(time.Since(start)),
+					}
+					if found {
+						data["row"] = row
+						data["column"] = col
+					}
+					msg := fmt.Sprintf("'%s' appeared on the screen", text)
+					if gone {
+						msg = fmt.Sprintf("'%s' is gone from the screen", text)
+					}
+					formatter.Success(msg, data)
+					return
+				}
+			} else {
+				lastErr = err
+			}
+			if time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(min(interval, time.Until(deadline)+time.Millisecond))
+		}
+
+		state := "appear"
+		if gone {
+			state = "disappear"
+		}
+		details := []string{fmt.Sprintf("'%s' did not %s within %s", text, state, timeout)}
+		if lastErr != nil {
+			details = append(details, "last read failed: "+lastErr.Error())
+		}
+		// The screen shows what the program did instead, e.g. in a CI log
+		if last != nil && !jsonOut {
+			fmt.Fprintln(os.Stderr, "Screen at the timeout:")
+			for _, line := range trimScreen(last.Lines()) {
+				fmt.Fprintln(os.Stderr, "  | "+line)
+			}
+		}
+		formatter.Error("Timed out waiting for the screen", details)
+	},
+}
+
+func init() {
+	machineCmd.AddCommand(machineWaitForTextCmd)
+	machineWaitForTextCmd.Flags().Duration("timeout", 30*time.Second, "How long to wait")
+	machineWaitForTextCmd.Flags().Duration("interval", 250*time.Millisecond, "How often to read the screen")
+	machineWaitForTextCmd.Flags().Bool("gone", false, "Wait until the text is no longer on the screen")
+}
+
+// trimScreen drops the empty rows at the end of a screen
+func trimScreen(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
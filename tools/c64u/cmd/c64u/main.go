@@ -3,10 +3,14 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
 	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/lock"
 	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/transcript"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -19,12 +23,33 @@ var (
 	date    = "unknown"
 
 	// Global flags
-	cfgFile string
-	host    string
-	port    int
-	verbose bool
-	jsonOut bool
-	noColor bool
+	cfgFile         string
+	host            string
+	port            int
+	verbose         bool
+	jsonOut         bool
+	noColor         bool
+	wait            bool
+	noWait          bool
+	maxRPS          float64
+	theme           string
+	bytesOut        bool
+	noPager         bool
+	compressUploads bool
+	rawOut          bool
+	ftpPort         int
+	telnetPort      int
+	readOnly        bool
+	waitBusy        time.Duration
+
+	transcriptFile string
+
+	// Settings only available in the config file
+	uploadHistory  bool
+	remoteCache    bool
+	remoteCacheDir string
+	assumeYes      bool
+	statsEnabled   bool
 
 	// Global instances
 	apiClient *api.Client
@@ -67,6 +92,20 @@ Configuration Priority:
 			port = cfg.Port
 		}
 
+		ftpPort = cfg.FTPPort
+		telnetPort = cfg.TelnetPort
+		uploadHistory = cfg.UploadHistory
+		remoteCache = cfg.RemoteCache
+		remoteCacheDir = cfg.RemoteCacheDir
+		assumeYes = cfg.AssumeYes
+		statsEnabled = cfg.Stats
+
+		if cmd.Flags().Changed("read-only") {
+			cfg.ReadOnly = readOnly
+		} else {
+			readOnly = cfg.ReadOnly
+		}
+
 		if cmd.Flags().Changed("verbose") {
 			cfg.Verbose = verbose
 		} else {
@@ -79,41 +118,126 @@ Configuration Priority:
 			jsonOut = cfg.JSON
 		}
 
+		if cmd.Flags().Changed("max-rps") {
+			cfg.MaxRPS = maxRPS
+		}
+
+		if cmd.Flags().Changed("theme") {
+			cfg.Theme = theme
+		}
+		applyColorSettings(cfg)
+
+		if cmd.Flags().Changed("transcript") {
+			cfg.Transcript = transcriptFile
+		}
+
 		// Initialize global instances
 		apiClient = api.NewClient(cfg.Host, cfg.Port, cfg.Verbose)
+		apiClient.Locker = newDeviceLock(cfg)
+		apiClient.ReadOnly = cfg.ReadOnly
+		apiClient.SetRateLimit(cfg.MaxRPS, cfg.Burst, cfg.MinInterval)
+		apiClient.Compression = cfg.Compression
+		apiClient.BusyWait = cfg.BusyWait
+		if cmd.Flags().Changed("wait-busy") {
+			apiClient.BusyWait = waitBusy
+		}
+		apiClient.CompressUploads = cfg.CompressUploads || compressUploads
 		formatter = output.NewFormatter(cfg.JSON)
 		formatter.SetNoColor(noColor)
-	},
-}
+		formatter.SetUnits(bytesOut, rawOut)
 
-// versionCmd represents the version command
-var versionCmd = &cobra.Command{
-	Use:   "version",
-	Short: "Show version information",
-	Long:  `Display the version, build commit, and build date of the c64u CLI tool.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		if jsonOut {
-			data := map[string]interface{}{
-				"version": version,
-				"commit":  commit,
-				"date":    date,
+		if cfg.Transcript != "" {
+			startTranscript(cmd, args, cfg)
+		}
+		startStats(cmd)
+
+		if cmd.Annotations[annotationPager] == "true" && !cfg.JSON && !noPager {
+			if err := output.StartPager(output.PagerCommand(cfg.Pager)); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 			}
-			formatter.PrintData(data)
-		} else {
-			fmt.Printf("c64u version %s\n", version)
-			fmt.Printf("  commit: %s\n", commit)
-			fmt.Printf("  built:  %s\n", date)
 		}
 	},
 }
 
+// annotationPager marks commands whose output is piped through the pager
+const annotationPager = "c64u-pager"
+
+// pagedOutput is the annotation set for commands with potentially long output
+var pagedOutput = map[string]string{annotationPager: "true"}
+
+// applyColorSettings honors NO_COLOR and applies the configured color theme
+func applyColorSettings(cfg *config.Config) {
+	if output.NoColorEnv() {
+		noColor = true
+	}
+
+	custom := make(map[string]output.Theme)
+	for name, colors := range cfg.Themes {
+		t, err := output.ThemeFromMap(colors)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: theme '%s': %v\n", name, err)
+			continue
+		}
+		custom[name] = t
+	}
+
+	t, err := output.LookupTheme(cfg.Theme, custom)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+	output.ApplyTheme(t)
+}
+
+// startTranscript opens the transcript file, records the command being run
+// and attaches the transcript to the API client for per-request entries
+func startTranscript(cmd *cobra.Command, args []string, cfg *config.Config) {
+	t, err := transcript.Open(cfg.Transcript)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+
+	flags := make(map[string]string)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	t.Command(cmd.CommandPath(), args, flags, fmt.Sprintf("%s:%d", cfg.Host, cfg.Port))
+	apiClient.Recorder = t
+
+	output.OnExit(func(code int) {
+		t.Close(code)
+	})
+}
+
+// newDeviceLock creates the lock that serializes state-changing requests
+// from concurrent c64u processes targeting the same device
+func newDeviceLock(cfg *config.Config) *lock.Lock {
+	lockDir := os.TempDir()
+	if configDir := config.GetConfigDir(); configDir != "" {
+		lockDir = filepath.Join(configDir, "locks")
+	}
+
+	deviceLock := lock.New(lockDir, cfg.Host, cfg.Port)
+	switch {
+	case noWait:
+		deviceLock.Wait = 0
+	case wait:
+		deviceLock.Wait = -1
+	default:
+		deviceLock.Wait = cfg.LockWait
+	}
+	return deviceLock
+}
+
 // aboutCmd gets the API version from the C64 Ultimate
 var aboutCmd = &cobra.Command{
 	Use:   "about",
 	Short: "Get C64 Ultimate API version",
 	Long:  `Query the C64 Ultimate to retrieve its REST API version (calls /v1/version).`,
 	Run: func(cmd *cobra.Command, args []string) {
-		resp, err := apiClient.Get("/v1/version", nil)
+		resp, err := apiClient.Endpoints().Version()
 		if err != nil {
 			formatter.Error("Failed to get API version", []string{err.Error()})
 			return
@@ -229,6 +353,7 @@ var configShowCmd = &cobra.Command{
 			"host":    cfg.Host,
 			"port":    cfg.Port,
 			"verbose": cfg.Verbose,
+			"theme":   cfg.Theme,
 		}
 
 		configPath := config.GetConfigPath()
@@ -243,6 +368,7 @@ var configShowCmd = &cobra.Command{
 			fmt.Printf("  Host:        %s\n", cfg.Host)
 			fmt.Printf("  Port:        %d\n", cfg.Port)
 			fmt.Printf("  Verbose:     %v\n", cfg.Verbose)
+			fmt.Printf("  Theme:       %s\n", cfg.Theme)
 			if configPath != "" {
 				fmt.Printf("  Config File: %s\n", configPath)
 			}
@@ -250,25 +376,67 @@ var configShowCmd = &cobra.Command{
 	},
 }
 
+// configThemesCmd lists available color themes
+var configThemesCmd = &cobra.Command{
+	Use:   "themes",
+	Short: "List available color themes",
+	Long:  `List the built-in color themes and any custom themes defined in config.toml.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load()
+		if err != nil {
+			formatter.Error("Failed to load config", []string{err.Error()})
+			return
+		}
+
+		custom := make(map[string]output.Theme)
+		for name := range cfg.Themes {
+			custom[name] = output.Theme{}
+		}
+
+		var rows [][]string
+		for _, name := range output.ThemeNames(custom) {
+			kind := "built-in"
+			if _, ok := cfg.Themes[name]; ok {
+				kind = "custom"
+			}
+			active := ""
+			if name == cfg.Theme {
+				active = "*"
+			}
+			rows = append(rows, []string{name, kind, active})
+		}
+		formatter.PrintTable([]string{"theme", "kind", "active"}, rows)
+	},
+}
+
 // setupColoredHelp configures Cobra to use colored output in help text
 func setupColoredHelp() {
-	// Import lipgloss for colored help
-	titleStyle := output.NewFormatter(false).GetTitleStyle()
-	sectionStyle := output.NewFormatter(false).GetSectionStyle()
-	commandStyle := output.NewFormatter(false).GetCommandStyle()
-	flagStyle := output.NewFormatter(false).GetFlagStyle()
-
 	// Store default help function
 	defaultHelpFunc := rootCmd.HelpFunc()
 
 	// Custom help template with colors
 	rootCmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		// Help runs without PersistentPreRun, so apply the theme here
+		if cfg, err := config.Load(); err == nil {
+			if cmd.Flags().Changed("theme") {
+				cfg.Theme = theme
+			}
+			applyColorSettings(cfg)
+		} else if output.NoColorEnv() {
+			noColor = true
+		}
+
 		// Check if colors should be disabled
 		if noColor {
 			defaultHelpFunc(cmd, args)
 			return
 		}
 
+		titleStyle := output.NewFormatter(false).GetTitleStyle()
+		sectionStyle := output.NewFormatter(false).GetSectionStyle()
+		commandStyle := output.NewFormatter(false).GetCommandStyle()
+		flagStyle := output.NewFormatter(false).GetFlagStyle()
+
 		fmt.Println(titleStyle.Render(cmd.Short))
 		if cmd.Long != "" {
 			fmt.Println()
@@ -324,6 +492,18 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "Enable verbose output")
 	rootCmd.PersistentFlags().BoolVar(&jsonOut, "json", false, "Output in JSON format")
 	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output")
+	rootCmd.PersistentFlags().BoolVar(&wait, "wait", false, "Wait indefinitely if another c64u process is using the device")
+	rootCmd.PersistentFlags().BoolVar(&noWait, "no-wait", false, "Fail immediately if another c64u process is using the device")
+	rootCmd.PersistentFlags().Float64Var(&maxRPS, "max-rps", 0, "Maximum requests per second sent to the device (default 10 from max_rps in config.toml; 0 = unlimited)")
+	rootCmd.PersistentFlags().BoolVar(&bytesOut, "bytes", false, "Show sizes as exact byte counts")
+	rootCmd.PersistentFlags().BoolVar(&rawOut, "raw", false, "Show sizes and durations as plain numbers (bytes, seconds)")
+	rootCmd.PersistentFlags().DurationVar(&waitBusy, "wait-busy", 0, "Retry while the device is busy, up to this long (default 60s if given)")
+	rootCmd.PersistentFlags().Lookup("wait-busy").NoOptDefVal = "60s"
+	rootCmd.PersistentFlags().BoolVar(&compressUploads, "compress-uploads", false, "Gzip compressible uploads (needs firmware support)")
+	rootCmd.PersistentFlags().BoolVar(&noPager, "no-pager", false, "Do not pipe long output through a pager")
+	rootCmd.PersistentFlags().StringVar(&theme, "theme", "", "Color theme (default, c64, light or a custom theme)")
+	rootCmd.PersistentFlags().BoolVar(&readOnly, "read-only", false, "Refuse all commands that change the device state")
+	rootCmd.PersistentFlags().StringVar(&transcriptFile, "transcript", "", "Append a transcript of commands and requests to this file")
 
 	// Bind flags to viper
 	viper.BindPFlag("host", rootCmd.PersistentFlags().Lookup("host"))
@@ -334,6 +514,7 @@ func init() {
 
 	// Add commands
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(bugreportCmd)
 	rootCmd.AddCommand(aboutCmd)
 	rootCmd.AddCommand(infoCmd)
 	rootCmd.AddCommand(configCmd)
@@ -342,15 +523,46 @@ func init() {
 	rootCmd.AddCommand(drivesCmd)
 	rootCmd.AddCommand(streamsCmd)
 	rootCmd.AddCommand(filesCmd)
+	rootCmd.AddCommand(powerCmd)
+	rootCmd.AddCommand(scheduleCmd)
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(execCmd)
+	rootCmd.AddCommand(keysCmd)
+	rootCmd.AddCommand(inputCmd)
+	rootCmd.AddCommand(xcheckCmd)
+	rootCmd.AddCommand(testCmd)
+	rootCmd.AddCommand(gameCmd)
+	rootCmd.AddCommand(stateCmd)
+	rootCmd.AddCommand(dirCmd)
+	rootCmd.AddCommand(printerCmd)
+	rootCmd.AddCommand(modemCmd)
+	rootCmd.AddCommand(videoCmd)
+	rootCmd.AddCommand(audioCmd)
+	rootCmd.AddCommand(sidCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(sidplayCmd)
+	rootCmd.AddCommand(prgCmd)
+	rootCmd.AddCommand(convertCmd)
+	rootCmd.AddCommand(menuCmd)
+	rootCmd.AddCommand(d64Cmd)
+	rootCmd.AddCommand(g64Cmd)
+	rootCmd.AddCommand(consoleCmd)
+	rootCmd.AddCommand(overlayCmd)
+	rootCmd.AddCommand(mqttCmd)
+	rootCmd.AddCommand(tuiCmd)
+	rootCmd.AddCommand(statsCmd)
 
 	// Config subcommands
 	configCmd.AddCommand(configInitCmd)
 	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configThemesCmd)
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		output.Exit(1)
 	}
+	output.Exit(0)
 }
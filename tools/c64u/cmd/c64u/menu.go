@@ -0,0 +1,349 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/basic"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+// menuPage is the number of programs the menu shows at once (keys A-R)
+const menuPage = 18
+
+// maxMenuDisks keeps the disk numbers in the menu to two digits
+const maxMenuDisks = 99
+
+// menuCmd represents the menu command group
+var menuCmd = &cobra.Command{
+	Use:   "menu",
+	Short: "Build launcher disks",
+	Long:  `Build disk images with a selector menu for a collection of programs.`,
+}
+
+// menuEntry is a program on a launcher disk
+type menuEntry struct {
+	Source string `json:"source"`
+	Name   []byte `json:"-"`
+	Label  string `json:"name"`
+	Disk   int    `json:"disk"`
+	// Sys is the address started after loading, 0 for programs started
+	// with RUN
+	Sys int `json:"sys,omitempty"`
+}
+
+var menuBuildCmd = &cobra.Command{
+	Use:   "build <dir> [--output menu.d64] [--title TEXT] [--yes]",
+	Short: "Turn a folder of PRGs into launcher disks with a menu",
+	Long: `Put every .prg below a directory onto disk images together with a BASIC
+selector menu, stored as the first file so that LOAD"*",8 and RUN start it.
+
+The menu lists the programs 18 at a time: a letter starts one, + and -
+page. Programs are loaded with ",8,1" and started with RUN, or with SYS at
+their load address if they are machine code without a BASIC stub. When
+the programs do not fit one image, more are created (menu-1.d64,
+menu-2.d64, ...), each with the same menu, which asks for the right disk.
+
+File names are made from the PRG names in upper case. Names longer than
+16 characters are truncated, or with --long-names squeeze first lose
+vowels and spaces (--long-names error refuses them); names that end up
+equal get " 2", " 3" and so on, or [filenames] unique_suffix from
+config.toml. The table shows which file got which name. The image format follows the extension of --output (d64,
+d71 or d81). Existing images are replaced after confirmation.
+
+Examples:
+  c64u menu build ~/c64/games -o games.d64
+  c64u menu build demos/ -o demos.d81 --title "PARTY DEMOS"`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("output")
+		title, _ := cmd.Flags().GetString("title")
+		root := args[0]
+		if title == "" {
+			abs, _ := filepath.Abs(root)
+			title = filepath.Base(abs)
+		}
+		format, err := diskimage.ParseFormat(filepath.Ext(out))
+		if err != nil || format == diskimage.DNP {
+			formatter.Error("Invalid output image", []string{"use a .d64, .d71 or .d81 file name"})
+			return
+		}
+
+		names, ok := imageNameShortener(cmd)
+		if !ok {
+			return
+		}
+		entries, data, skipped, shortened, err := collectMenuPrograms(root, names)
+		if errors.Is(err, diskimage.ErrNameTooLong) {
+			formatter.Error("File name too long", []string{err.Error(), "Rename the file, or use --long-names truncate or squeeze"})
+			return
+		} else if err != nil {
+			formatter.Error("Cannot read programs", []string{err.Error()})
+			return
+		}
+		for _, s := range skipped {
+			formatter.Warning("Skipped " + s)
+		}
+		if shortened > 0 && !jsonOut {
+			formatter.Warning(fmt.Sprintf("Shortened %s to 16 characters; the table lists their sources", plural(shortened, "name")))
+		}
+		if len(entries) == 0 {
+			formatter.Error("No programs found", []string{"put .prg files in " + root})
+			return
+		}
+
+		images, err := packMenuDisks(format, menuTitle(title), entries, data)
+		if err != nil {
+			formatter.Error("Cannot build the disks", []string{err.Error()})
+			return
+		}
+		paths := []string{out}
+		if len(images) > 1 {
+			base := strings.TrimSuffix(out, filepath.Ext(out))
+			paths = paths[:0]
+			for i := range images {
+				paths = append(paths, fmt.Sprintf("%s-%d%s", base, i+1, filepath.Ext(out)))
+			}
+		}
+		for _, p := range paths {
+			if _, err := os.Stat(p); err == nil {
+				if !confirmCmd(cmd, fmt.Sprintf("Replace %s?", p)) {
+					return
+				}
+			}
+		}
+		for i, img := range images {
+			if err := img.Save(paths[i]); err != nil {
+				formatter.Error("Cannot write disk image", []string{err.Error()})
+				return
+			}
+		}
+
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{"images": paths, "programs": entries})
+			return
+		}
+		rows := make([][]string, 0, len(entries))
+		for _, e := range entries {
+			start := "RUN"
+			if e.Sys != 0 {
+				start = "SYS " + strconv.Itoa(e.Sys)
+			}
+			rows = append(rows, []string{e.Label, filepath.Base(paths[e.Disk-1]), start, e.Source})
+		}
+		formatter.PrintTable([]string{"name", "image", "start", "source"}, rows)
+		formatter.Success(fmt.Sprintf("Built %s with %s", plural(len(images), "disk"), plural(len(entries), "program")),
+			map[string]interface{}{"images": strings.Join(paths, ", ")})
+	},
+}
+
+// collectMenuPrograms reads the PRGs below root in path order and names
+// them for the disk. skipped describes the files left out, shortened
+// counts the names cut to 16 characters.
+func collectMenuPrograms(root string, names *diskimage.Shortener) (entries []menuEntry, data [][]byte, skipped []string, shortened int, err error) {
+	var paths []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && strings.EqualFold(filepath.Ext(p), ".prg") {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+	sort.Strings(paths)
+
+	// The menu itself is always the first file; names without any
+	// character the menu can show become " 2" and so on
+	names.Reserve([]byte("MENU"))
+	names.Reserve(nil)
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, nil, nil, 0, err
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		info := scanPRG(rel, b)
+		if info.Kind == "invalid" {
+			skipped = append(skipped, rel+": "+strings.Join(info.Notes, "; "))
+			continue
+		}
+		name, cut, err := uniqueMenuName(strings.TrimSuffix(filepath.Base(p), filepath.Ext(p)), names)
+		if err != nil {
+			return nil, nil, nil, 0, err
+		}
+		if cut {
+			shortened++
+		}
+		e := menuEntry{Source: rel, Name: name}
+		if info.Load != basicStart || info.Kind == "machine code" {
+			e.Sys = info.Load
+		}
+		e.Label = petscii.ToEscaped(e.Name)
+		entries = append(entries, e)
+		data = append(data, b)
+	}
+	return entries, data, skipped, shortened, nil
+}
+
+// uniqueMenuName turns a file name into a PETSCII name of up to 16
+// characters that is not yet used, replacing characters the menu cannot
+// show; shortened reports whether it had to be cut
+func uniqueMenuName(base string, names *diskimage.Shortener) (name []byte, shortened bool, err error) {
+	full := menuTitle(base)
+	if name, err = names.Fit(full); err != nil {
+		return nil, false, fmt.Errorf("'%s': %w", base, err)
+	}
+	return name, len(full) > 16, nil
+}
+
+// menuTitle converts text to upper case PETSCII without quotes, which
+// cannot appear in BASIC strings
+func menuTitle(text string) []byte {
+	var out []byte
+	for _, r := range strings.ToUpper(text) {
+		b, ok := petscii.RuneToPETSCII(r)
+		switch {
+		case r == '"':
+			b = '\''
+		case !ok || b < 0x20:
+			b = '-'
+		}
+		out = append(out, b)
+	}
+	if len(out) > 38 {
+		out = out[:38]
+	}
+	return out
+}
+
+// packMenuDisks distributes the programs over as many images as needed,
+// each starting with the menu. The first pass places the programs behind
+// a menu of the largest possible size; the menu with the final disk
+// numbers is no larger, so the programs fit the same way.
+func packMenuDisks(format diskimage.Format, title []byte, entries []menuEntry, data [][]byte) ([]*diskimage.Image, error) {
+	for i := range entries {
+		entries[i].Disk = maxMenuDisks
+	}
+	placeholder := menuProgram(title, entries, maxMenuDisks)
+
+	disk := 1
+	img := newMenuImage(format, title, disk, placeholder)
+	for i := range entries {
+		err := img.WriteFile(entries[i].Name, diskimage.PRG, data[i])
+		if errors.Is(err, diskimage.ErrDiskFull) || errors.Is(err, diskimage.ErrDirFull) {
+			if disk++; disk > maxMenuDisks {
+				return nil, fmt.Errorf("more than %d disks needed", maxMenuDisks)
+			}
+			img = newMenuImage(format, title, disk, placeholder)
+			err = img.WriteFile(entries[i].Name, diskimage.PRG, data[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entries[i].Source, err)
+		}
+		entries[i].Disk = disk
+	}
+
+	images := make([]*diskimage.Image, disk)
+	for d := 1; d <= disk; d++ {
+		images[d-1] = newMenuImage(format, title, d, menuProgram(title, entries, d))
+	}
+	for i, e := range entries {
+		if err := images[e.Disk-1].WriteFile(e.Name, diskimage.PRG, data[i]); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Source, err)
+		}
+	}
+	return images, nil
+}
+
+// newMenuImage creates an image holding only the menu
+func newMenuImage(format diskimage.Format, title []byte, disk int, menu []byte) *diskimage.Image {
+	img := diskimage.New(format, title[:min(len(title), 16)], []byte(fmt.Sprintf("%02d", disk)))
+	img.WriteFile([]byte("MENU"), diskimage.PRG, menu)
+	return img
+}
+
+// menuProgram builds the menu PRG for one disk of the set. On selection it
+// prints the LOAD and the RUN or SYS command on the cleared screen and
+// puts HOME and two RETURNs in the keyboard buffer, so that BASIC loads the
+// program and starts it once the menu has ended.
+func menuProgram(title []byte, entries []menuEntry, disk int) []byte {
+	page := strconv.Itoa(menuPage)
+	text := []string{
+		fmt.Sprintf("D=%d:N=%d:DIMN$(N),D(N),S(N):POKE53280,0:POKE53281,0", disk, len(entries)),
+		"FORI=1TON:READN$(I),D(I),S(I):NEXT:P=0",
+		"PRINTCHR$(147)CHR$(5)\"" + string(title) + "\":PRINT",
+		"FORI=1TO" + page + ":J=P+I:IFJ>NTHEN70",
+		"PRINTCHR$(64+I)\") \"N$(J);:IFD(J)<>DTHENPRINT\" (DISK\"D(J)\")\";",
+		"PRINT:NEXT",
+		"PRINT:IFN>" + page + "THENPRINT\"+/- PAGE  \";",
+		"PRINT\"PRESS A LETTER\"",
+		"GETK$:IFK$=\"\"THEN90",
+		"IFK$=\"+\"ANDP+" + page + "<NTHENP=P+" + page + ":GOTO30",
+		"IFK$=\"-\"ANDP>0THENP=P-" + page + ":GOTO30",
+		"K=ASC(K$)-64:J=P+K:IFK<1ORK>" + page + "ORJ>NTHEN90",
+		"IFD(J)=DTHEN150",
+		"PRINT:PRINT\"INSERT DISK\"D(J)\"AND PRESS A KEY\":POKE198,0:WAIT198,1:POKE198,0",
+		"PRINTCHR$(147)\"LOAD\"CHR$(34)N$(J)CHR$(34)\",8,1\":PRINT:PRINT:PRINT",
+		"IFS(J)THENPRINT\"SYS\"S(J):GOTO180",
+		"PRINT\"RUN\"",
+		"POKE631,19:POKE632,13:POKE633,13:POKE198,3:END",
+	}
+	var lines []basic.Line
+	for i, t := range text {
+		tok, _ := basic.Tokenize(t)
+		lines = append(lines, basic.Line{Number: (i + 1) * 10, Text: tok})
+	}
+
+	// DATA lines of name, disk and start address, each under 80 characters
+	var item []byte
+	number := 1000
+	flush := func() {
+		if len(item) > 0 {
+			lines = append(lines, basic.Line{Number: number, Text: append([]byte{0x83}, item...)})
+			item, number = nil, number+10
+		}
+	}
+	for _, e := range entries {
+		field := []byte(`"`)
+		field = append(field, e.Name...)
+		field = append(field, fmt.Sprintf(`",%d,%d`, e.Disk, e.Sys)...)
+		if len(item)+len(field) > 70 {
+			flush()
+		}
+		if len(item) > 0 {
+			item = append(item, ',')
+		}
+		item = append(item, field...)
+	}
+	flush()
+
+	prg := []byte{basicStart & 0xFF, basicStart >> 8}
+	return append(prg, basic.Encode(lines, basicStart)...)
+}
+
+func init() {
+	menuCmd.AddCommand(menuBuildCmd)
+	menuBuildCmd.Flags().StringP("output", "o", "menu.d64", "Disk image to write (d64, d71 or d81)")
+	menuBuildCmd.Flags().String("title", "", "Title shown by the menu and disk name (default: the directory name)")
+	addLongNamesFlag(menuBuildCmd)
+	addYesFlag(menuBuildCmd)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/spf13/cobra"
+)
+
+// modemCmd represents the modem command group
+var modemCmd = &cobra.Command{
+	Use:   "modem",
+	Short: "Configure the userport/ACIA modem emulation",
+	Long: `Inspect and change the Ultimate's modem emulation settings through the
+configuration API. Settings are taken from every configuration category
+whose name contains "modem".
+
+Item names can be abbreviated to any unique part, e.g. "baud" or "port".
+Changes apply immediately; use --save to keep them across power cycles.`,
+}
+
+var modemStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the modem settings",
+	Long: `Show all modem emulation settings.
+
+The configuration API does not report live connections, so the active
+connection (if any) is not shown.
+
+Examples:
+  c64u modem status
+  c64u --json modem status`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		items, err := modemItems()
+		if err != nil {
+			formatter.Error("Failed to read modem settings", []string{err.Error()})
+			return
+		}
+
+		printConfigItems(items)
+	},
+}
+
+var modemSetCmd = &cobra.Command{
+	Use:   "set <setting> <value> [--save]",
+	Short: "Change a modem setting",
+	Long: `Set a modem emulation setting. The setting may be any unique part of its
+name, case-insensitive.
+
+Examples:
+  c64u modem set "Listening Port" 6400
+  c64u modem set baud 2400 --save`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		save, _ := cmd.Flags().GetBool("save")
+
+		items, err := modemItems()
+		if err != nil {
+			formatter.Error("Failed to read modem settings", []string{err.Error()})
+			return
+		}
+
+		item, err := matchConfigItem(items, args[0])
+		if err != nil {
+			formatter.Error("Unknown modem setting", []string{err.Error()})
+			return
+		}
+
+		if !setConfigItem(item, args[1]) {
+			return
+		}
+		if save && !saveConfigToFlash() {
+			return
+		}
+
+		formatter.Success(fmt.Sprintf("%s set to %s", item.Name, args[1]), map[string]interface{}{
+			"category": item.Category,
+			"previous": item.Value,
+			"saved":    save,
+		})
+	},
+}
+
+// modemItems returns the items of all modem configuration categories
+func modemItems() ([]api.ConfigItem, error) {
+	categories, err := apiClient.ConfigCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []api.ConfigItem
+	for _, cat := range categories {
+		if !strings.Contains(strings.ToLower(cat), "modem") {
+			continue
+		}
+		catItems, err := apiClient.ConfigItems(cat, "*")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cat, err)
+		}
+		items = append(items, catItems...)
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no modem configuration category found (firmware without modem emulation?)")
+	}
+	return items, nil
+}
+
+func init() {
+	modemSetCmd.Flags().Bool("save", false, "Save the configuration to flash")
+	addPreserveFlags(modemSetCmd)
+
+	modemCmd.AddCommand(modemStatusCmd)
+	modemCmd.AddCommand(modemSetCmd)
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/mqtt"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/schedule"
+	"github.com/spf13/cobra"
+)
+
+// mqttCmd represents the mqtt command group
+var mqttCmd = &cobra.Command{
+	Use:   "mqtt",
+	Short: "Bridge the device to an MQTT broker",
+	Long:  `Publish device status to an MQTT broker and accept commands from it, for home-automation dashboards.`,
+}
+
+var mqttServeCmd = &cobra.Command{
+	Use:   "serve [--broker URL] [--topic T] [--interval D]",
+	Short: "Publish status to MQTT and subscribe to command topics",
+	Long: `Connect to an MQTT broker, publish the device state and carry out
+commands published to it. The broker and topic come from the [mqtt] section
+of config.toml or the flags.
+
+Published (retained, only when they change), below the topic (default c64u):
+  <topic>/availability     online / offline (offline is also the last will)
+  <topic>/status           full status as JSON (as overlay serve's status.json)
+  <topic>/now_playing      what was last started with c64u, as JSON ("" if nothing)
+  <topic>/drives/<name>    image mounted in the drive ("" if none)
+
+Commands (subscribed):
+  <topic>/command/reset    reset the machine (payload ignored)
+  <topic>/command/run      run a file: a C64U path, URL or local path
+  <topic>/command/sidplay  play a SID file: path or {"file": "...", "song": N}
+
+Commands run as separate c64u processes, exactly as typed on the command
+line; a command is not started while the previous one is still running.
+With --discovery, Home Assistant MQTT discovery configs are published for
+an availability sensor, a now-playing sensor and a reset button.
+
+Examples:
+  c64u mqtt serve --broker tcp://192.168.1.10:1883
+  c64u mqtt serve --broker mqtts://broker.local --username c64u --password secret
+  mosquitto_pub -t c64u/command/run -m /Usb0/games/game.d64`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load()
+		if err != nil {
+			formatter.Error("Failed to load configuration", []string{err.Error()})
+			return
+		}
+		mc := cfg.MQTT
+		if cmd.Flags().Changed("broker") {
+			mc.Broker, _ = cmd.Flags().GetString("broker")
+		}
+		if cmd.Flags().Changed("topic") {
+			mc.Topic, _ = cmd.Flags().GetString("topic")
+		}
+		if cmd.Flags().Changed("username") {
+			mc.Username, _ = cmd.Flags().GetString("username")
+		}
+		if cmd.Flags().Changed("password") {
+			mc.Password, _ = cmd.Flags().GetString("password")
+		}
+		if cmd.Flags().Changed("discovery") {
+			mc.Discovery, _ = cmd.Flags().GetBool("discovery")
+		}
+		interval, _ := cmd.Flags().GetDuration("interval")
+
+		if mc.Broker == "" {
+			formatter.Error("No MQTT broker configured", []string{
+				"Set broker in the [mqtt] section of config.toml or use --broker",
+			})
+			return
+		}
+		mc.Topic = strings.Trim(mc.Topic, "/")
+		if mc.Topic == "" {
+			mc.Topic = "c64u"
+		}
+		if mc.ClientID == "" {
+			hostname, _ := os.Hostname()
+			mc.ClientID = fmt.Sprintf("c64u-%s-%d", hostname, os.Getpid())
+		}
+
+		b := &mqttBridge{topic: mc.Topic, sent: make(map[string]string)}
+		client, err := mqtt.Dial(mqtt.Options{
+			Broker:   mc.Broker,
+			ClientID: mc.ClientID,
+			Username: mc.Username,
+			Password: mc.Password,
+			Will:     &mqtt.Message{Topic: b.path("availability"), Payload: []byte("offline"), Retain: true},
+		})
+		if err != nil {
+			formatter.Error("Failed to connect to MQTT broker", []string{err.Error()})
+			return
+		}
+		b.client = client
+		defer client.Close()
+
+		if err := client.Subscribe(b.path("command/#")); err != nil {
+			formatter.Error("Failed to subscribe to command topics", []string{err.Error()})
+			return
+		}
+		if mc.Discovery {
+			b.publishDiscovery()
+		}
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(stop)
+
+		formatter.Info(fmt.Sprintf("Connected to %s, publishing to %s/ (Ctrl-C to stop)", mc.Broker, mc.Topic))
+		b.update()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		commands := make(chan mqtt.Message, 4)
+		go b.runCommands(commands)
+		defer close(commands)
+
+		for {
+			select {
+			case <-stop:
+				// A clean disconnect skips the will, so say goodbye here
+				client.Publish(b.path("availability"), []byte("offline"), true)
+				return
+			case <-client.Done():
+				formatter.Error("MQTT connection lost", []string{fmt.Sprint(client.Err())})
+				return
+			case msg, ok := <-client.Messages():
+				if !ok {
+					continue
+				}
+				select {
+				case commands <- msg:
+				default:
+					formatter.Warning(fmt.Sprintf("Ignoring %s: too many commands queued", msg.Topic))
+				}
+			case <-ticker.C:
+				b.update()
+			}
+		}
+	},
+}
+
+// mqttBridge publishes device state and carries out commands
+type mqttBridge struct {
+	client *mqtt.Client
+	topic  string
+	ov     overlay
+	// mu serializes updates from the poll loop and after commands
+	mu sync.Mutex
+	// sent holds the last payload per topic, so only changes are published
+	sent map[string]string
+}
+
+// path returns a topic below the base topic
+func (b *mqttBridge) path(sub string) string {
+	return b.topic + "/" + sub
+}
+
+// publish sends a retained value if it changed since the last time
+func (b *mqttBridge) publish(sub, payload string) {
+	topic := b.path(sub)
+	if last, ok := b.sent[topic]; ok && last == payload {
+		return
+	}
+	if err := b.client.Publish(topic, []byte(payload), true); err != nil {
+		formatter.Warning(fmt.Sprintf("Failed to publish %s: %v", topic, err))
+		return
+	}
+	b.sent[topic] = payload
+	if verbose {
+		formatter.Info(fmt.Sprintf("%s = %s", topic, payload))
+	}
+}
+
+// update polls the device and publishes what changed
+func (b *mqttBridge) update() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.ov.poll()
+	status := b.ov.get()
+
+	if status.Online {
+		b.publish("availability", "online")
+	} else {
+		b.publish("availability", "offline")
+	}
+
+	b.publishStatus(status)
+
+	playing := ""
+	if status.Playing != nil {
+		p, _ := json.Marshal(status.Playing)
+		playing = string(p)
+	}
+	b.publish("now_playing", playing)
+
+	for _, d := range status.Drives {
+		image := ""
+		if d.Enabled {
+			image = d.Image
+		}
+		b.publish("drives/"+d.Name, image)
+	}
+}
+
+// publishStatus publishes the full status when anything but the poll time
+// changed
+func (b *mqttBridge) publishStatus(status overlayStatus) {
+	data, _ := json.Marshal(status)
+	status.Time = time.Time{}
+	key, _ := json.Marshal(status)
+	topic := b.path("status")
+	if b.sent[topic+"\x00"] == string(key) {
+		return
+	}
+	if err := b.client.Publish(topic, data, true); err != nil {
+		formatter.Warning(fmt.Sprintf("Failed to publish %s: %v", topic, err))
+		return
+	}
+	b.sent[topic+"\x00"] = string(key)
+}
+
+// runCommands carries out queued commands one at a time
+func (b *mqttBridge) runCommands(commands <-chan mqtt.Message) {
+	for msg := range commands {
+		name := strings.TrimPrefix(msg.Topic, b.path("command/"))
+		if msg.Retain {
+			// A retained command would run again on every connect
+			formatter.Warning(fmt.Sprintf("Ignoring retained command '%s'", name))
+			continue
+		}
+		args, err := mqttCommandArgs(name, msg.Payload)
+		if err != nil {
+			formatter.Warning(fmt.Sprintf("Ignoring command '%s': %v", name, err))
+			continue
+		}
+
+		formatter.Info(fmt.Sprintf("Command %s: c64u %s", name, strings.Join(args, " ")))
+		var out bytes.Buffer
+		if _, err := runScheduledJob(&schedule.Job{Name: "mqtt-" + name, Args: args}, &out); err != nil {
+			formatter.Warning(fmt.Sprintf("Command %s failed: %v: %s", name, err, strings.TrimSpace(out.String())))
+		}
+		// Publish the result without waiting for the next poll
+		b.update()
+	}
+}
+
+// mqttCommandArgs maps a command topic and payload to c64u arguments
+func mqttCommandArgs(name string, payload []byte) ([]string, error) {
+	file, song, err := mqttFilePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "reset":
+		return []string{"machine", "reset"}, nil
+	case "run":
+		if file == "" {
+			return nil, fmt.Errorf("no file given")
+		}
+		args := []string{"run", file}
+		if song > 0 {
+			args = append(args, "--song", strconv.Itoa(song))
+		}
+		return args, nil
+	case "sidplay":
+		if file == "" {
+			return nil, fmt.Errorf("no file given")
+		}
+		if !strings.EqualFold(filepath.Ext(file), ".sid") {
+			return nil, fmt.Errorf("'%s' is not a SID file", file)
+		}
+		args := []string{"run", file}
+		if song > 0 {
+			args = append(args, "--song", strconv.Itoa(song))
+		}
+		return args, nil
+	default:
+		return nil, fmt.Errorf("unknown command (use reset, run or sidplay)")
+	}
+}
+
+// mqttFilePayload reads a plain path or a {"file": ..., "song": N} object
+func mqttFilePayload(payload []byte) (string, int, error) {
+	text := strings.TrimSpace(string(payload))
+	if !strings.HasPrefix(text, "{") {
+		if strings.HasPrefix(text, "-") {
+			return "", 0, fmt.Errorf("invalid file '%s'", text)
+		}
+		return text, 0, nil
+	}
+	var p struct {
+		File string `json:"file"`
+		Song int    `json:"song"`
+	}
+	if err := json.Unmarshal([]byte(text), &p); err != nil {
+		return "", 0, fmt.Errorf("invalid JSON payload: %w", err)
+	}
+	if strings.HasPrefix(p.File, "-") {
+		return "", 0, fmt.Errorf("invalid file '%s'", p.File)
+	}
+	return p.File, p.Song, nil
+}
+
+// publishDiscovery publishes Home Assistant MQTT discovery configs
+func (b *mqttBridge) publishDiscovery() {
+	id := strings.ReplaceAll(b.topic, "/", "_")
+	device := map[string]interface{}{
+		"identifiers":  []string{id},
+		"name":         "Commodore 64 Ultimate",
+		"manufacturer": "Gideon's Logic",
+	}
+	availability := b.path("availability")
+	configs := map[string]map[string]interface{}{
+		"binary_sensor/" + id + "/online/config": {
+			"name":         "Online",
+			"unique_id":    id + "_online",
+			"state_topic":  availability,
+			"payload_on":   "online",
+			"payload_off":  "offline",
+			"device_class": "connectivity",
+			"device":       device,
+		},
+		"sensor/" + id + "/now_playing/config": {
+			"name":                  "Now playing",
+			"unique_id":             id + "_now_playing",
+			"state_topic":           b.path("now_playing"),
+			"value_template":        "{{ (value_json.sid.title if value_json.sid and value_json.sid.title else value_json.file) if value else '' }}",
+			"availability_topic":    availability,
+			"json_attributes_topic": b.path("now_playing"),
+			"icon":                  "mdi:music",
+			"device":                device,
+		},
+		"button/" + id + "/reset/config": {
+			"name":               "Reset",
+			"unique_id":          id + "_reset",
+			"command_topic":      b.path("command/reset"),
+			"availability_topic": availability,
+			"icon":               "mdi:restart",
+			"device":             device,
+		},
+	}
+	for topic, cfg := range configs {
+		data, _ := json.Marshal(cfg)
+		if err := b.client.Publish("homeassistant/"+topic, data, true); err != nil {
+			formatter.Warning(fmt.Sprintf("Failed to publish discovery config: %v", err))
+		}
+	}
+}
+
+func init() {
+	mqttServeCmd.Flags().String("broker", "", "Broker address (host[:port], tcp://, mqtts://)")
+	mqttServeCmd.Flags().String("topic", "c64u", "Base topic")
+	mqttServeCmd.Flags().String("username", "", "Broker user name")
+	mqttServeCmd.Flags().String("password", "", "Broker password")
+	mqttServeCmd.Flags().Bool("discovery", false, "Publish Home Assistant discovery configs")
+	mqttServeCmd.Flags().Duration("interval", 10*time.Second, "How often to poll the device")
+	mqttCmd.AddCommand(mqttServeCmd)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/hvsc"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/sidfile"
+)
+
+// ============================================================================
+// Now Playing
+// ============================================================================
+
+// nowPlaying is the program or tune last started on the runner, shown by
+// "c64u overlay serve"
+type nowPlaying struct {
+	Kind string    `json:"kind"`
+	File string    `json:"file"`
+	Song int       `json:"song,omitempty"`
+	Time time.Time `json:"time"`
+	// SID is the header of a SID file that was uploaded (device files are
+	// not read)
+	SID *sidfile.Header `json:"sid,omitempty"`
+	// STIL is the HVSC information of the SID file and the playing song,
+	// if an HVSC copy is configured
+	STIL *nowPlayingSTIL `json:"stil,omitempty"`
+}
+
+// nowPlayingSTIL is the STIL commentary and song length of the playing song
+type nowPlayingSTIL struct {
+	Comment string     `json:"comment,omitempty"`
+	Song    *hvsc.Song `json:"song,omitempty"`
+	Length  string     `json:"length,omitempty"`
+}
+
+// nowPlayingPath is the location of the recorded runner state
+func nowPlayingPath() string {
+	return filepath.Join(config.GetConfigDir(), "cache", "now_playing.json")
+}
+
+// recordRunning remembers what was started on the runner. local is set for
+// uploaded files, whose SID header is read.
+func recordRunning(kind, file string, song int, local bool) {
+	np := nowPlaying{Kind: kind, File: filepath.Base(file), Song: song, Time: time.Now()}
+	if local && strings.EqualFold(filepath.Ext(file), ".sid") {
+		np.SID, np.STIL = readNowPlayingSID(file, song)
+	}
+	data, err := json.MarshalIndent(np, "", "  ")
+	if err != nil {
+		return
+	}
+	path := nowPlayingPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+		os.WriteFile(path, data, 0644)
+	}
+}
+
+// readNowPlayingSID reads the header of a SID file and looks up the song
+// in the HVSC copy
+func readNowPlayingSID(file string, song int) (*sidfile.Header, *nowPlayingSTIL) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil
+	}
+	h, err := sidfile.Parse(data)
+	if err != nil {
+		return nil, nil
+	}
+	lengths, entry, err := lookupHVSC("", data, file)
+	if err != nil || (entry == nil && lengths == nil) {
+		return h, nil
+	}
+	if song == 0 {
+		song = h.StartSong
+	}
+	info := &nowPlayingSTIL{Song: entry.Song(song, h.Songs)}
+	if entry != nil {
+		info.Comment = entry.Comment
+	}
+	if song >= 1 && song <= len(lengths) {
+		info.Length = formatLength(lengths[song-1])
+	}
+	return h, info
+}
+
+// clearRunning forgets the runner state after a reset or power off
+func clearRunning() {
+	os.Remove(nowPlayingPath())
+}
+
+// loadRunning returns the recorded runner state, or nil
+func loadRunning() *nowPlaying {
+	data, err := os.ReadFile(nowPlayingPath())
+	if err != nil {
+		return nil
+	}
+	var np nowPlaying
+	if json.Unmarshal(data, &np) != nil {
+		return nil
+	}
+	return &np
+}
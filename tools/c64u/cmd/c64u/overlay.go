@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// overlayCmd represents the overlay command group
+var overlayCmd = &cobra.Command{
+	Use:   "overlay",
+	Short: "Overlays for live streams",
+	Long:  `Serve machine status as browser sources for streaming software such as OBS.`,
+}
+
+var overlayServeCmd = &cobra.Command{
+	Use:   "serve [--listen ADDR] [--interval D]",
+	Short: "Serve a now-playing/status overlay over HTTP",
+	Long: `Run a small HTTP server with an overlay page for streaming software: the
+tune or program last started with c64u (with title, author and release of
+uploaded SID files, and the song's name, length and STIL commentary if
+hvsc_dir or stil_path is configured), the mounted disk images and whether
+the device is online. Add the page as a browser source in OBS; its background is
+transparent.
+
+The device is polled every --interval; the page refreshes itself. Endpoints:
+  /              overlay page (?panels=playing,drives,status picks panels)
+  /status.json   the same data as JSON
+
+What is playing is taken from c64u's own runner commands (run, runners,
+machine reset --then-run), as the device does not report it; resets and
+power off through c64u clear it.
+
+Examples:
+  c64u overlay serve
+  c64u overlay serve --listen :8080 --interval 2s`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		listen, _ := cmd.Flags().GetString("listen")
+		interval, _ := cmd.Flags().GetDuration("interval")
+
+		ov := &overlay{}
+		ov.poll()
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, overlayHTML)
+		})
+		mux.HandleFunc("/status.json", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			json.NewEncoder(w).Encode(ov.get())
+		})
+		srv := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(stop)
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+					srv.Shutdown(ctx)
+					cancel()
+					return
+				case <-ticker.C:
+					ov.poll()
+				}
+			}
+		}()
+
+		formatter.Info(fmt.Sprintf("Overlay at http://%s/ (Ctrl-C to stop)", displayAddr(listen)))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			formatter.Error("Overlay server failed", []string{err.Error()})
+		}
+	},
+}
+
+// overlayStatus is what the overlay page shows
+type overlayStatus struct {
+	Time     time.Time        `json:"time"`
+	Online   bool             `json:"online"`
+	Error    string           `json:"error,omitempty"`
+	Product  string           `json:"product,omitempty"`
+	Firmware string           `json:"firmware,omitempty"`
+	Playing  *nowPlaying      `json:"playing,omitempty"`
+	Drives   []indicatorDrive `json:"drives"`
+	Busy     bool             `json:"busy"`
+}
+
+// overlay holds the latest poll for the HTTP handlers
+type overlay struct {
+	mu     sync.Mutex
+	status overlayStatus
+	drives *indicatorStatus
+}
+
+// poll refreshes the status from the device and the runner state
+func (o *overlay) poll() {
+	o.mu.Lock()
+	prev, old := o.drives, o.status
+	o.mu.Unlock()
+
+	status := overlayStatus{Time: time.Now(), Playing: loadRunning(), Drives: []indicatorDrive{}}
+	drives, err := pollIndicator(prev)
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Online = true
+		status.Drives = drives.Drives
+		status.Busy = drives.Busy
+
+		// Device info only changes with a firmware update; read it once
+		// per connection
+		status.Product, status.Firmware = old.Product, old.Firmware
+		if !old.Online || status.Product == "" {
+			if resp, err := apiClient.GetInfo(); err == nil && !resp.HasErrors() {
+				status.Product = resp.GetString("product")
+				status.Firmware = resp.GetString("firmware_version")
+			}
+		}
+	}
+
+	o.mu.Lock()
+	o.status = status
+	if drives != nil {
+		o.drives = drives
+	}
+	o.mu.Unlock()
+}
+
+// get returns the latest status
+func (o *overlay) get() overlayStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.status
+}
+
+// displayAddr turns a listen address into one for a browser
+func displayAddr(listen string) string {
+	if len(listen) > 0 && listen[0] == ':' {
+		return "localhost" + listen
+	}
+	return listen
+}
+
+// overlayHTML is the browser source page. It polls /status.json and is
+// styled to be readable over video on a transparent background.
+const overlayHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>c64u overlay</title>
+<style>
+  html, body { margin: 0; background: transparent; }
+  body {
+    font: 600 22px/1.35 "C64 Pro Mono", "Courier New", monospace;
+    color: #fff;
+    text-shadow: 0 0 4px #000, 2px 2px 0 #000;
+    padding: 12px;
+  }
+  .panel { margin-bottom: 10px; }
+  .panel[hidden] { display: none; }
+  .label { color: #a0a0ff; font-size: 16px; text-transform: uppercase; }
+  .dim { color: #bbb; font-size: 18px; }
+  .offline { color: #ff7070; }
+  .comment { color: #bbb; font-size: 15px; max-width: 40em; }
+</style>
+</head>
+<body>
+<div class="panel" id="playing"></div>
+<div class="panel" id="drives"></div>
+<div class="panel" id="status"></div>
+<script>
+const want = new URLSearchParams(location.search).get("panels");
+const panels = want ? want.split(",") : ["playing", "drives", "status"];
+for (const id of ["playing", "drives", "status"]) {
+  document.getElementById(id).hidden = !panels.includes(id);
+}
+
+function esc(s) {
+  return String(s).replace(/[&<>"]/g, c => ({"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;"}[c]));
+}
+
+function render(s) {
+  const playing = document.getElementById("playing");
+  const p = s.playing;
+  if (!p) {
+    playing.innerHTML = "";
+  } else if (p.sid && p.sid.title) {
+    let song = p.song || p.sid.start_song;
+    playing.innerHTML = '<div class="label">Now playing</div>' +
+      esc(p.sid.title) + '<div class="dim">' + esc(p.sid.author) +
+      (p.sid.released ? " &middot; " + esc(p.sid.released) : "") +
+      (p.sid.songs > 1 ? " &middot; song " + song + "/" + p.sid.songs : "") +
+      (p.stil && p.stil.length ? " &middot; " + esc(p.stil.length) : "") + "</div>";
+    const info = p.stil && p.stil.song;
+    if (info && info.name) {
+      playing.innerHTML += '<div class="dim">' + esc(info.name) + "</div>";
+    }
+    if (info && info.title) {
+      playing.innerHTML += '<div class="dim">Cover of ' + esc(info.title) +
+        (info.artist ? " by " + esc(info.artist) : "") + "</div>";
+    }
+    const comment = (info && info.comment) || (p.stil && p.stil.comment);
+    if (comment) {
+      playing.innerHTML += '<div class="comment">' + esc(comment) + "</div>";
+    }
+  } else {
+    const label = (p.kind === "sidplay" || p.kind === "modplay") ? "Now playing" : "Running";
+    playing.innerHTML = '<div class="label">' + label + "</div>" + esc(p.file);
+  }
+
+  const drives = document.getElementById("drives");
+  const mounted = (s.drives || []).filter(d => d.enabled && d.image);
+  drives.innerHTML = mounted.length === 0 ? "" : '<div class="label">Disk</div>' +
+    mounted.map(d => esc(d.bus_id + ": " + d.image)).join("<br>");
+
+  const status = document.getElementById("status");
+  status.innerHTML = s.online
+    ? '<span class="dim">' + esc(s.product || "C64 Ultimate") + (s.busy ? " &middot; busy" : "") + "</span>"
+    : '<span class="offline">offline</span>';
+}
+
+async function refresh() {
+  try {
+    const r = await fetch("status.json", {cache: "no-store"});
+    render(await r.json());
+  } catch (e) {
+    render({online: false});
+  }
+}
+refresh();
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+`
+
+func init() {
+	overlayServeCmd.Flags().String("listen", "127.0.0.1:6464", "Address to listen on")
+	overlayServeCmd.Flags().Duration("interval", 5*time.Second, "How often to poll the device")
+	overlayCmd.AddCommand(overlayServeCmd)
+}
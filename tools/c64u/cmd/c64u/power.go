@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/power"
+	"github.com/spf13/cobra"
+)
+
+// powerCmd represents the power command group
+var powerCmd = &cobra.Command{
+	Use:   "power",
+	Short: "Mains power control via smart plug or Wake-on-LAN",
+	Long: `Switch the C64 Ultimate's mains power using a configured backend.
+
+Backends are configured in the [power] section of config.toml:
+  tasmota  Smart plug running Tasmota (host)
+  shelly   Shelly relay, Gen1 HTTP API (host, relay)
+  wol      Wake-on-LAN magic packet (mac, broadcast) - power on only
+
+Example config:
+  [power]
+  backend = "tasmota"
+  host = "192.168.1.50"`,
+}
+
+// loadPowerBackend creates the power backend from the configuration
+func loadPowerBackend() power.Backend {
+	cfg, err := config.Load()
+	if err != nil {
+		formatter.Error("Failed to load config", []string{err.Error()})
+		return nil
+	}
+
+	backend, err := power.New(power.Options{
+		Backend:   cfg.Power.Backend,
+		Host:      cfg.Power.Host,
+		Relay:     cfg.Power.Relay,
+		MAC:       cfg.Power.MAC,
+		Broadcast: cfg.Power.Broadcast,
+	})
+	if err != nil {
+		formatter.Error("Invalid power configuration", []string{err.Error()})
+		return nil
+	}
+	return backend
+}
+
+var powerOnCmd = &cobra.Command{
+	Use:   "on",
+	Short: "Switch power on",
+	Long: `Switch the C64 Ultimate's power on using the configured backend.
+
+Example:
+  c64u power on`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !requireWritable() {
+			return
+		}
+		backend := loadPowerBackend()
+
+		if err := backend.On(); err != nil {
+			formatter.Error("Failed to switch power on", []string{err.Error()})
+			return
+		}
+
+		formatter.Success("Power switched on", map[string]interface{}{
+			"backend": backend.Name(),
+		})
+	},
+}
+
+var powerOffCmd = &cobra.Command{
+	Use:   "off [--delay D] [--plug-only]",
+	Short: "Power off the machine and cut mains power",
+	Long: `Power off the machine and then cut mains power via the configured backend.
+
+The machine is first powered off through the REST API (U64 only), then the
+plug is switched off after --delay. Use --plug-only to skip the API call,
+e.g. on a 1541 Ultimate cartridge or an unresponsive device. Asks for
+confirmation first; --yes (or assume_yes in config.toml) skips the question.
+
+Example:
+  c64u power off --delay 5s`,
+	Run: func(cmd *cobra.Command, args []string) {
+		delay, _ := cmd.Flags().GetDuration("delay")
+		plugOnly, _ := cmd.Flags().GetBool("plug-only")
+
+		if !confirmCmd(cmd, "Power off the machine and cut mains power?") {
+			return
+		}
+
+		backend := loadPowerBackend()
+
+		if !plugOnly {
+			resp, err := apiClient.MachinePowerOff()
+			if err != nil {
+				formatter.Warning(fmt.Sprintf("Machine poweroff failed: %v", err))
+			} else if resp.HasErrors() {
+				formatter.Warning(fmt.Sprintf("Machine poweroff failed: %v", resp.Errors))
+			}
+			clearRunning()
+			time.Sleep(delay)
+		}
+
+		if err := backend.Off(); err != nil {
+			if errors.Is(err, power.ErrUnsupported) {
+				formatter.Error("Failed to switch power off", []string{
+					fmt.Sprintf("The %s backend can only switch power on", backend.Name()),
+				})
+				return
+			}
+			formatter.Error("Failed to switch power off", []string{err.Error()})
+			return
+		}
+
+		formatter.Success("Power switched off", map[string]interface{}{
+			"backend": backend.Name(),
+		})
+	},
+}
+
+var powerCycleCmd = &cobra.Command{
+	Use:   "cycle [--off-time D]",
+	Short: "Power cycle the machine",
+	Long: `Switch the plug off, wait, and switch it on again.
+
+Example:
+  c64u power cycle --off-time 5s`,
+	Run: func(cmd *cobra.Command, args []string) {
+		offTime, _ := cmd.Flags().GetDuration("off-time")
+		if !requireWritable() {
+			return
+		}
+
+		backend := loadPowerBackend()
+
+		if err := backend.Off(); err != nil {
+			formatter.Error("Failed to switch power off", []string{err.Error()})
+			return
+		}
+
+		time.Sleep(offTime)
+
+		if err := backend.On(); err != nil {
+			formatter.Error("Failed to switch power on", []string{err.Error()})
+			return
+		}
+
+		formatter.Success("Power cycled", map[string]interface{}{
+			"backend":  backend.Name(),
+			"off_time": offTime.String(),
+		})
+	},
+}
+
+var powerStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show plug power state",
+	Long:  `Query the configured smart plug for its current power state.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		backend := loadPowerBackend()
+
+		on, err := backend.Status()
+		if err != nil {
+			formatter.Error("Failed to get power state", []string{err.Error()})
+			return
+		}
+
+		state := "off"
+		if on {
+			state = "on"
+		}
+
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{
+				"backend": backend.Name(),
+				"power":   state,
+			})
+		} else {
+			formatter.PrintKeyValue("Backend", backend.Name())
+			formatter.PrintKeyValue("Power", state)
+		}
+	},
+}
+
+func init() {
+	powerCmd.AddCommand(powerOnCmd)
+	powerCmd.AddCommand(powerOffCmd)
+	powerCmd.AddCommand(powerCycleCmd)
+	powerCmd.AddCommand(powerStatusCmd)
+
+	powerOffCmd.Flags().Duration("delay", 2*time.Second, "Delay between machine poweroff and cutting the plug")
+	powerOffCmd.Flags().Bool("plug-only", false, "Only switch the plug, skip the REST API poweroff")
+	powerCycleCmd.Flags().Duration("off-time", 3*time.Second, "How long to keep power off")
+	addYesFlag(powerOffCmd)
+}
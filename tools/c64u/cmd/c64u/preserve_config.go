@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/lock"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Preserved Settings
+// ============================================================================
+
+// configSnapshot holds the values settings had before a command with
+// --preserve-config changed them
+type configSnapshot struct {
+	items    []api.ConfigItem
+	seen     map[string]bool
+	restored bool
+}
+
+// preserved is the snapshot of the running command; nil without
+// --preserve-config
+var preserved *configSnapshot
+
+// addPreserveFlags adds --preserve-config and --while to commands that
+// change settings. The command then keeps running after the change and
+// restores the previous values when it ends.
+func addPreserveFlags(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		c.Flags().Bool("preserve-config", false, "Restore the previous settings on Ctrl-C")
+		c.Flags().String("while", "", "Restore the previous settings when this shell command ends (implies --preserve-config)")
+		run := c.Run
+		c.Run = func(cmd *cobra.Command, args []string) {
+			if !startPreserving(cmd) {
+				return
+			}
+			run(cmd, args)
+			holdPreserved(cmd)
+		}
+	}
+}
+
+// startPreserving sets up the snapshot for --preserve-config
+func startPreserving(cmd *cobra.Command) bool {
+	keep, _ := cmd.Flags().GetBool("preserve-config")
+	while, _ := cmd.Flags().GetString("while")
+	if !keep && while == "" {
+		return true
+	}
+	if save, _ := cmd.Flags().GetBool("save"); save {
+		formatter.Error("Conflicting flags", []string{"--save writes the change to flash; it cannot be combined with --preserve-config or --while"})
+		return false
+	}
+	preserved = &configSnapshot{seen: make(map[string]bool)}
+	// A failing command restores what it changed so far
+	output.OnExit(func(int) { preserved.restore() })
+	return true
+}
+
+// remember records the value of a setting before its first change
+func (s *configSnapshot) remember(item api.ConfigItem) {
+	key := item.Category + "\x00" + item.Name
+	if s.seen[key] {
+		return
+	}
+	s.seen[key] = true
+	s.items = append(s.items, item)
+}
+
+// restore sets the remembered values again, the last change first
+func (s *configSnapshot) restore() (map[string]interface{}, error) {
+	if s.restored {
+		return nil, nil
+	}
+	s.restored = true
+	// holdPreserved gave up the device lock while waiting
+	if l, ok := apiClient.Locker.(*lock.Lock); ok {
+		if err := l.Lock(); err != nil {
+			return nil, fmt.Errorf("device lock: %w", err)
+		}
+	}
+	values := make(map[string]interface{})
+	var errs []string
+	for i := len(s.items) - 1; i >= 0; i-- {
+		item := s.items[i]
+		value := fmt.Sprintf("%v", item.Value)
+		resp, err := apiClient.ConfigSet(item.Category, item.Name, value)
+		if err == nil && resp.HasErrors() {
+			err = fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v (was %s)", item.Name, err, value))
+			continue
+		}
+		values[item.Name] = value
+	}
+	if len(errs) > 0 {
+		return values, errors.New(strings.Join(errs, "; "))
+	}
+	return values, nil
+}
+
+// holdPreserved waits until the --while command ends, or for Ctrl-C, and
+// restores the settings the command changed. The device lock is released
+// meanwhile, so the --while command and other c64u processes can change
+// the device.
+func holdPreserved(cmd *cobra.Command) {
+	if preserved == nil || preserved.restored || len(preserved.items) == 0 {
+		return
+	}
+	while, _ := cmd.Flags().GetString("while")
+	if l, ok := apiClient.Locker.(*lock.Lock); ok {
+		l.Release()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(stop)
+
+	code := 0
+	if while != "" {
+		// Ctrl-C reaches the command too; the settings are restored once
+		// it has ended
+		c := shellCommand(while)
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := c.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				formatter.Error("Failed to run --while command", []string{err.Error()})
+				return
+			}
+			code = exitErr.ExitCode()
+		}
+	} else {
+		formatter.Info("Ctrl-C restores the previous settings")
+		<-stop
+	}
+
+	values, err := preserved.restore()
+	if err != nil {
+		formatter.Error("Failed to restore settings", []string{err.Error()})
+		return
+	}
+	if !jsonOut {
+		formatter.Success(fmt.Sprintf("Restored %s", plural(len(values), "setting")), values)
+	}
+	if code != 0 {
+		output.Exit(code)
+	}
+}
+
+// shellCommand runs a command line through the shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/basic"
+	"github.com/spf13/cobra"
+)
+
+// basicStart is where the C64 loads and runs BASIC programs
+const basicStart = 0x0801
+
+// prgCmd represents the prg command group
+var prgCmd = &cobra.Command{
+	Use:   "prg",
+	Short: "Inspect local PRG files",
+	Long:  `Inspect local PRG files, e.g. to curate collections before building disks or menus.`,
+}
+
+// prgInfo describes a PRG file
+type prgInfo struct {
+	File   string `json:"file"`
+	Load   int    `json:"load"`
+	End    int    `json:"end"`
+	Size   int    `json:"size"`
+	Blocks int    `json:"blocks"`
+	// Kind is "stub" (BASIC stub starting machine code), "basic",
+	// "machine code" or "invalid"
+	Kind  string   `json:"kind"`
+	Sys   int      `json:"sys,omitempty"`
+	Notes []string `json:"notes,omitempty"`
+}
+
+var prgScanCmd = &cobra.Command{
+	Use:   "scan <dir>",
+	Short: "Report load addresses and BASIC stubs of all PRGs in a directory tree",
+	Long: `List every .prg file below a directory with its load and end address, size
+in bytes and blocks, and whether it starts with a BASIC stub (a short BASIC
+program whose SYS starts machine code, with the SYS address), is a BASIC
+program or is machine code to be started by hand.
+
+Notes point out what needs attention when building disks or menus: load
+addresses other than $0801 (the file must be loaded with ",8,1"), a SYS
+address outside the file, data past $FFFF or into the I/O area, and files
+too short to hold a load address. A summary counts the load addresses.
+
+Examples:
+  c64u prg scan ~/c64/games
+  c64u --json prg scan collection/ > prgs.json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		root := args[0]
+		var infos []prgInfo
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p != root && strings.HasPrefix(d.Name(), ".") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || !strings.EqualFold(filepath.Ext(p), ".prg") {
+				return nil
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, p)
+			infos = append(infos, scanPRG(filepath.ToSlash(rel), data))
+			return nil
+		})
+		if err != nil {
+			formatter.Error("Cannot scan directory", []string{err.Error()})
+			return
+		}
+
+		if jsonOut {
+			if infos == nil {
+				infos = []prgInfo{}
+			}
+			formatter.PrintData(infos)
+			return
+		}
+		if len(infos) == 0 {
+			formatter.Info("No PRG files found in " + root)
+			return
+		}
+
+		rows := make([][]string, 0, len(infos))
+		loads := map[int]int{}
+		kinds := map[string]int{}
+		for _, info := range infos {
+			sys := ""
+			if info.Sys != 0 {
+				sys = strconv.Itoa(info.Sys)
+			}
+			load, end := "", ""
+			if info.Kind != "invalid" {
+				load, end = fmt.Sprintf("$%04X", info.Load), fmt.Sprintf("$%04X", info.End)
+				loads[info.Load]++
+			}
+			kinds[info.Kind]++
+			rows = append(rows, []string{info.File, load, end, strconv.Itoa(info.Size), strconv.Itoa(info.Blocks),
+				info.Kind, sys, strings.Join(info.Notes, "; ")})
+		}
+		formatter.PrintTable([]string{"file", "load", "end", "bytes", "blocks", "kind", "sys", "notes"}, rows)
+
+		addrs := make([]int, 0, len(loads))
+		for a := range loads {
+			addrs = append(addrs, a)
+		}
+		sort.Slice(addrs, func(i, j int) bool {
+			return loads[addrs[i]] > loads[addrs[j]] || (loads[addrs[i]] == loads[addrs[j]] && addrs[i] < addrs[j])
+		})
+		counts := make([]string, 0, len(addrs))
+		for _, a := range addrs {
+			counts = append(counts, fmt.Sprintf("$%04X ×%d", a, loads[a]))
+		}
+		fmt.Println()
+		formatter.Info(fmt.Sprintf("%s: %d with BASIC stub, %d BASIC, %d machine code, %d invalid",
+			plural(len(infos), "PRG"), kinds["stub"], kinds["basic"], kinds["machine code"], kinds["invalid"]))
+		if len(counts) > 0 {
+			formatter.Info("Load addresses: " + strings.Join(counts, ", "))
+		}
+	},
+}
+
+// scanPRG classifies a PRG file and notes what is unusual about it
+func scanPRG(name string, data []byte) prgInfo {
+	info := prgInfo{File: name, Size: len(data), Blocks: (len(data) + 253) / 254}
+	if len(data) < 3 {
+		info.Kind = "invalid"
+		info.Notes = append(info.Notes, "too short for a load address and data")
+		return info
+	}
+	info.Load = int(data[0]) | int(data[1])<<8
+	body := data[2:]
+	end := info.Load + len(body)
+	info.End = min(end, 0x10000) - 1
+
+	info.Kind = "machine code"
+	if info.Load == basicStart {
+		if lines, err := basic.Lines(body, info.Load); err == nil && len(lines) > 0 {
+			info.Kind = "basic"
+			if sys, ok := basic.SysCall(lines); ok {
+				info.Sys = sys
+				if len(lines) <= 2 {
+					info.Kind = "stub"
+				}
+				if sys < info.Load || sys >= end {
+					info.Notes = append(info.Notes, fmt.Sprintf("SYS %d ($%04X) is outside the file", sys, sys))
+				}
+			}
+		}
+	} else {
+		info.Notes = append(info.Notes, "not at $0801: load with ,8,1")
+	}
+
+	if end > 0x10000 {
+		info.Notes = append(info.Notes, fmt.Sprintf("%d bytes past $FFFF", end-0x10000))
+	}
+	if info.Load < 0xE000 && end > 0xD000 {
+		info.Notes = append(info.Notes, "loads into the I/O area $D000-$DFFF")
+	}
+	if info.Load < 0x0200 {
+		info.Notes = append(info.Notes, "loads into the zero page or stack")
+	}
+	return info
+}
+
+func init() {
+	prgCmd.AddCommand(prgScanCmd)
+}
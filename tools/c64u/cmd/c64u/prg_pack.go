@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/crunch"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// PRG Packing
+// =============================================================================
+
+var prgPackCmd = &cobra.Command{
+	Use:   "pack <file.prg> [--output packed.prg] [--sys ADDR] [--tool builtin|exomizer|pucrunch]",
+	Short: "Compress a PRG into a self-extracting PRG",
+	Long: `Compress a PRG into a self-extracting PRG that loads at $0801, unpacks
+itself in place and starts the program: faster to upload and to load from
+disk.
+
+The start follows the program: BASIC programs are RUN, BASIC stubs are
+started at their SYS address and other machine code at its load address.
+--sys sets the start address (hex) instead.
+
+The built-in cruncher is used by default; --tool exomizer or --tool
+pucrunch runs that tool instead, which must be installed and in PATH
+(exomizer usually packs tighter). The built-in decruncher runs from
+$0100, so programs must load at $0200 or above, and the packed file must
+end below the I/O area at $D000. Memory under the I/O area is unpacked
+into RAM.
+
+Examples:
+  c64u prg pack game.prg
+  c64u prg pack demo.prg -o demo-sfx.prg --sys 1000
+  c64u prg pack game.prg --tool exomizer && c64u runners run-prg-upload game-packed.prg`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("output")
+		sysFlag, _ := cmd.Flags().GetString("sys")
+		tool, _ := cmd.Flags().GetString("tool")
+		if out == "" {
+			out = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + "-packed.prg"
+		}
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			formatter.Error("Cannot read PRG", []string{err.Error()})
+			return
+		}
+		info := scanPRG(filepath.Base(args[0]), data)
+		if info.Kind == "invalid" {
+			formatter.Error("Cannot pack PRG", info.Notes)
+			return
+		}
+
+		// start 0 runs the BASIC program
+		start := 0
+		switch {
+		case sysFlag != "":
+			addr, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(sysFlag), "$"), "0x"), 16, 16)
+			if err != nil {
+				formatter.Error("Invalid start address", []string{fmt.Sprintf("'%s' is not a hex address", sysFlag)})
+				return
+			}
+			start = int(addr)
+		case info.Kind == "stub":
+			start = info.Sys
+		case info.Kind == "machine code":
+			start = info.Load
+			formatter.Warning(fmt.Sprintf("No BASIC stub; the program is started at its load address $%04X (use --sys to change)", start))
+		}
+
+		var packed []byte
+		switch tool {
+		case "builtin":
+			packed, err = crunch.SFX(data, start)
+		case "exomizer", "pucrunch":
+			packed, err = runCruncher(tool, args[0], start)
+		default:
+			formatter.Error("Unknown cruncher", []string{"use builtin, exomizer or pucrunch"})
+			return
+		}
+		if err != nil {
+			formatter.Error("Cannot pack PRG", []string{err.Error()})
+			return
+		}
+		if err := os.WriteFile(out, packed, 0644); err != nil {
+			formatter.Error("Cannot write PRG", []string{err.Error()})
+			return
+		}
+
+		if len(packed) >= len(data) {
+			formatter.Warning("The packed PRG is not smaller than the original")
+		}
+		how := "RUN"
+		if start != 0 {
+			how = fmt.Sprintf("SYS $%04X", start)
+		}
+		formatter.Success(fmt.Sprintf("Wrote %s", out), map[string]interface{}{
+			"load":   fmt.Sprintf("$%04X-$%04X", info.Load, info.End),
+			"start":  how,
+			"size":   fmt.Sprintf("%s → %s (%.0f%%)", plural(len(data), "byte"), plural(len(packed), "byte"), 100*float64(len(packed))/float64(len(data))),
+			"blocks": fmt.Sprintf("%d → %d", info.Blocks, (len(packed)+253)/254),
+			"tool":   tool,
+		})
+	},
+}
+
+// runCruncher packs a PRG with exomizer or pucrunch and returns the result
+func runCruncher(tool, file string, start int) ([]byte, error) {
+	bin, err := exec.LookPath(tool)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found in PATH", tool)
+	}
+	tmp, err := os.CreateTemp("", "c64u-pack-*.prg")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	var args []string
+	switch tool {
+	case "exomizer":
+		target := "basic"
+		if start != 0 {
+			target = strconv.Itoa(start)
+		}
+		args = []string{"sfx", target, "-q", "-o", tmp.Name(), file}
+	default:
+		target := "-fbasic"
+		if start != 0 {
+			target = "-x" + strconv.Itoa(start)
+		}
+		args = []string{"-c64", target, file, tmp.Name()}
+	}
+	if verbose {
+		formatter.Info(bin + " " + strings.Join(args, " "))
+	}
+	if msg, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s failed: %v: %s", tool, err, strings.TrimSpace(string(msg)))
+	}
+	return os.ReadFile(tmp.Name())
+}
+
+func init() {
+	prgCmd.AddCommand(prgPackCmd)
+	prgPackCmd.Flags().StringP("output", "o", "", "Output file (default: the PRG name with -packed.prg)")
+	prgPackCmd.Flags().String("sys", "", "Start address in hex (default: from the BASIC stub or the load address)")
+	prgPackCmd.Flags().String("tool", "builtin", "Cruncher: builtin, exomizer or pucrunch")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/ftp"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/spf13/cobra"
+)
+
+// printerCmd represents the printer command group
+var printerCmd = &cobra.Command{
+	Use:   "printer",
+	Short: "Fetch virtual printer output",
+	Long: `Retrieve the printouts of the Ultimate's virtual printer over FTP.
+
+The firmware writes each print job to the output directory configured in
+its printer settings; set printer_dir in config.toml (or --remote-dir) to
+the same path. PNG output is rendered by the firmware itself; RAW/ASCII
+output can be converted from PETSCII to text with --text.`,
+}
+
+var printerFetchCmd = &cobra.Command{
+	Use:   "fetch [--out DIR] [--text]",
+	Short: "Download all printouts",
+	Long: `Download every printout that is not yet in the local directory.
+
+Examples:
+  c64u printer fetch
+  c64u printer fetch --out ~/printouts --text`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		outDir, _ := cmd.Flags().GetString("out")
+		text, _ := cmd.Flags().GetBool("text")
+
+		conn, remoteDir := dialPrinter(cmd)
+		defer conn.Close()
+
+		files, err := printerFiles(conn, remoteDir)
+		if err != nil {
+			formatter.Error("Failed to list printer output", []string{err.Error()})
+			return
+		}
+
+		fetched := []string{}
+		rows := [][]string{}
+		for _, f := range files {
+			local := filepath.Join(outDir, f.Name)
+			if st, err := os.Stat(local); err == nil && st.Size() == f.Size {
+				continue
+			}
+			saved, err := fetchPrintout(conn, f, local, text)
+			if err != nil {
+				formatter.Error("Failed to fetch printout", []string{err.Error()})
+				return
+			}
+			fetched = append(fetched, saved)
+			rows = append(rows, []string{f.Name, formatter.Size(f.Size), saved})
+		}
+
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{
+				"remote_dir": remoteDir,
+				"fetched":    fetched,
+			})
+			return
+		}
+
+		if len(fetched) == 0 {
+			formatter.Info("No new printouts")
+			return
+		}
+		formatter.PrintTable([]string{"printout", "size", "saved_as"}, rows)
+	},
+}
+
+var printerWatchCmd = &cobra.Command{
+	Use:   "watch [--out DIR] [--text] [--interval D]",
+	Short: "Download new print jobs as they appear",
+	Long: `Poll the printer output directory and download each new print job once
+it is complete (its size stopped changing). With --text the converted text
+is also printed, so programs can be tailed as they print. Stop with Ctrl-C.
+
+Examples:
+  c64u printer watch
+  c64u printer watch --text --interval 1s`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		outDir, _ := cmd.Flags().GetString("out")
+		text, _ := cmd.Flags().GetBool("text")
+		interval, _ := cmd.Flags().GetDuration("interval")
+
+		conn, remoteDir := dialPrinter(cmd)
+		defer conn.Close()
+
+		// Existing printouts are not new jobs
+		seen := make(map[string]int64)
+		files, err := printerFiles(conn, remoteDir)
+		if err != nil {
+			formatter.Error("Failed to list printer output", []string{err.Error()})
+			return
+		}
+		for _, f := range files {
+			seen[f.Name] = f.Size
+		}
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt)
+		formatter.Info(fmt.Sprintf("Watching %s for print jobs (Ctrl-C to stop)", remoteDir))
+
+		pending := make(map[string]int64)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			files, err := printerFiles(conn, remoteDir)
+			if err != nil {
+				formatter.Warning(err.Error())
+				continue
+			}
+			for _, f := range files {
+				if size, ok := seen[f.Name]; ok && size == f.Size {
+					continue
+				}
+				// Wait until the job stopped growing
+				if size, ok := pending[f.Name]; !ok || size != f.Size || f.Size == 0 {
+					pending[f.Name] = f.Size
+					continue
+				}
+				delete(pending, f.Name)
+				seen[f.Name] = f.Size
+
+				saved, err := fetchPrintout(conn, f, filepath.Join(outDir, f.Name), text)
+				if err != nil {
+					formatter.Warning(err.Error())
+					continue
+				}
+				printJob(f, saved, text)
+			}
+		}
+	},
+}
+
+var printerClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Delete all printouts on the device",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		conn, remoteDir := dialPrinter(cmd)
+		defer conn.Close()
+
+		files, err := printerFiles(conn, remoteDir)
+		if err != nil {
+			formatter.Error("Failed to list printer output", []string{err.Error()})
+			return
+		}
+		for _, f := range files {
+			if err := conn.Delete(f.Path); err != nil {
+				formatter.Error("Failed to clear printer output", []string{err.Error()})
+				return
+			}
+		}
+
+		formatter.Success(fmt.Sprintf("Deleted %s", plural(len(files), "printout")), map[string]interface{}{
+			"remote_dir": remoteDir,
+			"deleted":    len(files),
+		})
+	},
+}
+
+// dialPrinter connects to the FTP server and resolves the printer directory
+func dialPrinter(cmd *cobra.Command) (*ftp.Client, string) {
+	remoteDir, _ := cmd.Flags().GetString("remote-dir")
+	if remoteDir == "" {
+		cfg, err := config.Load()
+		if err != nil {
+			formatter.Error("Failed to load config", []string{err.Error()})
+		}
+		remoteDir = cfg.PrinterDir
+	}
+
+	conn, err := dialFTP()
+	if err != nil {
+		formatter.Error("Failed to connect", []string{err.Error()})
+	}
+	return conn, remoteDir
+}
+
+// printerFiles lists the printouts in the printer directory
+func printerFiles(conn *ftp.Client, remoteDir string) ([]ftp.Entry, error) {
+	entries, err := conn.List(remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := entries[:0]
+	for _, e := range entries {
+		if !e.Dir {
+			files = append(files, e)
+		}
+	}
+	return files, nil
+}
+
+// fetchPrintout downloads a printout, converting PETSCII output to a .txt
+// file when text is set. It returns the path of the saved file.
+func fetchPrintout(conn *ftp.Client, f ftp.Entry, local string, text bool) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return "", err
+	}
+	if err := conn.Download(f.Path, local); err != nil {
+		return "", err
+	}
+	// Images are rendered by the firmware and .txt output is already ASCII
+	if !text || isImage(f.Name) || strings.EqualFold(filepath.Ext(local), ".txt") {
+		return local, nil
+	}
+
+	data, err := os.ReadFile(local)
+	if err != nil {
+		return "", err
+	}
+	txt := strings.TrimSuffix(local, filepath.Ext(local)) + ".txt"
+	if err := os.WriteFile(txt, []byte(petscii.ToText(data)), 0644); err != nil {
+		return "", err
+	}
+	return txt, nil
+}
+
+// printJob reports a finished print job; text output is echoed in full
+func printJob(f ftp.Entry, saved string, text bool) {
+	if jsonOut {
+		formatter.PrintData(map[string]interface{}{
+			"printout": f.Name,
+			"size":     f.Size,
+			"saved_as": saved,
+		})
+		return
+	}
+
+	formatter.Success(fmt.Sprintf("Print job %s (%s) saved to %s", f.Name, formatter.Size(f.Size), saved), nil)
+	if text && !isImage(f.Name) {
+		if data, err := os.ReadFile(saved); err == nil {
+			fmt.Print(string(data))
+		}
+	}
+}
+
+// isImage reports whether a printout was rendered as an image by the firmware
+func isImage(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".bmp":
+		return true
+	}
+	return false
+}
+
+func init() {
+	printerCmd.PersistentFlags().String("remote-dir", "", "Printer output directory on the device (default: printer_dir from config)")
+	for _, c := range []*cobra.Command{printerFetchCmd, printerWatchCmd} {
+		c.Flags().String("out", ".", "Local directory for printouts")
+		c.Flags().Bool("text", false, "Convert PETSCII (RAW/ASCII) printouts to text")
+	}
+	printerWatchCmd.Flags().Duration("interval", 2*time.Second, "Polling interval")
+
+	printerCmd.AddCommand(printerFetchCmd)
+	printerCmd.AddCommand(printerWatchCmd)
+	printerCmd.AddCommand(printerClearCmd)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/transfer"
+	"github.com/spf13/cobra"
+)
+
+// remoteCacheHashLen is the number of hex digits of the SHA-256 used in
+// cached file names
+const remoteCacheHashLen = 16
+
+// useRemoteCache reports whether a command should go through the remote
+// cache (--remote-cache or remote_cache in config.toml)
+func useRemoteCache(cmd *cobra.Command) bool {
+	flag, _ := cmd.Flags().GetBool("remote-cache")
+	return flag || remoteCache
+}
+
+// remoteCopy returns the device path of the content-addressed copy of a
+// local file, uploading it over FTP unless an identical copy exists
+func remoteCopy(local string) (remote string, uploaded bool, err error) {
+	sum, err := transfer.FileHash(local)
+	if err != nil {
+		return "", false, err
+	}
+	st, err := os.Stat(local)
+	if err != nil {
+		return "", false, err
+	}
+
+	name := sum[:remoteCacheHashLen] + strings.ToLower(filepath.Ext(local))
+	remote = path.Join(remoteCacheDir, name)
+
+	conn, err := dialFTP()
+	if err != nil {
+		return "", false, err
+	}
+	defer conn.Close()
+
+	// A size mismatch means an interrupted upload, so it is replaced
+	if entries, err := conn.List(remoteCacheDir); err == nil {
+		for _, e := range entries {
+			if e.Name == name && e.Size == st.Size() {
+				return remote, false, nil
+			}
+		}
+	}
+
+	if err := conn.MkdirAll(remoteCacheDir); err != nil {
+		return "", false, err
+	}
+	if err := conn.Upload(local, remote); err != nil {
+		return "", false, err
+	}
+	return remote, true, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/fetch"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Run Command (any runnable file, local, on the device or by URL)
+// ============================================================================
+
+var runCmd = &cobra.Command{
+	Use:   "run <file|url|-> [--song N]",
+	Short: "Run a PRG, CRT, SID or MOD file",
+	Long: `Run a file, picking the runner from its extension: PRG files are
+loaded and started, CRT files started with reset, SID and MOD files played.
+
+The file may be a local file (uploaded), a path on the C64U filesystem, an
+http(s) URL, which is downloaded first, or "-" to read it from stdin (name
+it with --stdin-name tune.sid to run something other than a PRG).
+Downloads are cached; use --no-cache to fetch again and --sha256 to verify
+the download. Archives (.zip, .gz, and the C64 formats .lnx, .ark and
+.lbr) are extracted as with the upload commands.
+
+Examples:
+  c64u run demo.prg
+  c64u run /Usb0/games/game.crt
+  c64u run https://example.com/demo.prg
+  c64u run https://example.com/tune.sid --song 2
+  make prg | c64u run -`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		arg := args[0]
+		songNr, _ := cmd.Flags().GetInt("song")
+
+		// Paths that are neither stdin, URLs nor local files are on the device
+		if _, err := os.Stat(arg); arg != "-" && !fetch.IsURL(arg) && os.IsNotExist(err) {
+			runDeviceFile(arg, songNr)
+			return
+		}
+
+		exts := append(append(append(append([]string{}, prgExts...), crtExts...), sidExts...), modExts...)
+		localFile, cleanup, ok := resolveUploadFile(cmd, arg, exts)
+		if !ok {
+			return
+		}
+		defer cleanup()
+
+		var kind string
+		var resp *api.Response
+		var err error
+		switch strings.ToLower(filepath.Ext(localFile)) {
+		case ".sid":
+			kind = "sidplay"
+			warnSIDProblems(localFile, songNr)
+			resp, err = apiClient.SidPlayUpload(localFile, songNr)
+		case ".mod":
+			kind = "modplay"
+			resp, err = apiClient.ModPlayUpload(localFile)
+		case ".crt":
+			kind = "run_crt"
+			resp, err = apiClient.RunCRTUpload(localFile)
+		case ".prg":
+			kind = "run_prg"
+			resp, err = apiClient.RunPRGUpload(localFile)
+		default:
+			formatter.Error("Unsupported file type", []string{
+				filepath.Base(localFile),
+				"run accepts .prg, .crt, .sid and .mod files",
+			})
+			return
+		}
+
+		if err != nil {
+			formatter.Error("Failed to run "+filepath.Base(localFile), []string{err.Error()})
+			return
+		}
+		if resp.HasErrors() {
+			formatter.Error("API returned errors", resp.Errors)
+			return
+		}
+
+		recordUpload(kind, "runner", localFile)
+		recordRunning(kind, localFile, songNr, true)
+		formatter.Success(fmt.Sprintf("Running: %s", filepath.Base(localFile)), nil)
+	},
+}
+
+// runDeviceFile runs a file already on the C64U filesystem
+func runDeviceFile(file string, songNr int) {
+	var resp *api.Response
+	var err error
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".sid":
+		resp, err = apiClient.SidPlay(file, songNr)
+	case ".mod":
+		resp, err = apiClient.ModPlay(file)
+	case ".prg", ".crt":
+		if runProgram(file) {
+			formatter.Success(fmt.Sprintf("Running: %s", filepath.Base(file)), nil)
+		}
+		return
+	default:
+		formatter.Error("Unsupported file type", []string{
+			filepath.Base(file),
+			"run accepts .prg, .crt, .sid and .mod files",
+		})
+		return
+	}
+
+	if err != nil {
+		formatter.Error("Failed to run "+filepath.Base(file), []string{err.Error()})
+		return
+	}
+	if resp.HasErrors() {
+		formatter.Error("API returned errors", resp.Errors)
+		return
+	}
+	kind := "sidplay"
+	if strings.EqualFold(filepath.Ext(file), ".mod") {
+		kind = "modplay"
+	}
+	recordRunning(kind, file, songNr, false)
+	formatter.Success(fmt.Sprintf("Running: %s", filepath.Base(file)), nil)
+}
+
+func init() {
+	runCmd.Flags().Int("song", 0, "Song number to play for SID files (default: 0)")
+	addUploadSourceFlags(runCmd)
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/sidfile"
 	"github.com/spf13/cobra"
 )
 
@@ -17,7 +18,13 @@ execute programs (PRG, CRT) on the C64 Ultimate.
 
 Each command has two variants:
 - Without 'upload': Uses a file already on the C64U filesystem
-- With 'upload': Uploads a local file and then executes it`,
+- With 'upload': Uploads a local file and then executes it
+
+The upload variants also accept .zip and .gz archives (as most downloads
+arrive) and Lynx, ARK and LBR archives: the file of the right type is
+extracted first. If an archive contains several, pick one with --entry
+NAME (a name or glob). Use "-" as the file
+to read it from stdin, e.g. make prg | c64u runners run-prg-upload -`,
 }
 
 // ============================================================================
@@ -44,6 +51,7 @@ var sidPlayCmd = &cobra.Command{
 			return
 		}
 
+		recordRunning("sidplay", file, songNr, false)
 		msg := fmt.Sprintf("Playing SID file: %s", filepath.Base(file))
 		if songNr > 0 {
 			msg += fmt.Sprintf(" (song %d)", songNr)
@@ -55,18 +63,23 @@ var sidPlayCmd = &cobra.Command{
 var sidPlayUploadCmd = &cobra.Command{
 	Use:   "sidplay-upload <local-file> [--song N]",
 	Short: "Upload and play SID file",
-	Long:  `Upload a local SID file to the C64 Ultimate and play it.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Upload a local SID file to the C64 Ultimate and play it.
+
+The file is checked first against what the Ultimate's SID player handles:
+RSID rules (load and init address, no play address, no BASIC tunes),
+nonstandard speed fields, NTSC tunes and extra SIDs. Problems are reported
+as warnings; the file is played anyway.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		localFile := args[0]
 		songNr, _ := cmd.Flags().GetInt("song")
 
-		// Check if file exists
-		if _, err := os.Stat(localFile); os.IsNotExist(err) {
-			formatter.Error("File not found", []string{localFile})
+		localFile, cleanup, ok := resolveUploadFile(cmd, args[0], sidExts)
+		if !ok {
 			return
 		}
+		defer cleanup()
 
+		warnSIDProblems(localFile, songNr)
 		resp, err := apiClient.SidPlayUpload(localFile, songNr)
 		if err != nil {
 			formatter.Error("Failed to upload and play SID file", []string{err.Error()})
@@ -78,6 +91,9 @@ var sidPlayUploadCmd = &cobra.Command{
 			return
 		}
 
+		recordUpload("sidplay", "runner", localFile)
+		recordRunning("sidplay", localFile, songNr, true)
+
 		msg := fmt.Sprintf("Uploaded and playing: %s", filepath.Base(localFile))
 		if songNr > 0 {
 			msg += fmt.Sprintf(" (song %d)", songNr)
@@ -86,6 +102,30 @@ var sidPlayUploadCmd = &cobra.Command{
 	},
 }
 
+// warnSIDProblems warns about what may keep a local SID file from playing
+// on the Ultimate's SID player, before it is uploaded
+func warnSIDProblems(file string, song int) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	h, err := sidfile.Parse(data)
+	if err != nil {
+		formatter.Warning(fmt.Sprintf("%s: %v", filepath.Base(file), err))
+		return
+	}
+	problems := h.Check(data, song)
+	for _, p := range problems {
+		formatter.Warning(fmt.Sprintf("%s: %s", filepath.Base(file), p))
+	}
+	if h.SecondSID != 0 {
+		formatter.Info(fmt.Sprintf("Map the second SID with: c64u sid stereo enable --second-address %04x", h.SecondSID))
+	}
+	if len(problems) > 0 && h.Format == "RSID" && !h.BasicFlag() {
+		formatter.Info("If playback fails, try: c64u sid to-prg " + filepath.Base(file))
+	}
+}
+
 // ============================================================================
 // MOD Playback Commands
 // ============================================================================
@@ -109,6 +149,7 @@ var modPlayCmd = &cobra.Command{
 			return
 		}
 
+		recordRunning("modplay", file, 0, false)
 		formatter.Success(fmt.Sprintf("Playing MOD file: %s", filepath.Base(file)), nil)
 	},
 }
@@ -119,13 +160,11 @@ var modPlayUploadCmd = &cobra.Command{
 	Long:  `Upload a local Amiga MOD file to the C64 Ultimate and play it.`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		localFile := args[0]
-
-		// Check if file exists
-		if _, err := os.Stat(localFile); os.IsNotExist(err) {
-			formatter.Error("File not found", []string{localFile})
+		localFile, cleanup, ok := resolveUploadFile(cmd, args[0], modExts)
+		if !ok {
 			return
 		}
+		defer cleanup()
 
 		resp, err := apiClient.ModPlayUpload(localFile)
 		if err != nil {
@@ -138,6 +177,8 @@ var modPlayUploadCmd = &cobra.Command{
 			return
 		}
 
+		recordUpload("modplay", "runner", localFile)
+		recordRunning("modplay", localFile, 0, true)
 		formatter.Success(fmt.Sprintf("Uploaded and playing: %s", filepath.Base(localFile)), nil)
 	},
 }
@@ -165,6 +206,7 @@ var loadPrgCmd = &cobra.Command{
 			return
 		}
 
+		recordRunning("load_prg", file, 0, false)
 		formatter.Success(fmt.Sprintf("Loaded PRG file: %s", filepath.Base(file)), nil)
 	},
 }
@@ -175,13 +217,11 @@ var loadPrgUploadCmd = &cobra.Command{
 	Long:  `Upload a local program file and load it into memory via DMA without executing it.`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		localFile := args[0]
-
-		// Check if file exists
-		if _, err := os.Stat(localFile); os.IsNotExist(err) {
-			formatter.Error("File not found", []string{localFile})
+		localFile, cleanup, ok := resolveUploadFile(cmd, args[0], prgExts)
+		if !ok {
 			return
 		}
+		defer cleanup()
 
 		resp, err := apiClient.LoadPRGUpload(localFile)
 		if err != nil {
@@ -194,6 +234,8 @@ var loadPrgUploadCmd = &cobra.Command{
 			return
 		}
 
+		recordUpload("load_prg", "runner", localFile)
+		recordRunning("load_prg", localFile, 0, true)
 		formatter.Success(fmt.Sprintf("Uploaded and loaded: %s", filepath.Base(localFile)), nil)
 	},
 }
@@ -221,6 +263,7 @@ var runPrgCmd = &cobra.Command{
 			return
 		}
 
+		recordRunning("run_prg", file, 0, false)
 		formatter.Success(fmt.Sprintf("Running PRG file: %s", filepath.Base(file)), nil)
 	},
 }
@@ -231,13 +274,11 @@ var runPrgUploadCmd = &cobra.Command{
 	Long:  `Upload a local program file, load it into memory, and automatically execute it.`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		localFile := args[0]
-
-		// Check if file exists
-		if _, err := os.Stat(localFile); os.IsNotExist(err) {
-			formatter.Error("File not found", []string{localFile})
+		localFile, cleanup, ok := resolveUploadFile(cmd, args[0], prgExts)
+		if !ok {
 			return
 		}
+		defer cleanup()
 
 		resp, err := apiClient.RunPRGUpload(localFile)
 		if err != nil {
@@ -250,6 +291,8 @@ var runPrgUploadCmd = &cobra.Command{
 			return
 		}
 
+		recordUpload("run_prg", "runner", localFile)
+		recordRunning("run_prg", localFile, 0, true)
 		formatter.Success(fmt.Sprintf("Uploaded and running: %s", filepath.Base(localFile)), nil)
 	},
 }
@@ -277,6 +320,7 @@ var runCrtCmd = &cobra.Command{
 			return
 		}
 
+		recordRunning("run_crt", file, 0, false)
 		formatter.Success(fmt.Sprintf("Starting cartridge: %s", filepath.Base(file)), nil)
 	},
 }
@@ -287,13 +331,11 @@ var runCrtUploadCmd = &cobra.Command{
 	Long:  `Upload a local cartridge file and start it with reset.`,
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		localFile := args[0]
-
-		// Check if file exists
-		if _, err := os.Stat(localFile); os.IsNotExist(err) {
-			formatter.Error("File not found", []string{localFile})
+		localFile, cleanup, ok := resolveUploadFile(cmd, args[0], crtExts)
+		if !ok {
 			return
 		}
+		defer cleanup()
 
 		resp, err := apiClient.RunCRTUpload(localFile)
 		if err != nil {
@@ -306,11 +348,15 @@ var runCrtUploadCmd = &cobra.Command{
 			return
 		}
 
+		recordUpload("run_crt", "runner", localFile)
+		recordRunning("run_crt", localFile, 0, true)
 		formatter.Success(fmt.Sprintf("Uploaded and starting: %s", filepath.Base(localFile)), nil)
 	},
 }
 
 func init() {
+	addUploadSourceFlags(sidPlayUploadCmd, modPlayUploadCmd, loadPrgUploadCmd, runPrgUploadCmd, runCrtUploadCmd)
+
 	// Add --song flag for SID commands
 	sidPlayCmd.Flags().Int("song", 0, "Song number to play (default: 0)")
 	sidPlayUploadCmd.Flags().Int("song", 0, "Song number to play (default: 0)")
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/schedule"
+	"github.com/spf13/cobra"
+)
+
+// scheduleCmd represents the schedule command group
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Manage scheduled jobs",
+	Long: `List and trigger the scheduled jobs run by "c64u daemon".
+
+Jobs are defined in config.toml:
+  [[schedule]]
+  name = "nightly-poweroff"
+  cron = "0 1 * * *"
+  command = "machine poweroff"
+
+Schedules use 5-field cron syntax (minute hour day month weekday) or the
+descriptors @hourly, @daily, @weekly, @monthly, @yearly and @every <duration>.`,
+}
+
+// loadScheduledJobs parses all jobs from the configuration
+func loadScheduledJobs() ([]*schedule.Job, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*schedule.Job
+	seen := make(map[string]bool)
+	for _, j := range cfg.Schedule {
+		job, err := schedule.NewJob(j.Name, j.Cron, j.Command)
+		if err != nil {
+			return nil, err
+		}
+		if seen[job.Name] {
+			return nil, fmt.Errorf("duplicate job name '%s'", job.Name)
+		}
+		seen[job.Name] = true
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// jobCommand builds the process running a scheduled job against the
+// same device this process is configured for
+func jobCommand(job *schedule.Job) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate c64u executable: %w", err)
+	}
+
+	args := []string{"--host", host, "--port", strconv.Itoa(port), "--no-color"}
+	if readOnly {
+		args = append(args, "--read-only")
+	}
+	args = append(args, job.Args...)
+	c := exec.Command(exe, args...)
+	// Jobs run unattended, so there is nobody to confirm with
+	c.Env = append(os.Environ(), "C64U_ASSUME_YES=true")
+	return c, nil
+}
+
+// runScheduledJob runs a job to completion, writing its output to out
+func runScheduledJob(job *schedule.Job, out io.Writer) (time.Duration, error) {
+	c, err := jobCommand(job)
+	if err != nil {
+		return 0, err
+	}
+	c.Stdout = out
+	c.Stderr = out
+
+	start := time.Now()
+	err = c.Run()
+	return time.Since(start), err
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List scheduled jobs",
+	Long:  `List all jobs defined in config.toml with their next run time.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		jobs, err := loadScheduledJobs()
+		if err != nil {
+			formatter.Error("Failed to load scheduled jobs", []string{err.Error()})
+			return
+		}
+
+		if len(jobs) == 0 {
+			formatter.Info("No scheduled jobs configured")
+			return
+		}
+
+		now := time.Now()
+		rows := make([][]string, 0, len(jobs))
+		for _, job := range jobs {
+			rows = append(rows, []string{
+				job.Name,
+				job.Spec,
+				strings.Join(job.Args, " "),
+				job.Next(now).Format("2006-01-02 15:04:05"),
+			})
+		}
+		formatter.PrintTable([]string{"name", "schedule", "command", "next_run"}, rows)
+	},
+}
+
+var scheduleRunNowCmd = &cobra.Command{
+	Use:   "run-now <name>",
+	Short: "Run a scheduled job immediately",
+	Long: `Run a scheduled job now, in the foreground, regardless of its schedule.
+
+Example:
+  c64u schedule run-now nightly-poweroff`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		jobs, err := loadScheduledJobs()
+		if err != nil {
+			formatter.Error("Failed to load scheduled jobs", []string{err.Error()})
+			return
+		}
+
+		for _, job := range jobs {
+			if job.Name != name {
+				continue
+			}
+
+			elapsed, err := runScheduledJob(job, os.Stdout)
+			if err != nil {
+				formatter.Error(fmt.Sprintf("Job '%s' failed", name), []string{err.Error()})
+				return
+			}
+
+			data := map[string]interface{}{
+				"duration": formatter.Duration(elapsed),
+			}
+			if jsonOut {
+				data = map[string]interface{}{
+					"duration_ms": elapsed.Milliseconds(),
+				}
+			}
+			formatter.Success(fmt.Sprintf("Job '%s' completed", name), data)
+			return
+		}
+
+		formatter.Error("Job not found", []string{fmt.Sprintf("No scheduled job named '%s'", name)})
+	},
+}
+
+func init() {
+	scheduleCmd.AddCommand(scheduleListCmd)
+	scheduleCmd.AddCommand(scheduleRunNowCmd)
+}
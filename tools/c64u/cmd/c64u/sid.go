@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/spf13/cobra"
+)
+
+// SID register layout
+const (
+	sidPrimary = 0xD400
+	sidSpacing = 0x20
+	sidV3Freq  = 0x0E
+	sidV3Ctrl  = 0x12
+	sidOSC3    = 0x1B
+	sidNoise   = 0x80
+)
+
+// probeReads is how often the oscillator is sampled when probing a SID
+const probeReads = 8
+
+// sidCmd represents the sid command group
+var sidCmd = &cobra.Command{
+	Use:   "sid",
+	Short: "SID chip configuration and SID files",
+	Long: `Configure the SID chips and UltiSID emulation of the Ultimate, and prepare
+SID files for playback.`,
+}
+
+var sidStereoCmd = &cobra.Command{
+	Use:   "stereo",
+	Short: "Configure a second SID for stereo playback",
+	Long: `Map a second SID (real chip or UltiSID) to its own address for stereo
+SID music.
+
+The SID address settings are read from the device configuration; --sid
+selects which one to change (any unique part of its name, default
+"UltiSID 2").`,
+}
+
+var sidStereoEnableCmd = &cobra.Command{
+	Use:   "enable [--second-address ADDR] [--sid NAME] [--save]",
+	Short: "Map the second SID and verify it responds",
+	Long: `Map the second SID to an address and check that it answers there.
+
+The address must be a $20 aligned address in $D420-$D7E0 or $DE00-$DFE0
+(the latter conflicts with cartridges using I/O 1/2). The result is checked
+by running voice 3 of the new SID and reading its oscillator, so that a
+mirror of the first SID is not mistaken for a second chip.
+
+Examples:
+  c64u sid stereo enable
+  c64u sid stereo enable --second-address d500
+  c64u sid stereo enable --second-address de00 --sid "socket 2" --save`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		addrFlag, _ := cmd.Flags().GetString("second-address")
+		name, _ := cmd.Flags().GetString("sid")
+		save, _ := cmd.Flags().GetBool("save")
+
+		address, warning, err := validateSIDAddress(addrFlag)
+		if err != nil {
+			formatter.Error("Invalid SID address", []string{err.Error()})
+			return
+		}
+		if warning != "" {
+			formatter.Warning(warning)
+		}
+
+		item, ok := sidAddressSetting(name)
+		if !ok {
+			return
+		}
+
+		value := fmt.Sprintf("$%04X", address)
+		options := configOptions(item)
+		if len(options) > 0 {
+			opt, ok := matchSIDOption(options, address)
+			if !ok {
+				formatter.Error("Address not supported by the firmware", []string{fmt.Sprintf("%s cannot be mapped to %s; options: %s", item.Name, value, strings.Join(options, ", "))})
+				return
+			}
+			value = opt
+		}
+
+		if !setConfigItem(item, value) {
+			return
+		}
+
+		responds, err := probeSID(address)
+		if err != nil {
+			formatter.Error("Failed to probe the second SID", []string{err.Error()})
+			return
+		}
+		if !responds {
+			previous := fmt.Sprintf("%v", item.Value)
+			if !setConfigItem(item, previous) {
+				return
+			}
+			formatter.Error("Second SID does not respond", []string{
+				fmt.Sprintf("no independent SID answers at $%04X; %s was reset to %s", address, item.Name, previous),
+				"check that the SID socket is populated or the UltiSID is enabled",
+			})
+			return
+		}
+
+		if save && !saveConfigToFlash() {
+			return
+		}
+		formatter.Success(fmt.Sprintf("Second SID mapped to $%04X", address), map[string]interface{}{
+			"setting":  item.Name,
+			"previous": item.Value,
+			"verified": true,
+		})
+	},
+}
+
+var sidStereoDisableCmd = &cobra.Command{
+	Use:   "disable [--sid NAME] [--save]",
+	Short: "Unmap the second SID",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("sid")
+		save, _ := cmd.Flags().GetBool("save")
+
+		item, ok := sidAddressSetting(name)
+		if !ok {
+			return
+		}
+
+		value := "Unmapped"
+		for _, opt := range configOptions(item) {
+			lower := strings.ToLower(opt)
+			if strings.Contains(lower, "unmap") || strings.Contains(lower, "off") || strings.Contains(lower, "disable") {
+				value = opt
+				break
+			}
+		}
+
+		if !setConfigItem(item, value) {
+			return
+		}
+		if save && !saveConfigToFlash() {
+			return
+		}
+		formatter.Success(fmt.Sprintf("%s set to %s", item.Name, value), map[string]interface{}{
+			"previous": item.Value,
+		})
+	},
+}
+
+var sidStereoStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the SID address settings",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		items, ok := sidAddressSettings()
+		if !ok {
+			return
+		}
+		printConfigItems(items)
+	},
+}
+
+// validateSIDAddress checks a second SID address, returning a warning for
+// addresses that work but may conflict with cartridges
+func validateSIDAddress(s string) (int, string, error) {
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "$"), "0x"), 16, 16)
+	if err != nil {
+		return 0, "", fmt.Errorf("'%s' is not a hex address", s)
+	}
+	a := int(addr)
+
+	switch {
+	case a%sidSpacing != 0:
+		return 0, "", fmt.Errorf("$%04X is not a multiple of $%02X", a, sidSpacing)
+	case a == sidPrimary:
+		return 0, "", fmt.Errorf("$%04X is the first SID's address", a)
+	case a > sidPrimary && a < 0xD800:
+		return a, "", nil
+	case a >= 0xDE00 && a < 0xE000:
+		return a, fmt.Sprintf("$%04X is in the cartridge I/O area and conflicts with cartridges using it", a), nil
+	}
+	return 0, "", fmt.Errorf("$%04X is outside $D420-$D7E0 and $DE00-$DFE0", a)
+}
+
+// sidAddressSettings returns the SID address configuration items
+func sidAddressSettings() ([]api.ConfigItem, bool) {
+	items, err := apiClient.ConfigItems("*SID*", "*Address*")
+	if err == nil && len(items) == 0 {
+		err = fmt.Errorf("the device has no SID address settings")
+	}
+	if err != nil {
+		formatter.Error("Failed to read SID settings", []string{err.Error()})
+		return nil, false
+	}
+	return items, true
+}
+
+// sidAddressSetting finds the address setting of the named SID
+func sidAddressSetting(name string) (api.ConfigItem, bool) {
+	items, ok := sidAddressSettings()
+	if !ok {
+		return api.ConfigItem{}, false
+	}
+	item, err := matchConfigItem(items, name)
+	if err != nil {
+		formatter.Error("Unknown SID", []string{err.Error()})
+		return api.ConfigItem{}, false
+	}
+	return item, true
+}
+
+// matchSIDOption finds the option naming address, e.g. "$D420" or "D420"
+func matchSIDOption(options []string, address int) (string, bool) {
+	want := fmt.Sprintf("%04X", address)
+	for _, opt := range options {
+		if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(opt), "$"), want) {
+			return opt, true
+		}
+	}
+	return "", false
+}
+
+// probeSID runs voice 3 of the SID at base with the noise waveform and
+// checks that its oscillator register changes while the first SID's stays
+// still, which rules out a mirror of the first SID
+func probeSID(base int) (bool, error) {
+	if err := writeMemory(sidPrimary+sidV3Ctrl, []byte{0}); err != nil {
+		return false, err
+	}
+	if err := writeMemory(base+sidV3Freq, []byte{0xFF, 0xFF}); err != nil {
+		return false, err
+	}
+	if err := writeMemory(base+sidV3Ctrl, []byte{sidNoise}); err != nil {
+		return false, err
+	}
+	defer writeMemory(base+sidV3Ctrl, []byte{0})
+
+	second, err := distinctReads(base + sidOSC3)
+	if err != nil {
+		return false, err
+	}
+	first, err := distinctReads(sidPrimary + sidOSC3)
+	if err != nil {
+		return false, err
+	}
+	return second > 1 && first <= 1, nil
+}
+
+// distinctReads samples a register and counts the distinct values seen
+func distinctReads(address int) (int, error) {
+	seen := make(map[byte]bool)
+	for i := 0; i < probeReads; i++ {
+		data, err := readMemory(address, 1)
+		if err != nil {
+			return 0, err
+		}
+		seen[data[0]] = true
+	}
+	return len(seen), nil
+}
+
+func init() {
+	sidStereoEnableCmd.Flags().String("second-address", "d420", "Address of the second SID (hex)")
+	for _, c := range []*cobra.Command{sidStereoEnableCmd, sidStereoDisableCmd} {
+		c.Flags().String("sid", "UltiSID 2", "SID address setting to change")
+		c.Flags().Bool("save", false, "Save the configuration to flash")
+	}
+	addPreserveFlags(sidStereoEnableCmd, sidStereoDisableCmd)
+
+	sidStereoCmd.AddCommand(sidStereoEnableCmd)
+	sidStereoCmd.AddCommand(sidStereoDisableCmd)
+	sidStereoCmd.AddCommand(sidStereoStatusCmd)
+	sidCmd.AddCommand(sidStereoCmd)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/hvsc"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/sidfile"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// SID file information
+// =============================================================================
+
+// errNoHVSC is returned by lookupHVSC when no HVSC copy or STIL is
+// configured
+var errNoHVSC = errors.New("no HVSC directory or STIL configured (hvsc_dir, stil_path)")
+
+// lookupHVSC finds the song lengths and STIL entry of a SID file in the
+// HVSC copy at dir (default hvsc_dir) and the STIL at stil_path. local is
+// the file's path if it is local, to look it up by its place in the
+// collection. The parsed databases are cached in the cache directory.
+func lookupHVSC(dir string, data []byte, local string) ([]time.Duration, *hvsc.Entry, error) {
+	stil := ""
+	if cfg, err := config.Load(); err == nil {
+		if dir == "" {
+			dir = cfg.HVSCDir
+		}
+		stil = cfg.STILPath
+	}
+	if dir == "" && stil == "" {
+		return nil, nil, errNoHVSC
+	}
+
+	var src hvsc.Sources
+	if dir != "" {
+		src = hvsc.Locate(dir)
+	}
+	if stil != "" {
+		src.STIL = stil
+	}
+	db, err := hvsc.Load(src, filepath.Join(config.GetConfigDir(), "cache", "hvsc"))
+	if err != nil {
+		if dir != "" {
+			return nil, nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		return nil, nil, err
+	}
+	path := ""
+	if abs, err := filepath.Abs(local); err == nil && local != "" && dir != "" {
+		path = hvsc.CollectionPath(dir, abs)
+	}
+	lengths, entry := db.Lookup(data, path)
+	return lengths, entry, nil
+}
+
+var sidInfoCmd = &cobra.Command{
+	Use:   "info <file.sid> [--hvsc DIR]",
+	Short: "Show the header and STIL information of a SID file",
+	Long: `Show the header of a local or device SID file (addresses, songs, timing,
+video standard, SID model and extra SIDs) and, from a local HVSC copy, the
+length of each song and the STIL commentary: comments on the tune and its
+songs, song names and the originals of covers.
+
+The HVSC copy is --hvsc or hvsc_dir in the configuration; stil_path
+selects another STIL.txt. Device files are read via FTP.
+
+Examples:
+  c64u sid info commando.sid
+  c64u sid info /Usb0/music/tune.sid --hvsc ~/C64Music
+  c64u --json sid info tune.sid`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		hvscDir, _ := cmd.Flags().GetString("hvsc")
+
+		local := args[0]
+		data, err := os.ReadFile(local)
+		if os.IsNotExist(err) {
+			local = ""
+			data, err = retrieveDeviceFile(args[0])
+		}
+		if err != nil {
+			formatter.Error("Cannot read SID file", []string{err.Error()})
+			return
+		}
+		h, err := sidfile.Parse(data)
+		if err != nil {
+			formatter.Error("Cannot read SID file", []string{err.Error()})
+			return
+		}
+		lengths, entry, err := lookupHVSC(hvscDir, data, local)
+		if err != nil && (err != errNoHVSC) {
+			formatter.Warning(fmt.Sprintf("No song lengths and STIL: %v", err))
+		}
+
+		type songInfo struct {
+			Song   int        `json:"song"`
+			Length string     `json:"length,omitempty"`
+			Timing string     `json:"timing"`
+			STIL   *hvsc.Song `json:"stil,omitempty"`
+		}
+		songs := make([]songInfo, 0, h.Songs)
+		for n := 1; n <= h.Songs; n++ {
+			s := songInfo{Song: n, Timing: "vbi", STIL: entry.Song(n, h.Songs)}
+			if h.UsesCIA(n) {
+				s.Timing = "cia"
+			}
+			if n <= len(lengths) {
+				s.Length = formatLength(lengths[n-1])
+			}
+			songs = append(songs, s)
+		}
+
+		if jsonOut {
+			result := map[string]interface{}{"header": h, "songs": songs}
+			if entry != nil && entry.Comment != "" {
+				result["comment"] = entry.Comment
+			}
+			formatter.PrintData(result)
+			return
+		}
+
+		formatter.PrintHeader(h.Title)
+		fmt.Println()
+		formatter.PrintKeyValue("Author", h.Author)
+		formatter.PrintKeyValue("Released", h.Released)
+		formatter.PrintKeyValue("Format", fmt.Sprintf("%s v%d", h.Format, h.Version))
+		formatter.PrintKeyValue("Songs", fmt.Sprintf("%d (start song %d)", h.Songs, h.StartSong))
+		formatter.PrintKeyValue("Load", fmt.Sprintf("$%04X-$%04X", h.LoadAddress, int(h.LoadAddress)+len(h.Payload(data))-1))
+		formatter.PrintKeyValue("Init", fmt.Sprintf("$%04X", h.Init()))
+		formatter.PrintKeyValue("Play", fmt.Sprintf("$%04X", h.PlayAddress))
+		if clock := [...]string{"", "PAL", "NTSC", "PAL/NTSC"}[h.Clock()]; clock != "" {
+			formatter.PrintKeyValue("Video", clock)
+		}
+		if model := h.Model(); model != "" {
+			formatter.PrintKeyValue("SID model", model)
+		}
+		if h.SecondSID != 0 {
+			extra := fmt.Sprintf("$%04X", h.SecondSID)
+			if h.ThirdSID != 0 {
+				extra += fmt.Sprintf(", $%04X", h.ThirdSID)
+			}
+			formatter.PrintKeyValue("Extra SIDs", extra)
+		}
+		if entry != nil && entry.Comment != "" {
+			formatter.PrintKeyValue("Comment", entry.Comment)
+		}
+		fmt.Println()
+
+		rows := make([][]string, 0, len(songs))
+		for _, s := range songs {
+			comment := ""
+			if s.STIL != nil {
+				comment = s.STIL.Comment
+			}
+			rows = append(rows, []string{strconv.Itoa(s.Song), s.Length, strings.ToUpper(s.Timing),
+				truncate(s.STIL.Label(), 40), truncate(comment, 60)})
+		}
+		formatter.PrintTable([]string{"song", "length", "timing", "name", "comment"}, rows)
+	},
+}
+
+func init() {
+	sidCmd.AddCommand(sidInfoCmd)
+	sidInfoCmd.Flags().String("hvsc", "", "Local HVSC directory for song lengths and STIL (default from hvsc_dir)")
+}
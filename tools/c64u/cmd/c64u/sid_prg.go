@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/sidfile"
+	"github.com/spf13/cobra"
+)
+
+// =============================================================================
+// SID to PRG
+// =============================================================================
+
+var sidToPrgCmd = &cobra.Command{
+	Use:   "to-prg <file.sid> [--output player.prg] [--song N]",
+	Short: "Wrap a SID file in a PRG player",
+	Long: `Build a PRG that plays a PSID/RSID tune without the Ultimate's SID player,
+for setups where "runners sidplay" misbehaves. The PRG shows the title,
+author and release, moves the tune to its load address, calls init with
+the song number and then play from a raster interrupt or a CIA timer
+(60 Hz, PAL or NTSC rate from the header), as the header asks for.
+
+The player is put in the free memory the header declares, in the cassette
+buffer or in a free page. Tunes in the I/O area and RSID tunes that need
+BASIC cannot be wrapped. Run the result with "runners run-prg-upload".
+
+Examples:
+  c64u sid to-prg commando.sid
+  c64u sid to-prg tune.sid -o tune.prg --song 3
+  c64u sid to-prg tune.sid && c64u runners run-prg-upload tune.prg`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("output")
+		song, _ := cmd.Flags().GetInt("song")
+		if out == "" {
+			out = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + ".prg"
+		}
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			formatter.Error("Cannot read SID file", []string{err.Error()})
+			return
+		}
+		h, err := sidfile.Parse(data)
+		if err != nil {
+			formatter.Error("Cannot read SID file", []string{err.Error()})
+			return
+		}
+		if song == 0 {
+			song = h.StartSong
+		}
+		prg, err := sidfile.WrapPRG(h, data, song)
+		if err != nil {
+			formatter.Error("Cannot build player", []string{err.Error()})
+			return
+		}
+		if err := os.WriteFile(out, prg, 0644); err != nil {
+			formatter.Error("Cannot write PRG", []string{err.Error()})
+			return
+		}
+
+		timing := "raster interrupt"
+		switch {
+		case h.PlayAddress == 0:
+			timing = "tune's own interrupt"
+		case h.UsesCIA(song) || h.Format == "RSID":
+			timing = "CIA timer"
+		}
+		formatter.Success(fmt.Sprintf("Wrote %s", out), map[string]interface{}{
+			"title":  h.Title,
+			"song":   fmt.Sprintf("%d of %d", song, h.Songs),
+			"load":   fmt.Sprintf("$%04X-$%04X", h.LoadAddress, int(h.LoadAddress)+len(h.Payload(data))-1),
+			"init":   fmt.Sprintf("$%04X", h.Init()),
+			"play":   fmt.Sprintf("$%04X", h.PlayAddress),
+			"timing": timing,
+			"size":   plural(len(prg), "byte"),
+		})
+	},
+}
+
+func init() {
+	sidCmd.AddCommand(sidToPrgCmd)
+	sidToPrgCmd.Flags().StringP("output", "o", "", "Output file (default: the SID file with .prg extension)")
+	sidToPrgCmd.Flags().Int("song", 0, "Song to play (default: the start song)")
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/fetch"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/hvsc"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/sidfile"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// SID Playback with Song Browser
+// ============================================================================
+
+var sidplayCmd = &cobra.Command{
+	Use:   "sidplay <file> [--song N] [--interactive] [--hvsc DIR]",
+	Short: "Play a SID file and browse its songs",
+	Long: `Play a SID file, a local one (uploaded) or one on the C64U filesystem.
+
+With --interactive the songs of the tune are listed and can be switched
+with the arrow keys: up/down select a song, Enter plays it, left/right
+play the previous/next song, q quits (the tune keeps playing). Device
+files are read via FTP for their header.
+
+Song names and lengths come from a local copy of the High Voltage SID
+Collection (--hvsc or hvsc_dir in the configuration, stil_path for a STIL
+elsewhere): its DOCUMENTS/Songlengths.md5 and DOCUMENTS/STIL.txt are
+looked up by the file's MD5, or by its path for files inside the
+collection. The selected song's STIL comment is shown below the list.
+
+Examples:
+  c64u sidplay commando.sid --song 2
+  c64u sidplay ~/C64Music/MUSICIANS/H/Hubbard_Rob/Commando.sid -i
+  c64u sidplay /Usb0/music/tune.sid --interactive --hvsc ~/C64Music`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		song, _ := cmd.Flags().GetInt("song")
+		interactive, _ := cmd.Flags().GetBool("interactive")
+		hvscDir, _ := cmd.Flags().GetString("hvsc")
+		if interactive && (jsonOut || !output.IsTerminal(os.Stdin) || !output.IsTerminal(os.Stdout)) {
+			formatter.Error("--interactive needs a terminal", []string{"run it without --json and without redirecting input or output"})
+			return
+		}
+
+		p := &sidPlayer{}
+		arg := args[0]
+		if _, err := os.Stat(arg); arg != "-" && !fetch.IsURL(arg) && os.IsNotExist(err) {
+			p.device = arg
+			if interactive {
+				data, err := retrieveDeviceFile(arg)
+				if err != nil {
+					formatter.Error("Cannot read the SID file from the device", []string{err.Error()})
+					return
+				}
+				p.data = data
+			}
+		} else {
+			localFile, cleanup, ok := resolveUploadFile(cmd, arg, sidExts)
+			if !ok {
+				return
+			}
+			defer cleanup()
+			p.local = localFile
+			p.data, _ = os.ReadFile(localFile)
+			warnSIDProblems(localFile, song)
+		}
+
+		if !interactive {
+			if err := p.play(song); err != nil {
+				formatter.Error("Failed to play SID file", []string{err.Error()})
+				return
+			}
+			msg := fmt.Sprintf("Playing SID file: %s", p.name())
+			if song > 0 {
+				msg += fmt.Sprintf(" (song %d)", song)
+			}
+			formatter.Success(msg, nil)
+			return
+		}
+
+		h, err := sidfile.Parse(p.data)
+		if err != nil {
+			formatter.Error("Cannot read SID file", []string{err.Error()})
+			return
+		}
+		p.header = h
+		if lengths, entry, err := lookupHVSC(hvscDir, p.data, p.local); err == nil {
+			p.lengths, p.stil = lengths, entry
+		} else if err != errNoHVSC {
+			formatter.Warning(fmt.Sprintf("No song names and lengths: %v", err))
+		}
+		if song == 0 {
+			song = h.StartSong
+		}
+		p.browse(min(max(song, 1), max(h.Songs, 1)))
+	},
+}
+
+// retrieveDeviceFile reads a file from the device via FTP
+func retrieveDeviceFile(remote string) ([]byte, error) {
+	conn, err := dialFTP()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var buf bytes.Buffer
+	if err := conn.Retrieve(remote, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sidPlayer plays the songs of a local (uploaded) or device SID file
+type sidPlayer struct {
+	local  string
+	device string
+	data   []byte
+
+	header  *sidfile.Header
+	lengths []time.Duration
+	stil    *hvsc.Entry
+}
+
+func (p *sidPlayer) name() string {
+	if p.device != "" {
+		return filepath.Base(p.device)
+	}
+	return filepath.Base(p.local)
+}
+
+// play starts a song (0 for the default song)
+func (p *sidPlayer) play(song int) error {
+	if p.device != "" {
+		resp, err := apiClient.SidPlay(p.device, song)
+		if err == nil && resp.HasErrors() {
+			err = fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+		}
+		if err != nil {
+			return err
+		}
+		recordRunning("sidplay", p.device, song, false)
+		return nil
+	}
+	resp, err := apiClient.SidPlayUpload(p.local, song)
+	if err == nil && resp.HasErrors() {
+		err = fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+	}
+	if err != nil {
+		return err
+	}
+	recordUpload("sidplay", "runner", p.local)
+	recordRunning("sidplay", p.local, song, true)
+	return nil
+}
+
+// songLength returns the length of a song, or 0 if unknown
+func (p *sidPlayer) songLength(song int) time.Duration {
+	if song >= 1 && song <= len(p.lengths) {
+		return p.lengths[song-1]
+	}
+	return 0
+}
+
+// songName returns the STIL name or title of a song
+func (p *sidPlayer) songName(song int) string {
+	return p.stil.Song(song, p.header.Songs).Label()
+}
+
+// browseKey is a key press in the song browser
+type browseKey int
+
+const (
+	keyNone browseKey = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyEnter
+	keyQuit
+)
+
+// browse runs the interactive song list, starting with song playing
+func (p *sidPlayer) browse(song int) {
+	state, err := term.MakeRaw(os.Stdin.Fd())
+	if err != nil {
+		formatter.Error("Cannot switch the terminal to raw mode", []string{err.Error()})
+		return
+	}
+	restore := func() {
+		term.Restore(os.Stdin.Fd(), state)
+		fmt.Print("\033[?25h")
+	}
+	defer restore()
+	output.OnExit(func(int) { restore() })
+	fmt.Print("\033[?25l\033[H\033[2J")
+
+	keys := make(chan browseKey)
+	go readBrowseKeys(keys)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	songs := max(p.header.Songs, 1)
+	cursor, playing := song, 0
+	var started time.Time
+	status := ""
+	start := func(n int) {
+		if err := p.play(n); err != nil {
+			status = fmt.Sprintf("Failed to play song %d: %v", n, err)
+			return
+		}
+		playing, started, status = n, time.Now(), ""
+	}
+	start(song)
+
+	for {
+		p.render(cursor, playing, time.Since(started), status)
+		select {
+		case <-ticker.C:
+			continue
+		case k := <-keys:
+			switch k {
+			case keyUp:
+				cursor = max(cursor-1, 1)
+			case keyDown:
+				cursor = min(cursor+1, songs)
+			case keyLeft:
+				if playing > 1 {
+					cursor = playing - 1
+					start(cursor)
+				}
+			case keyRight:
+				if playing < songs {
+					cursor = playing + 1
+					start(cursor)
+				}
+			case keyEnter:
+				start(cursor)
+			case keyQuit:
+				fmt.Print("\033[H\033[2J")
+				return
+			}
+		}
+	}
+}
+
+// readBrowseKeys decodes key presses from the raw terminal
+func readBrowseKeys(keys chan<- browseKey) {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			keys <- keyQuit
+			return
+		}
+		in := string(buf[:n])
+		k := keyNone
+		switch in {
+		case "\033[A", "\033OA", "k":
+			k = keyUp
+		case "\033[B", "\033OB", "j":
+			k = keyDown
+		case "\033[D", "\033OD", "h":
+			k = keyLeft
+		case "\033[C", "\033OC", "l":
+			k = keyRight
+		case "\r", "\n", " ":
+			k = keyEnter
+		case "q", "Q", "\033", "\x03":
+			k = keyQuit
+		}
+		if k != keyNone {
+			keys <- k
+		}
+	}
+}
+
+// render draws the song list, with the window scrolled to the cursor
+func (p *sidPlayer) render(cursor, playing int, elapsed time.Duration, status string) {
+	width, height := 80, 24
+	if w, h, err := term.GetSize(os.Stdout.Fd()); err == nil && w > 0 && h > 0 {
+		width, height = max(w, 20), h
+	}
+	h := p.header
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(truncate(s, width) + "\033[K\r\n")
+	}
+
+	b.WriteString("\033[H")
+	line(fmt.Sprintf("%s — %s", h.Title, h.Author))
+	line(h.Released)
+	if p.stil != nil && p.stil.Comment != "" {
+		line(p.stil.Comment)
+	}
+	line("")
+
+	songs := max(h.Songs, 1)
+	rows := max(height-strings.Count(b.String(), "\n")-4, 1)
+	first := min(max(cursor-rows/2, 1), max(songs-rows+1, 1))
+	for n := first; n < first+rows && n <= songs; n++ {
+		mark := " "
+		if n == playing {
+			mark = "▶"
+		}
+		length := "     "
+		if d := p.songLength(n); d > 0 {
+			length = fmt.Sprintf("%5s", formatLength(d))
+		}
+		text := fmt.Sprintf("%s %3d  %s  %s", mark, n, length, p.songName(n))
+		if n == cursor {
+			b.WriteString("\033[7m" + truncate(text, width) + "\033[0m\033[K\r\n")
+		} else {
+			line(text)
+		}
+	}
+	b.WriteString("\033[J\r\n")
+	comment := ""
+	if s := p.stil.Song(cursor, songs); s != nil {
+		comment = s.Comment
+	}
+	line(comment)
+
+	info := status
+	if info == "" && playing > 0 {
+		info = fmt.Sprintf("Song %d/%d  %s", playing, songs, formatLength(elapsed))
+		if d := p.songLength(playing); d > 0 {
+			info += " / " + formatLength(d)
+		}
+	}
+	line(info)
+	b.WriteString(truncate("↑↓ select  Enter play  ←→ previous/next  q quit", width) + "\033[K")
+	os.Stdout.WriteString(b.String())
+}
+
+// formatLength formats a song length as m:ss
+func formatLength(d time.Duration) string {
+	s := int(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+func init() {
+	sidplayCmd.Flags().Int("song", 0, "Song to play first (default: the tune's start song)")
+	sidplayCmd.Flags().BoolP("interactive", "i", false, "Browse and switch the songs")
+	sidplayCmd.Flags().String("hvsc", "", "Local HVSC directory for song names and lengths (default from hvsc_dir)")
+	addUploadSourceFlags(sidplayCmd)
+}
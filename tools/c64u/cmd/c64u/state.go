@@ -0,0 +1,550 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/ftp"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/mounts"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Machine State Bundles
+// ============================================================================
+
+// stateVersion is the version of the bundle manifest
+const stateVersion = 1
+
+// stateManifest is manifest.json in a state bundle
+type stateManifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Tool    string    `json:"tool"`
+	// Device is the product, firmware and hostname of the exporting device
+	Device map[string]string `json:"device,omitempty"`
+	Paused bool              `json:"paused"`
+	Memory []stateRegion     `json:"memory,omitempty"`
+	Drives []stateDrive      `json:"drives,omitempty"`
+	Config bool              `json:"config"`
+}
+
+// stateRegion is a block of memory stored in the bundle
+type stateRegion struct {
+	Name    string `json:"name"`
+	Address int    `json:"address"`
+	Length  int    `json:"length"`
+	File    string `json:"file"`
+}
+
+// stateDrive is a drive and what it had mounted; Copy is the file in the
+// bundle holding the image, if it was included
+type stateDrive struct {
+	Drive string `json:"drive"`
+	BusID int    `json:"bus_id"`
+	Image string `json:"image,omitempty"`
+	Type  string `json:"type,omitempty"`
+	Mode  string `json:"mode,omitempty"`
+	Copy  string `json:"copy,omitempty"`
+}
+
+// stateRegions are the memory blocks DMA can read without side effects.
+// $D000-$DFFF holds the I/O registers, where a read can acknowledge
+// interrupts; only color RAM is taken from there.
+var stateRegions = []stateRegion{
+	{Name: "ram", Address: 0x0000, Length: 0xD000, File: "ram-0000.bin"},
+	{Name: "ram", Address: 0xE000, Length: 0x2000, File: "ram-e000.bin"},
+	{Name: "color", Address: 0xD800, Length: 0x0400, File: "color.bin"},
+}
+
+// stateSkipCategories are configuration categories that belong to the
+// device, not the machine setup, and are not exported
+var stateSkipCategories = []string{"network", "wifi"}
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Export and import machine setups as bundles",
+	Long: `Save the memory, mounted disk images and configuration of the machine
+into a zip file and restore them, on the same or another device, to hand
+someone an exact setup.
+
+The API cannot read or set the CPU registers or the VIC, SID and CIA
+registers, so a bundle is a setup rather than a freeze: after an import
+the CPU carries on from wherever it was on the importing machine. It
+reproduces a machine waiting at a prompt or a program loaded but not
+started, not one in the middle of running.`,
+}
+
+var stateExportCmd = &cobra.Command{
+	Use:   "export <bundle.zip> [--images] [--no-config] [--no-pause]",
+	Short: "Save memory, mounts and configuration into a bundle",
+	Long: `Write a state bundle, a zip file with:
+
+  manifest.json     device, drives and their mounted images, regions
+  ram-0000.bin      memory $0000-$CFFF
+  ram-e000.bin      memory $E000-$FFFF
+  color.bin         color RAM $D800-$DBFF
+  config.json       the device configuration, without network settings
+  images/           copies of the mounted images, with --images
+
+Memory is read by DMA as the CPU sees it: where BASIC or KERNAL ROM is
+banked in, the ROM is saved and the RAM below is not, and the I/O area
+$D000-$DFFF is left out except color RAM because reading its registers
+can change them. The machine is paused while memory is read, unless
+--no-pause is given.
+
+Without --images, the bundle refers to the images by their path on the
+device, so the importing device needs the same files there; --images
+copies them in via FTP, or from the local file for uploaded images.
+
+Examples:
+  c64u state export level3.zip
+  c64u state export repro.zip --images`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		images, _ := cmd.Flags().GetBool("images")
+		noConfig, _ := cmd.Flags().GetBool("no-config")
+		noPause, _ := cmd.Flags().GetBool("no-pause")
+
+		manifest := stateManifest{
+			Version: stateVersion,
+			Created: time.Now(),
+			Tool:    "c64u " + version,
+			Config:  !noConfig,
+		}
+		if resp, err := apiClient.GetInfo(); err == nil && !resp.HasErrors() {
+			manifest.Device = map[string]string{}
+			for _, key := range []string{"product", "firmware_version", "hostname"} {
+				if s, ok := resp.Data[key].(string); ok {
+					manifest.Device[key] = s
+				}
+			}
+		}
+
+		drives, err := stateDrives()
+		if err != nil {
+			formatter.Error("Failed to read the drives", []string{err.Error()})
+			return
+		}
+		manifest.Drives = drives
+
+		files := map[string][]byte{}
+		if !noConfig {
+			values, err := stateConfig()
+			if err != nil {
+				formatter.Error("Failed to read the configuration", []string{err.Error()})
+				return
+			}
+			files["config.json"], _ = json.MarshalIndent(values, "", "  ")
+		}
+
+		// Pausing is refused in read-only mode, which is no reason to fail
+		pause := !noPause
+		if pause && readOnly {
+			formatter.Warning("Read-only mode: memory is read without pausing the machine")
+			pause = false
+		}
+		if pause && !machineStep("pause machine", apiClient.MachinePause) {
+			return
+		}
+		// formatter.Error exits, so the machine is resumed before any error
+		var readErr error
+		for _, r := range stateRegions {
+			data, err := readMemory(r.Address, r.Length)
+			if err != nil {
+				readErr = fmt.Errorf("$%04X-$%04X: %w", r.Address, r.Address+r.Length-1, err)
+				break
+			}
+			files[r.File] = data
+			manifest.Memory = append(manifest.Memory, r)
+		}
+		if pause {
+			if err := apiStep(apiClient.MachineResume); err != nil {
+				formatter.Warning(fmt.Sprintf("Failed to resume machine: %v", err))
+			}
+		}
+		if readErr != nil {
+			formatter.Error("Failed to read memory", []string{readErr.Error()})
+			return
+		}
+		manifest.Paused = pause
+
+		if images {
+			if err := stateCopyImages(manifest.Drives, files); err != nil {
+				formatter.Error("Failed to copy the mounted images", []string{
+					err.Error(),
+					"Export without --images to refer to the images by their path on the device",
+				})
+				return
+			}
+		}
+
+		files["manifest.json"], _ = json.MarshalIndent(manifest, "", "  ")
+		if err := writeStateBundle(args[0], files); err != nil {
+			formatter.Error("Failed to write bundle", []string{err.Error()})
+			return
+		}
+
+		mounted, size := 0, 0
+		for _, d := range manifest.Drives {
+			if d.Image != "" {
+				mounted++
+			}
+		}
+		for _, r := range manifest.Memory {
+			size += r.Length
+		}
+		data := map[string]interface{}{
+			"file":   args[0],
+			"memory": size,
+			"mounts": mounted,
+			"config": !noConfig,
+			"images": images,
+			"paused": pause,
+		}
+		if !jsonOut {
+			data["memory"] = formatter.Size(int64(size))
+		}
+		formatter.Success("Machine state exported", data)
+	},
+}
+
+var stateImportCmd = &cobra.Command{
+	Use:   "import <bundle.zip> [--no-config] [--no-mounts] [--no-memory] [--save]",
+	Short: "Restore memory, mounts and configuration from a bundle",
+	Long: `Restore a bundle written by "state export": first the configuration,
+then the drives, then memory with the machine paused.
+
+Drives that were empty in the bundle are emptied. An image the bundle only
+refers to must exist at the same path on this device; an image copied into
+the bundle is uploaded. Problems with single mounts or settings do not stop
+the import; they are listed at the end, and the command exits 1.
+
+The configuration is changed until the next power cycle; --save stores it
+in flash. Since the import replaces memory and mounts, it asks first
+unless --yes is given.
+
+Examples:
+  c64u state import level3.zip
+  c64u state import repro.zip --no-config --yes`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		noConfig, _ := cmd.Flags().GetBool("no-config")
+		noMounts, _ := cmd.Flags().GetBool("no-mounts")
+		noMemory, _ := cmd.Flags().GetBool("no-memory")
+		save, _ := cmd.Flags().GetBool("save")
+
+		zr, err := zip.OpenReader(args[0])
+		if err != nil {
+			formatter.Error("Failed to open bundle", []string{err.Error()})
+			return
+		}
+		defer zr.Close()
+		readFile := func(name string) ([]byte, error) {
+			f, err := zr.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return io.ReadAll(f)
+		}
+
+		var manifest stateManifest
+		raw, err := readFile("manifest.json")
+		if err == nil {
+			err = json.Unmarshal(raw, &manifest)
+		}
+		if err != nil {
+			formatter.Error("Not a state bundle", []string{err.Error()})
+			return
+		}
+		if manifest.Version != stateVersion {
+			formatter.Error("Unsupported bundle", []string{fmt.Sprintf("manifest version %d, expected %d", manifest.Version, stateVersion)})
+			return
+		}
+
+		if !confirmCmd(cmd, fmt.Sprintf("Replace the memory, mounts and configuration of %s with %s?", host, filepath.Base(args[0]))) {
+			return
+		}
+
+		var problems []string
+		configured := 0
+		if !noConfig && manifest.Config {
+			var values map[string]map[string]interface{}
+			raw, err := readFile("config.json")
+			if err == nil {
+				err = json.Unmarshal(raw, &values)
+			}
+			if err == nil {
+				err = apiStep(func() (*api.Response, error) { return apiClient.ConfigSetMany(values) })
+			}
+			if err != nil {
+				problems = append(problems, "configuration: "+err.Error())
+			} else {
+				for _, items := range values {
+					configured += len(items)
+				}
+				if save && !saveConfigToFlash() {
+					return
+				}
+			}
+		}
+
+		mounted := 0
+		if !noMounts {
+			tmp, err := os.MkdirTemp("", "c64u-state-")
+			if err != nil {
+				formatter.Error("Failed to create temporary directory", []string{err.Error()})
+				return
+			}
+			defer os.RemoveAll(tmp)
+			for _, d := range manifest.Drives {
+				if err := stateMount(d, readFile, tmp); err != nil {
+					problems = append(problems, fmt.Sprintf("drive %s: %v", d.Drive, err))
+				} else if d.Image != "" {
+					mounted++
+				}
+			}
+		}
+
+		restored := 0
+		if !noMemory && len(manifest.Memory) > 0 {
+			if !machineStep("pause machine", apiClient.MachinePause) {
+				return
+			}
+			for _, r := range manifest.Memory {
+				data, err := readFile(r.File)
+				if err == nil && len(data) != r.Length {
+					err = fmt.Errorf("%s has %d bytes instead of %d", r.File, len(data), r.Length)
+				}
+				if err == nil {
+					err = apiStep(func() (*api.Response, error) {
+						return apiClient.Endpoints().MachineWritememUpload(bytes.NewReader(data),
+							api.MachineWritememUploadParams{Address: fmt.Sprintf("%04X", r.Address)})
+					})
+				}
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("memory $%04X: %v", r.Address, err))
+					continue
+				}
+				restored += len(data)
+			}
+			if err := apiStep(apiClient.MachineResume); err != nil {
+				problems = append(problems, "resume: "+err.Error())
+			}
+		}
+
+		if len(problems) > 0 {
+			formatter.Error("Machine state imported with problems", problems)
+			return
+		}
+		data := map[string]interface{}{
+			"file":     args[0],
+			"settings": configured,
+			"mounts":   mounted,
+			"memory":   restored,
+		}
+		if !jsonOut {
+			data["memory"] = formatter.Size(int64(restored))
+		}
+		if save {
+			data["saved_to_flash"] = true
+		}
+		formatter.Success("Machine state imported", data)
+	},
+}
+
+// stateDrives lists the enabled drives with their mounted images
+func stateDrives() ([]stateDrive, error) {
+	resp, err := apiClient.DrivesList()
+	if err != nil {
+		return nil, err
+	}
+	if resp.HasErrors() {
+		return nil, fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+	}
+
+	var drives []stateDrive
+	list, _ := resp.Data["drives"].([]interface{})
+	for _, entry := range list {
+		driveMap, _ := entry.(map[string]interface{})
+		for name, v := range driveMap {
+			info, _ := v.(map[string]interface{})
+			if enabled, _ := info["enabled"].(bool); !enabled {
+				continue
+			}
+			busID, _ := info["bus_id"].(float64)
+			d := stateDrive{Drive: name, BusID: int(busID)}
+			if file, _ := info["image_file"].(string); file != "" {
+				dir, _ := info["image_path"].(string)
+				d.Image = pathpkg.Join(dir, file)
+				if m, err := currentMount(name); err == nil && m != nil {
+					d.Type, d.Mode = m.Type, m.Mode
+				}
+			}
+			drives = append(drives, d)
+		}
+	}
+	sort.Slice(drives, func(i, j int) bool { return drives[i].BusID < drives[j].BusID })
+	return drives, nil
+}
+
+// stateConfig returns the device configuration as category -> item ->
+// value, without the categories in stateSkipCategories
+func stateConfig() (map[string]map[string]interface{}, error) {
+	items, err := apiClient.ConfigItems("*", "*")
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]map[string]interface{}{}
+	for _, item := range items {
+		skip := false
+		for _, s := range stateSkipCategories {
+			skip = skip || strings.Contains(strings.ToLower(item.Category), s)
+		}
+		if skip {
+			continue
+		}
+		if values[item.Category] == nil {
+			values[item.Category] = map[string]interface{}{}
+		}
+		values[item.Category][item.Name] = item.Value
+	}
+	return values, nil
+}
+
+// stateCopyImages adds copies of the mounted images to files: the local
+// file for a recorded upload, otherwise the image on the device via FTP
+func stateCopyImages(drives []stateDrive, files map[string][]byte) error {
+	var conn *ftp.Client
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for i, d := range drives {
+		if d.Image == "" {
+			continue
+		}
+		name := "images/" + d.Drive + "/" + pathpkg.Base(d.Image)
+		if m, err := currentMount(d.Drive); err == nil && m != nil && m.Uploaded {
+			if data, err := os.ReadFile(m.Image); err == nil {
+				files[name] = data
+				drives[i].Copy = name
+				continue
+			}
+		}
+		if conn == nil {
+			var err error
+			if conn, err = dialFTP(); err != nil {
+				return err
+			}
+		}
+		var buf bytes.Buffer
+		if err := conn.Retrieve(d.Image, &buf); err != nil {
+			return fmt.Errorf("%s: %w", d.Image, err)
+		}
+		files[name] = buf.Bytes()
+		drives[i].Copy = name
+	}
+	return nil
+}
+
+// stateMount gives a drive the image it had in the bundle, uploading the
+// copy if the bundle has one, or empties it
+func stateMount(d stateDrive, readFile func(string) ([]byte, error), tmp string) error {
+	prev, _ := currentMount(d.Drive)
+	if d.Image == "" {
+		if prev == nil {
+			return nil
+		}
+		if err := apiStep(func() (*api.Response, error) { return apiClient.DrivesRemove(d.Drive) }); err != nil {
+			return err
+		}
+		recordMount(d.Drive, nil, prev)
+		return nil
+	}
+
+	if d.Copy != "" {
+		data, err := readFile(d.Copy)
+		if err != nil {
+			return err
+		}
+		local := filepath.Join(tmp, d.Drive+"-"+pathpkg.Base(d.Copy))
+		if err := os.WriteFile(local, data, 0644); err != nil {
+			return err
+		}
+		if err := apiStep(func() (*api.Response, error) {
+			return apiClient.DrivesMountUpload(d.Drive, local, d.Type, d.Mode)
+		}); err != nil {
+			return err
+		}
+		recordMount(d.Drive, &mounts.Mount{Image: pathpkg.Base(d.Image), Uploaded: true, Type: d.Type, Mode: d.Mode}, prev)
+		return nil
+	}
+
+	if err := apiStep(func() (*api.Response, error) {
+		return apiClient.DrivesMount(d.Drive, d.Image, d.Type, d.Mode)
+	}); err != nil {
+		return fmt.Errorf("%s: %w", d.Image, err)
+	}
+	recordMount(d.Drive, &mounts.Mount{Image: d.Image, Type: d.Type, Mode: d.Mode}, prev)
+	return nil
+}
+
+// writeStateBundle writes the files to a zip, manifest first
+func writeStateBundle(path string, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if name != "manifest.json" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{"manifest.json"}, names...)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range names {
+		var w io.Writer
+		if w, err = zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}); err != nil {
+			break
+		}
+		if _, err = w.Write(files[name]); err != nil {
+			break
+		}
+	}
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func init() {
+	stateCmd.AddCommand(stateExportCmd)
+	stateCmd.AddCommand(stateImportCmd)
+	stateExportCmd.Flags().Bool("images", false, "Include copies of the mounted disk images")
+	stateExportCmd.Flags().Bool("no-config", false, "Leave out the device configuration")
+	stateExportCmd.Flags().Bool("no-pause", false, "Read memory without pausing the machine")
+	stateImportCmd.Flags().Bool("no-config", false, "Do not change the device configuration")
+	stateImportCmd.Flags().Bool("no-mounts", false, "Do not change the drives")
+	stateImportCmd.Flags().Bool("no-memory", false, "Do not write memory")
+	stateImportCmd.Flags().Bool("save", false, "Save the imported configuration to flash")
+	addYesFlag(stateImportCmd)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/stats"
+	"github.com/spf13/cobra"
+)
+
+// statsCmd shows the local usage statistics
+var statsCmd = &cobra.Command{
+	Use:   "stats [--since D] [--sort count|time|failures]",
+	Short: "Show local command usage statistics",
+	Long: `Show how often each command ran, how long it took and how often it failed.
+
+Recording is opt-in: set stats = true in config.toml (or C64U_STATS=1).
+Only the command name (e.g. "drives mount"), its duration, exit code and the
+c64u version are stored, in ~/.config/c64u/stats/usage.jsonl; arguments,
+hosts and file names are never recorded. Nothing is sent anywhere; use
+"c64u stats export" to produce a report to share.
+
+Examples:
+  c64u stats
+  c64u stats --since 168h --sort time
+  c64u --json stats`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		since, _ := cmd.Flags().GetDuration("since")
+		sortBy, _ := cmd.Flags().GetString("sort")
+
+		entries, err := readStats(since)
+		if err != nil {
+			formatter.Error("Failed to read usage statistics", []string{err.Error()})
+			return
+		}
+		summaries := stats.Summarize(entries)
+		switch sortBy {
+		case "count":
+		case "time":
+			sort.SliceStable(summaries, func(i, j int) bool { return summaries[i].Total > summaries[j].Total })
+		case "failures":
+			sort.SliceStable(summaries, func(i, j int) bool {
+				return summaries[i].FailureRate() > summaries[j].FailureRate()
+			})
+		default:
+			formatter.Error("Invalid sort order", []string{"Use count, time or failures"})
+			return
+		}
+
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{"commands": summaries})
+			return
+		}
+		if len(summaries) == 0 {
+			msg := "No usage recorded"
+			if !statsEnabled {
+				msg += " (enable stats in config.toml)"
+			}
+			formatter.Info(msg)
+			return
+		}
+
+		rows := make([][]string, 0, len(summaries))
+		for _, s := range summaries {
+			rows = append(rows, []string{
+				s.Command,
+				strconv.Itoa(s.Count),
+				strconv.Itoa(s.Failures),
+				fmt.Sprintf("%.0f%%", s.FailureRate()*100),
+				formatter.Duration(s.Median),
+				formatter.Duration(s.Mean),
+				formatter.Duration(s.Max),
+				formatter.Duration(s.Total),
+			})
+		}
+		formatter.PrintTable([]string{"command", "runs", "failed", "fail %", "median", "mean", "max", "total"}, rows)
+	},
+}
+
+var statsExportCmd = &cobra.Command{
+	Use:   "export [--output FILE] [--since D]",
+	Short: "Write an anonymized usage report",
+	Long: `Write the usage statistics as an anonymized JSON report, e.g. to attach
+to a bug report or share with the maintainers. The report only holds
+per-command aggregates (runs, failures, durations), the c64u version, the
+operating system and the covered period in days; no individual
+invocations or timestamps.
+
+Examples:
+  c64u stats export --output c64u-usage.json
+  c64u stats export --since 720h`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		outPath, _ := cmd.Flags().GetString("output")
+		since, _ := cmd.Flags().GetDuration("since")
+
+		entries, err := readStats(since)
+		if err != nil {
+			formatter.Error("Failed to read usage statistics", []string{err.Error()})
+			return
+		}
+
+		report := usageReport{
+			Version:  version,
+			OS:       runtime.GOOS,
+			Arch:     runtime.GOARCH,
+			Commands: stats.Summarize(entries),
+		}
+		if len(entries) > 0 {
+			first, last := entries[0].Time, entries[len(entries)-1].Time
+			report.Days = int(last.Sub(first).Hours()/24) + 1
+		}
+		for _, s := range report.Commands {
+			report.Runs += s.Count
+		}
+
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			formatter.Error("Failed to encode report", []string{err.Error()})
+			return
+		}
+		data = append(data, '\n')
+		if outPath == "" || outPath == "-" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(outPath, data, 0644); err != nil {
+			formatter.Error("Failed to write report", []string{err.Error()})
+			return
+		}
+		formatter.Success(fmt.Sprintf("Usage report written to %s", outPath), map[string]interface{}{
+			"commands": len(report.Commands),
+			"runs":     report.Runs,
+		})
+	},
+}
+
+var statsResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Delete the recorded usage statistics",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := os.Remove(statsPath()); err != nil && !os.IsNotExist(err) {
+			formatter.Error("Failed to delete usage statistics", []string{err.Error()})
+			return
+		}
+		formatter.Success("Usage statistics deleted", nil)
+	},
+}
+
+// usageReport is the anonymized export
+type usageReport struct {
+	Version  string          `json:"c64u_version"`
+	OS       string          `json:"os"`
+	Arch     string          `json:"arch"`
+	Days     int             `json:"days"`
+	Runs     int             `json:"runs"`
+	Commands []stats.Summary `json:"commands"`
+}
+
+// statsPath is the location of the usage statistics
+func statsPath() string {
+	return filepath.Join(config.GetConfigDir(), "stats", "usage.jsonl")
+}
+
+// readStats reads the entries of the last since (0 = all)
+func readStats(since time.Duration) ([]stats.Entry, error) {
+	entries, err := stats.Read(statsPath())
+	if err != nil || since <= 0 {
+		return entries, err
+	}
+	cutoff := time.Now().Add(-since)
+	recent := entries[:0]
+	for _, e := range entries {
+		if !e.Time.Before(cutoff) {
+			recent = append(recent, e)
+		}
+	}
+	return recent, nil
+}
+
+// startStats records the running command when it exits, if enabled
+func startStats(cmd *cobra.Command) {
+	root := cmd.Root()
+	path := strings.TrimPrefix(cmd.CommandPath(), root.Name()+" ")
+	if !statsEnabled || cmd == root || path == "stats" || strings.HasPrefix(path, "stats ") ||
+		strings.HasPrefix(path, "completion") || strings.HasPrefix(path, "__") {
+		return
+	}
+
+	start := time.Now()
+	output.OnExit(func(code int) {
+		entry := stats.Entry{
+			Time:     start,
+			Command:  path,
+			Duration: time.Since(start),
+			ExitCode: code,
+			Version:  version,
+		}
+		// Statistics must never get in the way of the command itself
+		stats.Append(statsPath(), entry)
+	})
+}
+
+func init() {
+	statsCmd.Flags().Duration("since", 0, "Only include commands run within this duration (e.g. 168h)")
+	statsCmd.Flags().String("sort", "count", "Sort by count, time (total) or failures (rate)")
+	statsExportCmd.Flags().StringP("output", "o", "", "Write the report to this file instead of stdout")
+	statsExportCmd.Flags().Duration("since", 0, "Only include commands run within this duration")
+	statsCmd.AddCommand(statsExportCmd)
+	statsCmd.AddCommand(statsResetCmd)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	pathpkg "path"
 
 	"github.com/spf13/cobra"
 )
@@ -24,18 +25,25 @@ This feature is only available on Ultimate 64 hardware.`,
 }
 
 var streamsStartCmd = &cobra.Command{
-	Use:   "start <stream> <ip>",
+	Use:   "start <stream> [ip] [--interface NAME]",
 	Short: "Start a stream",
 	Long: `Start a video, audio, or debug stream to the specified IP address.
 
+Without an IP address the stream goes to stream_destination from
+config.toml or, if that is not set, to this machine: its LAN address is the
+one it uses to reach the Ultimate. --interface (or stream_interface) picks
+the address of a specific network interface instead, e.g. when the machine
+has both wired and wireless connections.
+
 Streams: video, audio, debug
 
-Example:
-  c64u streams start video 192.168.1.100`,
-	Args: cobra.ExactArgs(2),
+Examples:
+  c64u streams start video 192.168.1.100
+  c64u streams start audio
+  c64u streams start video --interface eth0`,
+	Args: cobra.RangeArgs(1, 2),
 	Run: func(cmd *cobra.Command, args []string) {
 		stream := args[0]
-		ip := args[1]
 
 		// Validate stream type
 		validStreams := map[string]bool{"video": true, "audio": true, "debug": true}
@@ -47,6 +55,15 @@ Example:
 			return
 		}
 
+		ip, err := streamDestination(cmd, args[1:])
+		if err != nil {
+			formatter.Error("Cannot determine the stream destination", []string{
+				err.Error(),
+				"Give the destination IP address as argument",
+			})
+			return
+		}
+
 		resp, err := apiClient.StreamsStart(stream, ip)
 		if err != nil {
 			formatter.Error("Failed to start stream", []string{err.Error()})
@@ -58,11 +75,9 @@ Example:
 			return
 		}
 
-		// Get default port for stream type
-		ports := map[string]int{"video": 11000, "audio": 11001, "debug": 11002}
 		data := map[string]interface{}{
 			"stream":      stream,
-			"destination": fmt.Sprintf("%s:%d", ip, ports[stream]),
+			"destination": fmt.Sprintf("%s:%d", ip, streamPorts[stream]),
 		}
 		formatter.Success("Stream started", data)
 	},
@@ -111,8 +126,9 @@ Example:
 // ============================================================================
 
 var filesCmd = &cobra.Command{
-	Use:   "files",
-	Short: "File operations",
+	Use:     "files",
+	Aliases: []string{"fs"},
+	Short:   "File operations",
 	Long: `File manipulation on the C64 Ultimate filesystem.
 
 Commands include getting file info and creating disk images (D64, D71, D81, DNP).`,
@@ -142,45 +158,54 @@ Example:
 
 		if jsonOut {
 			formatter.PrintData(resp.Data)
-		} else {
-			// Parse file info data
-			files, ok := resp.Data["files"].([]interface{})
-			if !ok || len(files) == 0 {
-				formatter.Info("No files found")
-				return
-			}
+			return
+		}
+
+		wide, _ := cmd.Flags().GetBool("wide")
 
-			formatter.PrintHeader(fmt.Sprintf("File Information: %s", path))
-			fmt.Println()
+		// Parse file info data
+		files, ok := resp.Data["files"].([]interface{})
+		if !ok || len(files) == 0 {
+			formatter.Info("No files found")
+			return
+		}
+
+		var rows [][]string
+		for _, fileData := range files {
+			fileMap, ok := fileData.(map[string]interface{})
+			if !ok {
+				continue
+			}
 
-			for _, fileData := range files {
-				fileMap, ok := fileData.(map[string]interface{})
+			// File name is the key
+			for fileName, fileInfo := range fileMap {
+				info, ok := fileInfo.(map[string]interface{})
 				if !ok {
 					continue
 				}
 
-				// File name is the key
-				for fileName, fileInfo := range fileMap {
-					info, ok := fileInfo.(map[string]interface{})
-					if !ok {
-						continue
-					}
-
-					formatter.PrintHeader(fileName)
-					fmt.Println()
-
-					if size, ok := info["size"].(float64); ok {
-						formatter.PrintKeyValue("Size", fmt.Sprintf("%d bytes", int(size)))
-					}
+				name := fileName
+				if !wide {
+					name = pathpkg.Base(fileName)
+				}
 
-					if ext, ok := info["extension"].(string); ok && ext != "" {
-						formatter.PrintKeyValue("Type", ext)
-					}
+				size := "-"
+				if sz, ok := info["size"].(float64); ok {
+					size = formatter.Size(int64(sz))
+				}
 
-					fmt.Println()
+				ext := "-"
+				if e, ok := info["extension"].(string); ok && e != "" {
+					ext = e
 				}
+
+				rows = append(rows, []string{name, size, ext})
 			}
 		}
+
+		formatter.PrintHeader(fmt.Sprintf("File Information: %s", path))
+		fmt.Println()
+		formatter.PrintTable([]string{"Name", "Size", "Type"}, rows)
 	},
 }
 
@@ -338,8 +363,10 @@ Example:
 
 func init() {
 	// Streams commands
+	streamsStartCmd.Flags().String("interface", "", "Stream to the address of this network interface (default: stream_interface or auto-detect)")
 	streamsCmd.AddCommand(streamsStartCmd)
 	streamsCmd.AddCommand(streamsStopCmd)
+	streamsCmd.AddCommand(streamsCheckCmd)
 
 	// Files commands
 	filesCmd.AddCommand(filesInfoCmd)
@@ -348,6 +375,9 @@ func init() {
 	filesCmd.AddCommand(filesCreateD81Cmd)
 	filesCmd.AddCommand(filesCreateDNPCmd)
 
+	filesInfoCmd.Flags().Bool("wide", false, "Show full file paths")
+	filesInfoCmd.Annotations = pagedOutput
+
 	// Flags for file creation commands
 	filesCreateD64Cmd.Flags().Int("tracks", 35, "Number of tracks (35 or 40)")
 	filesCreateD64Cmd.Flags().String("name", "", "Disk name")
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// streamPorts are the UDP ports the Ultimate 64 sends each stream to
+var streamPorts = map[string]int{"video": 11000, "audio": 11001, "debug": 11002}
+
+// ============================================================================
+// Stream Destination
+// ============================================================================
+
+// streamDestination returns the IP address a stream is sent to: the
+// argument if given, else stream_destination from the configuration, else
+// this machine's address
+func streamDestination(cmd *cobra.Command, args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	iface := cfg.StreamInterface
+	if cmd.Flags().Changed("interface") {
+		iface, _ = cmd.Flags().GetString("interface")
+	} else if cfg.StreamDestination != "" {
+		return cfg.StreamDestination, nil
+	}
+
+	if iface != "" {
+		return interfaceAddress(iface)
+	}
+	return localAddressFor(host, port)
+}
+
+// localAddressFor returns the local IP address used to reach host. No
+// packets are sent; connecting a UDP socket only selects the route.
+func localAddressFor(host string, port int) (string, error) {
+	conn, err := net.Dial("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return "", fmt.Errorf("no route to %s: %w", host, err)
+	}
+	defer conn.Close()
+
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok || addr.IP.IsUnspecified() {
+		return "", fmt.Errorf("no local address for %s", host)
+	}
+	if addr.IP.IsLoopback() && !isLoopbackHost(host) {
+		return "", errors.New("the device is only reachable through loopback")
+	}
+	return addr.IP.String(), nil
+}
+
+// isLoopbackHost reports whether host names this machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// interfaceAddress returns the first IPv4 address of a network interface
+func interfaceAddress(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("network interface '%s': %w", name, err)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return "", fmt.Errorf("network interface '%s' is down", name)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("network interface '%s': %w", name, err)
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			if ip4 := ipnet.IP.To4(); ip4 != nil {
+				return ip4.String(), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("network interface '%s' has no IPv4 address", name)
+}
+
+// ============================================================================
+// Stream Reception Check
+// ============================================================================
+
+var streamsCheckCmd = &cobra.Command{
+	Use:   "check <stream> [ip] [--interface NAME] [--duration D] [--keep]",
+	Short: "Check that stream packets reach this machine",
+	Long: `Check that a stream can be received here before pointing a viewer at it.
+
+The check binds the stream's UDP port, sends itself a packet over loopback,
+then starts the stream and counts the packets arriving from the Ultimate
+for --duration. The stream is stopped again afterwards unless --keep is
+given. When nothing arrives, the firewall settings for this operating
+system are the usual cause; the hints show what to change.
+
+The destination is chosen as for "streams start".
+
+Examples:
+  c64u streams check video
+  c64u streams check audio --duration 5s
+  c64u streams check video --interface eth0 --keep`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		stream := args[0]
+		duration, _ := cmd.Flags().GetDuration("duration")
+		keep, _ := cmd.Flags().GetBool("keep")
+
+		streamPort, ok := streamPorts[stream]
+		if !ok {
+			formatter.Error("Invalid stream type", []string{
+				fmt.Sprintf("Stream '%s' is not valid", stream),
+				"Valid streams: video, audio, debug",
+			})
+			return
+		}
+
+		if duration <= 0 {
+			formatter.Error("Invalid duration", []string{"--duration must be positive, e.g. 3s"})
+			return
+		}
+
+		ip, err := streamDestination(cmd, args[1:])
+		if err != nil {
+			formatter.Error("Cannot determine the stream destination", []string{
+				err.Error(),
+				"Give the destination IP address as argument",
+			})
+			return
+		}
+
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: streamPort})
+		if err != nil {
+			formatter.Error(fmt.Sprintf("Cannot listen on UDP port %d", streamPort), []string{
+				err.Error(),
+				"Another program (e.g. a stream viewer) may already use the port; close it and retry",
+			})
+			return
+		}
+		defer conn.Close()
+
+		if err := loopbackProbe(conn, streamPort); err != nil {
+			formatter.Error("Loopback probe failed", []string{
+				err.Error(),
+				"Packets to this machine's own UDP port do not arrive; local security software may block them",
+			})
+			return
+		}
+		if verbose {
+			formatter.Info(fmt.Sprintf("Loopback probe on UDP port %d received", streamPort))
+		}
+
+		resp, err := apiClient.StreamsStart(stream, ip)
+		if err != nil {
+			formatter.Error("Failed to start stream", []string{err.Error()})
+			return
+		}
+		if resp.HasErrors() {
+			formatter.Error("API returned errors", resp.Errors)
+			return
+		}
+
+		packets, bytes := countStreamPackets(conn, duration)
+
+		if !keep {
+			if resp, err := apiClient.StreamsStop(stream); err != nil {
+				formatter.Warning(fmt.Sprintf("Failed to stop stream: %v", err))
+			} else if resp.HasErrors() {
+				formatter.Warning(fmt.Sprintf("Failed to stop stream: %v", resp.Errors))
+			}
+		}
+
+		destination := fmt.Sprintf("%s:%d", ip, streamPort)
+		if packets == 0 {
+			formatter.Error(fmt.Sprintf("No %s packets received on %s within %s", stream, destination, duration),
+				streamFirewallHints(ip, streamPort))
+			return
+		}
+
+		formatter.Success("Stream reception works", map[string]interface{}{
+			"stream":      stream,
+			"destination": destination,
+			"packets":     packets,
+			"bytes":       bytes,
+			"rate":        fmt.Sprintf("%.0f packets/s", float64(packets)/duration.Seconds()),
+		})
+	},
+}
+
+// loopbackProbe sends a packet to the listening port through loopback and
+// waits for it to arrive
+func loopbackProbe(conn *net.UDPConn, streamPort int) error {
+	probe, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: streamPort})
+	if err != nil {
+		return err
+	}
+	defer probe.Close()
+
+	payload := []byte("c64u stream check")
+	if _, err := probe.Write(payload); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64)
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn.SetReadDeadline(deadline)
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return fmt.Errorf("no loopback packet on UDP port %d: %w", streamPort, err)
+		}
+		if string(buf[:n]) == string(payload) {
+			return nil
+		}
+	}
+}
+
+// countStreamPackets counts the packets and bytes received within d
+func countStreamPackets(conn *net.UDPConn, d time.Duration) (packets, bytes int) {
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(d))
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return packets, bytes
+		}
+		packets++
+		bytes += n
+	}
+}
+
+// streamFirewallHints explains how to let stream packets through the
+// firewall of this operating system
+func streamFirewallHints(ip string, streamPort int) []string {
+	var hints []string
+	switch runtime.GOOS {
+	case "linux":
+		hints = []string{
+			fmt.Sprintf("ufw: sudo ufw allow %d/udp", streamPort),
+			fmt.Sprintf("firewalld: sudo firewall-cmd --add-port=%d/udp", streamPort),
+			fmt.Sprintf("iptables: sudo iptables -I INPUT -p udp --dport %d -j ACCEPT", streamPort),
+		}
+	case "darwin":
+		hints = []string{
+			"System Settings > Network > Firewall: allow incoming connections for c64u and your viewer",
+			"Or turn off \"Block all incoming connections\" in the firewall options",
+		}
+	case "windows":
+		hints = []string{
+			fmt.Sprintf("netsh advfirewall firewall add rule name=\"C64U stream\" dir=in action=allow protocol=UDP localport=%d", streamPort),
+			"Windows blocks incoming UDP on networks marked as Public; mark the network as Private",
+		}
+	}
+	return append(hints,
+		fmt.Sprintf("Check that %s is this machine's address on the Ultimate's network (see --interface)", ip),
+		"Streams do not cross most VPNs or routers doing NAT; use a machine on the same subnet",
+	)
+}
+
+func init() {
+	streamsCheckCmd.Flags().String("interface", "", "Receive on the address of this network interface")
+	streamsCheckCmd.Flags().Duration("duration", 3*time.Second, "How long to count incoming packets")
+	streamsCheckCmd.Flags().Bool("keep", false, "Leave the stream running after the check")
+}
@@ -0,0 +1,687 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/keyboard"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/palette"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/screen"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/testreport"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/testspec"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Screen Regression Tests
+// ============================================================================
+
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Regression tests that compare the screen",
+	Long: `Run programs on the device, compare the screens they show with
+golden references and check the memory, border and disk files they
+leave, to build regression suites for cross-developed programs against
+real hardware.`,
+}
+
+var testRunCmd = &cobra.Command{
+	Use:   "run <spec.toml> [--test NAME]... [--update] [--output DIR] [--fail-fast] [--report FILE]...",
+	Short: "Run the tests of a spec and compare the screens",
+	Long: `Run each [[test]] of a TOML spec: reset the machine and wait for
+READY., start the program (uploading it if it is a local file), wait for
+wait_text, type keys into the keyboard buffer, wait, then capture the
+screen and compare it with the golden reference.
+
+A text capture reads screen memory via DMA and is compared row by row
+with a text file as "c64u machine screen --no-color" prints it; colors
+and reverse video are not compared. A frame capture takes a frame of the
+video stream, as "c64u machine screenshot" does, and is compared pixel by
+pixel with a PNG.
+
+  # Settings at the top are the defaults of every test
+  program = "build/game.prg"
+  timeout = "20s"               # for READY., wait_text and keys
+
+  [[test]]
+  name = "title screen"
+  wait_text = "PRESS FIRE"
+  ignore_rows = [25]            # the hiscore changes
+
+  [[test]]
+  name = "level 1"
+  wait_text = "PRESS FIRE"
+  keys = " "                    # "keys type" syntax, e.g. "{f1}"
+  wait = "3s"
+  capture = "frame"
+  tolerance = 40                # pixels that may differ
+  golden = "ref/level1.png"     # default: golden/<name>.txt or .png
+
+Paths are relative to the spec; a program that is no local file is
+started from the device. reset = false starts the program on the running
+machine; pause = false takes the frame without halting the CPU.
+
+After the capture, [[test.assert]] entries check the machine state; an
+[[assert]] at the top of the file applies to every test:
+
+  [[test.assert]]
+  memory = "c000"
+  equals = "a9 00"              # the bytes at $C000
+  [[test.assert]]
+  memory = "0400"
+  length = 1000
+  contains = "13 03 0f 12 05"   # somewhere in $0400-$07E7
+  [[test.assert]]
+  border = "light blue"         # or 0-15
+  [[test.assert]]
+  file = "save.seq"             # on the image in drive a (drive = "8")
+
+Memory is read via DMA as the CPU sees it, and a file is looked up in the
+image read from the device. capture = "none" only checks the asserts.
+The SID registers are write-only, so their state cannot be asserted.
+
+--update saves the captures as golden references instead of comparing.
+A failing test saves its capture, and for frames an image with the
+differing pixels in red, to --output (test-output next to the spec).
+Exits with status 1 if any test fails.
+
+--report writes the results for CI test summaries: JUnit XML for a .xml
+file, TAP for a .tap file. Both carry the time of each test, the
+differing rows of a failure, the outcome of each assert, and the saved
+captures as attachments
+(Jenkins picks up the [[ATTACHMENT|path]] lines of JUnit system-out).
+Tests left out by --fail-fast are reported as skipped.
+
+Examples:
+  c64u test run tests/game.toml --update
+  c64u test run tests/game.toml
+  c64u test run tests/game.toml --test "level 1" --side-by-side
+  c64u test run tests/game.toml --report build/junit.xml`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		only, _ := cmd.Flags().GetStringSlice("test")
+		update, _ := cmd.Flags().GetBool("update")
+		outDir, _ := cmd.Flags().GetString("output")
+		failFast, _ := cmd.Flags().GetBool("fail-fast")
+		sideBySide, _ := cmd.Flags().GetBool("side-by-side")
+		palettePath, _ := cmd.Flags().GetString("palette")
+		reports, _ := cmd.Flags().GetStringSlice("report")
+
+		spec, err := testspec.Load(args[0])
+		if err != nil {
+			formatter.Error("Invalid test spec", []string{err.Error()})
+			return
+		}
+		tests, ok := selectTests(spec, only)
+		if !ok {
+			return
+		}
+		for _, path := range reports {
+			if _, err := testreport.FormatFor(path); err != nil {
+				formatter.Error("Unknown report format", []string{err.Error()})
+				return
+			}
+		}
+		pal := palette.Default
+		if palettePath != "" {
+			if pal, err = palette.Load(palettePath); err != nil {
+				formatter.Error("Invalid palette file", []string{err.Error()})
+				return
+			}
+		}
+		if outDir == "" {
+			outDir = filepath.Join(filepath.Dir(spec.Path), "test-output")
+		}
+
+		frames := &frameSource{cmd: cmd, pal: pal}
+		defer frames.Close()
+		run := &testRun{update: update, outDir: outDir, frames: frames}
+
+		started := time.Now()
+		var results []*testResult
+		failed := 0
+		for _, t := range tests {
+			r := run.test(t)
+			results = append(results, r)
+			if !jsonOut {
+				printTestResult(r, sideBySide)
+			}
+			if r.failed() {
+				failed++
+				if failFast {
+					break
+				}
+			}
+		}
+
+		if len(reports) > 0 {
+			report := testReport(spec, tests, results, started)
+			for _, path := range reports {
+				if err := testreport.WriteFile(path, report); err != nil {
+					formatter.Error("Failed to write the test report", []string{err.Error()})
+					return
+				}
+				if !jsonOut {
+					formatter.Info("Wrote report " + path)
+				}
+			}
+		}
+
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{
+				"spec":    spec.Path,
+				"passed":  failed == 0,
+				"failed":  failed,
+				"results": results,
+			})
+			if failed > 0 {
+				output.Exit(1)
+			}
+			return
+		}
+		if failed > 0 {
+			var details []string
+			for _, r := range results {
+				if r.failed() {
+					details = append(details, r.Name+": "+r.Message)
+				}
+			}
+			if frames.noFrame {
+				details = append(details, streamFirewallHints(frames.ip, streamPorts["video"])...)
+			}
+			formatter.Error(fmt.Sprintf("%d of %s failed", failed, plural(len(results), "test")), details)
+			return
+		}
+		msg := fmt.Sprintf("All %s passed", plural(len(results), "test"))
+		if update {
+			msg = fmt.Sprintf("Updated the golden references of %s", plural(len(results), "test"))
+		}
+		formatter.Success(msg, nil)
+	},
+}
+
+// selectTests returns the tests given with --test, in the order of the
+// spec; all of them without
+func selectTests(spec *testspec.Spec, only []string) ([]*testspec.Test, bool) {
+	if len(only) == 0 {
+		return spec.Tests, true
+	}
+	wanted := make(map[string]bool)
+	for _, name := range only {
+		wanted[name] = true
+	}
+	var tests []*testspec.Test
+	for _, t := range spec.Tests {
+		if wanted[t.Name] {
+			tests = append(tests, t)
+			delete(wanted, t.Name)
+		}
+	}
+	if len(wanted) > 0 {
+		var names []string
+		for _, t := range spec.Tests {
+			names = append(names, t.Name)
+		}
+		formatter.Error("Unknown test", []string{fmt.Sprintf("%s has: %s", spec.Path, strings.Join(names, ", "))})
+		return nil, false
+	}
+	return tests, true
+}
+
+// Test results
+const (
+	testPassed  = "pass"
+	testFailed  = "fail"
+	testError   = "error"
+	testUpdated = "updated"
+)
+
+// testResult is the outcome of one test
+type testResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Message  string `json:"message,omitempty"`
+	Golden   string `json:"golden,omitempty"`
+	// Rows are the text rows (1-25) that differ; Pixels the differing
+	// pixels of a frame
+	Rows   []int `json:"rows,omitempty"`
+	Pixels int   `json:"pixels,omitempty"`
+	// Saved are the captures written for a failed test
+	Saved []string `json:"saved,omitempty"`
+	// Asserts are the checks of the machine state after the capture
+	Asserts []assertResult `json:"asserts,omitempty"`
+
+	elapsed          time.Duration
+	expected, actual []string
+}
+
+func (r *testResult) failed() bool {
+	return r.Status == testFailed || r.Status == testError
+}
+
+// testRun holds what the tests of a run share
+type testRun struct {
+	update bool
+	outDir string
+	frames *frameSource
+}
+
+// test runs one test
+func (run *testRun) test(t *testspec.Test) *testResult {
+	start := time.Now()
+	r := &testResult{Name: t.Name, Golden: t.Golden}
+	defer func() {
+		r.elapsed = time.Since(start)
+		r.Duration = formatter.Duration(r.elapsed)
+	}()
+
+	if err := prepareTest(t); err != nil {
+		r.Status, r.Message = testError, err.Error()
+		// What the program showed instead helps more than the timeout
+		if s, err := readTextScreen(false); err == nil {
+			run.save(r, testspec.Slug(t.Name)+".txt", screenText(s.lines()))
+		}
+		return r
+	}
+	switch t.Capture {
+	case testspec.CaptureFrame:
+		run.compareFrame(t, r)
+	case testspec.CaptureText:
+		run.compareText(t, r)
+	default:
+		r.Status = testPassed
+	}
+	checkAsserts(t, r)
+	return r
+}
+
+// prepareTest starts the program of a test and waits until the screen
+// is ready for the capture
+func prepareTest(t *testspec.Test) error {
+	if t.Reset {
+		if err := apiStep(apiClient.MachineReset); err != nil {
+			return fmt.Errorf("failed to reset machine: %w", err)
+		}
+		clearRunning()
+		if _, err := screen.WaitFor(apiClient, "READY.", t.Timeout, 200*time.Millisecond); err != nil {
+			return fmt.Errorf("machine did not become ready: %w", err)
+		}
+		time.Sleep(readySettleDelay)
+	}
+	if err := startProgram(t.Program); err != nil {
+		return fmt.Errorf("failed to run %s: %w", t.Program, err)
+	}
+	if t.WaitText != "" {
+		if _, err := screen.WaitFor(apiClient, t.WaitText, t.Timeout, 200*time.Millisecond); err != nil {
+			return err
+		}
+	}
+	if t.Keys != "" {
+		// The spec checked the keys
+		codes, _ := petscii.FromKeys(t.Keys)
+		if err := keyboard.Type(apiClient, codes, t.Timeout); err != nil {
+			return fmt.Errorf("failed to type keys: %w", err)
+		}
+	}
+	time.Sleep(t.Wait)
+	return nil
+}
+
+// compareText compares screen memory with a golden text file
+func (run *testRun) compareText(t *testspec.Test, r *testResult) {
+	s, err := readTextScreen(false)
+	if err != nil {
+		r.Status, r.Message = testError, "failed to read the screen: "+err.Error()
+		return
+	}
+	actual := s.lines()
+	if run.update {
+		run.writeGolden(t, r, screenText(actual))
+		return
+	}
+	data, err := os.ReadFile(t.Golden)
+	if err != nil {
+		run.missingGolden(t, r, err, screenText(actual))
+		return
+	}
+	expected := screenRows(string(data))
+
+	ignored := make(map[int]bool)
+	for _, row := range t.IgnoreRows {
+		ignored[row-1] = true
+	}
+	for len(actual) < len(expected) {
+		actual = append(actual, "")
+	}
+	for i := range actual {
+		if ignored[i] {
+			actual[i] = expected[i]
+		} else if actual[i] != expected[i] {
+			r.Rows = append(r.Rows, i+1)
+		}
+	}
+	if len(r.Rows) == 0 {
+		r.Status = testPassed
+		return
+	}
+	r.Status = testFailed
+	r.Message = fmt.Sprintf("%s of the screen differ", plural(len(r.Rows), "row"))
+	r.expected, r.actual = expected, actual
+	run.save(r, testspec.Slug(t.Name)+".txt", screenText(s.lines()))
+}
+
+// compareFrame compares a frame of the video stream with a golden PNG
+func (run *testRun) compareFrame(t *testspec.Test, r *testResult) {
+	img, err := run.frames.capture(t.Pause)
+	if err != nil {
+		r.Status, r.Message = testError, err.Error()
+		return
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		r.Status, r.Message = testError, err.Error()
+		return
+	}
+	if run.update {
+		run.writeGolden(t, r, buf.Bytes())
+		return
+	}
+	golden, err := loadPNG(t.Golden)
+	if err != nil {
+		run.missingGolden(t, r, err, buf.Bytes())
+		return
+	}
+
+	slug := testspec.Slug(t.Name)
+	if golden.Bounds() != img.Bounds() {
+		r.Status = testFailed
+		r.Message = fmt.Sprintf("the frame is %dx%d, the reference %dx%d",
+			img.Bounds().Dx(), img.Bounds().Dy(), golden.Bounds().Dx(), golden.Bounds().Dy())
+		run.save(r, slug+".png", buf.Bytes())
+		return
+	}
+	diff, pixels, box := diffFrames(golden, img)
+	r.Pixels = pixels
+	switch {
+	case r.Pixels == 0:
+		r.Status = testPassed
+	case r.Pixels <= t.Tolerance:
+		r.Status = testPassed
+		r.Message = fmt.Sprintf("%s differ, within the tolerance", plural(r.Pixels, "pixel"))
+	default:
+		r.Status = testFailed
+		r.Message = fmt.Sprintf("%s differ between %d,%d and %d,%d",
+			plural(r.Pixels, "pixel"), box.Min.X, box.Min.Y, box.Max.X-1, box.Max.Y-1)
+		run.save(r, slug+".png", buf.Bytes())
+		var d bytes.Buffer
+		if err := png.Encode(&d, diff); err == nil {
+			run.save(r, slug+"-diff.png", d.Bytes())
+		}
+	}
+}
+
+// writeGolden saves a capture as the reference of a test
+func (run *testRun) writeGolden(t *testspec.Test, r *testResult, data []byte) {
+	if err := writeTestFile(t.Golden, data); err != nil {
+		r.Status, r.Message = testError, "failed to save the reference: "+err.Error()
+		return
+	}
+	r.Status = testUpdated
+}
+
+// missingGolden fails a test whose reference cannot be read
+func (run *testRun) missingGolden(t *testspec.Test, r *testResult, err error, capture []byte) {
+	r.Status = testFailed
+	if errors.Is(err, os.ErrNotExist) {
+		r.Message = fmt.Sprintf("no reference %s; --update saves it", t.Golden)
+	} else {
+		r.Message = fmt.Sprintf("cannot read the reference: %v", err)
+	}
+	run.save(r, testspec.Slug(t.Name)+filepath.Ext(t.Golden), capture)
+}
+
+// save writes a file of a failed test to the output directory
+func (run *testRun) save(r *testResult, name string, data []byte) {
+	path := filepath.Join(run.outDir, name)
+	if err := writeTestFile(path, data); err != nil {
+		r.Message += fmt.Sprintf(" (saving the capture failed: %v)", err)
+		return
+	}
+	r.Saved = append(r.Saved, path)
+}
+
+func writeTestFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// screenText returns screen rows as the contents of a text reference
+func screenText(lines []string) []byte {
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// screenRows splits a text reference into rows, at least a screen's worth
+func screenRows(text string) []string {
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	rows := strings.Split(text, "\n")
+	for i := range rows {
+		rows[i] = strings.TrimRight(rows[i], " ")
+	}
+	for len(rows) < screen.Rows {
+		rows = append(rows, "")
+	}
+	return rows
+}
+
+func loadPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return img, nil
+}
+
+// diffFrames compares two images of the same size. The result shows the
+// actual frame dimmed, with the n differing pixels in red; box encloses
+// them.
+func diffFrames(expected, actual image.Image) (diff *image.RGBA, n int, box image.Rectangle) {
+	bounds := actual.Bounds()
+	diff = image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			a := color.RGBAModel.Convert(actual.At(x, y)).(color.RGBA)
+			e := color.RGBAModel.Convert(expected.At(x, y)).(color.RGBA)
+			if a == e {
+				gray := uint8((int(a.R) + int(a.G) + int(a.B)) / 9)
+				diff.SetRGBA(x, y, color.RGBA{R: gray, G: gray, B: gray, A: 0xFF})
+				continue
+			}
+			diff.SetRGBA(x, y, color.RGBA{R: 0xFF, A: 0xFF})
+			box = box.Union(image.Rect(x, y, x+1, y+1))
+			n++
+		}
+	}
+	return diff, n, box
+}
+
+// testReport turns the results of a run into a report; tests that did
+// not run count as skipped
+func testReport(spec *testspec.Spec, tests []*testspec.Test, results []*testResult, started time.Time) *testreport.Report {
+	report := &testreport.Report{
+		Name:      strings.TrimSuffix(filepath.Base(spec.Path), filepath.Ext(spec.Path)),
+		Timestamp: started,
+	}
+	for _, r := range results {
+		c := testreport.Case{Name: r.Name, Time: r.elapsed, Message: r.Message}
+		switch r.Status {
+		case testPassed, testUpdated:
+			c.Status = testreport.Passed
+		case testFailed:
+			c.Status = testreport.Failed
+		default:
+			c.Status = testreport.Error
+		}
+		for _, row := range r.Rows {
+			c.Details = append(c.Details,
+				fmt.Sprintf("row %d:", row),
+				"- "+r.expected[row-1],
+				"+ "+r.actual[row-1])
+		}
+		for _, a := range r.Asserts {
+			status := testreport.Passed
+			switch a.Status {
+			case testFailed:
+				status = testreport.Failed
+			case testError:
+				status = testreport.Error
+			}
+			c.Asserts = append(c.Asserts, testreport.Assert{Name: a.Assert, Status: status, Message: a.Message})
+		}
+		for _, path := range r.Saved {
+			if abs, err := filepath.Abs(path); err == nil {
+				path = abs
+			}
+			c.Attachments = append(c.Attachments, path)
+		}
+		report.Cases = append(report.Cases, c)
+	}
+	for _, t := range tests[len(results):] {
+		report.Cases = append(report.Cases, testreport.Case{
+			Name:    t.Name,
+			Status:  testreport.Skipped,
+			Message: "not run after a failure with --fail-fast",
+		})
+	}
+	return report
+}
+
+// printTestResult shows the outcome of a test as it completes
+func printTestResult(r *testResult, sideBySide bool) {
+	switch r.Status {
+	case testPassed:
+		msg := fmt.Sprintf("%s (%s)", r.Name, r.Duration)
+		if r.Message != "" {
+			msg += "; " + r.Message
+		}
+		formatter.Success(msg, nil)
+	case testUpdated:
+		formatter.Success(fmt.Sprintf("%s: saved %s", r.Name, r.Golden), nil)
+	default:
+		formatter.Warning(fmt.Sprintf("%s failed: %s", r.Name, r.Message))
+		for _, a := range r.Asserts {
+			if a.Status != testPassed {
+				formatter.PrintKeyValue("assert", fmt.Sprintf("%s: %s", a.Assert, a.Message))
+			}
+		}
+		if r.expected != nil {
+			formatter.PrintLineDiff(r.expected, r.actual, output.DiffOptions{
+				ExpectedLabel: r.Golden,
+				ActualLabel:   "device",
+				SideBySide:    sideBySide,
+				Context:       1,
+			})
+		}
+		for _, path := range r.Saved {
+			formatter.Info("Saved " + path)
+		}
+	}
+}
+
+// frameSource receives the video stream for frame captures; the port is
+// only opened once a test needs it
+type frameSource struct {
+	cmd  *cobra.Command
+	pal  *palette.Palette
+	conn *net.UDPConn
+	ip   string
+	err  error
+	// noFrame is set when a capture got no frame, which mostly means a
+	// firewall drops the stream
+	noFrame bool
+}
+
+// frameTimeout is how long a capture waits for a complete frame
+const frameTimeout = 5 * time.Second
+
+func (s *frameSource) open() error {
+	streamPort := streamPorts["video"]
+	ip, err := streamDestination(s.cmd, nil)
+	if err != nil {
+		return fmt.Errorf("cannot determine the stream destination: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: streamPort})
+	if err != nil {
+		return fmt.Errorf("cannot listen on UDP port %d: %w", streamPort, err)
+	}
+	if err := loopbackProbe(conn, streamPort); err != nil {
+		conn.Close()
+		return fmt.Errorf("loopback probe failed: %w", err)
+	}
+	s.conn, s.ip = conn, ip
+	return nil
+}
+
+// capture returns the next frame, halting the CPU meanwhile with pause
+func (s *frameSource) capture(pause bool) (*image.Paletted, error) {
+	if s.conn == nil && s.err == nil {
+		s.err = s.open()
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	if pause {
+		if err := apiStep(apiClient.MachinePause); err != nil {
+			return nil, fmt.Errorf("failed to pause machine: %w", err)
+		}
+	}
+	frame, _, err := captureFrame(s.conn, s.ip, 0, frameTimeout)
+	if pause {
+		if rerr := apiStep(apiClient.MachineResume); rerr != nil && err == nil {
+			err = fmt.Errorf("failed to resume machine: %w", rerr)
+		}
+	}
+	if errors.Is(err, errNoFrame) {
+		s.noFrame = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	return frame.Image(s.pal), nil
+}
+
+func (s *frameSource) Close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func init() {
+	testCmd.AddCommand(testRunCmd)
+	testRunCmd.Flags().StringSlice("test", nil, "Run only the tests with these names")
+	testRunCmd.Flags().Bool("update", false, "Save the captures as golden references")
+	testRunCmd.Flags().String("output", "", "Directory for the captures of failed tests (default: test-output next to the spec)")
+	testRunCmd.Flags().Bool("fail-fast", false, "Stop at the first failing test")
+	testRunCmd.Flags().Bool("side-by-side", false, "Show text differences side by side")
+	testRunCmd.Flags().String("palette", "", "VICE palette (.vpl) file for frame captures")
+	testRunCmd.Flags().String("interface", "", "Receive the video stream on the address of this network interface")
+	testRunCmd.Flags().StringSlice("report", nil, "Write the results to a JUnit (.xml) or TAP (.tap) file")
+}
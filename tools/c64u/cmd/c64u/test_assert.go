@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	pathpkg "path"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/palette"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/testspec"
+)
+
+// ============================================================================
+// Test Asserts
+// ============================================================================
+
+// borderColor is the VIC-II border color register
+const borderColor = 0xD020
+
+// assertResult is the outcome of one assert of a test
+type assertResult struct {
+	Assert  string `json:"assert"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// checkAsserts checks the asserts of a test after the capture. One that
+// does not hold fails a test whose screen matched.
+func checkAsserts(t *testspec.Test, r *testResult) {
+	images := make(map[string]*driveImage)
+	failed, broken := 0, 0
+	for _, a := range t.Asserts {
+		ar := checkAssert(a, images)
+		switch ar.Status {
+		case testFailed:
+			failed++
+		case testError:
+			broken++
+		}
+		r.Asserts = append(r.Asserts, ar)
+	}
+	if failed+broken == 0 {
+		return
+	}
+
+	msg := fmt.Sprintf("%d of %s failed", failed+broken, plural(len(t.Asserts), "assert"))
+	if r.failed() {
+		r.Message += "; " + msg
+		return
+	}
+	r.Status, r.Message = testFailed, msg
+	if failed == 0 {
+		r.Status = testError
+	}
+}
+
+// checkAssert checks one assert; the images of the drives are read once
+// per test
+func checkAssert(a *testspec.Assert, images map[string]*driveImage) assertResult {
+	ar := assertResult{Assert: a.String(), Status: testPassed}
+	fail := func(status, format string, args ...interface{}) assertResult {
+		ar.Status, ar.Message = status, fmt.Sprintf(format, args...)
+		return ar
+	}
+
+	switch a.Kind {
+	case testspec.AssertMemory:
+		data, err := readMemory(a.Address, a.Length)
+		if err != nil {
+			return fail(testError, "failed to read memory: %v", err)
+		}
+		if a.Contains != nil {
+			if !bytes.Contains(data, a.Contains) {
+				return fail(testFailed, "not found")
+			}
+			return ar
+		}
+		first, n := -1, 0
+		for i := range data {
+			if data[i] != a.Equals[i] {
+				if first < 0 {
+					first = i
+				}
+				n++
+			}
+		}
+		if n > 0 {
+			msg := fmt.Sprintf("$%04X is %02X, not %02X", a.Address+first, data[first], a.Equals[first])
+			if n > 1 {
+				msg += fmt.Sprintf(" (%d bytes differ)", n)
+			}
+			return fail(testFailed, "%s", msg)
+		}
+
+	case testspec.AssertBorder:
+		data, err := readMemory(borderColor, 1)
+		if err != nil {
+			return fail(testError, "failed to read $D020: %v", err)
+		}
+		// The upper four bits of the color registers are not connected
+		if c := int(data[0] & 0x0F); c != a.Color {
+			return fail(testFailed, "the border is %s (%d)", palette.Names[c], c)
+		}
+
+	case testspec.AssertFile:
+		img, name, err := mountedDiskImage(a.Drive, images)
+		if err != nil {
+			return fail(testError, "%v", err)
+		}
+		f, err := img.Find(a.File)
+		if errors.Is(err, diskimage.ErrNotFound) {
+			return fail(testFailed, "not on %s", name)
+		}
+		if err != nil {
+			return fail(testError, "cannot read the directory of %s: %v", name, err)
+		}
+		if a.CheckType && f.Type != a.Type {
+			return fail(testFailed, "it is a %s file", strings.ToUpper(f.Type.String()))
+		}
+	}
+	return ar
+}
+
+// driveImage is the image mounted in a drive
+type driveImage struct {
+	img  *diskimage.Image
+	name string
+}
+
+// mountedDiskImage reads the image mounted in a drive from the device
+func mountedDiskImage(drive string, images map[string]*driveImage) (*diskimage.Image, string, error) {
+	if d, ok := images[drive]; ok {
+		return d.img, d.name, nil
+	}
+	_, info, err := driveStatus(drive)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot get drive status: %w", err)
+	}
+	image, _ := info["image_file"].(string)
+	dir, _ := info["image_path"].(string)
+	if image == "" {
+		return nil, "", fmt.Errorf("drive %s has no image mounted", drive)
+	}
+	data, err := retrieveDeviceFile(pathpkg.Join(dir, image))
+	if err != nil {
+		return nil, image, fmt.Errorf("cannot read %s: %w", image, err)
+	}
+	img, err := diskimage.Parse(data)
+	if err != nil {
+		return nil, image, fmt.Errorf("%s: %w", image, err)
+	}
+	images[drive] = &driveImage{img: img, name: image}
+	return img, image, nil
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/schedule"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Dashboard
+// ============================================================================
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui [--interval D]",
+	Short: "Full-screen dashboard with device, drives, runner and streams",
+	Long: `Show the device, the drives and their images, what the runner last
+started and the streams in panels, refreshed every --interval, and control
+the machine from the keyboard:
+
+  up/down  select a drive         r  reset the machine
+  m        mount an image on it   u  unmount it
+  x        run a PRG, CRT or SID  v  toggle the video stream
+  q        quit                   a  toggle the audio stream
+
+Mount and run ask for a path: a local file is uploaded, anything else is
+taken as a path on the device. The actions run as the c64u commands they
+stand for (e.g. "machine reset", "drives mount-upload"), so they behave and
+fail the same way; reset asks for confirmation first.
+
+The REST API cannot report which streams are running, so the streams panel
+shows those started or stopped from this dashboard.
+
+Example:
+  c64u tui --interval 1s`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		interval, _ := cmd.Flags().GetDuration("interval")
+		if interval <= 0 {
+			formatter.Error("Invalid interval", []string{"--interval must be positive, e.g. 2s"})
+			return
+		}
+		if !output.IsTerminal(os.Stdin) || !output.IsTerminal(os.Stdout) {
+			formatter.Error("The dashboard needs a terminal", []string{"use 'c64u overlay serve' or --json commands from scripts"})
+			return
+		}
+
+		m := &tuiModel{interval: interval, ov: &overlay{}, streams: map[string]string{}, styles: newTUIStyles()}
+		if _, err := tea.NewProgram(m, tea.WithAltScreen()).Run(); err != nil {
+			formatter.Error("Dashboard failed", []string{err.Error()})
+		}
+	},
+}
+
+// tuiStyles are the dashboard's styles, from the color theme
+type tuiStyles struct {
+	panel, title, label, dim, selected, ok, bad, prompt lipgloss.Style
+}
+
+func newTUIStyles() tuiStyles {
+	t := output.ActiveTheme()
+	color := func(c string) lipgloss.Style {
+		if formatter.NoColor {
+			return lipgloss.NewStyle()
+		}
+		return lipgloss.NewStyle().Foreground(lipgloss.Color(c))
+	}
+	return tuiStyles{
+		panel:    lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(color(t.Dim).GetForeground()).Padding(0, 1),
+		title:    color(t.Title).Bold(true),
+		label:    color(t.Label),
+		dim:      color(t.Dim),
+		selected: color(t.Highlight).Bold(true).Reverse(true),
+		ok:       color(t.Success),
+		bad:      color(t.Error),
+		prompt:   color(t.Warning).Bold(true),
+	}
+}
+
+// tuiPrompt is a question on the bottom line: a path to enter or a
+// confirmation
+type tuiPrompt struct {
+	label string
+	input string
+	// confirm takes y/n instead of text
+	confirm bool
+	done    func(input string) tea.Cmd
+}
+
+// tuiModel is the dashboard state
+type tuiModel struct {
+	interval time.Duration
+	ov       *overlay
+	status   overlayStatus
+	polled   bool
+	selected int
+	// streams maps the streams changed here to "on" or "off"
+	streams map[string]string
+	prompt  *tuiPrompt
+	running string
+	message string
+	failed  bool
+	width   int
+	styles  tuiStyles
+}
+
+// Messages
+type (
+	tuiPollMsg struct {
+		status overlayStatus
+		// refresh is set for the extra poll after an action, which does
+		// not schedule another
+		refresh bool
+	}
+	tuiTickMsg   struct{}
+	tuiActionMsg struct {
+		name string
+		out  string
+		err  error
+		done func()
+	}
+)
+
+func (m *tuiModel) Init() tea.Cmd {
+	return m.poll(false)
+}
+
+// poll reads the status in the background
+func (m *tuiModel) poll(refresh bool) tea.Cmd {
+	return func() tea.Msg {
+		m.ov.poll()
+		return tuiPollMsg{status: m.ov.get(), refresh: refresh}
+	}
+}
+
+// tick schedules the next poll
+func (m *tuiModel) tick() tea.Cmd {
+	return tea.Tick(m.interval, func(time.Time) tea.Msg { return tuiTickMsg{} })
+}
+
+// action runs a c64u command in the background; done runs when it
+// succeeds
+func (m *tuiModel) action(name string, args []string, done func()) tea.Cmd {
+	m.running, m.message = name, ""
+	return func() tea.Msg {
+		var out bytes.Buffer
+		_, err := runScheduledJob(&schedule.Job{Name: "tui-" + name, Args: args}, &out)
+		return tuiActionMsg{name: name, out: out.String(), err: err, done: done}
+	}
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+	case tuiPollMsg:
+		m.status, m.polled = msg.status, true
+		if m.selected >= len(m.status.Drives) {
+			m.selected = max(0, len(m.status.Drives)-1)
+		}
+		if msg.refresh {
+			return m, nil
+		}
+		return m, m.tick()
+	case tuiTickMsg:
+		return m, m.poll(false)
+	case tuiActionMsg:
+		m.running = ""
+		m.message, m.failed = tuiResult(msg.name, msg.out, msg.err), msg.err != nil
+		if msg.err == nil && msg.done != nil {
+			msg.done()
+		}
+		// Show the result without waiting for the next poll
+		return m, m.poll(true)
+	case tea.KeyMsg:
+		if m.prompt != nil {
+			return m, m.promptKey(msg)
+		}
+		return m, m.key(msg)
+	}
+	return m, nil
+}
+
+// tuiResult is the message line for a finished action: the last line it
+// printed
+func tuiResult(name, out string, err error) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	last := strings.TrimPrefix(strings.TrimSpace(lines[len(lines)-1]), "- ")
+	if err != nil && last == "" {
+		last = err.Error()
+	}
+	if last == "" {
+		last = "done"
+	}
+	return name + ": " + last
+}
+
+// key handles a key outside a prompt
+func (m *tuiModel) key(msg tea.KeyMsg) tea.Cmd {
+	if msg.String() == "q" || msg.String() == "ctrl+c" {
+		return tea.Quit
+	}
+	if m.running != "" {
+		return nil
+	}
+	drive, hasDrive := m.selectedDrive()
+	switch msg.String() {
+	case "up", "k":
+		m.selected = max(0, m.selected-1)
+	case "down", "j":
+		m.selected = min(max(0, len(m.status.Drives)-1), m.selected+1)
+	case "r":
+		m.prompt = &tuiPrompt{label: "Reset the machine? (y/n)", confirm: true, done: func(string) tea.Cmd {
+			return m.action("reset", []string{"machine", "reset"}, nil)
+		}}
+	case "m":
+		if hasDrive {
+			m.prompt = &tuiPrompt{label: fmt.Sprintf("Mount on drive %d: ", drive.BusID), done: func(path string) tea.Cmd {
+				return m.action("mount", tuiMountArgs(drive.Name, path), nil)
+			}}
+		}
+	case "u":
+		if hasDrive && drive.Image != "" {
+			return m.action("unmount", []string{"drives", "unmount", drive.Name}, nil)
+		}
+	case "x":
+		m.prompt = &tuiPrompt{label: "Run: ", done: func(path string) tea.Cmd {
+			return m.action("run", []string{"run", path}, nil)
+		}}
+	case "v", "a":
+		stream := map[string]string{"v": "video", "a": "audio"}[msg.String()]
+		verb, state := "start", "on"
+		if m.streams[stream] == "on" {
+			verb, state = "stop", "off"
+		}
+		return m.action(stream+" stream", []string{"streams", verb, stream}, func() { m.streams[stream] = state })
+	}
+	return nil
+}
+
+// promptKey edits or answers the prompt
+func (m *tuiModel) promptKey(msg tea.KeyMsg) tea.Cmd {
+	p := m.prompt
+	if p.confirm {
+		m.prompt = nil
+		if msg.String() == "y" {
+			return p.done("")
+		}
+		return nil
+	}
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.prompt = nil
+	case tea.KeyEnter:
+		m.prompt = nil
+		if input := strings.TrimSpace(p.input); input != "" {
+			return p.done(input)
+		}
+	case tea.KeyBackspace:
+		if r := []rune(p.input); len(r) > 0 {
+			p.input = string(r[:len(r)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		p.input += string(msg.Runes)
+	}
+	return nil
+}
+
+// tuiMountArgs mounts a local image by upload and a device path directly
+func tuiMountArgs(drive, path string) []string {
+	if _, err := os.Stat(path); err == nil {
+		return []string{"drives", "mount-upload", drive, path}
+	}
+	return []string{"drives", "mount", drive, path}
+}
+
+func (m *tuiModel) selectedDrive() (indicatorDrive, bool) {
+	if m.selected < len(m.status.Drives) {
+		return m.status.Drives[m.selected], true
+	}
+	return indicatorDrive{}, false
+}
+
+func (m *tuiModel) View() string {
+	s := m.styles
+	panels := []string{m.devicePanel(), m.drivesPanel(), m.runnerPanel(), m.streamsPanel()}
+
+	// Two columns when they fit, else one
+	width := 38
+	if m.width >= 2*width+4 {
+		width = m.width/2 - 2
+	} else if m.width > 4 {
+		width = m.width - 2
+	}
+	for i, p := range panels {
+		panels[i] = s.panel.Width(width).Render(p)
+	}
+	var body string
+	if m.width >= 2*38+4 {
+		body = lipgloss.JoinVertical(lipgloss.Left,
+			lipgloss.JoinHorizontal(lipgloss.Top, panels[0], panels[2]),
+			lipgloss.JoinHorizontal(lipgloss.Top, panels[1], panels[3]))
+	} else {
+		body = lipgloss.JoinVertical(lipgloss.Left, panels...)
+	}
+
+	var bottom string
+	switch {
+	case m.prompt != nil:
+		bottom = s.prompt.Render(m.prompt.label) + m.prompt.input + "█"
+	case m.running != "":
+		bottom = s.dim.Render(m.running + "...")
+	case m.message != "" && m.failed:
+		bottom = s.bad.Render(truncate(m.message, max(m.width, 40)))
+	case m.message != "":
+		bottom = s.ok.Render(truncate(m.message, max(m.width, 40)))
+	}
+	help := s.dim.Render("↑/↓ drive  m mount  u unmount  x run  r reset  v video  a audio  q quit")
+	return lipgloss.JoinVertical(lipgloss.Left, body, bottom, help)
+}
+
+// field is a "label value" line of a panel
+func (m *tuiModel) field(label, value string) string {
+	return m.styles.label.Render(fmt.Sprintf("%-9s", label)) + " " + value
+}
+
+func (m *tuiModel) devicePanel() string {
+	s, st := m.styles, m.status
+	lines := []string{s.title.Render("Device"), m.field("host", fmt.Sprintf("%s:%d", host, port))}
+	switch {
+	case !m.polled:
+		lines = append(lines, m.field("status", s.dim.Render("connecting...")))
+	case !st.Online:
+		lines = append(lines, m.field("status", s.bad.Render("offline")), s.dim.Render(truncate(st.Error, 60)))
+	default:
+		lines = append(lines,
+			m.field("status", s.ok.Render("online")),
+			m.field("product", st.Product),
+			m.field("firmware", st.Firmware),
+			m.field("polled", st.Time.Format("15:04:05")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *tuiModel) drivesPanel() string {
+	s := m.styles
+	lines := []string{s.title.Render("Drives")}
+	if len(m.status.Drives) == 0 {
+		lines = append(lines, s.dim.Render("no drives"))
+	}
+	for i, d := range m.status.Drives {
+		led := s.dim.Render("○")
+		if d.Active {
+			led = s.ok.Render("●")
+		}
+		image := d.Image
+		switch {
+		case !d.Enabled:
+			image = s.dim.Render("off")
+		case image == "":
+			image = s.dim.Render("empty")
+		}
+		bus := fmt.Sprintf("%2d", d.BusID)
+		if i == m.selected {
+			bus = s.selected.Render(bus)
+		}
+		lines = append(lines, bus+" "+led+" "+image)
+	}
+	if m.status.Busy {
+		lines = append(lines, s.dim.Render("bus busy"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *tuiModel) runnerPanel() string {
+	s, np := m.styles, m.status.Playing
+	lines := []string{s.title.Render("Runner")}
+	if np == nil {
+		return strings.Join(append(lines, s.dim.Render("nothing started")), "\n")
+	}
+	lines = append(lines, m.field("file", np.File), m.field("kind", np.Kind))
+	if np.SID != nil {
+		lines = append(lines, m.field("title", np.SID.Title), m.field("author", np.SID.Author))
+	}
+	if np.Song > 0 {
+		lines = append(lines, m.field("song", fmt.Sprint(np.Song)))
+	}
+	lines = append(lines, m.field("since", formatter.Duration(time.Since(np.Time).Truncate(time.Second))))
+	return strings.Join(lines, "\n")
+}
+
+func (m *tuiModel) streamsPanel() string {
+	s := m.styles
+	lines := []string{s.title.Render("Streams")}
+	for _, stream := range []string{"video", "audio", "debug"} {
+		state := s.dim.Render("not changed here")
+		switch m.streams[stream] {
+		case "on":
+			state = s.ok.Render("on")
+		case "off":
+			state = "off"
+		}
+		lines = append(lines, m.field(stream, state))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func init() {
+	tuiCmd.Flags().Duration("interval", 2*time.Second, "How often to poll the device")
+}
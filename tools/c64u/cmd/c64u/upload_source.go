@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/archive"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/config"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/fetch"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// File types accepted by the upload commands, used to pick the payload
+// from archives
+var (
+	sidExts  = []string{".sid"}
+	modExts  = []string{".mod"}
+	prgExts  = []string{".prg"}
+	crtExts  = []string{".crt"}
+	diskExts = []string{".d64", ".g64", ".d71", ".g71", ".d81"}
+	romExts  = []string{".rom", ".bin"}
+)
+
+// resolveUploadFile turns the local file argument of an upload command
+// into the file to upload. "-" reads the file from stdin; an http(s) URL
+// is downloaded first (through the download cache, checked against
+// --sha256). An archive (.zip, .gz, .lnx, .ark, .lbr) is
+// extracted to a temporary directory (the entry is picked by exts and
+// --entry); cleanup removes it and also runs if the command exits with an
+// error.
+func resolveUploadFile(cmd *cobra.Command, arg string, exts []string) (string, func(), bool) {
+	noop := func() {}
+
+	if arg == "-" {
+		file, cleanup, ok := readUploadStdin(cmd, exts)
+		if !ok {
+			return "", cleanup, false
+		}
+		if !archive.IsArchive(file) {
+			return file, cleanup, true
+		}
+		local, extracted, ok := extractUploadFile(cmd, file, exts)
+		return local, func() { extracted(); cleanup() }, ok
+	}
+
+	if fetch.IsURL(arg) {
+		file, ok := downloadUploadFile(cmd, arg)
+		if !ok {
+			return "", noop, false
+		}
+		arg = file
+	} else if _, err := os.Stat(arg); os.IsNotExist(err) {
+		formatter.Error("File not found", []string{arg})
+		return "", noop, false
+	}
+	if !archive.IsArchive(arg) {
+		return arg, noop, true
+	}
+	return extractUploadFile(cmd, arg, exts)
+}
+
+// extractUploadFile extracts the entry to upload from an archive into a
+// temporary directory
+func extractUploadFile(cmd *cobra.Command, arg string, exts []string) (string, func(), bool) {
+	noop := func() {}
+
+	pattern, _ := cmd.Flags().GetString("entry")
+	entries, err := archive.List(arg)
+	if err != nil {
+		formatter.Error("Failed to read archive", []string{err.Error()})
+		return "", noop, false
+	}
+	entry, err := archive.Select(entries, exts, pattern)
+	if err != nil {
+		formatter.Error(fmt.Sprintf("Cannot pick a file from %s", filepath.Base(arg)), []string{err.Error()})
+		return "", noop, false
+	}
+
+	dir, err := os.MkdirTemp("", "c64u-upload-*")
+	if err != nil {
+		formatter.Error("Failed to create temporary directory", []string{err.Error()})
+		return "", noop, false
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	output.OnExit(func(int) { cleanup() })
+
+	local := filepath.Join(dir, path.Base(entry.Name))
+	if err := archive.Extract(arg, entry.Name, local); err != nil {
+		formatter.Error("Failed to extract archive", []string{err.Error()})
+		return "", cleanup, false
+	}
+	if verbose {
+		fmt.Printf("→ Extracted %s from %s\n", entry.Name, filepath.Base(arg))
+	}
+	return local, cleanup, true
+}
+
+// readUploadStdin buffers stdin into a temporary file, as uploads need a
+// sized body. The file is named by --stdin-name, or gets the first of exts
+// (or .zip/.gz if the data is an archive) so the upload type is known.
+func readUploadStdin(cmd *cobra.Command, exts []string) (string, func(), bool) {
+	noop := func() {}
+
+	if output.IsTerminal(os.Stdin) {
+		formatter.Error("No input on stdin", []string{"pipe a file into the command, e.g. make prg | c64u runners run-prg-upload -"})
+		return "", noop, false
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		formatter.Error("Failed to read stdin", []string{err.Error()})
+		return "", noop, false
+	}
+	if len(data) == 0 {
+		formatter.Error("No input on stdin", []string{"the input was empty"})
+		return "", noop, false
+	}
+
+	name, _ := cmd.Flags().GetString("stdin-name")
+	if name == "" {
+		name = "stdin"
+		switch {
+		case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+			name += ".zip"
+		case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+			name += ".gz"
+		case len(exts) > 0:
+			name += exts[0]
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "c64u-stdin-*")
+	if err != nil {
+		formatter.Error("Failed to create temporary directory", []string{err.Error()})
+		return "", noop, false
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	output.OnExit(func(int) { cleanup() })
+
+	file := filepath.Join(dir, filepath.Base(name))
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		formatter.Error("Failed to buffer stdin", []string{err.Error()})
+		return "", cleanup, false
+	}
+	if verbose {
+		fmt.Printf("→ Read %s from stdin\n", formatter.Size(int64(len(data))))
+	}
+	return file, cleanup, true
+}
+
+// downloadUploadFile fetches a URL argument into the download cache. A new
+// download is checked against --sha256 or a published checksum, and a
+// published GPG signature, before anything is sent to the device.
+func downloadUploadFile(cmd *cobra.Command, rawURL string) (string, bool) {
+	noCache, _ := cmd.Flags().GetBool("no-cache")
+	sum, _ := cmd.Flags().GetString("sha256")
+	skipVerify, _ := cmd.Flags().GetBool("insecure-skip-verify")
+
+	cache := fetch.NewCache(filepath.Join(config.GetConfigDir(), "cache", "downloads"))
+	cache.Verbose = verbose
+	file, cached, err := cache.Get(rawURL, noCache)
+	if err != nil {
+		formatter.Error("Failed to download file", []string{err.Error()})
+		return "", false
+	}
+	if verbose && cached {
+		fmt.Printf("→ Using cached download of %s\n", rawURL)
+	}
+
+	if skipVerify {
+		formatter.Warning(fmt.Sprintf("Verification of %s skipped", filepath.Base(file)))
+		return file, true
+	}
+
+	fail := func(msg string, details ...string) (string, bool) {
+		// Drop a bad download so the next attempt fetches it again
+		os.RemoveAll(filepath.Dir(file))
+		formatter.Error(msg, append(details, "use --insecure-skip-verify to upload it anyway"))
+		return "", false
+	}
+	// Published checksums and signatures are only fetched for new
+	// downloads; cached files were checked when they were downloaded
+	checked := cached && fetch.Verified(file)
+	if sum == "" && !checked {
+		if sum, err = cache.PublishedSHA256(rawURL); err != nil {
+			return fail("Failed to fetch the published checksum", err.Error())
+		}
+	}
+	if sum != "" {
+		if err := fetch.VerifySHA256(file, sum); err != nil {
+			return fail("Checksum verification failed", err.Error())
+		}
+		if verbose {
+			fmt.Printf("→ SHA-256 verified: %s\n", strings.ToLower(sum))
+		}
+	}
+	if checked {
+		return file, true
+	}
+
+	sig, err := cache.PublishedSignature(rawURL)
+	if err != nil {
+		return fail("Failed to fetch the published signature", err.Error())
+	}
+	if sig != nil {
+		if err := fetch.VerifyGPG(file, sig); err != nil {
+			return fail("Signature verification failed", err.Error())
+		}
+		if verbose {
+			fmt.Println("→ GPG signature verified")
+		}
+	}
+	if err := fetch.MarkVerified(file); err != nil {
+		formatter.Warning(fmt.Sprintf("Failed to update download cache: %v", err))
+	}
+
+	if sum == "" && sig == nil {
+		formatter.Warning(fmt.Sprintf("No checksum published for %s; pass --sha256 to verify it", filepath.Base(file)))
+	}
+	return file, true
+}
+
+// addUploadSourceFlags registers the flags used by resolveUploadFile
+func addUploadSourceFlags(cmds ...*cobra.Command) {
+	for _, c := range cmds {
+		c.Flags().String("entry", "", "File to use from an archive (name or glob)")
+		c.Flags().String("sha256", "", "Expected SHA-256 of a downloaded file")
+		c.Flags().Bool("no-cache", false, "Download URLs again instead of using the cache")
+		c.Flags().Bool("insecure-skip-verify", false, "Do not verify checksums and signatures of downloads")
+		c.Flags().String("stdin-name", "", "File name for data read from stdin with '-' (sets its type)")
+	}
+}
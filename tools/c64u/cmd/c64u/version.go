@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// latestReleaseURL is the GitHub API endpoint for the newest release
+var latestReleaseURL = "https://api.github.com/repos/cybersorcerer/c64.nvim/releases/latest"
+
+// versionCmd represents the version command
+var versionCmd = &cobra.Command{
+	Use:   "version [--check-latest]",
+	Short: "Show version information",
+	Long: `Display the version, build commit and build date of the c64u CLI tool,
+with the Go version and platform it was built for. With --json the module
+build information (dependencies and build settings) is included, e.g. for
+packaging or bug reports.
+
+--check-latest asks GitHub for the latest release and reports whether an
+update is available; the exit code is 0 when up to date or newer, 1 when an
+update is available.
+
+Examples:
+  c64u version
+  c64u version --check-latest
+  c64u --json version`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkLatest, _ := cmd.Flags().GetBool("check-latest")
+
+		var latest *releaseInfo
+		var checkErr error
+		if checkLatest {
+			latest, checkErr = fetchLatestRelease()
+		}
+
+		if jsonOut {
+			data := map[string]interface{}{
+				"version":  version,
+				"commit":   commit,
+				"date":     date,
+				"go":       runtime.Version(),
+				"platform": runtime.GOOS + "/" + runtime.GOARCH,
+			}
+			if info := buildInfo(); info != nil {
+				data["build"] = info
+			}
+			if checkLatest {
+				latestData := map[string]interface{}{}
+				if checkErr != nil {
+					latestData["error"] = checkErr.Error()
+				} else {
+					latestData["version"] = latest.Tag
+					latestData["url"] = latest.URL
+					latestData["published"] = latest.Published
+					latestData["update_available"] = updateAvailable(version, latest.Tag)
+				}
+				data["latest"] = latestData
+			}
+			formatter.PrintData(data)
+			if checkLatest && (checkErr != nil || updateAvailable(version, latest.Tag)) {
+				output.Exit(1)
+			}
+			return
+		}
+
+		fmt.Printf("c64u version %s\n", version)
+		fmt.Printf("  commit:   %s\n", commit)
+		fmt.Printf("  built:    %s\n", date)
+		fmt.Printf("  go:       %s\n", runtime.Version())
+		fmt.Printf("  platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+		if !checkLatest {
+			return
+		}
+		if checkErr != nil {
+			formatter.Error("Failed to check for the latest release", []string{checkErr.Error()})
+			return
+		}
+		switch {
+		case updateAvailable(version, latest.Tag):
+			formatter.Warning(fmt.Sprintf("c64u %s is available: %s", latest.Tag, latest.URL))
+			output.Exit(1)
+		case parseVersion(version) == nil:
+			formatter.Info(fmt.Sprintf("Latest release is %s (development build, cannot compare)", latest.Tag))
+		default:
+			formatter.Success(fmt.Sprintf("c64u is up to date (latest release %s)", latest.Tag), nil)
+		}
+	},
+}
+
+// releaseInfo is the part of a GitHub release used here
+type releaseInfo struct {
+	Tag       string    `json:"tag_name"`
+	URL       string    `json:"html_url"`
+	Published time.Time `json:"published_at"`
+}
+
+// fetchLatestRelease asks GitHub for the newest release
+func fetchLatestRelease() (*releaseInfo, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest(http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "c64u/"+version)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", latestReleaseURL, resp.Status)
+	}
+
+	var rel releaseInfo
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return nil, fmt.Errorf("invalid release information: %w", err)
+	}
+	if rel.Tag == "" {
+		return nil, fmt.Errorf("release information without a tag")
+	}
+	return &rel, nil
+}
+
+// parseVersion extracts the numeric parts of a version such as "v0.4.1",
+// "0.4.1-rc1" or "v0.4.1-3-gabc1234-dirty" (git describe); nil if there
+// are none
+func parseVersion(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var parts []int
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// compareVersions compares two versions numerically (-1, 0, 1). Versions
+// that do not parse, such as "dev", compare equal to anything.
+func compareVersions(a, b string) int {
+	pa, pb := parseVersion(a), parseVersion(b)
+	if pa == nil || pb == nil {
+		return 0
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// updateAvailable reports whether latest is newer than current
+func updateAvailable(current, latest string) bool {
+	return compareVersions(current, latest) < 0
+}
+
+// buildInfo returns the module build information embedded by the Go
+// toolchain
+func buildInfo() map[string]interface{} {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+
+	deps := make([]map[string]string, 0, len(info.Deps))
+	for _, d := range info.Deps {
+		dep := map[string]string{"path": d.Path, "version": d.Version}
+		if d.Replace != nil {
+			dep["replace"] = d.Replace.Path + "@" + d.Replace.Version
+		}
+		deps = append(deps, dep)
+	}
+	settings := make(map[string]string, len(info.Settings))
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	return map[string]interface{}{
+		"path":         info.Path,
+		"main":         info.Main.Path,
+		"main_version": info.Main.Version,
+		"go_version":   info.GoVersion,
+		"settings":     settings,
+		"deps":         deps,
+	}
+}
+
+func init() {
+	versionCmd.Flags().Bool("check-latest", false, "Check whether a newer release is available")
+}
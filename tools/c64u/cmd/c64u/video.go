@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/palette"
+	"github.com/spf13/cobra"
+)
+
+// videoCmd represents the video command group
+var videoCmd = &cobra.Command{
+	Use:   "video",
+	Short: "Video settings (U64 only)",
+	Long:  `Change Ultimate 64 video settings such as the color palette.`,
+}
+
+var videoPaletteCmd = &cobra.Command{
+	Use:   "palette",
+	Short: "Manage the VIC-II color palette",
+	Long: `List, select and upload color palettes.
+
+The palette is selected with the device's "Palette" configuration setting.
+Custom palettes are VICE .vpl files.`,
+}
+
+var videoPaletteListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the palettes the firmware offers",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		item, ok := paletteSetting()
+		if !ok {
+			return
+		}
+		options := configOptions(item)
+
+		if jsonOut {
+			formatter.PrintData(map[string]interface{}{
+				"active":   item.Value,
+				"palettes": options,
+			})
+			return
+		}
+
+		rows := make([][]string, 0, len(options))
+		for _, opt := range options {
+			active := ""
+			if opt == fmt.Sprintf("%v", item.Value) {
+				active = "*"
+			}
+			rows = append(rows, []string{opt, active})
+		}
+		formatter.PrintTable([]string{"palette", "active"}, rows)
+	},
+}
+
+var videoPaletteSetCmd = &cobra.Command{
+	Use:   "set <name> [--save]",
+	Short: "Select a palette",
+	Long: `Select one of the palettes shown by "video palette list" (case-insensitive).
+
+Example:
+  c64u video palette set colodore --save`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		save, _ := cmd.Flags().GetBool("save")
+
+		item, ok := paletteSetting()
+		if !ok {
+			return
+		}
+		name, ok := matchOption(configOptions(item), args[0])
+		if !ok {
+			formatter.Error("Unknown palette", []string{fmt.Sprintf("'%s' is not offered by the firmware; see 'c64u video palette list'", args[0])})
+			return
+		}
+
+		if !setConfigItem(item, name) {
+			return
+		}
+		if save && !saveConfigToFlash() {
+			return
+		}
+		formatter.Success(fmt.Sprintf("Palette set to %s", name), map[string]interface{}{
+			"previous": item.Value,
+		})
+	},
+}
+
+var videoPaletteUploadCmd = &cobra.Command{
+	Use:   "upload <file.vpl> [--remote-dir DIR] [--save]",
+	Short: "Upload a VICE palette file",
+	Long: `Validate a VICE palette (.vpl) file, copy it to the device over FTP and
+select it if the firmware lists it as a palette.
+
+The REST API cannot install palettes directly; if the firmware does not
+pick up the file, select it from the Ultimate menu.
+
+Examples:
+  c64u video palette upload pepto.vpl
+  c64u video palette upload mine.vpl --remote-dir /Usb0/palettes --save`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		remoteDir, _ := cmd.Flags().GetString("remote-dir")
+		save, _ := cmd.Flags().GetBool("save")
+		local := args[0]
+
+		pal, err := palette.Load(local)
+		if err != nil {
+			formatter.Error("Invalid palette file", []string{err.Error()})
+			return
+		}
+
+		conn, err := dialFTP()
+		if err != nil {
+			formatter.Error("Failed to connect", []string{err.Error()})
+			return
+		}
+		defer conn.Close()
+
+		remote := path.Join(remoteDir, filepath.Base(local))
+		if err := conn.MkdirAll(remoteDir); err != nil {
+			formatter.Error("Failed to upload palette", []string{err.Error()})
+			return
+		}
+		if err := conn.Upload(local, remote); err != nil {
+			formatter.Error("Failed to upload palette", []string{err.Error()})
+			return
+		}
+
+		// Select the palette if the firmware offers the uploaded file
+		selected := ""
+		if items, err := apiClient.ConfigItems("*", "*Palette*"); err == nil && len(items) > 0 {
+			options := configOptions(items[0])
+			base := filepath.Base(local)
+			for _, name := range []string{strings.TrimSuffix(base, filepath.Ext(base)), base} {
+				if opt, ok := matchOption(options, name); ok {
+					if !setConfigItem(items[0], opt) {
+						return
+					}
+					selected = opt
+					break
+				}
+			}
+		}
+
+		if selected == "" {
+			formatter.Warning(fmt.Sprintf("Uploaded to %s, but the firmware does not list it as a palette; select it from the Ultimate menu", remote))
+		} else if save && !saveConfigToFlash() {
+			return
+		}
+
+		hex := make([]string, len(pal.Colors))
+		for i, c := range pal.Colors {
+			hex[i] = c.Hex()
+		}
+		data := map[string]interface{}{
+			"remote": remote,
+			"colors": strings.Join(hex, " "),
+		}
+		if selected != "" {
+			data["selected"] = selected
+		}
+		formatter.Success(fmt.Sprintf("Palette %s uploaded", filepath.Base(local)), data)
+	},
+}
+
+// paletteSetting returns the palette configuration item
+func paletteSetting() (api.ConfigItem, bool) {
+	items, err := apiClient.ConfigItems("*", "*Palette*")
+	if err == nil && len(items) == 0 {
+		err = fmt.Errorf("the device has no palette setting (U64 only)")
+	}
+	if err != nil {
+		formatter.Error("Failed to read palette setting", []string{err.Error()})
+		return api.ConfigItem{}, false
+	}
+	return items[0], true
+}
+
+// matchOption finds an option by case-insensitive name
+func matchOption(options []string, name string) (string, bool) {
+	for _, opt := range options {
+		if strings.EqualFold(strings.TrimSpace(opt), name) {
+			return opt, true
+		}
+	}
+	return "", false
+}
+
+func init() {
+	videoPaletteSetCmd.Flags().Bool("save", false, "Save the configuration to flash")
+	videoPaletteUploadCmd.Flags().String("remote-dir", "/Usb0/palettes", "Directory on the device for palette files")
+	videoPaletteUploadCmd.Flags().Bool("save", false, "Save the configuration to flash")
+	addPreserveFlags(videoPaletteSetCmd, videoPaletteUploadCmd)
+
+	videoPaletteCmd.AddCommand(videoPaletteListCmd)
+	videoPaletteCmd.AddCommand(videoPaletteSetCmd)
+	videoPaletteCmd.AddCommand(videoPaletteUploadCmd)
+	videoCmd.AddCommand(videoPaletteCmd)
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/output"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/screen"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/vicemon"
+	"github.com/spf13/cobra"
+)
+
+// ============================================================================
+// Emulator Cross-Check
+// ============================================================================
+
+var xcheckCmd = &cobra.Command{
+	Use:   "xcheck <file.prg> --emulator vice [--at D,...] [--mem START-END ...]",
+	Short: "Run a program on the device and in VICE and compare them",
+	Long: `Run the same local PRG on the Ultimate and in VICE, halt both at each
+checkpoint, compare their text screen, color RAM and any --mem ranges,
+and report where they diverge. Useful to find where an emulator and the
+hardware disagree.
+
+Checkpoints are times after each side started the program (default 5s).
+Both sides are halted while they are read, the Ultimate by DMA pause and
+VICE by its monitor, and the halts are left out of the times. The two
+start the program in different ways (DMA load and VICE autostart), so
+they do not reach the same cycle at the same time: compare states a
+program settles in, not ones that change every frame. The screen is
+found from $DD00/$D018 on each side; only the low nibble of color RAM
+is compared.
+
+VICE must run with its binary monitor (x64sc -binarymonitor), at
+--monitor; --start launches --vice-binary with it and quits it after the
+check. --mem takes hex ranges, last address included. Exits with status 1
+when the sides diverge.
+
+Examples:
+  c64u xcheck demo.prg --emulator vice --start
+  c64u xcheck test.prg --emulator vice --at 2s,10s --mem c000-c0ff
+  c64u xcheck raster.prg --emulator vice --mem d020-d021 --summary`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		emulator, _ := cmd.Flags().GetString("emulator")
+		checkpoints, _ := cmd.Flags().GetDurationSlice("at")
+		ranges, _ := cmd.Flags().GetStringSlice("mem")
+		monitor, _ := cmd.Flags().GetString("monitor")
+		start, _ := cmd.Flags().GetBool("start")
+		binary, _ := cmd.Flags().GetString("vice-binary")
+		summaryOnly, _ := cmd.Flags().GetBool("summary")
+
+		if emulator != "vice" {
+			formatter.Error("Unsupported emulator", []string{
+				fmt.Sprintf("'%s' is not supported; the only emulator is vice", emulator),
+			})
+			return
+		}
+		prg, err := filepath.Abs(args[0])
+		if err == nil {
+			_, err = os.Stat(prg)
+		}
+		if err != nil {
+			formatter.Error("Cannot read program", []string{err.Error(), "xcheck needs a local PRG file for the emulator"})
+			return
+		}
+		if len(checkpoints) == 0 {
+			formatter.Error("No checkpoints", []string{"give times with --at, e.g. --at 2s,10s"})
+			return
+		}
+		sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i] < checkpoints[j] })
+
+		regions := []xcheckRegion{
+			{Name: "screen"},
+			{Name: "color $D800", Address: 0xD800, Length: screen.Size, Mask: 0x0F},
+		}
+		for _, r := range ranges {
+			region, err := parseXcheckRange(r)
+			if err != nil {
+				formatter.Error("Invalid memory range", []string{err.Error()})
+				return
+			}
+			regions = append(regions, region)
+		}
+
+		vice, err := connectVice(monitor, start, binary)
+		if err != nil {
+			hints := []string{err.Error()}
+			if !start {
+				hints = append(hints,
+					fmt.Sprintf("Start VICE with: x64sc -binarymonitor -binarymonitoraddress ip4://%s", monitor),
+					"or let xcheck launch it with --start")
+			}
+			formatter.Error("Cannot reach the VICE monitor", hints)
+			return
+		}
+		defer vice.Close()
+
+		sides := []*xcheckSide{
+			{
+				name:   "device",
+				pause:  func() error { return apiStep(apiClient.MachinePause) },
+				resume: func() error { return apiStep(apiClient.MachineResume) },
+				read:   readMemory,
+			},
+			{
+				name:   "vice",
+				pause:  func() error { return nil }, // any monitor command halts VICE
+				resume: vice.Resume,
+				read:   vice.ReadMemory,
+			},
+		}
+
+		if !runProgram(args[0]) {
+			return
+		}
+		sides[0].started = time.Now()
+		if err := vice.Autostart(prg); err == nil {
+			err = vice.Resume()
+		}
+		if err != nil {
+			formatter.Error("Failed to start the program in VICE", []string{err.Error()})
+			return
+		}
+		sides[1].started = time.Now()
+
+		var diffs []xcheckDiff
+		var rows [][]string
+		for _, at := range checkpoints {
+			snaps, err := xcheckSnapshots(sides, at, regions)
+			if err != nil {
+				formatter.Error(fmt.Sprintf("Checkpoint %s failed", at), []string{err.Error()})
+				return
+			}
+			for i, region := range regions {
+				device, emu := snaps[0][i], snaps[1][i]
+				d := xcheckDiff{Checkpoint: at.String(), Region: region.label(device.address, emu.address)}
+				for _, r := range output.DiffBytes(device.data, emu.data) {
+					d.Bytes += len(r.Expected)
+					d.Ranges = append(d.Ranges, map[string]interface{}{
+						"address": fmt.Sprintf("$%04X", device.address+r.Offset),
+						"length":  len(r.Expected),
+						"device":  hex.EncodeToString(r.Expected),
+						"vice":    hex.EncodeToString(r.Actual),
+					})
+				}
+				result := "match"
+				if d.Bytes > 0 {
+					result = plural(d.Bytes, "differing byte")
+					diffs = append(diffs, d)
+					if !jsonOut && !summaryOnly {
+						printXcheckDiff(d, region, device, emu)
+					}
+				}
+				rows = append(rows, []string{d.Checkpoint, d.Region, result})
+			}
+		}
+
+		if start {
+			vice.Quit()
+		}
+
+		if jsonOut {
+			if diffs == nil {
+				diffs = []xcheckDiff{}
+			}
+			formatter.PrintData(map[string]interface{}{
+				"equal":       len(diffs) == 0,
+				"program":     args[0],
+				"checkpoints": len(checkpoints),
+				"divergences": diffs,
+			})
+		} else {
+			formatter.PrintTable([]string{"checkpoint", "region", "result"}, rows)
+		}
+		if len(diffs) > 0 {
+			if !jsonOut {
+				formatter.Info(fmt.Sprintf("Divergences: %s of %s",
+					plural(len(diffs), "region"), plural(len(rows), "comparison")))
+			}
+			output.Exit(1)
+		}
+	},
+}
+
+// xcheckRegion is memory compared at each checkpoint; the screen has no
+// fixed address
+type xcheckRegion struct {
+	Name    string
+	Address int
+	Length  int
+	// Mask selects the bits compared, all if zero
+	Mask byte
+}
+
+// label names the region, with the screen addresses of both sides
+func (r xcheckRegion) label(device, vice int) string {
+	if r.Name != "screen" {
+		return r.Name
+	}
+	if device == vice {
+		return fmt.Sprintf("screen $%04X", device)
+	}
+	return fmt.Sprintf("screen $%04X/$%04X", device, vice)
+}
+
+// parseXcheckRange parses a hex range like c000-c0ff, last address
+// included
+func parseXcheckRange(s string) (xcheckRegion, error) {
+	from, to, ok := strings.Cut(s, "-")
+	first, err1 := strconv.ParseUint(from, 16, 16)
+	last, err2 := strconv.ParseUint(to, 16, 16)
+	if !ok || err1 != nil || err2 != nil || last < first {
+		return xcheckRegion{}, fmt.Errorf("'%s' is not a hex range like c000-c0ff", s)
+	}
+	return xcheckRegion{
+		Name:    fmt.Sprintf("$%04X-$%04X", first, last),
+		Address: int(first),
+		Length:  int(last-first) + 1,
+	}, nil
+}
+
+// xcheckSide is a machine running the program; started and halted set
+// its clock, the time the program has run
+type xcheckSide struct {
+	name    string
+	started time.Time
+	halted  time.Duration
+	pause   func() error
+	resume  func() error
+	read    func(address, length int) ([]byte, error)
+}
+
+// due returns when the side's clock reaches at
+func (s *xcheckSide) due(at time.Duration) time.Time {
+	return s.started.Add(s.halted + at)
+}
+
+// xcheckSnapshot is a region as read from one side
+type xcheckSnapshot struct {
+	address int
+	data    []byte
+}
+
+// xcheckSnapshots halts each side when its clock reaches at, reads the
+// regions and resumes it; snapshots are indexed by side, then region
+func xcheckSnapshots(sides []*xcheckSide, at time.Duration, regions []xcheckRegion) ([][]xcheckSnapshot, error) {
+	order := make([]int, len(sides))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return sides[order[i]].due(at).Before(sides[order[j]].due(at)) })
+
+	snaps := make([][]xcheckSnapshot, len(sides))
+	for _, i := range order {
+		side := sides[i]
+		time.Sleep(time.Until(side.due(at)))
+		halt := time.Now()
+		if err := side.pause(); err != nil {
+			return nil, fmt.Errorf("%s: %w", side.name, err)
+		}
+		for _, region := range regions {
+			snap, err := xcheckRead(side, region)
+			if err != nil {
+				side.resume()
+				return nil, fmt.Errorf("%s: %w", side.name, err)
+			}
+			snaps[i] = append(snaps[i], snap)
+		}
+		if err := side.resume(); err != nil {
+			return nil, fmt.Errorf("%s: %w", side.name, err)
+		}
+		side.halted += time.Since(halt)
+	}
+	return snaps, nil
+}
+
+// xcheckRead reads a region from a side
+func xcheckRead(side *xcheckSide, region xcheckRegion) (xcheckSnapshot, error) {
+	address, length := region.Address, region.Length
+	if region.Name == "screen" {
+		cia, err := side.read(0xDD00, 1)
+		if err != nil {
+			return xcheckSnapshot{}, err
+		}
+		vic, err := side.read(0xD018, 1)
+		if err != nil {
+			return xcheckSnapshot{}, err
+		}
+		address, length = screen.BaseFrom(cia[0], vic[0]), screen.Size
+	}
+	data, err := side.read(address, length)
+	if err != nil {
+		return xcheckSnapshot{}, err
+	}
+	if region.Mask != 0 {
+		masked := make([]byte, len(data))
+		for i, b := range data {
+			masked[i] = b & region.Mask
+		}
+		data = masked
+	}
+	return xcheckSnapshot{address: address, data: data}, nil
+}
+
+// xcheckDiff is a region that differs at a checkpoint
+type xcheckDiff struct {
+	Checkpoint string                   `json:"checkpoint"`
+	Region     string                   `json:"region"`
+	Bytes      int                      `json:"bytes"`
+	Ranges     []map[string]interface{} `json:"ranges"`
+}
+
+// printXcheckDiff shows a divergence: the differing rows of a screen as
+// text, other regions as a hex diff
+func printXcheckDiff(d xcheckDiff, region xcheckRegion, device, vice xcheckSnapshot) {
+	title := d.Checkpoint + " " + d.Region
+	if region.Name != "screen" {
+		formatter.PrintHexHunks(device.address, device.data, vice.data, output.DiffOptions{
+			ExpectedLabel: "device", ActualLabel: "vice", Title: title,
+		})
+		return
+	}
+	fmt.Println(title)
+	deviceLines := (&screen.Screen{Codes: device.data}).Lines()
+	viceLines := (&screen.Screen{Codes: vice.data}).Lines()
+	for row := range deviceLines {
+		if deviceLines[row] != viceLines[row] {
+			fmt.Printf("  row %2d device: %s\n", row, deviceLines[row])
+			fmt.Printf("  row %2d vice:   %s\n", row, viceLines[row])
+		}
+	}
+	fmt.Println()
+}
+
+// connectVice connects to the VICE binary monitor, first launching VICE
+// if start is set
+func connectVice(monitor string, start bool, binary string) (*vicemon.Client, error) {
+	if !start {
+		return vicemon.Dial(monitor, 5*time.Second)
+	}
+
+	proc := exec.Command(binary, "-binarymonitor", "-binarymonitoraddress", "ip4://"+monitor)
+	if err := proc.Start(); err != nil {
+		return nil, fmt.Errorf("cannot start %s: %w", binary, err)
+	}
+	// Error exits leave no emulator behind
+	output.OnExit(func(int) { proc.Process.Kill() })
+	go proc.Wait()
+
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		c, err := vicemon.Dial(monitor, 5*time.Second)
+		if err == nil || time.Now().After(deadline) {
+			return c, err
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func init() {
+	xcheckCmd.Flags().String("emulator", "", "Emulator to compare with (vice)")
+	xcheckCmd.Flags().DurationSlice("at", []time.Duration{5 * time.Second}, "Checkpoint times after the program start")
+	xcheckCmd.Flags().StringSlice("mem", nil, "Hex memory range to compare, e.g. c000-c0ff (repeatable)")
+	xcheckCmd.Flags().String("monitor", vicemon.DefaultAddr, "Address of the VICE binary monitor")
+	xcheckCmd.Flags().Bool("start", false, "Launch VICE with the binary monitor and quit it afterwards")
+	xcheckCmd.Flags().String("vice-binary", "x64sc", "VICE executable for --start")
+	xcheckCmd.Flags().Bool("summary", false, "Show only the table of results")
+	xcheckCmd.MarkFlagRequired("emulator")
+}
@@ -0,0 +1,287 @@
+// Command apigen generates the low-level C64 Ultimate REST API bindings
+// (endpoints_gen.go) from the OpenAPI description in openapi.yaml.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// spec is the subset of OpenAPI 3 used by the generator
+type spec struct {
+	Paths map[string]map[string]operation `yaml:"paths"`
+}
+
+type operation struct {
+	OperationID string       `yaml:"operationId"`
+	Summary     string       `yaml:"summary"`
+	MinFirmware string       `yaml:"x-min-firmware"`
+	Parameters  []parameter  `yaml:"parameters"`
+	RequestBody *requestBody `yaml:"requestBody"`
+}
+
+type parameter struct {
+	Name     string `yaml:"name"`
+	In       string `yaml:"in"`
+	Required bool   `yaml:"required"`
+	GoName   string `yaml:"x-go-name"`
+	Schema   struct {
+		Type string `yaml:"type"`
+	} `yaml:"schema"`
+}
+
+type requestBody struct {
+	Content map[string]interface{} `yaml:"content"`
+}
+
+// route is an operation with its path and method, ready for code generation
+type route struct {
+	Path   string
+	Method string
+	operation
+}
+
+var methodOrder = map[string]int{"get": 0, "put": 1, "post": 2, "delete": 3}
+
+var pathParam = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+func main() {
+	in := flag.String("in", "openapi.yaml", "OpenAPI spec to read")
+	out := flag.String("out", "endpoints_gen.go", "Go file to write")
+	flag.Parse()
+
+	if err := run(*in, *out); err != nil {
+		fmt.Fprintf(os.Stderr, "apigen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out string) error {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+
+	var s spec
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("parse %s: %w", in, err)
+	}
+
+	var routes []route
+	for path, methods := range s.Paths {
+		for method, op := range methods {
+			if _, ok := methodOrder[method]; !ok {
+				return fmt.Errorf("%s: unsupported method %s", path, method)
+			}
+			if op.OperationID == "" {
+				return fmt.Errorf("%s %s: missing operationId", method, path)
+			}
+			routes = append(routes, route{Path: path, Method: method, operation: op})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return methodOrder[routes[i].Method] < methodOrder[routes[j].Method]
+	})
+
+	src, err := generate(in, routes)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, src, 0644)
+}
+
+func generate(in string, routes []route) ([]byte, error) {
+	var b bytes.Buffer
+	usesStrconv := false
+	usesFmt := false
+	usesIO := false
+
+	var body bytes.Buffer
+	for _, r := range routes {
+		if err := genRoute(&body, r, &usesFmt, &usesStrconv, &usesIO); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Fprintf(&b, "// Code generated by apigen from %s; DO NOT EDIT.\n\n", in)
+	b.WriteString("package api\n\n")
+	b.WriteString("import (\n")
+	if usesFmt {
+		b.WriteString("\t\"fmt\"\n")
+	}
+	if usesIO {
+		b.WriteString("\t\"io\"\n")
+	}
+	if usesStrconv {
+		b.WriteString("\t\"strconv\"\n")
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString("// Endpoints exposes one method per REST API operation, with typed\n")
+	b.WriteString("// parameters. The hand-written Client methods build on these.\n")
+	b.WriteString("type Endpoints struct {\n\tc *Client\n}\n\n")
+	b.WriteString("// Endpoints returns the low-level API bindings\n")
+	b.WriteString("func (c *Client) Endpoints() Endpoints {\n\treturn Endpoints{c: c}\n}\n\n")
+
+	b.WriteString("// routes lists every operation with its minimum firmware version\n")
+	b.WriteString("var routes = []route{\n")
+	for _, r := range routes {
+		fmt.Fprintf(&b, "\t{%q, %q, %q},\n", strings.ToUpper(r.Method), r.Path, r.MinFirmware)
+	}
+	b.WriteString("}\n\n")
+
+	b.Write(body.Bytes())
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, b.String())
+	}
+	return src, nil
+}
+
+func genRoute(b *bytes.Buffer, r route, usesFmt, usesStrconv, usesIO *bool) error {
+	var pathParams, queryParams []parameter
+	for _, p := range r.Parameters {
+		switch p.In {
+		case "path":
+			pathParams = append(pathParams, p)
+		case "query":
+			queryParams = append(queryParams, p)
+		default:
+			return fmt.Errorf("%s: unsupported parameter location %s", r.OperationID, p.In)
+		}
+	}
+
+	paramsType := r.OperationID + "Params"
+	if len(queryParams) > 0 {
+		fmt.Fprintf(b, "// %s are the query parameters of %s\n", paramsType, r.OperationID)
+		fmt.Fprintf(b, "type %s struct {\n", paramsType)
+		for _, p := range queryParams {
+			comment := ""
+			if p.Required {
+				comment = " // required"
+			}
+			fmt.Fprintf(b, "\t%s %s%s\n", goName(p), goType(p), comment)
+		}
+		b.WriteString("}\n\n")
+	}
+
+	// Signature: path parameters, body, query parameters
+	var args []string
+	for _, p := range pathParams {
+		args = append(args, lowerName(p.Name)+" string")
+	}
+	jsonBody := r.RequestBody != nil && r.RequestBody.Content["application/json"] != nil
+	switch {
+	case jsonBody:
+		args = append(args, "data interface{}")
+	case r.RequestBody != nil:
+		args = append(args, "body io.Reader")
+		*usesIO = true
+	}
+	if len(queryParams) > 0 {
+		args = append(args, "p "+paramsType)
+	}
+
+	summary := r.Summary
+	if summary != "" {
+		summary = strings.ToLower(summary[:1]) + summary[1:]
+	}
+	fmt.Fprintf(b, "// %s %s (%s %s)\n", r.OperationID, summary, strings.ToUpper(r.Method), r.Path)
+	fmt.Fprintf(b, "func (e Endpoints) %s(%s) (*Response, error) {\n", r.OperationID, strings.Join(args, ", "))
+
+	params := "nil"
+	if len(queryParams) > 0 {
+		params = "params"
+		b.WriteString("\tparams := make(map[string]string)\n")
+		for _, p := range queryParams {
+			field := "p." + goName(p)
+			value := field
+			if goType(p) == "int" {
+				value = "strconv.Itoa(" + field + ")"
+				*usesStrconv = true
+			}
+			switch {
+			case p.Required:
+				fmt.Fprintf(b, "\tparams[%q] = %s\n", p.Name, value)
+			case goType(p) == "int":
+				fmt.Fprintf(b, "\tif %s > 0 {\n\t\tparams[%q] = %s\n\t}\n", field, p.Name, value)
+			default:
+				fmt.Fprintf(b, "\tif %s != \"\" {\n\t\tparams[%q] = %s\n\t}\n", field, p.Name, value)
+			}
+		}
+	}
+
+	endpoint := fmt.Sprintf("%q", r.Path)
+	if len(pathParams) > 0 {
+		format := pathParam.ReplaceAllString(r.Path, "%s")
+		var names []string
+		for _, m := range pathParam.FindAllStringSubmatch(r.Path, -1) {
+			names = append(names, lowerName(m[1]))
+		}
+		endpoint = fmt.Sprintf("fmt.Sprintf(%q, %s)", format, strings.Join(names, ", "))
+		*usesFmt = true
+	}
+
+	switch r.Method {
+	case "get":
+		fmt.Fprintf(b, "\treturn e.c.Get(%s, %s)\n", endpoint, params)
+	case "put":
+		fmt.Fprintf(b, "\treturn e.c.Put(%s, %s)\n", endpoint, params)
+	case "post":
+		if r.RequestBody == nil {
+			return fmt.Errorf("%s: POST without requestBody is not supported", r.OperationID)
+		}
+		if jsonBody {
+			if len(queryParams) > 0 {
+				return fmt.Errorf("%s: JSON body with query parameters is not supported", r.OperationID)
+			}
+			fmt.Fprintf(b, "\treturn e.c.PostJSON(%s, data)\n", endpoint)
+			break
+		}
+		fmt.Fprintf(b, "\treturn e.c.Post(%s, body, %s)\n", endpoint, params)
+	default:
+		return fmt.Errorf("%s: no client method for %s", r.OperationID, r.Method)
+	}
+	b.WriteString("}\n\n")
+	return nil
+}
+
+// goName returns the Go field name of a parameter
+func goName(p parameter) string {
+	if p.GoName != "" {
+		return p.GoName
+	}
+	var out strings.Builder
+	for _, part := range strings.Split(p.Name, "_") {
+		if part != "" {
+			out.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return out.String()
+}
+
+// lowerName returns a Go argument name for a path parameter
+func lowerName(name string) string {
+	n := goName(parameter{Name: name})
+	return strings.ToLower(n[:1]) + n[1:]
+}
+
+// goType maps an OpenAPI schema type to a Go type
+func goType(p parameter) string {
+	if p.Schema.Type == "integer" {
+		return "int"
+	}
+	return "string"
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BusyError is returned when the device refuses a request because it is
+// busy, e.g. while the Ultimate menu is open or another transfer is active
+type BusyError struct {
+	StatusCode int
+	Message    string
+	// RetryAfter is the delay suggested by the device, if any
+	RetryAfter time.Duration
+}
+
+func (e *BusyError) Error() string {
+	msg := "device is busy (menu open or another transfer active?)"
+	switch {
+	case strings.Contains(strings.ToLower(e.Message), "busy"):
+		msg = e.Message
+	case e.Message != "":
+		msg = fmt.Sprintf("device is busy: %s", e.Message)
+	}
+	return msg + "; retry later or use --wait-busy"
+}
+
+// IsBusy reports whether err is (or wraps) a BusyError
+func IsBusy(err error) bool {
+	var busy *BusyError
+	return errors.As(err, &busy)
+}
+
+// busyError checks a response for the firmware's busy states
+func busyError(resp *http.Response, apiResp *Response) *BusyError {
+	busy := resp.StatusCode == http.StatusServiceUnavailable ||
+		resp.StatusCode == http.StatusLocked ||
+		resp.StatusCode == http.StatusTooManyRequests
+
+	message := ""
+	for _, e := range apiResp.Errors {
+		if strings.Contains(strings.ToLower(e), "busy") {
+			busy = true
+			message = e
+			break
+		}
+	}
+	if !busy {
+		return nil
+	}
+
+	if message == "" && len(apiResp.Errors) > 0 && !strings.HasPrefix(apiResp.Errors[0], "HTTP ") {
+		message = apiResp.Errors[0]
+	}
+
+	be := &BusyError{StatusCode: resp.StatusCode, Message: message}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		be.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return be
+}
+
+// busyBackoff returns the delay before retry attempt n (starting at 1)
+func busyBackoff(n int, be *BusyError) time.Duration {
+	if be.RetryAfter > 0 {
+		return be.RetryAfter
+	}
+	delay := time.Duration(n) * 500 * time.Millisecond
+	if delay > 5*time.Second {
+		delay = 5 * time.Second
+	}
+	return delay
+}
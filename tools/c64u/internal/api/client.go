@@ -1,12 +1,16 @@
 package api
 
+//go:generate go run ./apigen -in openapi.yaml -out endpoints_gen.go
+
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"time"
 )
 
@@ -15,6 +19,57 @@ type Client struct {
 	BaseURL    string
 	HTTPClient *http.Client
 	Verbose    bool
+
+	// Locker serializes state-changing requests with other processes (optional)
+	Locker Locker
+
+	// ReadOnly refuses all state-changing (PUT/POST) requests with ErrReadOnly
+	ReadOnly bool
+
+	// Recorder receives a record of every request sent (optional)
+	Recorder Recorder
+
+	// Compression negotiates gzip/deflate compressed responses
+	Compression bool
+	// CompressUploads gzips compressible request bodies (Content-Encoding: gzip)
+	CompressUploads bool
+
+	// BusyWait is how long to keep retrying while the device reports it is
+	// busy (0 = fail immediately with a BusyError)
+	BusyWait time.Duration
+
+	limiter  *rateLimiter
+	firmware string
+}
+
+// ErrReadOnly is returned for state-changing requests in read-only mode
+var ErrReadOnly = errors.New("read-only mode: state-changing requests are disabled")
+
+// Locker acquires exclusive access to the device before it is modified.
+// Implementations must allow Lock to be called repeatedly once acquired.
+type Locker interface {
+	Lock() error
+}
+
+// RequestRecord describes a completed API request
+type RequestRecord struct {
+	Method        string
+	URL           string
+	StatusCode    int
+	Duration      time.Duration
+	Errors        []string
+	ResponseBytes int
+	// WireBytes is the response size as transferred, before decompression
+	WireBytes int
+	// Body is the response body if it is JSON, nil otherwise
+	Body []byte
+	// Err is set if the request failed before a response was parsed
+	Err error
+}
+
+// Recorder is notified after every request, e.g. to write a transcript
+type Recorder interface {
+	RecordRequest(rec RequestRecord)
 }
 
 // Response represents a standard API response
@@ -23,6 +78,7 @@ type Response struct {
 	Data       map[string]interface{} `json:",inline"`
 	StatusCode int                    `json:"-"`
 	RawBody    []byte                 `json:"-"`
+	WireBytes  int                    `json:"-"`
 }
 
 // NewClient creates a new API client
@@ -34,8 +90,20 @@ func NewClient(host string, port int, verbose bool) *Client {
 		HTTPClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		Verbose: verbose,
+		Verbose:     verbose,
+		Compression: true,
+	}
+}
+
+// SetRateLimit configures request pacing. maxRPS limits the sustained
+// request rate (with bursts of up to burst requests), minInterval enforces
+// a fixed delay between consecutive requests. Zero values disable a limit.
+func (c *Client) SetRateLimit(maxRPS float64, burst int, minInterval time.Duration) {
+	if maxRPS <= 0 && minInterval <= 0 {
+		c.limiter = nil
+		return
 	}
+	c.limiter = newRateLimiter(maxRPS, burst, minInterval)
 }
 
 // Get performs a GET request to the API
@@ -58,13 +126,12 @@ func (c *Client) Get(endpoint string, params map[string]string) (*Response, erro
 		fmt.Printf("→ GET %s\n", reqURL.String())
 	}
 
-	resp, err := c.HTTPClient.Get(reqURL.String())
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	defer resp.Body.Close()
 
-	return c.parseResponse(resp)
+	return c.do(req)
 }
 
 // Put performs a PUT request to the API
@@ -87,18 +154,16 @@ func (c *Client) Put(endpoint string, params map[string]string) (*Response, erro
 		fmt.Printf("→ PUT %s\n", reqURL.String())
 	}
 
-	req, err := http.NewRequest(http.MethodPut, reqURL.String(), nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	if err := c.lock(); err != nil {
+		return nil, err
 	}
 
-	resp, err := c.HTTPClient.Do(req)
+	req, err := http.NewRequest(http.MethodPut, reqURL.String(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	defer resp.Body.Close()
 
-	return c.parseResponse(resp)
+	return c.do(req)
 }
 
 // Post performs a POST request to the API with a body
@@ -121,21 +186,26 @@ func (c *Client) Post(endpoint string, body io.Reader, params map[string]string)
 		fmt.Printf("→ POST %s\n", reqURL.String())
 	}
 
+	if err := c.lock(); err != nil {
+		return nil, err
+	}
+
 	req, err := http.NewRequest(http.MethodPost, reqURL.String(), body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	// The device needs a sized body; net/http only sizes in-memory readers
+	if f, ok := body.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			req.ContentLength = info.Size()
+		}
+	}
+
 	// Set appropriate content type
 	req.Header.Set("Content-Type", "application/octet-stream")
 
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	return c.parseResponse(resp)
+	return c.do(req)
 }
 
 // PostJSON performs a POST request with JSON body
@@ -152,6 +222,10 @@ func (c *Client) PostJSON(endpoint string, data interface{}) (*Response, error)
 		fmt.Printf("  Body: %s\n", string(jsonData))
 	}
 
+	if err := c.lock(); err != nil {
+		return nil, err
+	}
+
 	req, err := http.NewRequest(http.MethodPost, reqURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -159,25 +233,162 @@ func (c *Client) PostJSON(endpoint string, data interface{}) (*Response, error)
 
 	req.Header.Set("Content-Type", "application/json")
 
+	return c.do(req)
+}
+
+// lock prepares a state-changing request: it is refused in read-only mode,
+// otherwise the device lock is acquired if a Locker is configured
+func (c *Client) lock() error {
+	if c.ReadOnly {
+		return ErrReadOnly
+	}
+	if c.Locker == nil {
+		return nil
+	}
+	if err := c.Locker.Lock(); err != nil {
+		return fmt.Errorf("device lock: %w", err)
+	}
+	return nil
+}
+
+// do sends a request and parses the response, retrying while the device
+// is busy if BusyWait is set
+func (c *Client) do(req *http.Request) (*Response, error) {
+	if c.Compression {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	raw, err := c.compressUpload(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Busy retries resend the request, so the body must be replayable
+	if c.BusyWait > 0 && req.Body != nil && req.GetBody == nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		setBody(req, data)
+	}
+
+	deadline := time.Now().Add(c.BusyWait)
+	for attempt := 1; ; attempt++ {
+		apiResp, err := c.send(req, raw)
+
+		var busy *BusyError
+		if !errors.As(err, &busy) || c.BusyWait <= 0 {
+			return apiResp, err
+		}
+
+		delay := busyBackoff(attempt, busy)
+		if time.Now().Add(delay).After(deadline) {
+			return apiResp, err
+		}
+		if c.Verbose {
+			fmt.Printf("  Device busy, retrying in %s\n", delay)
+		}
+		time.Sleep(delay)
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			req.Body = body
+		}
+	}
+}
+
+// send performs a single request. raw is the uncompressed body of a
+// compressed upload, used to resend it if the device rejects compression.
+func (c *Client) send(req *http.Request, raw []byte) (*Response, error) {
+	c.pace()
+
+	start := time.Now()
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
+		c.record(req, nil, start, err)
 		return nil, fmt.Errorf("HTTP request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	return c.parseResponse(resp)
+	// The device rejected the compressed upload, send it again as-is
+	if raw != nil && resp.StatusCode == http.StatusUnsupportedMediaType {
+		resp.Body.Close()
+		if c.Verbose {
+			fmt.Printf("← %d %s, resending uncompressed\n", resp.StatusCode, resp.Status)
+		}
+		req.Header.Del("Content-Encoding")
+		setBody(req, raw)
+		c.CompressUploads = false
+		return c.send(req, nil)
+	}
+
+	apiResp, err := c.parseResponse(resp)
+	c.record(req, apiResp, start, err)
+	if err == nil {
+		if busy := busyError(resp, apiResp); busy != nil {
+			return apiResp, busy
+		}
+		if unsupported := c.unsupportedError(req, resp, apiResp); unsupported != nil {
+			return apiResp, unsupported
+		}
+	}
+	return apiResp, err
+}
+
+// record passes a completed request to the Recorder, if one is configured
+func (c *Client) record(req *http.Request, resp *Response, start time.Time, err error) {
+	if c.Recorder == nil {
+		return
+	}
+
+	rec := RequestRecord{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if resp != nil {
+		rec.StatusCode = resp.StatusCode
+		rec.Errors = resp.Errors
+		rec.ResponseBytes = len(resp.RawBody)
+		rec.WireBytes = resp.WireBytes
+		if json.Valid(resp.RawBody) {
+			rec.Body = resp.RawBody
+		}
+	}
+	c.Recorder.RecordRequest(rec)
+}
+
+// pace waits for the rate limiter, if one is configured
+func (c *Client) pace() {
+	if c.limiter != nil {
+		c.limiter.Wait()
+	}
 }
 
 // parseResponse parses the HTTP response and extracts error information
 func (c *Client) parseResponse(resp *http.Response) (*Response, error) {
 	// Read the entire response body
-	body, err := io.ReadAll(resp.Body)
+	wire, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
+	encoding := resp.Header.Get("Content-Encoding")
+	body, err := decodeBody(encoding, wire)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s response body: %w", encoding, err)
+	}
+
 	if c.Verbose {
 		fmt.Printf("← %d %s\n", resp.StatusCode, resp.Status)
+		if encoding != "" && encoding != "identity" {
+			fmt.Printf("  Encoding: %s %d → %d bytes (%.1f%%)\n", encoding, len(wire), len(body), ratio(len(wire), len(body)))
+		}
 		if len(body) > 0 {
 			fmt.Printf("  Response: %s\n", string(body))
 		}
@@ -186,6 +397,7 @@ func (c *Client) parseResponse(resp *http.Response) (*Response, error) {
 	apiResp := &Response{
 		StatusCode: resp.StatusCode,
 		RawBody:    body,
+		WireBytes:  len(wire),
 		Data:       make(map[string]interface{}),
 	}
 
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// acceptEncoding is sent when response compression is enabled. Setting it
+// explicitly disables net/http's transparent gzip handling, so bodies are
+// decoded in decodeBody and both sizes can be reported.
+const acceptEncoding = "gzip, deflate"
+
+// minUploadSavings is the fraction an upload must shrink by to be sent compressed
+const minUploadSavings = 0.1
+
+// decodeBody decompresses a response body according to its Content-Encoding
+func decodeBody(encoding string, body []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		// "deflate" should be zlib-wrapped, but some servers send raw deflate
+		r, err = zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			r, err = io.NopCloser(flate.NewReader(bytes.NewReader(body))), nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content encoding '%s'", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// compressUpload gzips the request body if it is worth it. It returns the
+// original body so the request can be resent uncompressed; nil means the
+// request was left unchanged.
+func (c *Client) compressUpload(req *http.Request) ([]byte, error) {
+	if !c.CompressUploads || req.Body == nil {
+		return nil, nil
+	}
+
+	raw, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(raw)
+	zw.Close()
+
+	if float64(buf.Len()) > float64(len(raw))*(1-minUploadSavings) {
+		setBody(req, raw)
+		return nil, nil
+	}
+
+	if c.Verbose {
+		fmt.Printf("  Upload: gzip %d → %d bytes (%.1f%%)\n", len(raw), buf.Len(), ratio(buf.Len(), len(raw)))
+	}
+
+	setBody(req, buf.Bytes())
+	req.Header.Set("Content-Encoding", "gzip")
+	return raw, nil
+}
+
+// setBody replaces a request body with an in-memory buffer
+func setBody(req *http.Request, data []byte) {
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+}
+
+// ratio returns part as a percentage of whole
+func ratio(part, whole int) float64 {
+	if whole == 0 {
+		return 100
+	}
+	return float64(part) * 100 / float64(whole)
+}
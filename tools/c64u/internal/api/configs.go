@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Configuration API
+
+// ConfigItem is a configuration setting as reported by the device
+type ConfigItem struct {
+	Category string      `json:"category"`
+	Name     string      `json:"name"`
+	Value    interface{} `json:"value"`
+	// Details holds min/max/default/values when the device reports them
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// ConfigCategories lists the configuration categories
+func (c *Client) ConfigCategories() ([]string, error) {
+	resp, err := c.Endpoints().Configs()
+	if err != nil {
+		return nil, err
+	}
+	if resp.HasErrors() {
+		return nil, fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+	}
+
+	raw, _ := resp.Data["categories"].([]interface{})
+	categories := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			categories = append(categories, s)
+		}
+	}
+	return categories, nil
+}
+
+// ConfigGet returns configuration items (category and item accept wildcards)
+func (c *Client) ConfigGet(category, item string) (*Response, error) {
+	return c.Endpoints().ConfigsGet(url.PathEscape(category), url.PathEscape(item))
+}
+
+// ConfigItems returns the items matching category and item, sorted by
+// category and name. Values reported with details ({"current": ...}) are
+// unwrapped into Value and Details.
+func (c *Client) ConfigItems(category, item string) ([]ConfigItem, error) {
+	resp, err := c.ConfigGet(category, item)
+	if err != nil {
+		return nil, err
+	}
+	if resp.HasErrors() {
+		return nil, fmt.Errorf("%s", strings.Join(resp.Errors, "; "))
+	}
+
+	var items []ConfigItem
+	for cat, values := range resp.Data {
+		entries, ok := values.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, value := range entries {
+			ci := ConfigItem{Category: cat, Name: name, Value: value}
+			if details, ok := value.(map[string]interface{}); ok {
+				ci.Value = details["current"]
+				ci.Details = details
+			}
+			items = append(items, ci)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Category != items[j].Category {
+			return items[i].Category < items[j].Category
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
+
+// ConfigSet sets a single configuration item
+func (c *Client) ConfigSet(category, item, value string) (*Response, error) {
+	return c.Endpoints().ConfigsSetItem(url.PathEscape(category), url.PathEscape(item), ConfigsSetItemParams{Value: value})
+}
+
+// ConfigSetMany sets several items at once
+// values: category -> item -> value
+func (c *Client) ConfigSetMany(values map[string]map[string]interface{}) (*Response, error) {
+	return c.Endpoints().ConfigsSet(values)
+}
+
+// ConfigSaveToFlash makes the current configuration persistent
+func (c *Client) ConfigSaveToFlash() (*Response, error) {
+	return c.Endpoints().ConfigsSaveToFlash()
+}
+
+// ConfigLoadFromFlash reverts to the configuration saved in flash
+func (c *Client) ConfigLoadFromFlash() (*Response, error) {
+	return c.Endpoints().ConfigsLoadFromFlash()
+}
+
+// ConfigResetToDefault resets the configuration to factory defaults
+func (c *Client) ConfigResetToDefault() (*Response, error) {
+	return c.Endpoints().ConfigsResetToDefault()
+}
@@ -9,7 +9,7 @@ import (
 
 // DrivesList returns info on all internal drives including mounted images
 func (c *Client) DrivesList() (*Response, error) {
-	return c.Get("/v1/drives", nil)
+	return c.Endpoints().Drives()
 }
 
 // DrivesMount mounts a disk image
@@ -18,20 +18,11 @@ func (c *Client) DrivesList() (*Response, error) {
 // imageType: d64, g64, d71, g71, d81 (optional)
 // mode: readwrite, readonly, unlinked (optional)
 func (c *Client) DrivesMount(drive, image, imageType, mode string) (*Response, error) {
-	params := map[string]string{
-		"image": image,
-	}
-
-	if imageType != "" {
-		params["type"] = imageType
-	}
-
-	if mode != "" {
-		params["mode"] = mode
-	}
-
-	endpoint := fmt.Sprintf("/v1/drives/%s:mount", drive)
-	return c.Put(endpoint, params)
+	return c.Endpoints().DrivesMount(drive, DrivesMountParams{
+		Image: image,
+		Type:  imageType,
+		Mode:  mode,
+	})
 }
 
 // DrivesMountUpload uploads and mounts a disk image
@@ -46,54 +37,37 @@ func (c *Client) DrivesMountUpload(drive, localFile, imageType, mode string) (*R
 	}
 	defer file.Close()
 
-	params := make(map[string]string)
-
-	if imageType != "" {
-		params["type"] = imageType
-	}
-
-	if mode != "" {
-		params["mode"] = mode
-	}
-
-	endpoint := fmt.Sprintf("/v1/drives/%s:mount", drive)
-	return c.Post(endpoint, file, params)
+	return c.Endpoints().DrivesMountUpload(drive, file, DrivesMountUploadParams{
+		Type: imageType,
+		Mode: mode,
+	})
 }
 
 // DrivesReset resets selected drive
 func (c *Client) DrivesReset(drive string) (*Response, error) {
-	endpoint := fmt.Sprintf("/v1/drives/%s:reset", drive)
-	return c.Put(endpoint, nil)
+	return c.Endpoints().DrivesReset(drive)
 }
 
 // DrivesRemove unmounts disk from drive
 func (c *Client) DrivesRemove(drive string) (*Response, error) {
-	endpoint := fmt.Sprintf("/v1/drives/%s:remove", drive)
-	return c.Put(endpoint, nil)
+	return c.Endpoints().DrivesRemove(drive)
 }
 
 // DrivesOn enables selected drive
 func (c *Client) DrivesOn(drive string) (*Response, error) {
-	endpoint := fmt.Sprintf("/v1/drives/%s:on", drive)
-	return c.Put(endpoint, nil)
+	return c.Endpoints().DrivesOn(drive)
 }
 
 // DrivesOff disables selected drive
 func (c *Client) DrivesOff(drive string) (*Response, error) {
-	endpoint := fmt.Sprintf("/v1/drives/%s:off", drive)
-	return c.Put(endpoint, nil)
+	return c.Endpoints().DrivesOff(drive)
 }
 
 // DrivesLoadROM loads custom ROM (16K/32K) temporarily
 // drive: drive number (e.g., "8", "9")
 // file: path to ROM file on C64U filesystem
 func (c *Client) DrivesLoadROM(drive, file string) (*Response, error) {
-	params := map[string]string{
-		"file": file,
-	}
-
-	endpoint := fmt.Sprintf("/v1/drives/%s:load_rom", drive)
-	return c.Put(endpoint, params)
+	return c.Endpoints().DrivesLoadRom(drive, DrivesLoadRomParams{File: file})
 }
 
 // DrivesLoadROMUpload uploads and loads custom ROM
@@ -106,18 +80,12 @@ func (c *Client) DrivesLoadROMUpload(drive, localFile string) (*Response, error)
 	}
 	defer file.Close()
 
-	endpoint := fmt.Sprintf("/v1/drives/%s:load_rom", drive)
-	return c.Post(endpoint, file, nil)
+	return c.Endpoints().DrivesLoadRomUpload(drive, file)
 }
 
 // DrivesSetMode changes drive mode
 // drive: drive number (e.g., "8", "9")
 // mode: 1541, 1571, or 1581
 func (c *Client) DrivesSetMode(drive, mode string) (*Response, error) {
-	params := map[string]string{
-		"mode": mode,
-	}
-
-	endpoint := fmt.Sprintf("/v1/drives/%s:set_mode", drive)
-	return c.Put(endpoint, params)
+	return c.Endpoints().DrivesSetMode(drive, DrivesSetModeParams{Mode: mode})
 }
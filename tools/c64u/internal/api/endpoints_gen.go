@@ -0,0 +1,486 @@
+// Code generated by apigen from openapi.yaml; DO NOT EDIT.
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Endpoints exposes one method per REST API operation, with typed
+// parameters. The hand-written Client methods build on these.
+type Endpoints struct {
+	c *Client
+}
+
+// Endpoints returns the low-level API bindings
+func (c *Client) Endpoints() Endpoints {
+	return Endpoints{c: c}
+}
+
+// routes lists every operation with its minimum firmware version
+var routes = []route{
+	{"GET", "/v1/configs", "3.11"},
+	{"POST", "/v1/configs", "3.11"},
+	{"GET", "/v1/configs/{category}/{item}", "3.11"},
+	{"PUT", "/v1/configs/{category}/{item}", "3.11"},
+	{"PUT", "/v1/configs:load_from_flash", "3.11"},
+	{"PUT", "/v1/configs:reset_to_default", "3.11"},
+	{"PUT", "/v1/configs:save_to_flash", "3.11"},
+	{"GET", "/v1/drives", "3.11"},
+	{"PUT", "/v1/drives/{drive}:load_rom", "3.11"},
+	{"POST", "/v1/drives/{drive}:load_rom", "3.11"},
+	{"PUT", "/v1/drives/{drive}:mount", "3.11"},
+	{"POST", "/v1/drives/{drive}:mount", "3.11"},
+	{"PUT", "/v1/drives/{drive}:off", "3.11"},
+	{"PUT", "/v1/drives/{drive}:on", "3.11"},
+	{"PUT", "/v1/drives/{drive}:remove", "3.11"},
+	{"PUT", "/v1/drives/{drive}:reset", "3.11"},
+	{"PUT", "/v1/drives/{drive}:set_mode", "3.11"},
+	{"PUT", "/v1/files/{path}:create_d64", "3.12"},
+	{"PUT", "/v1/files/{path}:create_d71", "3.12"},
+	{"PUT", "/v1/files/{path}:create_d81", "3.12"},
+	{"PUT", "/v1/files/{path}:create_dnp", "3.12"},
+	{"GET", "/v1/files/{path}:info", "3.12"},
+	{"GET", "/v1/info", "3.12"},
+	{"GET", "/v1/machine:debugreg", "3.12"},
+	{"PUT", "/v1/machine:debugreg", "3.12"},
+	{"PUT", "/v1/machine:menu_button", "3.12"},
+	{"PUT", "/v1/machine:pause", "3.11"},
+	{"PUT", "/v1/machine:poweroff", "3.11"},
+	{"GET", "/v1/machine:readmem", "3.11"},
+	{"PUT", "/v1/machine:reboot", "3.11"},
+	{"PUT", "/v1/machine:reset", "3.11"},
+	{"PUT", "/v1/machine:resume", "3.11"},
+	{"PUT", "/v1/machine:writemem", "3.11"},
+	{"POST", "/v1/machine:writemem", "3.11"},
+	{"PUT", "/v1/runners:load_prg", "3.11"},
+	{"POST", "/v1/runners:load_prg", "3.11"},
+	{"PUT", "/v1/runners:modplay", "3.11"},
+	{"POST", "/v1/runners:modplay", "3.11"},
+	{"PUT", "/v1/runners:run_crt", "3.11"},
+	{"POST", "/v1/runners:run_crt", "3.11"},
+	{"PUT", "/v1/runners:run_prg", "3.11"},
+	{"POST", "/v1/runners:run_prg", "3.11"},
+	{"PUT", "/v1/runners:sidplay", "3.11"},
+	{"POST", "/v1/runners:sidplay", "3.11"},
+	{"PUT", "/v1/streams/{stream}:start", "3.12"},
+	{"PUT", "/v1/streams/{stream}:stop", "3.12"},
+	{"GET", "/v1/version", "3.11"},
+}
+
+// Configs lists the configuration categories (GET /v1/configs)
+func (e Endpoints) Configs() (*Response, error) {
+	return e.c.Get("/v1/configs", nil)
+}
+
+// ConfigsSet sets several configuration items at once (POST /v1/configs)
+func (e Endpoints) ConfigsSet(data interface{}) (*Response, error) {
+	return e.c.PostJSON("/v1/configs", data)
+}
+
+// ConfigsGet returns configuration items; category and item accept wildcards (GET /v1/configs/{category}/{item})
+func (e Endpoints) ConfigsGet(category string, item string) (*Response, error) {
+	return e.c.Get(fmt.Sprintf("/v1/configs/%s/%s", category, item), nil)
+}
+
+// ConfigsSetItemParams are the query parameters of ConfigsSetItem
+type ConfigsSetItemParams struct {
+	Value string // required
+}
+
+// ConfigsSetItem sets a single configuration item (PUT /v1/configs/{category}/{item})
+func (e Endpoints) ConfigsSetItem(category string, item string, p ConfigsSetItemParams) (*Response, error) {
+	params := make(map[string]string)
+	params["value"] = p.Value
+	return e.c.Put(fmt.Sprintf("/v1/configs/%s/%s", category, item), params)
+}
+
+// ConfigsLoadFromFlash restores the configuration saved in flash (PUT /v1/configs:load_from_flash)
+func (e Endpoints) ConfigsLoadFromFlash() (*Response, error) {
+	return e.c.Put("/v1/configs:load_from_flash", nil)
+}
+
+// ConfigsResetToDefault resets the current configuration to factory defaults (PUT /v1/configs:reset_to_default)
+func (e Endpoints) ConfigsResetToDefault() (*Response, error) {
+	return e.c.Put("/v1/configs:reset_to_default", nil)
+}
+
+// ConfigsSaveToFlash saves the current configuration to flash (PUT /v1/configs:save_to_flash)
+func (e Endpoints) ConfigsSaveToFlash() (*Response, error) {
+	return e.c.Put("/v1/configs:save_to_flash", nil)
+}
+
+// Drives returns all internal drives and their mounted images (GET /v1/drives)
+func (e Endpoints) Drives() (*Response, error) {
+	return e.c.Get("/v1/drives", nil)
+}
+
+// DrivesLoadRomParams are the query parameters of DrivesLoadRom
+type DrivesLoadRomParams struct {
+	File string // required
+}
+
+// DrivesLoadRom temporarily loads a 16K/32K drive ROM from the Ultimate filesystem (PUT /v1/drives/{drive}:load_rom)
+func (e Endpoints) DrivesLoadRom(drive string, p DrivesLoadRomParams) (*Response, error) {
+	params := make(map[string]string)
+	params["file"] = p.File
+	return e.c.Put(fmt.Sprintf("/v1/drives/%s:load_rom", drive), params)
+}
+
+// DrivesLoadRomUpload temporarily loads an uploaded drive ROM (POST /v1/drives/{drive}:load_rom)
+func (e Endpoints) DrivesLoadRomUpload(drive string, body io.Reader) (*Response, error) {
+	return e.c.Post(fmt.Sprintf("/v1/drives/%s:load_rom", drive), body, nil)
+}
+
+// DrivesMountParams are the query parameters of DrivesMount
+type DrivesMountParams struct {
+	Image string // required
+	Type  string
+	Mode  string
+}
+
+// DrivesMount mounts a disk image from the Ultimate filesystem (PUT /v1/drives/{drive}:mount)
+func (e Endpoints) DrivesMount(drive string, p DrivesMountParams) (*Response, error) {
+	params := make(map[string]string)
+	params["image"] = p.Image
+	if p.Type != "" {
+		params["type"] = p.Type
+	}
+	if p.Mode != "" {
+		params["mode"] = p.Mode
+	}
+	return e.c.Put(fmt.Sprintf("/v1/drives/%s:mount", drive), params)
+}
+
+// DrivesMountUploadParams are the query parameters of DrivesMountUpload
+type DrivesMountUploadParams struct {
+	Type string
+	Mode string
+}
+
+// DrivesMountUpload mounts an uploaded disk image (POST /v1/drives/{drive}:mount)
+func (e Endpoints) DrivesMountUpload(drive string, body io.Reader, p DrivesMountUploadParams) (*Response, error) {
+	params := make(map[string]string)
+	if p.Type != "" {
+		params["type"] = p.Type
+	}
+	if p.Mode != "" {
+		params["mode"] = p.Mode
+	}
+	return e.c.Post(fmt.Sprintf("/v1/drives/%s:mount", drive), body, params)
+}
+
+// DrivesOff disables the drive (PUT /v1/drives/{drive}:off)
+func (e Endpoints) DrivesOff(drive string) (*Response, error) {
+	return e.c.Put(fmt.Sprintf("/v1/drives/%s:off", drive), nil)
+}
+
+// DrivesOn enables the drive (PUT /v1/drives/{drive}:on)
+func (e Endpoints) DrivesOn(drive string) (*Response, error) {
+	return e.c.Put(fmt.Sprintf("/v1/drives/%s:on", drive), nil)
+}
+
+// DrivesRemove removes the mounted disk image (PUT /v1/drives/{drive}:remove)
+func (e Endpoints) DrivesRemove(drive string) (*Response, error) {
+	return e.c.Put(fmt.Sprintf("/v1/drives/%s:remove", drive), nil)
+}
+
+// DrivesReset resets the drive (PUT /v1/drives/{drive}:reset)
+func (e Endpoints) DrivesReset(drive string) (*Response, error) {
+	return e.c.Put(fmt.Sprintf("/v1/drives/%s:reset", drive), nil)
+}
+
+// DrivesSetModeParams are the query parameters of DrivesSetMode
+type DrivesSetModeParams struct {
+	Mode string // required
+}
+
+// DrivesSetMode changes the drive type (PUT /v1/drives/{drive}:set_mode)
+func (e Endpoints) DrivesSetMode(drive string, p DrivesSetModeParams) (*Response, error) {
+	params := make(map[string]string)
+	params["mode"] = p.Mode
+	return e.c.Put(fmt.Sprintf("/v1/drives/%s:set_mode", drive), params)
+}
+
+// FilesCreateD64Params are the query parameters of FilesCreateD64
+type FilesCreateD64Params struct {
+	Tracks   int
+	DiskName string
+}
+
+// FilesCreateD64 creates a D64 disk image (PUT /v1/files/{path}:create_d64)
+func (e Endpoints) FilesCreateD64(path string, p FilesCreateD64Params) (*Response, error) {
+	params := make(map[string]string)
+	if p.Tracks > 0 {
+		params["tracks"] = strconv.Itoa(p.Tracks)
+	}
+	if p.DiskName != "" {
+		params["diskname"] = p.DiskName
+	}
+	return e.c.Put(fmt.Sprintf("/v1/files/%s:create_d64", path), params)
+}
+
+// FilesCreateD71Params are the query parameters of FilesCreateD71
+type FilesCreateD71Params struct {
+	DiskName string
+}
+
+// FilesCreateD71 creates a D71 disk image (PUT /v1/files/{path}:create_d71)
+func (e Endpoints) FilesCreateD71(path string, p FilesCreateD71Params) (*Response, error) {
+	params := make(map[string]string)
+	if p.DiskName != "" {
+		params["diskname"] = p.DiskName
+	}
+	return e.c.Put(fmt.Sprintf("/v1/files/%s:create_d71", path), params)
+}
+
+// FilesCreateD81Params are the query parameters of FilesCreateD81
+type FilesCreateD81Params struct {
+	DiskName string
+}
+
+// FilesCreateD81 creates a D81 disk image (PUT /v1/files/{path}:create_d81)
+func (e Endpoints) FilesCreateD81(path string, p FilesCreateD81Params) (*Response, error) {
+	params := make(map[string]string)
+	if p.DiskName != "" {
+		params["diskname"] = p.DiskName
+	}
+	return e.c.Put(fmt.Sprintf("/v1/files/%s:create_d81", path), params)
+}
+
+// FilesCreateDnpParams are the query parameters of FilesCreateDnp
+type FilesCreateDnpParams struct {
+	Tracks   int // required
+	DiskName string
+}
+
+// FilesCreateDnp creates a DNP disk image (PUT /v1/files/{path}:create_dnp)
+func (e Endpoints) FilesCreateDnp(path string, p FilesCreateDnpParams) (*Response, error) {
+	params := make(map[string]string)
+	params["tracks"] = strconv.Itoa(p.Tracks)
+	if p.DiskName != "" {
+		params["diskname"] = p.DiskName
+	}
+	return e.c.Put(fmt.Sprintf("/v1/files/%s:create_dnp", path), params)
+}
+
+// FilesInfo returns size and extension of files (supports wildcards) (GET /v1/files/{path}:info)
+func (e Endpoints) FilesInfo(path string) (*Response, error) {
+	return e.c.Get(fmt.Sprintf("/v1/files/%s:info", path), nil)
+}
+
+// Info returns product name, firmware versions and hostname (GET /v1/info)
+func (e Endpoints) Info() (*Response, error) {
+	return e.c.Get("/v1/info", nil)
+}
+
+// MachineDebugreg reads debug register $D7FF (U64 only) (GET /v1/machine:debugreg)
+func (e Endpoints) MachineDebugreg() (*Response, error) {
+	return e.c.Get("/v1/machine:debugreg", nil)
+}
+
+// MachineDebugregSetParams are the query parameters of MachineDebugregSet
+type MachineDebugregSetParams struct {
+	Value string // required
+}
+
+// MachineDebugregSet writes debug register $D7FF (U64 only) (PUT /v1/machine:debugreg)
+func (e Endpoints) MachineDebugregSet(p MachineDebugregSetParams) (*Response, error) {
+	params := make(map[string]string)
+	params["value"] = p.Value
+	return e.c.Put("/v1/machine:debugreg", params)
+}
+
+// MachineMenuButton simulates pressing the Menu button (PUT /v1/machine:menu_button)
+func (e Endpoints) MachineMenuButton() (*Response, error) {
+	return e.c.Put("/v1/machine:menu_button", nil)
+}
+
+// MachinePause pauses the machine by pulling the DMA line low (PUT /v1/machine:pause)
+func (e Endpoints) MachinePause() (*Response, error) {
+	return e.c.Put("/v1/machine:pause", nil)
+}
+
+// MachinePoweroff powers off the machine (U64 only) (PUT /v1/machine:poweroff)
+func (e Endpoints) MachinePoweroff() (*Response, error) {
+	return e.c.Put("/v1/machine:poweroff", nil)
+}
+
+// MachineReadmemParams are the query parameters of MachineReadmem
+type MachineReadmemParams struct {
+	Address string // required
+	Length  int
+}
+
+// MachineReadmem reads memory via DMA and returns the binary data (GET /v1/machine:readmem)
+func (e Endpoints) MachineReadmem(p MachineReadmemParams) (*Response, error) {
+	params := make(map[string]string)
+	params["address"] = p.Address
+	if p.Length > 0 {
+		params["length"] = strconv.Itoa(p.Length)
+	}
+	return e.c.Get("/v1/machine:readmem", params)
+}
+
+// MachineReboot restarts the machine with cartridge reinitialization (PUT /v1/machine:reboot)
+func (e Endpoints) MachineReboot() (*Response, error) {
+	return e.c.Put("/v1/machine:reboot", nil)
+}
+
+// MachineReset resets the machine without changing configuration (PUT /v1/machine:reset)
+func (e Endpoints) MachineReset() (*Response, error) {
+	return e.c.Put("/v1/machine:reset", nil)
+}
+
+// MachineResume resumes the machine from the paused state (PUT /v1/machine:resume)
+func (e Endpoints) MachineResume() (*Response, error) {
+	return e.c.Put("/v1/machine:resume", nil)
+}
+
+// MachineWritememParams are the query parameters of MachineWritemem
+type MachineWritememParams struct {
+	Address string // required
+	Data    string // required
+}
+
+// MachineWritemem writes up to 128 hex encoded bytes via DMA (PUT /v1/machine:writemem)
+func (e Endpoints) MachineWritemem(p MachineWritememParams) (*Response, error) {
+	params := make(map[string]string)
+	params["address"] = p.Address
+	params["data"] = p.Data
+	return e.c.Put("/v1/machine:writemem", params)
+}
+
+// MachineWritememUploadParams are the query parameters of MachineWritememUpload
+type MachineWritememUploadParams struct {
+	Address string // required
+}
+
+// MachineWritememUpload writes the request body to memory via DMA (POST /v1/machine:writemem)
+func (e Endpoints) MachineWritememUpload(body io.Reader, p MachineWritememUploadParams) (*Response, error) {
+	params := make(map[string]string)
+	params["address"] = p.Address
+	return e.c.Post("/v1/machine:writemem", body, params)
+}
+
+// RunnersLoadPrgParams are the query parameters of RunnersLoadPrg
+type RunnersLoadPrgParams struct {
+	File string // required
+}
+
+// RunnersLoadPrg loads a program into memory via DMA without running it (PUT /v1/runners:load_prg)
+func (e Endpoints) RunnersLoadPrg(p RunnersLoadPrgParams) (*Response, error) {
+	params := make(map[string]string)
+	params["file"] = p.File
+	return e.c.Put("/v1/runners:load_prg", params)
+}
+
+// RunnersLoadPrgUpload loads an uploaded program into memory via DMA without running it (POST /v1/runners:load_prg)
+func (e Endpoints) RunnersLoadPrgUpload(body io.Reader) (*Response, error) {
+	return e.c.Post("/v1/runners:load_prg", body, nil)
+}
+
+// RunnersModplayParams are the query parameters of RunnersModplay
+type RunnersModplayParams struct {
+	File string // required
+}
+
+// RunnersModplay plays a MOD file from the Ultimate filesystem (PUT /v1/runners:modplay)
+func (e Endpoints) RunnersModplay(p RunnersModplayParams) (*Response, error) {
+	params := make(map[string]string)
+	params["file"] = p.File
+	return e.c.Put("/v1/runners:modplay", params)
+}
+
+// RunnersModplayUpload plays an uploaded MOD file (POST /v1/runners:modplay)
+func (e Endpoints) RunnersModplayUpload(body io.Reader) (*Response, error) {
+	return e.c.Post("/v1/runners:modplay", body, nil)
+}
+
+// RunnersRunCrtParams are the query parameters of RunnersRunCrt
+type RunnersRunCrtParams struct {
+	File string // required
+}
+
+// RunnersRunCrt starts a cartridge file with reset (PUT /v1/runners:run_crt)
+func (e Endpoints) RunnersRunCrt(p RunnersRunCrtParams) (*Response, error) {
+	params := make(map[string]string)
+	params["file"] = p.File
+	return e.c.Put("/v1/runners:run_crt", params)
+}
+
+// RunnersRunCrtUpload starts an uploaded cartridge file with reset (POST /v1/runners:run_crt)
+func (e Endpoints) RunnersRunCrtUpload(body io.Reader) (*Response, error) {
+	return e.c.Post("/v1/runners:run_crt", body, nil)
+}
+
+// RunnersRunPrgParams are the query parameters of RunnersRunPrg
+type RunnersRunPrgParams struct {
+	File string // required
+}
+
+// RunnersRunPrg loads and runs a program (PUT /v1/runners:run_prg)
+func (e Endpoints) RunnersRunPrg(p RunnersRunPrgParams) (*Response, error) {
+	params := make(map[string]string)
+	params["file"] = p.File
+	return e.c.Put("/v1/runners:run_prg", params)
+}
+
+// RunnersRunPrgUpload loads and runs an uploaded program (POST /v1/runners:run_prg)
+func (e Endpoints) RunnersRunPrgUpload(body io.Reader) (*Response, error) {
+	return e.c.Post("/v1/runners:run_prg", body, nil)
+}
+
+// RunnersSidplayParams are the query parameters of RunnersSidplay
+type RunnersSidplayParams struct {
+	File   string // required
+	SongNr int
+}
+
+// RunnersSidplay plays a SID file from the Ultimate filesystem (PUT /v1/runners:sidplay)
+func (e Endpoints) RunnersSidplay(p RunnersSidplayParams) (*Response, error) {
+	params := make(map[string]string)
+	params["file"] = p.File
+	if p.SongNr > 0 {
+		params["songnr"] = strconv.Itoa(p.SongNr)
+	}
+	return e.c.Put("/v1/runners:sidplay", params)
+}
+
+// RunnersSidplayUploadParams are the query parameters of RunnersSidplayUpload
+type RunnersSidplayUploadParams struct {
+	SongNr int
+}
+
+// RunnersSidplayUpload plays an uploaded SID file (POST /v1/runners:sidplay)
+func (e Endpoints) RunnersSidplayUpload(body io.Reader, p RunnersSidplayUploadParams) (*Response, error) {
+	params := make(map[string]string)
+	if p.SongNr > 0 {
+		params["songnr"] = strconv.Itoa(p.SongNr)
+	}
+	return e.c.Post("/v1/runners:sidplay", body, params)
+}
+
+// StreamsStartParams are the query parameters of StreamsStart
+type StreamsStartParams struct {
+	IP string // required
+}
+
+// StreamsStart starts a video, audio or debug stream (PUT /v1/streams/{stream}:start)
+func (e Endpoints) StreamsStart(stream string, p StreamsStartParams) (*Response, error) {
+	params := make(map[string]string)
+	params["ip"] = p.IP
+	return e.c.Put(fmt.Sprintf("/v1/streams/%s:start", stream), params)
+}
+
+// StreamsStop stops a stream (PUT /v1/streams/{stream}:stop)
+func (e Endpoints) StreamsStop(stream string) (*Response, error) {
+	return e.c.Put(fmt.Sprintf("/v1/streams/%s:stop", stream), nil)
+}
+
+// Version returns the REST API version (GET /v1/version)
+func (e Endpoints) Version() (*Response, error) {
+	return e.c.Get("/v1/version", nil)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// route describes an API operation; the routes table is generated from
+// openapi.yaml
+type route struct {
+	Method      string
+	Pattern     string
+	MinFirmware string
+}
+
+var (
+	routePatternsOnce sync.Once
+	routePatterns     []*regexp.Regexp
+)
+
+// UnsupportedError is returned when the device does not know an endpoint,
+// typically because its firmware is older than the endpoint
+type UnsupportedError struct {
+	Method     string
+	Endpoint   string
+	StatusCode int
+	// MinFirmware is the first firmware version with the endpoint ("" if unknown)
+	MinFirmware string
+	// Firmware is the device's firmware version ("" if unknown)
+	Firmware string
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.MinFirmware == "" {
+		return fmt.Sprintf("%s %s is not supported by this device (HTTP %d)", e.Method, e.Endpoint, e.StatusCode)
+	}
+
+	msg := fmt.Sprintf("%s requires firmware >= %s", e.Endpoint, e.MinFirmware)
+	if e.Firmware != "" {
+		msg += fmt.Sprintf(" (device runs %s)", e.Firmware)
+	}
+	return msg + "; please update the Ultimate firmware"
+}
+
+// MinFirmware returns the minimum firmware version for a request, or ""
+// if the operation is unknown. Path parameters match any text.
+func MinFirmware(method, endpoint string) string {
+	routePatternsOnce.Do(func() {
+		for _, r := range routes {
+			pattern := regexp.QuoteMeta(r.Pattern)
+			pattern = regexp.MustCompile(`\\\{[a-z_]+\\\}`).ReplaceAllString(pattern, ".+")
+			routePatterns = append(routePatterns, regexp.MustCompile("^"+pattern+"$"))
+		}
+	})
+
+	for i, r := range routes {
+		if r.Method == method && routePatterns[i].MatchString(endpoint) {
+			return r.MinFirmware
+		}
+	}
+	return ""
+}
+
+// CompareVersions compares dotted version strings numerically, returning
+// -1, 0 or 1. Non-numeric suffixes (e.g. "3.12a") are ignored.
+func CompareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "V"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "V"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		na, nb := versionPart(pa, i), versionPart(pb, i)
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionPart returns the leading number of parts[i], or 0
+func versionPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	s := parts[i]
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n
+}
+
+// unsupportedError checks whether a 404/405 response means the endpoint
+// itself is unknown to the firmware, rather than e.g. a missing file
+func (c *Client) unsupportedError(req *http.Request, resp *http.Response, apiResp *Response) *UnsupportedError {
+	if resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusMethodNotAllowed {
+		return nil
+	}
+
+	// Errors reported by the API itself mean the endpoint exists
+	for _, e := range apiResp.Errors {
+		if !strings.HasPrefix(e, "HTTP ") {
+			return nil
+		}
+	}
+
+	endpoint := req.URL.Path
+	ue := &UnsupportedError{
+		Method:      req.Method,
+		Endpoint:    endpoint,
+		StatusCode:  resp.StatusCode,
+		MinFirmware: MinFirmware(req.Method, endpoint),
+	}
+	if ue.MinFirmware != "" && !strings.HasPrefix(endpoint, "/v1/info") {
+		ue.Firmware = c.firmwareVersion()
+		if ue.Firmware != "" && CompareVersions(ue.Firmware, ue.MinFirmware) >= 0 {
+			// The firmware should know this endpoint, so don't blame it
+			ue.MinFirmware = ""
+		}
+	}
+	return ue
+}
+
+// firmwareVersion returns the device's firmware version, querying it once
+func (c *Client) firmwareVersion() string {
+	if c.firmware != "" {
+		return c.firmware
+	}
+
+	resp, err := c.GetInfo()
+	if err != nil || resp.HasErrors() {
+		return ""
+	}
+	c.firmware = resp.GetString("firmware_version")
+	return c.firmware
+}
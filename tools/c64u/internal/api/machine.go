@@ -5,46 +5,43 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
-	"strconv"
 )
 
 // Machine Control API - System control and memory operations
 
 // MachineReset sends a reset without changing configuration
 func (c *Client) MachineReset() (*Response, error) {
-	return c.Put("/v1/machine:reset", nil)
+	return c.Endpoints().MachineReset()
 }
 
 // MachineReboot restarts machine with cartridge reinitialization
 func (c *Client) MachineReboot() (*Response, error) {
-	return c.Put("/v1/machine:reboot", nil)
+	return c.Endpoints().MachineReboot()
 }
 
 // MachinePause pauses machine by pulling DMA line low
 func (c *Client) MachinePause() (*Response, error) {
-	return c.Put("/v1/machine:pause", nil)
+	return c.Endpoints().MachinePause()
 }
 
 // MachineResume resumes from paused state
 func (c *Client) MachineResume() (*Response, error) {
-	return c.Put("/v1/machine:resume", nil)
+	return c.Endpoints().MachineResume()
 }
 
 // MachinePowerOff powers off (U64-only)
 func (c *Client) MachinePowerOff() (*Response, error) {
-	return c.Put("/v1/machine:poweroff", nil)
+	return c.Endpoints().MachinePoweroff()
 }
 
 // MachineWriteMem writes up to 128 bytes via DMA to specified hex address
 // address: hex address (e.g., "0400")
 // data: hex data string (e.g., "01020304")
 func (c *Client) MachineWriteMem(address string, data string) (*Response, error) {
-	params := map[string]string{
-		"address": address,
-		"data":    data,
-	}
-
-	return c.Put("/v1/machine:writemem", params)
+	return c.Endpoints().MachineWritemem(MachineWritememParams{
+		Address: address,
+		Data:    data,
+	})
 }
 
 // MachineWriteMemFile writes binary file data to hex address
@@ -57,53 +54,40 @@ func (c *Client) MachineWriteMemFile(address string, filePath string) (*Response
 	}
 	defer file.Close()
 
-	params := map[string]string{
-		"address": address,
-	}
-
-	return c.Post("/v1/machine:writemem", file, params)
+	return c.Endpoints().MachineWritememUpload(file, MachineWritememUploadParams{Address: address})
 }
 
 // MachineReadMem performs DMA read action returning binary data
 // address: hex address (e.g., "0400")
 // length: number of bytes to read (optional, default from API)
 func (c *Client) MachineReadMem(address string, length int) (*Response, error) {
-	params := map[string]string{
-		"address": address,
-	}
-
-	if length > 0 {
-		params["length"] = strconv.Itoa(length)
-	}
-
-	return c.Get("/v1/machine:readmem", params)
+	return c.Endpoints().MachineReadmem(MachineReadmemParams{
+		Address: address,
+		Length:  length,
+	})
 }
 
 // MachineDebugReg reads debug register $D7FF (U64-only)
 func (c *Client) MachineDebugReg() (*Response, error) {
-	return c.Get("/v1/machine:debugreg", nil)
+	return c.Endpoints().MachineDebugreg()
 }
 
 // MachineDebugRegSet writes to debug register $D7FF (U64-only)
 // value: hex value to write
 func (c *Client) MachineDebugRegSet(value string) (*Response, error) {
-	params := map[string]string{
-		"value": value,
-	}
-
-	return c.Put("/v1/machine:debugreg", params)
+	return c.Endpoints().MachineDebugregSet(MachineDebugregSetParams{Value: value})
 }
 
 // MachineMenuButton simulates pressing the Menu button
 // On 1541 Ultimate cartridge, this is the Menu button
 // On Ultimate 64, this is a brief press of the Multi Button
 func (c *Client) MachineMenuButton() (*Response, error) {
-	return c.Put("/v1/machine:menu_button", nil)
+	return c.Endpoints().MachineMenuButton()
 }
 
 // GetInfo returns device information including product name, firmware versions, and hostname
 func (c *Client) GetInfo() (*Response, error) {
-	return c.Get("/v1/info", nil)
+	return c.Endpoints().Info()
 }
 
 // Helper function to convert hex string to bytes
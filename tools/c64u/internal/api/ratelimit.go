@@ -0,0 +1,71 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter paces requests so the Ultimate's embedded web server isn't
+// hammered by rapid polling. It combines a fixed minimum delay between
+// requests with a token bucket that allows short bursts up to maxRPS.
+type rateLimiter struct {
+	mu          sync.Mutex
+	minInterval time.Duration
+	maxRPS      float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	lastRefill  time.Time
+}
+
+// newRateLimiter creates a limiter. maxRPS <= 0 disables the token bucket,
+// minInterval <= 0 disables the fixed delay.
+func newRateLimiter(maxRPS float64, burst int, minInterval time.Duration) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		minInterval: minInterval,
+		maxRPS:      maxRPS,
+		burst:       float64(burst),
+		tokens:      float64(burst),
+	}
+}
+
+// Wait blocks until the next request may be sent
+func (r *rateLimiter) Wait() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+
+	// Minimum inter-request delay
+	if r.minInterval > 0 && !r.last.IsZero() {
+		if next := r.last.Add(r.minInterval); now.Before(next) {
+			time.Sleep(next.Sub(now))
+			now = next
+		}
+	}
+
+	// Token bucket
+	if r.maxRPS > 0 {
+		if !r.lastRefill.IsZero() {
+			r.tokens += now.Sub(r.lastRefill).Seconds() * r.maxRPS
+			if r.tokens > r.burst {
+				r.tokens = r.burst
+			}
+		}
+		r.lastRefill = now
+
+		if r.tokens < 1 {
+			delay := time.Duration((1 - r.tokens) / r.maxRPS * float64(time.Second))
+			time.Sleep(delay)
+			now = now.Add(delay)
+			r.lastRefill = now
+			r.tokens = 1
+		}
+		r.tokens--
+	}
+
+	r.last = now
+}
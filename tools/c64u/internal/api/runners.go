@@ -4,21 +4,16 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strconv"
 )
 
 // Runners API - Media playback and program execution
 
 // SidPlay plays a SID file from the C64U filesystem
 func (c *Client) SidPlay(file string, songNr int) (*Response, error) {
-	params := map[string]string{
-		"file": file,
-	}
-	if songNr > 0 {
-		params["songnr"] = strconv.Itoa(songNr)
-	}
-
-	return c.Put("/v1/runners:sidplay", params)
+	return c.Endpoints().RunnersSidplay(RunnersSidplayParams{
+		File:   file,
+		SongNr: songNr,
+	})
 }
 
 // SidPlayUpload uploads and plays a SID file
@@ -29,21 +24,12 @@ func (c *Client) SidPlayUpload(localFile string, songNr int) (*Response, error)
 	}
 	defer file.Close()
 
-	params := make(map[string]string)
-	if songNr > 0 {
-		params["songnr"] = strconv.Itoa(songNr)
-	}
-
-	return c.Post("/v1/runners:sidplay", file, params)
+	return c.Endpoints().RunnersSidplayUpload(file, RunnersSidplayUploadParams{SongNr: songNr})
 }
 
 // ModPlay plays a MOD file from the C64U filesystem
 func (c *Client) ModPlay(file string) (*Response, error) {
-	params := map[string]string{
-		"file": file,
-	}
-
-	return c.Put("/v1/runners:modplay", params)
+	return c.Endpoints().RunnersModplay(RunnersModplayParams{File: file})
 }
 
 // ModPlayUpload uploads and plays a MOD file
@@ -54,16 +40,12 @@ func (c *Client) ModPlayUpload(localFile string) (*Response, error) {
 	}
 	defer file.Close()
 
-	return c.Post("/v1/runners:modplay", file, nil)
+	return c.Endpoints().RunnersModplayUpload(file)
 }
 
 // LoadPRG loads a program into memory via DMA (without execution)
 func (c *Client) LoadPRG(file string) (*Response, error) {
-	params := map[string]string{
-		"file": file,
-	}
-
-	return c.Put("/v1/runners:load_prg", params)
+	return c.Endpoints().RunnersLoadPrg(RunnersLoadPrgParams{File: file})
 }
 
 // LoadPRGUpload uploads and loads a program via DMA (without execution)
@@ -74,16 +56,12 @@ func (c *Client) LoadPRGUpload(localFile string) (*Response, error) {
 	}
 	defer file.Close()
 
-	return c.Post("/v1/runners:load_prg", file, nil)
+	return c.Endpoints().RunnersLoadPrgUpload(file)
 }
 
 // RunPRG loads and automatically executes a program
 func (c *Client) RunPRG(file string) (*Response, error) {
-	params := map[string]string{
-		"file": file,
-	}
-
-	return c.Put("/v1/runners:run_prg", params)
+	return c.Endpoints().RunnersRunPrg(RunnersRunPrgParams{File: file})
 }
 
 // RunPRGUpload uploads, loads and executes a program
@@ -94,16 +72,12 @@ func (c *Client) RunPRGUpload(localFile string) (*Response, error) {
 	}
 	defer file.Close()
 
-	return c.Post("/v1/runners:run_prg", file, nil)
+	return c.Endpoints().RunnersRunPrgUpload(file)
 }
 
 // RunCRT starts a cartridge file with reset
 func (c *Client) RunCRT(file string) (*Response, error) {
-	params := map[string]string{
-		"file": file,
-	}
-
-	return c.Put("/v1/runners:run_crt", params)
+	return c.Endpoints().RunnersRunCrt(RunnersRunCrtParams{File: file})
 }
 
 // RunCRTUpload uploads and starts a cartridge file
@@ -114,7 +88,7 @@ func (c *Client) RunCRTUpload(localFile string) (*Response, error) {
 	}
 	defer file.Close()
 
-	return c.Post("/v1/runners:run_crt", file, nil)
+	return c.Endpoints().RunnersRunCrtUpload(file)
 }
 
 // Helper function to read file into reader
@@ -0,0 +1,259 @@
+package archive
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/cbmarc"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+)
+
+// Entry is a file inside an archive
+type Entry struct {
+	Name string
+	Size int64
+}
+
+// IsArchive reports whether a file name has a supported archive extension
+func IsArchive(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".zip", ".gz":
+		return true
+	}
+	return cbmarc.IsArchiveName(name)
+}
+
+// List returns the files in a .zip archive, the single file of a .gz
+// file (named after the gzip header, or the file name without .gz), or
+// the files of a Lynx, ARK or LBR archive (named as by diskimage.HostName,
+// e.g. "game.prg")
+func List(file string) ([]Entry, error) {
+	if cbmarc.IsArchiveName(file) {
+		files, err := readCBM(file)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]Entry, len(files))
+		for i, f := range files {
+			entries[i] = Entry{Name: cbmName(f), Size: int64(len(f.Data))}
+		}
+		return entries, nil
+	}
+	if strings.EqualFold(filepath.Ext(file), ".gz") {
+		name, err := gzipName(file)
+		if err != nil {
+			return nil, err
+		}
+		return []Entry{{Name: name, Size: -1}}, nil
+	}
+
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filepath.Base(file), err)
+	}
+	defer r.Close()
+
+	var entries []Entry
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || isJunk(f.Name) {
+			continue
+		}
+		entries = append(entries, Entry{Name: f.Name, Size: int64(f.UncompressedSize64)})
+	}
+	return entries, nil
+}
+
+// Extract writes the named entry of an archive to dest
+func Extract(file, name, dest string) error {
+	if cbmarc.IsArchiveName(file) {
+		files, err := readCBM(file)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if cbmName(f) == name {
+				return os.WriteFile(dest, f.Data, 0644)
+			}
+		}
+		return fmt.Errorf("%s not found in %s", name, filepath.Base(file))
+	}
+
+	var src io.ReadCloser
+	if strings.EqualFold(filepath.Ext(file), ".gz") {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+		}
+		src = gz
+	} else {
+		r, err := zip.OpenReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", filepath.Base(file), err)
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if f.Name == name {
+				if src, err = f.Open(); err != nil {
+					return fmt.Errorf("failed to read %s: %w", name, err)
+				}
+				break
+			}
+		}
+		if src == nil {
+			return fmt.Errorf("%s not found in %s", name, filepath.Base(file))
+		}
+	}
+	defer src.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	return out.Close()
+}
+
+// Select picks the entry to use from an archive: entries are filtered by
+// extension (if exts is not empty), and pattern, if given, must match
+// exactly one of them by full name, base name or glob. Without a pattern,
+// exactly one entry must remain.
+func Select(entries []Entry, exts []string, pattern string) (Entry, error) {
+	var candidates []Entry
+	for _, e := range entries {
+		if matchesExt(e.Name, exts) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		return Entry{}, fmt.Errorf("the archive contains no %s file", strings.Join(exts, "/"))
+	}
+
+	if pattern != "" {
+		var matches []Entry
+		for _, e := range candidates {
+			base := path.Base(e.Name)
+			if e.Name == pattern || strings.EqualFold(base, pattern) || globMatch(pattern, e.Name) || globMatch(pattern, base) {
+				matches = append(matches, e)
+			}
+		}
+		switch len(matches) {
+		case 1:
+			return matches[0], nil
+		case 0:
+			return Entry{}, fmt.Errorf("no entry matches '%s'; entries: %s", pattern, names(candidates))
+		}
+		return Entry{}, fmt.Errorf("'%s' matches several entries: %s", pattern, names(matches))
+	}
+
+	if len(candidates) > 1 {
+		return Entry{}, fmt.Errorf("the archive contains several files, select one with --entry: %s", names(candidates))
+	}
+	return candidates[0], nil
+}
+
+// Matching returns the entries with one of the extensions, ordered by
+// file name without regard to case, as the disks of a set are numbered
+func Matching(entries []Entry, exts []string) []Entry {
+	var matched []Entry
+	for _, e := range entries {
+		if matchesExt(e.Name, exts) {
+			matched = append(matched, e)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := strings.ToLower(path.Base(matched[i].Name)), strings.ToLower(path.Base(matched[j].Name))
+		if a != b {
+			return a < b
+		}
+		return matched[i].Name < matched[j].Name
+	})
+	return matched
+}
+
+// readCBM reads the entries of a Lynx, ARK or LBR archive
+func readCBM(file string) ([]cbmarc.File, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	_, files, err := cbmarc.Read(file, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+	}
+	return files, nil
+}
+
+// cbmName is the host name of an entry of a C64 archive
+func cbmName(f cbmarc.File) string {
+	return diskimage.HostName(diskimage.File{Name: f.Name, Type: f.Type})
+}
+
+// gzipName returns the original file name of a gzip file
+func gzipName(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+	}
+	defer gz.Close()
+
+	if gz.Name != "" {
+		return filepath.Base(gz.Name), nil
+	}
+	return strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)), nil
+}
+
+// isJunk reports metadata files added by archivers (macOS resource forks)
+func isJunk(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), "._")
+}
+
+// matchesExt reports whether name has one of exts (case-insensitive)
+func matchesExt(name string, exts []string) bool {
+	if len(exts) == 0 {
+		return true
+	}
+	ext := strings.ToLower(path.Ext(name))
+	for _, e := range exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches a case-insensitive glob pattern
+func globMatch(pattern, name string) bool {
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return ok
+}
+
+// names joins entry names for error messages
+func names(entries []Entry) string {
+	list := make([]string, len(entries))
+	for i, e := range entries {
+		list[i] = e.Name
+	}
+	return strings.Join(list, ", ")
+}
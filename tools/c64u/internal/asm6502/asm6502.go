@@ -0,0 +1,125 @@
+// Package asm6502 assembles the small 6502 routines c64u generates, such as
+// the SID player stub and the PRG decruncher
+package asm6502
+
+// Zero page pointers used by the move routines
+const (
+	ZPSrc = 0xFB
+	ZPDst = 0xFD
+)
+
+// Asm assembles 6502 code at a fixed address, resolving labels at the end
+type Asm struct {
+	org    int
+	code   []byte
+	labels map[string]int
+	fixups []fixup
+}
+
+// fixup is a reference to a label: a branch offset, or the low or high
+// byte or both of its address
+type fixup struct {
+	pos   int
+	label string
+	kind  byte // 'r' (branch), '<', '>' or 'w' (word)
+}
+
+// New starts assembling at address org
+func New(org int) *Asm {
+	return &Asm{org: org, labels: map[string]int{}}
+}
+
+// Op emits raw bytes
+func (a *Asm) Op(b ...byte) { a.code = append(a.code, b...) }
+
+// Label defines a label at the current address
+func (a *Asm) Label(name string) { a.labels[name] = a.org + len(a.code) }
+
+// Abs emits an instruction with an absolute address operand
+func (a *Asm) Abs(opcode byte, addr int) {
+	a.Op(opcode, byte(addr), byte(addr>>8))
+}
+
+// AbsLabel emits an instruction whose operand is a label's address, or
+// with a "<" or ">" prefix its low or high byte as an immediate
+func (a *Asm) AbsLabel(opcode byte, label string) {
+	switch label[0] {
+	case '<', '>':
+		a.Op(opcode, 0)
+		a.fixups = append(a.fixups, fixup{len(a.code) - 1, label[1:], label[0]})
+	default:
+		a.Op(opcode, 0, 0)
+		a.fixups = append(a.fixups, fixup{len(a.code) - 2, label, 'w'})
+	}
+}
+
+// Branch emits a relative branch to a label
+func (a *Asm) Branch(opcode byte, label string) {
+	a.Op(opcode, 0)
+	a.fixups = append(a.fixups, fixup{len(a.code) - 1, label, 'r'})
+}
+
+// Bytes resolves the labels and returns the code
+func (a *Asm) Bytes() []byte {
+	for _, f := range a.fixups {
+		addr := a.labels[f.label]
+		switch f.kind {
+		case 'r':
+			a.code[f.pos] = byte(addr - (a.org + f.pos + 1))
+		case '<':
+			a.code[f.pos] = byte(addr)
+		case '>':
+			a.code[f.pos] = byte(addr >> 8)
+		default:
+			a.code[f.pos], a.code[f.pos+1] = byte(addr), byte(addr>>8)
+		}
+	}
+	return a.code
+}
+
+// pointers sets the zero page source and destination pointers
+func (a *Asm) pointers(src, dst int) {
+	a.Op(0xA9, byte(src), 0x85, ZPSrc, 0xA9, byte(src>>8), 0x85, ZPSrc+1)
+	a.Op(0xA9, byte(dst), 0x85, ZPDst, 0xA9, byte(dst>>8), 0x85, ZPDst+1)
+}
+
+// MoveForward copies size bytes from src to a lower dst, lowest first
+func (a *Asm) MoveForward(src, dst, size int) {
+	a.pointers(src, dst)
+	a.Op(0xA0, 0x00) // ldy #0
+	if pages := size >> 8; pages > 0 {
+		a.Op(0xA2, byte(pages)) // ldx #pages
+		a.Label("fpage")
+		a.Op(0xB1, ZPSrc, 0x91, ZPDst, 0xC8) // lda (src),y, sta (dst),y, iny
+		a.Branch(0xD0, "fpage")
+		a.Op(0xE6, ZPSrc+1, 0xE6, ZPDst+1, 0xCA) // inc src+1, inc dst+1, dex
+		a.Branch(0xD0, "fpage")
+	}
+	if rest := size & 0xFF; rest > 0 {
+		a.Label("frest")
+		a.Op(0xB1, ZPSrc, 0x91, ZPDst, 0xC8, 0xC0, byte(rest))
+		a.Branch(0xD0, "frest")
+	}
+}
+
+// MoveBackward copies size bytes from src to a higher dst, highest first
+func (a *Asm) MoveBackward(src, dst, size int) {
+	pages := size >> 8
+	a.pointers(src+pages*256, dst+pages*256)
+	if rest := size & 0xFF; rest > 0 {
+		a.Op(0xA0, byte(rest)) // ldy #rest
+		a.Label("brest")
+		a.Op(0x88, 0xB1, ZPSrc, 0x91, ZPDst, 0x98) // dey, lda (src),y, sta (dst),y, tya
+		a.Branch(0xD0, "brest")
+	}
+	if pages > 0 {
+		a.Op(0xA2, byte(pages)) // ldx #pages
+		a.Label("bpage")
+		a.Op(0xC6, ZPSrc+1, 0xC6, ZPDst+1, 0xA0, 0x00) // dec src+1, dec dst+1, ldy #0
+		a.Label("bbyte")
+		a.Op(0x88, 0xB1, ZPSrc, 0x91, ZPDst, 0x98)
+		a.Branch(0xD0, "bbyte")
+		a.Op(0xCA) // dex
+		a.Branch(0xD0, "bpage")
+	}
+}
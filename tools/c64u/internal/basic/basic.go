@@ -0,0 +1,172 @@
+package basic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+)
+
+// Zero page pointers to the BASIC program in memory
+const (
+	// TXTTAB points to the start of the BASIC program
+	TXTTAB = 0x2B
+	// VARTAB points to the end of the program (start of variables)
+	VARTAB = 0x2D
+)
+
+// TokenSYS is the BASIC token of the SYS statement
+const TokenSYS = 0x9E
+
+// Line is a single BASIC program line
+type Line struct {
+	Number int
+	// Text is the raw (tokenized) line content without the terminating zero
+	Text []byte
+}
+
+// Lines decodes a BASIC program stored at address start. The link pointers
+// are followed until the end marker or the end of the data.
+func Lines(program []byte, start int) ([]Line, error) {
+	var lines []Line
+	offset := 0
+	for {
+		if offset+2 > len(program) {
+			return lines, fmt.Errorf("program ends without end marker at $%04X", start+offset)
+		}
+		next := int(program[offset]) | int(program[offset+1])<<8
+		if next == 0 {
+			return lines, nil
+		}
+		if offset+4 > len(program) {
+			return lines, fmt.Errorf("truncated line header at $%04X", start+offset)
+		}
+		number := int(program[offset+2]) | int(program[offset+3])<<8
+
+		end := offset + 4
+		for end < len(program) && program[end] != 0 {
+			end++
+		}
+		if end >= len(program) {
+			return lines, fmt.Errorf("unterminated line %d at $%04X", number, start+offset)
+		}
+		lines = append(lines, Line{Number: number, Text: program[offset+4 : end]})
+
+		if next-start <= offset || next-start > len(program) {
+			return lines, fmt.Errorf("bad link pointer $%04X in line %d", next, number)
+		}
+		offset = next - start
+	}
+}
+
+// SysCall returns the address of the first SYS statement with a constant
+// address, as in the BASIC stubs that start machine code programs
+// ("10 SYS2061")
+func SysCall(lines []Line) (int, bool) {
+	for _, line := range lines {
+		quoted := false
+		for i, b := range line.Text {
+			if b == '"' {
+				quoted = !quoted
+			}
+			if quoted || b != TokenSYS {
+				continue
+			}
+			addr, digits := 0, 0
+		scan:
+			for _, c := range line.Text[i+1:] {
+				switch {
+				case c >= '0' && c <= '9':
+					addr = addr*10 + int(c-'0')
+					digits++
+				case c == ' ' || (c == '(' && digits == 0):
+				default:
+					break scan
+				}
+			}
+			if digits > 0 && addr <= 0xFFFF {
+				return addr, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Directory is a disk directory as returned by LOAD"$"
+type Directory struct {
+	DiskName   string  `json:"disk_name"`
+	DiskID     string  `json:"disk_id"`
+	Entries    []Entry `json:"entries"`
+	BlocksFree int     `json:"blocks_free"`
+}
+
+// Entry is a file in a directory listing
+type Entry struct {
+	Blocks int    `json:"blocks"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	// Locked and Splat mark "<" (locked) and "*" (not closed) files
+	Locked bool `json:"locked,omitempty"`
+	Splat  bool `json:"splat,omitempty"`
+}
+
+// ParseDirectory parses the BASIC program produced by LOAD"$"
+func ParseDirectory(program []byte, start int) (*Directory, error) {
+	lines, err := Lines(program, start)
+	if err != nil && len(lines) == 0 {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("directory listing is empty")
+	}
+
+	dir := &Directory{Entries: []Entry{}}
+	for i, line := range lines {
+		text := petscii.ToText(line.Text)
+		name, rest, quoted := splitQuoted(text)
+
+		switch {
+		case i == 0:
+			dir.DiskName = name
+			dir.DiskID = strings.TrimSpace(rest)
+		case !quoted && strings.Contains(text, "BLOCKS FREE"):
+			dir.BlocksFree = line.Number
+		case quoted:
+			entry := Entry{Blocks: line.Number, Name: name}
+			rest = strings.TrimSpace(rest)
+			entry.Splat = strings.HasPrefix(rest, "*")
+			rest = strings.TrimPrefix(rest, "*")
+			entry.Locked = strings.HasSuffix(rest, "<")
+			entry.Type = strings.TrimSpace(strings.TrimSuffix(rest, "<"))
+			dir.Entries = append(dir.Entries, entry)
+		}
+	}
+	return dir, nil
+}
+
+// splitQuoted returns the text between the first pair of quotes and the
+// text after them
+func splitQuoted(text string) (quoted, rest string, ok bool) {
+	open := strings.IndexByte(text, '"')
+	if open < 0 {
+		return "", text, false
+	}
+	end := strings.IndexByte(text[open+1:], '"')
+	if end < 0 {
+		return text[open+1:], "", true
+	}
+	return text[open+1 : open+1+end], text[open+2+end:], true
+}
+
+// FormatEntry formats an entry like the C64 LIST output
+func FormatEntry(e Entry) string {
+	name := `"` + e.Name + `"`
+	flags := e.Type
+	if e.Splat {
+		flags = "*" + flags
+	}
+	if e.Locked {
+		flags += "<"
+	}
+	return fmt.Sprintf("%-5d%-19s%s", e.Blocks, name, flags)
+}
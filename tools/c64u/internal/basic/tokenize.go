@@ -0,0 +1,81 @@
+package basic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+)
+
+// keywords are the BASIC V2 keywords in token order, starting at $80
+var keywords = []string{
+	"END", "FOR", "NEXT", "DATA", "INPUT#", "INPUT", "DIM", "READ",
+	"LET", "GOTO", "RUN", "IF", "RESTORE", "GOSUB", "RETURN", "REM",
+	"STOP", "ON", "WAIT", "LOAD", "SAVE", "VERIFY", "DEF", "POKE",
+	"PRINT#", "PRINT", "CONT", "LIST", "CLR", "CMD", "SYS", "OPEN",
+	"CLOSE", "GET", "NEW", "TAB(", "TO", "FN", "SPC(", "THEN",
+	"NOT", "STEP", "+", "-", "*", "/", "^", "AND",
+	"OR", ">", "=", "<", "SGN", "INT", "ABS", "USR",
+	"FRE", "POS", "SQR", "RND", "LOG", "EXP", "COS", "SIN",
+	"TAN", "ATN", "PEEK", "LEN", "STR$", "VAL", "ASC", "CHR$",
+	"LEFT$", "RIGHT$", "MID$", "GO",
+}
+
+// Tokenize converts a line of BASIC V2 text (without line number) to its
+// tokenized form, as the line editor does: keywords outside strings
+// become tokens, except in REM statements and DATA items.
+func Tokenize(text string) ([]byte, error) {
+	upper := strings.ToUpper(text)
+	var out []byte
+	quoted, data, rem := false, false, false
+	for i := 0; i < len(upper); {
+		c := upper[i]
+		if !quoted && !data && !rem {
+			if tok, n := matchKeyword(upper[i:]); n > 0 {
+				out = append(out, tok)
+				i += n
+				data = tok == 0x83
+				rem = tok == 0x8F
+				continue
+			}
+		}
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ':' && !quoted:
+			data = false
+		}
+		// Strings keep the case of the text
+		b, ok := petscii.RuneToPETSCII(rune(text[i]))
+		if !ok {
+			return nil, fmt.Errorf("character %q at position %d has no PETSCII equivalent", text[i], i+1)
+		}
+		out = append(out, b)
+		i++
+	}
+	return out, nil
+}
+
+// matchKeyword returns the token of the first keyword s starts with and
+// the keyword's length
+func matchKeyword(s string) (byte, int) {
+	for i, kw := range keywords {
+		if strings.HasPrefix(s, kw) {
+			return byte(0x80 + i), len(kw)
+		}
+	}
+	return 0, 0
+}
+
+// Encode stores program lines at address start, with link pointers and
+// the end marker (without a load address)
+func Encode(lines []Line, start int) []byte {
+	var out []byte
+	for _, line := range lines {
+		next := start + len(out) + 4 + len(line.Text) + 1
+		out = append(out, byte(next), byte(next>>8), byte(line.Number), byte(line.Number>>8))
+		out = append(out, line.Text...)
+		out = append(out, 0)
+	}
+	return append(out, 0, 0)
+}
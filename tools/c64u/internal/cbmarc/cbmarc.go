@@ -0,0 +1,476 @@
+// Package cbmarc reads the classic C64 archive formats Lynx (.lnx), ARK
+// (.ark) and LBR (.lbr), and writes Lynx archives. Entries keep their
+// PETSCII names and CBM file types, so they can be stored in disk images
+// unchanged.
+package cbmarc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+)
+
+// Format is an archive format
+type Format int
+
+// Supported archive formats
+const (
+	Lynx Format = iota
+	ARK
+	LBR
+)
+
+// String returns the format's file extension without the dot
+func (f Format) String() string {
+	switch f {
+	case ARK:
+		return "ark"
+	case LBR:
+		return "lbr"
+	}
+	return "lnx"
+}
+
+// blockSize is the data size of a disk block, the unit Lynx and ARK
+// archives are laid out in
+const blockSize = 254
+
+// ErrFormat is returned for data that is not a valid archive
+var ErrFormat = errors.New("not a Lynx, ARK or LBR archive")
+
+// File is an archive entry
+type File struct {
+	Name []byte
+	Type diskimage.FileType
+	Data []byte
+	// RecordLength is the record size of a REL file, whose Data is only
+	// the records (side sectors are dropped)
+	RecordLength int
+}
+
+// IsArchiveName reports whether a file name has the extension of a
+// supported archive format
+func IsArchiveName(name string) bool {
+	_, ok := formatByName(name)
+	return ok
+}
+
+// formatByName returns the format of a file extension
+func formatByName(name string) (Format, bool) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".lnx"):
+		return Lynx, true
+	case strings.HasSuffix(lower, ".ark"):
+		return ARK, true
+	case strings.HasSuffix(lower, ".lbr"):
+		return LBR, true
+	}
+	return Lynx, false
+}
+
+// Detect recognizes the format of archive data by its signature, falling
+// back to the file name's extension for ARK, which has none
+func Detect(name string, data []byte) (Format, error) {
+	head := data
+	if len(head) > 256 {
+		head = head[:256]
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("DWB")):
+		return LBR, nil
+	case bytes.Contains(head, []byte("LYNX")):
+		return Lynx, nil
+	}
+	if f, ok := formatByName(name); ok && f == ARK {
+		return ARK, nil
+	}
+	return Lynx, ErrFormat
+}
+
+// Read returns the entries of an archive
+func Read(name string, data []byte) (Format, []File, error) {
+	format, err := Detect(name, data)
+	if err != nil {
+		return format, nil, err
+	}
+	var files []File
+	switch format {
+	case LBR:
+		files, err = readLBR(data)
+	case ARK:
+		files, err = readARK(data)
+	default:
+		files, err = readLynx(data)
+	}
+	if err != nil {
+		return format, nil, fmt.Errorf("%s archive: %w", strings.ToUpper(format.String()), err)
+	}
+	return format, files, nil
+}
+
+// ============================================================================
+// Lynx
+// ============================================================================
+
+// A Lynx archive starts with a BASIC stub, followed by a directory of
+// CR-terminated lines: the size of stub and directory in blocks with the
+// "*LYNX" signature, the number of entries, and per entry the name
+// (padded to 16 with shifted spaces), the number of blocks, the type
+// letter, a REL record length (REL files only) and the number of bytes
+// used in the last block plus one. The files follow at the next block
+// boundary, each padded to whole blocks except the last.
+
+// readLynx parses a Lynx archive
+func readLynx(data []byte) ([]File, error) {
+	// The stub's PRINT usually names Lynx too, so prefer the signature
+	sig := bytes.Index(data, []byte("*LYNX"))
+	if sig < 0 {
+		sig = bytes.Index(data, []byte("LYNX"))
+	}
+	start := bytes.LastIndexByte(data[:sig], 0x0D) + 1
+	r := &lineReader{data: data, pos: start}
+
+	header, err := r.line()
+	if err != nil {
+		return nil, err
+	}
+	dirBlocks, err := leadingNumber(header)
+	if err != nil {
+		return nil, fmt.Errorf("directory size: %w", err)
+	}
+	count, err := r.number()
+	if err != nil {
+		return nil, fmt.Errorf("entry count: %w", err)
+	}
+
+	type entry struct {
+		name         []byte
+		typ          diskimage.FileType
+		blocks, last int
+		recordLength int
+	}
+	entries := make([]entry, 0, count)
+	for i := 0; i < count; i++ {
+		var e entry
+		name, err := r.line()
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		e.name = trimPadding(name)
+		if e.blocks, err = r.number(); err != nil {
+			return nil, fmt.Errorf("entry %d blocks: %w", i+1, err)
+		}
+		letter, err := r.line()
+		if err != nil {
+			return nil, fmt.Errorf("entry %d type: %w", i+1, err)
+		}
+		if e.typ, err = typeLetter(letter); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if e.typ == diskimage.REL {
+			if e.recordLength, err = r.number(); err != nil {
+				return nil, fmt.Errorf("entry %d record length: %w", i+1, err)
+			}
+		}
+		if e.last, err = r.number(); err != nil {
+			return nil, fmt.Errorf("entry %d last block: %w", i+1, err)
+		}
+		entries = append(entries, e)
+	}
+
+	files := make([]File, 0, count)
+	off := dirBlocks * blockSize
+	for i, e := range entries {
+		start, size := off, lastBlockSize(e.blocks, e.last)
+		if e.typ == diskimage.REL {
+			// The side sectors come first; they are rebuilt when the file
+			// is stored
+			sideSectors := (e.blocks + 120) / 121
+			start += sideSectors * blockSize
+			size -= sideSectors * blockSize
+		}
+		if size < 0 || start+size > len(data) {
+			return nil, fmt.Errorf("entry %d (%s) is truncated", i+1, e.name)
+		}
+		files = append(files, File{
+			Name:         e.name,
+			Type:         e.typ,
+			Data:         append([]byte(nil), data[start:start+size]...),
+			RecordLength: e.recordLength,
+		})
+		off += e.blocks * blockSize
+	}
+	return files, nil
+}
+
+// lynxStub is the BASIC program at the start of archives written here:
+// 10 PRINT"USE LYNX TO DISSOLVE THIS FILE"
+var lynxStub = func() []byte {
+	line := append([]byte{0x0A, 0x00, 0x99, '"'}, []byte("USE LYNX TO DISSOLVE THIS FILE")...)
+	line = append(line, '"', 0x00)
+	next := 0x0801 + 2 + len(line)
+	stub := []byte{0x01, 0x08, byte(next), byte(next >> 8)}
+	stub = append(stub, line...)
+	return append(stub, 0x00, 0x00)
+}()
+
+// WriteLynx returns a Lynx archive of files. REL files are not supported.
+func WriteLynx(files []File) ([]byte, error) {
+	var dir bytes.Buffer
+	fmt.Fprintf(&dir, " %d \r", len(files))
+	for _, f := range files {
+		if f.Type == diskimage.REL || f.Type == diskimage.CBM || f.Type == diskimage.DIR {
+			return nil, fmt.Errorf("%s: cannot archive %s files", f.Name, f.Type)
+		}
+		if len(f.Name) == 0 || len(f.Name) > 16 {
+			return nil, fmt.Errorf("file name must be 1 to 16 characters")
+		}
+		name := append([]byte(nil), f.Name...)
+		for len(name) < 16 {
+			name = append(name, 0xA0)
+		}
+		blocks, last := blockCount(len(f.Data))
+		dir.Write(name)
+		fmt.Fprintf(&dir, "\r %d \r%c\r %d \r", blocks, typeChar(f.Type), last)
+	}
+
+	// The first line holds the directory size in blocks, which depends on
+	// the length of that line
+	var header []byte
+	for dirBlocks := 1; ; dirBlocks++ {
+		header = append([]byte(nil), lynxStub...)
+		header = append(header, []byte(fmt.Sprintf("\r %d  *LYNX XV  BY C64U\r", dirBlocks))...)
+		header = append(header, dir.Bytes()...)
+		if len(header) <= dirBlocks*blockSize {
+			header = append(header, make([]byte, dirBlocks*blockSize-len(header))...)
+			break
+		}
+	}
+
+	out := header
+	for i, f := range files {
+		out = append(out, f.Data...)
+		if i < len(files)-1 {
+			if pad := len(f.Data) % blockSize; pad != 0 || len(f.Data) == 0 {
+				out = append(out, make([]byte, blockSize-pad)...)
+			}
+		}
+	}
+	return out, nil
+}
+
+// ============================================================================
+// ARK
+// ============================================================================
+
+// An ARK archive starts with the number of entries and a 29-byte entry per
+// file: the CBM file type, the bytes used in the last block plus one, the
+// name (padded with shifted spaces), the REL record length and side sector
+// counts, and the number of blocks. The directory is padded to whole
+// blocks, and the files follow, each padded to whole blocks except the
+// last.
+
+// arkEntrySize is the size of an ARK directory entry
+const arkEntrySize = 29
+
+// readARK parses an ARK archive
+func readARK(data []byte) ([]File, error) {
+	if len(data) == 0 {
+		return nil, ErrFormat
+	}
+	count := int(data[0])
+	dirSize := 1 + count*arkEntrySize
+	if count == 0 || dirSize > len(data) {
+		return nil, ErrFormat
+	}
+
+	files := make([]File, 0, count)
+	off := (dirSize + blockSize - 1) / blockSize * blockSize
+	for i := 0; i < count; i++ {
+		e := data[1+i*arkEntrySize : 1+(i+1)*arkEntrySize]
+		typ := diskimage.FileType(e[0] & 0x07)
+		if typ > diskimage.REL {
+			return nil, fmt.Errorf("entry %d has unknown file type $%02X", i+1, e[0])
+		}
+		blocks := int(e[0x1B]) | int(e[0x1C])<<8
+		start, size := off, lastBlockSize(blocks, int(e[1]))
+		if typ == diskimage.REL {
+			sideSectors := int(e[0x19])
+			start += sideSectors * blockSize
+			size -= sideSectors * blockSize
+		}
+		if size < 0 || start+size > len(data) {
+			return nil, fmt.Errorf("entry %d (%s) is truncated", i+1, trimPadding(e[2:0x12]))
+		}
+		files = append(files, File{
+			Name:         trimPadding(e[2:0x12]),
+			Type:         typ,
+			Data:         append([]byte(nil), data[start:start+size]...),
+			RecordLength: int(e[0x12]),
+		})
+		off += blocks * blockSize
+	}
+	return files, nil
+}
+
+// ============================================================================
+// LBR
+// ============================================================================
+
+// An LBR archive starts with "DWB" and the number of entries, followed by
+// CR-terminated lines per entry: the name, the type letter (and a REL
+// record length) and the size in bytes. The files follow back to back.
+
+// readLBR parses an LBR archive
+func readLBR(data []byte) ([]File, error) {
+	r := &lineReader{data: data, pos: 3}
+	count, err := r.number()
+	if err != nil {
+		return nil, fmt.Errorf("entry count: %w", err)
+	}
+
+	files := make([]File, 0, count)
+	sizes := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		var f File
+		name, err := r.line()
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		f.Name = trimPadding(name)
+		letter, err := r.line()
+		if err != nil {
+			return nil, fmt.Errorf("entry %d type: %w", i+1, err)
+		}
+		if f.Type, err = typeLetter(letter); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if f.Type == diskimage.REL {
+			if f.RecordLength, err = r.number(); err != nil {
+				return nil, fmt.Errorf("entry %d record length: %w", i+1, err)
+			}
+		}
+		size, err := r.number()
+		if err != nil {
+			return nil, fmt.Errorf("entry %d size: %w", i+1, err)
+		}
+		files = append(files, f)
+		sizes = append(sizes, size)
+	}
+
+	off := r.pos
+	for i := range files {
+		if off+sizes[i] > len(data) {
+			return nil, fmt.Errorf("entry %d (%s) is truncated", i+1, files[i].Name)
+		}
+		files[i].Data = append([]byte(nil), data[off:off+sizes[i]]...)
+		off += sizes[i]
+	}
+	return files, nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// lineReader reads CR-terminated lines
+type lineReader struct {
+	data []byte
+	pos  int
+}
+
+// line returns the next line without its CR
+func (r *lineReader) line() ([]byte, error) {
+	end := bytes.IndexByte(r.data[r.pos:], 0x0D)
+	if end < 0 {
+		return nil, errors.New("unexpected end of directory")
+	}
+	line := r.data[r.pos : r.pos+end]
+	r.pos += end + 1
+	return line, nil
+}
+
+// number returns the next line as a number, as BASIC prints them (" 12 ")
+func (r *lineReader) number() (int, error) {
+	line, err := r.line()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(line)))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %q", line)
+	}
+	return n, nil
+}
+
+// leadingNumber parses the number at the start of a line such as
+// " 2  *LYNX XV"
+func leadingNumber(line []byte) (int, error) {
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return 0, errors.New("empty line")
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid number %q", fields[0])
+	}
+	return n, nil
+}
+
+// lastBlockSize returns the size of a file of blocks blocks whose last
+// block has last-1 bytes
+func lastBlockSize(blocks, last int) int {
+	if blocks == 0 {
+		return 0
+	}
+	if last < 1 || last > blockSize+1 {
+		last = blockSize + 1
+	}
+	return (blocks-1)*blockSize + last - 1
+}
+
+// blockCount returns the number of blocks of a file of size bytes and the
+// bytes used in the last block plus one
+func blockCount(size int) (blocks, last int) {
+	if size == 0 {
+		return 1, 1
+	}
+	blocks = (size + blockSize - 1) / blockSize
+	return blocks, size - (blocks-1)*blockSize + 1
+}
+
+// typeLetter parses a one-letter file type (D, S, P, U, R)
+func typeLetter(line []byte) (diskimage.FileType, error) {
+	switch strings.ToUpper(strings.TrimSpace(string(line))) {
+	case "D":
+		return diskimage.DEL, nil
+	case "S":
+		return diskimage.SEQ, nil
+	case "P":
+		return diskimage.PRG, nil
+	case "U":
+		return diskimage.USR, nil
+	case "R":
+		return diskimage.REL, nil
+	}
+	return diskimage.PRG, fmt.Errorf("unknown file type %q", line)
+}
+
+// typeChar returns the one-letter name of a file type
+func typeChar(t diskimage.FileType) byte {
+	return strings.ToUpper(t.String())[0]
+}
+
+// trimPadding removes shifted-space padding from a name
+func trimPadding(name []byte) []byte {
+	end := len(name)
+	for end > 0 && name[end-1] == 0xA0 {
+		end--
+	}
+	return append([]byte(nil), name[:end]...)
+}
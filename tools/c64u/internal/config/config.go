@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -14,6 +17,153 @@ type Config struct {
 	Port    int    `mapstructure:"port"`
 	Verbose bool   `mapstructure:"verbose"`
 	JSON    bool   `mapstructure:"json"`
+
+	// FTPPort is the Ultimate's FTP server port, used for file transfers
+	FTPPort int `mapstructure:"ftp_port"`
+
+	// TelnetPort is the Ultimate's telnet port, used by "c64u console"
+	TelnetPort int `mapstructure:"telnet_port"`
+
+	// UploadHistory records every file uploaded via runners and drives
+	UploadHistory bool `mapstructure:"upload_history"`
+
+	// RemoteCache keeps uploaded disk images and ROMs on the device under a
+	// content-hash path and reuses them instead of uploading again
+	RemoteCache    bool   `mapstructure:"remote_cache"`
+	RemoteCacheDir string `mapstructure:"remote_cache_dir"`
+
+	// AssumeYes answers the confirmation of destructive commands (poweroff,
+	// reboot, files rm, unmounting read-write images) with yes
+	AssumeYes bool `mapstructure:"assume_yes"`
+
+	// ReadOnly disables all state-changing commands (writes, mounts,
+	// resets, power), e.g. for a shared or exhibition device
+	ReadOnly bool `mapstructure:"read_only"`
+
+	// StreamDestination is the default destination of "c64u streams start";
+	// empty streams to this machine
+	StreamDestination string `mapstructure:"stream_destination"`
+	// StreamInterface is the network interface whose address is used as the
+	// stream destination; empty picks the one that reaches the device
+	StreamInterface string `mapstructure:"stream_interface"`
+
+	// HVSCDir is a local copy of the High Voltage SID Collection (or its
+	// DOCUMENTS directory), whose song lengths and STIL name and describe
+	// the songs of SID files
+	HVSCDir string `mapstructure:"hvsc_dir"`
+	// STILPath is a STIL.txt to use instead of the one in HVSCDir
+	STILPath string `mapstructure:"stil_path"`
+
+	// PrinterDir is where the Ultimate's virtual printer writes its output
+	PrinterDir string `mapstructure:"printer_dir"`
+
+	// LockWait is how long to wait for another c64u process to release the device
+	LockWait time.Duration `mapstructure:"lock_wait"`
+
+	// BusyWait is how long to retry while the device reports it is busy
+	BusyWait time.Duration `mapstructure:"busy_wait"`
+
+	// Request pacing, to avoid wedging the Ultimate's embedded web server
+	MaxRPS      float64       `mapstructure:"max_rps"`
+	Burst       int           `mapstructure:"burst"`
+	MinInterval time.Duration `mapstructure:"min_interval"`
+
+	// Theme selects a built-in or custom color theme
+	Theme string `mapstructure:"theme"`
+	// Themes defines custom color themes ([themes.<name>] tables)
+	Themes map[string]map[string]string `mapstructure:"themes"`
+
+	// Compression negotiates gzip/deflate compressed responses
+	Compression bool `mapstructure:"compression"`
+	// CompressUploads gzips compressible uploads (needs firmware support)
+	CompressUploads bool `mapstructure:"compress_uploads"`
+
+	// Keymap translates host characters for the keys commands: a built-in
+	// layout or a file in keymaps/ below the config directory
+	Keymap string `mapstructure:"keymap"`
+
+	// Pager is the command used to page long output (default: $PAGER or less)
+	Pager string `mapstructure:"pager"`
+
+	// Transcript is a file that every command and request is appended to
+	Transcript string `mapstructure:"transcript"`
+
+	// Stats records local usage statistics for "c64u stats" (opt-in)
+	Stats bool `mapstructure:"stats"`
+
+	// Filenames are the rules that make local file names safe for the
+	// device on upload and sync (--transliterate) and fit them into disk
+	// images
+	Filenames FilenamesConfig `mapstructure:"filenames"`
+
+	Power PowerConfig `mapstructure:"power"`
+
+	MQTT MQTTConfig `mapstructure:"mqtt"`
+
+	// Schedule lists jobs run by "c64u daemon"
+	Schedule []ScheduleJob `mapstructure:"schedule"`
+
+	Daemon DaemonConfig `mapstructure:"daemon"`
+}
+
+// DaemonConfig configures the HTTP API of "c64u daemon"
+type DaemonConfig struct {
+	// Listen is the API address; empty disables the API
+	Listen string `mapstructure:"listen"`
+	// CommandTimeout stops commands run through the API that take longer
+	CommandTimeout time.Duration `mapstructure:"command_timeout"`
+	Tokens         []DaemonToken `mapstructure:"tokens"`
+}
+
+// DaemonToken grants access to the daemon API with a permission scope
+// (view, run or admin)
+type DaemonToken struct {
+	Name  string `mapstructure:"name"`
+	Token string `mapstructure:"token"`
+	Scope string `mapstructure:"scope"`
+}
+
+// ScheduleJob is a c64u command run periodically by the daemon
+type ScheduleJob struct {
+	Name    string `mapstructure:"name"`
+	Cron    string `mapstructure:"cron"`
+	Command string `mapstructure:"command"`
+}
+
+// FilenamesConfig configures the transliteration of file names and the
+// shortening of names for disk images
+type FilenamesConfig struct {
+	// Transliterate makes names safe on every upload and sync
+	Transliterate bool `mapstructure:"transliterate"`
+	// Replace lists custom replacements, each a pair of strings
+	Replace [][]string `mapstructure:"replace"`
+	// MaxLength shortens longer names, keeping the extension (0: no limit)
+	MaxLength int `mapstructure:"max_length"`
+	// LongNames is how names longer than 16 characters are fitted into
+	// disk images: truncate, squeeze or error
+	LongNames string `mapstructure:"long_names"`
+	// UniqueSuffix tells apart names that became equal when shortened
+	UniqueSuffix string `mapstructure:"unique_suffix"`
+}
+
+// MQTTConfig configures the broker used by `c64u mqtt serve`
+type MQTTConfig struct {
+	Broker   string `mapstructure:"broker"`
+	Topic    string `mapstructure:"topic"`
+	ClientID string `mapstructure:"client_id"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// Discovery publishes Home Assistant MQTT discovery configs
+	Discovery bool `mapstructure:"discovery"`
+}
+
+// PowerConfig configures the smart plug / Wake-on-LAN backend for `c64u power`
+type PowerConfig struct {
+	Backend   string `mapstructure:"backend"`
+	Host      string `mapstructure:"host"`
+	Relay     int    `mapstructure:"relay"`
+	MAC       string `mapstructure:"mac"`
+	Broadcast string `mapstructure:"broadcast"`
 }
 
 // Load loads configuration from file, environment variables, and flags
@@ -24,6 +174,25 @@ func Load() (*Config, error) {
 	viper.SetDefault("port", 80)
 	viper.SetDefault("verbose", false)
 	viper.SetDefault("json", false)
+	viper.SetDefault("ftp_port", 21)
+	viper.SetDefault("telnet_port", 23)
+	viper.SetDefault("mqtt.topic", "c64u")
+	viper.SetDefault("daemon.command_timeout", "5m")
+	viper.SetDefault("printer_dir", "/Usb0/printer")
+	viper.SetDefault("read_only", false)
+	viper.SetDefault("stats", false)
+	viper.SetDefault("upload_history", false)
+	viper.SetDefault("remote_cache", false)
+	viper.SetDefault("remote_cache_dir", "/Usb0/.c64u-cache")
+	viper.SetDefault("assume_yes", false)
+	viper.SetDefault("theme", "default")
+	viper.SetDefault("compression", true)
+	viper.SetDefault("compress_uploads", false)
+	viper.SetDefault("lock_wait", "30s")
+	viper.SetDefault("busy_wait", "0s")
+	viper.SetDefault("max_rps", 10)
+	viper.SetDefault("burst", 5)
+	viper.SetDefault("min_interval", "0s")
 
 	// Set config file name and paths
 	viper.SetConfigName("config")
@@ -91,6 +260,137 @@ host = "localhost"
 # HTTP port (default: 80)
 port = 80
 
+# FTP port used for file transfers (default: 21)
+# ftp_port = 21
+
+# Telnet port used by "c64u console" (default: 23)
+# telnet_port = 23
+
+# Record uploaded programs, cartridges, disk images and ROMs (hash, size,
+# time, target) for "c64u history uploads" (default: false)
+# upload_history = true
+
+# Keep uploaded disk images and ROMs on the device under a content-hash
+# path and mount the stored copy next time instead of uploading again
+# (default: false; same as --remote-cache)
+# remote_cache = true
+# remote_cache_dir = "/Usb0/.c64u-cache"
+
+# Do not ask before destructive commands (poweroff, reboot, files rm/mv,
+# unmounting a read-write image), as if --yes were given (default: false;
+# also C64U_ASSUME_YES=1)
+# assume_yes = true
+
+# Refuse every command that changes the device (uploads, deletes, mounts,
+# runners, resets, power), so scripts can only inspect it, as if
+# --read-only were given (default: false; also C64U_READ_ONLY=1)
+# read_only = true
+
+# Output directory of the virtual printer, as set in the Ultimate's
+# printer settings (used by "c64u printer")
+# printer_dir = "/Usb0/printer"
+
+# Local HVSC copy whose DOCUMENTS/Songlengths.md5 and STIL.txt name and
+# time songs and show their commentary ("c64u sidplay --interactive",
+# "c64u sid info", the overlay); stil_path overrides the STIL.txt used
+# hvsc_dir = "/home/user/C64Music"
+# stil_path = "/home/user/C64Music/DOCUMENTS/STIL.txt"
+
+# Default destination of "c64u streams start" when no IP is given. Without
+# it, streams go to this machine's address on the interface that reaches the
+# Ultimate, or on stream_interface.
+# stream_destination = "192.168.1.20"
+# stream_interface = "eth0"
+
+# Color theme: default, c64, light, or a custom [themes.<name>] table
+# (colors are ANSI numbers or hex values; NO_COLOR=1 disables colors)
+# theme = "c64"
+# [themes.mine]
+# success = "#9AD284"
+# error = "#B86962"
+# header = "12"
+
+# Request gzip/deflate compressed responses (default: true)
+# compression = true
+# Gzip compressible uploads such as RAM dumps and empty disk images.
+# Only enable this if your firmware accepts Content-Encoding: gzip.
+# compress_uploads = false
+
+# Keymap for characters of the host keyboard layout that PETSCII lacks,
+# used by "keys type" and "keys paste": de, sv, da or a file in keymaps/
+# (see c64u keys layouts)
+# keymap = "de"
+
+# Pager for long output such as hexdumps and listings (default: $PAGER,
+# then less; "cat" or --no-pager disables paging)
+# pager = "less -R"
+
+# How long to wait for another c64u process using the same device
+# lock_wait = "30s"
+
+# How long to keep retrying while the device is busy, e.g. while the menu
+# is open or another transfer is active (default: fail immediately)
+# busy_wait = "60s"
+
+# Request pacing: sustained requests per second (0 = unlimited), burst size,
+# and a fixed minimum delay between requests
+# max_rps = 10
+# burst = 5
+# min_interval = "0s"
+
+# Append every command, request and result to this file (JSON Lines)
+# transcript = "/home/user/.config/c64u/transcript.jsonl"
+
+# Record which commands run, how long they take and whether they fail, for
+# "c64u stats" (local only; no arguments, hosts or file names)
+# stats = true
+
+# File names for upload and sync: --transliterate (or transliterate = true)
+# spells out umlauts, removes accents and replaces characters CBM DOS or FAT
+# reject; replace pairs run first, max_length keeps the extension
+# [filenames]
+# transliterate = true
+# replace = [["&", "and"], ["å", "a"]]
+# max_length = 16
+# Names longer than 16 characters in disk images ("d64 add", "menu build"):
+# truncate, squeeze (drop vowels and spaces first) or error; names that
+# become equal get unique_suffix, %d counting from 2
+# long_names = "squeeze"
+# unique_suffix = "-%d"
+
+# Power control for "c64u power on|off|cycle"
+# Backends: tasmota, shelly (smart plugs, by host), wol (Wake-on-LAN, by mac)
+# [power]
+# backend = "tasmota"
+# host = "192.168.1.50"
+# relay = 0                      # shelly only
+# mac = "00:11:22:33:44:55"      # wol only
+# broadcast = "255.255.255.255:9" # wol only
+
+# MQTT broker for "c64u mqtt serve" (status topics and command topics)
+# [mqtt]
+# broker = "tcp://192.168.1.10:1883"   # mqtts:// for TLS
+# topic = "c64u"
+# username = "c64u"
+# password = "secret"
+# discovery = true                     # Home Assistant MQTT discovery
+
+# Scheduled jobs run by "c64u daemon" (cron syntax or @hourly, @daily, @every 30m)
+# [[schedule]]
+# name = "nightly-poweroff"
+# cron = "0 1 * * *"
+# command = "machine poweroff"
+
+# HTTP API of "c64u daemon" (see "c64u daemon --help"); each token has a
+# scope: view (status queries), run (runners, mounts, reset) or admin
+# [daemon]
+# listen = "0.0.0.0:6465"
+# command_timeout = "5m"
+# [[daemon.tokens]]
+# name = "party-ui"
+# token = "change-me"                  # e.g. openssl rand -hex 16
+# scope = "run"
+
 # Example for a specific C64 Ultimate on network:
 # host = "192.168.1.100"
 # port = 80
@@ -106,9 +406,64 @@ port = 80
 
 // GetConfigPath returns the path to the config file if it exists
 func GetConfigPath() string {
+	configDir := GetConfigDir()
+	if configDir == "" {
+		return ""
+	}
+	return filepath.Join(configDir, "config.toml")
+}
+
+// GetConfigDir returns the c64u configuration directory (~/.config/c64u)
+func GetConfigDir() string {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return ""
 	}
-	return filepath.Join(homeDir, ".config", "c64u", "config.toml")
+	return filepath.Join(homeDir, ".config", "c64u")
+}
+
+// secretKeys are the settings whose values Redacted hides
+var secretKeys = map[string]bool{"password": true, "token": true}
+
+// Redacted returns the settings Load resolved, with passwords, tokens and
+// the passwords in URLs replaced, e.g. for a bug report. Call it after Load.
+func Redacted() map[string]interface{} {
+	return redact(viper.AllSettings()).(map[string]interface{})
+}
+
+// redact replaces the secrets in a settings value
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			if s, ok := x.(string); secretKeys[strings.ToLower(k)] && (!ok || s != "") {
+				out[k] = "REDACTED"
+			} else {
+				out[k] = redact(x)
+			}
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]interface{}, len(v))
+		for i, x := range v {
+			out[i] = redact(x)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, x := range v {
+			out[i] = redact(x)
+		}
+		return out
+	case string:
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "REDACTED")
+				return u.String()
+			}
+		}
+		return v
+	}
+	return v
 }
@@ -0,0 +1,135 @@
+// Package crunch compresses C64 programs into self-extracting PRGs that
+// unpack themselves in place and start the program.
+package crunch
+
+// The compressed stream is a sequence of tokens, decoded front to back
+// until the unpacked size is reached:
+//
+//	$00-$7F  literal run: token+1 bytes follow and are copied
+//	$80-$BF  short match: (token&$3F)+2 bytes copied from 1-256 bytes
+//	         back, the byte after the token holds distance-1
+//	$C0-$FE  long match: (token&$3F)+3 bytes copied from 1-65535 bytes
+//	         back, the two bytes after the token hold the distance
+//
+// Matches may overlap the bytes they produce, so runs of a byte or a short
+// pattern compress to a single match.
+
+const (
+	maxLiteral = 128
+	shortMin   = 2
+	longMin    = 3
+	maxMatch   = 65
+	shortDist  = 256
+	maxDist    = 0xFFFF
+	// chainDepth limits how many earlier positions are tried per match
+	chainDepth = 256
+)
+
+// match is the longest short and long match found at a position
+type match struct {
+	shortLen, shortDist int
+	longLen, longDist   int
+}
+
+// step is the cheapest way to encode the data from a position on
+type step struct {
+	cost   int
+	length int
+	kind   byte // 'l' (literals), 's' (short match) or 'm' (long match)
+}
+
+// Crunch compresses data. margin is how many bytes past the end of the
+// unpacked data the compressed data must end at, so that unpacking in
+// place never overwrites bytes still to be read.
+func Crunch(data []byte) (packed []byte, margin int) {
+	matches := findMatches(data)
+
+	// Cheapest encoding of every suffix, computed back to front
+	n := len(data)
+	steps := make([]step, n+1)
+	steps[n] = step{}
+	for i := n - 1; i >= 0; i-- {
+		best := step{cost: 1 << 30}
+		for k := 1; k <= min(maxLiteral, n-i); k++ {
+			if c := 1 + k + steps[i+k].cost; c < best.cost {
+				best = step{c, k, 'l'}
+			}
+		}
+		m := matches[i]
+		for l := shortMin; l <= m.shortLen; l++ {
+			if c := 2 + steps[i+l].cost; c < best.cost {
+				best = step{c, l, 's'}
+			}
+		}
+		for l := longMin; l <= m.longLen; l++ {
+			if c := 3 + steps[i+l].cost; c < best.cost {
+				best = step{c, l, 'm'}
+			}
+		}
+		steps[i] = best
+	}
+
+	// Emit the tokens, tracking how far writing gets ahead of reading
+	packed = make([]byte, 0, steps[0].cost)
+	ahead := 0
+	for i := 0; i < n; {
+		s := steps[i]
+		switch s.kind {
+		case 'l':
+			packed = append(packed, byte(s.length-1))
+			for k := 0; k < s.length; k++ {
+				packed = append(packed, data[i+k])
+				ahead = max(ahead, i+k+1-len(packed))
+			}
+		case 's':
+			d := matches[i].shortDist
+			packed = append(packed, 0x80|byte(s.length-shortMin), byte(d-1))
+			ahead = max(ahead, i+s.length-len(packed))
+		default:
+			d := matches[i].longDist
+			packed = append(packed, 0xC0|byte(s.length-longMin), byte(d), byte(d>>8))
+			ahead = max(ahead, i+s.length-len(packed))
+		}
+		i += s.length
+	}
+	return packed, max(0, ahead+len(packed)-n)
+}
+
+// findMatches finds the longest matches at each position, with hash
+// chains over two byte prefixes
+func findMatches(data []byte) []match {
+	n := len(data)
+	matches := make([]match, n)
+	head := make([]int32, 1<<16)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+	for i := 0; i+1 < n; i++ {
+		key := int(data[i])<<8 | int(data[i+1])
+		limit := min(maxMatch, n-i)
+		m := &matches[i]
+		for j, depth := int(head[key]), 0; j >= 0 && i-j <= maxDist && depth < chainDepth; j, depth = int(prev[j]), depth+1 {
+			l := 2
+			for l < limit && data[j+l] == data[i+l] {
+				l++
+			}
+			d := i - j
+			if d <= shortDist && l > m.shortLen {
+				m.shortLen, m.shortDist = l, d
+			}
+			if l > m.longLen {
+				m.longLen, m.longDist = l, d
+			}
+			if l == limit && (m.shortLen == limit || d > shortDist) {
+				break
+			}
+		}
+		if m.longLen < longMin {
+			m.longLen = 0
+		}
+		prev[i] = head[key]
+		head[key] = int32(i)
+	}
+	return matches
+}
@@ -0,0 +1,173 @@
+package crunch
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/asm6502"
+)
+
+// The self-extracting PRG loads at $0801 and starts with SYS2061. Stage 1
+// banks out the ROMs, copies the decruncher to $0100 (below the stack)
+// and moves the compressed data up so that it ends margin bytes past the
+// unpacked program. The decruncher unpacks front to back, restores the
+// memory configuration and jumps to the start address, or runs the BASIC
+// program.
+
+const (
+	prgStart = 0x0801
+	sysAddr  = 0x080D // address of the code after the BASIC line
+	// decruncherAddr is where the decruncher runs; programs must load
+	// above the stack page
+	decruncherAddr = 0x0100
+	// ioStart ends the memory a PRG can be loaded into
+	ioStart = 0xD000
+
+	// zero page used by the decruncher
+	zpMatch = 0xF9
+	zpCount = 0xF8
+	zpLow   = 0xF7
+	zpHigh  = 0xF6
+)
+
+// ErrCannotPack is returned for programs that cannot be made self-extracting
+var ErrCannotPack = errors.New("cannot pack program")
+
+// SFX compresses a PRG into a self-extracting PRG. It starts the program
+// with a jump to start, or with RUN if start is 0.
+func SFX(prg []byte, start int) ([]byte, error) {
+	if len(prg) < 3 {
+		return nil, fmt.Errorf("%w: the file is too short", ErrCannotPack)
+	}
+	load := int(prg[0]) | int(prg[1])<<8
+	data := prg[2:]
+	end := load + len(data)
+	if load < 0x0200 || end > 0x10000 {
+		return nil, fmt.Errorf("%w: data at $%04X-$%04X is outside $0200-$FFFF", ErrCannotPack, load, end-1)
+	}
+
+	packed, margin := Crunch(data)
+	decruncher := buildDecruncher(load, end, start)
+	// Stage 1 is padded to its longest variant, the one moving the data
+	stage1Size := len(buildStage1(0, len(decruncher), 0, 0x100, 0x101))
+	src := sysAddr + stage1Size + len(decruncher)
+	if src+len(packed) > ioStart {
+		return nil, fmt.Errorf("%w: the packed program would reach $%04X (the I/O area starts at $%04X)",
+			ErrCannotPack, src+len(packed)-1, ioStart)
+	}
+	// The packed data is only moved if it is not far enough up already
+	dst := max(end+margin-len(packed), src)
+	if dst+len(packed) > 0x10000 {
+		return nil, fmt.Errorf("%w: %d bytes past $FFFF are needed to unpack in place", ErrCannotPack, dst+len(packed)-0x10000)
+	}
+	stage1 := buildStage1(sysAddr+stage1Size, len(decruncher), src, dst, len(packed))
+	stage1 = append(stage1, make([]byte, stage1Size-len(stage1))...)
+
+	out := []byte{prgStart & 0xFF, prgStart >> 8}
+	// 10 SYS2061
+	out = append(out, 0x0B, 0x08, 0x0A, 0x00, 0x9E, '2', '0', '6', '1', 0x00, 0x00, 0x00)
+	out = append(out, stage1...)
+	out = append(out, decruncher...)
+	return append(out, packed...), nil
+}
+
+// buildStage1 copies the decruncher to $0100 and size bytes of packed data
+// from src up to dst, then runs the decruncher. The decruncher's source
+// pointer is left at dst.
+func buildStage1(decruncherSrc, decruncherSize, src, dst, size int) []byte {
+	a := asm6502.New(sysAddr)
+	a.Op(0x78)                   // sei
+	a.Op(0xA9, 0x34, 0x85, 0x01) // lda #$34, sta $01: all RAM
+	a.Op(0xA2, 0x00)             // ldx #0
+	a.Label("copy")
+	a.Abs(0xBD, decruncherSrc)  // lda decruncher,x
+	a.Abs(0x9D, decruncherAddr) // sta $0100,x
+	a.Op(0xE8)                  // inx
+	a.Op(0xE0, byte(decruncherSize))
+	a.Branch(0xD0, "copy") // bne copy
+	if dst > src {
+		a.MoveBackward(src, dst, size)
+	}
+	a.Op(0xA9, byte(dst), 0x85, asm6502.ZPSrc, 0xA9, byte(dst>>8), 0x85, asm6502.ZPSrc+1)
+	a.Abs(0x4C, decruncherAddr) // jmp decruncher
+	return a.Bytes()
+}
+
+// buildDecruncher builds the decruncher at $0100. The source pointer is
+// set by stage 1; the data is unpacked to load.
+func buildDecruncher(load, end, start int) []byte {
+	const src, dst = asm6502.ZPSrc, asm6502.ZPDst
+	a := asm6502.New(decruncherAddr)
+	a.Op(0xA9, byte(load), 0x85, dst, 0xA9, byte(load>>8), 0x85, dst+1)
+	a.Label("token")
+	a.Op(0xA5, dst, 0xC9, byte(end)) // lda dst, cmp #<end
+	a.Branch(0xD0, "decode")         // bne decode
+	a.Op(0xA5, dst+1, 0xC9, byte(end>>8))
+	a.Branch(0xF0, "done") // beq done
+	a.Label("decode")
+	a.AbsLabel(0x20, "next") // jsr next
+	a.Op(0xC9, 0x80)         // cmp #$80
+	a.Branch(0xB0, "match")  // bcs match
+
+	// Literal run
+	a.Op(0xAA, 0xE8) // tax, inx
+	a.Label("literal")
+	a.AbsLabel(0x20, "next")      // jsr next
+	a.Op(0x91, dst)               // sta (dst),y
+	a.Op(0xE6, dst)               // inc dst
+	a.Branch(0xD0, "literalNext") // bne
+	a.Op(0xE6, dst+1)             // inc dst+1
+	a.Label("literalNext")
+	a.Op(0xCA)                // dex
+	a.Branch(0xD0, "literal") // bne literal
+	a.Branch(0xF0, "token")   // beq token
+
+	// Match: point zpMatch the distance back from dst
+	a.Label("match")
+	a.Op(0xAA)                                            // tax
+	a.AbsLabel(0x20, "next")                              // jsr next
+	a.Op(0x85, zpLow)                                     // sta low
+	a.Op(0x8A, 0xC9, 0xC0)                                // txa, cmp #$c0
+	a.Branch(0xB0, "long")                                // bcs long
+	a.Op(0x29, 0x3F, 0x18, 0x69, shortMin, 0x85, zpCount) // and #$3f, clc, adc #2, sta count
+	a.Op(0xA5, dst, 0x18, 0xE5, zpLow, 0x85, zpMatch)     // lda dst, clc, sbc low, sta match: dst-low-1
+	a.Op(0xA5, dst+1, 0xE9, 0x00, 0x85, zpMatch+1)        // lda dst+1, sbc #0, sta match+1
+	a.Branch(0xB0, "copy")                                // bcs copy (no borrow past $0000)
+	a.Label("long")
+	a.Op(0x29, 0x3F, 0x69, longMin-1, 0x85, zpCount)  // and #$3f, adc #2 (carry set), sta count
+	a.AbsLabel(0x20, "next")                          // jsr next
+	a.Op(0x85, zpHigh)                                // sta high
+	a.Op(0xA5, dst, 0x38, 0xE5, zpLow, 0x85, zpMatch) // lda dst, sec, sbc low, sta match
+	a.Op(0xA5, dst+1, 0xE5, zpHigh, 0x85, zpMatch+1)  // lda dst+1, sbc high, sta match+1
+	a.Label("copy")
+	a.Op(0xA0, 0x00) // ldy #0
+	a.Label("copyByte")
+	a.Op(0xB1, zpMatch, 0x91, dst, 0xC8)   // lda (match),y, sta (dst),y, iny
+	a.Op(0xC4, zpCount)                    // cpy count
+	a.Branch(0xD0, "copyByte")             // bne copyByte
+	a.Op(0x98, 0x18, 0x65, dst, 0x85, dst) // tya, clc, adc dst, sta dst
+	a.Branch(0x90, "token")                // bcc token
+	a.Op(0xE6, dst+1)                      // inc dst+1
+	a.Branch(0xB0, "token")                // bcs token
+
+	// next reads the byte at the source pointer and advances it
+	a.Label("next")
+	a.Op(0xA0, 0x00, 0xB1, src) // ldy #0, lda (src),y
+	a.Op(0xE6, src)             // inc src
+	a.Branch(0xD0, "nextDone")  // bne
+	a.Op(0xE6, src+1)           // inc src+1
+	a.Label("nextDone")
+	a.Op(0x60) // rts
+
+	a.Label("done")
+	a.Op(0xA9, 0x37, 0x85, 0x01, 0x58) // lda #$37, sta $01, cli
+	if start != 0 {
+		a.Abs(0x4C, start)
+	} else {
+		// Set the end of the BASIC program, reset the pointers and RUN
+		a.Op(0xA9, byte(end), 0x85, 0x2D, 0xA9, byte(end>>8), 0x85, 0x2E)
+		a.Abs(0x20, 0xA659) // jsr $a659
+		a.Abs(0x4C, 0xA7AE) // jmp $a7ae
+	}
+	return a.Bytes()
+}
@@ -0,0 +1,194 @@
+package diskimage
+
+import "math/bits"
+
+// Block interleaves used when allocating file and directory sectors, as
+// the drives' DOS does
+const (
+	d64Interleave = 10
+	d71Interleave = 6
+	d81Interleave = 1
+	dnpInterleave = 1
+	dirInterleave = 3
+)
+
+// bamEntry returns the free-count byte and the bitmap of a track in the BAM
+func (img *Image) bamEntry(track int) (count *byte, bitmap []byte) {
+	switch {
+	case img.Format == D81:
+		s := 1
+		if track > 40 {
+			s = 2
+		}
+		// A partition has a BAM of its own, on its first track
+		sec, _ := img.Sector(img.DirTrack(), s)
+		off := 0x10 + 6*((track-1)%40)
+		return &sec[off], sec[off+1 : off+6]
+	case img.Format == D71 && track > 35:
+		bam, _ := img.Sector(18, 0)
+		side2, _ := img.Sector(53, 0)
+		off := 3 * (track - 36)
+		return &bam[0xDD+track-36], side2[off : off+3]
+	case track > 35:
+		// 40-track images, in the SpeedDOS layout
+		bam, _ := img.Sector(18, 0)
+		off := 0xC0 + 4*(track-36)
+		return &bam[off], bam[off+1 : off+4]
+	}
+	bam, _ := img.Sector(18, 0)
+	off := 4 * track
+	return &bam[off], bam[off+1 : off+4]
+}
+
+// dnpBitmap returns the bitmap of a track in the BAM of a DNP image: 32
+// bytes per track from sector 1/2 on, the first sector bit the highest.
+// There are no free counts, and subdirectories share the BAM.
+func (img *Image) dnpBitmap(track int) []byte {
+	off := track * 32
+	sec, _ := img.Sector(1, 2+off/SectorSize)
+	return sec[off%SectorSize : off%SectorSize+32]
+}
+
+// isFree reports whether a sector is free in the BAM
+func (img *Image) isFree(track, sector int) bool {
+	if img.Format == DNP {
+		return img.dnpBitmap(track)[sector/8]&(0x80>>(sector%8)) != 0
+	}
+	_, bitmap := img.bamEntry(track)
+	return bitmap[sector/8]&(1<<(sector%8)) != 0
+}
+
+// setFree marks a sector free or allocated, keeping the free count in step
+func (img *Image) setFree(track, sector int, free bool) {
+	if img.isFree(track, sector) == free {
+		return
+	}
+	if img.Format == DNP {
+		bitmap := img.dnpBitmap(track)
+		bitmap[sector/8] ^= 0x80 >> (sector % 8)
+		return
+	}
+	count, bitmap := img.bamEntry(track)
+	if free {
+		bitmap[sector/8] |= 1 << (sector % 8)
+		*count++
+	} else {
+		bitmap[sector/8] &^= 1 << (sector % 8)
+		*count--
+	}
+}
+
+// reserved reports whether a track is not available for file data. The
+// system blocks of a DNP image are only marked used in its BAM.
+func (img *Image) reserved(track int) bool {
+	if img.Format == DNP {
+		return false
+	}
+	return track == img.DirTrack() || (img.Format == D71 && track == 53)
+}
+
+// FreeBlocks returns the number of free blocks outside the directory
+// track, as shown by the directory listing
+func (img *Image) FreeBlocks() int {
+	free := 0
+	for t := 1; t <= img.Tracks; t++ {
+		if img.Format == DNP {
+			for _, b := range img.dnpBitmap(t) {
+				free += bits.OnesCount8(b)
+			}
+			continue
+		}
+		if img.reserved(t) {
+			continue
+		}
+		count, _ := img.bamEntry(t)
+		free += int(*count)
+	}
+	return free
+}
+
+// interleave returns the sector interleave for file data
+func (img *Image) interleave() int {
+	switch img.Format {
+	case D71:
+		return d71Interleave
+	case D81:
+		return d81Interleave
+	case DNP:
+		return dnpInterleave
+	}
+	return d64Interleave
+}
+
+// allocTrackOrder returns the tracks in the order they are used for file
+// data: by distance from the directory track, as the DOS does
+func (img *Image) allocTrackOrder() []int {
+	order := make([]int, 0, img.Tracks)
+	if img.Format == DNP {
+		for t := 1; t <= img.Tracks; t++ {
+			order = append(order, t)
+		}
+		return order
+	}
+	dir := img.DirTrack()
+	for d := 1; d < img.Tracks; d++ {
+		for _, t := range []int{dir - d, dir + d} {
+			if t >= 1 && t <= img.Tracks && !img.reserved(t) {
+				order = append(order, t)
+			}
+		}
+	}
+	return order
+}
+
+// allocNear allocates a free sector on track, starting interleave sectors
+// after from (or at 0 if from is negative); ok is false if the track is full
+func (img *Image) allocNear(track, from, interleave int) (int, bool) {
+	n := img.SectorsPerTrack(track)
+	start := 0
+	if from >= 0 {
+		start = (from + interleave) % n
+	}
+	for i := 0; i < n; i++ {
+		s := (start + i) % n
+		if img.isFree(track, s) {
+			img.setFree(track, s, false)
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// allocChain allocates n sectors for a file, following the track order
+// and interleave. On failure nothing is allocated.
+func (img *Image) allocChain(n int) ([][2]int, error) {
+	if n > img.FreeBlocks() {
+		return nil, ErrDiskFull
+	}
+
+	chain := make([][2]int, 0, n)
+	order := img.allocTrackOrder()
+	ti, last := 0, -1
+	for len(chain) < n {
+		if ti >= len(order) {
+			img.freeChain(chain)
+			return nil, ErrDiskFull
+		}
+		s, ok := img.allocNear(order[ti], last, img.interleave())
+		if !ok {
+			ti++
+			last = -1
+			continue
+		}
+		chain = append(chain, [2]int{order[ti], s})
+		last = s
+	}
+	return chain, nil
+}
+
+// freeChain marks the sectors of a chain free
+func (img *Image) freeChain(chain [][2]int) {
+	for _, ts := range chain {
+		img.setFree(ts[0], ts[1], true)
+	}
+}
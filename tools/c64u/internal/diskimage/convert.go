@@ -0,0 +1,153 @@
+package diskimage
+
+import "fmt"
+
+// Convert copies the disk name, ID and directory of src into a new image
+// of another format, storing the files as that format's DOS would. The
+// directory keeps its order, duplicate names, DEL entries without data
+// (as used for directory art) and the closed and locked flags.
+//
+// losses describes everything that could not be carried over: REL and
+// GEOS structures, partitions and subdirectories, files that do not fit,
+// error info bytes and sectors allocated outside any file. src must be
+// opened at its root directory.
+func Convert(src *Image, to Format) (dst *Image, losses []string, err error) {
+	if !src.IsRoot() {
+		return nil, nil, fmt.Errorf("%w: convert the whole image", ErrUnsupported)
+	}
+	if to == DNP {
+		// Room for everything plus the BAM and directory on track 1
+		dst, err = NewDNP(min(src.totalSectors()/256+2, 255), src.Name(), src.ID())
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		dst = New(to, src.Name(), src.ID())
+	}
+
+	type entry struct {
+		File
+		raw []byte
+	}
+	var entries []entry
+	err = src.walkDir(func(slot dirSlot, e []byte) bool {
+		if e[2] != 0 {
+			entries = append(entries, entry{
+				File: File{
+					Name:   trimName(e[5:21]),
+					Type:   FileType(e[2] & 0x07),
+					Closed: e[2]&0x80 != 0,
+					Locked: e[2]&0x40 != 0,
+					Track:  int(e[3]),
+					Sector: int(e[4]),
+					Blocks: int(e[30]) | int(e[31])<<8,
+				},
+				raw: append([]byte(nil), e...),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, e := range entries {
+		name := HostName(e.File)
+		switch {
+		case e.IsDir():
+			kind := "partition"
+			if e.Type == DIR {
+				kind = "subdirectory"
+			}
+			losses = append(losses, fmt.Sprintf("%s: %s not converted", name, kind))
+			continue
+		case e.Type == REL:
+			losses = append(losses, fmt.Sprintf("%s: REL file not converted", name))
+			continue
+		case e.raw[0x15] != 0 && e.raw[0x18] != 0:
+			// GEOS files keep an info block link and the GEOS file type
+			losses = append(losses, fmt.Sprintf("%s: GEOS info block and structure not converted", name))
+		}
+
+		var data []byte
+		if e.Type != DEL || e.Track != 0 {
+			if data, err = src.ReadFile(e.File); err != nil {
+				losses = append(losses, fmt.Sprintf("%s: unreadable (%v)", name, err))
+				continue
+			}
+		}
+		if err := dst.appendEntry(e.File, e.raw[2], data); err != nil {
+			losses = append(losses, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	if n := src.errorSectors(); n > 0 {
+		losses = append(losses, fmt.Sprintf("error info of %d sector(s) dropped", n))
+	}
+	if n := src.hiddenSectors(); n > 0 {
+		losses = append(losses, fmt.Sprintf("%d allocated block(s) outside any file not converted (e.g. loader data)", n))
+	}
+	return dst, losses, nil
+}
+
+// appendEntry adds a directory entry with the given type byte (including
+// the closed and locked flags) after the existing ones, without checking
+// for duplicate names. DEL entries without data keep their block count.
+func (img *Image) appendEntry(f File, typ byte, data []byte) error {
+	var chain [][2]int
+	blocks := f.Blocks
+	if f.Type != DEL || f.Track != 0 {
+		blocks = max((len(data)+253)/254, 1)
+		var err error
+		if chain, err = img.allocChain(blocks); err != nil {
+			return fmt.Errorf("does not fit (%d blocks)", blocks)
+		}
+		img.writeChain(chain, data)
+	}
+
+	slot, err := img.freeSlot()
+	if err != nil {
+		img.freeChain(chain)
+		return err
+	}
+	e := img.entry(slot)
+	for i := 2; i < 32; i++ {
+		e[i] = 0
+	}
+	e[2] = typ
+	if len(chain) > 0 {
+		e[3], e[4] = byte(chain[0][0]), byte(chain[0][1])
+	}
+	copy(e[5:21], padName(f.Name))
+	e[30], e[31] = byte(blocks), byte(blocks>>8)
+	return nil
+}
+
+// errorSectors counts the sectors whose error info byte reports an error
+func (img *Image) errorSectors() int {
+	n := 0
+	for _, b := range img.errs {
+		if b > 1 {
+			n++
+		}
+	}
+	return n
+}
+
+// hiddenSectors counts the sectors allocated in the BAM that belong to no
+// file or directory structure
+func (img *Image) hiddenSectors() int {
+	use := img.Usage()
+	n := 0
+	for t := 1; t <= img.Tracks; t++ {
+		if img.reserved(t) {
+			continue
+		}
+		for s := 0; s < img.SectorsPerTrack(t); s++ {
+			if _, used := use[[2]int{t, s}]; !used && !img.isFree(t, s) {
+				n++
+			}
+		}
+	}
+	return n
+}
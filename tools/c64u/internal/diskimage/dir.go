@@ -0,0 +1,419 @@
+package diskimage
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// FileType is the type of a directory entry
+type FileType byte
+
+// CBM DOS file types
+const (
+	DEL FileType = iota
+	SEQ
+	PRG
+	USR
+	REL
+	// CBM is a D81 partition
+	CBM
+	// DIR is a DNP subdirectory
+	DIR
+)
+
+// String returns the three-letter type name
+func (t FileType) String() string {
+	switch t {
+	case DEL:
+		return "del"
+	case SEQ:
+		return "seq"
+	case PRG:
+		return "prg"
+	case USR:
+		return "usr"
+	case REL:
+		return "rel"
+	case CBM:
+		return "cbm"
+	case DIR:
+		return "dir"
+	}
+	return fmt.Sprintf("?%d", byte(t))
+}
+
+// ParseFileType parses a three-letter type name
+func ParseFileType(s string) (FileType, bool) {
+	for t := DEL; t <= DIR; t++ {
+		if t.String() == s {
+			return t, true
+		}
+	}
+	return PRG, false
+}
+
+// File is a directory entry
+type File struct {
+	Name   []byte
+	Type   FileType
+	Closed bool
+	Locked bool
+	Track  int
+	Sector int
+	Blocks int
+
+	// slot is where the entry is stored in the directory
+	slot dirSlot
+}
+
+// IsDir reports whether the entry is a D81 partition or DNP subdirectory
+// rather than a file
+func (f File) IsDir() bool {
+	return f.Type == CBM || f.Type == DIR
+}
+
+// dirSlot locates a 32-byte directory entry
+type dirSlot struct {
+	track, sector, index int
+}
+
+// entry returns the raw bytes of a directory entry
+func (img *Image) entry(slot dirSlot) []byte {
+	sec, _ := img.Sector(slot.track, slot.sector)
+	return sec[slot.index*32 : (slot.index+1)*32]
+}
+
+// walkDir calls fn for every directory slot, following the directory
+// chain; fn returns false to stop
+func (img *Image) walkDir(fn func(slot dirSlot, e []byte) bool) error {
+	track, sector := img.dirStart()
+	seen := make(map[[2]int]bool)
+	for track != 0 {
+		if seen[[2]int{track, sector}] {
+			return fmt.Errorf("%w: directory loops at %d/%d", ErrBadChain, track, sector)
+		}
+		seen[[2]int{track, sector}] = true
+
+		sec, err := img.Sector(track, sector)
+		if err != nil {
+			return fmt.Errorf("%w: directory", err)
+		}
+		for i := 0; i < 8; i++ {
+			slot := dirSlot{track, sector, i}
+			if !fn(slot, sec[i*32:(i+1)*32]) {
+				return nil
+			}
+		}
+		track, sector = int(sec[0]), int(sec[1])
+	}
+	return nil
+}
+
+// Files returns the directory entries in directory order
+func (img *Image) Files() ([]File, error) {
+	var files []File
+	err := img.walkDir(func(slot dirSlot, e []byte) bool {
+		if e[2] == 0 {
+			return true
+		}
+		files = append(files, File{
+			Name:   trimName(e[5:21]),
+			Type:   FileType(e[2] & 0x07),
+			Closed: e[2]&0x80 != 0,
+			Locked: e[2]&0x40 != 0,
+			Track:  int(e[3]),
+			Sector: int(e[4]),
+			Blocks: int(e[30]) | int(e[31])<<8,
+			slot:   slot,
+		})
+		return true
+	})
+	return files, err
+}
+
+// Find returns the entry named name
+func (img *Image) Find(name []byte) (File, error) {
+	files, err := img.Files()
+	if err != nil {
+		return File{}, err
+	}
+	for _, f := range files {
+		if bytes.Equal(f.Name, name) {
+			return f, nil
+		}
+	}
+	return File{}, ErrNotFound
+}
+
+// chain returns the sectors of the chain starting at track/sector and the
+// number of bytes used in the last one
+func (img *Image) chain(track, sector int) ([][2]int, int, error) {
+	var sectors [][2]int
+	seen := make(map[[2]int]bool)
+	for {
+		if seen[[2]int{track, sector}] {
+			return nil, 0, fmt.Errorf("%w: loop at %d/%d", ErrBadChain, track, sector)
+		}
+		seen[[2]int{track, sector}] = true
+
+		sec, err := img.Sector(track, sector)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", ErrBadChain, err)
+		}
+		sectors = append(sectors, [2]int{track, sector})
+		if sec[0] == 0 {
+			used := int(sec[1]) - 1
+			if used < 0 {
+				used = 0
+			}
+			return sectors, used, nil
+		}
+		track, sector = int(sec[0]), int(sec[1])
+	}
+}
+
+// ReadFile returns the contents of a file
+func (img *Image) ReadFile(f File) ([]byte, error) {
+	if f.Type == DEL && f.Track == 0 {
+		return nil, nil
+	}
+	if f.IsDir() {
+		return nil, fmt.Errorf("%w: %s is a %s entry", ErrUnsupported, f.Name, f.Type)
+	}
+	sectors, used, err := img.chain(f.Track, f.Sector)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+
+	var out []byte
+	for i, ts := range sectors {
+		sec, _ := img.Sector(ts[0], ts[1])
+		if i == len(sectors)-1 {
+			out = append(out, sec[2:2+used]...)
+		} else {
+			out = append(out, sec[2:]...)
+		}
+	}
+	return out, nil
+}
+
+// WriteFile stores data as a file, replacing an existing file of the same
+// name. The old file is only removed once the new one fits.
+func (img *Image) WriteFile(name []byte, typ FileType, data []byte) error {
+	if len(name) == 0 || len(name) > 16 {
+		return fmt.Errorf("file name must be 1 to 16 characters")
+	}
+	if typ == REL || typ == CBM || typ == DIR {
+		return fmt.Errorf("%w: cannot write %s files", ErrUnsupported, typ)
+	}
+
+	old, err := img.Find(name)
+	replacing := err == nil
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	if replacing && old.Locked {
+		return fmt.Errorf("%s is locked", name)
+	}
+	if replacing && old.IsDir() {
+		return fmt.Errorf("%w: %s is a %s entry", ErrExists, name, old.Type)
+	}
+
+	blocks := (len(data) + 253) / 254
+	if blocks == 0 {
+		blocks = 1
+	}
+
+	// Free the old chain first so its blocks can be reused, restoring it if
+	// the new file does not fit
+	var oldChain [][2]int
+	if replacing && old.Track != 0 {
+		if oldChain, _, err = img.chain(old.Track, old.Sector); err == nil {
+			img.freeChain(oldChain)
+		}
+	}
+	restore := func() {
+		for _, ts := range oldChain {
+			img.setFree(ts[0], ts[1], false)
+		}
+	}
+
+	chain, err := img.allocChain(blocks)
+	if err != nil {
+		restore()
+		return err
+	}
+
+	slot := old.slot
+	if !replacing {
+		if slot, err = img.freeSlot(); err != nil {
+			img.freeChain(chain)
+			return err
+		}
+	}
+
+	img.writeChain(chain, data)
+
+	e := img.entry(slot)
+	e[2] = 0x80 | byte(typ)
+	e[3], e[4] = byte(chain[0][0]), byte(chain[0][1])
+	copy(e[5:21], padName(name))
+	for i := 21; i < 30; i++ {
+		e[i] = 0
+	}
+	e[30], e[31] = byte(blocks), byte(blocks>>8)
+	return nil
+}
+
+// writeChain stores data in the allocated sectors of chain, linking them
+func (img *Image) writeChain(chain [][2]int, data []byte) {
+	for i, ts := range chain {
+		sec, _ := img.Sector(ts[0], ts[1])
+		for j := range sec {
+			sec[j] = 0
+		}
+		start := i * 254
+		end := start + 254
+		if end > len(data) {
+			end = len(data)
+		}
+		n := copy(sec[2:], data[start:end])
+		if i+1 < len(chain) {
+			sec[0], sec[1] = byte(chain[i+1][0]), byte(chain[i+1][1])
+		} else {
+			sec[0], sec[1] = 0, byte(n+1)
+		}
+	}
+}
+
+// freeSlot returns an unused directory entry, extending the directory
+// with a new sector on the directory track if needed
+func (img *Image) freeSlot() (dirSlot, error) {
+	var found, last dirSlot
+	ok := false
+	err := img.walkDir(func(slot dirSlot, e []byte) bool {
+		last = slot
+		if e[2] == 0 {
+			found, ok = slot, true
+			return false
+		}
+		return true
+	})
+	if err != nil || ok {
+		return found, err
+	}
+
+	track, s, err := img.allocDirSector(last)
+	if err != nil {
+		return dirSlot{}, err
+	}
+
+	prev, _ := img.Sector(last.track, last.sector)
+	prev[0], prev[1] = byte(track), byte(s)
+	sec, _ := img.Sector(track, s)
+	for i := range sec {
+		sec[i] = 0
+	}
+	sec[1] = 0xFF
+	return dirSlot{track, s, 0}, nil
+}
+
+// allocDirSector allocates a sector to extend the directory ending at
+// last. DNP directories may use any free block; their size is kept in the
+// parent's entry.
+func (img *Image) allocDirSector(last dirSlot) (int, int, error) {
+	if img.Format != DNP {
+		interleave := dirInterleave
+		if img.Format == D81 {
+			interleave = 1
+		}
+		s, ok := img.allocNear(img.DirTrack(), last.sector, interleave)
+		if !ok {
+			return 0, 0, ErrDirFull
+		}
+		return img.DirTrack(), s, nil
+	}
+
+	track, s, ok := last.track, 0, false
+	if s, ok = img.allocNear(track, last.sector, dnpInterleave); !ok {
+		chain, err := img.allocChain(1)
+		if err != nil {
+			return 0, 0, err
+		}
+		track, s = chain[0][0], chain[0][1]
+	}
+	if e := img.parentEntry(); e != nil {
+		blocks := (int(e[30]) | int(e[31])<<8) + 1
+		e[30], e[31] = byte(blocks), byte(blocks>>8)
+	}
+	return track, s, nil
+}
+
+// Delete removes a file and frees its blocks
+func (img *Image) Delete(name []byte) error {
+	f, err := img.Find(name)
+	if err != nil {
+		return err
+	}
+	if f.Locked {
+		return fmt.Errorf("%s is locked", name)
+	}
+	if f.IsDir() {
+		return fmt.Errorf("%w: %s is a %s entry", ErrUnsupported, name, f.Type)
+	}
+	if f.Track != 0 {
+		if sectors, _, err := img.chain(f.Track, f.Sector); err == nil {
+			img.freeChain(sectors)
+		}
+	}
+	img.entry(f.slot)[2] = 0
+	return nil
+}
+
+// Rename changes the name of a file; an existing file named newName is
+// replaced
+func (img *Image) Rename(oldName, newName []byte) error {
+	if len(newName) == 0 || len(newName) > 16 {
+		return fmt.Errorf("file name must be 1 to 16 characters")
+	}
+	f, err := img.Find(oldName)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(oldName, newName) {
+		return nil
+	}
+	if _, err := img.Find(newName); err == nil {
+		if err := img.Delete(newName); err != nil {
+			return err
+		}
+	}
+	copy(img.entry(f.slot)[5:21], padName(newName))
+	return nil
+}
+
+// SetType changes the type of a file
+func (img *Image) SetType(name []byte, typ FileType) error {
+	f, err := img.Find(name)
+	if err != nil {
+		return err
+	}
+	e := img.entry(f.slot)
+	e[2] = e[2]&0xF8 | byte(typ)
+	return nil
+}
+
+// SetLocked sets or clears the write protection of a file
+func (img *Image) SetLocked(name []byte, locked bool) error {
+	f, err := img.Find(name)
+	if err != nil {
+		return err
+	}
+	e := img.entry(f.slot)
+	if locked {
+		e[2] |= 0x40
+	} else {
+		e[2] &^= 0x40
+	}
+	return nil
+}
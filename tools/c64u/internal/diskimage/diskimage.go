@@ -0,0 +1,444 @@
+package diskimage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SectorSize is the size of a disk block
+const SectorSize = 256
+
+// Format is a disk image format
+type Format int
+
+// Supported image formats
+const (
+	D64 Format = iota
+	D71
+	D81
+	// DNP is a CMD native partition image
+	DNP
+)
+
+// String returns the format's file extension without the dot
+func (f Format) String() string {
+	switch f {
+	case D71:
+		return "d71"
+	case D81:
+		return "d81"
+	case DNP:
+		return "dnp"
+	}
+	return "d64"
+}
+
+// ParseFormat parses a format name (d64, d71, d81, dnp)
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "d64":
+		return D64, nil
+	case "d71":
+		return D71, nil
+	case "d81":
+		return D81, nil
+	case "dnp":
+		return DNP, nil
+	}
+	return D64, fmt.Errorf("unknown image format '%s' (use d64, d71, d81 or dnp)", s)
+}
+
+// Errors returned by image operations
+var (
+	ErrDiskFull    = errors.New("disk full")
+	ErrDirFull     = errors.New("directory full")
+	ErrNotFound    = errors.New("file not found")
+	ErrExists      = errors.New("file exists")
+	ErrBadSector   = errors.New("illegal track or sector")
+	ErrBadChain    = errors.New("corrupt sector chain")
+	ErrUnsupported = errors.New("unsupported image")
+	ErrNotDir      = errors.New("not a partition or subdirectory")
+)
+
+// Image is a D64, D71, D81 or DNP disk image held in memory
+type Image struct {
+	Format Format
+	Tracks int
+
+	data []byte
+	// errs holds the error info bytes (one per sector), if the image has them
+	errs []byte
+	// dir is the header block of the D81 partition or DNP subdirectory the
+	// image is opened at; zero for the root directory
+	dir [2]int
+}
+
+// imageSize describes a recognized image file size
+type imageSize struct {
+	format Format
+	tracks int
+	errors bool
+}
+
+// sizes maps image file sizes to their layout
+var sizes = map[int]imageSize{
+	174848: {D64, 35, false},
+	175531: {D64, 35, true},
+	196608: {D64, 40, false},
+	197376: {D64, 40, true},
+	349696: {D71, 70, false},
+	351062: {D71, 70, true},
+	819200: {D81, 80, false},
+	822400: {D81, 80, true},
+}
+
+// Open reads a disk image file
+func Open(path string) (*Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	img, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return img, nil
+}
+
+// dnpTrackSize is the size of a track of a DNP image
+const dnpTrackSize = 256 * SectorSize
+
+// Parse interprets image data, recognizing the format by its size
+func Parse(data []byte) (*Image, error) {
+	size, ok := sizes[len(data)]
+	if !ok && len(data)%dnpTrackSize == 0 && len(data) > 0 && len(data) <= 255*dnpTrackSize {
+		size, ok = imageSize{DNP, len(data) / dnpTrackSize, false}, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: size %d is not a D64, D71, D81 or DNP image", ErrUnsupported, len(data))
+	}
+
+	img := &Image{Format: size.format, Tracks: size.tracks}
+	sectors := img.totalSectors()
+	img.data = append([]byte(nil), data[:sectors*SectorSize]...)
+	if size.errors {
+		img.errs = append([]byte(nil), data[sectors*SectorSize:]...)
+	}
+	return img, nil
+}
+
+// New creates a formatted, empty image. name and id are PETSCII.
+func New(format Format, name, id []byte) *Image {
+	img := &Image{Format: format}
+	switch format {
+	case D71:
+		img.Tracks = 70
+	case D81:
+		img.Tracks = 80
+	case DNP:
+		img.Tracks = 255
+	default:
+		img.Tracks = 35
+	}
+	img.data = make([]byte, img.totalSectors()*SectorSize)
+	img.format(name, id)
+	return img
+}
+
+// NewDNP creates a formatted, empty DNP image of 1 to 255 tracks (64 KiB
+// each)
+func NewDNP(tracks int, name, id []byte) (*Image, error) {
+	if tracks < 1 || tracks > 255 {
+		return nil, fmt.Errorf("a DNP image has 1 to 255 tracks, not %d", tracks)
+	}
+	img := &Image{Format: DNP, Tracks: tracks}
+	img.data = make([]byte, tracks*dnpTrackSize)
+	img.format(name, id)
+	return img, nil
+}
+
+// Bytes returns the image file contents
+func (img *Image) Bytes() []byte {
+	out := append([]byte(nil), img.data...)
+	return append(out, img.errs...)
+}
+
+// Save writes the image to path, replacing the file atomically
+func (img *Image) Save(path string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, img.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SectorsPerTrack returns the number of sectors on a track
+func (img *Image) SectorsPerTrack(track int) int {
+	switch img.Format {
+	case D81:
+		return 40
+	case DNP:
+		return 256
+	}
+	if img.Format == D71 && track > 35 {
+		track -= 35
+	}
+	switch {
+	case track <= 17:
+		return 21
+	case track <= 24:
+		return 19
+	case track <= 30:
+		return 18
+	}
+	return 17
+}
+
+// totalSectors returns the number of sectors in the image
+func (img *Image) totalSectors() int {
+	n := 0
+	for t := 1; t <= img.Tracks; t++ {
+		n += img.SectorsPerTrack(t)
+	}
+	return n
+}
+
+// index returns the linear block number of a track/sector
+func (img *Image) index(track, sector int) (int, error) {
+	if track < 1 || track > img.Tracks || sector < 0 || sector >= img.SectorsPerTrack(track) {
+		return 0, fmt.Errorf("%w %d/%d", ErrBadSector, track, sector)
+	}
+	if img.Format == DNP {
+		return (track-1)*256 + sector, nil
+	}
+	n := sector
+	for t := 1; t < track; t++ {
+		n += img.SectorsPerTrack(t)
+	}
+	return n, nil
+}
+
+// Sector returns the contents of a sector; changes to the slice change
+// the image
+func (img *Image) Sector(track, sector int) ([]byte, error) {
+	i, err := img.index(track, sector)
+	if err != nil {
+		return nil, err
+	}
+	return img.data[i*SectorSize : (i+1)*SectorSize], nil
+}
+
+// ErrorByte returns the error info byte of a sector (1 means no error);
+// ok is false if the image has no error info
+func (img *Image) ErrorByte(track, sector int) (b byte, ok bool) {
+	if img.errs == nil {
+		return 0, false
+	}
+	i, err := img.index(track, sector)
+	if err != nil {
+		return 0, false
+	}
+	return img.errs[i], true
+}
+
+// IsRoot reports whether the image is opened at its root directory rather
+// than a partition or subdirectory
+func (img *Image) IsRoot() bool {
+	return img.dir[0] == 0
+}
+
+// headerBlock returns the track and sector of the directory header
+func (img *Image) headerBlock() (int, int) {
+	if !img.IsRoot() {
+		return img.dir[0], img.dir[1]
+	}
+	switch img.Format {
+	case D81:
+		return 40, 0
+	case DNP:
+		return 1, 1
+	}
+	return 18, 0
+}
+
+// DirTrack returns the directory track (for a D81 partition, its first
+// track; for a DNP image, the track of the directory header)
+func (img *Image) DirTrack() int {
+	track, _ := img.headerBlock()
+	return track
+}
+
+// headerSector returns the sector holding the disk name and ID, and the
+// offsets of both in it
+func (img *Image) headerSector() (sec []byte, nameOff, idOff int) {
+	sec, _ = img.Sector(img.headerBlock())
+	if img.Format == D81 || img.Format == DNP {
+		return sec, 0x04, 0x16
+	}
+	return sec, 0x90, 0xA2
+}
+
+// Name returns the disk name (PETSCII, without padding)
+func (img *Image) Name() []byte {
+	sec, off, _ := img.headerSector()
+	return trimName(sec[off : off+16])
+}
+
+// ID returns the two-character disk ID (PETSCII)
+func (img *Image) ID() []byte {
+	sec, _, off := img.headerSector()
+	return append([]byte(nil), sec[off:off+2]...)
+}
+
+// SetHeader changes the disk name and, if id is not nil, the disk ID
+func (img *Image) SetHeader(name, id []byte) error {
+	if len(name) > 16 {
+		return fmt.Errorf("disk name longer than 16 characters")
+	}
+	if id != nil && len(id) != 2 {
+		return fmt.Errorf("disk ID must be 2 characters")
+	}
+	sec, nameOff, idOff := img.headerSector()
+	copy(sec[nameOff:nameOff+16], padName(name))
+	if id != nil {
+		copy(sec[idOff:idOff+2], id)
+		switch {
+		case img.Format == D81:
+			// The BAM sectors carry a copy of the ID
+			for s := 1; s <= 2; s++ {
+				bam, _ := img.Sector(img.DirTrack(), s)
+				copy(bam[4:6], id)
+			}
+		case img.Format == DNP && img.IsRoot():
+			bam, _ := img.Sector(1, 2)
+			copy(bam[4:6], id)
+		}
+	}
+	return nil
+}
+
+// format writes an empty directory and BAM
+func (img *Image) format(name, id []byte) {
+	if len(id) != 2 {
+		id = []byte("01")
+	}
+
+	switch img.Format {
+	case D81:
+		img.writeD81Header(40, name, id)
+	case DNP:
+		header, _ := img.Sector(1, 1)
+		writeDNPHeader(header, name, id, [2]int{1, 34})
+		header[0x20], header[0x21] = 1, 1
+		bam, _ := img.Sector(1, 2)
+		bam[2], bam[3] = 'H', 0xB7
+		copy(bam[4:6], id)
+		bam[6] = 0xC0
+		bam[8] = byte(img.Tracks)
+	default:
+		bam, _ := img.Sector(18, 0)
+		bam[0], bam[1], bam[2] = 18, 1, 'A'
+		if img.Format == D71 {
+			bam[3] = 0x80
+		}
+		copy(bam[0x90:0xA0], padName(name))
+		bam[0xA0], bam[0xA1] = 0xA0, 0xA0
+		copy(bam[0xA2:0xA4], id)
+		bam[0xA4] = 0xA0
+		bam[0xA5], bam[0xA6] = '2', 'A'
+		for i := 0xA7; i <= 0xAA; i++ {
+			bam[i] = 0xA0
+		}
+	}
+
+	for t := 1; t <= img.Tracks; t++ {
+		for s := 0; s < img.SectorsPerTrack(t); s++ {
+			img.setFree(t, s, true)
+		}
+	}
+
+	dirTrack, dirSector := img.dirStart()
+	dir, _ := img.Sector(dirTrack, dirSector)
+	dir[0], dir[1] = 0, 0xFF
+
+	// Reserve the header, BAM and first directory sectors (and the boot
+	// sector of a DNP image)
+	for s := 0; s <= dirSector; s++ {
+		img.setFree(dirTrack, s, false)
+	}
+	if img.Format == D71 {
+		for s := 0; s < img.SectorsPerTrack(53); s++ {
+			img.setFree(53, s, false)
+		}
+	}
+}
+
+// writeD81Header writes the header and BAM sectors of a D81 root
+// directory or partition starting at track; the BAM marks all tracks used
+func (img *Image) writeD81Header(track int, name, id []byte) {
+	header, _ := img.Sector(track, 0)
+	header[0], header[1], header[2] = byte(track), 3, 'D'
+	copy(header[0x04:0x14], padName(name))
+	header[0x14], header[0x15] = 0xA0, 0xA0
+	copy(header[0x16:0x18], id)
+	header[0x18] = 0xA0
+	header[0x19], header[0x1A] = '3', 'D'
+	header[0x1B], header[0x1C] = 0xA0, 0xA0
+	for s := 1; s <= 2; s++ {
+		bam, _ := img.Sector(track, s)
+		if s == 1 {
+			bam[0], bam[1] = byte(track), 2
+		} else {
+			bam[0], bam[1] = 0, 0xFF
+		}
+		bam[2], bam[3] = 'D', 0xBB
+		copy(bam[4:6], id)
+		bam[6] = 0xC0
+	}
+}
+
+// writeDNPHeader fills a DNP directory header block; dir is the first
+// directory block
+func writeDNPHeader(header []byte, name, id []byte, dir [2]int) {
+	header[0], header[1], header[2] = byte(dir[0]), byte(dir[1]), 'H'
+	copy(header[0x04:0x14], padName(name))
+	header[0x14], header[0x15] = 0xA0, 0xA0
+	copy(header[0x16:0x18], id)
+	header[0x18] = 0xA0
+	header[0x19], header[0x1A] = '1', 'H'
+	header[0x1B], header[0x1C] = 0xA0, 0xA0
+}
+
+// dirStart returns the first directory sector
+func (img *Image) dirStart() (int, int) {
+	switch img.Format {
+	case D81:
+		return img.DirTrack(), 3
+	case DNP:
+		header, _ := img.Sector(img.headerBlock())
+		return int(header[0]), int(header[1])
+	}
+	return img.DirTrack(), 1
+}
+
+// padName pads a PETSCII name to 16 bytes with shifted spaces
+func padName(name []byte) []byte {
+	out := make([]byte, 16)
+	n := copy(out, name)
+	for i := n; i < 16; i++ {
+		out[i] = 0xA0
+	}
+	return out
+}
+
+// trimName removes the shifted-space padding of a name
+func trimName(name []byte) []byte {
+	end := len(name)
+	for end > 0 && name[end-1] == 0xA0 {
+		end--
+	}
+	return append([]byte(nil), name[:end]...)
+}
@@ -0,0 +1,179 @@
+package diskimage
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// HostName returns a file name for a directory entry on the host: the
+// name in lowercase (unshifted PETSCII letters) with the type as
+// extension, e.g. "giana sisters.prg". Shifted letters become uppercase;
+// characters that cannot appear in host names are written as %XX.
+func HostName(f File) string {
+	var b strings.Builder
+	for _, c := range f.Name {
+		switch {
+		case c >= 0x41 && c <= 0x5A:
+			b.WriteByte(c - 0x41 + 'a')
+		case c >= 0xC1 && c <= 0xDA:
+			b.WriteByte(c - 0xC1 + 'A')
+		case c >= 0x20 && c <= 0x40 && c != '/' && c != '%',
+			c == '[' || c == ']':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String() + "." + f.Type.String()
+}
+
+// ParseHostName converts a host file name back to a PETSCII name and file
+// type. A name without a known type extension is a PRG.
+func ParseHostName(name string) ([]byte, FileType, error) {
+	out, typ, err := ParseLongHostName(name)
+	if err == nil && len(out) > 16 {
+		return nil, typ, fmt.Errorf("'%s': file names must be 1 to 16 characters", name)
+	}
+	return out, typ, err
+}
+
+// ParseLongHostName is ParseHostName without the 16 character limit, for
+// names a Shortener fits into a directory entry
+func ParseLongHostName(name string) ([]byte, FileType, error) {
+	typ := PRG
+	if ext := path.Ext(name); ext != "" {
+		if t, ok := ParseFileType(strings.ToLower(ext[1:])); ok {
+			typ = t
+			name = strings.TrimSuffix(name, ext)
+		}
+	}
+
+	var out []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '%' && i+2 < len(name):
+			v, err := strconv.ParseUint(name[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, typ, fmt.Errorf("invalid escape in '%s'", name)
+			}
+			out = append(out, byte(v))
+			i += 2
+		case c >= 'a' && c <= 'z':
+			out = append(out, c-'a'+0x41)
+		case c >= 'A' && c <= 'Z':
+			out = append(out, c-'A'+0xC1)
+		case c >= 0x20 && c <= 0x40, c == '[' || c == ']':
+			out = append(out, c)
+		default:
+			return nil, typ, fmt.Errorf("character %q in '%s' has no PETSCII equivalent", c, name)
+		}
+	}
+	if len(out) == 0 {
+		return nil, typ, fmt.Errorf("'%s': file names must be 1 to 16 characters", name)
+	}
+	return out, typ, nil
+}
+
+// Ways to fit names longer than 16 characters into a directory entry
+const (
+	// LongTruncate keeps the first 16 characters
+	LongTruncate = "truncate"
+	// LongSqueeze drops vowels inside words, then spaces, from the end of
+	// the name before truncating
+	LongSqueeze = "squeeze"
+	// LongError refuses long names
+	LongError = "error"
+)
+
+// DefaultUniqueSuffix tells apart names that shortening made equal; %d is
+// the number, counting from 2
+const DefaultUniqueSuffix = " %d"
+
+// ErrNameTooLong is returned by Shortener.Fit for long names with
+// LongError
+var ErrNameTooLong = errors.New("name longer than 16 characters")
+
+// Shortener fits names into the 16 characters of a directory entry and
+// keeps them apart from the names it has already handed out or reserved
+type Shortener struct {
+	mode   string
+	suffix string
+	used   map[string]bool
+}
+
+// NewShortener returns a Shortener for one directory. mode is LongTruncate,
+// LongSqueeze or LongError (empty for LongTruncate); suffix contains %d
+// once (empty for DefaultUniqueSuffix).
+func NewShortener(mode, suffix string) (*Shortener, error) {
+	switch mode {
+	case "":
+		mode = LongTruncate
+	case LongTruncate, LongSqueeze, LongError:
+	default:
+		return nil, fmt.Errorf("unknown long name handling '%s' (truncate, squeeze or error)", mode)
+	}
+	if suffix == "" {
+		suffix = DefaultUniqueSuffix
+	}
+	if strings.Count(suffix, "%d") != 1 || strings.Count(suffix, "%") != 1 {
+		return nil, fmt.Errorf("unique suffix '%s' must contain %%d once", suffix)
+	}
+	if out, _, err := ParseLongHostName(fmt.Sprintf(suffix, 99)); err != nil || len(out) > 8 {
+		return nil, fmt.Errorf("unique suffix '%s' must be up to 6 PETSCII characters besides %%d", suffix)
+	}
+	return &Shortener{mode: mode, suffix: suffix, used: make(map[string]bool)}, nil
+}
+
+// Reserve marks a name as taken, e.g. by a file already in the directory
+func (s *Shortener) Reserve(name []byte) {
+	s.used[string(name)] = true
+}
+
+// Fit returns name if it fits and is not taken. Longer names are
+// shortened, and taken ones get the unique suffix in their last
+// characters. The result is reserved.
+func (s *Shortener) Fit(name []byte) ([]byte, error) {
+	short := name
+	if len(short) > 16 {
+		switch s.mode {
+		case LongError:
+			return nil, ErrNameTooLong
+		case LongSqueeze:
+			short = squeeze(short)
+		}
+		short = short[:min(len(short), 16)]
+	}
+	candidate := short
+	for n := 2; s.used[string(candidate)]; n++ {
+		// The suffix is ASCII digits and punctuation, the same in PETSCII
+		suffix, _, _ := ParseLongHostName(fmt.Sprintf(s.suffix, n))
+		candidate = append(append([]byte(nil), short[:min(len(short), 16-len(suffix))]...), suffix...)
+	}
+	s.used[string(candidate)] = true
+	return candidate, nil
+}
+
+// squeeze removes vowels that do not start a word, then spaces, from the
+// end of a name until it fits 16 characters
+func squeeze(name []byte) []byte {
+	out := append([]byte(nil), name...)
+	isVowel := func(c byte) bool {
+		// Unshifted or shifted
+		return strings.IndexByte("AEIOU", c&0x7F) >= 0
+	}
+	for i := len(out) - 1; i > 0 && len(out) > 16; i-- {
+		if isVowel(out[i]) && out[i-1] != ' ' {
+			out = append(out[:i], out[i+1:]...)
+		}
+	}
+	for i := len(out) - 1; i > 0 && len(out) > 16; i-- {
+		if out[i] == ' ' {
+			out = append(out[:i], out[i+1:]...)
+		}
+	}
+	return out
+}
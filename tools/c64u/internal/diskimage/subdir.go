@@ -0,0 +1,238 @@
+package diskimage
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// A D81 partition (a CBM entry) works as a subdirectory when it starts at
+// sector 0 of a track, covers at least three whole tracks and does not
+// contain the directory track it was created from: its first track then
+// holds a header, BAM and directory like track 40 of the disk, and the BAM
+// only has the partition's own tracks free.
+//
+// DNP images have real subdirectories (DIR entries). The entry points to a
+// header block like the one at 1/1, which links to the directory blocks
+// and back to the parent; all directories share the BAM of the image.
+
+// minPartitionTracks is the smallest D81 partition usable as subdirectory
+const minPartitionTracks = 3
+
+// Subdir returns the D81 partition or DNP subdirectory named name as an
+// image opened at that directory. It shares the data with img: changes to
+// either show in both, and saving either writes the whole image.
+func (img *Image) Subdir(name []byte) (*Image, error) {
+	f, err := img.Find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := *img
+	switch {
+	case img.Format == D81 && f.Type == CBM:
+		tracks := f.Blocks / 40
+		if f.Sector != 0 || f.Blocks%40 != 0 || tracks < minPartitionTracks ||
+			img.containsDirTrack(f.Track, tracks) {
+			return nil, fmt.Errorf("%w: partition %s cannot hold a directory", ErrNotDir, name)
+		}
+		header, err := img.Sector(f.Track, 0)
+		if err != nil {
+			return nil, fmt.Errorf("%w: partition %s", err, name)
+		}
+		if header[2] != 'D' {
+			return nil, fmt.Errorf("%w: partition %s is not formatted", ErrNotDir, name)
+		}
+		sub.dir = [2]int{f.Track, 0}
+	case img.Format == DNP && f.Type == DIR:
+		header, err := img.Sector(f.Track, f.Sector)
+		if err != nil {
+			return nil, fmt.Errorf("%w: directory %s", err, name)
+		}
+		if header[2] != 'H' {
+			return nil, fmt.Errorf("%w: directory %s has no header", ErrBadChain, name)
+		}
+		sub.dir = [2]int{f.Track, f.Sector}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNotDir, name)
+	}
+	return &sub, nil
+}
+
+// containsDirTrack reports whether tracks tracks from first include the
+// disk's or the current partition's directory track
+func (img *Image) containsDirTrack(first, tracks int) bool {
+	last := first + tracks - 1
+	return (first <= 40 && last >= 40) || (first <= img.DirTrack() && last >= img.DirTrack())
+}
+
+// MakePartition creates a D81 partition of tracks whole tracks in the
+// current directory and formats it as a subdirectory. The partition takes
+// the free tracks farthest from the directory track.
+func (img *Image) MakePartition(name []byte, tracks int) (File, error) {
+	if img.Format != D81 {
+		return File{}, fmt.Errorf("%w: partitions need a D81 image", ErrUnsupported)
+	}
+	if tracks < minPartitionTracks {
+		return File{}, fmt.Errorf("a partition needs at least %d tracks", minPartitionTracks)
+	}
+	if err := img.checkNewName(name); err != nil {
+		return File{}, err
+	}
+
+	first := 0
+	for t := img.Tracks - tracks + 1; t >= 1 && first == 0; t-- {
+		if !img.containsDirTrack(t, tracks) && img.tracksFree(t, tracks) {
+			first = t
+		}
+	}
+	if first == 0 {
+		return File{}, fmt.Errorf("%w: no %d consecutive free tracks", ErrDiskFull, tracks)
+	}
+
+	slot, err := img.freeSlot()
+	if err != nil {
+		return File{}, err
+	}
+	for t := first; t < first+tracks; t++ {
+		for s := 0; s < 40; s++ {
+			img.setFree(t, s, false)
+		}
+	}
+
+	e := img.entry(slot)
+	for i := range e[2:] {
+		e[2+i] = 0
+	}
+	blocks := tracks * 40
+	e[2] = 0x80 | byte(CBM)
+	e[3], e[4] = byte(first), 0
+	copy(e[5:21], padName(name))
+	e[30], e[31] = byte(blocks), byte(blocks>>8)
+
+	sub := *img
+	sub.dir = [2]int{first, 0}
+	sub.formatPartition(name, img.ID(), tracks)
+
+	return File{Name: append([]byte(nil), name...), Type: CBM, Closed: true,
+		Track: first, Blocks: blocks, slot: slot}, nil
+}
+
+// tracksFree reports whether all sectors of tracks tracks from first are
+// free
+func (img *Image) tracksFree(first, tracks int) bool {
+	for t := first; t < first+tracks; t++ {
+		for s := 0; s < img.SectorsPerTrack(t); s++ {
+			if !img.isFree(t, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// formatPartition writes an empty directory and BAM into the partition the
+// image is opened at
+func (img *Image) formatPartition(name, id []byte, tracks int) {
+	first := img.DirTrack()
+	for s := 0; s <= 3; s++ {
+		sec, _ := img.Sector(first, s)
+		for i := range sec {
+			sec[i] = 0
+		}
+	}
+	img.writeD81Header(first, name, id)
+
+	for t := first; t < first+tracks; t++ {
+		for s := 0; s < 40; s++ {
+			img.setFree(t, s, true)
+		}
+	}
+	dir, _ := img.Sector(first, 3)
+	dir[0], dir[1] = 0, 0xFF
+	for s := 0; s <= 3; s++ {
+		img.setFree(first, s, false)
+	}
+}
+
+// MakeDir creates an empty DNP subdirectory in the current directory
+func (img *Image) MakeDir(name []byte) (File, error) {
+	if img.Format != DNP {
+		return File{}, fmt.Errorf("%w: subdirectories need a DNP image (D81 images use partitions)", ErrUnsupported)
+	}
+	if err := img.checkNewName(name); err != nil {
+		return File{}, err
+	}
+
+	// The header and the first directory block
+	chain, err := img.allocChain(2)
+	if err != nil {
+		return File{}, err
+	}
+	slot, err := img.freeSlot()
+	if err != nil {
+		img.freeChain(chain)
+		return File{}, err
+	}
+	hdr, dir := chain[0], chain[1]
+
+	header, _ := img.Sector(hdr[0], hdr[1])
+	for i := range header {
+		header[i] = 0
+	}
+	writeDNPHeader(header, name, img.ID(), dir)
+	header[0x20], header[0x21] = byte(hdr[0]), byte(hdr[1])
+	parentTrack, parentSector := img.headerBlock()
+	header[0x22], header[0x23] = byte(parentTrack), byte(parentSector)
+	header[0x24], header[0x25] = byte(slot.track), byte(slot.sector)
+	header[0x26] = byte(slot.index*32 + 2)
+
+	sec, _ := img.Sector(dir[0], dir[1])
+	for i := range sec {
+		sec[i] = 0
+	}
+	sec[1] = 0xFF
+
+	e := img.entry(slot)
+	for i := range e[2:] {
+		e[2+i] = 0
+	}
+	e[2] = 0x80 | byte(DIR)
+	e[3], e[4] = byte(hdr[0]), byte(hdr[1])
+	copy(e[5:21], padName(name))
+	e[30] = 2
+
+	return File{Name: append([]byte(nil), name...), Type: DIR, Closed: true,
+		Track: hdr[0], Sector: hdr[1], Blocks: 2, slot: slot}, nil
+}
+
+// parentEntry returns the directory entry of a DNP subdirectory in its
+// parent directory, or nil for the root directory
+func (img *Image) parentEntry() []byte {
+	if img.Format != DNP || img.IsRoot() {
+		return nil
+	}
+	header, _ := img.Sector(img.headerBlock())
+	sec, err := img.Sector(int(header[0x24]), int(header[0x25]))
+	off := int(header[0x26]) - 2
+	if err != nil || off < 0 || off%32 != 0 {
+		return nil
+	}
+	return sec[off : off+32]
+}
+
+// checkNewName checks that name can be used for a new directory entry
+func (img *Image) checkNewName(name []byte) error {
+	if len(name) == 0 || len(name) > 16 {
+		return fmt.Errorf("file name must be 1 to 16 characters")
+	}
+	files, err := img.Files()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if bytes.Equal(f.Name, name) {
+			return fmt.Errorf("%w: %s", ErrExists, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package diskimage
+
+// SectorUse describes what a sector holds
+type SectorUse struct {
+	// What is "header", "bam", "directory", "file" or "side sector"
+	What string
+	// Name is the file, partition or subdirectory (PETSCII), with the
+	// names of enclosing directories separated by "/"
+	Name []byte
+}
+
+// Usage maps the sectors in use by the directory structure and the files
+// to what they hold, including the contents of D81 partitions and DNP
+// subdirectories. Sectors of broken chains are left out.
+func (img *Image) Usage() map[[2]int]SectorUse {
+	use := make(map[[2]int]SectorUse)
+	img.usage(use, nil)
+	return use
+}
+
+// usage adds the sectors of the current directory to use; prefix names
+// the directory
+func (img *Image) usage(use map[[2]int]SectorUse, prefix []byte) {
+	mark := func(t, s int, what string, name []byte) {
+		if _, err := img.index(t, s); err == nil {
+			use[[2]int{t, s}] = SectorUse{What: what, Name: name}
+		}
+	}
+
+	track, sector := img.headerBlock()
+	mark(track, sector, "header", prefix)
+	switch {
+	case img.Format == D81:
+		mark(track, 1, "bam", prefix)
+		mark(track, 2, "bam", prefix)
+	case img.Format == D71 && img.IsRoot():
+		mark(53, 0, "bam", prefix)
+	case img.Format == DNP && img.IsRoot():
+		for s := 2; s < 2+((img.Tracks+1)*32+SectorSize-1)/SectorSize; s++ {
+			mark(1, s, "bam", prefix)
+		}
+	}
+
+	var dirs []File
+	_ = img.walkDir(func(slot dirSlot, e []byte) bool {
+		mark(slot.track, slot.sector, "directory", prefix)
+		if e[2] == 0 {
+			return true
+		}
+		name := append(append([]byte(nil), prefix...), trimName(e[5:21])...)
+		switch FileType(e[2] & 0x07) {
+		case CBM:
+			// The whole partition (whole tracks of 40 sectors), until its
+			// own structures are marked
+			for i := 0; i < int(e[30])|int(e[31])<<8; i++ {
+				mark(int(e[3])+i/40, i%40, "partition", name)
+			}
+			fallthrough
+		case DIR:
+			dirs = append(dirs, File{Name: trimName(e[5:21]), Type: FileType(e[2] & 0x07)})
+			return true
+		case REL:
+			if chain, _, err := img.chain(int(e[21]), int(e[22])); err == nil {
+				for _, ts := range chain {
+					mark(ts[0], ts[1], "side sector", name)
+				}
+			}
+		}
+		if e[3] != 0 {
+			if chain, _, err := img.chain(int(e[3]), int(e[4])); err == nil {
+				for _, ts := range chain {
+					mark(ts[0], ts[1], "file", name)
+				}
+			}
+		}
+		return true
+	})
+
+	for _, d := range dirs {
+		if sub, err := img.Subdir(d.Name); err == nil {
+			sub.usage(use, append(append(append([]byte(nil), prefix...), d.Name...), '/'))
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package drivecode builds C64 programs that transfer code into the RAM of
+// a disk drive with M-W commands and start it with M-E, as fastloaders do,
+// or read the drive's memory with M-R.
+package drivecode
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/asm6502"
+)
+
+// ChunkSize is the number of bytes sent per M-W command; the command
+// buffer of the 1541 holds 40 characters
+const ChunkSize = 32
+
+// commandBuffer is the drive's command buffer, which M-W must not overwrite
+const commandBuffer = 0x0200
+
+// ErrRange is returned for code that does not fit the drive's RAM
+var ErrRange = errors.New("code outside drive RAM")
+
+// RAMSize returns the size of a drive type's RAM
+func RAMSize(driveType string) int {
+	if driveType == "1581" {
+		return 0x2000
+	}
+	return 0x0800
+}
+
+// Commands returns the M-W commands that write code to addr and, if exec
+// is not negative, the M-E command that starts it
+func Commands(code []byte, addr, exec, ramSize int) ([][]byte, error) {
+	end := addr + len(code)
+	switch {
+	case len(code) == 0:
+		return nil, fmt.Errorf("%w: the code is empty", ErrRange)
+	case end > ramSize:
+		return nil, fmt.Errorf("%w: $%04X-$%04X ends past $%04X", ErrRange, addr, end-1, ramSize-1)
+	case addr < commandBuffer+0x100 && end > commandBuffer:
+		return nil, fmt.Errorf("%w: $%04X-$%04X overlaps the command buffer $0200-$02FF", ErrRange, addr, end-1)
+	case exec >= ramSize:
+		return nil, fmt.Errorf("%w: start address $%04X is past $%04X", ErrRange, exec, ramSize-1)
+	}
+
+	var cmds [][]byte
+	for off := 0; off < len(code); off += ChunkSize {
+		chunk := code[off:min(off+ChunkSize, len(code))]
+		a := addr + off
+		cmd := append([]byte("M-W"), byte(a), byte(a>>8), byte(len(chunk)))
+		cmds = append(cmds, append(cmd, chunk...))
+	}
+	if exec >= 0 {
+		cmds = append(cmds, []byte{'M', '-', 'E', byte(exec), byte(exec >> 8)})
+	}
+	return cmds, nil
+}
+
+// Kernal routines used by the programs
+const (
+	setlfs = 0xFFBA
+	setnam = 0xFFBD
+	open   = 0xFFC0
+	close  = 0xFFC3
+	chkin  = 0xFFC6
+	chkout = 0xFFC9
+	clrchn = 0xFFCC
+	chrin  = 0xFFCF
+	chrout = 0xFFD2
+	clall  = 0xFFE7
+)
+
+// SenderPRG builds a PRG that opens the command channel of a device,
+// sends each command (the drive executes it when the C64 unlistens) and
+// returns to BASIC
+func SenderPRG(device int, cmds [][]byte) []byte {
+	const ptr, length, index = asm6502.ZPSrc, asm6502.ZPDst, asm6502.ZPDst + 1
+	a := asm6502.New(0x080D)
+	a.Op(0xA9, 0x0F, 0xA2, byte(device), 0xA0, 0x0F) // lda #15, ldx #device, ldy #15
+	a.Abs(0x20, setlfs)
+	a.Op(0xA9, 0x00) // lda #0: no name
+	a.Abs(0x20, setnam)
+	a.Abs(0x20, open)
+	a.AbsLabel(0xA9, "<table") // lda #<table
+	a.Op(0x85, ptr)
+	a.AbsLabel(0xA9, ">table") // lda #>table
+	a.Op(0x85, ptr+1)
+
+	// Each table entry is a length byte and the command; 0 ends it. The
+	// index is kept in memory, as the serial routines may change Y.
+	a.Label("command")
+	a.Op(0xA0, 0x00, 0xB1, ptr) // ldy #0, lda (ptr),y
+	a.Branch(0xF0, "done")      // beq done
+	a.Op(0x85, length)          // sta length
+	a.Op(0xA2, 0x0F)            // ldx #15
+	a.Abs(0x20, chkout)
+	a.Op(0xA0, 0x01) // ldy #1
+	a.Label("byte")
+	a.Op(0xB1, ptr, 0x84, index) // lda (ptr),y, sty index
+	a.Abs(0x20, chrout)
+	a.Op(0xA4, index, 0xC4, length, 0xC8) // ldy index, cpy length, iny
+	a.Branch(0x90, "byte")                // bcc byte
+	a.Abs(0x20, clrchn)
+	a.Op(0xA5, length, 0x38, 0x65, ptr, 0x85, ptr) // lda length, sec, adc ptr, sta ptr: skip length and command
+	a.Branch(0x90, "command")
+	a.Op(0xE6, ptr+1)         // inc ptr+1
+	a.Branch(0xB0, "command") // bcs command
+
+	// CLALL forgets the open file without talking to the drive, which may
+	// be running the code by now
+	a.Label("done")
+	a.Abs(0x4C, clall) // jmp clall: back to BASIC
+	a.Label("table")
+	for _, c := range cmds {
+		a.Op(byte(len(c)))
+		a.Op(c...)
+	}
+	a.Op(0)
+
+	prg := []byte{0x01, 0x08}
+	// 10 SYS2061
+	prg = append(prg, 0x0B, 0x08, 0x0A, 0x00, 0x9E, '2', '0', '6', '1', 0x00, 0x00, 0x00)
+	return append(prg, a.Bytes()...)
+}
+
+// Where the reader leaves drive memory in C64 RAM: ReadFlag is set to 1
+// once the MaxRead bytes at most from ReadBuffer are complete
+const (
+	ReadFlag   = 0x3FFF
+	ReadBuffer = 0x4000
+	MaxRead    = 0x2000
+)
+
+// ReadCommands returns the M-R commands that read length bytes at addr
+func ReadCommands(addr, length int) ([][]byte, error) {
+	switch {
+	case length < 1 || length > MaxRead:
+		return nil, fmt.Errorf("the length must be 1 to %d bytes", MaxRead)
+	case addr+length > 0x10000:
+		return nil, fmt.Errorf("$%04X-$%04X ends past $FFFF", addr, addr+length-1)
+	}
+	var cmds [][]byte
+	for off := 0; off < length; off += ChunkSize {
+		a, n := addr+off, min(ChunkSize, length-off)
+		cmds = append(cmds, []byte{'M', '-', 'R', byte(a), byte(a >> 8), byte(n)})
+	}
+	return cmds, nil
+}
+
+// ReaderPRG builds a PRG that sends each M-R command to the command
+// channel of a device, stores the bytes it answers with from ReadBuffer on,
+// sets ReadFlag and returns to BASIC. The last byte of each command is the
+// number of bytes read.
+func ReaderPRG(device int, cmds [][]byte) []byte {
+	const ptr, dst = asm6502.ZPSrc, asm6502.ZPDst
+	a := asm6502.New(0x080D)
+	a.Op(0xA9, 0x0F, 0xA2, byte(device), 0xA0, 0x0F) // lda #15, ldx #device, ldy #15
+	a.Abs(0x20, setlfs)
+	a.Op(0xA9, 0x00) // lda #0: no name
+	a.Abs(0x20, setnam)
+	a.Abs(0x20, open)
+	a.AbsLabel(0xA9, "<table") // lda #<table
+	a.Op(0x85, ptr)
+	a.AbsLabel(0xA9, ">table") // lda #>table
+	a.Op(0x85, ptr+1)
+	a.Op(0xA9, ReadBuffer&0xFF, 0x85, dst, 0xA9, ReadBuffer>>8, 0x85, dst+1)
+
+	// The table is as for SenderPRG; the counters are kept in memory, as
+	// the serial routines may change X and Y
+	a.Label("command")
+	a.Op(0xA0, 0x00, 0xB1, ptr) // ldy #0, lda (ptr),y
+	a.Branch(0xF0, "done")      // beq done
+	a.AbsLabel(0x8D, "length")  // sta length
+	a.Op(0xA2, 0x0F)            // ldx #15
+	a.Abs(0x20, chkout)
+	a.Op(0xA0, 0x01) // ldy #1
+	a.Label("byte")
+	a.Op(0xB1, ptr)           // lda (ptr),y
+	a.AbsLabel(0x8C, "index") // sty index
+	a.Abs(0x20, chrout)
+	a.AbsLabel(0xAC, "index")  // ldy index
+	a.AbsLabel(0xCC, "length") // cpy length
+	a.Op(0xC8)                 // iny
+	a.Branch(0x90, "byte")     // bcc byte
+	a.Abs(0x20, clrchn)
+
+	// The drive answers on the command channel
+	a.AbsLabel(0xAC, "length") // ldy length
+	a.Op(0xB1, ptr)            // lda (ptr),y: the number of bytes
+	a.AbsLabel(0x8D, "count")  // sta count
+	a.Op(0xA2, 0x0F)           // ldx #15
+	a.Abs(0x20, chkin)
+	a.Label("read")
+	a.Abs(0x20, chrin)
+	a.Op(0xA0, 0x00, 0x91, dst, 0xE6, dst) // ldy #0, sta (dst),y, inc dst
+	a.Branch(0xD0, "next")                 // bne next
+	a.Op(0xE6, dst+1)                      // inc dst+1
+	a.Label("next")
+	a.AbsLabel(0xCE, "count") // dec count
+	a.Branch(0xD0, "read")    // bne read
+	a.Abs(0x20, clrchn)
+	a.AbsLabel(0xAD, "length")       // lda length
+	a.Op(0x38, 0x65, ptr, 0x85, ptr) // sec, adc ptr, sta ptr: skip length and command
+	a.Branch(0x90, "command")        // bcc command
+	a.Op(0xE6, ptr+1)                // inc ptr+1
+	a.Branch(0xB0, "command")        // bcs command
+
+	a.Label("done")
+	a.Op(0xA9, 0x0F) // lda #15
+	a.Abs(0x20, close)
+	a.Op(0xA9, 0x01) // lda #1
+	a.Abs(0x8D, ReadFlag)
+	a.Abs(0x4C, clall) // jmp clall: back to BASIC
+	a.Label("length")
+	a.Op(0)
+	a.Label("index")
+	a.Op(0)
+	a.Label("count")
+	a.Op(0)
+	a.Label("table")
+	for _, c := range cmds {
+		a.Op(byte(len(c)))
+		a.Op(c...)
+	}
+	a.Op(0)
+
+	prg := []byte{0x01, 0x08}
+	// 10 SYS2061
+	prg = append(prg, 0x0B, 0x08, 0x0A, 0x00, 0x9E, '2', '0', '6', '1', 0x00, 0x00, 0x00)
+	return append(prg, a.Bytes()...)
+}
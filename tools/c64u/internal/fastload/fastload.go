@@ -0,0 +1,158 @@
+// Package fastload recognises fastloaders and copy protections on disk
+// images by the texts and drive commands they leave in their files, and
+// knows what each needs from the drive emulation to work.
+package fastload
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/g64"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+)
+
+// Loader is a fastloader or protection and what it needs to load. The
+// needs are community knowledge of what works, not a guarantee.
+type Loader struct {
+	Name string `json:"name"`
+	// Drive is the drive type it needs ("1541"), empty if any works
+	Drive string `json:"drive,omitempty"`
+	// Native is set if it needs the drive type the image is made for
+	Native bool `json:"-"`
+	// ROM names the drive ROM it needs, matched against the ROM file name
+	ROM string `json:"rom,omitempty"`
+	// GCR is set if it needs the raw GCR data of a G64 image
+	GCR bool `json:"gcr,omitempty"`
+	// Parallel is set if it transfers over a parallel cable
+	Parallel bool   `json:"parallel,omitempty"`
+	Advice   string `json:"advice"`
+
+	signatures [][]byte
+	// all is set if every signature must be present, not just one
+	all bool
+}
+
+// Finding is a loader found on an image
+type Finding struct {
+	Loader *Loader `json:"loader"`
+	// File is the file it was found in, empty if outside the files
+	File string `json:"file,omitempty"`
+	// Drive is the drive type needed, empty if any works
+	Drive string `json:"drive,omitempty"`
+}
+
+// serialOnly is the advice for IRQ loaders that drive the serial bus
+// with exact timing
+const serialOnly = "an IRQ loader with exact serial timing: switch off other drives and the printer emulation on the bus"
+
+// Loaders are the loaders and protections recognised, most specific first.
+// Signatures are upper case PETSCII texts and drive commands.
+var Loaders = []*Loader{
+	{Name: "V-MAX!", Drive: "1541", GCR: true, signatures: sigs("V-MAX"),
+		Advice: "a copy protection with its own GCR format: mount the original G64 (a D64 loses it) in a 1541 drive"},
+	{Name: "Rapidlok", Drive: "1541", GCR: true, signatures: sigs("RAPIDLOK"),
+		Advice: "a copy protection checking the track layout: mount the original G64 in a 1541 drive"},
+	{Name: "Vorpal", Drive: "1541", GCR: true, signatures: sigs("VORPAL"),
+		Advice: "Epyx's fastloader with its own sector format: mount the G64 in a 1541 drive"},
+	{Name: "Krill's loader", Drive: "", signatures: sigs("KRILL"),
+		Advice: "works with 1541, 1571 and 1581 drives; " + serialOnly},
+	{Name: "Bitfire", Drive: "1541", signatures: sigs("BITFIRE"),
+		Advice: "1541 only; " + serialOnly},
+	{Name: "Spindle", Drive: "1541", signatures: sigs("SPINDLE"),
+		Advice: "1541 only; " + serialOnly},
+	{Name: "Dolphin DOS", Drive: "1541", ROM: "dolphin", Parallel: true, signatures: sigs("DOLPHIN DOS", "DOLPHINDOS"),
+		Advice: "transfers over a parallel cable and needs the Dolphin DOS drive ROM; without them use the standard loader"},
+	{Name: "SpeedDOS", Drive: "1541", ROM: "speeddos", Parallel: true, signatures: sigs("SPEEDDOS", "SPEED-DOS"),
+		Advice: "transfers over a parallel cable and needs the SpeedDOS drive ROM"},
+	{Name: "JiffyDOS", ROM: "jiffy", signatures: sigs("JIFFYDOS"),
+		Advice: "uses the JiffyDOS protocol: needs JiffyDOS in the drive ROM and the C64 kernal, otherwise it falls back to standard speed or hangs"},
+	{Name: "Action Replay Warp*25", Drive: "1541", signatures: sigs("WARP*25", "WARP 25"),
+		Advice: "saved by the Action Replay's warp save: needs the Action Replay cartridge to load and a 1541 drive"},
+	{Name: "Hypra-Load", Drive: "1541", signatures: sigs("HYPRA-LOAD", "HYPRALOAD"),
+		Advice: "a 1541 fastloader: set the drive to 1541 with the stock ROM"},
+	{Name: "custom drive code", Native: true, signatures: sigs("M-W", "M-E"), all: true,
+		Advice: "runs its own code in the drive (M-E): needs the drive type the disk was made for and the stock ROM; speeder ROMs may hang it"},
+}
+
+// protection stands for G64 images whose tracks are unusual for the DOS
+var protection = &Loader{Name: "non-standard tracks", Drive: "1541", GCR: true,
+	Advice: "the image has tracks the DOS would not write, as copy protections check for: mount the G64, not a D64 conversion, in a 1541 drive"}
+
+func sigs(texts ...string) [][]byte {
+	out := make([][]byte, len(texts))
+	for i, t := range texts {
+		out[i] = []byte(t)
+	}
+	return out
+}
+
+// Scan looks for known loaders in a disk image file (D64, D71, D81 or
+// G64). Each loader is reported once, with the first file it is found in.
+// notes lists unusual G64 tracks.
+func Scan(name string, data []byte) (findings []Finding, notes []string, err error) {
+	var img *diskimage.Image
+	native := "1541"
+	if strings.EqualFold(filepath.Ext(name), ".g64") {
+		g, err := g64.Parse(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		disk := g64.Analyze(g)
+		for _, t := range disk.Tracks {
+			if len(t.Anomalies) > 0 && !(t.Missing && t.Track > 35) {
+				notes = append(notes, fmt.Sprintf("track %g: %s", t.Track, strings.Join(t.Anomalies, ", ")))
+			}
+		}
+		if len(notes) > 0 {
+			findings = append(findings, Finding{Loader: protection, Drive: protection.Drive})
+		}
+		if img, err = g64.ToD64(disk, false); err != nil {
+			return findings, notes, nil
+		}
+	} else if img, err = diskimage.Parse(data); err != nil {
+		return nil, nil, err
+	}
+	switch img.Format {
+	case diskimage.D71:
+		native = "1571"
+	case diskimage.D81:
+		native = "1581"
+	}
+
+	found := map[*Loader]bool{}
+	add := func(file string, content []byte) {
+		for _, l := range Loaders {
+			if !found[l] && l.matches(content) {
+				found[l] = true
+				drive := l.Drive
+				if l.Native {
+					drive = native
+				}
+				findings = append(findings, Finding{Loader: l, File: file, Drive: drive})
+			}
+		}
+	}
+	if files, err := img.Files(); err == nil {
+		for _, f := range files {
+			if content, err := img.ReadFile(f); err == nil {
+				add(petscii.ToEscaped(f.Name), content)
+			}
+		}
+	}
+	// Boot sectors and drive code outside the directory
+	add("", img.Bytes())
+	return findings, notes, nil
+}
+
+// matches reports whether data holds the loader's signatures
+func (l *Loader) matches(data []byte) bool {
+	for _, s := range l.signatures {
+		if bytes.Contains(data, s) != l.all {
+			return !l.all
+		}
+	}
+	return l.all
+}
@@ -0,0 +1,139 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout limits a single download
+const DefaultTimeout = 2 * time.Minute
+
+// IsURL reports whether s is an http(s) URL
+func IsURL(s string) bool {
+	lower := strings.ToLower(s)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// Cache downloads URLs into a directory, keeping one file per URL in a
+// subdirectory named after the URL's hash, so the file keeps its name
+type Cache struct {
+	Dir     string
+	Client  *http.Client
+	Verbose bool
+}
+
+// NewCache returns a download cache in dir
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir, Client: &http.Client{Timeout: DefaultTimeout}}
+}
+
+// Get returns the local copy of rawURL, downloading it unless it is cached
+// (or refresh is set). cached reports whether the cached copy was used.
+func (c *Cache) Get(rawURL string, refresh bool) (file string, cached bool, err error) {
+	sum := sha256.Sum256([]byte(rawURL))
+	dir := filepath.Join(c.Dir, hex.EncodeToString(sum[:8]))
+
+	if !refresh {
+		if entries, err := os.ReadDir(dir); err == nil {
+			for _, e := range entries {
+				if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") && !strings.HasSuffix(e.Name(), ".part") {
+					return filepath.Join(dir, e.Name()), true, nil
+				}
+			}
+		}
+	}
+
+	if c.Verbose {
+		fmt.Printf("→ GET %s\n", rawURL)
+	}
+	resp, err := c.Client.Get(rawURL)
+	if err != nil {
+		return "", false, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("download of %s failed: %s", rawURL, resp.Status)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return "", false, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", false, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	file = filepath.Join(dir, fileName(rawURL, resp.Header.Get("Content-Disposition")))
+	tmp := file + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return "", false, fmt.Errorf("download of %s failed: %w", rawURL, err)
+	}
+	if err := out.Close(); err != nil {
+		return "", false, err
+	}
+	return file, false, os.Rename(tmp, file)
+}
+
+// verifiedMarker flags a cached download whose checks passed
+const verifiedMarker = ".verified"
+
+// MarkVerified records that a cached download passed verification
+func MarkVerified(file string) error {
+	return os.WriteFile(filepath.Join(filepath.Dir(file), verifiedMarker), nil, 0644)
+}
+
+// Verified reports whether a cached download passed verification
+func Verified(file string) bool {
+	_, err := os.Stat(filepath.Join(filepath.Dir(file), verifiedMarker))
+	return err == nil
+}
+
+// VerifySHA256 checks a file against an expected hex SHA-256
+func VerifySHA256(file, want string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(got, strings.TrimSpace(want)) {
+		return fmt.Errorf("SHA-256 mismatch for %s: expected %s, got %s", filepath.Base(file), strings.ToLower(want), got)
+	}
+	return nil
+}
+
+// fileName picks the local name of a download: the Content-Disposition
+// file name, else the last element of the URL path
+func fileName(rawURL, disposition string) string {
+	if _, params, err := mime.ParseMediaType(disposition); err == nil {
+		if name := filepath.Base(params["filename"]); name != "" && name != "." && name != "/" {
+			return name
+		}
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		if name := path.Base(u.Path); name != "" && name != "." && name != "/" {
+			return name
+		}
+	}
+	return "download"
+}
@@ -0,0 +1,172 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// ErrNoGPG is returned when a signature is published but gpg is missing
+var ErrNoGPG = errors.New("gpg is not installed")
+
+// maxSidecarSize limits checksum and signature files
+const maxSidecarSize = 1 << 20
+
+// PublishedSHA256 looks for a checksum published next to rawURL: the file
+// <url>.sha256, then a SHA256SUMS file in the same directory. An empty
+// result means none was found.
+func (c *Cache) PublishedSHA256(rawURL string) (string, error) {
+	name := path.Base(urlPath(rawURL))
+
+	data, err := c.sidecar(suffixURL(rawURL, ".sha256"))
+	if err != nil {
+		return "", err
+	}
+	if data != nil {
+		if sum := findChecksum(data, name, true); sum != "" {
+			return sum, nil
+		}
+		return "", fmt.Errorf("%s.sha256 contains no checksum", name)
+	}
+
+	sums, err := siblingURL(rawURL, "SHA256SUMS")
+	if err != nil {
+		return "", nil
+	}
+	data, err = c.sidecar(sums)
+	if err != nil || data == nil {
+		return "", err
+	}
+	return findChecksum(data, name, false), nil
+}
+
+// PublishedSignature looks for a detached GPG signature published next to
+// rawURL (<url>.asc or <url>.sig). nil means none was found.
+func (c *Cache) PublishedSignature(rawURL string) ([]byte, error) {
+	for _, ext := range []string{".asc", ".sig"} {
+		data, err := c.sidecar(suffixURL(rawURL, ext))
+		if err != nil || data != nil {
+			return data, err
+		}
+	}
+	return nil, nil
+}
+
+// VerifyGPG checks a detached signature of file with gpg, against the keys
+// in the user's keyring
+func VerifyGPG(file string, sig []byte) error {
+	gpg, err := exec.LookPath("gpg")
+	if err != nil {
+		return ErrNoGPG
+	}
+
+	tmp, err := os.CreateTemp("", "c64u-sig-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(sig); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(gpg, "--batch", "--verify", tmp.Name(), file)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("GPG signature check failed: %s", msg)
+	}
+	return nil
+}
+
+// sidecar downloads a small file published next to a download. A missing
+// file (any non-200 status) yields nil data.
+func (c *Cache) sidecar(rawURL string) ([]byte, error) {
+	resp, err := c.Client.Get(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSidecarSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	if c.Verbose {
+		fmt.Printf("→ Found %s\n", rawURL)
+	}
+	return data, nil
+}
+
+// findChecksum finds the SHA-256 of name in sha256sum output. With single
+// set, a lone hash without a file name is accepted too.
+func findChecksum(data []byte, name string, single bool) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !isSHA256(fields[0]) {
+			continue
+		}
+		if len(fields) == 1 && single {
+			return strings.ToLower(fields[0])
+		}
+		// sha256sum marks binary mode with a leading '*'
+		if len(fields) > 1 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0])
+		}
+	}
+	return ""
+}
+
+// isSHA256 reports whether s is a hex SHA-256
+func isSHA256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 32
+}
+
+// siblingURL replaces the last path element of rawURL with name
+func siblingURL(rawURL, name string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join(path.Dir(u.Path), name)
+	u.RawPath, u.RawQuery, u.Fragment = "", "", ""
+	return u.String(), nil
+}
+
+// suffixURL appends ext to the path of rawURL, dropping any query
+func suffixURL(rawURL, ext string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL + ext
+	}
+	u.Path += ext
+	u.RawPath, u.RawQuery, u.Fragment = "", "", ""
+	return u.String()
+}
+
+// urlPath returns the path of a URL (or the URL itself if it cannot be parsed)
+func urlPath(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Path
+	}
+	return rawURL
+}
@@ -0,0 +1,296 @@
+package ftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	goftp "github.com/jlaffaye/ftp"
+)
+
+// DefaultPort is the Ultimate's FTP port
+const DefaultPort = 21
+
+// ErrReadOnly is returned for changes to the device in read-only mode
+var ErrReadOnly = errors.New("read-only mode: changes to the device are disabled")
+
+// ErrUnsupported is returned for commands the FTP server does not implement
+var ErrUnsupported = errors.New("not supported by the FTP server")
+
+// Client is a connection to the C64 Ultimate's FTP server (anonymous login)
+type Client struct {
+	Addr    string
+	Verbose bool
+	// ReadOnly refuses uploads, deletes, renames and new directories
+	ReadOnly bool
+
+	conn    *goftp.ServerConn
+	timeout time.Duration
+}
+
+// Entry is a file or directory on the device
+type Entry struct {
+	Name string
+	Path string
+	Size int64
+	Dir  bool
+	Time time.Time
+}
+
+// Dial connects and logs in to the FTP server on host
+func Dial(host string, port int, timeout time.Duration) (*Client, error) {
+	if port == 0 {
+		port = DefaultPort
+	}
+	addr := fmt.Sprintf("%s:%d", host, port)
+
+	conn, err := goftp.Dial(addr, goftp.DialWithTimeout(timeout))
+	if err != nil {
+		return nil, fmt.Errorf("FTP connection to %s failed: %w", addr, err)
+	}
+
+	if err := conn.Login("anonymous", "anonymous"); err != nil {
+		conn.Quit()
+		return nil, fmt.Errorf("FTP login failed: %w", err)
+	}
+
+	return &Client{Addr: addr, conn: conn, timeout: timeout}, nil
+}
+
+// Close ends the FTP session
+func (c *Client) Close() error {
+	return c.conn.Quit()
+}
+
+// Store writes the contents of r to the remote path
+func (c *Client) Store(remote string, r io.Reader) error {
+	if c.ReadOnly {
+		return fmt.Errorf("upload of %s failed: %w", remote, ErrReadOnly)
+	}
+	c.trace("STOR", remote)
+	if err := c.conn.Stor(remote, r); err != nil {
+		return fmt.Errorf("upload of %s failed: %w", remote, err)
+	}
+	return nil
+}
+
+// Upload copies a local file to the remote path
+func (c *Client) Upload(local, remote string) error {
+	file, err := os.Open(local)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return c.Store(remote, file)
+}
+
+// Retrieve copies the remote file to w
+func (c *Client) Retrieve(remote string, w io.Writer) error {
+	c.trace("RETR", remote)
+	resp, err := c.conn.Retr(remote)
+	if err != nil {
+		return fmt.Errorf("download of %s failed: %w", remote, err)
+	}
+	defer resp.Close()
+
+	if _, err := io.Copy(w, resp); err != nil {
+		return fmt.Errorf("download of %s failed: %w", remote, err)
+	}
+	return nil
+}
+
+// Download copies the remote file to a local path
+func (c *Client) Download(remote, local string) error {
+	file, err := os.Create(local)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	if err := c.Retrieve(remote, file); err != nil {
+		file.Close()
+		os.Remove(local)
+		return err
+	}
+	return file.Close()
+}
+
+// Delete removes a remote file
+func (c *Client) Delete(remote string) error {
+	if c.ReadOnly {
+		return fmt.Errorf("failed to delete %s: %w", remote, ErrReadOnly)
+	}
+	c.trace("DELE", remote)
+	if err := c.conn.Delete(remote); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", remote, err)
+	}
+	return nil
+}
+
+// Rename moves a remote file or directory
+func (c *Client) Rename(from, to string) error {
+	if c.ReadOnly {
+		return fmt.Errorf("failed to move %s to %s: %w", from, to, ErrReadOnly)
+	}
+	c.trace("RNFR", from+" → "+to)
+	if err := c.conn.Rename(from, to); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", from, to, err)
+	}
+	return nil
+}
+
+// RemoveDir removes an empty remote directory
+func (c *Client) RemoveDir(dir string) error {
+	if c.ReadOnly {
+		return fmt.Errorf("failed to remove directory %s: %w", dir, ErrReadOnly)
+	}
+	c.trace("RMD", dir)
+	if err := c.conn.RemoveDir(dir); err != nil {
+		return fmt.Errorf("failed to remove directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// MkdirAll creates a remote directory and any missing parents
+func (c *Client) MkdirAll(dir string) error {
+	dir = path.Clean("/" + dir)
+	if dir == "/" {
+		return nil
+	}
+
+	current := ""
+	for _, part := range strings.Split(strings.TrimPrefix(dir, "/"), "/") {
+		current += "/" + part
+		if c.IsDir(current) {
+			continue
+		}
+		if c.ReadOnly {
+			return fmt.Errorf("failed to create directory %s: %w", current, ErrReadOnly)
+		}
+		c.trace("MKD", current)
+		if err := c.conn.MakeDir(current); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", current, err)
+		}
+	}
+	return nil
+}
+
+// List returns the entries of a remote directory
+func (c *Client) List(dir string) ([]Entry, error) {
+	c.trace("LIST", dir)
+	list, err := c.conn.List(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+
+	entries := make([]Entry, 0, len(list))
+	for _, e := range list {
+		if e.Name == "." || e.Name == ".." {
+			continue
+		}
+		entries = append(entries, Entry{
+			Name: e.Name,
+			Path: path.Join(dir, e.Name),
+			Size: int64(e.Size),
+			Dir:  e.Type == goftp.EntryTypeFolder,
+			Time: e.Time,
+		})
+	}
+	return entries, nil
+}
+
+// Walk calls fn for every entry below dir, depth first
+func (c *Client) Walk(dir string, fn func(Entry) error) error {
+	entries, err := c.List(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+		if e.Dir {
+			if err := c.Walk(e.Path, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Available returns the free bytes of the volume holding dir using the
+// AVBL extension. The command is sent on a separate control connection, as
+// the FTP library has no way to issue raw commands. Servers without AVBL
+// return ErrUnsupported.
+func (c *Client) Available(dir string) (int64, error) {
+	c.trace("AVBL", dir)
+	nc, err := net.DialTimeout("tcp", c.Addr, c.timeout)
+	if err != nil {
+		return 0, fmt.Errorf("FTP connection to %s failed: %w", c.Addr, err)
+	}
+	conn := textproto.NewConn(nc)
+	defer conn.Close()
+	if c.timeout > 0 {
+		nc.SetDeadline(time.Now().Add(c.timeout))
+	}
+
+	if _, _, err := conn.ReadResponse(220); err != nil {
+		return 0, err
+	}
+	code, msg, err := c.command(conn, "USER anonymous")
+	if err == nil && code == 331 {
+		code, msg, err = c.command(conn, "PASS anonymous")
+	}
+	if err != nil {
+		return 0, err
+	}
+	if code != 230 {
+		return 0, fmt.Errorf("FTP login failed: %d %s", code, msg)
+	}
+	defer c.command(conn, "QUIT")
+
+	code, msg, err = c.command(conn, "AVBL "+dir)
+	if err != nil {
+		return 0, err
+	}
+	if code != 213 {
+		return 0, ErrUnsupported
+	}
+	free, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AVBL reply '%s'", msg)
+	}
+	return free, nil
+}
+
+// command sends a raw command and reads the reply
+func (c *Client) command(conn *textproto.Conn, cmd string) (int, string, error) {
+	if err := conn.PrintfLine("%s", cmd); err != nil {
+		return 0, "", err
+	}
+	return conn.ReadResponse(0)
+}
+
+// IsDir reports whether a remote directory exists
+func (c *Client) IsDir(dir string) bool {
+	if err := c.conn.ChangeDir(dir); err != nil {
+		return false
+	}
+	c.conn.ChangeDir("/")
+	return true
+}
+
+// trace prints an FTP command in verbose mode
+func (c *Client) trace(cmd, arg string) {
+	if c.Verbose {
+		fmt.Printf("→ FTP %s %s\n", cmd, arg)
+	}
+}
@@ -0,0 +1,71 @@
+// Package fuse serves a simple path-based file system to the kernel via
+// FUSE (Linux only), without cgo or external libraries. Files are read and
+// written whole: an open file is loaded into memory and written back when
+// it is closed, which suits small files such as disk image contents and
+// transfers from the Ultimate.
+package fuse
+
+import (
+	"errors"
+	"time"
+)
+
+// Errors a FileSystem can return besides the io/fs errors (fs.ErrNotExist,
+// fs.ErrExist, fs.ErrPermission, fs.ErrInvalid)
+var (
+	ErrNoSpace      = errors.New("no space left")
+	ErrNotEmpty     = errors.New("directory not empty")
+	ErrNotSupported = errors.New("operation not supported")
+	ErrNotDir       = errors.New("not a directory")
+	ErrIsDir        = errors.New("is a directory")
+)
+
+// ErrUnavailable is returned by Mount on systems without FUSE support
+var ErrUnavailable = errors.New("FUSE mounts are only supported on Linux")
+
+// Attr describes a file or directory
+type Attr struct {
+	Dir     bool
+	Size    int64
+	ModTime time.Time
+}
+
+// DirEntry is a directory listing entry
+type DirEntry struct {
+	Name string
+	Dir  bool
+}
+
+// StatFS describes the capacity of the file system
+type StatFS struct {
+	BlockSize uint32
+	Blocks    uint64
+	Free      uint64
+}
+
+// FileSystem is served by Mount. Paths are absolute and slash-separated,
+// "/" being the mount's root. Calls are made from a single goroutine.
+type FileSystem interface {
+	Stat(path string) (Attr, error)
+	ReadDir(path string) ([]DirEntry, error)
+	ReadFile(path string) ([]byte, error)
+	// WriteFile creates or replaces a file
+	WriteFile(path string, data []byte) error
+	Remove(path string) error
+	Rename(oldPath, newPath string) error
+	Mkdir(path string) error
+	Rmdir(path string) error
+	StatFS() (StatFS, error)
+}
+
+// Options configure a mount
+type Options struct {
+	// Name is shown as the mount's source, e.g. in mount(8) output
+	Name     string
+	ReadOnly bool
+	// Errors, if set, is called for every failed operation (except lookups
+	// of names that do not exist), since the kernel only passes an errno on
+	Errors func(op, path string, err error)
+	// Debug, if set, receives a line per request
+	Debug func(msg string)
+}
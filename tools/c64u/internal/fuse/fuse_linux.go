@@ -0,0 +1,846 @@
+//go:build linux
+
+package fuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// =============================================================================
+// Protocol
+// =============================================================================
+
+// FUSE opcodes handled by the server
+const (
+	opLookup      = 1
+	opForget      = 2
+	opGetattr     = 3
+	opSetattr     = 4
+	opMkdir       = 9
+	opUnlink      = 10
+	opRmdir       = 11
+	opRename      = 12
+	opOpen        = 14
+	opRead        = 15
+	opWrite       = 16
+	opStatfs      = 17
+	opRelease     = 18
+	opFsync       = 20
+	opFlush       = 25
+	opInit        = 26
+	opOpendir     = 27
+	opReaddir     = 28
+	opReleasedir  = 29
+	opFsyncdir    = 30
+	opCreate      = 35
+	opInterrupt   = 36
+	opDestroy     = 38
+	opBatchForget = 42
+)
+
+var opNames = map[uint32]string{
+	opLookup: "lookup", opGetattr: "getattr", opSetattr: "setattr",
+	opMkdir: "mkdir", opUnlink: "unlink", opRmdir: "rmdir", opRename: "rename",
+	opOpen: "open", opRead: "read", opWrite: "write", opStatfs: "statfs",
+	opRelease: "release", opFsync: "fsync", opFlush: "flush", opInit: "init",
+	opOpendir: "opendir", opReaddir: "readdir", opReleasedir: "releasedir",
+	opFsyncdir: "fsyncdir", opCreate: "create", opDestroy: "destroy",
+}
+
+const (
+	protoMajor = 7
+	protoMinor = 31
+
+	// Init flags accepted from the kernel
+	initAtomicOTrunc = 1 << 3
+	initBigWrites    = 1 << 5
+
+	// setattr valid bits
+	fattrSize = 1 << 3
+	fattrFH   = 1 << 6
+
+	inHeaderSize  = 40
+	outHeaderSize = 16
+	maxWrite      = 128 * 1024
+
+	// ttl is how long the kernel may cache names and attributes, kept short
+	// so changes made on the other side show up quickly
+	ttl = time.Second
+)
+
+var le = binary.LittleEndian
+
+// =============================================================================
+// Server
+// =============================================================================
+
+// Server serves a FileSystem at a mount point
+type Server struct {
+	fs   FileSystem
+	opts Options
+	dir  string
+	fd   int
+
+	// fusermount is the helper used to mount, or empty if mounted directly
+	fusermount string
+
+	nodes  map[uint64]string
+	ids    map[string]uint64
+	nextID uint64
+
+	handles map[uint64]*handle
+	nextFH  uint64
+}
+
+// handle is an open file or directory. File contents are loaded on first
+// access and written back on flush if they changed.
+type handle struct {
+	path    string
+	dir     bool
+	entries []DirEntry
+	data    []byte
+	loaded  bool
+	dirty   bool
+}
+
+// Mount mounts fsys at dir. Call Serve to handle requests until the file
+// system is unmounted.
+func Mount(dir string, fsys FileSystem, opts Options) (*Server, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if st, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !st.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	if opts.Name == "" {
+		opts.Name = "c64u"
+	}
+
+	s := &Server{
+		fs:      fsys,
+		opts:    opts,
+		dir:     dir,
+		nodes:   map[uint64]string{1: "/"},
+		ids:     map[string]uint64{"/": 1},
+		nextID:  2,
+		handles: make(map[uint64]*handle),
+		nextFH:  1,
+	}
+	if os.Geteuid() == 0 {
+		err = s.mountDirect()
+	} else {
+		err = s.mountFusermount()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// mountDirect mounts with mount(2), which needs root
+func (s *Server) mountDirect() error {
+	fd, err := unix.Open("/dev/fuse", unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("cannot open /dev/fuse: %w", err)
+	}
+	data := fmt.Sprintf("fd=%d,rootmode=40000,user_id=%d,group_id=%d,default_permissions",
+		fd, os.Getuid(), os.Getgid())
+	flags := uintptr(unix.MS_NOSUID | unix.MS_NODEV)
+	if s.opts.ReadOnly {
+		flags |= unix.MS_RDONLY
+	}
+	if err := unix.Mount(s.opts.Name, s.dir, "fuse.c64u", flags, data); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("mount %s: %w", s.dir, err)
+	}
+	s.fd = fd
+	return nil
+}
+
+// mountFusermount mounts through the setuid fusermount helper, which
+// passes the opened /dev/fuse back over a socket
+func (s *Server) mountFusermount() error {
+	bin, err := fusermountPath()
+	if err != nil {
+		return err
+	}
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return err
+	}
+	local := os.NewFile(uintptr(fds[0]), "fusermount")
+	remote := os.NewFile(uintptr(fds[1]), "fusermount")
+	defer local.Close()
+
+	options := "default_permissions,fsname=" + s.opts.Name + ",subtype=c64u"
+	if s.opts.ReadOnly {
+		options += ",ro"
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(bin, "-o", options, "--", s.dir)
+	cmd.Env = append(os.Environ(), "_FUSE_COMMFD=3")
+	cmd.ExtraFiles = []*os.File{remote}
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		remote.Close()
+		return err
+	}
+	remote.Close()
+
+	fd, recvErr := receiveFD(int(local.Fd()))
+	if err := cmd.Wait(); err != nil || recvErr != nil {
+		if fd >= 0 {
+			unix.Close(fd)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", filepath.Base(bin), msg)
+		}
+		if err == nil {
+			err = recvErr
+		}
+		return fmt.Errorf("%s: %w", filepath.Base(bin), err)
+	}
+	s.fd = fd
+	s.fusermount = bin
+	return nil
+}
+
+// fusermountPath finds the fusermount helper
+func fusermountPath() (string, error) {
+	for _, name := range []string{"fusermount3", "fusermount"} {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.New("mounting as a regular user needs fusermount3 (install fuse3)")
+}
+
+// receiveFD reads a file descriptor sent with SCM_RIGHTS
+func receiveFD(sock int) (int, error) {
+	buf := make([]byte, 1)
+	oob := make([]byte, unix.CmsgSpace(4))
+	_, oobn, _, _, err := unix.Recvmsg(sock, buf, oob, 0)
+	if err != nil {
+		return -1, err
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) == 0 {
+		return -1, errors.New("no file descriptor received")
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) == 0 {
+		return -1, errors.New("no file descriptor received")
+	}
+	return fds[0], nil
+}
+
+// Dir returns the mount point
+func (s *Server) Dir() string {
+	return s.dir
+}
+
+// Unmount unmounts the file system, which makes Serve return. It fails
+// while files in it are in use.
+func (s *Server) Unmount() error {
+	if s.fusermount != "" {
+		out, err := exec.Command(s.fusermount, "-u", "--", s.dir).CombinedOutput()
+		if err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return errors.New(msg)
+			}
+			return err
+		}
+		return nil
+	}
+	if err := unix.Unmount(s.dir, 0); err != nil {
+		if errors.Is(err, unix.EBUSY) {
+			return fmt.Errorf("%s is busy: close files and shells using it first", s.dir)
+		}
+		return fmt.Errorf("unmount %s: %w", s.dir, err)
+	}
+	return nil
+}
+
+// Serve handles requests until the file system is unmounted
+func (s *Server) Serve() error {
+	defer unix.Close(s.fd)
+
+	buf := make([]byte, maxWrite+64*1024)
+	for {
+		n, err := unix.Read(s.fd, buf)
+		if err != nil {
+			switch {
+			case errors.Is(err, unix.EINTR), errors.Is(err, unix.EAGAIN), errors.Is(err, unix.ENOENT):
+				continue
+			case errors.Is(err, unix.ENODEV):
+				return nil
+			}
+			return fmt.Errorf("reading /dev/fuse: %w", err)
+		}
+		if n < inHeaderSize {
+			continue
+		}
+		opcode := le.Uint32(buf[4:])
+		unique := le.Uint64(buf[8:])
+		nodeid := le.Uint64(buf[16:])
+		body := buf[inHeaderSize:n]
+
+		switch opcode {
+		case opForget, opBatchForget, opInterrupt:
+			continue
+		}
+
+		out, errno := s.handle(opcode, nodeid, body)
+		s.reply(unique, errno, out)
+		if opcode == opDestroy {
+			return nil
+		}
+	}
+}
+
+// reply sends a response to the kernel
+func (s *Server) reply(unique uint64, errno syscall.Errno, payload []byte) {
+	if errno != 0 {
+		payload = nil
+	}
+	msg := make([]byte, outHeaderSize, outHeaderSize+len(payload))
+	le.PutUint32(msg[0:], uint32(outHeaderSize+len(payload)))
+	le.PutUint32(msg[4:], uint32(-int32(errno)))
+	le.PutUint64(msg[8:], unique)
+	msg = append(msg, payload...)
+	// ENOENT means the request was interrupted; nothing waits for the reply
+	unix.Write(s.fd, msg)
+}
+
+// handle dispatches a request, returning the reply payload
+func (s *Server) handle(opcode uint32, nodeid uint64, body []byte) ([]byte, syscall.Errno) {
+	name, ok := opNames[opcode]
+	if !ok {
+		return nil, unix.ENOSYS
+	}
+	p, known := s.nodes[nodeid]
+	if s.opts.Debug != nil {
+		s.opts.Debug(fmt.Sprintf("%s %s", name, p))
+	}
+	if !known && opcode != opInit && opcode != opDestroy {
+		return nil, unix.ENOENT
+	}
+
+	out, target, err := s.dispatch(opcode, nodeid, p, body)
+	if err != nil {
+		errno := toErrno(err)
+		if s.opts.Errors != nil && !(opcode == opLookup && errno == unix.ENOENT) {
+			if target == "" {
+				target = p
+			}
+			s.opts.Errors(name, target, err)
+		}
+		return nil, errno
+	}
+	return out, 0
+}
+
+// dispatch runs a request against the file system; target is the path the
+// request is about, if it differs from the node's
+func (s *Server) dispatch(opcode uint32, nodeid uint64, p string, body []byte) (out []byte, target string, err error) {
+	writes := opcode == opSetattr || opcode == opMkdir || opcode == opUnlink ||
+		opcode == opRmdir || opcode == opRename || opcode == opWrite || opcode == opCreate
+	if writes && s.opts.ReadOnly {
+		return nil, "", unix.EROFS
+	}
+
+	switch opcode {
+	case opInit:
+		return s.init(body), "", nil
+
+	case opDestroy:
+		return nil, "", nil
+
+	case opLookup:
+		child := path.Join(p, cstring(body))
+		a, err := s.attr(child)
+		if err != nil {
+			return nil, child, err
+		}
+		return s.entryOut(s.id(child), a), child, nil
+
+	case opGetattr:
+		a, err := s.attr(p)
+		if err != nil {
+			return nil, "", err
+		}
+		return s.attrOut(nodeid, a), "", nil
+
+	case opSetattr:
+		if valid := le.Uint32(body[0:]); valid&fattrSize != 0 {
+			var h *handle
+			if valid&fattrFH != 0 {
+				h = s.handles[le.Uint64(body[8:])]
+			}
+			if h == nil {
+				h = s.openFile(p)
+			}
+			if err := s.truncate(p, h, int(le.Uint64(body[16:]))); err != nil {
+				return nil, "", err
+			}
+		}
+		a, err := s.attr(p)
+		if err != nil {
+			return nil, "", err
+		}
+		return s.attrOut(nodeid, a), "", nil
+
+	case opMkdir:
+		child := path.Join(p, cstring(body[8:]))
+		if err := s.fs.Mkdir(child); err != nil {
+			return nil, child, err
+		}
+		a, err := s.fs.Stat(child)
+		if err != nil {
+			return nil, child, err
+		}
+		return s.entryOut(s.id(child), a), child, nil
+
+	case opUnlink, opRmdir:
+		child := path.Join(p, cstring(body))
+		if opcode == opUnlink {
+			err = s.fs.Remove(child)
+		} else {
+			err = s.fs.Rmdir(child)
+		}
+		if err != nil {
+			return nil, child, err
+		}
+		s.forget(child)
+		return nil, child, nil
+
+	case opRename:
+		newDir, ok := s.nodes[le.Uint64(body[0:])]
+		if !ok {
+			return nil, "", unix.ENOENT
+		}
+		names := bytes.SplitN(body[8:], []byte{0}, 3)
+		if len(names) < 2 {
+			return nil, "", unix.EINVAL
+		}
+		from := path.Join(p, string(names[0]))
+		to := path.Join(newDir, string(names[1]))
+		if err := s.flushPath(from); err != nil {
+			return nil, from, err
+		}
+		if err := s.fs.Rename(from, to); err != nil {
+			return nil, from, err
+		}
+		s.rename(from, to)
+		return nil, from, nil
+
+	case opOpen:
+		flags := int(le.Uint32(body[0:]))
+		if s.opts.ReadOnly && flags&unix.O_ACCMODE != unix.O_RDONLY {
+			return nil, "", unix.EROFS
+		}
+		h := &handle{path: p}
+		if flags&unix.O_TRUNC != 0 {
+			h.loaded, h.dirty = true, true
+		}
+		return s.openOut(s.addHandle(h)), "", nil
+
+	case opCreate:
+		child := path.Join(p, cstring(body[16:]))
+		h := &handle{path: child, loaded: true, dirty: true}
+		fh := s.addHandle(h)
+		a, err := s.attr(child)
+		if err != nil {
+			delete(s.handles, fh)
+			return nil, child, err
+		}
+		return append(s.entryOut(s.id(child), a), s.openOut(fh)...), child, nil
+
+	case opRead:
+		h := s.handles[le.Uint64(body[0:])]
+		if h == nil {
+			return nil, "", unix.EBADF
+		}
+		if err := s.load(h); err != nil {
+			return nil, "", err
+		}
+		off, size := le.Uint64(body[8:]), uint64(le.Uint32(body[16:]))
+		if off >= uint64(len(h.data)) {
+			return nil, "", nil
+		}
+		end := off + size
+		if end > uint64(len(h.data)) {
+			end = uint64(len(h.data))
+		}
+		return append([]byte(nil), h.data[off:end]...), "", nil
+
+	case opWrite:
+		h := s.handles[le.Uint64(body[0:])]
+		if h == nil {
+			return nil, "", unix.EBADF
+		}
+		if err := s.load(h); err != nil {
+			return nil, "", err
+		}
+		off, size := int(le.Uint64(body[8:])), int(le.Uint32(body[16:]))
+		data := body[40:]
+		if size > len(data) {
+			size = len(data)
+		}
+		if end := off + size; end > len(h.data) {
+			h.data = append(h.data, make([]byte, end-len(h.data))...)
+		}
+		copy(h.data[off:], data[:size])
+		h.dirty = true
+		out := make([]byte, 8)
+		le.PutUint32(out, uint32(size))
+		return out, "", nil
+
+	case opFlush, opFsync:
+		if h := s.handles[le.Uint64(body[0:])]; h != nil {
+			return nil, "", s.flush(h)
+		}
+		return nil, "", nil
+
+	case opRelease:
+		fh := le.Uint64(body[0:])
+		h := s.handles[fh]
+		delete(s.handles, fh)
+		if h != nil {
+			return nil, "", s.flush(h)
+		}
+		return nil, "", nil
+
+	case opStatfs:
+		st, err := s.fs.StatFS()
+		if err != nil {
+			return nil, "", err
+		}
+		out := make([]byte, 80)
+		le.PutUint64(out[0:], st.Blocks)
+		le.PutUint64(out[8:], st.Free)
+		le.PutUint64(out[16:], st.Free)
+		le.PutUint32(out[40:], st.BlockSize)
+		le.PutUint32(out[44:], 255)
+		le.PutUint32(out[48:], st.BlockSize)
+		return out, "", nil
+
+	case opOpendir:
+		entries, err := s.fs.ReadDir(p)
+		if err != nil {
+			return nil, "", err
+		}
+		return s.openOut(s.addHandle(&handle{path: p, dir: true, entries: entries})), "", nil
+
+	case opReaddir:
+		h := s.handles[le.Uint64(body[0:])]
+		if h == nil || !h.dir {
+			return nil, "", unix.EBADF
+		}
+		return s.readdir(nodeid, h, le.Uint64(body[8:]), int(le.Uint32(body[16:]))), "", nil
+
+	case opReleasedir:
+		delete(s.handles, le.Uint64(body[0:]))
+		return nil, "", nil
+
+	case opFsyncdir:
+		return nil, "", nil
+	}
+	return nil, "", unix.ENOSYS
+}
+
+// init answers the INIT handshake
+func (s *Server) init(body []byte) []byte {
+	readahead, flags := le.Uint32(body[8:]), le.Uint32(body[12:])
+	out := make([]byte, 64)
+	le.PutUint32(out[0:], protoMajor)
+	le.PutUint32(out[4:], protoMinor)
+	le.PutUint32(out[8:], readahead)
+	le.PutUint32(out[12:], flags&(initAtomicOTrunc|initBigWrites))
+	le.PutUint16(out[16:], 1)
+	le.PutUint16(out[18:], 1)
+	le.PutUint32(out[20:], maxWrite)
+	le.PutUint32(out[24:], 1)
+	return out
+}
+
+// =============================================================================
+// Nodes and handles
+// =============================================================================
+
+// id returns the node ID of a path, assigning one if needed
+func (s *Server) id(p string) uint64 {
+	if id, ok := s.ids[p]; ok {
+		return id
+	}
+	id := s.nextID
+	s.nextID++
+	s.ids[p] = id
+	s.nodes[id] = p
+	return id
+}
+
+// forget drops the IDs of a removed path and everything below it, so a
+// new file of the same name gets a new node
+func (s *Server) forget(p string) {
+	for q := range s.ids {
+		if q == p || strings.HasPrefix(q, p+"/") {
+			delete(s.ids, q)
+		}
+	}
+}
+
+// rename moves the nodes and open handles of a path and everything below it
+func (s *Server) rename(from, to string) {
+	s.forget(to)
+	moved := func(q string) (string, bool) {
+		if q == from {
+			return to, true
+		}
+		if strings.HasPrefix(q, from+"/") {
+			return to + q[len(from):], true
+		}
+		return "", false
+	}
+	for id, q := range s.nodes {
+		if n, ok := moved(q); ok {
+			s.nodes[id] = n
+			if s.ids[q] == id {
+				delete(s.ids, q)
+				s.ids[n] = id
+			}
+		}
+	}
+	for _, h := range s.handles {
+		if n, ok := moved(h.path); ok {
+			h.path = n
+		}
+	}
+}
+
+// addHandle registers an open file or directory
+func (s *Server) addHandle(h *handle) uint64 {
+	fh := s.nextFH
+	s.nextFH++
+	s.handles[fh] = h
+	return fh
+}
+
+// openFile returns an open handle of path holding unsaved contents
+func (s *Server) openFile(p string) *handle {
+	for _, h := range s.handles {
+		if !h.dir && h.path == p && h.dirty {
+			return h
+		}
+	}
+	return nil
+}
+
+// load reads a handle's file on first access
+func (s *Server) load(h *handle) error {
+	if h.loaded {
+		return nil
+	}
+	data, err := s.fs.ReadFile(h.path)
+	if err != nil {
+		return err
+	}
+	h.data, h.loaded = data, true
+	return nil
+}
+
+// flush writes a handle's changes back
+func (s *Server) flush(h *handle) error {
+	if !h.dirty {
+		return nil
+	}
+	if err := s.fs.WriteFile(h.path, h.data); err != nil {
+		return err
+	}
+	h.dirty = false
+	return nil
+}
+
+// flushPath writes back unsaved changes to a path before it is renamed
+func (s *Server) flushPath(p string) error {
+	if h := s.openFile(p); h != nil {
+		return s.flush(h)
+	}
+	return nil
+}
+
+// truncate changes the size of a file, open or not
+func (s *Server) truncate(p string, h *handle, size int) error {
+	resize := func(data []byte) []byte {
+		if size <= len(data) {
+			return data[:size]
+		}
+		return append(data, make([]byte, size-len(data))...)
+	}
+	if h != nil {
+		if err := s.load(h); err != nil {
+			return err
+		}
+		h.data, h.dirty = resize(h.data), true
+		return nil
+	}
+	data, err := s.fs.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	return s.fs.WriteFile(p, resize(data))
+}
+
+// attr returns the attributes of a path, taking unsaved changes of open
+// files into account
+func (s *Server) attr(p string) (Attr, error) {
+	a, err := s.fs.Stat(p)
+	if h := s.openFile(p); h != nil {
+		if err != nil {
+			// Created, but not written yet
+			a, err = Attr{ModTime: time.Now()}, nil
+		}
+		a.Size = int64(len(h.data))
+	}
+	return a, err
+}
+
+// =============================================================================
+// Encoding
+// =============================================================================
+
+func (s *Server) encodeAttr(out []byte, ino uint64, a Attr) {
+	mode := uint32(unix.S_IFREG | 0644)
+	nlink := uint32(1)
+	if a.Dir {
+		mode, nlink = unix.S_IFDIR|0755, 2
+	}
+	if s.opts.ReadOnly {
+		mode &^= 0222
+	}
+	sec, nsec := uint64(a.ModTime.Unix()), uint32(a.ModTime.Nanosecond())
+	if a.ModTime.IsZero() {
+		sec, nsec = 0, 0
+	}
+
+	le.PutUint64(out[0:], ino)
+	le.PutUint64(out[8:], uint64(a.Size))
+	le.PutUint64(out[16:], uint64(a.Size+511)/512)
+	for i := 0; i < 3; i++ {
+		le.PutUint64(out[24+8*i:], sec)
+		le.PutUint32(out[48+4*i:], nsec)
+	}
+	le.PutUint32(out[60:], mode)
+	le.PutUint32(out[64:], nlink)
+	le.PutUint32(out[68:], uint32(os.Getuid()))
+	le.PutUint32(out[72:], uint32(os.Getgid()))
+	le.PutUint32(out[80:], 4096)
+}
+
+func (s *Server) entryOut(id uint64, a Attr) []byte {
+	out := make([]byte, 128)
+	le.PutUint64(out[0:], id)
+	le.PutUint64(out[16:], uint64(ttl/time.Second))
+	le.PutUint64(out[24:], uint64(ttl/time.Second))
+	s.encodeAttr(out[40:], id, a)
+	return out
+}
+
+func (s *Server) attrOut(id uint64, a Attr) []byte {
+	out := make([]byte, 104)
+	le.PutUint64(out[0:], uint64(ttl/time.Second))
+	s.encodeAttr(out[16:], id, a)
+	return out
+}
+
+func (s *Server) openOut(fh uint64) []byte {
+	out := make([]byte, 16)
+	le.PutUint64(out[0:], fh)
+	return out
+}
+
+// readdir encodes directory entries from offset, as many as fit in size
+func (s *Server) readdir(nodeid uint64, h *handle, offset uint64, size int) []byte {
+	type dirent struct {
+		name string
+		ino  uint64
+		dir  bool
+	}
+	entries := []dirent{{".", nodeid, true}, {"..", 1, true}}
+	for _, e := range h.entries {
+		entries = append(entries, dirent{e.Name, s.id(path.Join(h.path, e.Name)), e.Dir})
+	}
+
+	var out []byte
+	for i := offset; i < uint64(len(entries)); i++ {
+		e := entries[i]
+		n := (24 + len(e.name) + 7) &^ 7
+		if len(out)+n > size {
+			break
+		}
+		rec := make([]byte, n)
+		le.PutUint64(rec[0:], e.ino)
+		le.PutUint64(rec[8:], i+1)
+		le.PutUint32(rec[16:], uint32(len(e.name)))
+		typ := uint32(unix.DT_REG)
+		if e.dir {
+			typ = unix.DT_DIR
+		}
+		le.PutUint32(rec[20:], typ)
+		copy(rec[24:], e.name)
+		out = append(out, rec...)
+	}
+	return out
+}
+
+// cstring returns the NUL-terminated string at the start of b
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return string(b[:i])
+	}
+	return string(b)
+}
+
+// toErrno maps file system errors to the errno returned to callers
+func toErrno(err error) syscall.Errno {
+	var errno syscall.Errno
+	switch {
+	case errors.As(err, &errno):
+		return errno
+	case errors.Is(err, fs.ErrNotExist):
+		return unix.ENOENT
+	case errors.Is(err, fs.ErrExist):
+		return unix.EEXIST
+	case errors.Is(err, fs.ErrPermission):
+		return unix.EACCES
+	case errors.Is(err, fs.ErrInvalid):
+		return unix.EINVAL
+	case errors.Is(err, ErrNoSpace):
+		return unix.ENOSPC
+	case errors.Is(err, ErrNotEmpty):
+		return unix.ENOTEMPTY
+	case errors.Is(err, ErrNotSupported):
+		return unix.ENOTSUP
+	case errors.Is(err, ErrNotDir):
+		return unix.ENOTDIR
+	case errors.Is(err, ErrIsDir):
+		return unix.EISDIR
+	}
+	return unix.EIO
+}
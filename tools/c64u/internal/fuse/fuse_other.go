@@ -0,0 +1,26 @@
+//go:build !linux
+
+package fuse
+
+// Server serves a FileSystem at a mount point
+type Server struct{}
+
+// Mount reports that FUSE is not available on this system
+func Mount(dir string, fsys FileSystem, opts Options) (*Server, error) {
+	return nil, ErrUnavailable
+}
+
+// Dir returns the mount point
+func (s *Server) Dir() string {
+	return ""
+}
+
+// Unmount unmounts the file system
+func (s *Server) Unmount() error {
+	return ErrUnavailable
+}
+
+// Serve handles requests until the file system is unmounted
+func (s *Server) Serve() error {
+	return ErrUnavailable
+}
@@ -0,0 +1,355 @@
+package g64
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ErrorCode is a sector's error info byte as stored in D64 images
+type ErrorCode byte
+
+// Error info bytes and the DOS errors they stand for
+const (
+	OK             ErrorCode = 0x01 // 00 OK
+	HeaderNotFound ErrorCode = 0x02 // 20 READ ERROR
+	NoSync         ErrorCode = 0x03 // 21 READ ERROR
+	DataNotFound   ErrorCode = 0x04 // 22 READ ERROR
+	DataChecksum   ErrorCode = 0x05 // 23 READ ERROR
+	HeaderChecksum ErrorCode = 0x09 // 27 READ ERROR
+	IDMismatch     ErrorCode = 0x0B // 29 DISK ID MISMATCH
+	DriveNotReady  ErrorCode = 0x0F // 74 DRIVE NOT READY
+)
+
+// errorNames maps error info bytes to the DOS error and its cause
+var errorNames = map[ErrorCode]string{
+	0x00:           "ok",
+	OK:             "ok",
+	HeaderNotFound: "20 header block not found",
+	NoSync:         "21 no sync",
+	DataNotFound:   "22 data block not found",
+	DataChecksum:   "23 data checksum error",
+	0x06:           "24 byte decoding error",
+	0x07:           "25 write verify error",
+	0x08:           "26 write protect on",
+	HeaderChecksum: "27 header checksum error",
+	0x0A:           "28 long data block",
+	IDMismatch:     "29 disk ID mismatch",
+	DriveNotReady:  "74 drive not ready",
+}
+
+// String returns the DOS error number and cause, e.g. "23 data checksum
+// error"
+func (e ErrorCode) String() string {
+	if s, ok := errorNames[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown error $%02X", byte(e))
+}
+
+// IsError reports whether the code stands for a read error
+func (e ErrorCode) IsError() bool {
+	return e > OK
+}
+
+// longSync is the sync length in bits above which a sync is reported as
+// unusual; the DOS writes 40 bits
+const longSync = 80
+
+// Block is a header or data block found after a sync mark
+type Block struct {
+	// Pos is the bit position of the block, SyncBits the length of the
+	// sync before it
+	Pos      int
+	SyncBits int
+	Marker   byte
+	// BadGCR counts codes that are not valid GCR
+	BadGCR int
+
+	// Header fields
+	Track, Sector int
+	ID            [2]byte
+	ChecksumOK    bool
+
+	// Data holds the 256 bytes of a data block
+	Data []byte
+}
+
+// IsHeader and IsData report the kind of block by its marker
+func (b Block) IsHeader() bool { return b.Marker == headerMarker }
+func (b Block) IsData() bool   { return b.Marker == dataMarker }
+
+// Sector is a sector as the drive would read it
+type Sector struct {
+	Sector int       `json:"sector"`
+	Error  ErrorCode `json:"error"`
+	Data   []byte    `json:"-"`
+}
+
+// TrackInfo is the analysis of a track
+type TrackInfo struct {
+	Track float64 `json:"track"`
+	Half  int     `json:"-"`
+	Bytes int     `json:"bytes"`
+	// Speed is the density zone of the image (-1: per-byte speeds),
+	// StandardSpeed the one the DOS uses on this track
+	Speed         int      `json:"speed"`
+	StandardSpeed int      `json:"standard_speed"`
+	Syncs         []int    `json:"syncs"`
+	Blocks        []Block  `json:"-"`
+	Sectors       []Sector `json:"sectors,omitempty"`
+	Anomalies     []string `json:"anomalies,omitempty"`
+	Missing       bool     `json:"missing,omitempty"`
+	present       bool
+}
+
+// Errors returns the sectors that have a read error
+func (t TrackInfo) Errors() []Sector {
+	var errs []Sector
+	for _, s := range t.Sectors {
+		if s.Error.IsError() {
+			errs = append(errs, s)
+		}
+	}
+	return errs
+}
+
+// Disk is the analysis of a whole image
+type Disk struct {
+	// ID is the disk ID most headers carry (first character first)
+	ID     [2]byte
+	Tracks []TrackInfo
+}
+
+// Track returns the analysis of a full track, or nil
+func (d *Disk) Track(track int) *TrackInfo {
+	for i := range d.Tracks {
+		if d.Tracks[i].Half == track*2 {
+			return &d.Tracks[i]
+		}
+	}
+	return nil
+}
+
+// Analyze decodes all tracks of an image. Tracks 1-35 that the image does
+// not have are included as missing.
+func Analyze(img *Image) *Disk {
+	d := &Disk{}
+	for _, t := range img.Tracks {
+		d.Tracks = append(d.Tracks, scanTrack(t))
+	}
+	for track := 1; track <= 35; track++ {
+		if img.Track(track) == nil {
+			d.Tracks = append(d.Tracks, TrackInfo{
+				Track:         float64(track),
+				Half:          track * 2,
+				Speed:         SpeedZone(track),
+				StandardSpeed: SpeedZone(track),
+				Missing:       true,
+			})
+		}
+	}
+	sort.Slice(d.Tracks, func(i, j int) bool { return d.Tracks[i].Half < d.Tracks[j].Half })
+
+	d.ID = majorityID(d.Tracks)
+	for i := range d.Tracks {
+		t := &d.Tracks[i]
+		if t.Half%2 == 0 && t.Half <= 84 {
+			t.Sectors = readSectors(t.Half/2, t, d.ID)
+		}
+		t.Anomalies = anomalies(t)
+	}
+	return d
+}
+
+// scanTrack finds the syncs and blocks of a track
+func scanTrack(t Track) TrackInfo {
+	track := (t.Half + 1) / 2
+	info := TrackInfo{
+		Track:         t.Number(),
+		Half:          t.Half,
+		Bytes:         len(t.Data),
+		Speed:         t.Speed,
+		StandardSpeed: SpeedZone(track),
+		Syncs:         []int{},
+		present:       true,
+	}
+	s := bitStream{t.Data}
+	syncs, all := s.findSyncs()
+	if all {
+		info.Anomalies = append(info.Anomalies, "killer track: no 0 bits at all")
+	}
+	for _, sy := range syncs {
+		info.Syncs = append(info.Syncs, sy.Bits)
+		b := Block{Pos: sy.end() % s.len(), SyncBits: sy.Bits}
+		marker, bad := s.decode(b.Pos, 1)
+		b.Marker, b.BadGCR = marker[0], bad
+		switch b.Marker {
+		case headerMarker:
+			h, bad := s.decode(b.Pos, headerSize)
+			b.BadGCR = bad
+			b.Sector, b.Track = int(h[2]), int(h[3])
+			b.ID = [2]byte{h[5], h[4]}
+			b.ChecksumOK = bad == 0 && h[1] == h[2]^h[3]^h[4]^h[5]
+		case dataMarker:
+			data, bad := s.decode(b.Pos, dataSize)
+			b.BadGCR = bad
+			b.Data = data[1:257]
+			b.ChecksumOK = bad == 0 && checksum(b.Data) == data[257]
+		}
+		info.Blocks = append(info.Blocks, b)
+	}
+	return info
+}
+
+// majorityID returns the disk ID found in most valid headers
+func majorityID(tracks []TrackInfo) [2]byte {
+	counts := map[[2]byte]int{}
+	var best [2]byte
+	for _, t := range tracks {
+		for _, b := range t.Blocks {
+			if b.IsHeader() && b.ChecksumOK {
+				counts[b.ID]++
+				if counts[b.ID] > counts[best] {
+					best = b.ID
+				}
+			}
+		}
+	}
+	return best
+}
+
+// readSectors reads the sectors of a full track as the DOS would, taking
+// the first header of each sector
+func readSectors(track int, t *TrackInfo, id [2]byte) []Sector {
+	sectors := make([]Sector, SectorsPerTrack(track))
+	for s := range sectors {
+		sectors[s] = readSector(track, s, t, id)
+	}
+	return sectors
+}
+
+// readSector reads one sector; the data block is the one after its header
+func readSector(track, sector int, t *TrackInfo, id [2]byte) Sector {
+	s := Sector{Sector: sector, Error: HeaderNotFound, Data: make([]byte, 256)}
+	if !t.present || len(t.Syncs) == 0 {
+		s.Error = NoSync
+		return s
+	}
+
+	at := -1
+	for i, b := range t.Blocks {
+		if !b.IsHeader() || b.Track != track || b.Sector != sector {
+			continue
+		}
+		if b.ChecksumOK {
+			at = i
+			break
+		}
+		s.Error = HeaderChecksum
+	}
+	if at < 0 {
+		return s
+	}
+
+	s.Error = OK
+	if t.Blocks[at].ID != id {
+		s.Error = IDMismatch
+	}
+	next := t.Blocks[(at+1)%len(t.Blocks)]
+	if !next.IsData() {
+		if s.Error == OK {
+			s.Error = DataNotFound
+		}
+		return s
+	}
+	copy(s.Data, next.Data)
+	if !next.ChecksumOK && s.Error == OK {
+		s.Error = DataChecksum
+	}
+	return s
+}
+
+// anomalies lists what is unusual about a track for the 1541 DOS, as copy
+// protections make use of
+func anomalies(t *TrackInfo) []string {
+	list := t.Anomalies
+	if t.Missing {
+		return append(list, "not in the image")
+	}
+	if t.Half%2 == 1 {
+		if len(t.Syncs) > 0 {
+			list = append(list, "half track with data")
+		}
+		return list
+	}
+
+	switch {
+	case t.Speed < 0:
+		list = append(list, "variable density (speed per byte)")
+	case t.Speed != t.StandardSpeed:
+		list = append(list, fmt.Sprintf("density zone %d (standard %d)", t.Speed, t.StandardSpeed))
+	}
+	zone := t.StandardSpeed
+	if t.Speed >= 0 {
+		zone = t.Speed
+	}
+	if nominal := NominalSize(zone); t.Bytes > nominal*102/100 {
+		list = append(list, fmt.Sprintf("long track: %d bytes (nominal %d)", t.Bytes, nominal))
+	}
+	if len(t.Syncs) == 0 && len(list) == 0 {
+		list = append(list, "no sync marks")
+	}
+
+	long, longest := 0, 0
+	for _, bits := range t.Syncs {
+		if bits > longSync {
+			long++
+			longest = max(longest, bits)
+		}
+	}
+	if long > 0 {
+		list = append(list, fmt.Sprintf("%d long sync(s), up to %d bits", long, longest))
+	}
+
+	track := t.Half / 2
+	seen := map[int]int{}
+	var foreign, unknown, badGCR int
+	for _, b := range t.Blocks {
+		switch {
+		case b.IsHeader():
+			if b.Track != track {
+				foreign++
+				continue
+			}
+			seen[b.Sector]++
+		case !b.IsData():
+			unknown++
+		}
+		if b.BadGCR > 0 {
+			badGCR++
+		}
+	}
+	keys := make([]int, 0, len(seen))
+	for s := range seen {
+		keys = append(keys, s)
+	}
+	sort.Ints(keys)
+	for _, s := range keys {
+		switch {
+		case s >= SectorsPerTrack(track):
+			list = append(list, fmt.Sprintf("extra sector %d", s))
+		case seen[s] > 1:
+			list = append(list, fmt.Sprintf("sector %d appears %d times", s, seen[s]))
+		}
+	}
+	if foreign > 0 {
+		list = append(list, fmt.Sprintf("%d header(s) for other tracks", foreign))
+	}
+	if unknown > 0 {
+		list = append(list, fmt.Sprintf("%d block(s) with non-standard markers", unknown))
+	}
+	if badGCR > 0 {
+		list = append(list, fmt.Sprintf("%d block(s) with invalid GCR", badGCR))
+	}
+	return list
+}
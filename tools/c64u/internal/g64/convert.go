@@ -0,0 +1,146 @@
+package g64
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+)
+
+// ============================================================================
+// D64 conversion
+// ============================================================================
+
+// ToD64 builds a D64 image from the sectors of an analyzed disk. It has 40
+// tracks if any of tracks 36-40 can be read, and error info bytes if any
+// sector has a read error and errorInfo is set.
+func ToD64(d *Disk, errorInfo bool) (*diskimage.Image, error) {
+	tracks := 35
+	for track := 36; track <= 40; track++ {
+		if t := d.Track(track); t != nil {
+			for _, s := range t.Sectors {
+				if s.Error == OK {
+					tracks = 40
+				}
+			}
+		}
+	}
+
+	var data, errs []byte
+	hasErrors := false
+	for track := 1; track <= tracks; track++ {
+		t := d.Track(track)
+		for s := 0; s < SectorsPerTrack(track); s++ {
+			sec := Sector{Error: NoSync, Data: make([]byte, 256)}
+			if t != nil && s < len(t.Sectors) {
+				sec = t.Sectors[s]
+			}
+			data = append(data, sec.Data...)
+			errs = append(errs, byte(sec.Error))
+			hasErrors = hasErrors || sec.Error.IsError()
+		}
+	}
+	if errorInfo && hasErrors {
+		data = append(data, errs...)
+	}
+	return diskimage.Parse(data)
+}
+
+// sectorSize is the size of an encoded sector with the DOS's gaps but
+// without the gap at its end: sync, header, header gap, sync, data block
+const sectorSize = 5 + 10 + 9 + 5 + 325
+
+// FromD64 encodes a D64 image as the 1541 DOS would have written it.
+// Sectors with error info are written so that the drive reports the same
+// error; unrepresentable lists the sectors whose error cannot be written
+// as GCR (they are written without error).
+func FromD64(img *diskimage.Image) (g *Image, unrepresentable []string, err error) {
+	if img.Format != diskimage.D64 {
+		return nil, nil, diskimage.ErrUnsupported
+	}
+	var id [2]byte
+	copy(id[:], img.ID())
+
+	g = &Image{}
+	for track := 1; track <= img.Tracks; track++ {
+		n := SectorsPerTrack(track)
+		sectors := make([][]byte, n)
+		codes := make([]ErrorCode, n)
+		for s := 0; s < n; s++ {
+			if sectors[s], err = img.Sector(track, s); err != nil {
+				return nil, nil, err
+			}
+			codes[s] = OK
+			if b, ok := img.ErrorByte(track, s); ok && ErrorCode(b).IsError() {
+				codes[s] = ErrorCode(b)
+				switch codes[s] {
+				case HeaderNotFound, NoSync, DataNotFound, DataChecksum, HeaderChecksum, IDMismatch:
+				case DriveNotReady:
+					codes[s] = NoSync
+				default:
+					unrepresentable = append(unrepresentable, fmtSector(track, s, codes[s]))
+					codes[s] = OK
+				}
+			}
+		}
+		g.Tracks = append(g.Tracks, Track{
+			Half:  track * 2,
+			Data:  encodeTrack(track, sectors, codes, id),
+			Speed: SpeedZone(track),
+		})
+	}
+	return g, unrepresentable, nil
+}
+
+// encodeTrack writes the sectors of a track with the DOS's layout: a sync
+// and header, a gap of 9 bytes, a sync and the data block, and the tail
+// gaps filling the track to its nominal size
+func encodeTrack(track int, sectors [][]byte, codes []ErrorCode, id [2]byte) []byte {
+	size := NominalSize(SpeedZone(track))
+	noSync := true
+	for _, c := range codes {
+		noSync = noSync && c == NoSync
+	}
+	if noSync {
+		return bytes.Repeat([]byte{0x55}, size)
+	}
+
+	syncMark := bytes.Repeat([]byte{0xFF}, 5)
+	gap := (size - len(sectors)*sectorSize) / len(sectors)
+	out := make([]byte, 0, size)
+	for s, data := range sectors {
+		h := header(track, s, id)
+		b := dataBlock(data)
+		switch codes[s] {
+		case HeaderNotFound:
+			h[0] = 0
+		case HeaderChecksum:
+			h[1] ^= 0xFF
+		case IDMismatch:
+			h[4], h[5] = h[4]^0xFF, h[5]^0xFF
+			h[1] = h[2] ^ h[3] ^ h[4] ^ h[5]
+		case DataNotFound:
+			b[0] = 0
+		case DataChecksum:
+			b[257] ^= 0xFF
+		}
+
+		if codes[s] == NoSync {
+			out = append(out, bytes.Repeat([]byte{0x55}, len(syncMark))...)
+		} else {
+			out = append(out, syncMark...)
+		}
+		out = append(out, encodeGCR(h)...)
+		out = append(out, bytes.Repeat([]byte{0x55}, 9)...)
+		out = append(out, syncMark...)
+		out = append(out, encodeGCR(b)...)
+		out = append(out, bytes.Repeat([]byte{0x55}, gap)...)
+	}
+	return append(out, bytes.Repeat([]byte{0x55}, size-len(out))...)
+}
+
+// fmtSector describes a sector with an error, e.g. "18/1: 25 write verify
+// error"
+func fmtSector(track, sector int, code ErrorCode) string {
+	return fmt.Sprintf("%d/%d: %s", track, sector, code)
+}
@@ -0,0 +1,189 @@
+// Package g64 reads and writes G64 images, which hold the raw GCR bit
+// stream of each (half) track of a 1541 disk together with its recording
+// density, and decodes them into sectors with the drive's error codes.
+package g64
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Errors returned when reading images
+var (
+	ErrFormat = errors.New("not a G64 image")
+	ErrG71    = errors.New("G71 (1571) images are not supported")
+)
+
+const (
+	signature = "GCR-1541"
+	// halfTracks is the number of half tracks of a standard G64
+	halfTracks = 84
+	// maxTrackSize is the track buffer size of a standard G64
+	maxTrackSize = 7928
+)
+
+// Track is the raw content of a (half) track
+type Track struct {
+	// Half is the half track number: 2 for track 1, 3 for track 1.5, ...
+	Half int
+	Data []byte
+	// Speed is the density zone (0-3, 3 being the densest) used for the
+	// whole track; -1 if the image gives a speed per byte instead
+	Speed int
+}
+
+// Number returns the track number, e.g. 18 or 18.5
+func (t Track) Number() float64 {
+	return float64(t.Half) / 2
+}
+
+// IsHalf reports whether the track lies between two full tracks
+func (t Track) IsHalf() bool {
+	return t.Half%2 == 1
+}
+
+// Image is a G64 image held in memory
+type Image struct {
+	Version int
+	// Tracks are the tracks with data, in order
+	Tracks []Track
+}
+
+// Open reads a G64 image file
+func Open(path string) (*Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	img, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return img, nil
+}
+
+// Parse interprets G64 image data
+func Parse(data []byte) (*Image, error) {
+	if len(data) < 12 || !bytes.HasPrefix(data, []byte("GCR-15")) {
+		return nil, ErrFormat
+	}
+	if string(data[:8]) == "GCR-1571" {
+		return nil, ErrG71
+	}
+	if string(data[:8]) != signature {
+		return nil, ErrFormat
+	}
+
+	count := int(data[9])
+	tables := 12 + count*8
+	if len(data) < tables {
+		return nil, fmt.Errorf("%w: truncated track table", ErrFormat)
+	}
+	img := &Image{Version: int(data[8])}
+	for i := 0; i < count; i++ {
+		off := int(binary.LittleEndian.Uint32(data[12+i*4:]))
+		speed := int(binary.LittleEndian.Uint32(data[12+count*4+i*4:]))
+		if off == 0 {
+			continue
+		}
+		if off+2 > len(data) {
+			return nil, fmt.Errorf("%w: track %.1f lies outside the file", ErrFormat, float64(i+2)/2)
+		}
+		size := int(binary.LittleEndian.Uint16(data[off:]))
+		if off+2+size > len(data) {
+			return nil, fmt.Errorf("%w: track %.1f is truncated", ErrFormat, float64(i+2)/2)
+		}
+		if speed > 3 {
+			speed = -1
+		}
+		img.Tracks = append(img.Tracks, Track{
+			Half:  i + 2,
+			Data:  append([]byte(nil), data[off+2:off+2+size]...),
+			Speed: speed,
+		})
+	}
+	return img, nil
+}
+
+// Track returns a full track (1-42), or nil if the image does not have it
+func (img *Image) Track(track int) *Track {
+	for i := range img.Tracks {
+		if img.Tracks[i].Half == track*2 {
+			return &img.Tracks[i]
+		}
+	}
+	return nil
+}
+
+// Bytes returns the image file contents. Tracks with a per-byte speed are
+// written with their standard zone.
+func (img *Image) Bytes() []byte {
+	size := maxTrackSize
+	for _, t := range img.Tracks {
+		if len(t.Data) > size {
+			size = len(t.Data)
+		}
+	}
+
+	out := make([]byte, 12+halfTracks*8)
+	copy(out, signature)
+	out[8] = byte(img.Version)
+	out[9] = halfTracks
+	binary.LittleEndian.PutUint16(out[10:], uint16(size))
+	for _, t := range img.Tracks {
+		i := t.Half - 2
+		if i < 0 || i >= halfTracks {
+			continue
+		}
+		speed := t.Speed
+		if speed < 0 {
+			speed = SpeedZone((t.Half + 1) / 2)
+		}
+		binary.LittleEndian.PutUint32(out[12+i*4:], uint32(len(out)))
+		binary.LittleEndian.PutUint32(out[12+halfTracks*4+i*4:], uint32(speed))
+
+		buf := make([]byte, 2+size)
+		binary.LittleEndian.PutUint16(buf, uint16(len(t.Data)))
+		copy(buf[2:], t.Data)
+		out = append(out, buf...)
+	}
+	return out
+}
+
+// Save writes the image to path, replacing the file atomically
+func (img *Image) Save(path string) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, img.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SpeedZone returns the density zone the 1541 DOS uses for a track
+func SpeedZone(track int) int {
+	switch {
+	case track <= 17:
+		return 3
+	case track <= 24:
+		return 2
+	case track <= 30:
+		return 1
+	}
+	return 0
+}
+
+// SectorsPerTrack returns the number of sectors the 1541 DOS writes on a
+// track
+func SectorsPerTrack(track int) int {
+	return []int{17, 18, 19, 21}[SpeedZone(track)]
+}
+
+// NominalSize returns the number of bytes a track of a density zone holds
+// at the nominal 300 rpm
+func NominalSize(zone int) int {
+	return []int{6250, 6666, 7142, 7692}[zone]
+}
@@ -0,0 +1,180 @@
+package g64
+
+import "sort"
+
+// ============================================================================
+// GCR coding
+// ============================================================================
+
+// gcrEncode maps a nybble to its 5-bit GCR code
+var gcrEncode = [16]byte{
+	0x0A, 0x0B, 0x12, 0x13, 0x0E, 0x0F, 0x16, 0x17,
+	0x09, 0x19, 0x1A, 0x1B, 0x0D, 0x1D, 0x1E, 0x15,
+}
+
+// gcrDecode maps a 5-bit GCR code to its nybble, or -1 for codes the
+// drive cannot decode
+var gcrDecode = func() [32]int {
+	var t [32]int
+	for i := range t {
+		t[i] = -1
+	}
+	for n, c := range gcrEncode {
+		t[c] = n
+	}
+	return t
+}()
+
+// encodeGCR encodes bytes (a multiple of 4) as GCR, 5 bytes per 4
+func encodeGCR(data []byte) []byte {
+	out := make([]byte, 0, len(data)*5/4)
+	var acc uint64
+	bits := 0
+	for _, b := range data {
+		acc = acc<<10 | uint64(gcrEncode[b>>4])<<5 | uint64(gcrEncode[b&0x0F])
+		bits += 10
+		for bits >= 8 {
+			bits -= 8
+			out = append(out, byte(acc>>bits))
+		}
+	}
+	return out
+}
+
+// bitStream reads the bits of a track, wrapping around at the end as the
+// disk rotates
+type bitStream struct {
+	data []byte
+}
+
+// len returns the number of bits on the track
+func (s bitStream) len() int {
+	return len(s.data) * 8
+}
+
+// bit returns the bit at position i (modulo the track length)
+func (s bitStream) bit(i int) int {
+	i %= s.len()
+	return int(s.data[i/8]>>(7-i%8)) & 1
+}
+
+// bits returns n bits starting at position i, most significant first
+func (s bitStream) bits(i, n int) int {
+	v := 0
+	for k := 0; k < n; k++ {
+		v = v<<1 | s.bit(i+k)
+	}
+	return v
+}
+
+// decode decodes n bytes of GCR data starting at bit position i. bad
+// counts the 5-bit codes that are not valid GCR (decoded as 0).
+func (s bitStream) decode(i, n int) (out []byte, bad int) {
+	out = make([]byte, n)
+	for k := range out {
+		hi := gcrDecode[s.bits(i+k*10, 5)]
+		lo := gcrDecode[s.bits(i+k*10+5, 5)]
+		if hi < 0 || lo < 0 {
+			bad++
+			hi, lo = max(hi, 0), max(lo, 0)
+		}
+		out[k] = byte(hi<<4 | lo)
+	}
+	return out, bad
+}
+
+// minSync is the number of 1 bits the drive takes as a sync mark
+const minSync = 10
+
+// sync is a sync mark on a track
+type sync struct {
+	// Start is the bit position of the first 1 bit, Bits the length
+	Start, Bits int
+}
+
+// end returns the bit position of the data following the sync
+func (s sync) end() int {
+	return s.Start + s.Bits
+}
+
+// findSyncs returns the sync marks of a track in order. all is true if the
+// whole track is 1 bits (a "killer" track).
+func (s bitStream) findSyncs() (syncs []sync, all bool) {
+	n := s.len()
+	if n == 0 {
+		return nil, false
+	}
+	// Start after a 0 bit, so no run is split at the wrap-around
+	first := -1
+	for i := 0; i < n; i++ {
+		if s.bit(i) == 0 {
+			first = i + 1
+			break
+		}
+	}
+	if first < 0 {
+		return nil, true
+	}
+
+	run := 0
+	for k := 0; k < n; k++ {
+		i := first + k
+		if s.bit(i) == 1 {
+			run++
+			continue
+		}
+		if run >= minSync {
+			syncs = append(syncs, sync{Start: (i - run) % n, Bits: run})
+		}
+		run = 0
+	}
+	if run >= minSync {
+		syncs = append(syncs, sync{Start: (first + n - run) % n, Bits: run})
+	}
+	// Order by the data that follows, which a sync across the end wraps to
+	sort.Slice(syncs, func(i, j int) bool { return syncs[i].end()%n < syncs[j].end()%n })
+	return syncs, false
+}
+
+// ============================================================================
+// Blocks
+// ============================================================================
+
+// Block markers: the first byte after a sync
+const (
+	headerMarker = 0x08
+	dataMarker   = 0x07
+)
+
+const (
+	// headerSize and dataSize are the decoded sizes of header and data
+	// blocks including the marker
+	headerSize = 8
+	dataSize   = 260
+)
+
+// header builds the decoded header block of a sector. id is the disk ID
+// as stored in the BAM (first character first).
+func header(track, sector int, id [2]byte) []byte {
+	h := []byte{headerMarker, 0, byte(sector), byte(track), id[1], id[0], 0x0F, 0x0F}
+	h[1] = h[2] ^ h[3] ^ h[4] ^ h[5]
+	return h
+}
+
+// dataBlock builds the decoded data block of a sector
+func dataBlock(data []byte) []byte {
+	b := make([]byte, dataSize)
+	b[0] = dataMarker
+	copy(b[1:], data)
+	b[257] = checksum(data)
+	return b
+}
+
+// checksum returns the XOR of data, as used by header and data blocks
+func checksum(data []byte) byte {
+	var c byte
+	for _, b := range data {
+		c ^= b
+	}
+	return c
+}
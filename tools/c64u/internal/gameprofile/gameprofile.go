@@ -0,0 +1,205 @@
+// Package gameprofile loads the launch profiles of "c64u game": the
+// settings, mounts and program a title needs.
+package gameprofile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Profile is a title and what launching it takes. Local paths are
+// resolved against the directory of the profile.
+type Profile struct {
+	Name        string
+	Description string
+	Path        string
+	// Run is the PRG or CRT to start: a local file, or a file on the
+	// device if there is none
+	Run string
+	// Load is the file loaded from the first mounted drive with
+	// LOAD"name",8,1 when there is nothing to run; "*" by default
+	Load string
+	// DriveMode is the mode (1541, 1571, 1581) of drive 8
+	DriveMode string
+	// REU is the REU size, e.g. "512K" or "16M", or "off"
+	REU string
+	// SID is the UltiSID model, 6581 or 8580
+	SID string
+	// Joystick is the port the title reads; 1 swaps the ports so the
+	// stick in port 2 reaches it. 0 leaves the ports alone.
+	Joystick int
+	Mounts   []Mount
+	// Settings are further device settings: category -> item -> value
+	Settings map[string]map[string]string
+}
+
+// Mount is an image for a drive
+type Mount struct {
+	Drive string
+	// Image is a local file, which is uploaded, or a path on the device
+	Image string
+	Type  string
+	Mode  string
+	// DriveMode is the mode the drive needs for the image
+	DriveMode string
+}
+
+// file is the TOML form of a profile
+type file struct {
+	Description string                       `toml:"description"`
+	Run         string                       `toml:"run"`
+	Load        string                       `toml:"load"`
+	DriveMode   string                       `toml:"drive_mode"`
+	REU         string                       `toml:"reu"`
+	SID         string                       `toml:"sid"`
+	Joystick    int                          `toml:"joystick"`
+	Mounts      []mount                      `toml:"mount"`
+	Settings    map[string]map[string]string `toml:"settings"`
+}
+
+type mount struct {
+	Drive     string `toml:"drive"`
+	Image     string `toml:"image"`
+	Type      string `toml:"type"`
+	Mode      string `toml:"mode"`
+	DriveMode string `toml:"drive_mode"`
+}
+
+var (
+	driveModes = map[string]bool{"": true, "1541": true, "1571": true, "1581": true}
+	mountModes = map[string]bool{"": true, "readwrite": true, "readonly": true, "unlinked": true}
+	reuSize    = regexp.MustCompile(`^(?i)(\d+)\s*([KM])B?$`)
+)
+
+// Dir returns the directory of the profiles below a config directory
+func Dir(configDir string) string {
+	return filepath.Join(configDir, "games")
+}
+
+// Load returns the profile with a name from dir, or the profile in a
+// .toml file given by its path
+func Load(dir, name string) (*Profile, error) {
+	if strings.HasSuffix(name, ".toml") {
+		return parseFile(name)
+	}
+	path := filepath.Join(dir, name+".toml")
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("no profile '%s' in %s (see c64u game list)", name, dir)
+	}
+	return parseFile(path)
+}
+
+// List returns the profiles in dir, by name
+func List(dir string) ([]*Profile, error) {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.toml"))
+	list := make([]*Profile, 0, len(paths))
+	for _, p := range paths {
+		profile, err := parseFile(p)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, profile)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// ReuSize returns an REU size as "512K" or "16M", the way it is compared
+// with the options of the device setting
+func ReuSize(s string) (string, bool) {
+	m := reuSize.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return "", false
+	}
+	return m[1] + strings.ToUpper(m[2]), true
+}
+
+// parseFile reads a profile, named after its file
+func parseFile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := toml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	p := &Profile{
+		Name:        strings.TrimSuffix(filepath.Base(path), ".toml"),
+		Description: f.Description,
+		Path:        path,
+		Run:         local(dir, f.Run),
+		Load:        f.Load,
+		DriveMode:   f.DriveMode,
+		REU:         f.REU,
+		SID:         f.SID,
+		Joystick:    f.Joystick,
+		Settings:    f.Settings,
+	}
+	fail := func(format string, args ...interface{}) (*Profile, error) {
+		return nil, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case p.Run != "" && p.Load != "":
+		return fail("give either run or load, not both")
+	case p.Load != "" && len(f.Mounts) == 0:
+		return fail("load needs a [[mount]] to load from")
+	case !driveModes[p.DriveMode]:
+		return fail("drive_mode must be 1541, 1571 or 1581, not '%s'", p.DriveMode)
+	case p.SID != "" && p.SID != "6581" && p.SID != "8580":
+		return fail("sid must be 6581 or 8580, not '%s'", p.SID)
+	case p.Joystick < 0 || p.Joystick > 2:
+		return fail("joystick must be 1 or 2")
+	}
+	if p.REU != "" && !strings.EqualFold(p.REU, "off") {
+		if _, ok := ReuSize(p.REU); !ok {
+			return fail("reu must be a size such as 512K or 16M, or off; not '%s'", p.REU)
+		}
+	}
+
+	drives := make(map[string]bool)
+	for i, m := range f.Mounts {
+		switch {
+		case m.Drive == "" || m.Image == "":
+			return fail("mount %d needs a drive and an image", i+1)
+		case drives[m.Drive]:
+			return fail("drive %s is mounted twice", m.Drive)
+		case !mountModes[m.Mode]:
+			return fail("mount %d: mode must be readwrite, readonly or unlinked, not '%s'", i+1, m.Mode)
+		case !driveModes[m.DriveMode]:
+			return fail("mount %d: drive_mode must be 1541, 1571 or 1581, not '%s'", i+1, m.DriveMode)
+		}
+		drives[m.Drive] = true
+		p.Mounts = append(p.Mounts, Mount{
+			Drive:     m.Drive,
+			Image:     local(dir, m.Image),
+			Type:      m.Type,
+			Mode:      m.Mode,
+			DriveMode: m.DriveMode,
+		})
+	}
+	if p.Run == "" && p.Load == "" {
+		if len(p.Mounts) == 0 {
+			return fail("nothing to launch: give run, or a [[mount]] to load from")
+		}
+		p.Load = "*"
+	}
+	return p, nil
+}
+
+// local resolves a relative path against dir; device paths are absolute
+func local(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,127 @@
+package history
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Upload records a file sent to the device
+type Upload struct {
+	Time   time.Time `json:"time"`
+	Device string    `json:"device"`
+	// Kind is the operation, e.g. "run_prg", "mount" or "load_rom"
+	Kind string `json:"kind"`
+	// Target is where the file went: "runner" or a drive name
+	Target string `json:"target"`
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// NewUpload describes the upload of a local file, hashing its contents
+func NewUpload(device, kind, target, local string) (Upload, error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return Upload{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	abs, err := filepath.Abs(local)
+	if err != nil {
+		abs = local
+	}
+
+	return Upload{
+		Time:   time.Now(),
+		Device: device,
+		Kind:   kind,
+		Target: target,
+		File:   abs,
+		Size:   size,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// Append adds an upload to the manifest (JSON Lines)
+func Append(path string, u Upload) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Read returns all recorded uploads, oldest first. A missing manifest is
+// an empty history.
+func Read(path string) ([]Upload, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var uploads []Upload
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var u Upload
+		if err := json.Unmarshal(scanner.Bytes(), &u); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, scanner.Err()
+}
+
+// Current returns the latest upload per device and target, i.e. what is
+// presumably loaded or mounted right now, ordered by target
+func Current(uploads []Upload) []Upload {
+	latest := make(map[string]Upload)
+	for _, u := range uploads {
+		key := u.Device + "\x00" + u.Target
+		if prev, ok := latest[key]; !ok || !u.Time.Before(prev.Time) {
+			latest[key] = u
+		}
+	}
+
+	current := make([]Upload, 0, len(latest))
+	for _, u := range latest {
+		current = append(current, u)
+	}
+	sort.Slice(current, func(i, j int) bool {
+		if current[i].Device != current[j].Device {
+			return current[i].Device < current[j].Device
+		}
+		return current[i].Target < current[j].Target
+	})
+	return current
+}
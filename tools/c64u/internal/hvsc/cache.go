@@ -0,0 +1,68 @@
+package hvsc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheVersion is increased when the parsed representation changes
+const cacheVersion = 1
+
+// cacheFile is the parsed contents of a database file, with what is
+// needed to tell whether the file changed since
+type cacheFile struct {
+	Version int             `json:"version"`
+	Source  string          `json:"source"`
+	Size    int64           `json:"size"`
+	ModTime time.Time       `json:"mod_time"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// loadCached fills v from the cache of source in cacheDir if it is
+// current, and otherwise parses source and updates the cache. Failing to
+// write the cache is not an error.
+func loadCached(source, cacheDir string, v interface{}, parse func(io.Reader) error) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	abs, _ := filepath.Abs(source)
+	sum := sha256.Sum256([]byte(abs))
+	cachePath := filepath.Join(cacheDir, filepath.Base(source)+"-"+hex.EncodeToString(sum[:4])+".json")
+
+	if cacheDir != "" {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			var c cacheFile
+			if json.Unmarshal(data, &c) == nil && c.Version == cacheVersion && c.Source == abs &&
+				c.Size == info.Size() && c.ModTime.Equal(info.ModTime()) && json.Unmarshal(c.Data, v) == nil {
+				return nil
+			}
+		}
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := parse(f); err != nil {
+		return err
+	}
+
+	if cacheDir != "" {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		c, _ := json.Marshal(cacheFile{Version: cacheVersion, Source: abs, Size: info.Size(), ModTime: info.ModTime(), Data: data})
+		if os.MkdirAll(cacheDir, 0755) == nil {
+			os.WriteFile(cachePath, c, 0644)
+		}
+	}
+	return nil
+}
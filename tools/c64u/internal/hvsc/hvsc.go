@@ -0,0 +1,324 @@
+// Package hvsc reads the song length database (Songlengths.md5) and the
+// SID Tune Information List (STIL.txt) of the High Voltage SID Collection,
+// to name and time the songs of a SID file.
+package hvsc
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoDatabase is returned when neither Songlengths.md5 nor STIL.txt is
+// available
+var ErrNoDatabase = errors.New("no Songlengths.md5 or STIL.txt found")
+
+// DB is a loaded song length database and STIL; either may be empty
+type DB struct {
+	// lengths maps the MD5 of a SID file to the durations of its songs
+	lengths map[string][]time.Duration
+	// paths maps the MD5 of a SID file to its path in the collection
+	paths map[string]string
+	stil  map[string]*Entry
+}
+
+// Entry is the STIL information of a SID file
+type Entry struct {
+	// Comment is about the file as a whole
+	Comment string `json:"comment,omitempty"`
+	// Songs holds the information per song (1-based); song 0 is used for
+	// files with a single song
+	Songs map[int]*Song `json:"songs,omitempty"`
+}
+
+// Song is the STIL information of one song
+type Song struct {
+	Name string `json:"name,omitempty"`
+	// Title and Artist name the original of a cover
+	Title   string `json:"title,omitempty"`
+	Artist  string `json:"artist,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// Sources names the database files to load; empty names are skipped
+type Sources struct {
+	Songlengths string
+	STIL        string
+}
+
+// Locate finds Songlengths.md5 and STIL.txt in an HVSC directory (or its
+// DOCUMENTS subdirectory); files not found are left empty
+func Locate(dir string) Sources {
+	var src Sources
+	for _, d := range []string{filepath.Join(dir, "DOCUMENTS"), dir} {
+		if p := filepath.Join(d, "Songlengths.md5"); src.Songlengths == "" && isFile(p) {
+			src.Songlengths = p
+		}
+		if p := filepath.Join(d, "STIL.txt"); src.STIL == "" && isFile(p) {
+			src.STIL = p
+		}
+	}
+	return src
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Load reads the database files. With a cacheDir, the parsed contents are
+// kept there and reused while the file's size and modification time are
+// unchanged, as parsing the full STIL takes a noticeable moment.
+func Load(src Sources, cacheDir string) (*DB, error) {
+	if src.Songlengths == "" && src.STIL == "" {
+		return nil, ErrNoDatabase
+	}
+	db := &DB{lengths: map[string][]time.Duration{}, paths: map[string]string{}, stil: map[string]*Entry{}}
+	if src.Songlengths != "" {
+		var c songlengthsCache
+		if err := loadCached(src.Songlengths, cacheDir, &c, func(r io.Reader) error {
+			return c.read(r)
+		}); err != nil {
+			return nil, err
+		}
+		db.lengths, db.paths = c.Lengths, c.Paths
+	}
+	if src.STIL != "" {
+		c := stilCache{}
+		if err := loadCached(src.STIL, cacheDir, &c, func(r io.Reader) error {
+			return readSTIL(r, c)
+		}); err != nil {
+			return nil, err
+		}
+		db.stil = c
+	}
+	return db, nil
+}
+
+// Lookup returns the song lengths and STIL entry of a SID file (its whole
+// contents). path is the file's path in the collection if known, used
+// when the song length database does not list the file.
+func (db *DB) Lookup(data []byte, path string) ([]time.Duration, *Entry) {
+	sum := md5.Sum(data)
+	key := hex.EncodeToString(sum[:])
+	if p, ok := db.paths[key]; ok {
+		path = p
+	}
+	return db.lengths[key], db.stil[path]
+}
+
+// Song returns the information of a song (1-based) of a file with songs
+// songs, or nil
+func (e *Entry) Song(n, songs int) *Song {
+	if e == nil {
+		return nil
+	}
+	if s := e.Songs[n]; s != nil {
+		return s
+	}
+	if songs <= 1 {
+		return e.Songs[0]
+	}
+	return nil
+}
+
+// Label returns the song's name, or for covers the original's title and
+// artist
+func (s *Song) Label() string {
+	switch {
+	case s == nil:
+		return ""
+	case s.Name != "":
+		return s.Name
+	case s.Title != "" && s.Artist != "":
+		return s.Title + " (" + s.Artist + ")"
+	}
+	return s.Title
+}
+
+// CollectionPath returns the path of a local file in the collection
+// rooted at dir ("/MUSICIANS/..."), or "" if it is outside
+func CollectionPath(dir, file string) string {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+// =============================================================================
+// Songlengths.md5
+// =============================================================================
+
+// songlengthsCache is the parsed Songlengths.md5
+type songlengthsCache struct {
+	Lengths map[string][]time.Duration `json:"lengths"`
+	Paths   map[string]string          `json:"paths"`
+}
+
+// read parses lines of "; /PATH" comments followed by
+// "MD5=m:ss.SSS m:ss ..."
+func (c *songlengthsCache) read(r io.Reader) error {
+	c.Lengths, c.Paths = map[string][]time.Duration{}, map[string]string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	path := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, ";"):
+			path = strings.TrimSpace(line[1:])
+		case strings.Contains(line, "="):
+			key, times, _ := strings.Cut(line, "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			var lengths []time.Duration
+			for _, t := range strings.Fields(times) {
+				d, err := parseLength(t)
+				if err != nil {
+					return fmt.Errorf("Songlengths.md5: %s: %w", key, err)
+				}
+				lengths = append(lengths, d)
+			}
+			c.Lengths[key] = lengths
+			if strings.HasPrefix(path, "/") {
+				c.Paths[key] = path
+			}
+			path = ""
+		}
+	}
+	return scanner.Err()
+}
+
+// parseLength parses "m:ss" or "m:ss.SSS", ignoring attributes such as
+// "(G)" from older databases
+func parseLength(s string) (time.Duration, error) {
+	if i := strings.IndexByte(s, '('); i >= 0 {
+		s = s[:i]
+	}
+	min, sec, ok := strings.Cut(s, ":")
+	m, err := strconv.Atoi(min)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("invalid length %q", s)
+	}
+	secs, err := strconv.ParseFloat(sec, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid length %q", s)
+	}
+	return time.Duration(m)*time.Minute + time.Duration(secs*float64(time.Second)), nil
+}
+
+// =============================================================================
+// STIL.txt
+// =============================================================================
+
+// stilCache is the parsed STIL.txt, by path in the collection
+type stilCache map[string]*Entry
+
+// readSTIL parses entries of a "/PATH" line, optional "(#N)" song
+// markers and "FIELD: text" lines continued by indented lines
+func readSTIL(r io.Reader, stil stilCache) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var entry *Entry
+	var song *Song
+	// field is the text continuation lines are added to; skipped holds
+	// the fields that are not kept
+	var field *string
+	var skipped string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(line, "#"):
+			field = nil
+		case strings.HasPrefix(line, "/"):
+			entry = &Entry{Songs: map[int]*Song{}}
+			stil[line] = entry
+			song, field = nil, nil
+		case strings.HasPrefix(trimmed, "(#") && strings.HasSuffix(trimmed, ")"):
+			n, err := strconv.Atoi(trimmed[2 : len(trimmed)-1])
+			if err != nil || entry == nil {
+				continue
+			}
+			song = &Song{}
+			entry.Songs[n] = song
+			field = nil
+		case entry == nil:
+			// The file's introduction
+		default:
+			if name, text, ok := strings.Cut(trimmed, ":"); ok && isFieldName(name) {
+				field = stilField(entry, &song, name)
+				if field == nil {
+					field = &skipped
+				}
+				appendText(field, strings.TrimSpace(text))
+			} else if field != nil {
+				appendText(field, trimmed)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// stilField returns the text a field of the current song is stored in, or
+// nil if it is not kept. A COMMENT before any song marker is about the
+// whole file; other fields there belong to song 0. Only the first TITLE,
+// ARTIST and NAME of a song are kept; later ones (of medleys of several
+// covers) are not.
+func stilField(e *Entry, song **Song, name string) *string {
+	if *song == nil && name == "COMMENT" {
+		return &e.Comment
+	}
+	if *song == nil {
+		*song = &Song{}
+		e.Songs[0] = *song
+	}
+	s := *song
+	switch name {
+	case "NAME":
+		return firstOnly(&s.Name)
+	case "TITLE":
+		return firstOnly(&s.Title)
+	case "ARTIST":
+		return firstOnly(&s.Artist)
+	case "COMMENT":
+		return &s.Comment
+	}
+	return nil
+}
+
+func firstOnly(s *string) *string {
+	if *s != "" {
+		return nil
+	}
+	return s
+}
+
+// isFieldName reports whether s is an upper case STIL field name such as
+// "TITLE" or "AUTHOR"
+func isFieldName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func appendText(field *string, text string) {
+	if *field != "" && text != "" {
+		*field += " "
+	}
+	*field += text
+}
@@ -0,0 +1,169 @@
+package imagecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SectorSize is the block size used for delta computation
+const SectorSize = 256
+
+// Entry describes the last image uploaded to a drive
+type Entry struct {
+	Name      string    `json:"name"`
+	ImageFile string    `json:"image_file,omitempty"`
+	Mode      string    `json:"mode,omitempty"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	Sectors   []uint64  `json:"sectors"`
+	Uploaded  time.Time `json:"uploaded"`
+}
+
+// Cache is a persistent map of device/drive to the last uploaded image
+type Cache struct {
+	path    string
+	Entries map[string]*Entry `json:"entries"`
+}
+
+// Delta summarizes how an image differs from the previous upload
+type Delta struct {
+	Total   int
+	Changed []int
+	// Resized is set if the image size differs, in which case Changed
+	// only covers the common prefix
+	Resized bool
+}
+
+// Unchanged reports whether the image is identical to the previous upload
+func (d Delta) Unchanged() bool {
+	return !d.Resized && len(d.Changed) == 0
+}
+
+// Load reads the cache at path. A missing file yields an empty cache.
+func Load(path string) (*Cache, error) {
+	c := &Cache{path: path, Entries: make(map[string]*Entry)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse image cache %s: %w", path, err)
+	}
+	if c.Entries == nil {
+		c.Entries = make(map[string]*Entry)
+	}
+	return c, nil
+}
+
+// Save writes the cache back to disk
+func (c *Cache) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write image cache: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// Key returns the cache key for a drive on a device
+func Key(device, drive string) string {
+	return device + "/" + drive
+}
+
+// Get returns the previous upload for key, or nil
+func (c *Cache) Get(key string) *Entry {
+	return c.Entries[key]
+}
+
+// Put records an upload for key
+func (c *Cache) Put(key string, e *Entry) {
+	c.Entries[key] = e
+}
+
+// NewEntry builds a cache entry for image data
+func NewEntry(name string, data []byte) *Entry {
+	sum := sha256.Sum256(data)
+	return &Entry{
+		Name:     name,
+		Size:     int64(len(data)),
+		SHA256:   hex.EncodeToString(sum[:]),
+		Sectors:  SectorHashes(data),
+		Uploaded: time.Now(),
+	}
+}
+
+// SectorHashes hashes data in SectorSize blocks
+func SectorHashes(data []byte) []uint64 {
+	hashes := make([]uint64, 0, (len(data)+SectorSize-1)/SectorSize)
+	for off := 0; off < len(data); off += SectorSize {
+		end := off + SectorSize
+		if end > len(data) {
+			end = len(data)
+		}
+		h := fnv.New64a()
+		h.Write(data[off:end])
+		hashes = append(hashes, h.Sum64())
+	}
+	return hashes
+}
+
+// Compare computes which sectors of next differ from prev
+func Compare(prev, next *Entry) Delta {
+	d := Delta{Total: len(next.Sectors), Resized: prev.Size != next.Size}
+	if prev.SHA256 == next.SHA256 {
+		return d
+	}
+
+	for i, h := range next.Sectors {
+		if i >= len(prev.Sectors) || prev.Sectors[i] != h {
+			d.Changed = append(d.Changed, i)
+		}
+	}
+	return d
+}
+
+// d64SectorsPerTrack gives the sector count of tracks 1-40 in a D64 image
+func d64SectorsPerTrack(track int) int {
+	switch {
+	case track <= 17:
+		return 21
+	case track <= 24:
+		return 19
+	case track <= 30:
+		return 18
+	default:
+		return 17
+	}
+}
+
+// D64Location converts a block index of a D64 image to track and sector.
+// ok is false if the index is beyond track 40.
+func D64Location(block int) (track, sector int, ok bool) {
+	for track = 1; track <= 40; track++ {
+		n := d64SectorsPerTrack(track)
+		if block < n {
+			return track, block, true
+		}
+		block -= n
+	}
+	return 0, 0, false
+}
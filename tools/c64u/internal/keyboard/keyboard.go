@@ -0,0 +1,79 @@
+package keyboard
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+)
+
+// KERNAL keyboard buffer locations
+const (
+	// BufferAddr is the keyboard buffer (KEYD)
+	BufferAddr = 0x0277
+	// CountAddr holds the number of pending keys (NDX)
+	CountAddr = 0x00C6
+	// BufferSize is the KERNAL's keyboard buffer length
+	BufferSize = 10
+)
+
+// pollInterval is how often the buffer is checked while it drains
+const pollInterval = 50 * time.Millisecond
+
+// Type feeds PETSCII codes into the keyboard buffer, BufferSize keys at a
+// time, waiting for the KERNAL to consume each chunk. The machine must be
+// running with interrupts enabled (e.g. at the READY. prompt).
+func Type(c *api.Client, codes []byte, timeout time.Duration) error {
+	for len(codes) > 0 {
+		if err := WaitEmpty(c, timeout); err != nil {
+			return err
+		}
+
+		n := len(codes)
+		if n > BufferSize {
+			n = BufferSize
+		}
+		if err := writeMem(c, BufferAddr, codes[:n]); err != nil {
+			return err
+		}
+		if err := writeMem(c, CountAddr, []byte{byte(n)}); err != nil {
+			return err
+		}
+		codes = codes[n:]
+	}
+	return WaitEmpty(c, timeout)
+}
+
+// WaitEmpty waits until the keyboard buffer has been consumed
+func WaitEmpty(c *api.Client, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := c.MachineReadMem(fmt.Sprintf("%04X", CountAddr), 1)
+		if err != nil {
+			return err
+		}
+		if resp.HasErrors() {
+			return fmt.Errorf("reading keyboard buffer failed: %s", strings.Join(resp.Errors, "; "))
+		}
+		if len(resp.RawBody) > 0 && resp.RawBody[0] == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("keyboard buffer not consumed after %s (is the machine paused or busy?)", timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// writeMem writes a few bytes via DMA
+func writeMem(c *api.Client, address int, data []byte) error {
+	resp, err := c.MachineWriteMem(fmt.Sprintf("%04X", address), fmt.Sprintf("%X", data))
+	if err != nil {
+		return err
+	}
+	if resp.HasErrors() {
+		return fmt.Errorf("write to $%04X failed: %s", address, strings.Join(resp.Errors, "; "))
+	}
+	return nil
+}
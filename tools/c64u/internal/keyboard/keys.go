@@ -0,0 +1,162 @@
+package keyboard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+)
+
+// StopAddr holds the keyboard row of the RUN/STOP key (STKEY), which the
+// KERNAL's STOP routine checks; $7F means pressed
+const StopAddr = 0x0091
+
+// ErrRestore is returned for RESTORE, which raises an NMI instead of
+// producing a key code
+var ErrRestore = errors.New("RESTORE triggers an NMI, which the API cannot raise")
+
+// Key is a key press: the codes it puts into the keyboard buffer, or for
+// RUN/STOP a press the STOP routine sees
+type Key struct {
+	Name  string
+	Codes []byte
+	Stop  bool
+}
+
+// keyCodes maps key names (with modifiers in the order SHIFT, CTRL, C=) to
+// their codes; single characters and shifted letters are not listed
+var keyCodes = map[string][]byte{
+	"RETURN": {0x0D}, "SHIFT+RETURN": {0x8D},
+	"SPACE": {0x20}, "SHIFT+SPACE": {0xA0},
+	"HOME": {0x13}, "SHIFT+HOME": {0x93}, "CLR": {0x93},
+	"DEL": {0x14}, "SHIFT+DEL": {0x94}, "INST": {0x94},
+	"CRSR-DOWN": {0x11}, "SHIFT+CRSR-DOWN": {0x91}, "CRSR-UP": {0x91},
+	"CRSR-RIGHT": {0x1D}, "SHIFT+CRSR-RIGHT": {0x9D}, "CRSR-LEFT": {0x9D},
+	"F1": {0x85}, "F3": {0x86}, "F5": {0x87}, "F7": {0x88},
+	"F2": {0x89}, "F4": {0x8A}, "F6": {0x8B}, "F8": {0x8C},
+	"SHIFT+F1": {0x89}, "SHIFT+F3": {0x8A}, "SHIFT+F5": {0x8B}, "SHIFT+F7": {0x8C},
+	"POUND": {0x5C}, "UP-ARROW": {0x5E}, "SHIFT+UP-ARROW": {0xFF}, "LEFT-ARROW": {0x5F},
+	// The KERNAL types this for SHIFT+RUN/STOP
+	"SHIFT+RUNSTOP": []byte("LOAD\rRUN\r"),
+	// Colors and reverse
+	"CTRL+1": {0x90}, "CTRL+2": {0x05}, "CTRL+3": {0x1C}, "CTRL+4": {0x9F},
+	"CTRL+5": {0x9C}, "CTRL+6": {0x1E}, "CTRL+7": {0x1F}, "CTRL+8": {0x9E},
+	"CTRL+9": {0x12}, "CTRL+0": {0x92},
+	"C=+1": {0x81}, "C=+2": {0x95}, "C=+3": {0x96}, "C=+4": {0x97},
+	"C=+5": {0x98}, "C=+6": {0x99}, "C=+7": {0x9A}, "C=+8": {0x9B},
+}
+
+// keyAliases are other spellings of key and modifier names
+var keyAliases = map[string]string{
+	"ENTER": "RETURN", "STOP": "RUNSTOP", "RUN/STOP": "RUNSTOP",
+	"DOWN": "CRSR-DOWN", "UP": "CRSR-UP", "LEFT": "CRSR-LEFT", "RIGHT": "CRSR-RIGHT",
+	"CBM": "C=", "COMMODORE": "C=", "CONTROL": "CTRL",
+}
+
+// shiftedDigits are the characters SHIFT gives the digit keys
+var shiftedDigits = map[byte]byte{'1': '!', '2': '"', '3': '#', '4': '$', '5': '%', '6': '&', '7': '\'', '8': '(', '9': ')'}
+
+// ParseKey parses a key name such as F1, CRSR-DOWN or A, or a combination
+// with SHIFT, CTRL or C= (Commodore) such as SHIFT+RUNSTOP
+func ParseKey(name string) (Key, error) {
+	if len([]rune(name)) == 1 {
+		b, ok := petscii.RuneToPETSCII([]rune(name)[0])
+		if !ok {
+			return Key{}, fmt.Errorf("no key types %q", name)
+		}
+		return Key{Name: strings.ToUpper(name), Codes: []byte{b}}, nil
+	}
+
+	var shift, ctrl, cbm bool
+	parts := strings.Split(strings.ToUpper(name), "+")
+	for i, p := range parts {
+		if a, ok := keyAliases[p]; ok {
+			parts[i] = a
+		}
+		if parts[i] == "RESTORE" {
+			return Key{}, ErrRestore
+		}
+	}
+	for _, p := range parts[:len(parts)-1] {
+		switch p {
+		case "SHIFT":
+			shift = true
+		case "CTRL":
+			ctrl = true
+		case "C=":
+			cbm = true
+		default:
+			return Key{}, fmt.Errorf("'%s' in %s is not a modifier (SHIFT, CTRL, C=)", p, name)
+		}
+	}
+	key := parts[len(parts)-1]
+	canon := key
+	for _, m := range []struct {
+		on   bool
+		name string
+	}{{cbm, "C="}, {ctrl, "CTRL"}, {shift, "SHIFT"}} {
+		if m.on {
+			canon = m.name + "+" + canon
+		}
+	}
+
+	switch {
+	case canon == "RUNSTOP":
+		return Key{Name: canon, Codes: []byte{0x03}, Stop: true}, nil
+	case len(key) == 1 && canon == key:
+		b, _ := petscii.RuneToPETSCII(rune(key[0]))
+		return Key{Name: canon, Codes: []byte{b}}, nil
+	case len(key) == 1 && canon == "SHIFT+"+key && key[0] >= 'A' && key[0] <= 'Z':
+		return Key{Name: canon, Codes: []byte{key[0] + 0x80}}, nil
+	case len(key) == 1 && canon == "SHIFT+"+key && shiftedDigits[key[0]] != 0:
+		return Key{Name: canon, Codes: []byte{shiftedDigits[key[0]]}}, nil
+	case len(key) == 1 && canon == "CTRL+"+key && key[0] >= 'A' && key[0] <= 'Z':
+		return Key{Name: canon, Codes: []byte{key[0] - 0x40}}, nil
+	}
+	if codes, ok := keyCodes[canon]; ok {
+		return Key{Name: canon, Codes: codes}, nil
+	}
+	return Key{}, fmt.Errorf("unknown key %s", name)
+}
+
+// Press presses keys in order. RUN/STOP is held for the STOP routine
+// until the next keyboard scan, which is enough for BASIC to break a
+// running program, and its code is put into the buffer if it is empty, as
+// a program may be waiting for it. Other keys are typed together.
+func Press(c *api.Client, keys []Key, timeout time.Duration) error {
+	var codes []byte
+	for _, k := range keys {
+		if !k.Stop {
+			codes = append(codes, k.Codes...)
+			continue
+		}
+		if len(codes) > 0 {
+			if err := Type(c, codes, timeout); err != nil {
+				return err
+			}
+			codes = nil
+		}
+		if err := writeMem(c, StopAddr, []byte{0x7F}); err != nil {
+			return err
+		}
+		resp, err := c.MachineReadMem(fmt.Sprintf("%04X", CountAddr), 1)
+		if err != nil {
+			return err
+		}
+		if len(resp.RawBody) > 0 && resp.RawBody[0] == 0 {
+			if err := writeMem(c, BufferAddr, k.Codes); err != nil {
+				return err
+			}
+			if err := writeMem(c, CountAddr, []byte{byte(len(k.Codes))}); err != nil {
+				return err
+			}
+		}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return Type(c, codes, timeout)
+}
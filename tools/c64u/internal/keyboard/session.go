@@ -0,0 +1,60 @@
+package keyboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// sessionVersion is the version of the session file format
+const sessionVersion = 1
+
+// Session is a recording of key presses with their times
+type Session struct {
+	Version  int       `json:"version"`
+	Recorded time.Time `json:"recorded"`
+	Events   []Event   `json:"events"`
+}
+
+// Event is a key, by its ParseKey name, pressed at a time after the start
+// of the recording
+type Event struct {
+	AtMS int64  `json:"at_ms"`
+	Key  string `json:"key"`
+}
+
+// LoadSession reads a session file and parses the keys of its events
+func LoadSession(path string) (*Session, []Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, nil, fmt.Errorf("invalid session file: %w", err)
+	}
+	if s.Version != sessionVersion {
+		return nil, nil, fmt.Errorf("unsupported session version %d", s.Version)
+	}
+	keys := make([]Key, len(s.Events))
+	for i, e := range s.Events {
+		if keys[i], err = ParseKey(e.Key); err != nil {
+			return nil, nil, fmt.Errorf("event %d: %w", i+1, err)
+		}
+		if i > 0 && e.AtMS < s.Events[i-1].AtMS {
+			return nil, nil, fmt.Errorf("event %d: at_ms goes back in time", i+1)
+		}
+	}
+	return &s, keys, nil
+}
+
+// Save writes the session to a file
+func (s *Session) Save(path string) error {
+	s.Version = sessionVersion
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,138 @@
+// Package keymap translates characters typed on a host keyboard layout
+// that PETSCII lacks, such as umlauts, to text the C64 can type.
+package keymap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Keymap maps host characters to text in the syntax of "keys type":
+// PETSCII characters and {name} or {$hh} escapes
+type Keymap struct {
+	Name        string
+	Description string
+	Chars       map[rune]string
+	// Path is the file a custom keymap was loaded from
+	Path string
+}
+
+// file is the TOML form of a keymap
+type file struct {
+	Description string            `toml:"description"`
+	Chars       map[string]string `toml:"chars"`
+}
+
+// builtin are the keymaps that need no file. The Scandinavian C64s have
+// their letters in place of [ £ ] ($5B-$5D); German ones have none, so
+// umlauts are spelled out.
+var builtin = []*Keymap{
+	{Name: "de", Description: "German: umlauts and ß spelled out (AE, OE, UE, SS)", Chars: map[rune]string{
+		'ä': "AE", 'ö': "OE", 'ü': "UE", 'Ä': "AE", 'Ö': "OE", 'Ü': "UE", 'ß': "SS",
+		'€': "EUR", '´': "'", '`': "'",
+	}},
+	{Name: "sv", Description: "Swedish/Finnish C64: Ä Ö Å in place of [ £ ]", Chars: map[rune]string{
+		'ä': "{$5B}", 'ö': "{$5C}", 'å': "{$5D}", 'Ä': "{$5B}", 'Ö': "{$5C}", 'Å': "{$5D}",
+		'é': "E", 'É': "E",
+	}},
+	{Name: "da", Description: "Danish/Norwegian C64: Æ Ø Å in place of [ £ ]", Chars: map[rune]string{
+		'æ': "{$5B}", 'ø': "{$5C}", 'å': "{$5D}", 'Æ': "{$5B}", 'Ø': "{$5C}", 'Å': "{$5D}",
+		'é': "E", 'É': "E",
+	}},
+}
+
+// Dir returns the directory of custom keymaps below a config directory
+func Dir(configDir string) string {
+	return filepath.Join(configDir, "keymaps")
+}
+
+// Load returns the keymap with a name: a custom one from dir, which
+// replaces a built-in one of the same name, or a built-in one
+func Load(dir, name string) (*Keymap, error) {
+	path := filepath.Join(dir, name+".toml")
+	if _, err := os.Stat(path); err == nil {
+		return parseFile(path)
+	}
+	for _, k := range builtin {
+		if k.Name == name {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown keymap '%s' (see c64u keys layouts)", name)
+}
+
+// List returns the built-in keymaps and the custom ones in dir, by name
+func List(dir string) ([]*Keymap, error) {
+	byName := make(map[string]*Keymap)
+	for _, k := range builtin {
+		byName[k.Name] = k
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.toml"))
+	for _, p := range paths {
+		k, err := parseFile(p)
+		if err != nil {
+			return nil, err
+		}
+		byName[k.Name] = k
+	}
+
+	list := make([]*Keymap, 0, len(byName))
+	for _, k := range byName {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// parseFile reads a custom keymap, named after its file
+func parseFile(path string) (*Keymap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := toml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	k := &Keymap{
+		Name:        strings.TrimSuffix(filepath.Base(path), ".toml"),
+		Description: f.Description,
+		Chars:       make(map[rune]string, len(f.Chars)),
+		Path:        path,
+	}
+	for from, to := range f.Chars {
+		r, size := utf8.DecodeRuneInString(from)
+		if size == 0 || size != len(from) {
+			return nil, fmt.Errorf("%s: '%s' is not a single character", path, from)
+		}
+		if _, err := petscii.FromKeys(to); err != nil {
+			return nil, fmt.Errorf("%s: '%s': %w", path, from, err)
+		}
+		k.Chars[r] = to
+	}
+	return k, nil
+}
+
+// Apply replaces the characters of the keymap in text
+func (k *Keymap) Apply(text string) string {
+	if k == nil {
+		return text
+	}
+	var b strings.Builder
+	for _, r := range text {
+		if to, ok := k.Chars[r]; ok {
+			b.WriteString(to)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,142 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned when the device lock is held by another process
+var ErrLocked = errors.New("device is locked by another c64u process")
+
+// pollInterval is how often a waiting process retries the lock
+const pollInterval = 100 * time.Millisecond
+
+// Lock is an inter-process lock for a single C64 Ultimate device.
+// It is backed by an advisory lock on a file, so the operating system
+// releases it automatically when the owning process exits.
+type Lock struct {
+	Path string
+	// Wait is the maximum time to wait for the lock (0 = don't wait, <0 = forever)
+	Wait time.Duration
+
+	file *os.File
+}
+
+// New creates a lock for the device at host:port, stored in dir
+func New(dir, host string, port int) *Lock {
+	name := fmt.Sprintf("%s-%d.lock", sanitize(host), port)
+	return &Lock{
+		Path: filepath.Join(dir, name),
+	}
+}
+
+// Lock acquires the lock, waiting up to l.Wait. Calling Lock while the
+// lock is already held by this process is a no-op.
+func (l *Lock) Lock() error {
+	if l.file != nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	file, err := os.OpenFile(l.Path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(l.Wait)
+	for {
+		err = tryLock(file)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrLocked) {
+			file.Close()
+			return fmt.Errorf("failed to lock %s: %w", l.Path, err)
+		}
+		if l.Wait >= 0 && !time.Now().Before(deadline) {
+			owner := readOwner(file)
+			file.Close()
+			if owner != "" {
+				return fmt.Errorf("%w (pid %s)", ErrLocked, owner)
+			}
+			return ErrLocked
+		}
+		time.Sleep(pollInterval)
+	}
+
+	// Record our PID so that waiting processes can report the owner
+	file.Truncate(0)
+	file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+
+	l.file = file
+	return nil
+}
+
+// Release releases the lock if it is held
+func (l *Lock) Release() error {
+	if l.file == nil {
+		return nil
+	}
+	err := unlock(l.file)
+	l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Held reports whether this process currently holds the lock
+func (l *Lock) Held() bool {
+	return l.file != nil
+}
+
+// Owner reports whether the lock is held, and the PID of the holder
+// (empty if it has not been recorded yet)
+func (l *Lock) Owner() (string, bool, error) {
+	if l.file != nil {
+		return strconv.Itoa(os.Getpid()), true, nil
+	}
+
+	file, err := os.OpenFile(l.Path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	defer file.Close()
+
+	if err := tryLock(file); err != nil {
+		if errors.Is(err, ErrLocked) {
+			return readOwner(file), true, nil
+		}
+		return "", false, err
+	}
+	unlock(file)
+	return "", false, nil
+}
+
+// readOwner returns the PID recorded in the lock file, if any
+func readOwner(file *os.File) string {
+	buf := make([]byte, 32)
+	n, _ := file.ReadAt(buf, 0)
+	return strings.TrimSpace(string(buf[:n]))
+}
+
+// sanitize makes a hostname safe for use in a file name
+func sanitize(host string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, host)
+}
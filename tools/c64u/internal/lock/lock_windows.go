@@ -0,0 +1,33 @@
+//go:build windows
+
+package lock
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockOffset is the byte that is locked. Windows locks are mandatory, so
+// it lies past the PID record, which other processes must be able to read;
+// a lock may cover bytes past the end of the file.
+const lockOffset = 1 << 30
+
+// tryLock takes an exclusive, non-blocking lock on one byte of the file
+func tryLock(file *os.File) error {
+	ol := &windows.Overlapped{Offset: lockOffset}
+	err := windows.LockFileEx(windows.Handle(file.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return ErrLocked
+	}
+	return err
+}
+
+// unlock releases the lock on the file
+func unlock(file *os.File) error {
+	ol := &windows.Overlapped{Offset: lockOffset}
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, ol)
+}
@@ -0,0 +1,138 @@
+package mounts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Mount is a disk image mounted in a drive by c64u. The drives API does not
+// report the mount mode, so it is only known for mounts recorded here.
+type Mount struct {
+	// Image is the image path on the device, or the local file for uploads
+	Image string `json:"image"`
+	// ImageFile is the file name the device reports for the mount
+	ImageFile string    `json:"image_file,omitempty"`
+	Uploaded  bool      `json:"uploaded,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	Mode      string    `json:"mode,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// State is the persistent map of device/drive to its recorded mount, and
+// to what the drive held before the last mount command
+type State struct {
+	path   string
+	Drives map[string]*Mount `json:"drives"`
+	// Previous maps a drive to its mount before the last change; a nil
+	// value means the drive was empty
+	Previous map[string]*Mount `json:"previous,omitempty"`
+	// Swaps maps a drive to the disks of a multi-disk set it swaps through
+	Swaps map[string]*SwapList `json:"swaps,omitempty"`
+}
+
+// SwapList is a set of disk images on the device mounted one at a time
+type SwapList struct {
+	// Source is the local file the images came from
+	Source string `json:"source"`
+	// Images are the device paths, disk 1 first
+	Images []string `json:"images"`
+	// Current is the index of the mounted image
+	Current int    `json:"current"`
+	Type    string `json:"type,omitempty"`
+	Mode    string `json:"mode,omitempty"`
+}
+
+// Key builds the state key for a drive on a device
+func Key(device, drive string) string {
+	return device + "/" + drive
+}
+
+// Load reads the mount state at path. A missing file yields an empty state.
+func Load(path string) (*State, error) {
+	s := &State{
+		path:     path,
+		Drives:   make(map[string]*Mount),
+		Previous: make(map[string]*Mount),
+		Swaps:    make(map[string]*SwapList),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mount state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse mount state %s: %w", path, err)
+	}
+	if s.Drives == nil {
+		s.Drives = make(map[string]*Mount)
+	}
+	if s.Previous == nil {
+		s.Previous = make(map[string]*Mount)
+	}
+	if s.Swaps == nil {
+		s.Swaps = make(map[string]*SwapList)
+	}
+	return s, nil
+}
+
+// Get returns the recorded mount of a drive, or nil
+func (s *State) Get(key string) *Mount {
+	return s.Drives[key]
+}
+
+// Set records the mount of a drive; nil records that it is empty. prev is
+// what the drive held before, kept for Undo.
+func (s *State) Set(key string, m, prev *Mount) {
+	s.Previous[key] = prev
+	if m == nil {
+		delete(s.Drives, key)
+		return
+	}
+	s.Drives[key] = m
+}
+
+// Undo returns what a drive held before its last mount change; ok is false
+// if nothing was recorded. A nil mount means the drive was empty.
+func (s *State) Undo(key string) (m *Mount, ok bool) {
+	m, ok = s.Previous[key]
+	return m, ok
+}
+
+// Swap returns the swap list of a drive, or nil
+func (s *State) Swap(key string) *SwapList {
+	return s.Swaps[key]
+}
+
+// SetSwap records the swap list of a drive; nil removes it
+func (s *State) SetSwap(key string, l *SwapList) {
+	if l == nil {
+		delete(s.Swaps, key)
+		return
+	}
+	s.Swaps[key] = l
+}
+
+// Save writes the state back to disk
+func (s *State) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
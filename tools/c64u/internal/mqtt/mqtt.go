@@ -0,0 +1,357 @@
+// Package mqtt is a small MQTT 3.1.1 client: QoS 0 publish and subscribe,
+// retained messages, a last will and keep-alive pings, which is all a
+// status/command bridge needs.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Packet types
+const (
+	pktConnect    = 1
+	pktConnack    = 2
+	pktPublish    = 3
+	pktPuback     = 4
+	pktSubscribe  = 8
+	pktSuback     = 9
+	pktPingreq    = 12
+	pktPingresp   = 13
+	pktDisconnect = 14
+)
+
+// connackErrors are the CONNACK return codes
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Message is a published message
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options configure a connection
+type Options struct {
+	// Broker is host[:port] or a URL with scheme tcp, mqtt, ssl or mqtts
+	Broker    string
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+	Timeout   time.Duration
+	// Will is published by the broker when the connection is lost
+	Will *Message
+}
+
+// Client is a connection to a broker
+type Client struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	mu       sync.Mutex
+	nextID   uint16
+	messages chan Message
+	done     chan struct{}
+	err      error
+}
+
+// Dial connects to the broker and waits for it to accept the session
+func Dial(opts Options) (*Client, error) {
+	addr, useTLS, err := brokerAddr(opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = 30 * time.Second
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	var conn net.Conn
+	if useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: strings.Split(addr, ":")[0]})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("MQTT connection to %s failed: %w", addr, err)
+	}
+
+	c := &Client{
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+		nextID:   1,
+		messages: make(chan Message, 16),
+		done:     make(chan struct{}),
+	}
+	conn.SetDeadline(time.Now().Add(opts.Timeout))
+	if err := c.connect(opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	go c.readLoop()
+	go c.pingLoop(opts.KeepAlive)
+	return c, nil
+}
+
+// brokerAddr parses the broker setting into host:port
+func brokerAddr(broker string) (string, bool, error) {
+	if broker == "" {
+		return "", false, errors.New("no MQTT broker configured")
+	}
+	useTLS := false
+	if strings.Contains(broker, "://") {
+		u, err := url.Parse(broker)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid broker URL '%s': %w", broker, err)
+		}
+		switch u.Scheme {
+		case "tcp", "mqtt":
+		case "ssl", "tls", "mqtts":
+			useTLS = true
+		default:
+			return "", false, fmt.Errorf("unsupported broker scheme '%s'", u.Scheme)
+		}
+		broker = u.Host
+	}
+	if _, _, err := net.SplitHostPort(broker); err != nil {
+		port := "1883"
+		if useTLS {
+			port = "8883"
+		}
+		broker = net.JoinHostPort(broker, port)
+	}
+	return broker, useTLS, nil
+}
+
+// connect sends CONNECT and reads the CONNACK
+func (c *Client) connect(opts Options) error {
+	var flags byte = 0x02 // clean session
+	var payload []byte
+	payload = appendString(payload, opts.ClientID)
+	if opts.Will != nil {
+		flags |= 0x04
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, opts.Will.Topic)
+		payload = appendBytes(payload, opts.Will.Payload)
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, opts.Username)
+		if opts.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, opts.Password)
+		}
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = append(body, payload...)
+	if err := c.send(pktConnect<<4, body); err != nil {
+		return err
+	}
+
+	typ, data, err := c.readPacket()
+	if err != nil {
+		return fmt.Errorf("MQTT handshake failed: %w", err)
+	}
+	if typ>>4 != pktConnack || len(data) < 2 {
+		return errors.New("MQTT handshake failed: unexpected reply")
+	}
+	if rc := data[1]; rc != 0 {
+		if msg, ok := connackErrors[rc]; ok {
+			return fmt.Errorf("MQTT broker refused the connection: %s", msg)
+		}
+		return fmt.Errorf("MQTT broker refused the connection (code %d)", rc)
+	}
+	return nil
+}
+
+// Publish sends a message with QoS 0
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	var header byte = pktPublish << 4
+	if retain {
+		header |= 0x01
+	}
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	return c.send(header, body)
+}
+
+// Subscribe subscribes to topic filters with QoS 0; messages arrive on
+// Messages
+func (c *Client) Subscribe(filters ...string) error {
+	c.mu.Lock()
+	id := c.nextID
+	c.nextID++
+	c.mu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, f := range filters {
+		body = appendString(body, f)
+		body = append(body, 0)
+	}
+	return c.send(pktSubscribe<<4|0x02, body)
+}
+
+// Messages returns the channel of received messages; it is closed when the
+// connection ends
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Done is closed when the connection ends
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close disconnects cleanly; the broker does not publish the will
+func (c *Client) Close() error {
+	c.send(pktDisconnect<<4, nil)
+	return c.conn.Close()
+}
+
+// readLoop receives packets until the connection ends
+func (c *Client) readLoop() {
+	defer close(c.messages)
+	defer close(c.done)
+	for {
+		typ, data, err := c.readPacket()
+		if err != nil {
+			c.mu.Lock()
+			if c.err == nil {
+				c.err = err
+			}
+			c.mu.Unlock()
+			return
+		}
+		if typ>>4 != pktPublish {
+			// CONNACK, SUBACK and PINGRESP need no action
+			continue
+		}
+
+		if len(data) < 2 {
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+n {
+			continue
+		}
+		msg := Message{Topic: string(data[2 : 2+n]), Retain: typ&0x01 != 0}
+		rest := data[2+n:]
+		if qos := (typ >> 1) & 0x03; qos > 0 && len(rest) >= 2 {
+			if qos == 1 {
+				c.send(pktPuback<<4, rest[:2])
+			}
+			rest = rest[2:]
+		}
+		msg.Payload = append([]byte(nil), rest...)
+		c.messages <- msg
+	}
+}
+
+// pingLoop keeps the session alive
+func (c *Client) pingLoop(keepAlive time.Duration) {
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.send(pktPingreq<<4, nil); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// send writes a packet
+func (c *Client) send(header byte, body []byte) error {
+	pkt := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		pkt = append(pkt, b)
+		if n == 0 {
+			break
+		}
+	}
+	pkt = append(pkt, body...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.conn.Write(pkt)
+	return err
+}
+
+// readPacket reads a packet's header byte and body
+func (c *Client) readPacket() (byte, []byte, error) {
+	typ, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(b&0x7F) * mult
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("malformed MQTT packet length")
+		}
+		mult *= 128
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return 0, nil, err
+	}
+	return typ, data, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
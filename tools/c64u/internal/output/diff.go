@@ -0,0 +1,431 @@
+package output
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Diff styles
+var (
+	// Removed/expected content - red
+	diffDelStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("9"))
+
+	// Added/actual content - green
+	diffAddStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("10"))
+
+	// Hunk headers - cyan
+	diffHunkStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("14"))
+)
+
+// DiffOptions controls how diffs are rendered in text mode
+type DiffOptions struct {
+	// ExpectedLabel and ActualLabel name the two sides (e.g. file name, "device")
+	ExpectedLabel string
+	ActualLabel   string
+	// SideBySide renders both sides in columns instead of a unified diff
+	SideBySide bool
+	// Context is the number of unchanged rows/lines shown around changes
+	Context int
+	// Title, if set, names the block in hunk headers, which then show
+	// offsets into it rather than addresses
+	Title string
+}
+
+// ByteRange is a run of differing bytes
+type ByteRange struct {
+	Offset   int
+	Expected []byte
+	Actual   []byte
+}
+
+// DiffBytes returns the runs of differing bytes between expected and actual.
+// If the lengths differ, the missing tail is reported with an empty side.
+func DiffBytes(expected, actual []byte) []ByteRange {
+	n := len(expected)
+	if len(actual) > n {
+		n = len(actual)
+	}
+
+	var ranges []ByteRange
+	var cur *ByteRange
+	for i := 0; i < n; i++ {
+		inE, inA := i < len(expected), i < len(actual)
+		if inE && inA && expected[i] == actual[i] {
+			cur = nil
+			continue
+		}
+		if cur == nil {
+			ranges = append(ranges, ByteRange{Offset: i})
+			cur = &ranges[len(ranges)-1]
+		}
+		if inE {
+			cur.Expected = append(cur.Expected, expected[i])
+		}
+		if inA {
+			cur.Actual = append(cur.Actual, actual[i])
+		}
+	}
+	return ranges
+}
+
+// PrintHexDiff compares two memory regions starting at startAddr and prints
+// the differences as a colored hex diff (text) or a list of ranges (JSON).
+// It returns true if the regions are equal.
+func (f *Formatter) PrintHexDiff(startAddr int, expected, actual []byte, opts DiffOptions) bool {
+	ranges := DiffBytes(expected, actual)
+
+	if f.Mode == ModeJSON {
+		diffs := make([]map[string]interface{}, 0, len(ranges))
+		for _, r := range ranges {
+			length := len(r.Expected)
+			if len(r.Actual) > length {
+				length = len(r.Actual)
+			}
+			diffs = append(diffs, map[string]interface{}{
+				"address":  fmt.Sprintf("$%04X", startAddr+r.Offset),
+				"offset":   r.Offset,
+				"length":   length,
+				"expected": hex.EncodeToString(r.Expected),
+				"actual":   hex.EncodeToString(r.Actual),
+			})
+		}
+		f.printJSON(map[string]interface{}{
+			"equal":       len(ranges) == 0,
+			"expected":    opts.ExpectedLabel,
+			"actual":      opts.ActualLabel,
+			"start":       fmt.Sprintf("$%04X", startAddr),
+			"differences": diffs,
+		})
+		return len(ranges) == 0
+	}
+
+	if len(ranges) == 0 {
+		return true
+	}
+
+	f.printDiffHeader(opts)
+	total := f.printHexRows(startAddr, expected, actual, ranges, opts)
+	fmt.Println()
+	fmt.Printf("%d byte(s) differ in %d range(s)\n", total, len(ranges))
+	return false
+}
+
+// PrintHexHunks prints the differing rows of two byte blocks (text mode
+// only) without the ---/+++ labels and summary, for callers that compare
+// many blocks, e.g. the sectors of two disk images. It returns the number
+// of differing bytes.
+func (f *Formatter) PrintHexHunks(startAddr int, expected, actual []byte, opts DiffOptions) int {
+	ranges := DiffBytes(expected, actual)
+	if len(ranges) == 0 {
+		return 0
+	}
+	return f.printHexRows(startAddr, expected, actual, ranges, opts)
+}
+
+// printHexRows prints the rows of a hex diff that contain changes, plus
+// context rows, and returns the number of differing bytes
+func (f *Formatter) printHexRows(startAddr int, expected, actual []byte, ranges []ByteRange, opts DiffOptions) int {
+	// Work out which 16-byte rows differ, plus context rows
+	n := len(expected)
+	if len(actual) > n {
+		n = len(actual)
+	}
+	rows := (n + 15) / 16
+	changed := make([]bool, rows)
+	for _, r := range ranges {
+		end := r.Offset + len(r.Expected)
+		if e := r.Offset + len(r.Actual); e > end {
+			end = e
+		}
+		for row := r.Offset / 16; row <= (end-1)/16; row++ {
+			changed[row] = true
+		}
+	}
+	visible := expandContext(changed, opts.Context)
+
+	byteAt := func(data []byte, i int) (byte, bool) {
+		if i < len(data) {
+			return data[i], true
+		}
+		return 0, false
+	}
+
+	formatRow := func(row int, data, other []byte, style lipgloss.Style) string {
+		var buf strings.Builder
+		for j := 0; j < 16; j++ {
+			i := row*16 + j
+			b, ok := byteAt(data, i)
+			o, okOther := byteAt(other, i)
+			cell := "--"
+			if ok {
+				cell = fmt.Sprintf("%02X", b)
+			} else if i >= n {
+				cell = "  "
+			}
+			if (ok != okOther || b != o) && i < n {
+				cell = f.style(style, cell)
+			}
+			buf.WriteString(cell)
+			if j < 15 {
+				buf.WriteString(" ")
+			}
+			if j == 7 {
+				buf.WriteString(" ")
+			}
+		}
+		return buf.String()
+	}
+
+	prevVisible := true
+	for row := 0; row < rows; row++ {
+		if !visible[row] {
+			prevVisible = false
+			continue
+		}
+		if !prevVisible || row == 0 {
+			if opts.Title != "" {
+				f.printHunk(fmt.Sprintf("@@ %s +$%02X @@", opts.Title, row*16))
+			} else {
+				f.printHunk(fmt.Sprintf("@@ $%04X @@", startAddr+row*16))
+			}
+		}
+		prevVisible = true
+
+		addr := fmt.Sprintf("%04X:", startAddr+row*16)
+		exp := formatRow(row, expected, actual, diffDelStyle)
+		act := formatRow(row, actual, expected, diffAddStyle)
+
+		switch {
+		case opts.SideBySide:
+			marker := " "
+			if changed[row] {
+				marker = f.style(diffHunkStyle, "!")
+			}
+			fmt.Printf("%s %s %s | %s\n", marker, addr, exp, act)
+		case changed[row]:
+			fmt.Printf("%s %s %s\n", f.style(diffDelStyle, "-"), addr, exp)
+			fmt.Printf("%s %s %s\n", f.style(diffAddStyle, "+"), addr, act)
+		default:
+			fmt.Printf("  %s\n", f.style(dimStyle, addr+" "+exp))
+		}
+	}
+
+	total := 0
+	for _, r := range ranges {
+		l := len(r.Expected)
+		if len(r.Actual) > l {
+			l = len(r.Actual)
+		}
+		total += l
+	}
+	return total
+}
+
+// DiffLine is one line of a line-based diff
+type DiffLine struct {
+	// Op is ' ' (unchanged), '-' (only in expected) or '+' (only in actual)
+	Op rune
+	// Line numbers (1-based) in expected and actual, 0 if not present
+	ExpectedLine int
+	ActualLine   int
+	Text         string
+}
+
+// DiffLines computes a line diff between expected and actual using the
+// longest common subsequence
+func DiffLines(expected, actual []string) []DiffLine {
+	n, m := len(expected), len(actual)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if expected[i] == actual[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []DiffLine
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && expected[i] == actual[j]:
+			lines = append(lines, DiffLine{Op: ' ', ExpectedLine: i + 1, ActualLine: j + 1, Text: expected[i]})
+			i++
+			j++
+		case j < m && (i >= n || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, DiffLine{Op: '+', ActualLine: j + 1, Text: actual[j]})
+			j++
+		default:
+			lines = append(lines, DiffLine{Op: '-', ExpectedLine: i + 1, Text: expected[i]})
+			i++
+		}
+	}
+	return lines
+}
+
+// PrintLineDiff prints a line diff of expected and actual text, e.g. two
+// screen captures. It returns true if both are equal.
+func (f *Formatter) PrintLineDiff(expected, actual []string, opts DiffOptions) bool {
+	lines := DiffLines(expected, actual)
+
+	equal := true
+	for _, l := range lines {
+		if l.Op != ' ' {
+			equal = false
+			break
+		}
+	}
+
+	if f.Mode == ModeJSON {
+		changes := make([]map[string]interface{}, 0)
+		for _, l := range lines {
+			if l.Op == ' ' {
+				continue
+			}
+			change := map[string]interface{}{
+				"op":   string(l.Op),
+				"text": l.Text,
+			}
+			if l.ExpectedLine > 0 {
+				change["expected_line"] = l.ExpectedLine
+			}
+			if l.ActualLine > 0 {
+				change["actual_line"] = l.ActualLine
+			}
+			changes = append(changes, change)
+		}
+		f.printJSON(map[string]interface{}{
+			"equal":    equal,
+			"expected": opts.ExpectedLabel,
+			"actual":   opts.ActualLabel,
+			"changes":  changes,
+		})
+		return equal
+	}
+
+	if equal {
+		return true
+	}
+
+	f.printDiffHeader(opts)
+
+	if opts.SideBySide {
+		f.printSideBySide(expected, actual)
+		return false
+	}
+
+	changed := make([]bool, len(lines))
+	for i, l := range lines {
+		changed[i] = l.Op != ' '
+	}
+	visible := expandContext(changed, opts.Context)
+
+	prevVisible := false
+	for i, l := range lines {
+		if !visible[i] {
+			prevVisible = false
+			continue
+		}
+		if !prevVisible {
+			f.printHunk(fmt.Sprintf("@@ -%d +%d @@", max(l.ExpectedLine, 1), max(l.ActualLine, 1)))
+		}
+		prevVisible = true
+
+		switch l.Op {
+		case '-':
+			fmt.Println(f.style(diffDelStyle, "-"+l.Text))
+		case '+':
+			fmt.Println(f.style(diffAddStyle, "+"+l.Text))
+		default:
+			fmt.Println(" " + l.Text)
+		}
+	}
+	return false
+}
+
+// printSideBySide prints expected and actual line by line in two columns,
+// marking lines that differ. Lines are compared positionally, which suits
+// fixed-size content such as a 40x25 screen.
+func (f *Formatter) printSideBySide(expected, actual []string) {
+	width := 0
+	for _, l := range expected {
+		if w := lipgloss.Width(l); w > width {
+			width = w
+		}
+	}
+
+	n := len(expected)
+	if len(actual) > n {
+		n = len(actual)
+	}
+	for i := 0; i < n; i++ {
+		var e, a string
+		if i < len(expected) {
+			e = expected[i]
+		}
+		if i < len(actual) {
+			a = actual[i]
+		}
+		pad := strings.Repeat(" ", width-lipgloss.Width(e))
+		if e == a {
+			fmt.Printf("  %s%s | %s\n", e, pad, a)
+		} else {
+			fmt.Printf("%s %s%s | %s\n", f.style(diffHunkStyle, "!"), f.style(diffDelStyle, e), pad, f.style(diffAddStyle, a))
+		}
+	}
+}
+
+// printDiffHeader prints the ---/+++ labels of a diff
+func (f *Formatter) printDiffHeader(opts DiffOptions) {
+	expected, actual := opts.ExpectedLabel, opts.ActualLabel
+	if expected == "" {
+		expected = "expected"
+	}
+	if actual == "" {
+		actual = "actual"
+	}
+	fmt.Println(f.style(diffDelStyle, "--- "+expected))
+	fmt.Println(f.style(diffAddStyle, "+++ "+actual))
+}
+
+// printHunk prints a hunk header
+func (f *Formatter) printHunk(text string) {
+	fmt.Println(f.style(diffHunkStyle, text))
+}
+
+// style renders text with the given style unless colors are disabled
+func (f *Formatter) style(s lipgloss.Style, text string) string {
+	if f.NoColor {
+		return text
+	}
+	return s.Render(text)
+}
+
+// expandContext marks entries within ctx positions of a changed entry
+func expandContext(changed []bool, ctx int) []bool {
+	visible := make([]bool, len(changed))
+	for i, c := range changed {
+		if !c {
+			continue
+		}
+		for j := i - ctx; j <= i+ctx; j++ {
+			if j >= 0 && j < len(visible) {
+				visible[j] = true
+			}
+		}
+	}
+	return visible
+}
@@ -0,0 +1,32 @@
+package output
+
+import (
+	"os"
+	"sync"
+)
+
+var (
+	exitMu    sync.Mutex
+	exitHooks []func(code int)
+)
+
+// OnExit registers a function that runs before the process exits via Exit.
+// Hooks run in reverse registration order.
+func OnExit(fn func(code int)) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitHooks = append(exitHooks, fn)
+}
+
+// Exit runs the registered exit hooks and terminates the process
+func Exit(code int) {
+	exitMu.Lock()
+	hooks := exitHooks
+	exitHooks = nil
+	exitMu.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i](code)
+	}
+	os.Exit(code)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
@@ -64,12 +65,27 @@ var (
 	highlightStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("15")).
 			Bold(true)
+
+	// Help styles - titles, section headers, command and flag names
+	helpTitleStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("12")).
+			Bold(true)
+	helpSectionStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("14")).
+				Bold(true)
+	helpCommandStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("10")).
+				Bold(true)
+	helpFlagStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("11"))
 )
 
 // Formatter handles output formatting
 type Formatter struct {
 	Mode     OutputMode
 	NoColor  bool
+	RawBytes bool
+	Raw      bool
 }
 
 // NewFormatter creates a new output formatter
@@ -149,7 +165,7 @@ func (f *Formatter) Error(message string, errors []string) {
 			}
 		}
 	}
-	os.Exit(1)
+	Exit(1)
 }
 
 // PrintResponse formats and prints an API response
@@ -206,12 +222,12 @@ func (f *Formatter) PrintTable(headers []string, rows [][]string) {
 	// Calculate column widths
 	widths := make([]int, len(headers))
 	for i, h := range headers {
-		widths[i] = len(h)
+		widths[i] = utf8.RuneCountInString(h)
 	}
 	for _, row := range rows {
 		for i, cell := range row {
-			if i < len(widths) && len(cell) > widths[i] {
-				widths[i] = len(cell)
+			if i < len(widths) && utf8.RuneCountInString(cell) > widths[i] {
+				widths[i] = utf8.RuneCountInString(cell)
 			}
 		}
 	}
@@ -244,7 +260,7 @@ func (f *Formatter) printJSON(data interface{}) {
 	jsonData, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error marshaling JSON: %v\n", err)
-		os.Exit(1)
+		Exit(1)
 	}
 	fmt.Println(string(jsonData))
 }
@@ -312,9 +328,7 @@ func (f *Formatter) GetTitleStyle() lipgloss.Style {
 	if f.NoColor {
 		return lipgloss.NewStyle()
 	}
-	return lipgloss.NewStyle().
-		Foreground(lipgloss.Color("12")).
-		Bold(true)
+	return helpTitleStyle
 }
 
 // GetSectionStyle returns a style for help section headers
@@ -322,9 +336,7 @@ func (f *Formatter) GetSectionStyle() lipgloss.Style {
 	if f.NoColor {
 		return lipgloss.NewStyle()
 	}
-	return lipgloss.NewStyle().
-		Foreground(lipgloss.Color("14")).
-		Bold(true)
+	return helpSectionStyle
 }
 
 // GetCommandStyle returns a style for command names in help
@@ -332,9 +344,7 @@ func (f *Formatter) GetCommandStyle() lipgloss.Style {
 	if f.NoColor {
 		return lipgloss.NewStyle()
 	}
-	return lipgloss.NewStyle().
-		Foreground(lipgloss.Color("10")).
-		Bold(true)
+	return helpCommandStyle
 }
 
 // GetFlagStyle returns a style for flag names in help
@@ -342,6 +352,5 @@ func (f *Formatter) GetFlagStyle() lipgloss.Style {
 	if f.NoColor {
 		return lipgloss.NewStyle()
 	}
-	return lipgloss.NewStyle().
-		Foreground(lipgloss.Color("11"))
+	return helpFlagStyle
 }
@@ -0,0 +1,83 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// IsTerminal reports whether f is attached to a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// PagerCommand returns the pager to use: C64U_PAGER, then the configured
+// pager, then PAGER, falling back to "less". An empty result or "cat"
+// means no pager.
+func PagerCommand(configured string) string {
+	if p, ok := os.LookupEnv("C64U_PAGER"); ok {
+		return p
+	}
+	if configured != "" {
+		return configured
+	}
+	if p, ok := os.LookupEnv("PAGER"); ok {
+		return p
+	}
+	return "less"
+}
+
+// StartPager redirects os.Stdout through the given pager command when
+// stdout is a terminal. The pager is closed and waited for on Exit.
+func StartPager(pager string) error {
+	pager = strings.TrimSpace(pager)
+	if pager == "" || pager == "cat" || !IsTerminal(os.Stdout) {
+		return nil
+	}
+
+	args := strings.Fields(pager)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Like git: quit if the output fits on one screen, keep colors and
+	// don't clear the screen on exit
+	env := os.Environ()
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		env = append(env, "LESS=FRX")
+	}
+	cmd.Env = env
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = r
+
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return fmt.Errorf("failed to start pager '%s': %w", pager, err)
+	}
+	r.Close()
+
+	// Detect the color profile against the terminal before stdout becomes a pipe
+	lipgloss.ColorProfile()
+
+	stdout := os.Stdout
+	os.Stdout = w
+
+	OnExit(func(code int) {
+		w.Close()
+		cmd.Wait()
+		os.Stdout = stdout
+	})
+	return nil
+}
@@ -0,0 +1,237 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Theme defines the colors used by the formatter. Colors are ANSI color
+// numbers ("0"-"255") or hex values ("#6C5EB5"). Empty values fall back
+// to the default theme.
+type Theme struct {
+	Success   string
+	Error     string
+	Warning   string
+	Info      string
+	Label     string
+	Value     string
+	Header    string
+	Dim       string
+	Highlight string
+	Title     string
+	Section   string
+	Command   string
+	Flag      string
+	DiffAdd   string
+	DiffDel   string
+	DiffHunk  string
+}
+
+// BuiltinThemes are the themes available without configuration
+var BuiltinThemes = map[string]Theme{
+	"default": {
+		Success:   "10",
+		Error:     "9",
+		Warning:   "11",
+		Info:      "14",
+		Label:     "14",
+		Value:     "15",
+		Header:    "12",
+		Dim:       "8",
+		Highlight: "15",
+		Title:     "12",
+		Section:   "14",
+		Command:   "10",
+		Flag:      "11",
+		DiffAdd:   "10",
+		DiffDel:   "9",
+		DiffHunk:  "14",
+	},
+	// The C64's own palette: light blue on blue, as on the power-up screen
+	"c64": {
+		Success:   "#9AD284", // light green
+		Error:     "#B86962", // light red
+		Warning:   "#BFCE72", // yellow
+		Info:      "#70A4B2", // cyan
+		Label:     "#6C5EB5", // light blue
+		Value:     "#FFFFFF", // white
+		Header:    "#6C5EB5", // light blue
+		Dim:       "#6C6C6C", // grey
+		Highlight: "#FFFFFF", // white
+		Title:     "#6C5EB5", // light blue
+		Section:   "#70A4B2", // cyan
+		Command:   "#9AD284", // light green
+		Flag:      "#BFCE72", // yellow
+		DiffAdd:   "#9AD284", // light green
+		DiffDel:   "#B86962", // light red
+		DiffHunk:  "#70A4B2", // cyan
+	},
+	// Muted colors for light terminal backgrounds
+	"light": {
+		Success:   "22",
+		Error:     "124",
+		Warning:   "130",
+		Info:      "24",
+		Label:     "24",
+		Value:     "0",
+		Header:    "18",
+		Dim:       "244",
+		Highlight: "0",
+		Title:     "18",
+		Section:   "24",
+		Command:   "22",
+		Flag:      "130",
+		DiffAdd:   "22",
+		DiffDel:   "124",
+		DiffHunk:  "24",
+	},
+}
+
+// ThemeNames returns the names of all built-in and custom themes, sorted
+func ThemeNames(custom map[string]Theme) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for name := range BuiltinThemes {
+		seen[name] = true
+		names = append(names, name)
+	}
+	for name := range custom {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupTheme resolves a theme by name. Custom themes take precedence over
+// built-in ones, and any colors missing from a custom theme are taken from
+// the built-in theme of the same name or the default theme.
+func LookupTheme(name string, custom map[string]Theme) (Theme, error) {
+	if name == "" {
+		name = "default"
+	}
+	name = strings.ToLower(name)
+
+	base, builtin := BuiltinThemes[name]
+	if !builtin {
+		base = BuiltinThemes["default"]
+	}
+
+	t, ok := custom[name]
+	if !ok {
+		if !builtin {
+			return Theme{}, fmt.Errorf("unknown theme '%s' (available: %s)", name, strings.Join(ThemeNames(custom), ", "))
+		}
+		return base, nil
+	}
+
+	return t.withDefaults(base), nil
+}
+
+// ThemeFromMap builds a theme from a key/color table such as a
+// [themes.<name>] section in config.toml
+func ThemeFromMap(m map[string]string) (Theme, error) {
+	var t Theme
+	fields := map[string]*string{
+		"success":   &t.Success,
+		"error":     &t.Error,
+		"warning":   &t.Warning,
+		"info":      &t.Info,
+		"label":     &t.Label,
+		"value":     &t.Value,
+		"header":    &t.Header,
+		"dim":       &t.Dim,
+		"highlight": &t.Highlight,
+		"title":     &t.Title,
+		"section":   &t.Section,
+		"command":   &t.Command,
+		"flag":      &t.Flag,
+		"diff_add":  &t.DiffAdd,
+		"diff_del":  &t.DiffDel,
+		"diff_hunk": &t.DiffHunk,
+	}
+	for key, value := range m {
+		field, ok := fields[strings.ToLower(key)]
+		if !ok {
+			return Theme{}, fmt.Errorf("unknown theme color '%s'", key)
+		}
+		*field = value
+	}
+	return t, nil
+}
+
+// withDefaults fills empty colors from base
+func (t Theme) withDefaults(base Theme) Theme {
+	pick := func(c, fallback string) string {
+		if c == "" {
+			return fallback
+		}
+		return c
+	}
+	return Theme{
+		Success:   pick(t.Success, base.Success),
+		Error:     pick(t.Error, base.Error),
+		Warning:   pick(t.Warning, base.Warning),
+		Info:      pick(t.Info, base.Info),
+		Label:     pick(t.Label, base.Label),
+		Value:     pick(t.Value, base.Value),
+		Header:    pick(t.Header, base.Header),
+		Dim:       pick(t.Dim, base.Dim),
+		Highlight: pick(t.Highlight, base.Highlight),
+		Title:     pick(t.Title, base.Title),
+		Section:   pick(t.Section, base.Section),
+		Command:   pick(t.Command, base.Command),
+		Flag:      pick(t.Flag, base.Flag),
+		DiffAdd:   pick(t.DiffAdd, base.DiffAdd),
+		DiffDel:   pick(t.DiffDel, base.DiffDel),
+		DiffHunk:  pick(t.DiffHunk, base.DiffHunk),
+	}
+}
+
+// activeTheme is the theme last applied
+var activeTheme = BuiltinThemes["default"]
+
+// ActiveTheme returns the theme in use, for screens the formatter does not
+// draw
+func ActiveTheme() Theme {
+	return activeTheme
+}
+
+// ApplyTheme replaces the formatter's color styles with the theme's colors
+func ApplyTheme(t Theme) {
+	t = t.withDefaults(BuiltinThemes["default"])
+	activeTheme = t
+	color := func(c string) lipgloss.Style {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color(c))
+	}
+
+	successStyle = color(t.Success).Bold(true)
+	errorStyle = color(t.Error).Bold(true)
+	warningStyle = color(t.Warning).Bold(true)
+	infoStyle = color(t.Info)
+	labelStyle = color(t.Label).Bold(true)
+	valueStyle = color(t.Value)
+	headerStyle = color(t.Header).Bold(true).Underline(true)
+	dimStyle = color(t.Dim)
+	highlightStyle = color(t.Highlight).Bold(true)
+
+	helpTitleStyle = color(t.Title).Bold(true)
+	helpSectionStyle = color(t.Section).Bold(true)
+	helpCommandStyle = color(t.Command).Bold(true)
+	helpFlagStyle = color(t.Flag)
+
+	diffAddStyle = color(t.DiffAdd)
+	diffDelStyle = color(t.DiffDel)
+	diffHunkStyle = color(t.DiffHunk)
+}
+
+// NoColorEnv reports whether the NO_COLOR environment variable requests
+// uncolored output (see https://no-color.org)
+func NoColorEnv() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
@@ -0,0 +1,115 @@
+package output
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Size units used by HumanSize (binary multiples, as the Ultimate reports them)
+var sizeUnits = []string{"KB", "MB", "GB", "TB"}
+
+// SetUnits configures how sizes and durations are rendered in text mode.
+// With bytes set, sizes are printed as exact byte counts only; with raw set,
+// sizes and durations are printed as plain numbers (bytes, seconds).
+func (f *Formatter) SetUnits(bytes, raw bool) {
+	f.RawBytes = bytes
+	f.Raw = raw
+}
+
+// Size renders a byte count for text output, e.g. "170 KB (174,848 bytes)"
+func (f *Formatter) Size(n int64) string {
+	switch {
+	case f.Raw:
+		return strconv.FormatInt(n, 10)
+	case f.RawBytes:
+		return GroupDigits(n) + " bytes"
+	default:
+		return FormatSize(n)
+	}
+}
+
+// Duration renders a duration for text output, e.g. "350ms" or "1m05s"
+func (f *Formatter) Duration(d time.Duration) string {
+	if f.Raw {
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	}
+	return HumanDuration(d)
+}
+
+// HumanSize formats a byte count with a binary unit, e.g. "170 KB"
+func HumanSize(n int64) string {
+	if n < 1024 && n > -1024 {
+		if n == 1 {
+			return "1 byte"
+		}
+		return fmt.Sprintf("%d bytes", n)
+	}
+
+	v := float64(n) / 1024
+	unit := 0
+	for (v >= 1024 || v <= -1024) && unit < len(sizeUnits)-1 {
+		v /= 1024
+		unit++
+	}
+
+	// Truncate rather than round so a size never reads larger than it is
+	if v >= 100 || v <= -100 {
+		return fmt.Sprintf("%.0f %s", math.Trunc(v), sizeUnits[unit])
+	}
+	v = math.Trunc(v*10) / 10
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f %s", v, sizeUnits[unit])
+	}
+	return fmt.Sprintf("%.1f %s", v, sizeUnits[unit])
+}
+
+// FormatSize formats a byte count as human size plus exact bytes,
+// e.g. "170 KB (174,848 bytes)". Small sizes are shown as bytes only.
+func FormatSize(n int64) string {
+	if n < 1024 && n > -1024 {
+		return HumanSize(n)
+	}
+	return fmt.Sprintf("%s (%s bytes)", HumanSize(n), GroupDigits(n))
+}
+
+// GroupDigits formats an integer with thousands separators, e.g. "174,848"
+func GroupDigits(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
+
+// HumanDuration formats a duration rounded to a sensible precision,
+// e.g. "850µs", "350ms", "2.4s", "1m05s", "2h03m"
+func HumanDuration(d time.Duration) string {
+	neg := ""
+	if d < 0 {
+		neg, d = "-", -d
+	}
+
+	var s string
+	switch {
+	case d < time.Millisecond:
+		s = d.Round(time.Microsecond).String()
+	case d < time.Second:
+		s = d.Round(time.Millisecond).String()
+	case d < time.Minute:
+		s = strconv.FormatFloat(d.Round(100*time.Millisecond).Seconds(), 'f', -1, 64) + "s"
+	case d < time.Hour:
+		d = d.Round(time.Second)
+		s = fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		d = d.Round(time.Minute)
+		s = fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return neg + s
+}
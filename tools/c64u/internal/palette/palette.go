@@ -0,0 +1,101 @@
+package palette
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// NumColors is the size of the VIC-II palette
+const NumColors = 16
+
+// Color is an RGB palette entry
+type Color struct {
+	R, G, B uint8
+}
+
+// Hex returns the color as #RRGGBB
+func (c Color) Hex() string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// Palette is a set of 16 VIC-II colors
+type Palette struct {
+	Name   string
+	Colors [NumColors]Color
+}
+
+// Load reads a VICE palette (.vpl) file
+func Load(path string) (*Palette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse reads a VICE palette: "#" comments and one "R G B [dither]" line
+// of hex values per color
+func Parse(r io.Reader) (*Palette, error) {
+	p := &Palette{}
+	n := 0
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		if text == "" {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 3 || len(fields) > 4 {
+			return nil, fmt.Errorf("line %d: expected R G B [dither], got %q", line, text)
+		}
+		if n == NumColors {
+			return nil, fmt.Errorf("line %d: more than %d colors", line, NumColors)
+		}
+
+		var rgb [3]uint8
+		for i := range rgb {
+			v, err := strconv.ParseUint(fields[i], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid color value %q", line, fields[i])
+			}
+			rgb[i] = uint8(v)
+		}
+		p.Colors[n] = Color{R: rgb[0], G: rgb[1], B: rgb[2]}
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if n != NumColors {
+		return nil, fmt.Errorf("expected %d colors, found %d", NumColors, n)
+	}
+	return p, nil
+}
+
+// Names of the VIC-II colors, in palette order
+var Names = [NumColors]string{
+	"black", "white", "red", "cyan", "purple", "green", "blue", "yellow",
+	"orange", "brown", "light red", "dark grey", "grey", "light green", "light blue", "light grey",
+}
+
+// Default is Pepto's PAL palette, which VICE and the Ultimate 64 ship
+var Default = &Palette{Name: "pepto", Colors: [NumColors]Color{
+	{0x00, 0x00, 0x00}, {0xFF, 0xFF, 0xFF}, {0x68, 0x37, 0x2B}, {0x70, 0xA4, 0xB2},
+	{0x6F, 0x3D, 0x86}, {0x58, 0x8D, 0x43}, {0x35, 0x28, 0x79}, {0xB8, 0xC7, 0x6F},
+	{0x6F, 0x4F, 0x25}, {0x43, 0x39, 0x00}, {0x9A, 0x67, 0x59}, {0x44, 0x44, 0x44},
+	{0x6C, 0x6C, 0x6C}, {0x9A, 0xD2, 0x84}, {0x6C, 0x5E, 0xB5}, {0x95, 0x95, 0x95},
+}}
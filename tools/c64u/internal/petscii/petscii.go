@@ -0,0 +1,327 @@
+package petscii
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Control codes
+const (
+	Return = 0x0D
+	RvsOn  = 0x12
+	RvsOff = 0x92
+)
+
+// FromText converts text to PETSCII as typed on the keyboard in the default
+// uppercase/graphics mode. Letters of either case become unshifted
+// (uppercase) letters and newlines become RETURN.
+func FromText(text string) ([]byte, error) {
+	return fromText(text, false)
+}
+
+// fromText converts text like FromText; with lower, for the
+// lowercase/uppercase character set, uppercase letters become shifted
+// letters
+func fromText(text string, lower bool) ([]byte, error) {
+	out := make([]byte, 0, len(text))
+	for i, r := range []rune(text) {
+		if lower && r >= 'A' && r <= 'Z' {
+			out = append(out, byte(r-'A'+0xC1))
+			continue
+		}
+		b, ok := RuneToPETSCII(r)
+		if !ok {
+			return nil, fmt.Errorf("character %q at position %d has no PETSCII equivalent", r, i+1)
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// FromASCII converts text like FromKeys, {name} and {$hh} included. With
+// lower the text is for the lowercase/uppercase character set, where
+// lowercase letters are unshifted and uppercase ones shifted.
+func FromASCII(text string, lower bool) ([]byte, error) {
+	return fromBraces(text, "{", keyNames, lower)
+}
+
+// FromEscaped converts text like FromText, with {$hh} standing for the
+// PETSCII code hh, e.g. "{$C1}RCADE" for a shifted A or "{$A0}" for a
+// shifted space. It is meant for names that use codes without a text
+// equivalent.
+func FromEscaped(text string) ([]byte, error) {
+	return fromBraces(text, "{$", nil, false)
+}
+
+// keyNames are the keys FromKeys accepts by name, spelled as in petcat
+var keyNames = map[string]byte{
+	"return": Return, "shift return": 0x8D, "space": 0x20,
+	"clr": 0x93, "home": 0x13, "del": 0x14, "inst": 0x94,
+	"up": 0x91, "down": 0x11, "left": 0x9D, "rght": 0x1D, "right": 0x1D,
+	"rvs on": 0x12, "rvs off": 0x92, "swlc": 0x0E, "swuc": 0x8E,
+	"f1": 0x85, "f2": 0x89, "f3": 0x86, "f4": 0x8A,
+	"f5": 0x87, "f6": 0x8B, "f7": 0x88, "f8": 0x8C,
+	"blk": 0x90, "wht": 0x05, "red": 0x1C, "cyn": 0x9F,
+	"pur": 0x9C, "grn": 0x1E, "blu": 0x1F, "yel": 0x9E,
+}
+
+// FromKeys converts text typed on the keyboard like FromEscaped, with
+// {name} also standing for special keys, e.g. "{clr}{down}" or "{f1}"
+func FromKeys(text string) ([]byte, error) {
+	return fromBraces(text, "{", keyNames, false)
+}
+
+// fromBraces converts text with escapes starting with open: {$hh} and,
+// with names, {name}
+func fromBraces(text, open string, names map[string]byte, lower bool) ([]byte, error) {
+	var out []byte
+	for text != "" {
+		i := strings.Index(text, open)
+		if i < 0 {
+			i = len(text)
+		}
+		codes, err := fromText(text[:i], lower)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, codes...)
+		text = text[i:]
+		if text == "" {
+			break
+		}
+
+		end := strings.IndexByte(text, '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated escape %q", text)
+		}
+		if hex, ok := strings.CutPrefix(text[1:end], "$"); ok {
+			v, err := strconv.ParseUint(hex, 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid escape %q (use {$hh} with a hex code)", text[:end+1])
+			}
+			out = append(out, byte(v))
+		} else if v, ok := names[strings.ToLower(text[1:end])]; ok {
+			out = append(out, v)
+		} else {
+			return nil, fmt.Errorf("unknown key %q", text[:end+1])
+		}
+		text = text[end+1:]
+	}
+	return out, nil
+}
+
+// ToEscaped converts PETSCII to text that FromEscaped converts back:
+// codes outside the printable uppercase range are written as {$hh}
+func ToEscaped(codes []byte) string {
+	var b strings.Builder
+	for _, c := range codes {
+		if c >= 0x20 && c <= 0x5D && c != 0x5C {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "{$%02X}", c)
+		}
+	}
+	return b.String()
+}
+
+// RuneToPETSCII maps a single rune to its PETSCII code
+func RuneToPETSCII(r rune) (byte, bool) {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return byte(r - 'a' + 0x41), true
+	case r >= 0x20 && r <= 0x5D && r != '\\':
+		return byte(r), true
+	case r == '\n' || r == '\r':
+		return Return, true
+	case r == '£':
+		return 0x5C, true
+	case r == '↑' || r == '^':
+		return 0x5E, true
+	case r == '←' || r == '_':
+		return 0x5F, true
+	case r == 'π':
+		return 0xFF, true
+	}
+	return 0, false
+}
+
+// ToText converts PETSCII to text as displayed in the uppercase/graphics
+// mode. RETURN becomes a newline, other control codes are dropped and
+// graphics characters become '·'.
+func ToText(codes []byte) string {
+	var b strings.Builder
+	for _, c := range codes {
+		switch {
+		case c == Return:
+			b.WriteByte('\n')
+		case c >= 0x20 && c <= 0x5B:
+			b.WriteByte(c)
+		case c == 0x5C:
+			b.WriteRune('£')
+		case c == 0x5D:
+			b.WriteByte(']')
+		case c == 0x5E:
+			b.WriteRune('↑')
+		case c == 0x5F:
+			b.WriteRune('←')
+		case c == 0xA0:
+			b.WriteByte(' ')
+		case c == 0xFF:
+			b.WriteRune('π')
+		case c >= 0x60:
+			b.WriteRune('·')
+		}
+	}
+	return b.String()
+}
+
+// ToASCII converts PETSCII to ASCII text: letters, digits and punctuation,
+// RETURN as a newline and shifted space as a space. With lower the codes
+// are for the lowercase/uppercase character set. Other codes are written
+// as {$hh}, so FromASCII converts the text back, or left out with strip;
+// dropped is how many were.
+func ToASCII(codes []byte, lower, strip bool) (text string, dropped int) {
+	var b strings.Builder
+	for _, c := range codes {
+		switch {
+		case c == Return:
+			b.WriteByte('\n')
+		case c >= 0x41 && c <= 0x5A && lower:
+			b.WriteByte(c - 0x41 + 'a')
+		case (c >= 0xC1 && c <= 0xDA || c >= 0x61 && c <= 0x7A) && lower:
+			b.WriteByte(c&0x1F - 1 + 'A')
+		case c >= 0x20 && c <= 0x5D && c != 0x5C:
+			b.WriteByte(c)
+		case c == 0x5E:
+			b.WriteByte('^')
+		case c == 0x5F:
+			b.WriteByte('_')
+		case c == 0xA0:
+			b.WriteByte(' ')
+		case strip:
+			dropped++
+		default:
+			fmt.Fprintf(&b, "{$%02X}", c)
+		}
+	}
+	return b.String(), dropped
+}
+
+// ============================================================================
+// Screen Codes
+// ============================================================================
+
+// screenCode maps a printable PETSCII code to its screen code
+func screenCode(c byte) (byte, bool) {
+	switch {
+	case c >= 0x20 && c <= 0x3F:
+		return c, true
+	case c >= 0x40 && c <= 0x5F:
+		return c - 0x40, true
+	case c >= 0x60 && c <= 0x7F:
+		return c - 0x20, true
+	case c >= 0xA0 && c <= 0xBF:
+		return c - 0x40, true
+	case c >= 0xC0 && c <= 0xFE:
+		return c - 0x80, true
+	case c == 0xFF:
+		return 0x5E, true
+	}
+	return 0, false
+}
+
+// fromScreenCode maps a screen code without the reverse bit to PETSCII
+func fromScreenCode(s byte) byte {
+	switch {
+	case s < 0x20:
+		return s + 0x40
+	case s < 0x40:
+		return s
+	case s < 0x60:
+		return s + 0x80
+	}
+	return s + 0x40
+}
+
+// ToScreenCodes converts PETSCII to screen codes as written to screen
+// memory. RVS ON and RVS OFF set and clear the reverse bit; RETURN fills
+// the line with spaces up to the next multiple of width and ends reverse,
+// as the screen editor does, or is left out for a width of 0. Other
+// control codes have no screen code and are left out; dropped is how many
+// were.
+func ToScreenCodes(codes []byte, width int) (out []byte, dropped int) {
+	var reverse byte
+	line := 0
+	for _, c := range codes {
+		switch c {
+		case RvsOn:
+			reverse = 0x80
+			continue
+		case RvsOff:
+			reverse = 0
+			continue
+		case Return:
+			reverse = 0
+			if width > 0 {
+				for line == 0 || line%width != 0 {
+					out = append(out, 0x20)
+					line++
+				}
+			}
+			line = 0
+			continue
+		}
+		s, ok := screenCode(c)
+		if !ok {
+			dropped++
+			continue
+		}
+		out = append(out, s|reverse)
+		line++
+	}
+	return out, dropped
+}
+
+// FromScreenCodes converts screen codes to PETSCII, with RVS ON and RVS
+// OFF around reversed characters. A width above 0 splits the codes into
+// lines of that many, each with trailing spaces removed and ending with
+// RETURN.
+func FromScreenCodes(codes []byte, width int) []byte {
+	var out []byte
+	reverse := false
+	convert := func(row []byte) {
+		for _, s := range row {
+			if r := s&0x80 != 0; r != reverse {
+				reverse = r
+				if r {
+					out = append(out, RvsOn)
+				} else {
+					out = append(out, RvsOff)
+				}
+			}
+			out = append(out, fromScreenCode(s&0x7F))
+		}
+	}
+	if width <= 0 {
+		convert(codes)
+		if reverse {
+			out = append(out, RvsOff)
+		}
+		return out
+	}
+	for len(codes) > 0 {
+		n := min(width, len(codes))
+		row := codes[:n]
+		// Reversed spaces are visible and stay
+		for len(row) > 0 && row[len(row)-1] == 0x20 {
+			row = row[:len(row)-1]
+		}
+		convert(row)
+		// RETURN ends reverse
+		reverse = false
+		out = append(out, Return)
+		codes = codes[n:]
+	}
+	return out
+}
@@ -0,0 +1,175 @@
+package power
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned when a backend can't perform an operation
+var ErrUnsupported = errors.New("operation not supported by power backend")
+
+// Backend switches mains power for the C64 Ultimate
+type Backend interface {
+	// Name returns the backend identifier (e.g. "tasmota")
+	Name() string
+	// On switches power on
+	On() error
+	// Off switches power off
+	Off() error
+	// Status reports whether power is on
+	Status() (bool, error)
+}
+
+// Options configures a power backend
+type Options struct {
+	Backend   string
+	Host      string
+	Relay     int
+	MAC       string
+	Broadcast string
+	Timeout   time.Duration
+}
+
+// Backends lists the supported backend names
+var Backends = []string{"tasmota", "shelly", "wol"}
+
+// New creates the backend selected in opts
+func New(opts Options) (Backend, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	httpClient := &http.Client{Timeout: opts.Timeout}
+
+	switch strings.ToLower(opts.Backend) {
+	case "tasmota":
+		if opts.Host == "" {
+			return nil, fmt.Errorf("power.host is required for the tasmota backend")
+		}
+		return &tasmota{host: opts.Host, client: httpClient}, nil
+	case "shelly":
+		if opts.Host == "" {
+			return nil, fmt.Errorf("power.host is required for the shelly backend")
+		}
+		return &shelly{host: opts.Host, relay: opts.Relay, client: httpClient}, nil
+	case "wol":
+		if opts.MAC == "" {
+			return nil, fmt.Errorf("power.mac is required for the wol backend")
+		}
+		broadcast := opts.Broadcast
+		if broadcast == "" {
+			broadcast = "255.255.255.255:9"
+		}
+		return &wol{mac: opts.MAC, broadcast: broadcast}, nil
+	case "":
+		return nil, fmt.Errorf("no power backend configured (set [power] backend in config.toml)")
+	default:
+		return nil, fmt.Errorf("unknown power backend '%s' (valid: %s)", opts.Backend, strings.Join(Backends, ", "))
+	}
+}
+
+// getJSON performs a GET request and decodes the JSON response into v
+func getJSON(client *http.Client, reqURL string, v interface{}) error {
+	resp, err := client.Get(reqURL)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid response from plug: %w", err)
+	}
+	return nil
+}
+
+// ============================================================================
+// Tasmota
+// ============================================================================
+
+// tasmota controls a plug running Tasmota firmware via its HTTP command API
+type tasmota struct {
+	host   string
+	client *http.Client
+}
+
+func (t *tasmota) Name() string { return "tasmota" }
+
+func (t *tasmota) command(cmnd string) (bool, error) {
+	reqURL := fmt.Sprintf("http://%s/cm?cmnd=%s", t.host, url.QueryEscape(cmnd))
+	var result map[string]interface{}
+	if err := getJSON(t.client, reqURL, &result); err != nil {
+		return false, err
+	}
+	state, ok := result["POWER"].(string)
+	if !ok {
+		return false, fmt.Errorf("unexpected response from plug: %v", result)
+	}
+	return strings.EqualFold(state, "ON"), nil
+}
+
+func (t *tasmota) On() error {
+	_, err := t.command("Power On")
+	return err
+}
+
+func (t *tasmota) Off() error {
+	_, err := t.command("Power Off")
+	return err
+}
+
+func (t *tasmota) Status() (bool, error) {
+	return t.command("Power")
+}
+
+// ============================================================================
+// Shelly (Gen1 HTTP API)
+// ============================================================================
+
+// shelly controls a Shelly relay via the Gen1 /relay endpoint
+type shelly struct {
+	host   string
+	relay  int
+	client *http.Client
+}
+
+func (s *shelly) Name() string { return "shelly" }
+
+func (s *shelly) relayRequest(turn string) (bool, error) {
+	reqURL := fmt.Sprintf("http://%s/relay/%d", s.host, s.relay)
+	if turn != "" {
+		reqURL += "?turn=" + turn
+	}
+	var result struct {
+		IsOn bool `json:"ison"`
+	}
+	if err := getJSON(s.client, reqURL, &result); err != nil {
+		return false, err
+	}
+	return result.IsOn, nil
+}
+
+func (s *shelly) On() error {
+	_, err := s.relayRequest("on")
+	return err
+}
+
+func (s *shelly) Off() error {
+	_, err := s.relayRequest("off")
+	return err
+}
+
+func (s *shelly) Status() (bool, error) {
+	return s.relayRequest("")
+}
@@ -0,0 +1,55 @@
+package power
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+)
+
+// wol wakes a device by sending a Wake-on-LAN magic packet.
+// It can only switch power on.
+type wol struct {
+	mac       string
+	broadcast string
+}
+
+func (w *wol) Name() string { return "wol" }
+
+func (w *wol) On() error {
+	hw, err := net.ParseMAC(w.mac)
+	if err != nil {
+		return fmt.Errorf("invalid MAC address '%s': %w", w.mac, err)
+	}
+
+	packet := magicPacket(hw)
+
+	conn, err := net.Dial("udp", w.broadcast)
+	if err != nil {
+		return fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(packet); err != nil {
+		return fmt.Errorf("failed to send magic packet: %w", err)
+	}
+	return nil
+}
+
+func (w *wol) Off() error {
+	return ErrUnsupported
+}
+
+func (w *wol) Status() (bool, error) {
+	return false, ErrUnsupported
+}
+
+// magicPacket builds a Wake-on-LAN packet: 6 bytes of 0xFF followed by
+// the target MAC address repeated 16 times
+func magicPacket(hw net.HardwareAddr) []byte {
+	var buf bytes.Buffer
+	buf.Write(bytes.Repeat([]byte{0xFF}, 6))
+	for i := 0; i < 16; i++ {
+		buf.Write(hw)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,113 @@
+// Package safename turns file names into ones the Ultimate can store on
+// FAT and show to the C64 as CBM file names: printable ASCII that PETSCII
+// also has, without the characters CBM DOS parses in names.
+package safename
+
+import (
+	"path"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// allowedPunct is the punctuation kept in names. CBM DOS parses " * , :
+// = ? and / in names, FAT rejects < > \ | as well, and PETSCII has no
+// ` { } ~.
+const allowedPunct = " !#$%&'()+-.;@[]^_"
+
+// Fallback replaces a character without a safe equivalent
+const Fallback = "_"
+
+// letters are transliterations Unicode decomposition does not provide
+var letters = map[rune]string{
+	'ä': "ae", 'ö': "oe", 'ü': "ue", 'Ä': "Ae", 'Ö': "Oe", 'Ü': "Ue", 'ß': "ss",
+	'æ': "ae", 'Æ': "Ae", 'œ': "oe", 'Œ': "Oe", 'ø': "o", 'Ø': "O",
+	'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'þ': "th", 'Þ': "Th",
+	'–': "-", '—': "-", '‘': "'", '’': "'", '“': "'", '”': "'", '…': "...",
+}
+
+// Rules are the transliteration rules
+type Rules struct {
+	// Replace holds custom replacements, applied before the built-in ones;
+	// each is a string and what it becomes
+	Replace [][2]string
+	// MaxLength shortens longer names, keeping the extension; 0 for no
+	// limit
+	MaxLength int
+}
+
+// Name returns a safe version of a file name: custom replacements first,
+// then umlauts and ligatures spelled out, accents removed, and any other
+// unsafe character replaced by Fallback
+func (r *Rules) Name(name string) string {
+	if len(r.Replace) > 0 {
+		pairs := make([]string, 0, 2*len(r.Replace))
+		for _, p := range r.Replace {
+			pairs = append(pairs, p[0], p[1])
+		}
+		name = strings.NewReplacer(pairs...).Replace(name)
+	}
+
+	var b strings.Builder
+	for _, c := range name {
+		switch {
+		case safe(c):
+			b.WriteRune(c)
+		case letters[c] != "":
+			b.WriteString(letters[c])
+		default:
+			// é is e followed by a combining accent
+			base := ""
+			for _, d := range norm.NFD.String(string(c)) {
+				if safe(d) {
+					base += string(d)
+				} else if !unicode.Is(unicode.Mn, d) {
+					base = ""
+					break
+				}
+			}
+			if base == "" {
+				base = Fallback
+			}
+			b.WriteString(base)
+		}
+	}
+
+	// FAT drops trailing dots and spaces
+	safeName := strings.TrimRight(strings.TrimSpace(b.String()), ". ")
+	if safeName == "" {
+		safeName = Fallback
+	}
+	if r.MaxLength > 0 && len(safeName) > r.MaxLength {
+		ext := path.Ext(safeName)
+		if len(ext) >= r.MaxLength {
+			ext = ""
+		}
+		safeName = strings.TrimRight(safeName[:r.MaxLength-len(ext)], ". ") + ext
+	}
+	return safeName
+}
+
+// Path applies Name to each element of a slash-separated path
+func (r *Rules) Path(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		if part != "" {
+			parts[i] = r.Name(part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Unsafe reports whether a name has characters Name would change, not
+// counting the length limit
+func Unsafe(name string) bool {
+	return (&Rules{}).Name(name) != name
+}
+
+// safe reports whether a character may appear in a name as it is
+func safe(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.ContainsRune(allowedPunct, c)
+}
@@ -0,0 +1,102 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Job is a c64u command line that runs on a schedule
+type Job struct {
+	Name     string
+	Spec     string
+	Command  string
+	Args     []string
+	Schedule Schedule
+}
+
+// NewJob parses the schedule spec and command line of a job
+func NewJob(name, spec, command string) (*Job, error) {
+	if name == "" {
+		return nil, fmt.Errorf("scheduled job is missing a name")
+	}
+
+	sched, err := Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("job '%s': invalid schedule '%s': %w", name, spec, err)
+	}
+
+	args, err := SplitCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("job '%s': %w", name, err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("job '%s': command is empty", name)
+	}
+	// Allow the command to be written with or without the program name
+	if args[0] == "c64u" {
+		args = args[1:]
+	}
+
+	return &Job{
+		Name:     name,
+		Spec:     spec,
+		Command:  command,
+		Args:     args,
+		Schedule: sched,
+	}, nil
+}
+
+// Next returns the job's next activation after t
+func (j *Job) Next(t time.Time) time.Time {
+	return j.Schedule.Next(t)
+}
+
+// SplitCommand splits a command line into arguments, honoring single and
+// double quotes and backslash escapes
+func SplitCommand(command string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command: %s", command)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
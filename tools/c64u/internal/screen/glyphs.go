@@ -0,0 +1,78 @@
+package screen
+
+// Character sets
+const (
+	Uppercase = "uppercase"
+	Lowercase = "lowercase"
+	Custom    = "custom"
+)
+
+// CharsetFrom returns the character generator address for values of
+// $DD00 and $D018, and which character set it holds: the VIC sees the
+// ROM sets at $1000 (uppercase/graphics) and $1800 (lowercase/uppercase)
+// of banks 0 and 2, anything else is a custom set in RAM
+func CharsetFrom(cia, vic byte) (int, string) {
+	bank := 3 - int(cia&0x03)
+	offset := int(vic>>1&0x07) * 0x800
+	if bank%2 == 0 {
+		switch offset {
+		case 0x1000:
+			return bank*0x4000 + offset, Uppercase
+		case 0x1800:
+			return bank*0x4000 + offset, Lowercase
+		}
+	}
+	return bank*0x4000 + offset, Custom
+}
+
+// Graphics characters $40-$7F of the uppercase set, approximated with box
+// drawing and block elements most terminal fonts have
+const upperGraphics = "─♠│────││╮╰╯⌊╲╱⌈⌉●─♥│╭╳○♣│♦┼▒│π◥" +
+	" ▌▄▔▁▏▒▕▒◤▐├▗└┐▂┌┴┬┤▎▍▐▔▀▃⌋▖▝┘▘▚"
+
+// legacyGraphics are the exact glyphs from Unicode's Symbols for Legacy
+// Computing block, which fewer fonts cover
+var legacyGraphics = map[byte]rune{
+	0x43: '🭸', 0x44: '🭷', 0x45: '🭶', 0x46: '🭺', 0x47: '🭱', 0x48: '🭴',
+	0x4C: '🭼', 0x4F: '🭽', 0x50: '🭾', 0x52: '🭻', 0x54: '🭰', 0x59: '🭵',
+	0x5C: '🮌', 0x68: '🮏', 0x6A: '🮇', 0x76: '🮈', 0x77: '🮂', 0x78: '🮃',
+	0x7A: '🭿',
+}
+
+// lowerGraphics are the graphics characters of the lowercase set that
+// differ from the uppercase set, approximated and exact
+var (
+	lowerGraphics       = map[byte]rune{0x5E: '▒', 0x5F: '▒', 0x69: '▒', 0x7A: '✓'}
+	lowerLegacyGraphics = map[byte]rune{0x5E: '🮖', 0x5F: '🮘', 0x69: '🮙', 0x7A: '✓'}
+)
+
+var upperGraphicsRunes = []rune(upperGraphics)
+
+// Glyph returns the Unicode character for a screen code in the uppercase
+// or lowercase character set. Reversed characters return their normal
+// form. legacy uses the Symbols for Legacy Computing where box drawing and
+// block elements only come close.
+func Glyph(code byte, lower, legacy bool) rune {
+	code &= 0x7F
+	if code < 0x40 {
+		if lower && code >= 0x01 && code <= 0x1A {
+			return rune('a' + code - 1)
+		}
+		return CodeToRune(code)
+	}
+	if lower {
+		if code >= 0x41 && code <= 0x5A {
+			return rune('A' + code - 0x41)
+		}
+		if r, ok := lowerGraphics[code]; ok {
+			if legacy {
+				return lowerLegacyGraphics[code]
+			}
+			return r
+		}
+	}
+	if r, ok := legacyGraphics[code]; ok && legacy {
+		return r
+	}
+	return upperGraphicsRunes[code-0x40]
+}
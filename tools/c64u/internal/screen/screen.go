@@ -0,0 +1,157 @@
+package screen
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+)
+
+// Text screen dimensions
+const (
+	Columns = 40
+	Rows    = 25
+	Size    = Columns * Rows
+)
+
+// Screen is a snapshot of the C64 text screen
+type Screen struct {
+	// Base is the address of screen memory
+	Base int
+	// Codes holds the screen codes, row by row
+	Codes []byte
+}
+
+// Base returns the current screen memory address from the VIC bank
+// ($DD00) and video matrix ($D018) registers
+func Base(c *api.Client) (int, error) {
+	cia, err := readMem(c, 0xDD00, 1)
+	if err != nil {
+		return 0, err
+	}
+	vic, err := readMem(c, 0xD018, 1)
+	if err != nil {
+		return 0, err
+	}
+	return BaseFrom(cia[0], vic[0]), nil
+}
+
+// BaseFrom returns the screen memory address for values of $DD00 and $D018
+func BaseFrom(cia, vic byte) int {
+	bank := 3 - int(cia&0x03)
+	return bank*0x4000 + int(vic>>4)*0x400
+}
+
+// Read captures the text screen via DMA
+func Read(c *api.Client) (*Screen, error) {
+	base, err := Base(c)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := readMem(c, base, Size)
+	if err != nil {
+		return nil, err
+	}
+	return &Screen{Base: base, Codes: codes}, nil
+}
+
+// Lines returns the screen as text, one string per row with trailing
+// spaces removed
+func (s *Screen) Lines() []string {
+	lines := make([]string, 0, Rows)
+	for row := 0; row < Rows && (row+1)*Columns <= len(s.Codes); row++ {
+		var b strings.Builder
+		for _, code := range s.Codes[row*Columns : (row+1)*Columns] {
+			b.WriteRune(CodeToRune(code))
+		}
+		lines = append(lines, strings.TrimRight(b.String(), " "))
+	}
+	return lines
+}
+
+// Text returns the screen as newline separated text
+func (s *Screen) Text() string {
+	return strings.Join(s.Lines(), "\n")
+}
+
+// Contains reports whether text appears on the screen (case-insensitive)
+func (s *Screen) Contains(text string) bool {
+	return strings.Contains(strings.ToUpper(s.Text()), strings.ToUpper(text))
+}
+
+// Find returns the row and column where text first appears on the screen
+// (case-insensitive), counting from 0
+func (s *Screen) Find(text string) (row, col int, ok bool) {
+	text = strings.ToUpper(text)
+	for row, line := range s.Lines() {
+		if i := strings.Index(strings.ToUpper(line), text); i >= 0 {
+			return row, len([]rune(line[:i])), true
+		}
+	}
+	return 0, 0, false
+}
+
+// WaitFor polls the screen until text appears or timeout elapses
+func WaitFor(c *api.Client, text string, timeout, interval time.Duration) (*Screen, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		s, err := Read(c)
+		if err != nil {
+			return nil, err
+		}
+		if s.Contains(text) {
+			return s, nil
+		}
+		if time.Now().After(deadline) {
+			return s, fmt.Errorf("timed out after %s waiting for %q on screen", timeout, text)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// CodeToRune converts a screen code (uppercase/graphics charset) to a
+// printable rune. Reversed characters are shown as their normal form.
+func CodeToRune(code byte) rune {
+	code &= 0x7F
+	switch {
+	case code == 0x00:
+		return '@'
+	case code >= 0x01 && code <= 0x1A:
+		return rune('A' + code - 1)
+	case code == 0x1B:
+		return '['
+	case code == 0x1C:
+		return '£'
+	case code == 0x1D:
+		return ']'
+	case code == 0x1E:
+		return '↑'
+	case code == 0x1F:
+		return '←'
+	case code >= 0x20 && code <= 0x3F:
+		return rune(code)
+	case code == 0x40:
+		return '─'
+	case code == 0x60:
+		return ' '
+	default:
+		return '·'
+	}
+}
+
+// readMem reads length bytes at address via DMA
+func readMem(c *api.Client, address, length int) ([]byte, error) {
+	resp, err := c.MachineReadMem(fmt.Sprintf("%04X", address), length)
+	if err != nil {
+		return nil, err
+	}
+	if resp.HasErrors() {
+		return nil, fmt.Errorf("read of $%04X failed: %s", address, strings.Join(resp.Errors, "; "))
+	}
+	if len(resp.RawBody) < length {
+		return nil, fmt.Errorf("short read at $%04X: got %d of %d bytes", address, len(resp.RawBody), length)
+	}
+	return resp.RawBody[:length], nil
+}
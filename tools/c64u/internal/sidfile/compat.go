@@ -0,0 +1,86 @@
+package sidfile
+
+import "fmt"
+
+// Check lists the reasons a song (1-based, 0 for the start song) of a SID
+// file may not play correctly on the Ultimate's SID player: violations of
+// the RSID rules, features the player does not emulate and timing that
+// depends on the machine. file is the whole SID file.
+func (h *Header) Check(file []byte, song int) []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if song == 0 {
+		song = h.StartSong
+	}
+	if song < 1 || song > h.Songs {
+		add("song %d does not exist, the tune has %d", song, h.Songs)
+	}
+
+	data := h.Payload(file)
+	load, init := int(h.LoadAddress), int(h.Init())
+	end := load + len(data)
+	switch {
+	case len(data) == 0:
+		add("the file has no C64 data")
+	case end > 0x10000:
+		add("the data at $%04X is %d bytes too long and wraps past $FFFF", load, end-0x10000)
+	case h.Format == "PSID" && overlaps(load, end, 0xD000, 0xE000):
+		add("the data at $%04X-$%04X overlaps the I/O area $D000-$DFFF", load, end-1)
+	}
+
+	if h.Format == "RSID" {
+		// RSID tunes run in a real C64 environment and must follow its rules
+		if h.BasicFlag() {
+			add("the tune is a BASIC program started with RUN, which the player may not support")
+		} else if init < 0x07E8 || overlaps(init, init+1, 0xA000, 0xC000) || init >= 0xD000 {
+			add("the init address $%04X is outside RAM the tune may use ($07E8-$9FFF, $C000-$CFFF)", init)
+		}
+		if !h.embeddedLoad {
+			add("RSID tunes must store the load address in the data, not the header")
+		}
+		if load < 0x07E8 {
+			add("RSID data must load at $07E8 or above, not $%04X", load)
+		}
+		if h.PlayAddress != 0 {
+			add("RSID tunes must install their own interrupt, but the play address is $%04X", h.PlayAddress)
+		}
+		if h.Speed != 0 {
+			add("RSID tunes must have speed 0, not $%08X", h.Speed)
+		}
+		if h.DataOffset != 0x7C {
+			add("RSID data must start at offset $7C, not $%02X", h.DataOffset)
+		}
+	} else if h.PlayAddress == 0 && !h.UsesCIA(song) {
+		add("the tune has no play address but song %d asks for vertical blank timing", song)
+	}
+
+	if h.StartPage == 0xFF {
+		add("the header declares no free memory for the player's driver")
+	} else if h.StartPage != 0 && h.PageLength == 0 {
+		add("the free memory at $%02X00 has a length of 0 pages", h.StartPage)
+	}
+
+	// Nonstandard speeds
+	if h.Songs > 32 && h.Speed&(1<<31) != 0 {
+		add("songs 32-%d all use CIA timing (the speed field has 32 bits)", h.Songs)
+	} else if h.Songs < 32 && h.Speed>>uint(max(h.Songs, 0)) != 0 {
+		add("the speed field has bits set for songs beyond %d", h.Songs)
+	}
+	if h.Clock() == ClockNTSC {
+		add("the tune is made for NTSC machines and plays too slow on PAL")
+	}
+
+	for i, addr := range []uint16{h.SecondSID, h.ThirdSID} {
+		switch {
+		case addr == 0:
+		case overlaps(int(addr), int(addr)+1, 0xD420, 0xD800), overlaps(int(addr), int(addr)+1, 0xDE00, 0xE000):
+			add("the tune needs a %s SID at $%04X", []string{"second", "third"}[i], addr)
+		default:
+			add("the %s SID address $%04X is invalid", []string{"second", "third"}[i], addr)
+		}
+	}
+	return problems
+}
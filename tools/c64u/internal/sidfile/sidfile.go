@@ -0,0 +1,186 @@
+// Package sidfile reads the header of PSID/RSID music files
+package sidfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNotSID is returned for data without a PSID or RSID header
+var ErrNotSID = errors.New("not a PSID/RSID file")
+
+// Header is the metadata of a SID file
+type Header struct {
+	// Format is "PSID" or "RSID"
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	Songs     int    `json:"songs"`
+	StartSong int    `json:"start_song"`
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	Released  string `json:"released"`
+
+	DataOffset  int    `json:"-"`
+	LoadAddress uint16 `json:"load_address"`
+	InitAddress uint16 `json:"init_address"`
+	PlayAddress uint16 `json:"play_address"`
+	// Speed has a bit per song (bit 0 for song 1, bit 31 for songs 32
+	// and up): 0 for the vertical blank interrupt, 1 for a CIA timer
+	Speed uint32 `json:"speed"`
+
+	// Version 2+ fields
+	Flags uint16 `json:"flags"`
+	// StartPage and PageLength give a free memory range for a player
+	// (0: the tune only uses its load range; $FF: no free memory)
+	StartPage  int `json:"start_page"`
+	PageLength int `json:"page_length"`
+	// SecondSID and ThirdSID are the addresses of the extra SIDs of
+	// version 3 and 4 tunes (0: none)
+	SecondSID uint16 `json:"second_sid,omitempty"`
+	ThirdSID  uint16 `json:"third_sid,omitempty"`
+
+	// embeddedLoad is set when the load address is stored in the first
+	// two data bytes
+	embeddedLoad bool
+}
+
+// Video standards, from bits 2-3 of Flags
+const (
+	ClockUnknown = 0
+	ClockPAL     = 1
+	ClockNTSC    = 2
+	ClockAny     = 3
+)
+
+// Parse reads the header at the start of data
+func Parse(data []byte) (*Header, error) {
+	if len(data) < 0x76 {
+		return nil, ErrNotSID
+	}
+	format := string(data[0:4])
+	if format != "PSID" && format != "RSID" {
+		return nil, ErrNotSID
+	}
+
+	be := binary.BigEndian
+	h := &Header{
+		Format:      format,
+		Version:     int(be.Uint16(data[0x04:])),
+		DataOffset:  int(be.Uint16(data[0x06:])),
+		LoadAddress: be.Uint16(data[0x08:]),
+		InitAddress: be.Uint16(data[0x0A:]),
+		PlayAddress: be.Uint16(data[0x0C:]),
+		Songs:       int(be.Uint16(data[0x0E:])),
+		StartSong:   int(be.Uint16(data[0x10:])),
+		Speed:       be.Uint32(data[0x12:]),
+		Title:       field(data[0x16:0x36]),
+		Author:      field(data[0x36:0x56]),
+		Released:    field(data[0x56:0x76]),
+	}
+	if h.DataOffset < 0x76 || h.DataOffset > len(data) {
+		return nil, fmt.Errorf("%w: invalid data offset $%04X", ErrNotSID, h.DataOffset)
+	}
+	if h.Version >= 2 && h.DataOffset >= 0x7C && len(data) >= 0x7A {
+		h.Flags = be.Uint16(data[0x76:])
+		h.StartPage, h.PageLength = int(data[0x78]), int(data[0x79])
+	}
+	if h.Version >= 3 && len(data) >= 0x7C {
+		h.SecondSID = sidAddress(data[0x7A])
+		if h.Version >= 4 {
+			h.ThirdSID = sidAddress(data[0x7B])
+		}
+	}
+	if h.LoadAddress == 0 && len(data) >= h.DataOffset+2 {
+		// The load address is stored in the first two data bytes
+		h.LoadAddress = binary.LittleEndian.Uint16(data[h.DataOffset:])
+		h.embeddedLoad = true
+	}
+	return h, nil
+}
+
+// Payload returns the C64 data of a SID file (the whole file, as passed
+// to Parse), without an embedded load address
+func (h *Header) Payload(file []byte) []byte {
+	off := h.DataOffset
+	if h.embeddedLoad {
+		off += 2
+	}
+	if off > len(file) {
+		return nil
+	}
+	return file[off:]
+}
+
+// Init returns the init address, which defaults to the load address
+func (h *Header) Init() uint16 {
+	if h.InitAddress == 0 {
+		return h.LoadAddress
+	}
+	return h.InitAddress
+}
+
+// UsesCIA reports whether a song (1-based) is timed by a CIA timer rather
+// than the vertical blank
+func (h *Header) UsesCIA(song int) bool {
+	bit := min(max(song, 1), 32) - 1
+	return h.Speed&(1<<bit) != 0
+}
+
+// Clock returns the video standard the tune was made for (ClockPAL,
+// ClockNTSC, ClockAny or ClockUnknown)
+func (h *Header) Clock() int {
+	return int(h.Flags>>2) & 3
+}
+
+// Model returns the SID model the tune was made for ("6581", "8580",
+// "6581/8580" or "" if unknown), from bits 4-5 of Flags
+func (h *Header) Model() string {
+	return [...]string{"", "6581", "8580", "6581/8580"}[(h.Flags>>4)&3]
+}
+
+// BasicFlag reports whether an RSID tune needs the BASIC interpreter
+// (its init address is then ignored and the tune is started with RUN)
+func (h *Header) BasicFlag() bool {
+	return h.Format == "RSID" && h.Flags&0x02 != 0
+}
+
+// Read parses the header of a SID file
+func Read(path string) (*Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 0x7E)
+	n, _ := f.Read(buf)
+	h, err := Parse(buf[:n])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return h, nil
+}
+
+// sidAddress decodes the middle two digits of an extra SID's address
+// ($Dxx0); 0 and odd values mean no SID
+func sidAddress(b byte) uint16 {
+	if b == 0 || b&1 != 0 {
+		return 0
+	}
+	return 0xD000 | uint16(b)<<4
+}
+
+// field decodes a NUL-padded Latin-1 header string
+func field(b []byte) string {
+	var s strings.Builder
+	for _, c := range b {
+		if c == 0 {
+			break
+		}
+		s.WriteRune(rune(c))
+	}
+	return strings.TrimSpace(s.String())
+}
@@ -0,0 +1,237 @@
+package sidfile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/asm6502"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+)
+
+// ErrCannotWrap is returned for tunes that cannot be run from a PRG
+var ErrCannotWrap = errors.New("cannot wrap tune")
+
+// A wrapped tune is a PRG at $0801 with a BASIC line "SYS 2061", code that
+// prints the tune's credits and copies the player to free memory, the
+// player, and the tune data. The player moves the tune to its load
+// address, sets the memory configuration and timer the PSID conventions
+// expect, calls init with the song number and plays from an interrupt.
+//
+// The interrupt is the kernal's ($0314) unless the tune occupies
+// $E000-$FFFF, in which case the kernal is banked out and the hardware
+// vector ($FFFE) is used.
+
+const (
+	prgStart = 0x0801
+	sysAddr  = 0x080D // address of the code after the BASIC line
+)
+
+// WrapPRG builds a PRG that plays a song (1-based, 0 for the start song)
+// of a SID file. file is the whole SID file.
+func WrapPRG(h *Header, file []byte, song int) ([]byte, error) {
+	if h.BasicFlag() {
+		return nil, fmt.Errorf("%w: the RSID tune is a BASIC program", ErrCannotWrap)
+	}
+	if song == 0 {
+		song = h.StartSong
+	}
+	if song < 1 || song > max(h.Songs, 1) {
+		return nil, fmt.Errorf("%w: song %d does not exist (1-%d)", ErrCannotWrap, song, h.Songs)
+	}
+	data := h.Payload(file)
+	load := int(h.LoadAddress)
+	end := load + len(data)
+	if len(data) == 0 || load < 0x0200 || end > 0x10000 {
+		return nil, fmt.Errorf("%w: data at $%04X-$%04X is outside $0200-$FFFF", ErrCannotWrap, load, end-1)
+	}
+	if overlaps(load, end, 0xD000, 0xE000) {
+		return nil, fmt.Errorf("%w: the tune occupies the I/O area $D000-$DFFF", ErrCannotWrap)
+	}
+	bank := byte(0x37)
+	switch {
+	case overlaps(load, end, 0xE000, 0x10000):
+		bank = 0x35
+	case overlaps(load, end, 0xA000, 0xC000):
+		bank = 0x36
+	}
+
+	// The player's final address must not collide with the tune, nor with
+	// the PRG it is copied from. Its size depends on the direction the tune
+	// is moved in, so room is left for the longer variant.
+	credits := creditText(h)
+	stage1 := buildStage1(credits, 0, 0, 0)
+	playerSrc := sysAddr + len(stage1)
+	size := max(len(buildPlayer(h, song, bank, 0, load+1, load, len(data))),
+		len(buildPlayer(h, song, bank, 0, load-1, load, len(data))))
+	tuneSrc := playerSrc + size
+	prgEnd := tuneSrc + len(data)
+	if prgEnd > 0x10000 {
+		return nil, fmt.Errorf("%w: the tune is too large to be loaded at $0801", ErrCannotWrap)
+	}
+	at, ok := playerAddress(h, bank, size, load, end, prgEnd)
+	if !ok {
+		return nil, fmt.Errorf("%w: no free memory for the player", ErrCannotWrap)
+	}
+	player := buildPlayer(h, song, bank, at, tuneSrc, load, len(data))
+	player = append(player, make([]byte, size-len(player))...)
+	stage1 = buildStage1(credits, playerSrc, at, size)
+
+	prg := []byte{prgStart & 0xFF, prgStart >> 8}
+	// 10 SYS2061
+	prg = append(prg, 0x0B, 0x08, 0x0A, 0x00, 0x9E, '2', '0', '6', '1', 0x00, 0x00, 0x00)
+	prg = append(prg, stage1...)
+	prg = append(prg, player...)
+	return append(prg, data...), nil
+}
+
+// overlaps reports whether [a, b) and [c, d) overlap
+func overlaps(a, b, c, d int) bool {
+	return a < d && c < b
+}
+
+// playerAddress picks free memory for the player: the range the header
+// declares free, the cassette buffer, or a page outside tune and PRG
+func playerAddress(h *Header, bank byte, size, load, end, prgEnd int) (int, bool) {
+	var candidates []int
+	if h.StartPage != 0 && h.StartPage != 0xFF && h.PageLength*256 >= size {
+		candidates = append(candidates, h.StartPage*256)
+	}
+	candidates = append(candidates, 0x033C)
+	for page := 0xC000; page >= 0x0800; page -= 0x100 {
+		candidates = append(candidates, page)
+	}
+	for _, at := range candidates {
+		switch {
+		case at == 0x033C && size > 0x03FC-0x033C:
+		case overlaps(at, at+size, load, end), overlaps(at, at+size, prgStart, prgEnd):
+		case overlaps(at, at+size, 0xA000, 0xC000) && bank == 0x37:
+		case at >= 0x0400 && at < 0x0800, at+size > 0xD000:
+		default:
+			return at, true
+		}
+	}
+	return 0, false
+}
+
+// creditText returns the tune's title, author and release as PETSCII
+// lines for CHROUT in the uppercase character set
+func creditText(h *Header) []byte {
+	out := []byte{0x93} // clear screen
+	for _, line := range []string{h.Title, h.Author, h.Released} {
+		for _, r := range strings.ToLower(line) {
+			b, ok := petscii.RuneToPETSCII(r)
+			if !ok || b >= 0x80 {
+				b = '?'
+			}
+			out = append(out, b)
+		}
+		out = append(out, 0x0D)
+	}
+	return append(out, 0)
+}
+
+// buildStage1 prints the credits and copies the player (size bytes at
+// src) to its address, then runs it
+func buildStage1(credits []byte, src, dst, size int) []byte {
+	a := asm6502.New(sysAddr)
+	a.Op(0xA2, 0x00) // ldx #0
+	a.Label("print")
+	a.AbsLabel(0xBD, "text") // lda text,x
+	a.Branch(0xF0, "copy")   // beq copy
+	a.Abs(0x20, 0xFFD2)      // jsr CHROUT
+	a.Op(0xE8)               // inx
+	a.Branch(0xD0, "print")  // bne print
+	a.Label("copy")
+	a.Op(0x78)       // sei
+	a.Op(0xA2, 0x00) // ldx #0
+	a.Label("loop")
+	a.Abs(0xBD, src) // lda src,x
+	a.Abs(0x9D, dst) // sta dst,x
+	a.Op(0xE8)       // inx
+	a.Op(0xE0, byte(size))
+	a.Branch(0xD0, "loop") // bne loop
+	a.Abs(0x4C, dst)       // jmp player
+	a.Label("text")
+	a.Op(credits...)
+	return a.Bytes()
+}
+
+// buildPlayer builds the player at address at: it moves size bytes of
+// tune data from src to load, sets up memory and timing and starts the
+// song
+func buildPlayer(h *Header, song int, bank byte, at, src, load, size int) []byte {
+	a := asm6502.New(at)
+	a.Op(0xA9, 0x34, 0x85, 0x01) // lda #$34, sta $01: all RAM while moving
+	if load < src {
+		a.MoveForward(src, load, size)
+	} else {
+		a.MoveBackward(src, load, size)
+	}
+	a.Op(0xA9, bank, 0x85, 0x01) // lda #bank, sta $01
+
+	play := int(h.PlayAddress)
+	cia := h.UsesCIA(song) || h.Format == "RSID"
+	if play != 0 {
+		vector := 0x0314
+		if bank == 0x35 {
+			vector = 0xFFFE
+			a.AbsLabel(0xA9, "<nmi")
+			a.Abs(0x8D, 0xFFFA)
+			a.AbsLabel(0xA9, ">nmi")
+			a.Abs(0x8D, 0xFFFB)
+		}
+		a.AbsLabel(0xA9, "<irq")
+		a.Abs(0x8D, vector)
+		a.AbsLabel(0xA9, ">irq")
+		a.Abs(0x8D, vector+1)
+	}
+
+	if cia || play == 0 {
+		// CIA 1 timer A at the kernal's 60 Hz rate; without a play
+		// address the interrupt handler is the tune's own
+		timer := 0x4025
+		if h.Clock() == ClockNTSC {
+			timer = 0x4295
+		}
+		a.Op(0xA9, byte(timer), 0x8D, 0x04, 0xDC) // lda #<timer, sta $dc04
+		a.Op(0xA9, byte(timer>>8), 0x8D, 0x05, 0xDC)
+		if play != 0 || bank != 0x35 {
+			a.Op(0xA9, 0x81, 0x8D, 0x0D, 0xDC) // enable timer A interrupt
+		}
+		a.Op(0xA9, 0x11, 0x8D, 0x0E, 0xDC) // start timer A
+	} else {
+		// Raster interrupt once per frame, CIA interrupts off
+		a.Op(0xA9, 0x7F, 0x8D, 0x0D, 0xDC, 0xAD, 0x0D, 0xDC)
+		a.Op(0xAD, 0x11, 0xD0, 0x29, 0x7F, 0x8D, 0x11, 0xD0) // clear raster bit 8
+		a.Op(0xA9, 0xFB, 0x8D, 0x12, 0xD0)                   // line 251
+		a.Op(0xA9, 0x01, 0x8D, 0x1A, 0xD0, 0x8D, 0x19, 0xD0)
+	}
+
+	a.Op(0xA9, byte(song-1))   // lda #song
+	a.Abs(0x20, int(h.Init())) // jsr init
+	a.Op(0x58)                 // cli
+	a.Label("idle")
+	a.AbsLabel(0x4C, "idle") // jmp idle
+
+	if play != 0 {
+		a.Label("irq")
+		if bank == 0x35 {
+			a.Op(0x48, 0x8A, 0x48, 0x98, 0x48) // pha, txa, pha, tya, pha
+		}
+		if cia {
+			a.Op(0xAD, 0x0D, 0xDC) // lda $dc0d: acknowledge
+		} else {
+			a.Op(0xA9, 0x01, 0x8D, 0x19, 0xD0) // acknowledge raster
+		}
+		a.Abs(0x20, play) // jsr play
+		if bank == 0x35 {
+			a.Op(0x68, 0xA8, 0x68, 0xAA, 0x68) // pla, tay, pla, tax, pla
+			a.Label("nmi")
+			a.Op(0x40) // rti
+		} else {
+			a.Abs(0x4C, 0xEA81) // jmp $ea81: restore registers, rti
+		}
+	}
+	return a.Bytes()
+}
@@ -0,0 +1,127 @@
+// Package stats records local, opt-in command usage statistics: which
+// command ran, how long it took and whether it failed. Arguments, hosts and
+// file names are never recorded.
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Entry is one command invocation
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Command is the command path without arguments, e.g. "drives mount"
+	Command  string        `json:"command"`
+	Duration time.Duration `json:"duration_ns"`
+	ExitCode int           `json:"exit_code"`
+	Version  string        `json:"version,omitempty"`
+}
+
+// Summary aggregates the entries of one command
+type Summary struct {
+	Command  string        `json:"command"`
+	Count    int           `json:"count"`
+	Failures int           `json:"failures"`
+	Total    time.Duration `json:"total_ns"`
+	Mean     time.Duration `json:"mean_ns"`
+	Median   time.Duration `json:"median_ns"`
+	Max      time.Duration `json:"max_ns"`
+}
+
+// FailureRate is the share of failed invocations
+func (s Summary) FailureRate() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Count)
+}
+
+// Append adds an entry to the statistics file (JSON Lines)
+func Append(path string, e Entry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Read returns all recorded entries, oldest first. A missing file has no
+// entries.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Summarize aggregates entries per command, most used first
+func Summarize(entries []Entry) []Summary {
+	durations := make(map[string][]time.Duration)
+	byCommand := make(map[string]*Summary)
+	for _, e := range entries {
+		s := byCommand[e.Command]
+		if s == nil {
+			s = &Summary{Command: e.Command}
+			byCommand[e.Command] = s
+		}
+		s.Count++
+		if e.ExitCode != 0 {
+			s.Failures++
+		}
+		s.Total += e.Duration
+		if e.Duration > s.Max {
+			s.Max = e.Duration
+		}
+		durations[e.Command] = append(durations[e.Command], e.Duration)
+	}
+
+	summaries := make([]Summary, 0, len(byCommand))
+	for cmd, s := range byCommand {
+		d := durations[cmd]
+		sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+		s.Median = d[len(d)/2]
+		s.Mean = s.Total / time.Duration(s.Count)
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Count != summaries[j].Count {
+			return summaries[i].Count > summaries[j].Count
+		}
+		return summaries[i].Command < summaries[j].Command
+	})
+	return summaries
+}
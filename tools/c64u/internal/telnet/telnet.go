@@ -0,0 +1,218 @@
+// Package telnet is a minimal telnet client for the Ultimate's console.
+// It answers option negotiation (accepting echo and suppress-go-ahead from
+// the server and reporting the window size) and strips protocol commands
+// from the data stream.
+package telnet
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultPort is the Ultimate's telnet port
+const DefaultPort = 23
+
+// Telnet commands and options
+const (
+	cmdSE   = 240
+	cmdSB   = 250
+	cmdWill = 251
+	cmdWont = 252
+	cmdDo   = 253
+	cmdDont = 254
+	cmdIAC  = 255
+
+	optEcho = 1
+	optSGA  = 3
+	optNAWS = 31
+)
+
+// Conn is a telnet connection. Read returns the data sent by the server
+// without telnet commands; Write escapes data for the server.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu       sync.Mutex
+	answered map[[2]byte]bool
+	naws     bool
+	width    int
+	height   int
+}
+
+// Dial connects to the telnet server on host
+func Dial(host string, port int, timeout time.Duration) (*Conn, error) {
+	if port == 0 {
+		port = DefaultPort
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("telnet connection to %s failed: %w", addr, err)
+	}
+	return &Conn{
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+		answered: make(map[[2]byte]bool),
+	}, nil
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Read reads data from the server, handling telnet commands in it
+func (c *Conn) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if n > 0 && c.r.Buffered() == 0 {
+			break
+		}
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if b != cmdIAC {
+			p[n] = b
+			n++
+			continue
+		}
+
+		cmd, err := c.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		switch cmd {
+		case cmdIAC:
+			p[n] = cmdIAC
+			n++
+		case cmdWill, cmdWont, cmdDo, cmdDont:
+			opt, err := c.r.ReadByte()
+			if err != nil {
+				return n, err
+			}
+			if err := c.negotiate(cmd, opt); err != nil {
+				return n, err
+			}
+		case cmdSB:
+			if err := c.skipSubnegotiation(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// negotiate answers an option request once per option, which avoids
+// negotiation loops
+func (c *Conn) negotiate(cmd, opt byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cmd == cmdWont || cmd == cmdDont || c.answered[[2]byte{cmd, opt}] {
+		return nil
+	}
+	c.answered[[2]byte{cmd, opt}] = true
+
+	var reply byte
+	switch {
+	case cmd == cmdWill && (opt == optEcho || opt == optSGA):
+		reply = cmdDo
+	case cmd == cmdWill:
+		reply = cmdDont
+	case opt == optNAWS:
+		reply = cmdWill
+	case opt == optSGA:
+		reply = cmdWill
+	default:
+		reply = cmdWont
+	}
+	if _, err := c.conn.Write([]byte{cmdIAC, reply, opt}); err != nil {
+		return err
+	}
+	if opt == optNAWS && reply == cmdWill {
+		c.naws = true
+		return c.sendSize()
+	}
+	return nil
+}
+
+// skipSubnegotiation discards a subnegotiation up to IAC SE
+func (c *Conn) skipSubnegotiation() error {
+	prev := byte(0)
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if prev == cmdIAC && b == cmdSE {
+			return nil
+		}
+		if prev == cmdIAC && b == cmdIAC {
+			b = 0
+		}
+		prev = b
+	}
+}
+
+// Write sends data to the server, escaping IAC bytes and sending a
+// carriage return as CR NUL, as the protocol requires
+func (c *Conn) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p)+8)
+	for _, b := range p {
+		switch b {
+		case cmdIAC:
+			out = append(out, cmdIAC, cmdIAC)
+		case '\r':
+			out = append(out, '\r', 0)
+		default:
+			out = append(out, b)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SetSize reports the terminal size to the server (if it asked for it)
+func (c *Conn) SetSize(width, height int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.width, c.height = width, height
+	if !c.naws {
+		return nil
+	}
+	return c.sendSize()
+}
+
+// sendSize sends the NAWS subnegotiation; c.mu must be held
+func (c *Conn) sendSize() error {
+	if c.width <= 0 || c.height <= 0 {
+		return nil
+	}
+	msg := []byte{cmdIAC, cmdSB, optNAWS}
+	for _, v := range []int{c.width, c.height} {
+		hi, lo := byte(v>>8), byte(v)
+		msg = append(msg, hi)
+		if hi == cmdIAC {
+			msg = append(msg, cmdIAC)
+		}
+		msg = append(msg, lo)
+		if lo == cmdIAC {
+			msg = append(msg, cmdIAC)
+		}
+	}
+	msg = append(msg, cmdIAC, cmdSE)
+	_, err := c.conn.Write(msg)
+	return err
+}
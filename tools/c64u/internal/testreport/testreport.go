@@ -0,0 +1,327 @@
+// Package testreport writes the results of "c64u test run" as JUnit XML
+// or TAP for CI test summaries.
+package testreport
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Outcomes of a test case
+const (
+	Passed  = "passed"
+	Failed  = "failed"
+	Error   = "error"
+	Skipped = "skipped"
+)
+
+// Formats
+const (
+	JUnit = "junit"
+	TAP   = "tap"
+)
+
+// Report is a run of the tests of one spec
+type Report struct {
+	Name      string
+	Timestamp time.Time
+	Cases     []Case
+}
+
+// Case is one test
+type Case struct {
+	Name    string
+	Status  string
+	Time    time.Duration
+	Message string
+	// Details are the lines explaining a failure, e.g. differing rows
+	Details []string
+	// Attachments are files saved for the test, such as screenshots
+	Attachments []string
+	// Asserts are the checks of the machine state, in the order of the spec
+	Asserts []Assert
+}
+
+// Assert is the outcome of one check of a test
+type Assert struct {
+	Name    string
+	Status  string
+	Message string
+}
+
+// failedAsserts counts the asserts that did not pass
+func (c *Case) failedAsserts() int {
+	n := 0
+	for _, a := range c.Asserts {
+		if a.Status != Passed {
+			n++
+		}
+	}
+	return n
+}
+
+// FormatFor returns the format of a report file by its extension
+func FormatFor(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xml":
+		return JUnit, nil
+	case ".tap":
+		return TAP, nil
+	}
+	return "", fmt.Errorf("%s: use .xml for JUnit or .tap for TAP", path)
+}
+
+// WriteFile writes a report in the format its extension names
+func WriteFile(path string, r *Report) error {
+	format, err := FormatFor(path)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if format == JUnit {
+		err = WriteJUnit(f, r)
+	} else {
+		err = WriteTAP(f, r)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// count returns the number of cases with a status
+func (r *Report) count(status string) int {
+	n := 0
+	for _, c := range r.Cases {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Report) time() time.Duration {
+	var total time.Duration
+	for _, c := range r.Cases {
+		total += c.Time
+	}
+	return total
+}
+
+// ============================================================================
+// JUnit XML
+// ============================================================================
+
+type junitSuites struct {
+	XMLName  xml.Name   `xml:"testsuites"`
+	Name     string     `xml:"name,attr"`
+	Tests    int        `xml:"tests,attr"`
+	Failures int        `xml:"failures,attr"`
+	Errors   int        `xml:"errors,attr"`
+	Skipped  int        `xml:"skipped,attr"`
+	Time     string     `xml:"time,attr"`
+	Suites   []junitSet `xml:"testsuite"`
+}
+
+type junitSet struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name       string          `xml:"name,attr"`
+	Class      string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties *junitProps     `xml:"properties,omitempty"`
+	Failure    *junitProblem   `xml:"failure,omitempty"`
+	Error      *junitProblem   `xml:"error,omitempty"`
+	Skipped    *junitProblem   `xml:"skipped,omitempty"`
+	SystemOut  *junitCharacter `xml:"system-out,omitempty"`
+}
+
+type junitProps struct {
+	Properties []junitProp `xml:"property"`
+}
+
+type junitProp struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",cdata"`
+}
+
+type junitCharacter struct {
+	Text string `xml:",cdata"`
+}
+
+// WriteJUnit writes the report as JUnit XML. Asserts are "assert"
+// properties with their status, and the failed ones are listed in the
+// failure text. Attachments are listed as "attachment" properties and as
+// [[ATTACHMENT|path]] lines in system-out, which the Jenkins JUnit
+// attachments plugin picks up.
+func WriteJUnit(w io.Writer, r *Report) error {
+	set := junitSet{
+		Name:      r.Name,
+		Tests:     len(r.Cases),
+		Failures:  r.count(Failed),
+		Errors:    r.count(Error),
+		Skipped:   r.count(Skipped),
+		Time:      seconds(r.time()),
+		Timestamp: r.Timestamp.Format("2006-01-02T15:04:05"),
+	}
+	for _, c := range r.Cases {
+		jc := junitCase{Name: c.Name, Class: r.Name, Time: seconds(c.Time)}
+		details := append([]string(nil), c.Details...)
+		for _, a := range c.Asserts {
+			if a.Status != Passed {
+				details = append(details, fmt.Sprintf("assert %s: %s", a.Name, a.Message))
+			}
+		}
+		problem := &junitProblem{Message: c.Message, Text: strings.Join(details, "\n")}
+		switch c.Status {
+		case Failed:
+			problem.Type = "screen"
+			if c.failedAsserts() > 0 {
+				problem.Type = "assert"
+			}
+			jc.Failure = problem
+		case Error:
+			jc.Error = problem
+		case Skipped:
+			jc.Skipped = &junitProblem{Message: c.Message}
+		}
+		if len(c.Asserts) > 0 || len(c.Attachments) > 0 {
+			jc.Properties = &junitProps{}
+		}
+		for _, a := range c.Asserts {
+			value := a.Status + ": " + a.Name
+			if a.Message != "" {
+				value += " (" + a.Message + ")"
+			}
+			jc.Properties.Properties = append(jc.Properties.Properties, junitProp{Name: "assert", Value: value})
+		}
+		if len(c.Attachments) > 0 {
+			var out strings.Builder
+			for _, a := range c.Attachments {
+				jc.Properties.Properties = append(jc.Properties.Properties, junitProp{Name: "attachment", Value: a})
+				fmt.Fprintf(&out, "[[ATTACHMENT|%s]]\n", a)
+			}
+			jc.SystemOut = &junitCharacter{Text: out.String()}
+		}
+		set.Cases = append(set.Cases, jc)
+	}
+
+	suites := junitSuites{
+		Name:     "c64u",
+		Tests:    set.Tests,
+		Failures: set.Failures,
+		Errors:   set.Errors,
+		Skipped:  set.Skipped,
+		Time:     set.Time,
+		Suites:   []junitSet{set},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// seconds formats a duration as JUnit wants it
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// ============================================================================
+// TAP
+// ============================================================================
+
+// WriteTAP writes the report as TAP version 13, with the message, time,
+// details, asserts and attachments of each test in a YAML block
+func WriteTAP(w io.Writer, r *Report) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "TAP version 13\n1..%d\n", len(r.Cases))
+	for i, c := range r.Cases {
+		name := strings.ReplaceAll(c.Name, "#", `\#`)
+		switch c.Status {
+		case Passed:
+			fmt.Fprintf(&b, "ok %d - %s\n", i+1, name)
+		case Skipped:
+			fmt.Fprintf(&b, "ok %d - %s # SKIP %s\n", i+1, name, c.Message)
+			continue
+		default:
+			fmt.Fprintf(&b, "not ok %d - %s\n", i+1, name)
+		}
+
+		b.WriteString("  ---\n")
+		if c.Message != "" {
+			fmt.Fprintf(&b, "  message: %s\n", yamlString(c.Message))
+		}
+		if c.Status == Error {
+			b.WriteString("  severity: error\n")
+		}
+		fmt.Fprintf(&b, "  duration_ms: %d\n", c.Time.Milliseconds())
+		if len(c.Details) > 0 {
+			b.WriteString("  details: |\n")
+			for _, line := range c.Details {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+		if len(c.Asserts) > 0 {
+			b.WriteString("  asserts:\n")
+			for _, a := range c.Asserts {
+				fmt.Fprintf(&b, "    - name: %s\n      status: %s\n", yamlString(a.Name), a.Status)
+				if a.Message != "" {
+					fmt.Fprintf(&b, "      message: %s\n", yamlString(a.Message))
+				}
+			}
+		}
+		if len(c.Attachments) > 0 {
+			b.WriteString("  attachments:\n")
+			for _, a := range c.Attachments {
+				fmt.Fprintf(&b, "    - %s\n", yamlString(a))
+			}
+		}
+		b.WriteString("  ...\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// yamlString quotes a string for YAML; JSON strings are valid YAML
+func yamlString(s string) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,426 @@
+// Package testspec loads the TOML files of "c64u test run": which
+// programs to start on the device, the screens they must show and the
+// machine state they must leave.
+package testspec
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/diskimage"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/palette"
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/petscii"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Captures compared against the golden reference; CaptureNone only
+// checks the asserts
+const (
+	CaptureText  = "text"
+	CaptureFrame = "frame"
+	CaptureNone  = "none"
+)
+
+// DefaultTimeout is the time a test may wait for its text
+const DefaultTimeout = 30 * time.Second
+
+// Spec is a loaded test file
+type Spec struct {
+	Path  string
+	Tests []*Test
+}
+
+// Test is one program run and the screen it is compared against. Paths
+// are resolved against the directory of the spec.
+type Test struct {
+	Name string
+	// Program is the PRG or CRT to start: a local file, or a file on the
+	// device if there is none
+	Program string
+	// Reset resets the machine and waits for READY. before the program
+	Reset bool
+	// WaitText is waited for after the start, then Keys are typed and
+	// Wait elapses before the capture
+	WaitText string
+	Keys     string
+	Wait     time.Duration
+	Timeout  time.Duration
+	// Capture is CaptureText (screen memory), CaptureFrame (a frame of
+	// the video stream) or CaptureNone
+	Capture string
+	// Golden is the reference: the screen as text, or a PNG; empty with
+	// CaptureNone
+	Golden string
+	// IgnoreRows are text rows (1-25) left out of the comparison, e.g. a
+	// clock or a score
+	IgnoreRows []int
+	// Tolerance is the number of pixels a frame may differ by
+	Tolerance int
+	// Pause halts the CPU while a frame is captured
+	Pause bool
+	// Asserts are checked after the capture, the defaults of the file
+	// first
+	Asserts []*Assert
+}
+
+// What an assert checks
+const (
+	AssertMemory = "memory"
+	AssertBorder = "border"
+	AssertFile   = "file"
+)
+
+// Assert is a check of the machine state after a test
+type Assert struct {
+	Kind string
+	// Address and Length are the memory checked: Equals must be the bytes
+	// at Address, Contains must appear in the Length bytes from there
+	Address  int
+	Length   int
+	Equals   []byte
+	Contains []byte
+	// Color is the border color, 0-15
+	Color int
+	// File is the PETSCII name of a file on the image mounted in Drive;
+	// Type is checked if the name had a type extension
+	Drive     string
+	File      []byte
+	Type      diskimage.FileType
+	CheckType bool
+
+	label string
+}
+
+// String describes the assert for reports, e.g. "memory $C000 equals 01 02"
+func (a *Assert) String() string {
+	return a.label
+}
+
+// duration reads TOML strings such as "1.5s"
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// test is the TOML form of a test; the settings at the top of the file
+// are the defaults of every test
+type test struct {
+	Name       string    `toml:"name"`
+	Program    string    `toml:"program"`
+	Reset      *bool     `toml:"reset"`
+	WaitText   string    `toml:"wait_text"`
+	Keys       string    `toml:"keys"`
+	Wait       *duration `toml:"wait"`
+	Timeout    *duration `toml:"timeout"`
+	Capture    string    `toml:"capture"`
+	Golden     string    `toml:"golden"`
+	IgnoreRows []int     `toml:"ignore_rows"`
+	Tolerance  int       `toml:"tolerance"`
+	Pause      *bool     `toml:"pause"`
+	Asserts    []assert  `toml:"assert"`
+}
+
+// assert is the TOML form of an assert; its key (memory, border or file)
+// says what it checks
+type assert struct {
+	Memory   string      `toml:"memory"`
+	Length   int         `toml:"length"`
+	Equals   string      `toml:"equals"`
+	Contains string      `toml:"contains"`
+	Border   interface{} `toml:"border"`
+	File     string      `toml:"file"`
+	Drive    string      `toml:"drive"`
+}
+
+type file struct {
+	test
+	Tests []test `toml:"test"`
+}
+
+// Load reads and checks a spec
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := toml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(f.Tests) == 0 {
+		return nil, fmt.Errorf("%s: no [[test]] entries", path)
+	}
+
+	dir := filepath.Dir(path)
+	spec := &Spec{Path: path}
+	names := make(map[string]bool)
+	goldens := make(map[string]string)
+	for i, raw := range f.Tests {
+		t, err := resolve(raw, f.test, dir)
+		if err != nil {
+			label := raw.Name
+			if label == "" {
+				label = fmt.Sprintf("test %d", i+1)
+			}
+			return nil, fmt.Errorf("%s: %s: %w", path, label, err)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("%s: two tests are named '%s'", path, t.Name)
+		}
+		if other, ok := goldens[t.Golden]; ok && t.Golden != "" {
+			return nil, fmt.Errorf("%s: '%s' and '%s' both use %s; set golden for one", path, other, t.Name, t.Golden)
+		}
+		names[t.Name] = true
+		if t.Golden != "" {
+			goldens[t.Golden] = t.Name
+		}
+		spec.Tests = append(spec.Tests, t)
+	}
+	return spec, nil
+}
+
+// resolve fills in the defaults of a test and checks it
+func resolve(raw, defaults test, dir string) (*Test, error) {
+	t := &Test{
+		Name:       raw.Name,
+		Program:    pick(raw.Program, defaults.Program),
+		WaitText:   pick(raw.WaitText, defaults.WaitText),
+		Keys:       pick(raw.Keys, defaults.Keys),
+		Capture:    pick(raw.Capture, defaults.Capture, CaptureText),
+		Golden:     raw.Golden,
+		IgnoreRows: raw.IgnoreRows,
+		Tolerance:  raw.Tolerance,
+		Reset:      pickBool(true, raw.Reset, defaults.Reset),
+		Pause:      pickBool(true, raw.Pause, defaults.Pause),
+		Timeout:    DefaultTimeout,
+	}
+	if t.IgnoreRows == nil {
+		t.IgnoreRows = defaults.IgnoreRows
+	}
+	if t.Tolerance == 0 {
+		t.Tolerance = defaults.Tolerance
+	}
+	for _, d := range []*duration{defaults.Wait, raw.Wait} {
+		if d != nil {
+			t.Wait = time.Duration(*d)
+		}
+	}
+	for _, d := range []*duration{defaults.Timeout, raw.Timeout} {
+		if d != nil {
+			t.Timeout = time.Duration(*d)
+		}
+	}
+
+	switch {
+	case t.Name == "":
+		return nil, fmt.Errorf("no name")
+	case t.Program == "":
+		return nil, fmt.Errorf("no program")
+	case t.Capture != CaptureText && t.Capture != CaptureFrame && t.Capture != CaptureNone:
+		return nil, fmt.Errorf("capture must be %s, %s or %s, not '%s'", CaptureText, CaptureFrame, CaptureNone, t.Capture)
+	case t.Timeout <= 0 || t.Wait < 0:
+		return nil, fmt.Errorf("timeout must be positive and wait not negative")
+	case t.Tolerance < 0:
+		return nil, fmt.Errorf("tolerance must not be negative")
+	}
+	for _, row := range t.IgnoreRows {
+		if row < 1 || row > 25 {
+			return nil, fmt.Errorf("ignore_rows: %d is not a row from 1 to 25", row)
+		}
+	}
+	if _, err := petscii.FromKeys(t.Keys); err != nil {
+		return nil, fmt.Errorf("keys: %w", err)
+	}
+	if t.Capture != CaptureText && len(t.IgnoreRows) > 0 {
+		return nil, fmt.Errorf("ignore_rows only applies to the text capture")
+	}
+	asserts := append(append([]assert(nil), defaults.Asserts...), raw.Asserts...)
+	for i, ra := range asserts {
+		a, err := resolveAssert(ra)
+		if err != nil {
+			return nil, fmt.Errorf("assert %d: %w", i+1, err)
+		}
+		t.Asserts = append(t.Asserts, a)
+	}
+	if t.Capture == CaptureNone {
+		switch {
+		case len(t.Asserts) == 0:
+			return nil, fmt.Errorf("capture = \"%s\" needs [[test.assert]] entries", CaptureNone)
+		case t.Golden != "":
+			return nil, fmt.Errorf("golden does not apply to capture = \"%s\"", CaptureNone)
+		}
+	}
+
+	// Device paths are absolute, so a relative path is always local
+	if !filepath.IsAbs(t.Program) {
+		t.Program = filepath.Join(dir, t.Program)
+	}
+	if t.Capture == CaptureNone {
+		return t, nil
+	}
+	if t.Golden == "" {
+		ext := ".txt"
+		if t.Capture == CaptureFrame {
+			ext = ".png"
+		}
+		t.Golden = filepath.Join("golden", Slug(t.Name)+ext)
+	}
+	if !filepath.IsAbs(t.Golden) {
+		t.Golden = filepath.Join(dir, t.Golden)
+	}
+	return t, nil
+}
+
+// resolveAssert checks an assert and converts its values
+func resolveAssert(raw assert) (*Assert, error) {
+	keys := 0
+	for _, set := range []bool{raw.Memory != "", raw.Border != nil, raw.File != ""} {
+		if set {
+			keys++
+		}
+	}
+	if keys != 1 {
+		return nil, fmt.Errorf("give one of memory, border or file")
+	}
+	if raw.Drive != "" && raw.File == "" {
+		return nil, fmt.Errorf("drive only applies to file")
+	}
+	if raw.Memory == "" && (raw.Length != 0 || raw.Equals != "" || raw.Contains != "") {
+		return nil, fmt.Errorf("length, equals and contains only apply to memory")
+	}
+
+	switch {
+	case raw.Border != nil:
+		color, err := parseColor(raw.Border)
+		if err != nil {
+			return nil, fmt.Errorf("border: %w", err)
+		}
+		return &Assert{Kind: AssertBorder, Color: color,
+			label: "border is " + palette.Names[color]}, nil
+
+	case raw.File != "":
+		name, typ, err := diskimage.ParseHostName(raw.File)
+		if err != nil {
+			return nil, fmt.Errorf("file: %w", err)
+		}
+		_, known := diskimage.ParseFileType(strings.ToLower(strings.TrimPrefix(path.Ext(raw.File), ".")))
+		a := &Assert{Kind: AssertFile, Drive: pick(raw.Drive, "a"), File: name, Type: typ, CheckType: known}
+		a.label = fmt.Sprintf("file %s on drive %s", raw.File, a.Drive)
+		return a, nil
+	}
+
+	addr, err := strconv.ParseUint(strings.TrimPrefix(raw.Memory, "$"), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("memory: '%s' is not a hex address", raw.Memory)
+	}
+	a := &Assert{Kind: AssertMemory, Address: int(addr), Length: raw.Length}
+	switch {
+	case (raw.Equals == "") == (raw.Contains == ""):
+		return nil, fmt.Errorf("memory needs equals or contains")
+	case raw.Equals != "":
+		if a.Equals, err = parseBytes(raw.Equals); err != nil {
+			return nil, fmt.Errorf("equals: %w", err)
+		}
+		if a.Length != 0 && a.Length != len(a.Equals) {
+			return nil, fmt.Errorf("length is %d, but equals has %d bytes", a.Length, len(a.Equals))
+		}
+		a.Length = len(a.Equals)
+		a.label = fmt.Sprintf("memory $%04X equals %s", a.Address, raw.Equals)
+	default:
+		if a.Contains, err = parseBytes(raw.Contains); err != nil {
+			return nil, fmt.Errorf("contains: %w", err)
+		}
+		if a.Length == 0 {
+			a.Length = len(a.Contains)
+		}
+		if a.Length < len(a.Contains) {
+			return nil, fmt.Errorf("length is %d, shorter than the %d bytes of contains", a.Length, len(a.Contains))
+		}
+		a.label = fmt.Sprintf("memory $%04X-$%04X contains %s", a.Address, a.Address+a.Length-1, raw.Contains)
+	}
+	if a.Address+a.Length > 0x10000 {
+		return nil, fmt.Errorf("memory: $%04X-$%04X ends past $FFFF", a.Address, a.Address+a.Length-1)
+	}
+	return a, nil
+}
+
+// parseBytes reads hex bytes such as "a9 00 8d 20 d0"
+func parseBytes(text string) ([]byte, error) {
+	data, err := hex.DecodeString(strings.Join(strings.Fields(text), ""))
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("'%s' are no hex bytes", text)
+	}
+	return data, nil
+}
+
+// parseColor reads a VIC-II color as a number or a name such as
+// "light blue"
+func parseColor(v interface{}) (int, error) {
+	switch c := v.(type) {
+	case int64:
+		if c >= 0 && c < palette.NumColors {
+			return int(c), nil
+		}
+	case string:
+		for i, name := range palette.Names {
+			if strings.EqualFold(strings.ReplaceAll(c, "gray", "grey"), name) {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("'%v' is not a color from 0 to 15 or a name such as \"light blue\"", v)
+}
+
+// Slug turns a test name into a file name: lowercase letters, digits and
+// dashes
+func Slug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "test"
+	}
+	return b.String()
+}
+
+// pick returns the first value that is set
+func pick(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// pickBool returns the first value that is set, or def
+func pickBool(def bool, values ...*bool) bool {
+	for _, v := range values {
+		if v != nil {
+			return *v
+		}
+	}
+	return def
+}
@@ -0,0 +1,150 @@
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/api"
+)
+
+// maxBodyBytes limits how much of a response body is kept in the transcript
+const maxBodyBytes = 512
+
+// Entry is one line of the transcript (JSON Lines format)
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Type is "command", "request" or "result"
+	Type string `json:"type"`
+	PID  int    `json:"pid"`
+
+	// Command entries
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Flags   map[string]string `json:"flags,omitempty"`
+	Device  string            `json:"device,omitempty"`
+
+	// Request entries
+	Method     string   `json:"method,omitempty"`
+	URL        string   `json:"url,omitempty"`
+	Status     int      `json:"status,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+	Bytes      int      `json:"bytes,omitempty"`
+	WireBytes  int      `json:"wire_bytes,omitempty"`
+	Response   string   `json:"response,omitempty"`
+	DurationMS int64    `json:"duration_ms,omitempty"`
+
+	// Result entries
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Failed reports whether the entry is a request that failed: no response,
+// an HTTP error status or errors in the response
+func (e Entry) Failed() bool {
+	return e.Type == "request" && (e.Error != "" || e.Status >= 400 || len(e.Errors) > 0)
+}
+
+// Transcript appends a record of executed commands and API requests to a file
+type Transcript struct {
+	mu      sync.Mutex
+	file    *os.File
+	started time.Time
+}
+
+// Open opens (or creates) a transcript file for appending
+func Open(path string) (*Transcript, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transcript: %w", err)
+	}
+	return &Transcript{file: file, started: time.Now()}, nil
+}
+
+// Command records the start of a command with its resolved parameters
+func (t *Transcript) Command(command string, args []string, flags map[string]string, device string) {
+	t.write(Entry{
+		Type:    "command",
+		Command: command,
+		Args:    args,
+		Flags:   flags,
+		Device:  device,
+	})
+}
+
+// RecordRequest implements api.Recorder
+func (t *Transcript) RecordRequest(rec api.RequestRecord) {
+	entry := Entry{
+		Type:       "request",
+		Method:     rec.Method,
+		URL:        rec.URL,
+		Status:     rec.StatusCode,
+		Errors:     rec.Errors,
+		Bytes:      rec.ResponseBytes,
+		WireBytes:  rec.WireBytes,
+		DurationMS: rec.Duration.Milliseconds(),
+	}
+	if len(rec.Body) > 0 {
+		body := string(rec.Body)
+		if len(body) > maxBodyBytes {
+			body = body[:maxBodyBytes] + "..."
+		}
+		entry.Response = body
+	}
+	if rec.Err != nil {
+		entry.Error = rec.Err.Error()
+	}
+	t.write(entry)
+}
+
+// Close records the command result and closes the transcript
+func (t *Transcript) Close(exitCode int) error {
+	t.write(Entry{
+		Type:       "result",
+		ExitCode:   &exitCode,
+		DurationMS: time.Since(t.started).Milliseconds(),
+	})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.file.Close()
+}
+
+// write appends an entry as a single JSON line
+func (t *Transcript) write(entry Entry) {
+	entry.Time = time.Now()
+	entry.PID = os.Getpid()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.file.Write(append(line, '\n'))
+}
+
+// Read returns the entries of a transcript file, oldest first. Lines that
+// do not parse, e.g. one cut short by a crash, are skipped.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
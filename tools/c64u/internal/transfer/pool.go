@@ -0,0 +1,193 @@
+package transfer
+
+import (
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Uploader is a single connection able to upload files. Connections are
+// not shared between workers.
+type Uploader interface {
+	Upload(local, remote string) error
+	MkdirAll(dir string) error
+	Close() error
+}
+
+// Job is a single file to upload
+type Job struct {
+	Local  string
+	Remote string
+	Size   int64
+}
+
+// Result is the outcome of a job
+type Result struct {
+	Job
+	Err      error
+	Attempts int
+	Duration time.Duration
+}
+
+// Progress is an aggregate snapshot of a running transfer
+type Progress struct {
+	Done       int
+	Failed     int
+	Total      int
+	Bytes      int64
+	TotalBytes int64
+	Current    string
+}
+
+// Pool uploads jobs with a bounded number of parallel connections
+type Pool struct {
+	// Workers is the number of parallel connections (minimum 1)
+	Workers int
+	// Retries is the number of extra attempts per file
+	Retries int
+	// RetryDelay is the base delay between attempts, multiplied by the attempt
+	RetryDelay time.Duration
+	// Connect opens a new connection for a worker
+	Connect func() (Uploader, error)
+	// OnProgress is called after every completed job (optional)
+	OnProgress func(Progress)
+
+	mu       sync.Mutex
+	progress Progress
+}
+
+// Run uploads all jobs and returns their results in job order. Remote
+// directories are created up front over a single connection.
+func (p *Pool) Run(jobs []Job) ([]Result, error) {
+	results := make([]Result, len(jobs))
+	if len(jobs) == 0 {
+		return results, nil
+	}
+
+	p.progress = Progress{Total: len(jobs)}
+	for _, job := range jobs {
+		p.progress.TotalBytes += job.Size
+	}
+
+	if err := p.createDirs(jobs); err != nil {
+		return nil, err
+	}
+
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.worker(jobs, results, queue)
+		}()
+	}
+
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	return results, nil
+}
+
+// worker processes queued jobs over its own connection, reconnecting
+// after a failed attempt
+func (p *Pool) worker(jobs []Job, results []Result, queue <-chan int) {
+	var conn Uploader
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for i := range queue {
+		job := jobs[i]
+		res := Result{Job: job}
+		start := time.Now()
+
+		for attempt := 0; attempt <= p.Retries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(p.RetryDelay * time.Duration(attempt))
+			}
+			res.Attempts++
+
+			if conn == nil {
+				c, err := p.Connect()
+				if err != nil {
+					res.Err = err
+					continue
+				}
+				conn = c
+			}
+
+			res.Err = conn.Upload(job.Local, job.Remote)
+			if res.Err == nil {
+				break
+			}
+
+			// The connection may be unusable after a failure
+			conn.Close()
+			conn = nil
+		}
+
+		res.Duration = time.Since(start)
+		results[i] = res
+		p.report(res)
+	}
+}
+
+// createDirs creates the remote directories needed by jobs
+func (p *Pool) createDirs(jobs []Job) error {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, job := range jobs {
+		dir := path.Dir(job.Remote)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+
+	conn, err := p.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, dir := range dirs {
+		if err := conn.MkdirAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// report updates the aggregate progress with a finished job
+func (p *Pool) report(res Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if res.Err != nil {
+		p.progress.Failed++
+	} else {
+		p.progress.Done++
+		p.progress.Bytes += res.Size
+	}
+	p.progress.Current = res.Remote
+
+	if p.OnProgress != nil {
+		p.OnProgress(p.progress)
+	}
+}
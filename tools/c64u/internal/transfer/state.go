@@ -0,0 +1,91 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// State remembers the content hash of every file uploaded by sync, so
+// files with unchanged sizes but new contents are still detected
+type State struct {
+	path string
+	// Devices maps device address to remote path to SHA-256
+	Devices map[string]map[string]string `json:"devices"`
+}
+
+// LoadState reads the sync state at path. A missing file yields an empty state.
+func LoadState(path string) (*State, error) {
+	s := &State{path: path, Devices: make(map[string]map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state %s: %w", path, err)
+	}
+	if s.Devices == nil {
+		s.Devices = make(map[string]map[string]string)
+	}
+	return s, nil
+}
+
+// Save writes the state back to disk
+func (s *State) Save() error {
+	return writeJSON(s.path, s)
+}
+
+// writeJSON atomically writes a sync state file
+func writeJSON(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Hash returns the recorded hash of a remote file
+func (s *State) Hash(device, remote string) string {
+	return s.Devices[device][remote]
+}
+
+// SetHash records the hash of an uploaded remote file
+func (s *State) SetHash(device, remote, hash string) {
+	if s.Devices[device] == nil {
+		s.Devices[device] = make(map[string]string)
+	}
+	s.Devices[device][remote] = hash
+}
+
+// FileHash returns the hex SHA-256 of a local file
+func FileHash(local string) (string, error) {
+	file, err := os.Open(local)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,151 @@
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Two-way sync actions
+const (
+	ActionUpload       = "upload"
+	ActionDownload     = "download"
+	ActionDeleteLocal  = "delete-local"
+	ActionDeleteRemote = "delete-remote"
+	// ActionCompare means the file was created or changed on both sides
+	// with equal sizes; the contents must be compared to tell if they differ
+	ActionCompare  = "compare"
+	ActionConflict = "conflict"
+	// ActionForget means the file was deleted on both sides
+	ActionForget = "forget"
+)
+
+// FileState is a file on one side of a two-way sync. Local files carry a
+// hash; remote files a modification time, as FTP cannot hash them.
+type FileState struct {
+	Size int64
+	Time time.Time
+	Hash string
+}
+
+// Base is the state of a file after the last two-way sync
+type Base struct {
+	Hash       string    `json:"hash"`
+	RemoteSize int64     `json:"remote_size"`
+	RemoteTime time.Time `json:"remote_time"`
+}
+
+// Change is a planned two-way sync action for a relative path
+type Change struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// PlanTwoWay compares both sides with the state of the last sync and
+// returns the changes needed, sorted by path. Files changed on both sides,
+// or changed on one and deleted on the other, become conflicts.
+func PlanTwoWay(base map[string]Base, local, remote map[string]FileState) []Change {
+	paths := make(map[string]bool)
+	for p := range base {
+		paths[p] = true
+	}
+	for p := range local {
+		paths[p] = true
+	}
+	for p := range remote {
+		paths[p] = true
+	}
+
+	var changes []Change
+	for p := range paths {
+		b, synced := base[p]
+		l, hasLocal := local[p]
+		r, hasRemote := remote[p]
+
+		if !synced {
+			switch {
+			case hasLocal && hasRemote && l.Size == r.Size:
+				changes = append(changes, Change{Path: p, Action: ActionCompare})
+			case hasLocal && hasRemote:
+				changes = append(changes, Change{Path: p, Action: ActionConflict, Reason: "created on both sides"})
+			case hasLocal:
+				changes = append(changes, Change{Path: p, Action: ActionUpload, Reason: "new"})
+			case hasRemote:
+				changes = append(changes, Change{Path: p, Action: ActionDownload, Reason: "new"})
+			}
+			continue
+		}
+
+		localChanged := hasLocal && l.Hash != b.Hash
+		remoteChanged := hasRemote && (r.Size != b.RemoteSize || !r.Time.Equal(b.RemoteTime))
+
+		switch {
+		case !hasLocal && !hasRemote:
+			changes = append(changes, Change{Path: p, Action: ActionForget})
+		case localChanged && remoteChanged && l.Size == r.Size:
+			changes = append(changes, Change{Path: p, Action: ActionCompare})
+		case localChanged && remoteChanged:
+			changes = append(changes, Change{Path: p, Action: ActionConflict, Reason: "changed on both sides"})
+		case localChanged && !hasRemote:
+			changes = append(changes, Change{Path: p, Action: ActionConflict, Reason: "changed locally, deleted on the device"})
+		case remoteChanged && !hasLocal:
+			changes = append(changes, Change{Path: p, Action: ActionConflict, Reason: "changed on the device, deleted locally"})
+		case localChanged:
+			changes = append(changes, Change{Path: p, Action: ActionUpload, Reason: "changed"})
+		case remoteChanged:
+			changes = append(changes, Change{Path: p, Action: ActionDownload, Reason: "changed"})
+		case !hasLocal:
+			changes = append(changes, Change{Path: p, Action: ActionDeleteRemote, Reason: "deleted locally"})
+		case !hasRemote:
+			changes = append(changes, Change{Path: p, Action: ActionDeleteLocal, Reason: "deleted on the device"})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// TwoWayState keeps the base state of every two-way synced directory pair
+type TwoWayState struct {
+	path string
+	// Pairs maps a pair key to relative path to base state
+	Pairs map[string]map[string]Base `json:"pairs"`
+}
+
+// LoadTwoWayState reads the two-way sync state at path. A missing file
+// yields an empty state.
+func LoadTwoWayState(path string) (*TwoWayState, error) {
+	s := &TwoWayState{path: path, Pairs: make(map[string]map[string]Base)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state %s: %w", path, err)
+	}
+	if s.Pairs == nil {
+		s.Pairs = make(map[string]map[string]Base)
+	}
+	return s, nil
+}
+
+// Pair returns the base states of a directory pair, creating it if needed
+func (s *TwoWayState) Pair(key string) map[string]Base {
+	if s.Pairs[key] == nil {
+		s.Pairs[key] = make(map[string]Base)
+	}
+	return s.Pairs[key]
+}
+
+// Save writes the state back to disk
+func (s *TwoWayState) Save() error {
+	return writeJSON(s.path, s)
+}
@@ -0,0 +1,175 @@
+// Package vicemon is a client for the VICE binary monitor protocol
+// (x64sc -binarymonitor), enough to start a program and read memory.
+//
+// Requests are STX, API version, body length (uint32), request ID
+// (uint32), command and body; responses are STX, API version, body
+// length, response type, error code, request ID and body, all
+// little-endian. Events such as "stopped" carry the ID 0xFFFFFFFF.
+package vicemon
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// DefaultAddr is where VICE listens with -binarymonitor
+const DefaultAddr = "127.0.0.1:6502"
+
+const (
+	stx        = 0x02
+	apiVersion = 0x02
+)
+
+// Commands
+const (
+	cmdMemoryGet      = 0x01
+	cmdBanksAvailable = 0x82
+	cmdExit           = 0xAA
+	cmdQuit           = 0xBB
+	cmdAutostart      = 0xDD
+)
+
+// Client is a connection to the binary monitor. Any command stops the
+// emulation until Resume.
+type Client struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+	nextID  uint32
+	// bank is the ID of the "cpu" memory bank, the memory as the CPU sees it
+	bank uint16
+}
+
+// Dial connects to the binary monitor at addr
+func Dial(addr string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: conn, r: bufio.NewReader(conn), timeout: timeout}
+	if err := c.findBank("cpu"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection; the emulator keeps running
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Resume continues the emulation
+func (c *Client) Resume() error {
+	_, err := c.call(cmdExit, nil)
+	return err
+}
+
+// Quit ends the emulator
+func (c *Client) Quit() error {
+	_, err := c.call(cmdQuit, nil)
+	return err
+}
+
+// Autostart loads and runs a program file, a path on the emulator's host
+func (c *Client) Autostart(path string) error {
+	if len(path) > 255 {
+		return fmt.Errorf("path longer than 255 bytes: %s", path)
+	}
+	body := []byte{1, 0, 0, byte(len(path))}
+	_, err := c.call(cmdAutostart, append(body, path...))
+	return err
+}
+
+// ReadMemory reads length bytes at address without side effects on I/O
+// registers
+func (c *Client) ReadMemory(address, length int) ([]byte, error) {
+	if length <= 0 || address < 0 || address+length > 0x10000 {
+		return nil, fmt.Errorf("invalid range $%04X+%d", address, length)
+	}
+	body, err := c.call(cmdMemoryGet, c.memoryRange(address, length))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < 2 || int(binary.LittleEndian.Uint16(body)) != length || len(body) < 2+length {
+		return nil, fmt.Errorf("short read at $%04X", address)
+	}
+	return body[2 : 2+length], nil
+}
+
+// memoryRange is the body prefix of the memory commands: no side
+// effects, first and last address, main memory space, bank
+func (c *Client) memoryRange(address, length int) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint16(b[1:], uint16(address))
+	binary.LittleEndian.PutUint16(b[3:], uint16(address+length-1))
+	binary.LittleEndian.PutUint16(b[6:], c.bank)
+	return b
+}
+
+// findBank looks up the ID of a memory bank by name
+func (c *Client) findBank(name string) error {
+	body, err := c.call(cmdBanksAvailable, nil)
+	if err != nil {
+		return err
+	}
+	if len(body) < 2 {
+		return fmt.Errorf("invalid bank list")
+	}
+	count := int(binary.LittleEndian.Uint16(body))
+	pos := 2
+	for i := 0; i < count && pos < len(body); i++ {
+		size := int(body[pos])
+		item := body[pos+1:]
+		if size < 3 || len(item) < size {
+			break
+		}
+		if n := int(item[2]); 3+n <= size && string(item[3:3+n]) == name {
+			c.bank = binary.LittleEndian.Uint16(item)
+			return nil
+		}
+		pos += 1 + size
+	}
+	return fmt.Errorf("the monitor has no '%s' memory bank", name)
+}
+
+// call sends a command and returns the body of its response, skipping
+// events and responses to other requests
+func (c *Client) call(command byte, body []byte) ([]byte, error) {
+	c.nextID++
+	id := c.nextID
+	req := make([]byte, 11, 11+len(body))
+	req[0], req[1] = stx, apiVersion
+	binary.LittleEndian.PutUint32(req[2:], uint32(len(body)))
+	binary.LittleEndian.PutUint32(req[6:], id)
+	req[10] = command
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(append(req, body...)); err != nil {
+		return nil, err
+	}
+	for {
+		header := make([]byte, 12)
+		if _, err := io.ReadFull(c.r, header); err != nil {
+			return nil, err
+		}
+		if header[0] != stx {
+			return nil, fmt.Errorf("invalid response from the monitor")
+		}
+		resp := make([]byte, binary.LittleEndian.Uint32(header[2:]))
+		if _, err := io.ReadFull(c.r, resp); err != nil {
+			return nil, err
+		}
+		if binary.LittleEndian.Uint32(header[8:]) != id {
+			continue
+		}
+		if code := header[7]; code != 0 {
+			return nil, fmt.Errorf("monitor command $%02X failed with error $%02X", command, code)
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,119 @@
+// Package vicstream assembles the Ultimate 64 video stream into frames.
+//
+// Each UDP packet holds a 12-byte header and a few lines of 4-bit color
+// indexes, two pixels per byte with the left one in the low nibble. The
+// header fields are little-endian: sequence number, frame number, line
+// number (bit 15 marks the last packet of a frame), pixels per line,
+// lines per packet, bits per pixel and encoding.
+package vicstream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/cybersorcerer/c64.nvim/tools/c64u/internal/palette"
+)
+
+// HeaderSize is the size of the packet header
+const HeaderSize = 12
+
+// lastPacket is the line number bit of the last packet of a frame
+const lastPacket = 0x8000
+
+// Packet is one video stream packet
+type Packet struct {
+	Seq    uint16
+	Frame  uint16
+	Line   int
+	Last   bool
+	Width  int
+	Lines  int
+	Pixels []byte
+}
+
+// ParsePacket decodes a packet; the pixels refer to data
+func ParsePacket(data []byte) (*Packet, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("packet of %d bytes is shorter than the header", len(data))
+	}
+	line := binary.LittleEndian.Uint16(data[4:])
+	if bpp, encoding := data[9], binary.LittleEndian.Uint16(data[10:]); bpp != 4 || encoding != 0 {
+		return nil, fmt.Errorf("unsupported format: %d bits per pixel, encoding %d", bpp, encoding)
+	}
+	p := &Packet{
+		Seq:    binary.LittleEndian.Uint16(data[0:]),
+		Frame:  binary.LittleEndian.Uint16(data[2:]),
+		Line:   int(line &^ lastPacket),
+		Last:   line&lastPacket != 0,
+		Width:  int(binary.LittleEndian.Uint16(data[6:])),
+		Lines:  int(data[8]),
+		Pixels: data[HeaderSize:],
+	}
+	if p.Width == 0 || p.Width%2 != 0 || p.Lines == 0 {
+		return nil, fmt.Errorf("invalid size: %d pixels, %d lines", p.Width, p.Lines)
+	}
+	if len(p.Pixels) != p.Width/2*p.Lines {
+		return nil, fmt.Errorf("%d bytes of pixels for %d lines of %d", len(p.Pixels), p.Lines, p.Width)
+	}
+	return p, nil
+}
+
+// Frame is a picture of VIC-II color indexes, border included
+type Frame struct {
+	Number uint16
+	Width  int
+	Height int
+	Pixels []uint8
+}
+
+// Image returns the frame as a paletted image
+func (f *Frame) Image(pal *palette.Palette) *image.Paletted {
+	colors := make(color.Palette, palette.NumColors)
+	for i, c := range pal.Colors {
+		colors[i] = color.RGBA{R: c.R, G: c.G, B: c.B, A: 0xFF}
+	}
+	img := image.NewPaletted(image.Rect(0, 0, f.Width, f.Height), colors)
+	copy(img.Pix, f.Pixels)
+	return img
+}
+
+// Assembler collects packets into frames. Packets of one frame may
+// arrive in any order; a frame missing a packet is dropped when the next
+// frame starts.
+type Assembler struct {
+	frame  uint16
+	width  int
+	height int // known once the last packet arrived
+	lines  map[int][]byte
+}
+
+// Add adds a packet and returns the frame it completes, if any
+func (a *Assembler) Add(p *Packet) *Frame {
+	if a.lines == nil || p.Frame != a.frame || p.Width != a.width {
+		a.frame, a.width, a.height = p.Frame, p.Width, 0
+		a.lines = make(map[int][]byte)
+	}
+	a.lines[p.Line] = p.Pixels
+	if p.Last {
+		a.height = p.Line + p.Lines
+	}
+	if a.height == 0 || len(a.lines)*p.Lines < a.height {
+		return nil
+	}
+
+	f := &Frame{Number: a.frame, Width: a.width, Height: a.height, Pixels: make([]uint8, a.width*a.height)}
+	for line, data := range a.lines {
+		for i, b := range data {
+			at := line*a.width + 2*i
+			if at+1 >= len(f.Pixels) {
+				break
+			}
+			f.Pixels[at] = b & 0x0F
+			f.Pixels[at+1] = b >> 4
+		}
+	}
+	a.lines = nil
+	return f
+}